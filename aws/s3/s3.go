@@ -9,9 +9,9 @@ import (
 	"github.com/aws/aws-sdk-go/service/s3/s3manager"
 	"github.com/gofrs/uuid"
 	"io"
-	"log"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 )
 
@@ -20,25 +20,42 @@ var Session *session.Session
 
 var awsRegion = os.Getenv("AWS_S3_REGION")
 var awsBucketName = os.Getenv("AWS_S3_BUCKET")
+var awsEndpoint = os.Getenv("AWS_S3_ENDPOINT") // S3-compatible endpoint (e.g. MinIO), AWS is used if empty
+
+// awsStorage stores objects at AWS S3 or S3-compatible storage
+type awsStorage struct {
+	client   *s3.S3
+	session  *session.Session
+	bucket   string
+	region   string
+	endpoint string
+}
 
-func Setup() (err error) {
+func newAwsStorage() (*awsStorage, error) {
 	if awsRegion == "" || awsBucketName == "" {
-		log.Fatalf("required s3 env not provided")
+		return nil, fmt.Errorf("required s3 env not provided (AWS_S3_REGION, AWS_S3_BUCKET)")
 	}
 
 	config := aws.NewConfig()
 	config.Region = aws.String(awsRegion)
+	if awsEndpoint != "" {
+		// S3-compatible storages usually do not support virtual-hosted bucket addressing
+		config.Endpoint = aws.String(awsEndpoint)
+		config.S3ForcePathStyle = aws.Bool(true)
+	}
+
+	var err error
 	Session, err = session.NewSession(config)
 	if err != nil {
-		log.Fatalf("failed to initialize a new AWS session: %v", err)
+		return nil, fmt.Errorf("failed to initialize a new AWS session: %v", err)
 	}
 
 	S3 = s3.New(Session)
 	if S3 == nil {
-		return fmt.Errorf("failed to create a S3 client")
+		return nil, fmt.Errorf("failed to create a S3 client")
 	}
 
-	return nil
+	return &awsStorage{client: S3, session: Session, bucket: awsBucketName, region: awsRegion, endpoint: strings.TrimSuffix(awsEndpoint, "/")}, nil
 }
 
 func GetS3KeyForEntityFile(entityId uuid.UUID, fileId uuid.UUID) string {
@@ -49,25 +66,20 @@ func GetS3KeyForEntityUrl(url string) string {
 	return filepath.Base(filepath.Dir(url)) + "/" + filepath.Base(url)
 }
 
-func GetS3UrlForEntityFile(entityId uuid.UUID, fileId uuid.UUID) string {
-	return fmt.Sprintf("https://%s.s3-%s.amazonaws.com/%s/%s", awsBucketName, awsRegion, entityId.String(), fileId.String())
-}
-
-func GetS3UrlForFile(key string) string {
-	return fmt.Sprintf("https://%s.s3-%s.amazonaws.com/%s", awsBucketName, awsRegion, key)
+func (s *awsStorage) Url(key string) string {
+	if s.endpoint != "" {
+		return fmt.Sprintf("%s/%s/%s", s.endpoint, s.bucket, key)
+	}
+	return fmt.Sprintf("https://%s.s3-%s.amazonaws.com/%s", s.bucket, s.region, key)
 }
 
-func GetS3PresignedDownloadUrlForEntityFile(key string, duration time.Duration) (string, error) {
+func (s *awsStorage) PresignDownload(key string, duration time.Duration) (string, error) {
 	params := &s3.GetObjectInput{
-		Bucket: aws.String(awsBucketName),
+		Bucket: aws.String(s.bucket),
 		Key:    aws.String(key),
 	}
 
-	if duration == 0 {
-		duration = 360 * time.Minute
-	}
-
-	req, _ := S3.GetObjectRequest(params)
+	req, _ := s.client.GetObjectRequest(params)
 	url, err := req.Presign(duration) // Set link expiration time
 	if err != nil {
 		return "", fmt.Errorf("failed to get presigned url: %s", err.Error())
@@ -76,17 +88,13 @@ func GetS3PresignedDownloadUrlForEntityFile(key string, duration time.Duration)
 	return url, err
 }
 
-func GetS3PresignedUploadUrlForEntityFile(key string, duration time.Duration) (string, error) {
+func (s *awsStorage) PresignUpload(key string, duration time.Duration) (string, error) {
 	params := &s3.PutObjectInput{
-		Bucket: aws.String(awsBucketName),
+		Bucket: aws.String(s.bucket),
 		Key:    aws.String(key),
 	}
 
-	if duration == 0 {
-		duration = 360 * time.Minute
-	}
-
-	req, _ := S3.PutObjectRequest(params)
+	req, _ := s.client.PutObjectRequest(params)
 	url, err := req.Presign(duration) // Set link expiration time
 	if err != nil {
 		return "", fmt.Errorf("failed to get presigned url: %s", err.Error())
@@ -95,11 +103,7 @@ func GetS3PresignedUploadUrlForEntityFile(key string, duration time.Duration) (s
 	return url, err
 }
 
-func UploadObject(key string, body io.Reader, mime string, public bool, metadata *map[string]string, tags *map[string]string) (err error) {
-	if mime == "" {
-		mime = "application/octet-stream" // Default MIME
-	}
-
+func (s *awsStorage) Upload(key string, body io.Reader, mime string, public bool, metadata *map[string]string, tags *map[string]string) (err error) {
 	acl := "private"
 	if public {
 		acl = "public-read"
@@ -128,9 +132,9 @@ func UploadObject(key string, body io.Reader, mime string, public bool, metadata
 		filename = filepath.Base(*m["originalPath"])
 	}
 
-	uploader := s3manager.NewUploader(Session)
+	uploader := s3manager.NewUploader(s.session)
 	_, err = uploader.Upload(&s3manager.UploadInput{
-		Bucket:             aws.String(awsBucketName),
+		Bucket:             aws.String(s.bucket),
 		Key:                aws.String(key),
 		Body:               body,
 		Metadata:           m,
@@ -143,9 +147,9 @@ func UploadObject(key string, body io.Reader, mime string, public bool, metadata
 	return err
 }
 
-func ObjectExists(key string) bool {
-	_, err := S3.HeadObject(&s3.HeadObjectInput{
-		Bucket: aws.String(awsBucketName),
+func (s *awsStorage) Exists(key string) bool {
+	_, err := s.client.HeadObject(&s3.HeadObjectInput{
+		Bucket: aws.String(s.bucket),
 		Key:    aws.String(key),
 	})
 
@@ -167,9 +171,9 @@ func ObjectExists(key string) bool {
 	return true
 }
 
-func DeleteObject(key string) error {
-	_, err := S3.DeleteObject(&s3.DeleteObjectInput{
-		Bucket: aws.String(awsBucketName),
+func (s *awsStorage) Delete(key string) error {
+	_, err := s.client.DeleteObject(&s3.DeleteObjectInput{
+		Bucket: aws.String(s.bucket),
 		Key:    aws.String(key),
 	})
 
@@ -177,8 +181,220 @@ func DeleteObject(key string) error {
 		return err
 	}
 
-	return S3.WaitUntilObjectNotExists(&s3.HeadObjectInput{
-		Bucket: aws.String(awsBucketName),
+	return s.client.WaitUntilObjectNotExists(&s3.HeadObjectInput{
+		Bucket: aws.String(s.bucket),
 		Key:    aws.String(key),
 	})
 }
+
+func (s *awsStorage) SetPublic(key string, public bool) error {
+	acl := "private"
+	if public {
+		acl = "public-read"
+	}
+
+	_, err := s.client.PutObjectAcl(&s3.PutObjectAclInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+		ACL:    aws.String(acl),
+	})
+
+	return err
+}
+
+func (s *awsStorage) Info(key string) (size int64, mime string, err error) {
+	out, err := s.client.HeadObject(&s3.HeadObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return 0, "", err
+	}
+
+	return aws.Int64Value(out.ContentLength), aws.StringValue(out.ContentType), nil
+}
+
+func (s *awsStorage) Head(key string, n int64) ([]byte, error) {
+	out, err := s.client.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+		Range:  aws.String(fmt.Sprintf("bytes=0-%d", n-1)),
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer out.Body.Close()
+
+	return io.ReadAll(out.Body)
+}
+
+func (s *awsStorage) Stat(key string) (ObjectStat, error) {
+	out, err := s.client.HeadObject(&s3.HeadObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return ObjectStat{}, err
+	}
+
+	return ObjectStat{
+		Size:         aws.Int64Value(out.ContentLength),
+		Mime:         aws.StringValue(out.ContentType),
+		ETag:         aws.StringValue(out.ETag),
+		LastModified: aws.TimeValue(out.LastModified),
+	}, nil
+}
+
+func (s *awsStorage) Read(key string, offset int64, length int64) (io.ReadCloser, error) {
+	out, err := s.client.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+		Range:  aws.String(fmt.Sprintf("bytes=%d-%d", offset, offset+length-1)),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return out.Body, nil
+}
+
+func (s *awsStorage) Open(key string) (io.ReadCloser, error) {
+	out, err := s.client.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return out.Body, nil
+}
+
+func (s *awsStorage) CreateMultipartUpload(key string, mime string, public bool, metadata *map[string]string) (uploadId string, err error) {
+	acl := "private"
+	if public {
+		acl = "public-read"
+	}
+
+	m := map[string]*string{}
+	if metadata != nil {
+		for k, v := range *metadata {
+			m[k] = aws.String(v)
+		}
+	}
+
+	var filename string
+	if m["originalPath"] != nil {
+		filename = filepath.Base(*m["originalPath"])
+	}
+
+	out, err := s.client.CreateMultipartUpload(&s3.CreateMultipartUploadInput{
+		Bucket:             aws.String(s.bucket),
+		Key:                aws.String(key),
+		Metadata:           m,
+		ContentType:        aws.String(mime),
+		ContentDisposition: aws.String(fmt.Sprintf("attachment; filename=\"%s\"", filename)),
+		ACL:                aws.String(acl),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return aws.StringValue(out.UploadId), nil
+}
+
+func (s *awsStorage) PresignUploadPart(key string, uploadId string, partNumber int64, duration time.Duration) (string, error) {
+	params := &s3.UploadPartInput{
+		Bucket:     aws.String(s.bucket),
+		Key:        aws.String(key),
+		UploadId:   aws.String(uploadId),
+		PartNumber: aws.Int64(partNumber),
+	}
+
+	req, _ := s.client.UploadPartRequest(params)
+	url, err := req.Presign(duration) // Set link expiration time
+	if err != nil {
+		return "", fmt.Errorf("failed to get presigned url: %s", err.Error())
+	}
+
+	return url, err
+}
+
+func (s *awsStorage) ListUploadedParts(key string, uploadId string) (parts []UploadedPart, err error) {
+	input := &s3.ListPartsInput{
+		Bucket:   aws.String(s.bucket),
+		Key:      aws.String(key),
+		UploadId: aws.String(uploadId),
+	}
+
+	err = s.client.ListPartsPages(input, func(page *s3.ListPartsOutput, lastPage bool) bool {
+		for _, p := range page.Parts {
+			parts = append(parts, UploadedPart{
+				PartNumber:   aws.Int64Value(p.PartNumber),
+				ETag:         aws.StringValue(p.ETag),
+				Size:         aws.Int64Value(p.Size),
+				LastModified: aws.TimeValue(p.LastModified),
+			})
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return parts, nil
+}
+
+func (s *awsStorage) CompleteMultipartUpload(key string, uploadId string, parts []UploadedPart) error {
+	completed := make([]*s3.CompletedPart, 0, len(parts))
+	for _, p := range parts {
+		completed = append(completed, &s3.CompletedPart{
+			ETag:       aws.String(p.ETag),
+			PartNumber: aws.Int64(p.PartNumber),
+		})
+	}
+
+	_, err := s.client.CompleteMultipartUpload(&s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(s.bucket),
+		Key:             aws.String(key),
+		UploadId:        aws.String(uploadId),
+		MultipartUpload: &s3.CompletedMultipartUpload{Parts: completed},
+	})
+
+	return err
+}
+
+func (s *awsStorage) AbortMultipartUpload(key string, uploadId string) error {
+	_, err := s.client.AbortMultipartUpload(&s3.AbortMultipartUploadInput{
+		Bucket:   aws.String(s.bucket),
+		Key:      aws.String(key),
+		UploadId: aws.String(uploadId),
+	})
+
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == s3.ErrCodeNoSuchUpload {
+			return nil // Already aborted or completed
+		}
+	}
+
+	return err
+}
+
+func (s *awsStorage) List(prefix string, fn func(object ObjectInfo) bool) error {
+	input := &s3.ListObjectsV2Input{
+		Bucket: aws.String(s.bucket),
+	}
+
+	if prefix != "" {
+		input.Prefix = aws.String(prefix)
+	}
+
+	return s.client.ListObjectsV2Pages(input, func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+		for _, o := range page.Contents {
+			if !fn(ObjectInfo{Key: aws.StringValue(o.Key), Size: aws.Int64Value(o.Size), LastModified: aws.TimeValue(o.LastModified)}) {
+				return false
+			}
+		}
+		return true
+	})
+}
@@ -0,0 +1,271 @@
+package s3
+
+import (
+	"context"
+	"fmt"
+	"github.com/gofrs/uuid"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// Storage is a file object storage backend, object keys have the {entityId}/{fileId} form
+type Storage interface {
+	// Url returns the static url of the object
+	Url(key string) string
+	// PresignDownload returns a temporary url to download the object
+	PresignDownload(key string, duration time.Duration) (string, error)
+	// PresignUpload returns a temporary url to upload the object with a PUT request
+	PresignUpload(key string, duration time.Duration) (string, error)
+
+	Upload(key string, body io.Reader, mime string, public bool, metadata *map[string]string, tags *map[string]string) error
+	Exists(key string) bool
+	Delete(key string) error
+	// SetPublic changes the ACL of the object, public objects can be downloaded using the static url
+	SetPublic(key string, public bool) error
+	// Info returns the size and MIME type of the object
+	Info(key string) (size int64, mime string, err error)
+	// Head reads up to n first bytes of the object
+	Head(key string, n int64) ([]byte, error)
+	// Open returns a reader of the object contents, the reader must be closed
+	Open(key string) (io.ReadCloser, error)
+	// Stat returns the size, MIME type, ETag and modification time of the object
+	Stat(key string) (ObjectStat, error)
+	// Read returns a reader of length bytes of the object contents starting at the offset, the reader must be closed
+	Read(key string, offset int64, length int64) (io.ReadCloser, error)
+
+	CreateMultipartUpload(key string, mime string, public bool, metadata *map[string]string) (uploadId string, err error)
+	PresignUploadPart(key string, uploadId string, partNumber int64, duration time.Duration) (string, error)
+	ListUploadedParts(key string, uploadId string) ([]UploadedPart, error)
+	CompleteMultipartUpload(key string, uploadId string, parts []UploadedPart) error
+	AbortMultipartUpload(key string, uploadId string) error
+
+	// List calls fn for every object with the key prefix until fn returns false
+	List(prefix string, fn func(object ObjectInfo) bool) error
+}
+
+const StorageBackendS3 = "s3"
+
+var storageBackend = os.Getenv("STORAGE_BACKEND") // s3 (default, AWS or S3-compatible endpoint such as MinIO) or a registered backend such as local
+
+var storage Storage
+
+// storageBackends are constructors of the storage backends implemented outside of this package
+var storageBackends = map[string]func() (Storage, error){}
+
+// UploadedPart is a part of the multipart upload stored at S3
+type UploadedPart struct {
+	PartNumber   int64     `json:"partNumber"`
+	ETag         string    `json:"etag"`
+	Size         int64     `json:"size"`
+	LastModified time.Time `json:"lastModified"`
+}
+
+// ObjectStat is the object metadata used to serve the object
+type ObjectStat struct {
+	Size         int64
+	Mime         string
+	ETag         string // Quoted entity tag of the object contents
+	LastModified time.Time
+}
+
+// ObjectInfo is an object listed from the storage
+type ObjectInfo struct {
+	Key          string
+	Size         int64
+	LastModified time.Time
+}
+
+// Setup initializes the storage backend configured by the STORAGE_BACKEND env
+func Setup() (err error) {
+	switch storageBackend {
+	case "", StorageBackendS3:
+		storage, err = newAwsStorage()
+	default:
+		constructor, ok := storageBackends[storageBackend]
+		if !ok {
+			return fmt.Errorf("unsupported storage backend: %s", storageBackend)
+		}
+		storage, err = constructor()
+	}
+
+	return err
+}
+
+// RegisterStorageBackend registers the storage backend selectable by the STORAGE_BACKEND env, must be called before Setup
+func RegisterStorageBackend(name string, constructor func() (Storage, error)) {
+	storageBackends[name] = constructor
+}
+
+// GetStorage returns the configured storage backend
+func GetStorage() Storage {
+	return storage
+}
+
+func GetS3UrlForEntityFile(entityId uuid.UUID, fileId uuid.UUID) string {
+	return storage.Url(GetS3KeyForEntityFile(entityId, fileId))
+}
+
+// IsStorageUrl returns true if the url is the static url of an object of the configured storage
+func IsStorageUrl(url string) bool {
+	return url != "" && storage.Url(GetS3KeyForEntityUrl(url)) == url
+}
+
+func GetS3UrlForFile(key string) string {
+	return storage.Url(key)
+}
+
+func GetS3PresignedDownloadUrlForEntityFile(key string, duration time.Duration) (string, error) {
+	if duration == 0 {
+		duration = 360 * time.Minute
+	}
+
+	return storage.PresignDownload(key, duration)
+}
+
+func GetS3PresignedUploadUrlForEntityFile(key string, duration time.Duration) (string, error) {
+	if duration == 0 {
+		duration = 360 * time.Minute
+	}
+
+	return storage.PresignUpload(key, duration)
+}
+
+func UploadObject(key string, body io.Reader, mime string, public bool, metadata *map[string]string, tags *map[string]string) (err error) {
+	if mime == "" {
+		mime = "application/octet-stream" // Default MIME
+	}
+
+	return storage.Upload(key, body, mime, public, metadata, tags)
+}
+
+func ObjectExists(key string) bool {
+	return storage.Exists(key)
+}
+
+func DeleteObject(key string) error {
+	return storage.Delete(key)
+}
+
+// SetObjectPublic changes the ACL of the object (e.g. when the entity is published or the file has been scanned)
+func SetObjectPublic(key string, public bool) error {
+	return storage.SetPublic(key, public)
+}
+
+func CreateMultipartUpload(key string, mime string, public bool, metadata *map[string]string) (uploadId string, err error) {
+	if mime == "" {
+		mime = "application/octet-stream" // Default MIME
+	}
+
+	return storage.CreateMultipartUpload(key, mime, public, metadata)
+}
+
+func GetS3PresignedUploadPartUrl(key string, uploadId string, partNumber int64, duration time.Duration) (string, error) {
+	if duration == 0 {
+		duration = 360 * time.Minute
+	}
+
+	return storage.PresignUploadPart(key, uploadId, partNumber, duration)
+}
+
+func ListUploadedParts(key string, uploadId string) (parts []UploadedPart, err error) {
+	return storage.ListUploadedParts(key, uploadId)
+}
+
+func CompleteMultipartUpload(key string, uploadId string, parts []UploadedPart) error {
+	return storage.CompleteMultipartUpload(key, uploadId, parts)
+}
+
+// AbortMultipartUpload aborts the upload, uploads that have already been aborted or completed are ignored
+func AbortMultipartUpload(key string, uploadId string) error {
+	return storage.AbortMultipartUpload(key, uploadId)
+}
+
+// GetObjectInfo returns the size and MIME type of the object
+func GetObjectInfo(key string) (size int64, mime string, err error) {
+	return storage.Info(key)
+}
+
+// GetObjectHead reads up to n first bytes of the object (e.g. to detect its MIME type)
+func GetObjectHead(key string, n int64) ([]byte, error) {
+	return storage.Head(key, n)
+}
+
+// OpenObject returns a reader of the object contents (e.g. to scan the object), the reader must be closed
+func OpenObject(key string) (io.ReadCloser, error) {
+	return storage.Open(key)
+}
+
+// OpenObjectContext returns a reader of the object contents which stops once the context is done (e.g. when the client has disconnected), the reader must be closed
+func OpenObjectContext(ctx context.Context, key string) (io.ReadCloser, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	body, err := storage.Open(key)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &contextReader{ctx: ctx, body: body, done: make(chan struct{})}
+	go func() {
+		select {
+		case <-ctx.Done():
+			// Closing the body interrupts the pending read
+			_ = r.closeBody()
+		case <-r.done:
+		}
+	}()
+
+	return r, nil
+}
+
+// contextReader fails reads of the object body once the context is done
+type contextReader struct {
+	ctx      context.Context
+	body     io.ReadCloser
+	done     chan struct{}
+	doneOnce sync.Once
+	bodyOnce sync.Once
+	bodyErr  error
+}
+
+func (r *contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	n, err := r.body.Read(p)
+	if err != nil {
+		if ctxErr := r.ctx.Err(); ctxErr != nil {
+			return n, ctxErr
+		}
+	}
+	return n, err
+}
+
+func (r *contextReader) Close() error {
+	r.doneOnce.Do(func() { close(r.done) })
+	return r.closeBody()
+}
+
+func (r *contextReader) closeBody() error {
+	r.bodyOnce.Do(func() { r.bodyErr = r.body.Close() })
+	return r.bodyErr
+}
+
+// StatObject returns the size, MIME type, ETag and modification time of the object
+func StatObject(key string) (ObjectStat, error) {
+	return storage.Stat(key)
+}
+
+// ReadObject returns a reader of length bytes of the object contents starting at the offset (e.g. to serve a range request), the reader must be closed
+func ReadObject(key string, offset int64, length int64) (io.ReadCloser, error) {
+	return storage.Read(key, offset, length)
+}
+
+// ListObjects calls fn for every object with the key prefix until fn returns false
+func ListObjects(prefix string, fn func(object ObjectInfo) bool) error {
+	return storage.List(prefix, fn)
+}
@@ -0,0 +1,59 @@
+begin;
+
+-- file object acls (objects of files of public entities are publicly readable)
+
+create table if not exists file_acl_jobs
+(
+    id         uuid      default gen_random_uuid() not null
+        primary key,
+    entity_id  uuid                                not null, -- entity which files should have their object acls updated
+    status     text      default 'pending'         not null, -- pending, completed or failed
+    attempts   integer   default 0                 not null,
+    error      text,
+    created_at timestamp default now()             not null,
+    updated_at timestamp
+);
+
+comment on table file_acl_jobs is 'File acl jobs table (entities published or unpublished since their files have been uploaded, object acls are updated by the background worker).';
+
+create index if not exists file_acl_jobs_status_created_at_idx
+    on file_acl_jobs (status, created_at)
+    where status = 'pending';
+
+create index if not exists file_acl_jobs_entity_id_idx
+    on file_acl_jobs (entity_id);
+
+-- queue the acl update whenever the entity is published or unpublished
+
+create or replace function file_acl_jobs_enqueue()
+    returns trigger
+    language plpgsql
+as
+$$
+begin
+    if coalesce(old.public, false) is distinct from coalesce(new.public, false) and
+       not exists (select 1 from file_acl_jobs j where j.entity_id = new.id and j.status = 'pending') then
+        insert into file_acl_jobs (entity_id, status, created_at) values (new.id, 'pending', now());
+    end if;
+
+    return null;
+end;
+$$;
+
+drop trigger if exists entities_file_acl_jobs on entities;
+
+create trigger entities_file_acl_jobs
+    after update of public
+    on entities
+    for each row
+execute function file_acl_jobs_enqueue();
+
+-- acls of existing objects have been fixed at upload time, queue all entities with stored files
+
+insert into file_acl_jobs (entity_id, status, created_at)
+select distinct f.entity_id, 'pending', now()
+from files f
+where f.entity_id is not null
+  and not exists (select 1 from file_acl_jobs j where j.entity_id = f.entity_id and j.status = 'pending');
+
+commit;
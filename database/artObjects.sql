@@ -0,0 +1,17 @@
+begin;
+
+-- faceted art object browsing
+
+-- the date is free text (e.g. c. 1503-1506), the first three or four digit number is used as the year
+alter table objects
+    add column if not exists year integer generated always as ((substring(date from '(\d{3,4})'))::integer) stored;
+
+comment on column objects.year is 'Year parsed from the free text date, used by date range filters and sorting.';
+
+create index if not exists objects_artist_idx on objects (artist);
+create index if not exists objects_medium_idx on objects (medium);
+create index if not exists objects_license_idx on objects (license);
+create index if not exists objects_origin_idx on objects (origin);
+create index if not exists objects_year_idx on objects (year);
+
+commit;
@@ -0,0 +1,65 @@
+begin;
+
+-- content-addressed file blobs
+
+create table if not exists file_blobs
+(
+    hash       text                              not null
+        primary key,                                       -- SHA-256 of the file contents (lowercase hex)
+    key        text                              not null, -- S3 object key of the blob (key of the file it has been uploaded with)
+    url        text                              not null, -- S3 object url
+    size       bigint                            not null,
+    mime       text,
+    ref_count  bigint    default 0               not null, -- number of files referencing the blob, maintained by the files trigger
+    created_at timestamp default now()           not null,
+    updated_at timestamp
+);
+
+comment on table file_blobs is 'File blobs table (content-addressed S3 objects shared by files with identical contents, the object is deleted when the last referencing file is deleted).';
+
+alter table files
+    add column if not exists blob_hash text
+        references file_blobs
+            on delete set null;
+
+comment on column files.blob_hash is 'Content-addressed blob the file is stored in, null if the file owns its S3 object.';
+
+create index if not exists files_blob_hash_idx
+    on files (blob_hash);
+
+create unique index if not exists file_blobs_key_uindex
+    on file_blobs (key);
+
+create index if not exists file_blobs_ref_count_idx
+    on file_blobs (ref_count)
+    where ref_count <= 0;
+
+-- reference counting
+
+create or replace function file_blobs_ref_count()
+    returns trigger
+    language plpgsql
+as
+$$
+begin
+    if tg_op in ('UPDATE', 'DELETE') and old.blob_hash is not null then
+        update file_blobs set ref_count = ref_count - 1, updated_at = now() where hash = old.blob_hash;
+    end if;
+
+    if tg_op in ('INSERT', 'UPDATE') and new.blob_hash is not null then
+        update file_blobs set ref_count = ref_count + 1, updated_at = now() where hash = new.blob_hash;
+    end if;
+
+    return null;
+end;
+$$;
+
+drop trigger if exists files_blob_ref_count on files;
+
+create trigger files_blob_ref_count
+    after insert or delete or update of blob_hash
+    on files
+    for each row
+execute function file_blobs_ref_count();
+
+commit;
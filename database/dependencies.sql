@@ -0,0 +1,20 @@
+begin;
+
+-- package dependencies with semver constraints
+
+create table if not exists package_dependencies
+(
+    package_id         uuid                                   not null references mods (id) on delete cascade,
+    dependency_id      uuid                                   not null references mods (id) on delete restrict,
+    version_constraint text                                   not null, -- semver constraint, e.g. ^1.2 or >= 1.0, < 2.0
+    created_at         timestamp with time zone default now() not null,
+    primary key (package_id, dependency_id),
+    constraint package_dependencies_no_self_dependency check (package_id <> dependency_id)
+);
+
+comment on table package_dependencies is 'Packages required by the package, the dependency version must satisfy the constraint.';
+
+-- dependents are looked up when a dependency is rebuilt
+create index if not exists package_dependencies_dependency_id_idx on package_dependencies (dependency_id);
+
+commit;
@@ -0,0 +1,45 @@
+begin;
+
+-- image derivatives (resized and re-encoded copies of uploaded images)
+
+alter table files
+    add column if not exists derivative_of uuid;
+
+alter table files
+    add column if not exists derivative_size text;
+
+alter table files
+    add column if not exists derivative_format text;
+
+comment on column files.derivative_of is 'Source image file the derivative has been generated from, not a foreign key as the source file id changes when it is re-uploaded, derivatives of removed sources are deleted by the derivative worker.';
+comment on column files.derivative_size is 'Named size of the derivative (e.g. preview, texture).';
+comment on column files.derivative_format is 'Image format of the derivative (jpeg, png or webp).';
+
+create index if not exists files_derivative_of_idx
+    on files (derivative_of)
+    where derivative_of is not null;
+
+-- derivative generation queue
+
+create table if not exists image_derivative_jobs
+(
+    id         uuid      default gen_random_uuid() not null
+        primary key,
+    file_id    uuid                                not null, -- source image file
+    status     text      default 'pending'         not null, -- pending, processing (claimed by a worker), completed or failed
+    attempts   integer   default 0                 not null,
+    error      text,
+    created_at timestamp default now()             not null,
+    updated_at timestamp
+);
+
+comment on table image_derivative_jobs is 'Image derivative jobs table (source image files queued for derivative generation by the background worker).';
+
+create index if not exists image_derivative_jobs_status_created_at_idx
+    on image_derivative_jobs (status, created_at)
+    where status = 'pending';
+
+create index if not exists image_derivative_jobs_file_id_idx
+    on image_derivative_jobs (file_id);
+
+commit;
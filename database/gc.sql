@@ -0,0 +1,23 @@
+begin;
+
+-- storage garbage collection runs
+
+create table if not exists object_gc_runs
+(
+    id          uuid      default gen_random_uuid() not null
+        primary key,
+    dry_run     boolean   default true              not null, -- orphans are only reported
+    status      text      default 'running'         not null, -- running, finished or failed
+    report      jsonb,                                        -- orphans and files without objects found by the run
+    error       text,
+    created_by  uuid,                                         -- admin who started the run, null for scheduled runs
+    created_at  timestamp default now()             not null,
+    finished_at timestamp
+);
+
+comment on table object_gc_runs is 'Storage garbage collection runs table (background reconciliations of storage objects with file records).';
+
+create index if not exists object_gc_runs_created_at_idx
+    on object_gc_runs (created_at desc);
+
+commit;
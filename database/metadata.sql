@@ -0,0 +1,10 @@
+begin;
+
+-- extracted asset metadata
+
+alter table files
+    add column if not exists metadata jsonb;
+
+comment on column files.metadata is 'Metadata extracted from the uploaded asset (glTF triangle, vertex, material and texture counts, bounding box, animation names and embedded texture dimensions), null for other files.';
+
+commit;
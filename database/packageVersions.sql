@@ -0,0 +1,195 @@
+begin;
+
+-- immutable package versions
+
+create table if not exists package_versions
+(
+    id          uuid                    not null
+        primary key
+        references entities
+            on delete cascade,                     -- pak files of the version are attached to the version entity
+    package_id  uuid                    not null
+        references mods
+            on delete cascade,
+    version     text                    not null, -- semver, greater than all previous versions of the package
+    changelog   text    default ''      not null,
+    deprecated  boolean default false   not null, -- deprecated versions are skipped as the latest version and by dependency resolution unless nothing else matches
+    created_by  uuid,
+    released_at timestamp default now() not null,
+    unique (package_id, version)
+);
+
+comment on table package_versions is 'Package versions table (published versions of the package, each version is built into its own pak files and can not be changed except for the deprecation flag).';
+
+create index if not exists package_versions_package_id_idx
+    on package_versions (package_id, released_at desc);
+
+create or replace function package_versions_immutable()
+    returns trigger
+    language plpgsql
+as
+$$
+begin
+    if new.package_id <> old.package_id or new.version <> old.version or new.changelog <> old.changelog or new.released_at <> old.released_at then
+        raise exception 'package version % is immutable', old.version;
+    end if;
+    return new;
+end;
+$$;
+
+drop trigger if exists package_versions_immutable on package_versions;
+
+create trigger package_versions_immutable
+    before update
+    on package_versions
+    for each row
+execute function package_versions_immutable();
+
+-- the latest version is resolved when requested so a version is not served before its paks are built, mods.version keeps the newest published version string, packages without versions keep pak files attached to the package entity
+-- paks built before versions were introduced stay on the package entity, so readers resolving paks by the package id keep working, the package paks are served until a version has a pak for the platform and deployment
+
+create or replace function package_latest_version(package_id uuid, platform text, deployment text)
+    returns uuid
+    language sql
+    stable
+as
+$$
+select pv.id
+from package_versions pv
+where pv.package_id = $1
+  and ($2 = '' or -- the package pak is used if no version has a pak for the platform and deployment
+       exists (select 1 from files f where f.entity_id = pv.id and f.type = 'pak' and f.platform = $2 and ($3 = '' or f.deployment_type = $3)) or
+       not exists (select 1 from files f where f.entity_id = pv.package_id and f.type = 'pak' and f.platform = $2 and ($3 = '' or f.deployment_type = $3)))
+order by exists (select 1
+                 from files f
+                 where f.entity_id = pv.id
+                   and f.type = 'pak'
+                   and ($2 = '' or f.platform = $2)
+                   and ($3 = '' or f.deployment_type = $3)) desc, -- versions without paks for the platform and deployment are only used if no version has them
+         pv.deprecated,                                            -- deprecated versions are only used if all built versions are deprecated
+         pv.released_at desc
+limit 1
+$$;
+
+comment on function package_latest_version(uuid, text, text) is 'Latest version of the package, the newest not deprecated version with a pak for the platform and deployment (empty values match any), null if only the package entity has a pak for the platform and deployment.';
+
+-- package jobs build the newest version
+
+create or replace function package_newest_version(package_id uuid)
+    returns uuid
+    language sql
+    stable
+as
+$$
+select pv.id
+from package_versions pv
+where pv.package_id = $1
+order by pv.released_at desc
+limit 1
+$$;
+
+comment on function package_newest_version(uuid) is 'Newest published version of the package, package jobs build its paks.';
+
+-- dependencies of the version are snapshotted on publish, package_dependencies is the set the next version is published with
+
+create table if not exists package_version_dependencies
+(
+    version_id         uuid not null references package_versions (id) on delete cascade,
+    dependency_id      uuid not null references mods (id) on delete restrict,
+    version_constraint text not null, -- semver constraint, e.g. ^1.2 or >= 1.0, < 2.0
+    primary key (version_id, dependency_id)
+);
+
+comment on table package_version_dependencies is 'Packages required by the package version at the time it was published, the dependency version must satisfy the constraint.';
+
+create index if not exists package_version_dependencies_dependency_id_idx
+    on package_version_dependencies (dependency_id);
+
+-- version entities follow the visibility and accessibles of their package so access changes of the package apply to its versions
+
+create or replace function package_versions_sync_public()
+    returns trigger
+    language plpgsql
+as
+$$
+begin
+    if old.public is distinct from new.public then
+        update entities e
+        set public = new.public
+        from package_versions pv
+        where pv.package_id = new.id
+          and e.id = pv.id;
+    end if;
+
+    return null;
+end;
+$$;
+
+drop trigger if exists entities_package_versions_public on entities;
+
+create trigger entities_package_versions_public
+    after update of public
+    on entities
+    for each row
+    when (new.entity_type = 'mod')
+execute function package_versions_sync_public();
+
+create or replace function package_versions_sync_accessibles()
+    returns trigger
+    language plpgsql
+as
+$$
+begin
+    -- only accessibles of packages with versions are copied, the trigger is not fired by the version rows written below
+    if not exists (select 1 from package_versions pv where pv.package_id in (old.entity_id, new.entity_id)) then
+        return null;
+    end if;
+
+    if tg_op in ('UPDATE', 'DELETE') then
+        delete
+        from accessibles a
+            using package_versions pv
+        where pv.package_id = old.entity_id
+          and a.entity_id = pv.id
+          and a.user_id = old.user_id;
+    end if;
+
+    if tg_op in ('INSERT', 'UPDATE') then
+        insert into accessibles (user_id, entity_id, is_owner, can_view, can_edit, can_delete)
+        select new.user_id, pv.id, new.is_owner, new.can_view, new.can_edit, new.can_delete
+        from package_versions pv
+        where pv.package_id = new.entity_id;
+    end if;
+
+    return null;
+end;
+$$;
+
+drop trigger if exists accessibles_package_versions on accessibles;
+
+drop trigger if exists accessibles_package_versions_update on accessibles;
+
+create trigger accessibles_package_versions
+    after insert or delete
+    on accessibles
+    for each row
+    when (pg_trigger_depth() < 1)
+execute function package_versions_sync_accessibles();
+
+create trigger accessibles_package_versions_update
+    after update
+    on accessibles
+    for each row
+    when (pg_trigger_depth() < 1 and old.* is distinct from new.*)
+execute function package_versions_sync_accessibles();
+
+-- worlds can pin the version of their package
+
+alter table spaces
+    add column if not exists mod_version_id uuid
+        references package_versions
+            on delete set null;
+
+comment on column spaces.mod_version_id is 'Pinned version of the world package, the latest version is used if not set.';
+
+commit;
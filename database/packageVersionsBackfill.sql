@@ -0,0 +1,40 @@
+begin;
+
+-- packages published before versions were introduced get a version for their current version string, applied after packageVersions.sql
+
+create temporary table package_versions_backfill on commit drop as
+select gen_random_uuid()                             as id,
+       m.id                                          as package_id,
+       m.version                                     as version,
+       e.public                                      as public,
+       coalesce(m.released_at, e.created_at, now()) as released_at
+from mods m
+    join entities e on e.id = m.id
+where coalesce(m.version, '') <> ''
+  and not exists (select 1 from package_versions pv where pv.package_id = m.id);
+
+insert into entities (id, entity_type, public)
+select b.id, 'mod_version', b.public
+from package_versions_backfill b;
+
+insert into accessibles (user_id, entity_id, is_owner, can_view, can_edit, can_delete)
+select a.user_id, b.id, a.is_owner, a.can_view, a.can_edit, a.can_delete
+from package_versions_backfill b
+    join accessibles a on a.entity_id = b.package_id;
+
+insert into package_versions (id, package_id, version, released_at)
+select b.id, b.package_id, b.version, b.released_at
+from package_versions_backfill b;
+
+-- pak files stay on the package entity, readers resolving paks by the package id keep serving them and package_latest_version falls back to them until the next version is built
+
+-- versions published without a dependency snapshot depend on the current dependencies of their package
+
+insert into package_version_dependencies (version_id, dependency_id, version_constraint)
+select pv.id, pd.dependency_id, pd.version_constraint
+from package_versions pv
+    join package_dependencies pd on pd.package_id = pv.package_id
+where not exists (select 1 from package_version_dependencies vd where vd.version_id = pv.id)
+on conflict do nothing;
+
+commit;
@@ -0,0 +1,27 @@
+begin;
+
+-- portal graph integrity
+
+-- clear destinations pointing to deleted portals and to the portal itself
+update portals
+set destination_id = null
+where destination_id is not null
+  and (destination_id = id or not exists(select 1 from portals d where d.id = portals.destination_id));
+
+alter table portals
+    drop constraint if exists portals_destination_id_fkey;
+
+alter table portals
+    add constraint portals_destination_id_fkey foreign key (destination_id) references portals (id) on delete set null;
+
+alter table portals
+    drop constraint if exists portals_destination_not_self;
+
+alter table portals
+    add constraint portals_destination_not_self check (destination_id is null or destination_id <> id);
+
+-- inbound portals are looked up by the destination
+create index if not exists portals_destination_id_idx
+    on portals (destination_id);
+
+commit;
@@ -0,0 +1,19 @@
+begin;
+
+-- storage quotas
+
+create table if not exists storage_quotas
+(
+    owner_id   uuid                    not null
+        primary key,                                -- user or app the quota applies to
+    quota      bigint                  not null,    -- maximum number of stored bytes, 0 for unlimited
+    created_at timestamp default now() not null,
+    updated_at timestamp
+);
+
+comment on table storage_quotas is 'Storage quotas table (per user or per app overrides of the default STORAGE_USER_QUOTA and STORAGE_APP_QUOTA limits).';
+
+create index if not exists files_uploaded_by_idx
+    on files (uploaded_by);
+
+commit;
@@ -0,0 +1,83 @@
+begin;
+
+-- entity ratings
+
+create table if not exists entity_ratings
+(
+    entity_id           uuid not null
+        primary key
+        references public.entities
+            on delete cascade,
+    total_likes         integer          default 0 not null, -- number of likes (likables with value = 1)
+    total_dislikes      integer          default 0 not null, -- sum of dislikes (likables with value = -1), zero or negative as totalDislikes has always been returned by the api
+    trending_score      double precision default 0 not null, -- time-decayed score combining likes, views and recent plays
+    trending_updated_at timestamp                            -- last time the trending score has been recalculated
+);
+
+comment on table entity_ratings is 'Entity ratings table (materialized like and dislike counters and the trending score maintained together with likables).';
+
+create index if not exists entity_ratings_trending_score_idx
+    on entity_ratings (trending_score desc);
+
+-- a single rating per user and entity, the latest one is kept if concurrent requests have inserted duplicates
+delete
+from likables a
+    using likables b
+where a.user_id = b.user_id
+  and a.entity_id = b.entity_id
+  and (coalesce(a.updated_at, a.created_at), a.id) < (coalesce(b.updated_at, b.created_at), b.id);
+
+create unique index if not exists likables_user_id_entity_id_uindex
+    on likables (user_id, entity_id);
+
+-- backfill counters from the existing likables
+insert into entity_ratings (entity_id, total_likes, total_dislikes)
+select l.entity_id,
+       count(*) filter (where l.value > 0),
+       -count(*) filter (where l.value < 0)
+from likables l
+         join entities e on e.id = l.entity_id
+group by l.entity_id
+on conflict (entity_id) do update set total_likes    = excluded.total_likes,
+                                      total_dislikes = excluded.total_dislikes;
+
+-- trending score
+
+-- score = (likes + dislikes) + 0.5 * ln(1 + views) + 2 * plays during the last 7 days,
+-- decayed by half every half_life_hours since the last activity (update, rating or play) of the entity
+create or replace function entity_trending_score(entity uuid, half_life_hours double precision)
+    returns double precision
+    language sql
+    stable
+as
+$$
+with plays as (select count(*)                                               as total,
+                      max(coalesce(p.updated_at, p.created_at))              as last_played_at
+               from game_server_player_v2 p
+                        join game_server_v2 s on s.id = p.server_id
+                        left join spaces w on w.id = s.world_id
+               where (s.world_id = entity or w.mod_id = entity)
+                 and p.created_at > now() - interval '7 days'),
+     rated as (select max(coalesce(l.updated_at, l.created_at)) as last_rated_at
+               from likables l
+               where l.entity_id = entity)
+select ((coalesce(r.total_likes, 0) + coalesce(r.total_dislikes, 0))
+    + 0.5 * ln(1 + greatest(coalesce(e.views, 0), 0))
+    + 2.0 * plays.total)
+           * power(0.5, extract(epoch from now() - greatest(coalesce(e.updated_at, e.created_at),
+                                                              rated.last_rated_at,
+                                                              plays.last_played_at)) / 3600.0 /
+                        greatest(half_life_hours, 1))
+from entities e
+         left join entity_ratings r on r.entity_id = e.id
+         cross join plays
+         cross join rated
+where e.id = entity
+$$;
+
+-- initial trending scores for the rated entities
+update entity_ratings
+set trending_score      = coalesce(entity_trending_score(entity_id, 72), 0),
+    trending_updated_at = now();
+
+commit;
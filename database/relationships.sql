@@ -0,0 +1,34 @@
+begin;
+
+-- entity relationships
+
+create table if not exists entity_relationships
+(
+    id         uuid      default gen_random_uuid() not null
+        primary key,
+    source_id  uuid                                not null -- entity the relationship starts from (e.g. world)
+        references public.entities
+            on delete cascade,
+    target_id  uuid                                not null -- entity the relationship points to (e.g. art object)
+        references public.entities
+            on delete cascade,
+    type       text                                not null, -- relationship type (e.g. features, requires, bundles)
+    metadata   jsonb,                                        -- optional relationship metadata
+    sort_order integer   default 0                 not null, -- order of the relationship among the relationships of the same source and type
+    created_at timestamp default now()             not null,
+    updated_at timestamp,
+    constraint entity_relationships_unique
+        unique (source_id, target_id, type),
+    constraint entity_relationships_no_self
+        check (source_id <> target_id)
+);
+
+comment on table entity_relationships is 'Entity relationships table (typed directed relationship between two entities, e.g. world features art object, package requires package, app bundles world).';
+
+create index if not exists entity_relationships_source_type_idx
+    on entity_relationships (source_id, type, sort_order);
+
+create index if not exists entity_relationships_target_type_idx
+    on entity_relationships (target_id, type);
+
+commit;
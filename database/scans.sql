@@ -0,0 +1,52 @@
+begin;
+
+-- upload scanning
+
+alter table files
+    add column if not exists scan_status text;
+
+alter table files
+    add column if not exists scan_signature text;
+
+alter table files
+    add column if not exists scanned_at timestamp;
+
+comment on column files.scan_status is 'Malware scan status (pending, clean, infected, failed or external, verifying while the contents of a multipart upload are verified), external for linked files not stored at the storage, null for files not scanned yet (uploaded before scanning was enabled, queued by the worker), only clean and external files can be downloaded while scanning is enabled.';
+comment on column files.scan_signature is 'Name of the signature detected in an infected file.';
+comment on column files.scanned_at is 'Time of the last completed scan.';
+
+-- scan queue
+
+create table if not exists file_scan_jobs
+(
+    id         uuid      default gen_random_uuid() not null
+        primary key,
+    file_id    uuid                                not null, -- uploaded file
+    status     text      default 'pending'         not null, -- pending, processing (claimed by a worker), completed or failed
+    attempts   integer   default 0                 not null,
+    error      text,
+    created_at timestamp default now()             not null,
+    updated_at timestamp
+);
+
+alter table file_scan_jobs
+    add column if not exists scheduled_at timestamp default now() not null;
+
+comment on column file_scan_jobs.scheduled_at is 'Time the job can be processed at, jobs of files uploaded using presigned urls are postponed until the object is uploaded.';
+
+comment on table file_scan_jobs is 'File scan jobs table (uploaded files queued for the malware scan by the background worker).';
+
+drop index if exists file_scan_jobs_status_created_at_idx;
+
+create index if not exists file_scan_jobs_status_scheduled_at_idx
+    on file_scan_jobs (status, scheduled_at)
+    where status = 'pending';
+
+create index if not exists files_scan_status_null_idx
+    on files (created_at)
+    where scan_status is null;
+
+create index if not exists file_scan_jobs_file_id_idx
+    on file_scan_jobs (file_id);
+
+commit;
@@ -0,0 +1,51 @@
+begin;
+
+-- full-text search with ranking across content types
+
+create extension if not exists pg_trgm;
+
+-- names and titles are weighted over secondary fields and descriptions
+
+alter table spaces
+    add column if not exists search_vector tsvector generated always as (
+        setweight(to_tsvector('english', coalesce(name, '')), 'A') ||
+        setweight(to_tsvector('english', coalesce(description, '')), 'C')) stored;
+
+alter table mods
+    add column if not exists search_vector tsvector generated always as (
+        setweight(to_tsvector('english', coalesce(name, '')), 'A') ||
+        setweight(to_tsvector('english', coalesce(title, '')), 'B') ||
+        setweight(to_tsvector('english', coalesce(description, '')), 'C')) stored;
+
+alter table portals
+    add column if not exists search_vector tsvector generated always as (
+        setweight(to_tsvector('english', coalesce(name, '')), 'A')) stored;
+
+alter table placeable_classes
+    add column if not exists search_vector tsvector generated always as (
+        setweight(to_tsvector('english', coalesce(name, '')), 'A') ||
+        setweight(to_tsvector('english', coalesce(category, '')), 'B') ||
+        setweight(to_tsvector('english', coalesce(description, '')), 'C')) stored;
+
+alter table objects
+    add column if not exists search_vector tsvector generated always as (
+        setweight(to_tsvector('english', coalesce(name, '')), 'A') ||
+        setweight(to_tsvector('english', coalesce(artist, '')), 'B') ||
+        setweight(to_tsvector('english', coalesce(description, '')), 'C')) stored;
+
+create index if not exists spaces_search_vector_idx on spaces using gin (search_vector);
+create index if not exists mods_search_vector_idx on mods using gin (search_vector);
+create index if not exists portals_search_vector_idx on portals using gin (search_vector);
+create index if not exists placeable_classes_search_vector_idx on placeable_classes using gin (search_vector);
+create index if not exists objects_search_vector_idx on objects using gin (search_vector);
+
+-- trigram indices of names match misspelled queries
+
+create index if not exists spaces_name_trgm_idx on spaces using gin (name gin_trgm_ops);
+create index if not exists mods_name_trgm_idx on mods using gin (name gin_trgm_ops);
+create index if not exists mods_title_trgm_idx on mods using gin (title gin_trgm_ops);
+create index if not exists portals_name_trgm_idx on portals using gin (name gin_trgm_ops);
+create index if not exists placeable_classes_name_trgm_idx on placeable_classes using gin (name gin_trgm_ops);
+create index if not exists objects_name_trgm_idx on objects using gin (name gin_trgm_ops);
+
+commit;
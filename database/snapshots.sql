@@ -0,0 +1,48 @@
+begin;
+
+-- world layout snapshots
+
+create table if not exists world_snapshots
+(
+    id           uuid                    not null
+        primary key,
+    world_id     uuid                    not null
+        references entities
+            on delete cascade,
+    name         text                    not null,
+    automatic    boolean default false   not null, -- taken before bulk edits and restores, pruned by WORLD_SNAPSHOT_RETENTION
+    created_by   uuid,
+    object_count integer default 0       not null,
+    objects      jsonb   default '[]'    not null, -- placeables with transforms, classes, properties and file references
+    created_at   timestamp default now() not null
+);
+
+comment on table world_snapshots is 'World snapshots table (named copies of the world placeable set which can be diffed and restored).';
+
+create index if not exists world_snapshots_world_id_idx
+    on world_snapshots (world_id, created_at desc);
+
+-- blobs of snapshot files are referenced so they are kept while the snapshot exists
+
+create table if not exists world_snapshot_blobs
+(
+    snapshot_id uuid not null
+        references world_snapshots
+            on delete cascade,
+    blob_hash   text not null
+        references file_blobs
+            on delete cascade,
+    primary key (snapshot_id, blob_hash)
+);
+
+comment on table world_snapshot_blobs is 'World snapshot blobs table (file blobs referenced by snapshots, counted by the blob reference trigger).';
+
+drop trigger if exists world_snapshot_blobs_ref_count on world_snapshot_blobs;
+
+create trigger world_snapshot_blobs_ref_count
+    after insert or delete or update of blob_hash
+    on world_snapshot_blobs
+    for each row
+execute function file_blobs_ref_count();
+
+commit;
@@ -0,0 +1,17 @@
+begin;
+
+-- spatial index of world objects
+
+create extension if not exists cube;
+create extension if not exists btree_gist;
+
+alter table placeables
+    add column if not exists position cube generated always as (cube(array [coalesce(offset_x, 0), coalesce(offset_y, 0), coalesce(offset_z, 0)]::float8[])) stored;
+
+comment on column placeables.position is 'Object location as a three-dimensional point derived from the offset, used by radius, box and nearest neighbour queries.';
+
+-- world objects are always queried within the world, nearest neighbour queries are ordered by the index
+create index if not exists placeables_space_position_idx
+    on placeables using gist (space_id, position);
+
+commit;
@@ -0,0 +1,14 @@
+begin;
+
+-- world templates
+
+alter table spaces
+    add column if not exists template boolean default false not null;
+
+comment on column spaces.template is 'World is listed in the template picker, templates can be cloned by users who can view them.';
+
+create index if not exists spaces_template_idx
+    on spaces (template)
+    where template;
+
+commit;
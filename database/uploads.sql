@@ -0,0 +1,53 @@
+begin;
+
+-- file multipart uploads
+
+create table if not exists file_uploads
+(
+    id              uuid      default gen_random_uuid() not null
+        primary key,
+    upload_id       text                                not null, -- S3 multipart upload id
+    key             text                                not null, -- S3 object key
+    entity_id       uuid                                not null  -- entity the file is uploaded for
+        references public.entities
+            on delete cascade,
+    file_id         uuid                                not null, -- id of the file record created on completion
+    type            text                                not null, -- file type
+    mime            text,                                         -- MIME type provided by the client, detected on completion if empty
+    size            bigint                              not null, -- expected file size in bytes
+    part_size       bigint                              not null, -- size of each part except the last one
+    deployment_type text      default ''                not null,
+    platform        text      default ''                not null,
+    variation       bigint    default 0                 not null,
+    original_path   text      default ''                not null,
+    hash            text,                                         -- SHA-256 of the file contents, provided by the client and verified after the completion
+    width           integer,
+    height          integer,
+    status          text      default 'pending'         not null, -- pending, completing (claimed by a completion), verifying (assembled, contents verified by the worker), completed or aborted
+    verify_attempts integer   default 0                 not null,
+    verify_error    text,
+    verify_started_at timestamp,
+    created_by      uuid                                          -- user who initiated the upload
+        references users
+            on delete set null,
+    created_at      timestamp default now()             not null,
+    updated_at      timestamp
+);
+
+comment on table file_uploads is 'File uploads table (S3 multipart uploads in progress, used to resume, complete or abort large file uploads).';
+
+comment on column file_uploads.verify_attempts is 'Number of attempts to hash and verify the assembled object, the upload is rejected after the limit.';
+comment on column file_uploads.verify_error is 'Last verification error or the reason the upload has been rejected.';
+comment on column file_uploads.verify_started_at is 'Time the verification has been claimed by a worker, claims of stopped workers are reclaimed after the timeout.';
+
+create index if not exists file_uploads_entity_id_idx
+    on file_uploads (entity_id);
+
+create index if not exists file_uploads_status_created_at_idx
+    on file_uploads (status, created_at);
+
+create index if not exists file_uploads_verifying_updated_at_idx
+    on file_uploads (updated_at)
+    where status = 'verifying';
+
+commit;
@@ -0,0 +1,46 @@
+begin;
+
+-- file version history
+
+create table if not exists file_versions
+(
+    id              uuid                    not null
+        primary key,                                  -- id of the version, the object is identified by the url
+    entity_id       uuid                    not null
+        references entities
+            on delete cascade,
+    type            text                    not null,
+    url             text                    not null,
+    mime            text,
+    size            bigint,
+    version         bigint                  not null,
+    deployment_type text    default ''      not null,
+    platform        text    default ''      not null,
+    variation       bigint  default 0       not null,
+    original_path   text,
+    hash            text,
+    blob_hash       text
+        references file_blobs
+            on delete set null,                       -- blob the version is stored in, counted by the blob reference trigger
+    uploaded_by     uuid,
+    width           integer,
+    height          integer,
+    metadata        jsonb,
+    created_at      timestamp               not null, -- time the version has been uploaded
+    archived_at     timestamp default now() not null  -- time the version has been replaced
+);
+
+comment on table file_versions is 'File versions table (previous versions of replaced files kept as immutable objects, the number of kept versions is limited per file type by FILE_VERSION_RETENTION).';
+
+create index if not exists file_versions_slot_idx
+    on file_versions (entity_id, type, platform, deployment_type, variation, original_path, version desc);
+
+drop trigger if exists file_versions_blob_ref_count on file_versions;
+
+create trigger file_versions_blob_ref_count
+    after insert or delete or update of blob_hash
+    on file_versions
+    for each row
+execute function file_blobs_ref_count();
+
+commit;
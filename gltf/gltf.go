@@ -0,0 +1,389 @@
+package gltf
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"math"
+	"strings"
+)
+
+const (
+	MimeBinary = "model/gltf-binary"
+	MimeJson   = "model/gltf+json"
+)
+
+const (
+	glbMagic     = 0x46546C67 // glTF
+	glbChunkJson = 0x4E4F534A // JSON
+	glbChunkBin  = 0x004E4942 // BIN
+
+	maxJsonSize   = 64 * 1024 * 1024 // Larger JSON documents are rejected
+	maxNodeDepth  = 256              // Deeper node hierarchies are rejected to bound the recursion
+	modeTriangles = 4
+	modeStrip     = 5
+	modeFan       = 6
+)
+
+var ErrInvalid = errors.New("invalid glTF")
+
+// Metadata is the summary of the glTF asset
+type Metadata struct {
+	Triangles      int64        `json:"triangles"`      // Triangles of all mesh instances of the scene
+	Vertices       int64        `json:"vertices"`       // Vertices of all mesh instances of the scene
+	Meshes         int          `json:"meshes"`         // Number of meshes
+	Materials      int          `json:"materials"`      // Number of materials
+	Textures       int          `json:"textures"`       // Number of textures
+	Images         []Image      `json:"images"`         // Images used by textures
+	MaxTextureSize int          `json:"maxTextureSize"` // Longest side of embedded images
+	BoundingBox    *BoundingBox `json:"boundingBox,omitempty"`
+	Animations     []string     `json:"animations"` // Names of animations, unnamed animations are listed by their index
+}
+
+// Image is the image of the asset, dimensions are only known for embedded PNG and JPEG images
+type Image struct {
+	Name     string `json:"name,omitempty"`
+	Mime     string `json:"mime,omitempty"`
+	Embedded bool   `json:"embedded"`
+	Width    int    `json:"width,omitempty"`
+	Height   int    `json:"height,omitempty"`
+}
+
+// BoundingBox is the axis-aligned bounding box of the scene in meters
+type BoundingBox struct {
+	Min [3]float64 `json:"min"`
+	Max [3]float64 `json:"max"`
+}
+
+type document struct {
+	Scene  *int `json:"scene"`
+	Scenes []struct {
+		Nodes []int `json:"nodes"`
+	} `json:"scenes"`
+	Nodes []struct {
+		Children    []int     `json:"children"`
+		Mesh        *int      `json:"mesh"`
+		Matrix      []float64 `json:"matrix"`
+		Translation []float64 `json:"translation"`
+		Rotation    []float64 `json:"rotation"`
+		Scale       []float64 `json:"scale"`
+	} `json:"nodes"`
+	Meshes []struct {
+		Primitives []struct {
+			Attributes map[string]int `json:"attributes"`
+			Indices    *int           `json:"indices"`
+			Mode       *int           `json:"mode"`
+		} `json:"primitives"`
+	} `json:"meshes"`
+	Accessors []struct {
+		Count int64     `json:"count"`
+		Min   []float64 `json:"min"`
+		Max   []float64 `json:"max"`
+	} `json:"accessors"`
+	Materials []json.RawMessage `json:"materials"`
+	Textures  []json.RawMessage `json:"textures"`
+	Images    []struct {
+		Name       string `json:"name"`
+		Uri        string `json:"uri"`
+		MimeType   string `json:"mimeType"`
+		BufferView *int   `json:"bufferView"`
+	} `json:"images"`
+	BufferViews []struct {
+		Buffer     int   `json:"buffer"`
+		ByteOffset int64 `json:"byteOffset"`
+		ByteLength int64 `json:"byteLength"`
+	} `json:"bufferViews"`
+	Buffers []struct {
+		Uri string `json:"uri"`
+	} `json:"buffers"`
+	Animations []struct {
+		Name string `json:"name"`
+	} `json:"animations"`
+}
+
+// Parse reads the glTF JSON or binary (GLB) asset, only the JSON chunk and headers of embedded images are read
+func Parse(r io.ReaderAt, size int64) (*Metadata, error) {
+	var (
+		data      []byte
+		bin       *io.SectionReader
+		header    = make([]byte, 12)
+		byteOrder = binary.LittleEndian
+	)
+
+	if _, err := r.ReadAt(header, 0); err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	if byteOrder.Uint32(header[0:4]) == glbMagic {
+		if version := byteOrder.Uint32(header[4:8]); version != 2 {
+			return nil, fmt.Errorf("%w: unsupported version %d", ErrInvalid, version)
+		}
+
+		chunk := make([]byte, 8)
+		if _, err := r.ReadAt(chunk, 12); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalid, err)
+		}
+
+		length := int64(byteOrder.Uint32(chunk[0:4]))
+		if byteOrder.Uint32(chunk[4:8]) != glbChunkJson || length > maxJsonSize || 20+length > size {
+			return nil, fmt.Errorf("%w: invalid JSON chunk", ErrInvalid)
+		}
+
+		data = make([]byte, length)
+		if _, err := r.ReadAt(data, 20); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalid, err)
+		}
+
+		// The binary chunk is optional
+		offset := 20 + length
+		if offset+8 <= size {
+			if _, err := r.ReadAt(chunk, offset); err == nil && byteOrder.Uint32(chunk[4:8]) == glbChunkBin {
+				bin = io.NewSectionReader(r, offset+8, int64(byteOrder.Uint32(chunk[0:4])))
+			}
+		}
+	} else {
+		if size > maxJsonSize {
+			return nil, fmt.Errorf("%w: JSON is too large", ErrInvalid)
+		}
+
+		data = make([]byte, size)
+		if _, err := r.ReadAt(data, 0); err != nil && err != io.EOF {
+			return nil, err
+		}
+	}
+
+	var doc document
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+
+	return doc.summarize(bin)
+}
+
+// summarize Counts scene geometry and reads embedded image headers
+func (doc *document) summarize(bin *io.SectionReader) (*Metadata, error) {
+	m := &Metadata{
+		Meshes:     len(doc.Meshes),
+		Materials:  len(doc.Materials),
+		Textures:   len(doc.Textures),
+		Images:     []Image{},
+		Animations: []string{},
+	}
+
+	for i, a := range doc.Animations {
+		name := a.Name
+		if name == "" {
+			name = fmt.Sprintf("animation_%d", i)
+		}
+		m.Animations = append(m.Animations, name)
+	}
+
+	//region Scene
+
+	var roots []int
+	if len(doc.Scenes) > 0 {
+		scene := 0
+		if doc.Scene != nil {
+			scene = *doc.Scene
+		}
+		if scene < 0 || scene >= len(doc.Scenes) {
+			return nil, fmt.Errorf("%w: invalid scene %d", ErrInvalid, scene)
+		}
+		roots = doc.Scenes[scene].Nodes
+	} else {
+		// Without scenes all nodes which are not children are roots
+		children := map[int]bool{}
+		for _, n := range doc.Nodes {
+			for _, c := range n.Children {
+				children[c] = true
+			}
+		}
+		for i := range doc.Nodes {
+			if !children[i] {
+				roots = append(roots, i)
+			}
+		}
+	}
+
+	// Nodes form disjoint trees, each node is visited once
+	visited := make([]bool, len(doc.Nodes))
+	for _, root := range roots {
+		if err := doc.visit(m, root, identity(), 0, visited); err != nil {
+			return nil, err
+		}
+	}
+
+	//endregion
+
+	//region Images
+
+	for _, img := range doc.Images {
+		i := Image{Name: img.Name, Mime: img.MimeType}
+
+		var contents io.Reader
+		if img.BufferView != nil {
+			v := *img.BufferView
+			if v < 0 || v >= len(doc.BufferViews) {
+				return nil, fmt.Errorf("%w: invalid buffer view %d", ErrInvalid, v)
+			}
+			view := doc.BufferViews[v]
+
+			// Only the GLB binary chunk is available, it is the first buffer without an uri
+			if bin != nil && view.Buffer == 0 && len(doc.Buffers) > 0 && doc.Buffers[0].Uri == "" {
+				i.Embedded = true
+				contents = io.NewSectionReader(bin, view.ByteOffset, view.ByteLength)
+			}
+		} else if strings.HasPrefix(img.Uri, "data:") {
+			header, payload, ok := strings.Cut(strings.TrimPrefix(img.Uri, "data:"), ",")
+			if ok && strings.HasSuffix(header, ";base64") {
+				i.Embedded = true
+				if i.Mime == "" {
+					i.Mime = strings.TrimSuffix(header, ";base64")
+				}
+				contents = base64.NewDecoder(base64.StdEncoding, strings.NewReader(payload))
+			}
+		}
+
+		if contents != nil {
+			// Unsupported formats (e.g. KTX2 or WebP) are listed without dimensions
+			if config, _, err := image.DecodeConfig(contents); err == nil {
+				i.Width, i.Height = config.Width, config.Height
+				if config.Width > m.MaxTextureSize {
+					m.MaxTextureSize = config.Width
+				}
+				if config.Height > m.MaxTextureSize {
+					m.MaxTextureSize = config.Height
+				}
+			}
+		}
+
+		m.Images = append(m.Images, i)
+	}
+
+	//endregion
+
+	return m, nil
+}
+
+// visit Adds the node mesh and its children transformed by the parent matrix, nodes referenced more than once (shared children or cycles) are rejected as they would multiply the traversal
+func (doc *document) visit(m *Metadata, index int, parent matrix, depth int, visited []bool) error {
+	if depth > maxNodeDepth {
+		return fmt.Errorf("%w: node hierarchy is too deep", ErrInvalid)
+	}
+
+	if index < 0 || index >= len(doc.Nodes) {
+		return fmt.Errorf("%w: invalid node %d", ErrInvalid, index)
+	}
+
+	if visited[index] {
+		return fmt.Errorf("%w: node %d is referenced more than once", ErrInvalid, index)
+	}
+	visited[index] = true
+
+	node := doc.Nodes[index]
+
+	var local matrix
+	if len(node.Matrix) == 16 {
+		copy(local[:], node.Matrix)
+	} else {
+		local = compose(node.Translation, node.Rotation, node.Scale)
+	}
+	world := parent.mul(local)
+
+	if node.Mesh != nil {
+		if *node.Mesh < 0 || *node.Mesh >= len(doc.Meshes) {
+			return fmt.Errorf("%w: invalid mesh %d", ErrInvalid, *node.Mesh)
+		}
+
+		for _, p := range doc.Meshes[*node.Mesh].Primitives {
+			position, ok := p.Attributes["POSITION"]
+			if !ok {
+				continue
+			}
+			if position < 0 || position >= len(doc.Accessors) {
+				return fmt.Errorf("%w: invalid accessor %d", ErrInvalid, position)
+			}
+			positions := doc.Accessors[position]
+
+			count := positions.Count
+			if p.Indices != nil {
+				if *p.Indices < 0 || *p.Indices >= len(doc.Accessors) {
+					return fmt.Errorf("%w: invalid accessor %d", ErrInvalid, *p.Indices)
+				}
+				count = doc.Accessors[*p.Indices].Count
+			}
+
+			if positions.Count < 0 || count < 0 {
+				return fmt.Errorf("%w: invalid accessor count", ErrInvalid)
+			}
+
+			mode := modeTriangles
+			if p.Mode != nil {
+				mode = *p.Mode
+			}
+
+			// Points and lines have no triangles
+			switch mode {
+			case modeTriangles:
+				m.Triangles += count / 3
+			case modeStrip, modeFan:
+				if count > 2 {
+					m.Triangles += count - 2
+				}
+			}
+			m.Vertices += positions.Count
+
+			// Position accessors are required to have bounds
+			if len(positions.Min) == 3 && len(positions.Max) == 3 {
+				m.extend(world, positions.Min, positions.Max)
+			}
+		}
+	}
+
+	for _, child := range node.Children {
+		if err := doc.visit(m, child, world, depth+1, visited); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// extend Adds the corners of the transformed box to the bounding box
+func (m *Metadata) extend(world matrix, min []float64, max []float64) {
+	for corner := 0; corner < 8; corner++ {
+		p := [3]float64{min[0], min[1], min[2]}
+		for axis := 0; axis < 3; axis++ {
+			if corner&(1<<axis) != 0 {
+				p[axis] = max[axis]
+			}
+		}
+		p = world.apply(p)
+
+		if m.BoundingBox == nil {
+			m.BoundingBox = &BoundingBox{Min: p, Max: p}
+			continue
+		}
+
+		for axis := 0; axis < 3; axis++ {
+			m.BoundingBox.Min[axis] = math.Min(m.BoundingBox.Min[axis], p[axis])
+			m.BoundingBox.Max[axis] = math.Max(m.BoundingBox.Max[axis], p[axis])
+		}
+	}
+}
+
+// IsGltf returns true if the MIME type or the file name is of a glTF asset
+func IsGltf(mime string, name string) bool {
+	if mime == MimeBinary || mime == MimeJson {
+		return true
+	}
+
+	name = strings.ToLower(name)
+	return strings.HasSuffix(name, ".glb") || strings.HasSuffix(name, ".gltf")
+}
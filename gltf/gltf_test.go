@@ -0,0 +1,132 @@
+package gltf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// parseFixture parses the glTF asset of the testdata directory
+func parseFixture(t *testing.T, name string) (*Metadata, error) {
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return Parse(bytes.NewReader(data), int64(len(data)))
+}
+
+func TestParse(t *testing.T) {
+	m, err := parseFixture(t, "triangle.gltf")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.Equal(t, int64(1), m.Triangles)
+	assert.Equal(t, int64(3), m.Vertices)
+	assert.Equal(t, 1, m.Meshes)
+	assert.Equal(t, 1, m.Materials)
+	assert.Equal(t, []string{"wave", "animation_1"}, m.Animations)
+	if assert.NotNil(t, m.BoundingBox) {
+		assert.Equal(t, [3]float64{0, 0, 2}, m.BoundingBox.Min)
+		assert.Equal(t, [3]float64{1, 1, 2}, m.BoundingBox.Max)
+	}
+}
+
+func TestParseInstances(t *testing.T) {
+	// Nodes sharing a mesh are counted once per instance
+	m, err := parseFixture(t, "instances.gltf")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.Equal(t, int64(2), m.Triangles)
+	assert.Equal(t, int64(6), m.Vertices)
+	if assert.NotNil(t, m.BoundingBox) {
+		assert.Equal(t, [3]float64{0, 0, 0}, m.BoundingBox.Min)
+		assert.Equal(t, [3]float64{11, 1, 0}, m.BoundingBox.Max)
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		fixture string
+	}{
+		{"shared children", "dag.gltf"},
+		{"cycle", "cycle.gltf"},
+		{"invalid node", "invalid_node.gltf"},
+		{"invalid scene", "invalid_scene.gltf"},
+		{"invalid mesh", "invalid_mesh.gltf"},
+		{"invalid position accessor", "invalid_position.gltf"},
+		{"invalid indices accessor", "invalid_indices.gltf"},
+		{"negative accessor count", "invalid_count.gltf"},
+		{"invalid image buffer view", "invalid_image.gltf"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start := time.Now()
+			_, err := parseFixture(t, tt.fixture)
+			assert.True(t, errors.Is(err, ErrInvalid), "%v", err)
+			// Shared children would multiply the traversal if nodes were visited more than once
+			assert.Less(t, time.Since(start), time.Second)
+		})
+	}
+}
+
+func TestParseGlb(t *testing.T) {
+	var img bytes.Buffer
+	if err := png.Encode(&img, image.NewRGBA(image.Rect(0, 0, 64, 32))); err != nil {
+		t.Fatal(err)
+	}
+
+	// The binary chunk is padded to four bytes
+	bin := append(img.Bytes(), make([]byte, (4-img.Len()%4)%4)...)
+
+	doc, err := json.Marshal(map[string]any{
+		"asset":       map[string]any{"version": "2.0"},
+		"buffers":     []any{map[string]any{"byteLength": len(bin)}},
+		"bufferViews": []any{map[string]any{"buffer": 0, "byteLength": img.Len()}},
+		"images":      []any{map[string]any{"name": "albedo", "mimeType": "image/png", "bufferView": 0}},
+		"textures":    []any{map[string]any{"source": 0}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc = append(doc, bytes.Repeat([]byte(" "), (4-len(doc)%4)%4)...)
+
+	var glb bytes.Buffer
+	for _, v := range []uint32{glbMagic, 2, uint32(12 + 8 + len(doc) + 8 + len(bin)), uint32(len(doc)), glbChunkJson} {
+		_ = binary.Write(&glb, binary.LittleEndian, v)
+	}
+	glb.Write(doc)
+	for _, v := range []uint32{uint32(len(bin)), glbChunkBin} {
+		_ = binary.Write(&glb, binary.LittleEndian, v)
+	}
+	glb.Write(bin)
+
+	m, err := Parse(bytes.NewReader(glb.Bytes()), int64(glb.Len()))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.Equal(t, 1, m.Textures)
+	assert.Equal(t, 64, m.MaxTextureSize)
+	assert.Equal(t, []Image{{Name: "albedo", Mime: "image/png", Embedded: true, Width: 64, Height: 32}}, m.Images)
+}
+
+func TestIsGltf(t *testing.T) {
+	assert.True(t, IsGltf(MimeBinary, ""))
+	assert.True(t, IsGltf("", "Avatar.GLB"))
+	assert.True(t, IsGltf("application/octet-stream", "scene.gltf"))
+	assert.False(t, IsGltf("image/png", "texture.png"))
+}
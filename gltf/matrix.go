@@ -0,0 +1,55 @@
+package gltf
+
+// matrix is the column-major 4x4 transformation matrix of glTF nodes
+type matrix [16]float64
+
+func identity() matrix {
+	return matrix{1, 0, 0, 0, 0, 1, 0, 0, 0, 0, 1, 0, 0, 0, 0, 1}
+}
+
+// compose returns the matrix of the translation, rotation (quaternion) and scale, missing properties are the identity
+func compose(t []float64, r []float64, s []float64) matrix {
+	var (
+		tx, ty, tz     float64
+		qx, qy, qz, qw float64 = 0, 0, 0, 1
+		sx, sy, sz     float64 = 1, 1, 1
+	)
+
+	if len(t) == 3 {
+		tx, ty, tz = t[0], t[1], t[2]
+	}
+	if len(r) == 4 {
+		qx, qy, qz, qw = r[0], r[1], r[2], r[3]
+	}
+	if len(s) == 3 {
+		sx, sy, sz = s[0], s[1], s[2]
+	}
+
+	return matrix{
+		(1 - 2*(qy*qy+qz*qz)) * sx, 2 * (qx*qy + qz*qw) * sx, 2 * (qx*qz - qy*qw) * sx, 0,
+		2 * (qx*qy - qz*qw) * sy, (1 - 2*(qx*qx+qz*qz)) * sy, 2 * (qy*qz + qx*qw) * sy, 0,
+		2 * (qx*qz + qy*qw) * sz, 2 * (qy*qz - qx*qw) * sz, (1 - 2*(qx*qx+qy*qy)) * sz, 0,
+		tx, ty, tz, 1,
+	}
+}
+
+func (a matrix) mul(b matrix) (m matrix) {
+	for col := 0; col < 4; col++ {
+		for row := 0; row < 4; row++ {
+			var v float64
+			for k := 0; k < 4; k++ {
+				v += a[k*4+row] * b[col*4+k]
+			}
+			m[col*4+row] = v
+		}
+	}
+	return m
+}
+
+func (a matrix) apply(p [3]float64) [3]float64 {
+	return [3]float64{
+		a[0]*p[0] + a[4]*p[1] + a[8]*p[2] + a[12],
+		a[1]*p[0] + a[5]*p[1] + a[9]*p[2] + a[13],
+		a[2]*p[0] + a[6]*p[1] + a[10]*p[2] + a[14],
+	}
+}
@@ -0,0 +1,286 @@
+package handler
+
+import (
+	"bufio"
+	"context"
+	sm "dev.hackerman.me/artheon/veverse-shared/model"
+	"errors"
+	"fmt"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofrs/uuid"
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"strconv"
+	"time"
+	"veverse-api/aws/s3"
+	"veverse-api/helper"
+	"veverse-api/model"
+)
+
+// DownloadFile godoc
+// @Summary Download file
+// @Description Streams the file contents if the requester can view the entity, anonymous requests can download files of public entities, supports Range and ETag (If-None-Match, If-Range) headers
+// @Tags Files
+// @Produce octet-stream
+// @Param id path string true "File ID"
+// @Param Range header string false "Single byte range (e.g. bytes=0-1023)"
+// @Success 200 {file} file
+// @Success 206 {file} file
+// @Success 304
+// @Failure 403 {object} model.ErrorResponse
+// @Failure 404 {object} model.ErrorResponse
+// @Failure 416 {object} model.ErrorResponse
+// @Router /files/{id}/content [get]
+func DownloadFile(c *fiber.Ctx) error {
+	//region Requester
+
+	// Get requester, anonymous requests are allowed
+	requester, _ := helper.GetRequester(c)
+
+	// Check if requester is banned
+	if requester != nil && requester.IsBanned {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"status": "error", "message": "banned", "data": nil})
+	}
+
+	//endregion
+
+	id := uuid.FromStringOrNil(c.Params("id"))
+	if id.IsNil() {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "error", "message": "no id", "data": nil})
+	}
+
+	var (
+		file *model.File
+		err  error
+	)
+
+	if requester != nil && (requester.IsAdmin || requester.IsInternal) {
+		file, err = model.GetFileForAdmin(c.UserContext(), id)
+	} else {
+		var user = sm.User{}
+		if requester != nil {
+			user = *requester
+		}
+		file, err = model.GetFileForRequester(c.UserContext(), &user, id)
+	}
+
+	if err != nil {
+		if err.Error() == "no rows in result set" {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"status": "error", "message": "not found", "data": nil})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"status": "error", "message": err.Error(), "data": nil})
+	}
+
+	// Files the requester can not view are not distinguished from missing files
+	if file == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"status": "error", "message": "not found", "data": nil})
+	}
+
+	// Refuse files which have not been scanned yet or have been rejected by the scanner
+	if err = model.CheckFileScanStatus(file); err != nil {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"status": "error", "message": err.Error(), "data": nil})
+	}
+
+	// Files linked to external urls are not stored at the storage
+	key := s3.GetS3KeyForEntityUrl(file.Url)
+	if file.Url != s3.GetS3UrlForFile(key) {
+		return c.Redirect(file.Url, fiber.StatusFound)
+	}
+
+	// Objects of other entities linked to the file are not served
+	if err = model.CheckFileObject(c.UserContext(), file); err != nil {
+		if errors.Is(err, model.ErrFileObjectNotOwned) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"status": "error", "message": "not found", "data": nil})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"status": "error", "message": err.Error(), "data": nil})
+	}
+
+	stat, err := s3.StatObject(key)
+	if err != nil {
+		logrus.Errorf("failed to stat file %s object %s: %v", id, key, err)
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"status": "error", "message": "not found", "data": nil})
+	}
+
+	c.Set(fiber.HeaderAcceptRanges, "bytes")
+	c.Set(fiber.HeaderCacheControl, "private, no-cache")
+	if stat.ETag != "" {
+		c.Set(fiber.HeaderETag, stat.ETag)
+	}
+	if !stat.LastModified.IsZero() {
+		c.Set(fiber.HeaderLastModified, stat.LastModified.UTC().Format(http.TimeFormat))
+	}
+
+	if match := c.Get(fiber.HeaderIfNoneMatch); match != "" && stat.ETag != "" && (match == stat.ETag || match == "*") {
+		return c.SendStatus(fiber.StatusNotModified)
+	}
+
+	//region Range
+
+	var (
+		offset int64 = 0
+		length       = stat.Size
+		status       = fiber.StatusOK
+	)
+
+	// The range is ignored if the object has changed since the client has got its ETag
+	if r := c.Get(fiber.HeaderRange); r != "" {
+		if ifRange := c.Get(fiber.HeaderIfRange); ifRange == "" || ifRange == stat.ETag {
+			offset, length, err = model.ParseByteRange(r, stat.Size)
+			if err != nil {
+				c.Set(fiber.HeaderContentRange, fmt.Sprintf("bytes */%d", stat.Size))
+				return c.Status(fiber.StatusRequestedRangeNotSatisfiable).JSON(fiber.Map{"status": "error", "message": err.Error(), "data": nil})
+			}
+			status = fiber.StatusPartialContent
+			c.Set(fiber.HeaderContentRange, fmt.Sprintf("bytes %d-%d/%d", offset, offset+length-1, stat.Size))
+		}
+	}
+
+	//endregion
+
+	if stat.Mime != "" {
+		c.Set(fiber.HeaderContentType, stat.Mime)
+	} else if file.Mime != nil && *file.Mime != "" {
+		c.Set(fiber.HeaderContentType, *file.Mime)
+	} else {
+		c.Set(fiber.HeaderContentType, fiber.MIMEOctetStream)
+	}
+	c.Set(fiber.HeaderContentLength, strconv.FormatInt(length, 10))
+
+	if c.Method() == fiber.MethodHead {
+		return c.SendStatus(status)
+	}
+
+	reader, err := s3.ReadObject(key, offset, length)
+	if err != nil {
+		logrus.Errorf("failed to read file %s object %s: %v", id, key, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"status": "error", "message": "failed to read the file", "data": nil})
+	}
+
+	// Report the download without delaying the response
+	go func(file *model.File, offset int64, length int64) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := model.ReportFileDownload(ctx, requester, file, offset, length); err != nil {
+			logrus.Errorf("failed to report file %s download: %v", id, err)
+		}
+	}(file, offset, length)
+
+	// The reader is closed after the body has been sent
+	return c.Status(status).SendStream(reader, int(length))
+}
+
+// DownloadFileArchive godoc
+// @Summary Download entity files as a ZIP archive
+// @Description Streams the ZIP archive of entity files built on the fly, files keep their original paths, files which can not be read are listed in the _skipped.txt entry, files linked to external urls are listed in the _links.txt entry
+// @Tags Files
+// @Produce application/zip
+// @Param id path string true "Entity ID"
+// @Param type query string false "Comma separated file types"
+// @Param platform query string false "Comma separated platforms"
+// @Param deployment query string false "Comma separated deployments (Server or Client)"
+// @Success 200 {file} file
+// @Failure 400 {object} model.ErrorResponse
+// @Failure 403 {object} model.ErrorResponse
+// @Failure 404 {object} model.ErrorResponse
+// @Router /entities/{id}/files/archive [get]
+func DownloadFileArchive(c *fiber.Ctx) error {
+	//region Requester
+
+	// Get requester
+	requester, err := helper.GetRequester(c)
+	if err != nil {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"status": "error", "message": "no requester", "data": nil})
+	}
+
+	// Check if requester is banned
+	if requester.IsBanned {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"status": "error", "message": "banned", "data": nil})
+	}
+
+	//endregion
+
+	//region Request metadata
+
+	m := model.FileBatchRequestMetadata{}
+	if err = c.QueryParser(&m); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "error", "message": err.Error(), "data": nil})
+	}
+
+	entityId := uuid.FromStringOrNil(c.Params("id"))
+	if entityId.IsNil() {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "error", "message": "invalid entity id", "data": nil})
+	}
+
+	query := model.FileQuery{
+		Types:       model.ParseFileQueryList(m.Type, nil),
+		Platforms:   model.ParseFileQueryList(m.Platform, model.SupportedPlatform),
+		Deployments: model.ParseFileQueryList(m.Deployment, model.SupportedDeployment),
+		Limit:       1,
+	}
+
+	//endregion
+
+	isAdmin := requester.IsAdmin || requester.IsInternal
+
+	// Check the entity has matching files the requester can view before the response is started
+	var total int64
+	if isAdmin {
+		_, total, _, err = model.IndexFilesForAdmin(c.UserContext(), entityId, query)
+	} else {
+		_, total, _, err = model.IndexFilesForRequester(c.UserContext(), requester, entityId, query)
+	}
+
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"status": "error", "message": err.Error(), "data": nil})
+	}
+
+	if total == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"status": "error", "message": "no files", "data": nil})
+	}
+
+	c.Set(fiber.HeaderContentType, "application/zip")
+	c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="%s.zip"`, entityId))
+
+	// The archive is written while the response is sent, errors can only be logged
+	userCtx := c.UserContext()
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		var (
+			count int
+			err   error
+		)
+
+		// Reading of file objects stops once the client has disconnected
+		ctx, cancel := context.WithCancel(userCtx)
+		defer cancel()
+		out := &cancelOnErrorWriter{w: w, cancel: cancel}
+
+		if isAdmin {
+			count, err = model.WriteFileArchiveForAdmin(ctx, out, entityId, query)
+		} else {
+			count, err = model.WriteFileArchiveForRequester(ctx, out, requester, entityId, query)
+		}
+
+		if err == nil {
+			err = w.Flush()
+		}
+
+		if err != nil {
+			logrus.Errorf("failed to stream the archive of %s after %d files: %v", entityId, count, err)
+		}
+	})
+
+	return nil
+}
+
+// cancelOnErrorWriter cancels the context once writing of the response fails (e.g. the client has disconnected)
+type cancelOnErrorWriter struct {
+	w      *bufio.Writer
+	cancel context.CancelFunc
+}
+
+func (w *cancelOnErrorWriter) Write(p []byte) (n int, err error) {
+	if n, err = w.w.Write(p); err != nil {
+		w.cancel()
+	}
+	return n, err
+}
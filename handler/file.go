@@ -40,12 +40,9 @@ func IndexFiles(c *fiber.Ctx) error {
 	}
 
 	var (
-		offset     int64 = 0
-		limit      int64 = 100
-		fileType         = ""
-		platform         = ""
-		deployment       = ""
-		entityId   uuid.UUID
+		offset   int64 = 0
+		limit    int64 = 100
+		entityId uuid.UUID
 	)
 
 	entityId = uuid.FromStringOrNil(c.Params("id"))
@@ -58,16 +55,25 @@ func IndexFiles(c *fiber.Ctx) error {
 		limit = m.Limit
 	}
 
-	if m.Type != "" {
-		fileType = m.Type
-	}
-
-	if model.SupportedPlatform[m.Platform] {
-		platform = m.Platform
+	query := model.FileQuery{
+		Types:       model.ParseFileQueryList(m.Type, nil),
+		Platforms:   model.ParseFileQueryList(m.Platform, model.SupportedPlatform),
+		Deployments: model.ParseFileQueryList(m.Deployment, model.SupportedDeployment),
+		MimePrefix:  m.Mime,
+		MinSize:     m.MinSize,
+		MaxSize:     m.MaxSize,
+		Version:     m.Version,
+		Cursor:      m.Cursor,
+		Offset:      offset,
+		Limit:       limit,
 	}
 
-	if model.SupportedDeployment[m.Deployment] {
-		deployment = m.Deployment
+	if m.UpdatedSince != "" {
+		updatedSince, err := time.Parse(time.RFC3339, m.UpdatedSince)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "error", "message": "invalid updated-since", "data": nil})
+		}
+		query.UpdatedSince = &updatedSince
 	}
 
 	//endregion
@@ -75,75 +81,28 @@ func IndexFiles(c *fiber.Ctx) error {
 	var (
 		entities []model.File
 		total    int64
+		next     string
 	)
 
 	if requester.IsAdmin || requester.IsInternal {
-		if fileType == "" {
-			if platform == "" {
-				if deployment == "" {
-					entities, total, err = model.IndexFilesForAdmin(c.UserContext(), entityId, offset, limit)
-				} else {
-					entities, total, err = model.IndexFilesForAdminForDeployment(c.UserContext(), entityId, offset, limit, deployment)
-				}
-			} else {
-				if deployment == "" {
-					entities, total, err = model.IndexFilesForAdminForPlatform(c.UserContext(), entityId, offset, limit, platform)
-				} else {
-					entities, total, err = model.IndexFilesForAdminForPlatformForDeployment(c.UserContext(), entityId, offset, limit, platform, deployment)
-				}
-			}
-		} else {
-			if platform == "" {
-				if deployment == "" {
-					entities, total, err = model.IndexFilesForAdminForType(c.UserContext(), entityId, offset, limit, fileType)
-				} else {
-					entities, total, err = model.IndexFilesForAdminForTypeForDeployment(c.UserContext(), entityId, offset, limit, fileType, deployment)
-				}
-			} else {
-				if deployment == "" {
-					entities, total, err = model.IndexFilesForAdminForTypeForPlatform(c.UserContext(), entityId, offset, limit, fileType, platform)
-				} else {
-					entities, total, err = model.IndexFilesForAdminForTypeForPlatformForDeployment(c.UserContext(), entityId, offset, limit, fileType, platform, deployment)
-				}
-			}
-		}
+		entities, total, next, err = model.IndexFilesForAdmin(c.UserContext(), entityId, query)
 	} else {
-		if fileType == "" {
-			if platform == "" {
-				if deployment == "" {
-					entities, total, err = model.IndexFilesForRequester(c.UserContext(), requester, entityId, offset, limit)
-				} else {
-					entities, total, err = model.IndexFilesForRequesterForDeployment(c.UserContext(), requester, entityId, offset, limit, deployment)
-				}
-			} else {
-				if deployment == "" {
-					entities, total, err = model.IndexFilesForRequesterForPlatform(c.UserContext(), requester, entityId, offset, limit, platform)
-				} else {
-					entities, total, err = model.IndexFilesForRequesterForPlatformForDeployment(c.UserContext(), requester, entityId, offset, limit, platform, deployment)
-				}
-			}
-		} else {
-			if platform == "" {
-				if deployment == "" {
-					entities, total, err = model.IndexFilesForRequesterForType(c.UserContext(), requester, entityId, offset, limit, fileType)
-				} else {
-					entities, total, err = model.IndexFilesForRequesterForTypeForDeployment(c.UserContext(), requester, entityId, offset, limit, fileType, deployment)
-				}
-			} else {
-				if deployment == "" {
-					entities, total, err = model.IndexFilesForRequesterForTypeForPlatform(c.UserContext(), requester, entityId, offset, limit, fileType, platform)
-				} else {
-					entities, total, err = model.IndexFilesForRequesterForTypeForPlatformForDeployment(c.UserContext(), requester, entityId, offset, limit, fileType, platform, deployment)
-				}
-			}
-		}
+		entities, total, next, err = model.IndexFilesForRequester(c.UserContext(), requester, entityId, query)
 	}
 
 	if err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "error", "message": err.Error(), "data": nil})
 	}
 
-	return c.Status(fiber.StatusOK).JSON(fiber.Map{"data": fiber.Map{"entities": entities, "offset": offset, "limit": limit, "total": total}})
+	// Replace images with their derivatives of the requested size and format
+	if m.Size != "" || m.Format != "" {
+		entities, err = model.ResolveImageDerivatives(c.UserContext(), entities, m.Size, m.Format)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "error", "message": err.Error(), "data": nil})
+		}
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"data": fiber.Map{"entities": entities, "offset": offset, "limit": limit, "total": total, "next": next}})
 }
 
 func UploadFile(c *fiber.Ctx) error {
@@ -200,84 +159,30 @@ func UploadFile(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "error", "message": "no file type", "data": nil})
 	}
 
-	// Process special image case that requires texture and preview generation
+	// Previews and textures of the initial image are generated from the full image by the derivative worker
 	if metadata.Type == "image_full_initial" {
-		// Handle special case for image_full_initial type that requires image_full, image_preview and texture_diffuse to be stored
-
-		// Try to upload a preview image
-		if requester.IsAdmin || requester.IsInternal {
-			fileId, err = model.UploadResizedImageForAdmin(c, requester, entityId, metadata, model.ImagePreview)
-		} else {
-			fileId, err = model.UploadResizedImageForRequester(c, requester, entityId, metadata, model.ImagePreview)
-		}
-
-		if err != nil {
-			if err.Error() == "no rows in result set" {
-				logrus.Warningf("%d: failed to upload preview image: entity %s not found", fiber.StatusNotFound, entityId.String())
-				return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"status": "error", "message": "not found", "data": nil})
-			} else if err.Error() == "no access" {
-				logrus.Warningf("%d: failed to upload preview image: forbidden, requester %s can't upload files for entity %s", fiber.StatusForbidden, requester.Id.String(), entityId.String())
-				return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"status": "error", "message": "forbidden", "data": nil})
-			}
-			logrus.Warningf("%d: failed to upload preview image: %v", fiber.StatusBadRequest, err.Error())
-			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "error", "message": err.Error(), "data": nil})
-		}
-
-		if requester.IsAdmin || requester.IsInternal {
-			fileId, err = model.UploadResizedImageForAdmin(c, requester, entityId, metadata, model.ImageTexture)
-		} else {
-			fileId, err = model.UploadResizedImageForRequester(c, requester, entityId, metadata, model.ImageTexture)
-		}
-
-		if err != nil {
-			if err.Error() == "no rows in result set" {
-				logrus.Warningf("%d: failed to upload texture image: entity %s not found", fiber.StatusNotFound, entityId.String())
-				return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"status": "error", "message": "not found", "data": nil})
-			} else if err.Error() == "no access" {
-				logrus.Warningf("%d: failed to upload texture image: forbidden, requester %s can't upload files for entity %s", fiber.StatusForbidden, requester.Id.String(), entityId.String())
-				return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"status": "error", "message": "forbidden", "data": nil})
-			}
-			logrus.Warningf("%d: failed to upload texture image: %v", fiber.StatusBadRequest, err.Error())
-			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "error", "message": err.Error(), "data": nil})
-		}
-
 		metadata.Type = "image_full"
-		if requester.IsAdmin || requester.IsInternal {
-			fileId, err = model.UploadFileForAdmin(c, requester, entityId, metadata)
-		} else {
-			fileId, err = model.UploadFileForRequester(c, requester, entityId, metadata)
-		}
-
-		if err != nil {
-			if err.Error() == "no rows in result set" {
-				logrus.Warningf("%d: failed to upload full image: entity %s not found", fiber.StatusNotFound, entityId.String())
-				return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"status": "error", "message": "not found", "data": nil})
-			} else if err.Error() == "no access" {
-				logrus.Warningf("%d: failed to upload full image: forbidden, requester %s can't upload files for entity %s", fiber.StatusForbidden, requester.Id.String(), entityId.String())
-				return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"status": "error", "message": "forbidden", "data": nil})
-			}
-			logrus.Warningf("%d: failed to upload full image: %v", fiber.StatusBadRequest, err.Error())
-			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "error", "message": err.Error(), "data": nil})
-		}
+	}
 
+	if requester.IsAdmin || requester.IsInternal {
+		fileId, err = model.UploadFileForAdmin(c, requester, entityId, metadata)
 	} else {
-		if requester.IsAdmin || requester.IsInternal {
-			fileId, err = model.UploadFileForAdmin(c, requester, entityId, metadata)
-		} else {
-			fileId, err = model.UploadFileForRequester(c, requester, entityId, metadata)
-		}
+		fileId, err = model.UploadFileForRequester(c, requester, entityId, metadata)
+	}
 
-		if err != nil {
-			if err.Error() == "no rows in result set" {
-				logrus.Warningf("%d: failed to upload image: entity %s not found", fiber.StatusNotFound, entityId.String())
-				return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"status": "error", "message": "not found", "data": nil})
-			} else if err.Error() == "no access" {
-				logrus.Warningf("%d: failed to upload image: forbidden, requester %s can't upload files for entity %s", fiber.StatusForbidden, requester.Id.String(), entityId.String())
-				return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"status": "error", "message": "forbidden", "data": nil})
-			}
-			logrus.Warningf("%d: failed to upload image: %v", fiber.StatusBadRequest, err.Error())
-			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "error", "message": err.Error(), "data": nil})
+	if err != nil {
+		if err.Error() == "no rows in result set" {
+			logrus.Warningf("%d: failed to upload image: entity %s not found", fiber.StatusNotFound, entityId.String())
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"status": "error", "message": "not found", "data": nil})
+		} else if err.Error() == "no access" {
+			logrus.Warningf("%d: failed to upload image: forbidden, requester %s can't upload files for entity %s", fiber.StatusForbidden, requester.Id.String(), entityId.String())
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"status": "error", "message": "forbidden", "data": nil})
+		} else if err.Error() == "storage quota exceeded" {
+			logrus.Warningf("%d: storage quota of requester %s exceeded", fiber.StatusRequestEntityTooLarge, requester.Id.String())
+			return c.Status(fiber.StatusRequestEntityTooLarge).JSON(fiber.Map{"status": "error", "message": "storage quota exceeded", "data": nil})
 		}
+		logrus.Warningf("%d: failed to upload image: %v", fiber.StatusBadRequest, err.Error())
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "error", "message": err.Error(), "data": nil})
 	}
 
 	if requester.IsAdmin || requester.IsInternal {
@@ -337,11 +242,11 @@ func LinkFile(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "error", "message": "no type", "data": nil})
 	}
 
-	if metadata.Url == "" {
+	if metadata.Url == "" && metadata.Hash == "" {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "error", "message": "no url", "data": nil})
 	}
 
-	if !strings.HasPrefix(metadata.Url, "http") {
+	if metadata.Url != "" && !strings.HasPrefix(metadata.Url, "http") {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "error", "message": fmt.Sprintf("unsupported URL format: %s", metadata.Url), "data": nil})
 	}
 
@@ -362,6 +267,8 @@ func LinkFile(c *fiber.Ctx) error {
 				return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"status": "error", "message": "not found", "data": nil})
 			} else if err.Error() == "no access" {
 				return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"status": "error", "message": "forbidden", "data": nil})
+			} else if err.Error() == "storage quota exceeded" {
+				return c.Status(fiber.StatusRequestEntityTooLarge).JSON(fiber.Map{"status": "error", "message": "storage quota exceeded", "data": nil})
 			}
 			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "error", "message": err.Error(), "data": nil})
 		}
@@ -378,6 +285,8 @@ func LinkFile(c *fiber.Ctx) error {
 				return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"status": "error", "message": "not found", "data": nil})
 			} else if err.Error() == "no access" {
 				return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"status": "error", "message": "forbidden", "data": nil})
+			} else if err.Error() == "storage quota exceeded" {
+				return c.Status(fiber.StatusRequestEntityTooLarge).JSON(fiber.Map{"status": "error", "message": "storage quota exceeded", "data": nil})
 			}
 			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "error", "message": err.Error(), "data": nil})
 		}
@@ -394,6 +303,8 @@ func LinkFile(c *fiber.Ctx) error {
 				return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"status": "error", "message": "not found", "data": nil})
 			} else if err.Error() == "no access" {
 				return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"status": "error", "message": "forbidden", "data": nil})
+			} else if err.Error() == "storage quota exceeded" {
+				return c.Status(fiber.StatusRequestEntityTooLarge).JSON(fiber.Map{"status": "error", "message": "storage quota exceeded", "data": nil})
 			}
 			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "error", "message": err.Error(), "data": nil})
 		}
@@ -409,6 +320,8 @@ func LinkFile(c *fiber.Ctx) error {
 				return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"status": "error", "message": "not found", "data": nil})
 			} else if err.Error() == "no access" {
 				return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"status": "error", "message": "forbidden", "data": nil})
+			} else if err.Error() == "storage quota exceeded" {
+				return c.Status(fiber.StatusRequestEntityTooLarge).JSON(fiber.Map{"status": "error", "message": "storage quota exceeded", "data": nil})
 			}
 			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "error", "message": err.Error(), "data": nil})
 		}
@@ -504,6 +417,22 @@ func GetFileDownloadLink(c *fiber.Ctx) error {
 
 	if requester.IsAdmin || requester.IsInternal {
 		key := s3.GetS3KeyForEntityFile(entityId, fileId)
+		if file, err := model.GetFileForAdmin(c.UserContext(), fileId); err == nil && file != nil {
+			// Refuse files which have not been scanned yet or have been rejected by the scanner
+			if err := model.CheckFileScanStatus(file); err != nil {
+				return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"status": "error", "message": err.Error(), "data": nil})
+			}
+			// Objects of other entities linked to the file are not presigned
+			if err := model.CheckFileObject(c.UserContext(), file); err != nil {
+				return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"status": "error", "message": "forbidden", "data": nil})
+			}
+			// Download the image derivative of the requested size and format if there is one
+			if derivative, err := model.GetImageDerivative(c.UserContext(), file, m.Size, m.Format); err == nil && derivative != nil {
+				file = derivative
+			}
+			// Files linked to a shared blob are stored under the blob key
+			key = s3.GetS3KeyForEntityUrl(file.Url)
+		}
 		url, err := s3.GetS3PresignedDownloadUrlForEntityFile(key, 30*time.Minute)
 		if err != nil {
 			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "error", "message": err.Error(), "data": nil})
@@ -549,6 +478,22 @@ func GetFilePreSignedDownloadLink(c *fiber.Ctx) error {
 
 	if requester.IsAdmin || requester.IsInternal {
 		key := s3.GetS3KeyForEntityFile(entityId, fileId)
+		if file, err := model.GetFileForAdmin(c.UserContext(), fileId); err == nil && file != nil {
+			// Refuse files which have not been scanned yet or have been rejected by the scanner
+			if err := model.CheckFileScanStatus(file); err != nil {
+				return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"status": "error", "message": err.Error(), "data": nil})
+			}
+			// Objects of other entities linked to the file are not presigned
+			if err := model.CheckFileObject(c.UserContext(), file); err != nil {
+				return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"status": "error", "message": "forbidden", "data": nil})
+			}
+			// Download the image derivative of the requested size and format if there is one
+			if derivative, err := model.GetImageDerivative(c.UserContext(), file, m.Size, m.Format); err == nil && derivative != nil {
+				file = derivative
+			}
+			// Files linked to a shared blob are stored under the blob key
+			key = s3.GetS3KeyForEntityUrl(file.Url)
+		}
 		url, err := s3.GetS3PresignedDownloadUrlForEntityFile(key, 72*time.Hour)
 		if err != nil {
 			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "error", "message": err.Error(), "data": nil})
@@ -558,7 +503,20 @@ func GetFilePreSignedDownloadLink(c *fiber.Ctx) error {
 	} else {
 		file, err := model.GetFileForRequester(c.Context(), requester, fileId)
 		if err == nil && file != nil {
-			key := s3.GetS3KeyForEntityFile(entityId, fileId)
+			// Refuse files which have not been scanned yet or have been rejected by the scanner
+			if err := model.CheckFileScanStatus(file); err != nil {
+				return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"status": "error", "message": err.Error(), "data": nil})
+			}
+			// Objects of other entities linked to the file are not presigned
+			if err := model.CheckFileObject(c.UserContext(), file); err != nil {
+				return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"status": "error", "message": "forbidden", "data": nil})
+			}
+			// Download the image derivative of the requested size and format if there is one
+			if derivative, err := model.GetImageDerivative(c.Context(), file, m.Size, m.Format); err == nil && derivative != nil {
+				file = derivative
+			}
+			// Files linked to a shared blob are stored under the blob key
+			key := s3.GetS3KeyForEntityUrl(file.Url)
 			url, err := s3.GetS3PresignedDownloadUrlForEntityFile(key, 72*time.Hour)
 			if err != nil {
 				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "error", "message": err.Error(), "data": nil})
@@ -598,6 +556,18 @@ func GetFilePreSignedDownloadLinkByURL(c *fiber.Ctx) error {
 	}
 
 	if requester.IsAdmin || requester.IsInternal {
+		if fileId := uuid.FromStringOrNil(filepath.Base(m.Url)); !fileId.IsNil() {
+			if file, err := model.GetFileForAdmin(c.UserContext(), fileId); err == nil && file != nil {
+				// Refuse files which have not been scanned yet or have been rejected by the scanner
+				if err := model.CheckFileScanStatus(file); err != nil {
+					return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"status": "error", "message": err.Error(), "data": nil})
+				}
+				// Objects of other entities linked to the file are not presigned
+				if err := model.CheckFileObject(c.UserContext(), file); err != nil {
+					return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"status": "error", "message": "forbidden", "data": nil})
+				}
+			}
+		}
 		key := s3.GetS3KeyForEntityUrl(m.Url)
 		url, err := s3.GetS3PresignedDownloadUrlForEntityFile(key, 72*time.Hour)
 		if err != nil {
@@ -610,7 +580,15 @@ func GetFilePreSignedDownloadLinkByURL(c *fiber.Ctx) error {
 		if fileId.IsNil() {
 			file, err := model.GetFileForRequesterByUrl(c.Context(), requester, m.Url)
 			if err == nil && file != nil {
-				key := s3.GetS3KeyForEntityUrl(m.Url)
+				// Refuse files which have not been scanned yet or have been rejected by the scanner
+				if err := model.CheckFileScanStatus(file); err != nil {
+					return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"status": "error", "message": err.Error(), "data": nil})
+				}
+				// Objects of other entities linked to the file are not presigned
+				if err := model.CheckFileObject(c.UserContext(), file); err != nil {
+					return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"status": "error", "message": "forbidden", "data": nil})
+				}
+				key := s3.GetS3KeyForEntityUrl(file.Url)
 				url, err := s3.GetS3PresignedDownloadUrlForEntityFile(key, 72*time.Hour)
 				if err != nil {
 					return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "error", "message": err.Error(), "data": nil})
@@ -621,7 +599,15 @@ func GetFilePreSignedDownloadLinkByURL(c *fiber.Ctx) error {
 		} else {
 			file, err := model.GetFileForRequester(c.Context(), requester, fileId)
 			if err == nil && file != nil {
-				key := s3.GetS3KeyForEntityUrl(m.Url)
+				// Refuse files which have not been scanned yet or have been rejected by the scanner
+				if err := model.CheckFileScanStatus(file); err != nil {
+					return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"status": "error", "message": err.Error(), "data": nil})
+				}
+				// Objects of other entities linked to the file are not presigned
+				if err := model.CheckFileObject(c.UserContext(), file); err != nil {
+					return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"status": "error", "message": "forbidden", "data": nil})
+				}
+				key := s3.GetS3KeyForEntityUrl(file.Url)
 				url, err := s3.GetS3PresignedDownloadUrlForEntityFile(key, 72*time.Hour)
 				if err != nil {
 					return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "error", "message": err.Error(), "data": nil})
@@ -723,6 +709,16 @@ func GetFileUploadLink(c *fiber.Ctx) error {
 	} else {
 		err = model.PreCreateFileForRequester(c, requester, entityId, fileId, m)
 		if err != nil {
+			if err.Error() == "no access" {
+				logrus.Warningf("%d: failed to pre-create file %s: %v", fiber.StatusForbidden, key, err)
+				return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"status": "error", "message": "forbidden", "data": nil})
+			} else if err.Error() == "storage quota exceeded" {
+				logrus.Warningf("%d: failed to pre-create file %s: %v", fiber.StatusRequestEntityTooLarge, key, err)
+				return c.Status(fiber.StatusRequestEntityTooLarge).JSON(fiber.Map{"status": "error", "message": "storage quota exceeded", "data": nil})
+			} else if err.Error() == "file size is required" {
+				logrus.Warningf("%d: failed to pre-create file %s: %v", fiber.StatusBadRequest, key, err)
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "error", "message": err.Error(), "data": nil})
+			}
 			logrus.Warningf("%d: failed to pre-create file %s: %v", fiber.StatusInternalServerError, key, err)
 			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"status": "error", "message": err.Error(), "data": nil})
 		}
@@ -753,3 +749,54 @@ func GetFileUploadLink(c *fiber.Ctx) error {
 	//logrus.Warningf("%d: failed to pre-create file for non-admin", fiber.StatusForbidden)
 	//return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"data": fiber.Map{"status": "error", "message": "forbidden", "data": nil}})
 }
+
+// GetFileBlobExists godoc
+// @Summary Check if the file contents have already been uploaded
+// @Description Check if a blob with the SHA-256 hash of the file contents exists, the file can be linked by the hash without uploading it again
+// @Tags Files
+// @Accept json
+// @Produce json
+// @Param hash query string true "SHA-256 of the file contents (hex)"
+// @Security	 Bearer
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} model.ErrorResponse
+// @Failure 403 {object} model.ErrorResponse
+// @Failure 500 {object} model.ErrorResponse
+// @Router /files/exists [get]
+func GetFileBlobExists(c *fiber.Ctx) error {
+	//region Requester
+
+	// Get requester
+	requester, err := helper.GetRequester(c)
+	if err != nil {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"status": "error", "message": "no requester", "data": nil})
+	}
+
+	// Check if requester is banned
+	if requester.IsBanned {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"status": "error", "message": "banned", "data": nil})
+	}
+
+	//endregion
+
+	m := model.FileBlobExistsRequestMetadata{}
+	err = c.QueryParser(&m)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "error", "message": err.Error(), "data": nil})
+	}
+
+	hash, ok := model.NormalizeFileBlobHash(m.Hash)
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "error", "message": "invalid hash", "data": nil})
+	}
+
+	blob, err := model.GetFileBlob(c.UserContext(), hash)
+	if err != nil {
+		if err.Error() == "no rows in result set" {
+			return c.Status(fiber.StatusOK).JSON(fiber.Map{"status": "ok", "message": nil, "data": fiber.Map{"exists": false, "hash": hash}})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"status": "error", "message": err.Error(), "data": nil})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"status": "ok", "message": nil, "data": fiber.Map{"exists": true, "hash": blob.Hash, "size": blob.Size, "mime": blob.Mime}})
+}
@@ -0,0 +1,144 @@
+package handler
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofrs/uuid"
+	"veverse-api/helper"
+	"veverse-api/model"
+)
+
+// IndexFileVersions godoc
+// @Summary Index file versions
+// @Description Previous versions of the file starting from the latest, versions are kept when the file is replaced, the number of kept versions depends on the file type
+// @Tags Files
+// @Accept json
+// @Produce json
+// @Param id path string true "File ID"
+// @Param offset query int false "Offset"
+// @Param limit query int false "Limit"
+// @Success 200 {object} model.FileVersion
+// @Failure 400 {object} model.ErrorResponse
+// @Failure 403 {object} model.ErrorResponse
+// @Failure 404 {object} model.ErrorResponse
+// @Router /files/{id}/versions [get]
+func IndexFileVersions(c *fiber.Ctx) error {
+	//region Requester
+
+	// Get requester
+	requester, err := helper.GetRequester(c)
+	if err != nil {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"status": "error", "message": "no requester", "data": nil})
+	}
+
+	// Check if requester is banned
+	if requester.IsBanned {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"status": "error", "message": "banned", "data": nil})
+	}
+
+	//endregion
+
+	//region Request metadata
+
+	m := model.BatchRequestMetadata{}
+	if err = c.QueryParser(&m); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "error", "message": err.Error(), "data": nil})
+	}
+
+	id := uuid.FromStringOrNil(c.Params("id"))
+	if id.IsNil() {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "error", "message": "invalid file id", "data": nil})
+	}
+
+	var (
+		offset int64 = 0
+		limit  int64 = 100
+	)
+
+	if m.Offset > 0 {
+		offset = m.Offset
+	}
+
+	if m.Limit > 0 && m.Limit < 100 {
+		limit = m.Limit
+	}
+
+	//endregion
+
+	var (
+		entities []model.FileVersion
+		total    int64
+	)
+
+	if requester.IsAdmin || requester.IsInternal {
+		entities, total, err = model.IndexFileVersionsForAdmin(c.UserContext(), id, offset, limit)
+	} else {
+		entities, total, err = model.IndexFileVersionsForRequester(c.UserContext(), requester, id, offset, limit)
+	}
+
+	if err != nil {
+		if err.Error() == "no rows in result set" {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"status": "error", "message": "not found", "data": nil})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"status": "error", "message": err.Error(), "data": nil})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"data": fiber.Map{"entities": entities, "offset": offset, "limit": limit, "total": total}})
+}
+
+// RollbackFileVersion godoc
+// @Summary Rollback file version
+// @Description Makes the previous version of the file current again, the current file is kept as a version, the file keeps its id and gets the contents of the version with the next version number
+// @Tags Files
+// @Accept json
+// @Produce json
+// @Param id path string true "File ID"
+// @Param versionId path string true "Version ID"
+// @Success 200 {object} model.File
+// @Failure 400 {object} model.ErrorResponse
+// @Failure 403 {object} model.ErrorResponse
+// @Failure 404 {object} model.ErrorResponse
+// @Router /files/{id}/versions/{versionId}/rollback [post]
+func RollbackFileVersion(c *fiber.Ctx) error {
+	//region Requester
+
+	// Get requester
+	requester, err := helper.GetRequester(c)
+	if err != nil {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"status": "error", "message": "no requester", "data": nil})
+	}
+
+	// Check if requester is banned
+	if requester.IsBanned {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"status": "error", "message": "banned", "data": nil})
+	}
+
+	//endregion
+
+	id := uuid.FromStringOrNil(c.Params("id"))
+	if id.IsNil() {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "error", "message": "invalid file id", "data": nil})
+	}
+
+	versionId := uuid.FromStringOrNil(c.Params("versionId"))
+	if versionId.IsNil() {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "error", "message": "invalid version id", "data": nil})
+	}
+
+	var file *model.File
+	if requester.IsAdmin || requester.IsInternal {
+		file, err = model.RollbackFileVersionForAdmin(c.UserContext(), id, versionId)
+	} else {
+		file, err = model.RollbackFileVersionForRequester(c.UserContext(), requester, id, versionId)
+	}
+
+	if err != nil {
+		if err.Error() == "no rows in result set" {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"status": "error", "message": "not found", "data": nil})
+		} else if err.Error() == "no access" {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"status": "error", "message": "no access", "data": nil})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"status": "error", "message": err.Error(), "data": nil})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"status": "ok", "message": "ok", "data": file})
+}
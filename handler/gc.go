@@ -0,0 +1,128 @@
+package handler
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofrs/uuid"
+	"github.com/sirupsen/logrus"
+	"veverse-api/helper"
+	"veverse-api/model"
+)
+
+// startObjectGcRun starts the storage garbage collection in the background, admin only
+func startObjectGcRun(c *fiber.Ctx, dryRun bool) error {
+	//region Requester
+
+	// Get requester
+	requester, err := helper.GetRequester(c)
+	if err != nil {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"status": "error", "message": "no requester", "data": nil})
+	}
+
+	// Check if requester is banned
+	if requester.IsBanned {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"status": "error", "message": "banned", "data": nil})
+	}
+
+	if !requester.IsAdmin {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"status": "error", "message": "forbidden", "data": nil})
+	}
+
+	//endregion
+
+	run, err := model.StartObjectGcRun(c.UserContext(), requester, dryRun)
+	if err != nil {
+		if err == model.ErrObjectGcRunning {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"status": "error", "message": err.Error(), "data": nil})
+		}
+		logrus.Errorf("failed to start the object gc: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"status": "error", "message": "failed to start the object gc", "data": nil})
+	}
+
+	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{"status": "ok", "message": nil, "data": run})
+}
+
+// IndexOrphanedObjects godoc
+// @Summary Start a dry run of the storage garbage collection
+// @Description Starts listing objects not referenced by files (including expired text-to-speech output) and files without objects in the background, the report is available when the run is finished, admin only
+// @Tags Files
+// @Accept json
+// @Produce json
+// @Security	 Bearer
+// @Success 202 {object} model.ObjectGcRun
+// @Failure 403 {object} model.ErrorResponse
+// @Failure 409 {object} model.ErrorResponse
+// @Failure 500 {object} model.ErrorResponse
+// @Router /files/orphans [post]
+func IndexOrphanedObjects(c *fiber.Ctx) error {
+	return startObjectGcRun(c, true)
+}
+
+// DeleteOrphanedObjects godoc
+// @Summary Start the storage garbage collection
+// @Description Starts deleting objects not referenced by files (including expired text-to-speech output) older than the grace period in the background, files without objects are only reported, admin only
+// @Tags Files
+// @Accept json
+// @Produce json
+// @Security	 Bearer
+// @Success 202 {object} model.ObjectGcRun
+// @Failure 403 {object} model.ErrorResponse
+// @Failure 409 {object} model.ErrorResponse
+// @Failure 500 {object} model.ErrorResponse
+// @Router /files/orphans [delete]
+func DeleteOrphanedObjects(c *fiber.Ctx) error {
+	return startObjectGcRun(c, false)
+}
+
+// GetObjectGcRun godoc
+// @Summary Get a storage garbage collection run
+// @Description Get the run of the storage garbage collection with its report, the latest run if no id is specified, admin only
+// @Tags Files
+// @Accept json
+// @Produce json
+// @Security	 Bearer
+// @Param id path string false "Run ID"
+// @Success 200 {object} model.ObjectGcRun
+// @Failure 400 {object} model.ErrorResponse
+// @Failure 403 {object} model.ErrorResponse
+// @Failure 404 {object} model.ErrorResponse
+// @Failure 500 {object} model.ErrorResponse
+// @Router /files/orphans/runs/{id} [get]
+func GetObjectGcRun(c *fiber.Ctx) error {
+	//region Requester
+
+	// Get requester
+	requester, err := helper.GetRequester(c)
+	if err != nil {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"status": "error", "message": "no requester", "data": nil})
+	}
+
+	// Check if requester is banned
+	if requester.IsBanned {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"status": "error", "message": "banned", "data": nil})
+	}
+
+	if !requester.IsAdmin {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"status": "error", "message": "forbidden", "data": nil})
+	}
+
+	//endregion
+
+	var id uuid.UUID
+	if c.Params("id") != "" {
+		id = uuid.FromStringOrNil(c.Params("id"))
+		if id.IsNil() {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "error", "message": "no id", "data": nil})
+		}
+	}
+
+	run, err := model.GetObjectGcRun(c.UserContext(), id)
+	if err != nil {
+		if err.Error() == "no rows in result set" {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"status": "error", "message": "not found", "data": nil})
+		}
+		logrus.Errorf("failed to get the object gc run: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"status": "error", "message": "failed to get the object gc run", "data": nil})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"status": "ok", "message": nil, "data": run})
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofrs/uuid"
+	"strings"
 	"veverse-api/helper"
 	"veverse-api/model"
 )
@@ -136,6 +137,52 @@ func IndexObjects(c *fiber.Ctx) (err error) {
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{"data": fiber.Map{"offset": offset, "limit": limit, "total": total, "entities": objects}})
 }
 
+// parseArtObjectFilter Parses art object filters, facet values are passed as repeated query parameters (artist=a&artist=b) so values can contain commas
+func parseArtObjectFilter(c *fiber.Ctx) (f model.SearchArtObject, err error) {
+	if err = c.QueryParser(&f); err != nil {
+		return f, err
+	}
+
+	args := c.Context().QueryArgs()
+	values := func(key string) (values []string) {
+		for _, v := range args.PeekMulti(key) {
+			if s := strings.TrimSpace(string(v)); s != "" {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+
+	f.Artist = values("artist")
+	f.Medium = values("medium")
+	f.License = values("license")
+	f.Origin = values("origin")
+
+	return f, nil
+}
+
+// IndexArtObjects godoc
+// @Summary      Index Art Objects
+// @Description  Fetch art objects matching the filters, the trending sort orders objects by the trending score
+// @Tags         objects
+// @Accept       json
+// @Produce      json
+// @Security	 Bearer
+// @Param        offset query int false "Offset"
+// @Param        limit query int false "Limit"
+// @Param        query query string false "Search query"
+// @Param        sort query string false "Sort order" Enums(trending, date, width, height, size)
+// @Param        order query string false "Sort direction" Enums(asc, desc)
+// @Param        artist query []string false "Artists" collectionFormat(multi)
+// @Param        medium query []string false "Mediums" collectionFormat(multi)
+// @Param        license query []string false "Licenses" collectionFormat(multi)
+// @Param        origin query []string false "Origins" collectionFormat(multi)
+// @Param        yearFrom query int false "Objects dated in or after the year"
+// @Param        yearTo query int false "Objects dated in or before the year"
+// @Success      200  {object}  []model.ArtObject
+// @Failure      400  {object}  error
+// @Failure      500  {object}  error
+// @Router       /art-objects [get]
 func IndexArtObjects(c *fiber.Ctx) (err error) {
 	//region Requester
 
@@ -180,7 +227,35 @@ func IndexArtObjects(c *fiber.Ctx) (err error) {
 	query = fmt.Sprintf("%%%s%%", m.Query)
 	//}
 
-	if requester.IsAdmin || requester.IsInternal {
+	// Parse art object filters from the request
+	f, err := parseArtObjectFilter(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "error", "message": err.Error(), "data": nil})
+	}
+
+	if m.Sort != "" && m.Sort != model.SortTrending {
+		if _, ok := model.ArtObjectSorts[m.Sort]; !ok {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "error", "message": "invalid sort", "data": nil})
+		}
+	}
+
+	if f.Order != "" && f.Order != "asc" && f.Order != "desc" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "error", "message": "invalid order", "data": nil})
+	}
+
+	if m.Sort == model.SortTrending {
+		if requester.IsAdmin || requester.IsInternal {
+			objects, total, err = model.GetArtObjectsTrendingForAdmin(c.UserContext(), requester, offset, limit, query)
+		} else {
+			objects, total, err = model.GetArtObjectsTrendingForRequester(c.UserContext(), requester, offset, limit, query)
+		}
+	} else if f.IsSet() || m.Sort != "" {
+		if requester.IsAdmin || requester.IsInternal {
+			objects, total, err = model.GetArtObjectsFilteredForAdmin(c.UserContext(), requester, offset, limit, query, f, m.Sort)
+		} else {
+			objects, total, err = model.GetArtObjectsFilteredForRequester(c.UserContext(), requester, offset, limit, query, f, m.Sort)
+		}
+	} else if requester.IsAdmin || requester.IsInternal {
 		objects, total, err = model.GetArtObjectsForAdmin(c.UserContext(), requester, offset, limit, query)
 	} else {
 		objects, total, err = model.GetArtObjectsForRequester(c.UserContext(), requester, offset, limit, query)
@@ -193,6 +268,51 @@ func IndexArtObjects(c *fiber.Ctx) (err error) {
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{"data": fiber.Map{"offset": offset, "limit": limit, "total": total, "entities": objects}})
 }
 
+func GetArtObjectFacets(c *fiber.Ctx) (err error) {
+	//region Requester
+
+	var (
+		requester *sm.User
+	)
+
+	// Get requester
+	requester, err = helper.GetRequester(c)
+	if err != nil {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"status": "error", "message": "no requester", "data": nil})
+	}
+
+	// Check if requester is banned
+	if requester.IsBanned {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"status": "error", "message": "banned", "data": nil})
+	}
+
+	m := model.BatchRequestMetadata{}
+	err = c.QueryParser(&m)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "error", "message": err.Error(), "data": nil})
+	}
+
+	f, err := parseArtObjectFilter(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "error", "message": err.Error(), "data": nil})
+	}
+
+	query := fmt.Sprintf("%%%s%%", m.Query)
+
+	var facets *model.ArtObjectFacets
+	if requester.IsAdmin || requester.IsInternal {
+		facets, err = model.GetArtObjectFacetsForAdmin(c.UserContext(), requester, query, f)
+	} else {
+		facets, err = model.GetArtObjectFacetsForRequester(c.UserContext(), requester, query, f)
+	}
+
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"status": "error", "message": "failed to fetch object facets", "data": nil})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"data": facets})
+}
+
 func GetArtObject(c *fiber.Ctx) (err error) {
 	//region Requester
 
@@ -2,6 +2,7 @@ package handler
 
 import (
 	vModel "dev.hackerman.me/artheon/veverse-shared/model"
+	"errors"
 	"fmt"
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofrs/uuid"
@@ -9,6 +10,23 @@ import (
 	"veverse-api/model"
 )
 
+// IndexPackages godoc
+// @Summary      Index Packages
+// @Description  Fetch packages, the trending sort orders packages by the trending score
+// @Tags         packages
+// @Accept       json
+// @Produce      json
+// @Security	 Bearer
+// @Param        offset query int false "Offset"
+// @Param        limit query int false "Limit"
+// @Param        query query string false "Search query"
+// @Param        sort query string false "Sort order" Enums(trending)
+// @Param        platform query string false "Specify to attach the pak file"
+// @Param        deployment query string false "Specify to attach the pak file"
+// @Success      200  {object}  []model.Package
+// @Failure      400  {object}  error
+// @Failure      500  {object}  error
+// @Router       /packages [get]
 func IndexPackages(c *fiber.Ctx) error {
 	//region Requester
 
@@ -64,6 +82,10 @@ func IndexPackages(c *fiber.Ctx) error {
 
 	withPak := deployment != "" && platform != ""
 
+	if m.Sort != "" && m.Sort != model.SortTrending {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "error", "message": "invalid sort", "data": nil})
+	}
+
 	//endregion
 
 	var (
@@ -71,7 +93,13 @@ func IndexPackages(c *fiber.Ctx) error {
 		total    int64
 	)
 
-	if requester.IsAdmin || requester.IsInternal {
+	if m.Sort == model.SortTrending {
+		if requester.IsAdmin || requester.IsInternal {
+			entities, total, err = model.IndexPackagesTrendingForAdmin(c.UserContext(), requester, offset, limit, query, platform, deployment)
+		} else {
+			entities, total, err = model.IndexPackagesTrendingForRequester(c.UserContext(), requester, offset, limit, query, platform, deployment)
+		}
+	} else if requester.IsAdmin || requester.IsInternal {
 		if query == "" {
 			if withPak {
 				entities, total, err = model.IndexPackagesForAdminWithPak(c.UserContext(), requester, offset, limit, platform, deployment)
@@ -177,6 +205,21 @@ func GetPackage(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"status": "error", "message": "not found", "data": nil})
 	}
 
+	//region Version
+
+	// Access to the package has been checked above, the latest version is used if no version requested
+	version, err := model.GetPackageVersionForAdmin(c.UserContext(), m.Id, m.Version, platform, deployment)
+	if err != nil {
+		if errors.Is(err, model.ErrInvalidPackageVersion) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"status": "error", "message": err.Error(), "data": nil})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"status": "error", "message": err.Error(), "data": nil})
+	}
+
+	model.ApplyPackageVersion(entity, version, withPak)
+
+	//endregion
+
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{"data": entity})
 }
 
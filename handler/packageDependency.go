@@ -0,0 +1,270 @@
+package handler
+
+import (
+	"errors"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofrs/uuid"
+	"github.com/sirupsen/logrus"
+	"veverse-api/database"
+	"veverse-api/helper"
+	"veverse-api/model"
+)
+
+// IndexPackageDependencies godoc
+// @Summary      Index package dependencies
+// @Description  Packages required by the package with their version constraints, satisfied tells whether the latest version of the dependency matches the constraint
+// @Tags         packages
+// @Accept       json
+// @Produce      json
+// @Security	 Bearer
+// @Param        id path string true "Package ID"
+// @Success      200  {object}  []model.PackageDependency
+// @Failure      400  {object}  error
+// @Failure      403  {object}  error
+// @Failure      404  {object}  error
+// @Failure      500  {object}  error
+// @Router       /packages/:id/dependencies [get]
+func IndexPackageDependencies(c *fiber.Ctx) error {
+	var (
+		status      = fiber.StatusOK
+		requesterId = uuid.Nil
+	)
+	defer func() {
+		err := database.ReportRequestEvent(c, requesterId, status)
+		if err != nil {
+			logrus.Errorf("failed to report request: %v", err)
+		}
+	}()
+
+	//region Requester
+
+	// Get requester
+	requester, err := helper.GetRequester(c)
+	if err != nil {
+		status = fiber.StatusBadRequest
+		return c.Status(status).JSON(fiber.Map{"status": "error", "message": "no requester", "data": nil})
+	}
+
+	// Check if requester is banned
+	if requester.IsBanned {
+		status = fiber.StatusForbidden
+		return c.Status(status).JSON(fiber.Map{"status": "error", "message": "banned", "data": nil})
+	}
+
+	requesterId = requester.Id
+	//endregion
+
+	id := uuid.FromStringOrNil(c.Params("id"))
+	if id.IsNil() {
+		status = fiber.StatusBadRequest
+		return c.Status(status).JSON(fiber.Map{"status": "error", "message": "invalid id", "data": nil})
+	}
+
+	var entities []model.PackageDependency
+	if requester.IsAdmin || requester.IsInternal {
+		entities, err = model.IndexPackageDependenciesForAdmin(c.UserContext(), id)
+	} else {
+		entities, err = model.IndexPackageDependenciesForRequester(c.UserContext(), requester, id)
+	}
+
+	if err != nil {
+		if err.Error() == "no rows in result set" {
+			status = fiber.StatusNotFound
+			return c.Status(status).JSON(fiber.Map{"status": "error", "message": "package not found", "data": nil})
+		} else if err.Error() == "no access" {
+			status = fiber.StatusForbidden
+			return c.Status(status).JSON(fiber.Map{"status": "error", "message": "no access", "data": nil})
+		}
+		status = fiber.StatusInternalServerError
+		return c.Status(status).JSON(fiber.Map{"status": "error", "message": err.Error(), "data": nil})
+	}
+
+	return c.Status(status).JSON(fiber.Map{"status": "ok", "message": "ok", "data": entities})
+}
+
+// SetPackageDependencies godoc
+// @Summary      Set package dependencies
+// @Description  Replaces dependencies of the package, constraints use the semver syntax (e.g. ^1.2, ~1.4.0 or >= 1.0, < 2.0), dependencies must not form a cycle with current dependencies or dependencies of published versions
+// @Tags         packages
+// @Accept       json
+// @Produce      json
+// @Security	 Bearer
+// @Param        id path string true "Package ID"
+// @Param        dependencies body model.PackageDependenciesUpdateMetadata true "Dependencies"
+// @Success      200  {object}  []model.PackageDependency
+// @Failure      400  {object}  error
+// @Failure      403  {object}  error
+// @Failure      404  {object}  error
+// @Failure      500  {object}  error
+// @Router       /packages/:id/dependencies [put]
+func SetPackageDependencies(c *fiber.Ctx) error {
+	var (
+		status      = fiber.StatusOK
+		requesterId = uuid.Nil
+	)
+	defer func() {
+		err := database.ReportRequestEvent(c, requesterId, status)
+		if err != nil {
+			logrus.Errorf("failed to report request: %v", err)
+		}
+	}()
+
+	//region Requester
+
+	// Get requester
+	requester, err := helper.GetRequester(c)
+	if err != nil {
+		status = fiber.StatusBadRequest
+		return c.Status(status).JSON(fiber.Map{"status": "error", "message": "no requester", "data": nil})
+	}
+
+	// Check if requester is banned
+	if requester.IsBanned {
+		status = fiber.StatusForbidden
+		return c.Status(status).JSON(fiber.Map{"status": "error", "message": "banned", "data": nil})
+	}
+
+	requesterId = requester.Id
+	//endregion
+
+	//region Request metadata
+
+	id := uuid.FromStringOrNil(c.Params("id"))
+	if id.IsNil() {
+		status = fiber.StatusBadRequest
+		return c.Status(status).JSON(fiber.Map{"status": "error", "message": "invalid id", "data": nil})
+	}
+
+	m := model.PackageDependenciesUpdateMetadata{}
+	if err = c.BodyParser(&m); err != nil {
+		status = fiber.StatusBadRequest
+		return c.Status(status).JSON(fiber.Map{"status": "error", "message": err.Error(), "data": nil})
+	}
+
+	//endregion
+
+	var entities []model.PackageDependency
+	if requester.IsAdmin || requester.IsInternal {
+		entities, err = model.SetPackageDependenciesForAdmin(c.UserContext(), id, m.Dependencies)
+	} else {
+		entities, err = model.SetPackageDependenciesForRequester(c.UserContext(), requester, id, m.Dependencies)
+	}
+
+	if err != nil {
+		if errors.Is(err, model.ErrInvalidPackageDependency) {
+			status = fiber.StatusBadRequest
+			return c.Status(status).JSON(fiber.Map{"status": "error", "message": err.Error(), "data": nil})
+		} else if err.Error() == "no rows in result set" {
+			status = fiber.StatusNotFound
+			return c.Status(status).JSON(fiber.Map{"status": "error", "message": "package not found", "data": nil})
+		} else if err.Error() == "no access" {
+			status = fiber.StatusForbidden
+			return c.Status(status).JSON(fiber.Map{"status": "error", "message": "no access", "data": nil})
+		}
+		status = fiber.StatusInternalServerError
+		return c.Status(status).JSON(fiber.Map{"status": "error", "message": err.Error(), "data": nil})
+	}
+
+	return c.Status(status).JSON(fiber.Map{"status": "ok", "message": "ok", "data": entities})
+}
+
+// ResolvePackage godoc
+// @Summary      Resolve package
+// @Description  Full pak set required to load the package version, dependencies are listed before their dependents. Each dependency gets its greatest not deprecated version satisfying the constraints of its dependents. Conflicting constraints, dependency cycles and missing paks are reported with 409 and the list of conflicts
+// @Tags         packages
+// @Accept       json
+// @Produce      json
+// @Security	 Bearer
+// @Param        id path string true "Package ID"
+// @Param        platform query string true "Platform"
+// @Param        deployment query string true "Deployment"
+// @Param        version query string false "Package version, the latest version by default"
+// @Success      200  {object}  model.PackageResolution
+// @Failure      400  {object}  error
+// @Failure      403  {object}  error
+// @Failure      404  {object}  error
+// @Failure      409  {object}  []model.PackageConflict
+// @Failure      500  {object}  error
+// @Router       /packages/:id/resolve [get]
+func ResolvePackage(c *fiber.Ctx) error {
+	var (
+		status      = fiber.StatusOK
+		requesterId = uuid.Nil
+	)
+	defer func() {
+		err := database.ReportRequestEvent(c, requesterId, status)
+		if err != nil {
+			logrus.Errorf("failed to report request: %v", err)
+		}
+	}()
+
+	//region Requester
+
+	// Get requester
+	requester, err := helper.GetRequester(c)
+	if err != nil {
+		status = fiber.StatusBadRequest
+		return c.Status(status).JSON(fiber.Map{"status": "error", "message": "no requester", "data": nil})
+	}
+
+	// Check if requester is banned
+	if requester.IsBanned {
+		status = fiber.StatusForbidden
+		return c.Status(status).JSON(fiber.Map{"status": "error", "message": "banned", "data": nil})
+	}
+
+	requesterId = requester.Id
+	//endregion
+
+	//region Request metadata
+
+	id := uuid.FromStringOrNil(c.Params("id"))
+	if id.IsNil() {
+		status = fiber.StatusBadRequest
+		return c.Status(status).JSON(fiber.Map{"status": "error", "message": "invalid id", "data": nil})
+	}
+
+	platform := c.Query("platform")
+	if !model.SupportedPlatform[platform] {
+		status = fiber.StatusBadRequest
+		return c.Status(status).JSON(fiber.Map{"status": "error", "message": "unsupported platform", "data": nil})
+	}
+
+	deployment := c.Query("deployment")
+	if !model.SupportedDeployment[deployment] {
+		status = fiber.StatusBadRequest
+		return c.Status(status).JSON(fiber.Map{"status": "error", "message": "unsupported deployment", "data": nil})
+	}
+
+	version := c.Query("version")
+
+	//endregion
+
+	var resolution *model.PackageResolution
+	if requester.IsAdmin || requester.IsInternal {
+		resolution, err = model.ResolvePackageForAdmin(c.UserContext(), id, version, platform, deployment)
+	} else {
+		resolution, err = model.ResolvePackageForRequester(c.UserContext(), requester, id, version, platform, deployment)
+	}
+
+	if err != nil {
+		var conflictErr *model.PackageResolutionError
+		if errors.As(err, &conflictErr) {
+			status = fiber.StatusConflict
+			return c.Status(status).JSON(fiber.Map{"status": "error", "message": err.Error(), "data": conflictErr.Conflicts})
+		} else if errors.Is(err, model.ErrInvalidPackageVersion) {
+			status = fiber.StatusNotFound
+			return c.Status(status).JSON(fiber.Map{"status": "error", "message": err.Error(), "data": nil})
+		} else if err.Error() == "no rows in result set" {
+			status = fiber.StatusNotFound
+			return c.Status(status).JSON(fiber.Map{"status": "error", "message": "package not found", "data": nil})
+		} else if err.Error() == "no access" {
+			status = fiber.StatusForbidden
+			return c.Status(status).JSON(fiber.Map{"status": "error", "message": "no access", "data": nil})
+		}
+		status = fiber.StatusInternalServerError
+		return c.Status(status).JSON(fiber.Map{"status": "error", "message": err.Error(), "data": nil})
+	}
+
+	return c.Status(status).JSON(fiber.Map{"status": "ok", "message": "ok", "data": resolution})
+}
@@ -0,0 +1,561 @@
+package handler
+
+import (
+	"errors"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofrs/uuid"
+	"github.com/sirupsen/logrus"
+	"veverse-api/database"
+	"veverse-api/helper"
+	"veverse-api/model"
+)
+
+// IndexPackageVersions godoc
+// @Summary      Index package versions
+// @Description  Published versions of the package starting from the latest
+// @Tags         packages
+// @Accept       json
+// @Produce      json
+// @Security	 Bearer
+// @Param        id path string true "Package ID"
+// @Param        offset query int false "Offset"
+// @Param        limit query int false "Limit"
+// @Success      200  {object}  []model.PackageVersion
+// @Failure      400  {object}  error
+// @Failure      403  {object}  error
+// @Failure      404  {object}  error
+// @Failure      500  {object}  error
+// @Router       /packages/:id/versions [get]
+func IndexPackageVersions(c *fiber.Ctx) error {
+	var (
+		status      = fiber.StatusOK
+		requesterId = uuid.Nil
+	)
+	defer func() {
+		err := database.ReportRequestEvent(c, requesterId, status)
+		if err != nil {
+			logrus.Errorf("failed to report request: %v", err)
+		}
+	}()
+
+	//region Requester
+
+	// Get requester
+	requester, err := helper.GetRequester(c)
+	if err != nil {
+		status = fiber.StatusBadRequest
+		return c.Status(status).JSON(fiber.Map{"status": "error", "message": "no requester", "data": nil})
+	}
+
+	// Check if requester is banned
+	if requester.IsBanned {
+		status = fiber.StatusForbidden
+		return c.Status(status).JSON(fiber.Map{"status": "error", "message": "banned", "data": nil})
+	}
+
+	requesterId = requester.Id
+	//endregion
+
+	//region Request metadata
+
+	m := model.BatchRequestMetadata{}
+	if err = c.QueryParser(&m); err != nil {
+		status = fiber.StatusBadRequest
+		return c.Status(status).JSON(fiber.Map{"status": "error", "message": err.Error(), "data": nil})
+	}
+
+	id := uuid.FromStringOrNil(c.Params("id"))
+	if id.IsNil() {
+		status = fiber.StatusBadRequest
+		return c.Status(status).JSON(fiber.Map{"status": "error", "message": "invalid id", "data": nil})
+	}
+
+	var (
+		offset int64 = 0
+		limit  int64 = 100
+	)
+
+	if m.Offset > 0 {
+		offset = m.Offset
+	}
+
+	if m.Limit > 0 && m.Limit < 100 {
+		limit = m.Limit
+	}
+
+	//endregion
+
+	var (
+		entities []model.PackageVersion
+		total    int64
+	)
+
+	if requester.IsAdmin || requester.IsInternal {
+		entities, total, err = model.IndexPackageVersionsForAdmin(c.UserContext(), id, offset, limit)
+	} else {
+		entities, total, err = model.IndexPackageVersionsForRequester(c.UserContext(), requester, id, offset, limit)
+	}
+
+	if err != nil {
+		if err.Error() == "no rows in result set" {
+			status = fiber.StatusNotFound
+			return c.Status(status).JSON(fiber.Map{"status": "error", "message": "package not found", "data": nil})
+		} else if err.Error() == "no access" {
+			status = fiber.StatusForbidden
+			return c.Status(status).JSON(fiber.Map{"status": "error", "message": "no access", "data": nil})
+		}
+		status = fiber.StatusInternalServerError
+		return c.Status(status).JSON(fiber.Map{"status": "error", "message": err.Error(), "data": nil})
+	}
+
+	return c.Status(status).JSON(fiber.Map{"data": fiber.Map{"entities": entities, "offset": offset, "limit": limit, "total": total}})
+}
+
+// GetPackageVersion godoc
+// @Summary      Get package version
+// @Description  Published version of the package with its pak files
+// @Tags         packages
+// @Accept       json
+// @Produce      json
+// @Security	 Bearer
+// @Param        id path string true "Package ID"
+// @Param        version path string true "Version"
+// @Param        platform query string false "Platform of pak files"
+// @Param        deployment query string false "Deployment of pak files"
+// @Success      200  {object}  model.PackageVersion
+// @Failure      400  {object}  error
+// @Failure      403  {object}  error
+// @Failure      404  {object}  error
+// @Failure      500  {object}  error
+// @Router       /packages/:id/versions/:version [get]
+func GetPackageVersion(c *fiber.Ctx) error {
+	var (
+		status      = fiber.StatusOK
+		requesterId = uuid.Nil
+	)
+	defer func() {
+		err := database.ReportRequestEvent(c, requesterId, status)
+		if err != nil {
+			logrus.Errorf("failed to report request: %v", err)
+		}
+	}()
+
+	//region Requester
+
+	// Get requester
+	requester, err := helper.GetRequester(c)
+	if err != nil {
+		status = fiber.StatusBadRequest
+		return c.Status(status).JSON(fiber.Map{"status": "error", "message": "no requester", "data": nil})
+	}
+
+	// Check if requester is banned
+	if requester.IsBanned {
+		status = fiber.StatusForbidden
+		return c.Status(status).JSON(fiber.Map{"status": "error", "message": "banned", "data": nil})
+	}
+
+	requesterId = requester.Id
+	//endregion
+
+	//region Request metadata
+
+	m := model.PackageVersionRequestMetadata{}
+	if err = c.QueryParser(&m); err != nil {
+		status = fiber.StatusBadRequest
+		return c.Status(status).JSON(fiber.Map{"status": "error", "message": err.Error(), "data": nil})
+	}
+
+	id := uuid.FromStringOrNil(c.Params("id"))
+	if id.IsNil() {
+		status = fiber.StatusBadRequest
+		return c.Status(status).JSON(fiber.Map{"status": "error", "message": "invalid id", "data": nil})
+	}
+
+	version := c.Params("version")
+	if version == "" {
+		status = fiber.StatusBadRequest
+		return c.Status(status).JSON(fiber.Map{"status": "error", "message": "no version", "data": nil})
+	}
+
+	var (
+		platform   = ""
+		deployment = ""
+	)
+
+	if model.SupportedPlatform[m.Platform] {
+		platform = m.Platform
+	}
+
+	if model.SupportedDeployment[m.Deployment] {
+		deployment = m.Deployment
+	}
+
+	//endregion
+
+	var entity *model.PackageVersion
+	if requester.IsAdmin || requester.IsInternal {
+		entity, err = model.GetPackageVersionForAdmin(c.UserContext(), id, version, platform, deployment)
+	} else {
+		entity, err = model.GetPackageVersionForRequester(c.UserContext(), requester, id, version, platform, deployment)
+	}
+
+	if err != nil {
+		if errors.Is(err, model.ErrInvalidPackageVersion) {
+			status = fiber.StatusNotFound
+			return c.Status(status).JSON(fiber.Map{"status": "error", "message": err.Error(), "data": nil})
+		} else if err.Error() == "no rows in result set" {
+			status = fiber.StatusNotFound
+			return c.Status(status).JSON(fiber.Map{"status": "error", "message": "package not found", "data": nil})
+		} else if err.Error() == "no access" {
+			status = fiber.StatusForbidden
+			return c.Status(status).JSON(fiber.Map{"status": "error", "message": "no access", "data": nil})
+		}
+		status = fiber.StatusInternalServerError
+		return c.Status(status).JSON(fiber.Map{"status": "error", "message": err.Error(), "data": nil})
+	}
+
+	return c.Status(status).JSON(fiber.Map{"status": "ok", "message": "ok", "data": entity})
+}
+
+// CreatePackageVersion godoc
+// @Summary      Create package version
+// @Description  Publishes the new immutable version of the package, the version must be greater than all previous versions and becomes the latest version. Package jobs build the latest version into its own pak files
+// @Tags         packages
+// @Accept       json
+// @Produce      json
+// @Security	 Bearer
+// @Param        id path string true "Package ID"
+// @Param        version body model.PackageVersionCreateMetadata true "Version"
+// @Success      200  {object}  model.PackageVersion
+// @Failure      400  {object}  error
+// @Failure      403  {object}  error
+// @Failure      404  {object}  error
+// @Failure      500  {object}  error
+// @Router       /packages/:id/versions [post]
+func CreatePackageVersion(c *fiber.Ctx) error {
+	var (
+		status      = fiber.StatusOK
+		requesterId = uuid.Nil
+	)
+	defer func() {
+		err := database.ReportRequestEvent(c, requesterId, status)
+		if err != nil {
+			logrus.Errorf("failed to report request: %v", err)
+		}
+	}()
+
+	//region Requester
+
+	// Get requester
+	requester, err := helper.GetRequester(c)
+	if err != nil {
+		status = fiber.StatusBadRequest
+		return c.Status(status).JSON(fiber.Map{"status": "error", "message": "no requester", "data": nil})
+	}
+
+	// Check if requester is banned
+	if requester.IsBanned {
+		status = fiber.StatusForbidden
+		return c.Status(status).JSON(fiber.Map{"status": "error", "message": "banned", "data": nil})
+	}
+
+	requesterId = requester.Id
+	//endregion
+
+	//region Request metadata
+
+	id := uuid.FromStringOrNil(c.Params("id"))
+	if id.IsNil() {
+		status = fiber.StatusBadRequest
+		return c.Status(status).JSON(fiber.Map{"status": "error", "message": "invalid id", "data": nil})
+	}
+
+	m := model.PackageVersionCreateMetadata{}
+	if err = c.BodyParser(&m); err != nil {
+		status = fiber.StatusBadRequest
+		return c.Status(status).JSON(fiber.Map{"status": "error", "message": err.Error(), "data": nil})
+	}
+
+	if m.Version == "" {
+		status = fiber.StatusBadRequest
+		return c.Status(status).JSON(fiber.Map{"status": "error", "message": "no version", "data": nil})
+	}
+
+	//endregion
+
+	var entity *model.PackageVersion
+	if requester.IsAdmin || requester.IsInternal {
+		entity, err = model.CreatePackageVersionForAdmin(c.UserContext(), requester, id, m)
+	} else {
+		entity, err = model.CreatePackageVersionForRequester(c.UserContext(), requester, id, m)
+	}
+
+	if err != nil {
+		if errors.Is(err, model.ErrInvalidPackageVersion) {
+			status = fiber.StatusBadRequest
+			return c.Status(status).JSON(fiber.Map{"status": "error", "message": err.Error(), "data": nil})
+		} else if err.Error() == "no rows in result set" {
+			status = fiber.StatusNotFound
+			return c.Status(status).JSON(fiber.Map{"status": "error", "message": "package not found", "data": nil})
+		} else if err.Error() == "no access" {
+			status = fiber.StatusForbidden
+			return c.Status(status).JSON(fiber.Map{"status": "error", "message": "no access", "data": nil})
+		}
+		status = fiber.StatusInternalServerError
+		return c.Status(status).JSON(fiber.Map{"status": "error", "message": err.Error(), "data": nil})
+	}
+
+	return c.Status(status).JSON(fiber.Map{"status": "ok", "message": "ok", "data": entity})
+}
+
+// UpdatePackageVersion godoc
+// @Summary      Update package version
+// @Description  Deprecates the version or removes the deprecation, versions are immutable otherwise. Deprecated versions are not used as the latest version unless all versions are deprecated
+// @Tags         packages
+// @Accept       json
+// @Produce      json
+// @Security	 Bearer
+// @Param        id path string true "Package ID"
+// @Param        version path string true "Version"
+// @Param        metadata body model.PackageVersionUpdateMetadata true "Deprecation"
+// @Success      200  {object}  model.PackageVersion
+// @Failure      400  {object}  error
+// @Failure      403  {object}  error
+// @Failure      404  {object}  error
+// @Failure      500  {object}  error
+// @Router       /packages/:id/versions/:version [patch]
+func UpdatePackageVersion(c *fiber.Ctx) error {
+	var (
+		status      = fiber.StatusOK
+		requesterId = uuid.Nil
+	)
+	defer func() {
+		err := database.ReportRequestEvent(c, requesterId, status)
+		if err != nil {
+			logrus.Errorf("failed to report request: %v", err)
+		}
+	}()
+
+	//region Requester
+
+	// Get requester
+	requester, err := helper.GetRequester(c)
+	if err != nil {
+		status = fiber.StatusBadRequest
+		return c.Status(status).JSON(fiber.Map{"status": "error", "message": "no requester", "data": nil})
+	}
+
+	// Check if requester is banned
+	if requester.IsBanned {
+		status = fiber.StatusForbidden
+		return c.Status(status).JSON(fiber.Map{"status": "error", "message": "banned", "data": nil})
+	}
+
+	requesterId = requester.Id
+	//endregion
+
+	//region Request metadata
+
+	id := uuid.FromStringOrNil(c.Params("id"))
+	if id.IsNil() {
+		status = fiber.StatusBadRequest
+		return c.Status(status).JSON(fiber.Map{"status": "error", "message": "invalid id", "data": nil})
+	}
+
+	version := c.Params("version")
+	if version == "" {
+		status = fiber.StatusBadRequest
+		return c.Status(status).JSON(fiber.Map{"status": "error", "message": "no version", "data": nil})
+	}
+
+	m := model.PackageVersionUpdateMetadata{}
+	if err = c.BodyParser(&m); err != nil {
+		status = fiber.StatusBadRequest
+		return c.Status(status).JSON(fiber.Map{"status": "error", "message": err.Error(), "data": nil})
+	}
+
+	//endregion
+
+	var entity *model.PackageVersion
+	if requester.IsAdmin || requester.IsInternal {
+		entity, err = model.UpdatePackageVersionForAdmin(c.UserContext(), id, version, m)
+	} else {
+		entity, err = model.UpdatePackageVersionForRequester(c.UserContext(), requester, id, version, m)
+	}
+
+	if err != nil {
+		if errors.Is(err, model.ErrInvalidPackageVersion) {
+			status = fiber.StatusNotFound
+			return c.Status(status).JSON(fiber.Map{"status": "error", "message": err.Error(), "data": nil})
+		} else if err.Error() == "no rows in result set" {
+			status = fiber.StatusNotFound
+			return c.Status(status).JSON(fiber.Map{"status": "error", "message": "package not found", "data": nil})
+		} else if err.Error() == "no access" {
+			status = fiber.StatusForbidden
+			return c.Status(status).JSON(fiber.Map{"status": "error", "message": "no access", "data": nil})
+		}
+		status = fiber.StatusInternalServerError
+		return c.Status(status).JSON(fiber.Map{"status": "error", "message": err.Error(), "data": nil})
+	}
+
+	return c.Status(status).JSON(fiber.Map{"status": "ok", "message": "ok", "data": entity})
+}
+
+// GetWorldPackageVersion godoc
+// @Summary      Get world package version
+// @Description  Pinned version of the world package or the latest version if the world does not pin one
+// @Tags         worlds
+// @Accept       json
+// @Produce      json
+// @Security	 Bearer
+// @Param        id path string true "World ID"
+// @Success      200  {object}  model.WorldPackageVersion
+// @Failure      400  {object}  error
+// @Failure      403  {object}  error
+// @Failure      404  {object}  error
+// @Failure      500  {object}  error
+// @Router       /worlds/:id/package-version [get]
+func GetWorldPackageVersion(c *fiber.Ctx) error {
+	var (
+		status      = fiber.StatusOK
+		requesterId = uuid.Nil
+	)
+	defer func() {
+		err := database.ReportRequestEvent(c, requesterId, status)
+		if err != nil {
+			logrus.Errorf("failed to report request: %v", err)
+		}
+	}()
+
+	//region Requester
+
+	// Get requester
+	requester, err := helper.GetRequester(c)
+	if err != nil {
+		status = fiber.StatusBadRequest
+		return c.Status(status).JSON(fiber.Map{"status": "error", "message": "no requester", "data": nil})
+	}
+
+	// Check if requester is banned
+	if requester.IsBanned {
+		status = fiber.StatusForbidden
+		return c.Status(status).JSON(fiber.Map{"status": "error", "message": "banned", "data": nil})
+	}
+
+	requesterId = requester.Id
+	//endregion
+
+	worldId := uuid.FromStringOrNil(c.Params("id"))
+	if worldId.IsNil() {
+		status = fiber.StatusBadRequest
+		return c.Status(status).JSON(fiber.Map{"status": "error", "message": "invalid id", "data": nil})
+	}
+
+	var entity *model.WorldPackageVersion
+	if requester.IsAdmin || requester.IsInternal {
+		entity, err = model.GetWorldPackageVersionForAdmin(c.UserContext(), worldId)
+	} else {
+		entity, err = model.GetWorldPackageVersionForRequester(c.UserContext(), requester, worldId)
+	}
+
+	if err != nil {
+		if err.Error() == "no rows in result set" {
+			status = fiber.StatusNotFound
+			return c.Status(status).JSON(fiber.Map{"status": "error", "message": "world not found", "data": nil})
+		} else if err.Error() == "no access" {
+			status = fiber.StatusForbidden
+			return c.Status(status).JSON(fiber.Map{"status": "error", "message": "no access", "data": nil})
+		}
+		status = fiber.StatusInternalServerError
+		return c.Status(status).JSON(fiber.Map{"status": "error", "message": err.Error(), "data": nil})
+	}
+
+	return c.Status(status).JSON(fiber.Map{"status": "ok", "message": "ok", "data": entity})
+}
+
+// PinWorldPackageVersion godoc
+// @Summary      Pin world package version
+// @Description  Pins the version of the world package so the world keeps loading its pak files when new versions are published, a null version removes the pin
+// @Tags         worlds
+// @Accept       json
+// @Produce      json
+// @Security	 Bearer
+// @Param        id path string true "World ID"
+// @Param        version body model.WorldPackageVersionMetadata true "Version"
+// @Success      200  {object}  model.WorldPackageVersion
+// @Failure      400  {object}  error
+// @Failure      403  {object}  error
+// @Failure      404  {object}  error
+// @Failure      500  {object}  error
+// @Router       /worlds/:id/package-version [put]
+func PinWorldPackageVersion(c *fiber.Ctx) error {
+	var (
+		status      = fiber.StatusOK
+		requesterId = uuid.Nil
+	)
+	defer func() {
+		err := database.ReportRequestEvent(c, requesterId, status)
+		if err != nil {
+			logrus.Errorf("failed to report request: %v", err)
+		}
+	}()
+
+	//region Requester
+
+	// Get requester
+	requester, err := helper.GetRequester(c)
+	if err != nil {
+		status = fiber.StatusBadRequest
+		return c.Status(status).JSON(fiber.Map{"status": "error", "message": "no requester", "data": nil})
+	}
+
+	// Check if requester is banned
+	if requester.IsBanned {
+		status = fiber.StatusForbidden
+		return c.Status(status).JSON(fiber.Map{"status": "error", "message": "banned", "data": nil})
+	}
+
+	requesterId = requester.Id
+	//endregion
+
+	//region Request metadata
+
+	worldId := uuid.FromStringOrNil(c.Params("id"))
+	if worldId.IsNil() {
+		status = fiber.StatusBadRequest
+		return c.Status(status).JSON(fiber.Map{"status": "error", "message": "invalid id", "data": nil})
+	}
+
+	m := model.WorldPackageVersionMetadata{}
+	if err = c.BodyParser(&m); err != nil {
+		status = fiber.StatusBadRequest
+		return c.Status(status).JSON(fiber.Map{"status": "error", "message": err.Error(), "data": nil})
+	}
+
+	//endregion
+
+	var entity *model.WorldPackageVersion
+	if requester.IsAdmin || requester.IsInternal {
+		entity, err = model.PinWorldPackageVersionForAdmin(c.UserContext(), worldId, m.Version)
+	} else {
+		entity, err = model.PinWorldPackageVersionForRequester(c.UserContext(), requester, worldId, m.Version)
+	}
+
+	if err != nil {
+		if errors.Is(err, model.ErrInvalidPackageVersion) {
+			status = fiber.StatusBadRequest
+			return c.Status(status).JSON(fiber.Map{"status": "error", "message": err.Error(), "data": nil})
+		} else if err.Error() == "no rows in result set" {
+			status = fiber.StatusNotFound
+			return c.Status(status).JSON(fiber.Map{"status": "error", "message": "world not found", "data": nil})
+		} else if err.Error() == "no access" {
+			status = fiber.StatusForbidden
+			return c.Status(status).JSON(fiber.Map{"status": "error", "message": "no access", "data": nil})
+		}
+		status = fiber.StatusInternalServerError
+		return c.Status(status).JSON(fiber.Map{"status": "error", "message": err.Error(), "data": nil})
+	}
+
+	return c.Status(status).JSON(fiber.Map{"status": "ok", "message": "ok", "data": entity})
+}
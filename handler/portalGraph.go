@@ -0,0 +1,198 @@
+package handler
+
+import (
+	"errors"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofrs/uuid"
+	"github.com/sirupsen/logrus"
+	"veverse-api/database"
+	"veverse-api/helper"
+	"veverse-api/model"
+)
+
+// IndexInboundPortals godoc
+// @Summary      Index inbound portals
+// @Description  Portals leading into the world, requesters see portals they can use to enter the world
+// @Tags         portals
+// @Accept       json
+// @Produce      json
+// @Security	 Bearer
+// @Param        id path string true "World ID"
+// @Param        offset query int false "Offset"
+// @Param        limit query int false "Limit"
+// @Success      200  {object}  []model.PortalLink
+// @Failure      400  {object}  error
+// @Failure      403  {object}  error
+// @Failure      404  {object}  error
+// @Failure      500  {object}  error
+// @Router       /portals/:id/inbound [get]
+func IndexInboundPortals(c *fiber.Ctx) error {
+	var (
+		status      = fiber.StatusOK
+		requesterId = uuid.Nil
+	)
+	defer func() {
+		err := database.ReportRequestEvent(c, requesterId, status)
+		if err != nil {
+			logrus.Errorf("failed to report request: %v", err)
+		}
+	}()
+
+	//region Requester
+
+	// Get requester
+	requester, err := helper.GetRequester(c)
+	if err != nil {
+		status = fiber.StatusBadRequest
+		return c.Status(status).JSON(fiber.Map{"status": "error", "message": "no requester", "data": nil})
+	}
+
+	// Check if requester is banned
+	if requester.IsBanned {
+		status = fiber.StatusForbidden
+		return c.Status(status).JSON(fiber.Map{"status": "error", "message": "banned", "data": nil})
+	}
+
+	requesterId = requester.Id
+	//endregion
+
+	//region Request metadata
+
+	m := model.BatchRequestMetadata{}
+	if err = c.QueryParser(&m); err != nil {
+		status = fiber.StatusBadRequest
+		return c.Status(status).JSON(fiber.Map{"status": "error", "message": err.Error(), "data": nil})
+	}
+
+	worldId := uuid.FromStringOrNil(c.Params("id"))
+	if worldId.IsNil() {
+		status = fiber.StatusBadRequest
+		return c.Status(status).JSON(fiber.Map{"status": "error", "message": "invalid id", "data": nil})
+	}
+
+	var (
+		offset int64 = 0
+		limit  int64 = 100
+	)
+
+	if m.Offset > 0 {
+		offset = m.Offset
+	}
+
+	if m.Limit > 0 && m.Limit < 100 {
+		limit = m.Limit
+	}
+
+	//endregion
+
+	var (
+		entities []model.PortalLink
+		total    int64
+	)
+
+	if requester.IsAdmin || requester.IsInternal {
+		entities, total, err = model.IndexInboundPortalsForAdmin(c.UserContext(), worldId, offset, limit)
+	} else {
+		entities, total, err = model.IndexInboundPortalsForRequester(c.UserContext(), requester, worldId, offset, limit)
+	}
+
+	if err != nil {
+		if err.Error() == "no rows in result set" {
+			status = fiber.StatusNotFound
+			return c.Status(status).JSON(fiber.Map{"status": "error", "message": "world not found", "data": nil})
+		} else if err.Error() == "no access" {
+			status = fiber.StatusForbidden
+			return c.Status(status).JSON(fiber.Map{"status": "error", "message": "no access", "data": nil})
+		}
+		status = fiber.StatusInternalServerError
+		return c.Status(status).JSON(fiber.Map{"status": "error", "message": err.Error(), "data": nil})
+	}
+
+	return c.Status(status).JSON(fiber.Map{"data": fiber.Map{"entities": entities, "offset": offset, "limit": limit, "total": total}})
+}
+
+// GetWorldRoute godoc
+// @Summary      Get world route
+// @Description  Shortest sequence of portals leading from the world to the destination world, requester routes only pass through portals and worlds the requester can view
+// @Tags         worlds
+// @Accept       json
+// @Produce      json
+// @Security	 Bearer
+// @Param        id path string true "World ID"
+// @Param        to query string true "Destination world ID"
+// @Success      200  {object}  model.PortalRoute
+// @Failure      400  {object}  error
+// @Failure      403  {object}  error
+// @Failure      404  {object}  error
+// @Failure      500  {object}  error
+// @Router       /worlds/:id/routes [get]
+func GetWorldRoute(c *fiber.Ctx) error {
+	var (
+		status      = fiber.StatusOK
+		requesterId = uuid.Nil
+	)
+	defer func() {
+		err := database.ReportRequestEvent(c, requesterId, status)
+		if err != nil {
+			logrus.Errorf("failed to report request: %v", err)
+		}
+	}()
+
+	//region Requester
+
+	// Get requester
+	requester, err := helper.GetRequester(c)
+	if err != nil {
+		status = fiber.StatusBadRequest
+		return c.Status(status).JSON(fiber.Map{"status": "error", "message": "no requester", "data": nil})
+	}
+
+	// Check if requester is banned
+	if requester.IsBanned {
+		status = fiber.StatusForbidden
+		return c.Status(status).JSON(fiber.Map{"status": "error", "message": "banned", "data": nil})
+	}
+
+	requesterId = requester.Id
+	//endregion
+
+	//region Request metadata
+
+	fromId := uuid.FromStringOrNil(c.Params("id"))
+	if fromId.IsNil() {
+		status = fiber.StatusBadRequest
+		return c.Status(status).JSON(fiber.Map{"status": "error", "message": "invalid id", "data": nil})
+	}
+
+	toId := uuid.FromStringOrNil(c.Query("to"))
+	if toId.IsNil() {
+		status = fiber.StatusBadRequest
+		return c.Status(status).JSON(fiber.Map{"status": "error", "message": "invalid destination id", "data": nil})
+	}
+
+	//endregion
+
+	var route *model.PortalRoute
+	if requester.IsAdmin || requester.IsInternal {
+		route, err = model.FindPortalRouteForAdmin(c.UserContext(), fromId, toId)
+	} else {
+		route, err = model.FindPortalRouteForRequester(c.UserContext(), requester, fromId, toId)
+	}
+
+	if err != nil {
+		if errors.Is(err, model.ErrNoPortalRoute) {
+			status = fiber.StatusNotFound
+			return c.Status(status).JSON(fiber.Map{"status": "error", "message": err.Error(), "data": nil})
+		} else if err.Error() == "no rows in result set" {
+			status = fiber.StatusNotFound
+			return c.Status(status).JSON(fiber.Map{"status": "error", "message": "world not found", "data": nil})
+		} else if err.Error() == "no access" {
+			status = fiber.StatusForbidden
+			return c.Status(status).JSON(fiber.Map{"status": "error", "message": "no access", "data": nil})
+		}
+		status = fiber.StatusInternalServerError
+		return c.Status(status).JSON(fiber.Map{"status": "error", "message": err.Error(), "data": nil})
+	}
+
+	return c.Status(status).JSON(fiber.Map{"status": "ok", "message": "ok", "data": route})
+}
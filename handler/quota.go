@@ -0,0 +1,104 @@
+package handler
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/sirupsen/logrus"
+	"veverse-api/helper"
+	"veverse-api/model"
+)
+
+// GetRequesterStorageUsage godoc
+// @Summary Get requester storage usage
+// @Description Get the number of bytes stored by files uploaded by the requester and files of apps owned by the requester with their quotas
+// @Tags Users
+// @Accept json
+// @Produce json
+// @Security	 Bearer
+// @Success 200 {object} model.StorageUsage
+// @Failure 403 {object} model.ErrorResponse
+// @Failure 500 {object} model.ErrorResponse
+// @Router /users/me/storage [get]
+func GetRequesterStorageUsage(c *fiber.Ctx) error {
+	//region Requester
+
+	// Get requester
+	requester, err := helper.GetRequester(c)
+	if err != nil {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"status": "error", "message": "no requester", "data": nil})
+	}
+
+	// Check if requester is banned
+	if requester.IsBanned {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"status": "error", "message": "banned", "data": nil})
+	}
+
+	//endregion
+
+	usage, err := model.GetStorageUsageForRequester(c.UserContext(), requester.Id)
+	if err != nil {
+		logrus.Errorf("failed to get storage usage of %s: %v", requester.Id, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"status": "error", "message": "failed to get storage usage", "data": nil})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"status": "ok", "message": nil, "data": usage})
+}
+
+// IndexStorageUsage godoc
+// @Summary Index storage usage
+// @Description Report of bytes stored by users or apps ordered by usage, admin only
+// @Tags Files
+// @Accept json
+// @Produce json
+// @Param group query string false "Group by user (default) or app"
+// @Param offset query integer false "Offset"
+// @Param limit query integer false "Limit"
+// @Security	 Bearer
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} model.ErrorResponse
+// @Failure 403 {object} model.ErrorResponse
+// @Router /files/storage [get]
+func IndexStorageUsage(c *fiber.Ctx) error {
+	//region Requester
+
+	// Get requester
+	requester, err := helper.GetRequester(c)
+	if err != nil {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"status": "error", "message": "no requester", "data": nil})
+	}
+
+	// Check if requester is banned
+	if requester.IsBanned {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"status": "error", "message": "banned", "data": nil})
+	}
+
+	if !(requester.IsAdmin || requester.IsInternal) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"status": "error", "message": "forbidden", "data": nil})
+	}
+
+	//endregion
+
+	m := model.StorageUsageBatchRequestMetadata{}
+	if err = c.QueryParser(&m); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "error", "message": err.Error(), "data": nil})
+	}
+
+	var (
+		offset int64 = 0
+		limit  int64 = 100
+	)
+
+	if m.Offset > 0 {
+		offset = m.Offset
+	}
+
+	if m.Limit > 0 && m.Limit < 100 {
+		limit = m.Limit
+	}
+
+	entities, total, err := model.IndexStorageUsageForAdmin(c.UserContext(), m.Group, offset, limit)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "error", "message": err.Error(), "data": nil})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"status": "ok", "message": nil, "data": fiber.Map{"entities": entities, "offset": offset, "limit": limit, "total": total}})
+}
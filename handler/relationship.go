@@ -0,0 +1,300 @@
+package handler
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofrs/uuid"
+	"veverse-api/helper"
+	"veverse-api/model"
+)
+
+// IndexEntityRelationships godoc
+// @Summary Index entity relationships
+// @Description Index relationships starting from the entity
+// @Tags Entity
+// @Accept json
+// @Produce json
+// @Param id path string true "Entity ID"
+// @Param type query string false "Relationship type"
+// @Param limit query integer false "Limit"
+// @Param offset query integer false "Offset"
+// @Security	 Bearer
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} model.ErrorResponse
+// @Failure 403 {object} model.ErrorResponse
+// @Failure 404 {object} model.ErrorResponse
+// @Failure 500 {object} model.ErrorResponse
+// @Router /entities/{id}/relationships [get]
+func IndexEntityRelationships(c *fiber.Ctx) error {
+	return indexEntityRelationships(c, false)
+}
+
+// IndexEntityInboundRelationships godoc
+// @Summary Index entity inbound relationships
+// @Description Index relationships pointing to the entity
+// @Tags Entity
+// @Accept json
+// @Produce json
+// @Param id path string true "Entity ID"
+// @Param type query string false "Relationship type"
+// @Param limit query integer false "Limit"
+// @Param offset query integer false "Offset"
+// @Security	 Bearer
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} model.ErrorResponse
+// @Failure 403 {object} model.ErrorResponse
+// @Failure 404 {object} model.ErrorResponse
+// @Failure 500 {object} model.ErrorResponse
+// @Router /entities/{id}/relationships/inbound [get]
+func IndexEntityInboundRelationships(c *fiber.Ctx) error {
+	return indexEntityRelationships(c, true)
+}
+
+func indexEntityRelationships(c *fiber.Ctx, inbound bool) (err error) {
+	//region Requester
+
+	// Get requester
+	requester, err := helper.GetRequester(c)
+	if err != nil {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"status": "error", "message": "no requester", "data": nil})
+	}
+
+	// Check if requester is banned
+	if requester.IsBanned {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"status": "error", "message": "banned", "data": nil})
+	}
+
+	//endregion
+
+	//region Request metadata
+	id := uuid.FromStringOrNil(c.Params("id"))
+	if id.IsNil() {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "error", "message": "no id", "data": nil})
+	}
+
+	m := model.RelationshipBatchRequestMetadata{}
+	err = c.QueryParser(&m)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "error", "message": err.Error(), "data": nil})
+	}
+
+	var (
+		offset        int64 = 0
+		limit         int64 = 100
+		total         int64
+		relationships []model.Relationship
+	)
+
+	if m.Offset > 0 {
+		offset = m.Offset
+	}
+
+	if m.Limit > 0 && m.Limit < 100 {
+		limit = m.Limit
+	}
+
+	if m.Type != "" && !model.ValidRelationshipType(m.Type) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "error", "message": "invalid type", "data": nil})
+	}
+	//endregion
+
+	if requester.IsAdmin || requester.IsInternal {
+		relationships, total, err = model.IndexRelationshipsForAdmin(c.UserContext(), id, m.Type, inbound, offset, limit)
+	} else {
+		relationships, total, err = model.IndexRelationshipsForRequester(c.UserContext(), requester, id, m.Type, inbound, offset, limit)
+	}
+
+	if err != nil {
+		if err.Error() == "no rows in result set" {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"status": "error", "message": "not found", "data": nil})
+		} else if err.Error() == "no access" {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"status": "error", "message": "forbidden", "data": nil})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"status": "error", "message": err.Error(), "data": nil})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"data": fiber.Map{"offset": offset, "limit": limit, "total": total, "entities": relationships}})
+}
+
+// CreateEntityRelationship godoc
+// @Summary Create entity relationship
+// @Description Create a relationship from the entity to the target entity, requires edit access to the entity and view access to the target
+// @Tags Entity
+// @Accept json
+// @Produce json
+// @Param id path string true "Source entity ID"
+// @Param request body model.RelationshipCreateMetadata true "Relationship"
+// @Security	 Bearer
+// @Success 200 {object} model.Relationship
+// @Failure 400 {object} model.ErrorResponse
+// @Failure 403 {object} model.ErrorResponse
+// @Failure 404 {object} model.ErrorResponse
+// @Router /entities/{id}/relationships [post]
+func CreateEntityRelationship(c *fiber.Ctx) error {
+	//region Requester
+
+	// Get requester
+	requester, err := helper.GetRequester(c)
+	if err != nil {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"status": "error", "message": "no requester", "data": nil})
+	}
+
+	// Check if requester is banned
+	if requester.IsBanned {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"status": "error", "message": "banned", "data": nil})
+	}
+
+	//endregion
+
+	//region Request metadata
+	id := uuid.FromStringOrNil(c.Params("id"))
+	if id.IsNil() {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "error", "message": "no id", "data": nil})
+	}
+
+	m := model.RelationshipCreateMetadata{}
+	err = c.BodyParser(&m)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "error", "message": err.Error(), "data": nil})
+	}
+
+	if m.TargetId.IsNil() {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "error", "message": "no target", "data": nil})
+	}
+
+	if !model.ValidRelationshipType(m.Type) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "error", "message": "invalid type", "data": nil})
+	}
+	//endregion
+
+	var relationship *model.Relationship
+	if requester.IsAdmin || requester.IsInternal {
+		relationship, err = model.CreateRelationshipForAdmin(c.UserContext(), id, m)
+	} else {
+		relationship, err = model.CreateRelationshipForRequester(c.UserContext(), requester, id, m)
+	}
+
+	if err != nil {
+		if err.Error() == "no rows in result set" {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"status": "error", "message": "not found", "data": nil})
+		} else if err.Error() == "no access" {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"status": "error", "message": "forbidden", "data": nil})
+		}
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "error", "message": err.Error(), "data": nil})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"status": "ok", "message": nil, "data": relationship})
+}
+
+// UpdateEntityRelationship godoc
+// @Summary Update entity relationship
+// @Description Update relationship metadata and order, requires edit access to the source entity
+// @Tags Entity
+// @Accept json
+// @Produce json
+// @Param id path string true "Relationship ID"
+// @Param request body model.RelationshipUpdateMetadata true "Relationship"
+// @Security	 Bearer
+// @Success 200 {object} model.Relationship
+// @Failure 400 {object} model.ErrorResponse
+// @Failure 403 {object} model.ErrorResponse
+// @Failure 404 {object} model.ErrorResponse
+// @Router /entities/relationships/{id} [patch]
+func UpdateEntityRelationship(c *fiber.Ctx) error {
+	//region Requester
+
+	// Get requester
+	requester, err := helper.GetRequester(c)
+	if err != nil {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"status": "error", "message": "no requester", "data": nil})
+	}
+
+	// Check if requester is banned
+	if requester.IsBanned {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"status": "error", "message": "banned", "data": nil})
+	}
+
+	//endregion
+
+	//region Request metadata
+	id := uuid.FromStringOrNil(c.Params("id"))
+	if id.IsNil() {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "error", "message": "no id", "data": nil})
+	}
+
+	m := model.RelationshipUpdateMetadata{}
+	err = c.BodyParser(&m)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "error", "message": err.Error(), "data": nil})
+	}
+	//endregion
+
+	var relationship *model.Relationship
+	if requester.IsAdmin || requester.IsInternal {
+		relationship, err = model.UpdateRelationshipForAdmin(c.UserContext(), id, m)
+	} else {
+		relationship, err = model.UpdateRelationshipForRequester(c.UserContext(), requester, id, m)
+	}
+
+	if err != nil {
+		if err.Error() == "no rows in result set" {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"status": "error", "message": "not found", "data": nil})
+		} else if err.Error() == "no access" {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"status": "error", "message": "forbidden", "data": nil})
+		}
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "error", "message": err.Error(), "data": nil})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"status": "ok", "message": nil, "data": relationship})
+}
+
+// DeleteEntityRelationship godoc
+// @Summary Delete entity relationship
+// @Description Delete relationship, requires edit access to the source or the target entity
+// @Tags Entity
+// @Accept json
+// @Produce json
+// @Param id path string true "Relationship ID"
+// @Security	 Bearer
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} model.ErrorResponse
+// @Failure 403 {object} model.ErrorResponse
+// @Failure 404 {object} model.ErrorResponse
+// @Router /entities/relationships/{id} [delete]
+func DeleteEntityRelationship(c *fiber.Ctx) error {
+	//region Requester
+
+	// Get requester
+	requester, err := helper.GetRequester(c)
+	if err != nil {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"status": "error", "message": "no requester", "data": nil})
+	}
+
+	// Check if requester is banned
+	if requester.IsBanned {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"status": "error", "message": "banned", "data": nil})
+	}
+
+	//endregion
+
+	id := uuid.FromStringOrNil(c.Params("id"))
+	if id.IsNil() {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "error", "message": "no id", "data": nil})
+	}
+
+	if requester.IsAdmin || requester.IsInternal {
+		err = model.DeleteRelationshipForAdmin(c.UserContext(), id)
+	} else {
+		err = model.DeleteRelationshipForRequester(c.UserContext(), requester, id)
+	}
+
+	if err != nil {
+		if err.Error() == "no rows in result set" {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"status": "error", "message": "not found", "data": nil})
+		} else if err.Error() == "no access" {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"status": "error", "message": "forbidden", "data": nil})
+		}
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "error", "message": err.Error(), "data": nil})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"status": "ok", "message": "ok", "data": nil})
+}
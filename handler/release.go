@@ -203,3 +203,137 @@ func GetLatestReleaseV2Public(c *fiber.Ctx) error {
 
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{"data": releaseV2})
 }
+
+// GetReleaseManifest godoc
+// @Summary Get release manifest
+// @Description Get the full list of release files with their paths, hashes and sizes
+// @Tags Releases
+// @Accept json
+// @Produce json
+// @Param id path string true "Release ID"
+// @Param platform query string false "Platform"
+// @Param deployment query string false "Deployment"
+// @Success 200 {object} model.ReleaseManifest
+// @Failure 400 {object} model.ErrorResponse
+// @Failure 403 {object} model.ErrorResponse
+// @Failure 404 {object} model.ErrorResponse
+// @Router /releases/{id}/manifest [get]
+func GetReleaseManifest(c *fiber.Ctx) error {
+	//region Requester
+
+	// Get requester
+	requester, _ := helper.GetRequester(c)
+
+	// Check if requester is banned
+	if requester != nil && requester.IsBanned {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"status": "error", "message": "banned", "data": nil})
+	}
+
+	//endregion
+
+	id := uuid.FromStringOrNil(c.Params("id"))
+	if id.IsNil() {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "error", "message": "no id", "data": nil})
+	}
+
+	m := model.ReleaseManifestRequestMetadata{}
+	if err := c.QueryParser(&m); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "error", "message": err.Error(), "data": nil})
+	}
+
+	var (
+		manifest *model.ReleaseManifest
+		err      error
+	)
+
+	if requester != nil && (requester.IsAdmin || requester.IsInternal) {
+		manifest, err = model.GetReleaseManifestForAdmin(c.UserContext(), id, m.Platform, m.Deployment)
+	} else {
+		var user = sm.User{}
+		if requester != nil {
+			user = *requester
+		}
+		manifest, err = model.GetReleaseManifestForRequester(c.UserContext(), &user, id, m.Platform, m.Deployment)
+	}
+
+	if err != nil {
+		if err.Error() == "no rows in result set" {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"status": "error", "message": "not found", "data": nil})
+		} else if err.Error() == "no access" {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"status": "error", "message": "forbidden", "data": nil})
+		}
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "error", "message": err.Error(), "data": nil})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"status": "ok", "message": nil, "data": manifest})
+}
+
+// GetReleaseDelta godoc
+// @Summary Get release delta
+// @Description Get files added, changed and removed since the previous release per platform and deployment to update the app incrementally
+// @Tags Releases
+// @Accept json
+// @Produce json
+// @Param id path string true "Release ID to update to"
+// @Param from query string true "Release ID to update from"
+// @Param platform query string false "Platform"
+// @Param deployment query string false "Deployment"
+// @Success 200 {object} model.ReleaseDelta
+// @Failure 400 {object} model.ErrorResponse
+// @Failure 403 {object} model.ErrorResponse
+// @Failure 404 {object} model.ErrorResponse
+// @Router /releases/{id}/delta [get]
+func GetReleaseDelta(c *fiber.Ctx) error {
+	//region Requester
+
+	// Get requester
+	requester, _ := helper.GetRequester(c)
+
+	// Check if requester is banned
+	if requester != nil && requester.IsBanned {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"status": "error", "message": "banned", "data": nil})
+	}
+
+	//endregion
+
+	id := uuid.FromStringOrNil(c.Params("id"))
+	if id.IsNil() {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "error", "message": "no id", "data": nil})
+	}
+
+	m := model.ReleaseDeltaRequestMetadata{}
+	if err := c.QueryParser(&m); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "error", "message": err.Error(), "data": nil})
+	}
+
+	fromId := uuid.FromStringOrNil(m.From)
+	if fromId.IsNil() {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "error", "message": "no from release id", "data": nil})
+	}
+
+	var (
+		delta *model.ReleaseDelta
+		err   error
+	)
+
+	if requester != nil && (requester.IsAdmin || requester.IsInternal) {
+		delta, err = model.GetReleaseDeltaForAdmin(c.UserContext(), fromId, id, m.Platform, m.Deployment)
+	} else {
+		var user = sm.User{}
+		if requester != nil {
+			user = *requester
+		}
+		delta, err = model.GetReleaseDeltaForRequester(c.UserContext(), &user, fromId, id, m.Platform, m.Deployment)
+	}
+
+	if err != nil {
+		if err.Error() == "no rows in result set" {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"status": "error", "message": "not found", "data": nil})
+		} else if err.Error() == "no access" {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"status": "error", "message": "forbidden", "data": nil})
+		}
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "error", "message": err.Error(), "data": nil})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"status": "ok", "message": nil, "data": delta})
+}
@@ -0,0 +1,115 @@
+package handler
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofrs/uuid"
+	"github.com/sirupsen/logrus"
+	"strings"
+	"veverse-api/database"
+	"veverse-api/helper"
+	"veverse-api/model"
+)
+
+// Search godoc
+// @Summary      Search
+// @Description  Searches worlds, packages, portals, object classes and art objects ranked by the full-text relevance of weighted names, titles and descriptions and by the name similarity for misspelled queries, snippets are HTML escaped and highlight matched words with <b> tags, facets count matches of every type, requesters only find entities they can view
+// @Tags         search
+// @Accept       json
+// @Produce      json
+// @Security	 Bearer
+// @Param        query query string true "Search query"
+// @Param        types query string false "Comma separated result types: world, package, portal, class, object"
+// @Param        offset query int false "Offset"
+// @Param        limit query int false "Limit"
+// @Success      200  {object}  []model.SearchResult
+// @Failure      400  {object}  error
+// @Failure      403  {object}  error
+// @Failure      500  {object}  error
+// @Router       /search [get]
+func Search(c *fiber.Ctx) error {
+	var (
+		status      = fiber.StatusOK
+		requesterId = uuid.Nil
+	)
+	defer func() {
+		err := database.ReportRequestEvent(c, requesterId, status)
+		if err != nil {
+			logrus.Errorf("failed to report request: %v", err)
+		}
+	}()
+
+	//region Requester
+
+	// Get requester
+	requester, err := helper.GetRequester(c)
+	if err != nil {
+		status = fiber.StatusBadRequest
+		return c.Status(status).JSON(fiber.Map{"status": "error", "message": "no requester", "data": nil})
+	}
+
+	// Check if requester is banned
+	if requester.IsBanned {
+		status = fiber.StatusForbidden
+		return c.Status(status).JSON(fiber.Map{"status": "error", "message": "banned", "data": nil})
+	}
+
+	requesterId = requester.Id
+	//endregion
+
+	//region Request metadata
+
+	m := model.SearchRequestMetadata{}
+	if err = c.QueryParser(&m); err != nil {
+		status = fiber.StatusBadRequest
+		return c.Status(status).JSON(fiber.Map{"status": "error", "message": err.Error(), "data": nil})
+	}
+
+	query := strings.TrimSpace(m.Query)
+	if query == "" {
+		status = fiber.StatusBadRequest
+		return c.Status(status).JSON(fiber.Map{"status": "error", "message": "no query", "data": nil})
+	}
+
+	var types []string
+	if m.Types != "" {
+		types = model.ParseFileQueryList(m.Types, model.SearchTypes)
+		if len(types) == 0 {
+			status = fiber.StatusBadRequest
+			return c.Status(status).JSON(fiber.Map{"status": "error", "message": "invalid types", "data": nil})
+		}
+	}
+
+	var (
+		offset int64 = 0
+		limit  int64 = 100
+	)
+
+	if m.Offset > 0 {
+		offset = m.Offset
+	}
+
+	if m.Limit > 0 && m.Limit < 100 {
+		limit = m.Limit
+	}
+
+	//endregion
+
+	var (
+		entities []model.SearchResult
+		facets   map[string]int64
+		total    int64
+	)
+
+	if requester.IsAdmin || requester.IsInternal {
+		entities, facets, total, err = model.SearchForAdmin(c.UserContext(), query, types, offset, limit)
+	} else {
+		entities, facets, total, err = model.SearchForRequester(c.UserContext(), requester, query, types, offset, limit)
+	}
+
+	if err != nil {
+		status = fiber.StatusInternalServerError
+		return c.Status(status).JSON(fiber.Map{"status": "error", "message": err.Error(), "data": nil})
+	}
+
+	return c.Status(status).JSON(fiber.Map{"data": fiber.Map{"entities": entities, "facets": facets, "offset": offset, "limit": limit, "total": total}})
+}
@@ -0,0 +1,115 @@
+package handler
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/gofiber/fiber/v2"
+	"github.com/sirupsen/logrus"
+	"io"
+	"strconv"
+	"veverse-api/localStorage"
+)
+
+// GetStorageObject godoc
+// @Summary Download locally stored object
+// @Description Download the object stored at the local storage, private objects require a signed url issued by the API
+// @Tags Storage
+// @Produce octet-stream
+// @Param key path string true "Object key"
+// @Param expires query integer false "Signed url expiration (unix time)"
+// @Param signature query string false "Signed url signature"
+// @Success 200 {file} binary
+// @Failure 403 {object} model.ErrorResponse
+// @Failure 404 {object} model.ErrorResponse
+// @Router /storage/{key} [get]
+func GetStorageObject(c *fiber.Ctx) error {
+	if !localStorage.IsUsed() {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"status": "error", "message": "not found", "data": nil})
+	}
+
+	key := c.Params("*")
+
+	object, err := localStorage.GetObject(key)
+	if err != nil {
+		if err == localStorage.ErrObjectNotFound {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"status": "error", "message": "not found", "data": nil})
+		}
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "error", "message": err.Error(), "data": nil})
+	}
+
+	if !object.Public {
+		expires, _ := strconv.ParseInt(c.Query("expires"), 10, 64)
+		if !localStorage.VerifySignature(fiber.MethodGet, key, expires, "", 0, c.Query("signature")) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"status": "error", "message": "forbidden", "data": nil})
+		}
+	}
+
+	if err = c.SendFile(object.Path); err != nil {
+		return err
+	}
+
+	if object.Mime != "" {
+		c.Set(fiber.HeaderContentType, object.Mime)
+	}
+
+	if object.Filename != "" {
+		c.Set(fiber.HeaderContentDisposition, fmt.Sprintf("attachment; filename=\"%s\"", object.Filename))
+	}
+
+	return nil
+}
+
+// PutStorageObject godoc
+// @Summary Upload object to the local storage
+// @Description Upload the object or the multipart upload part using the signed url issued by the API
+// @Tags Storage
+// @Accept octet-stream
+// @Produce json
+// @Param key path string true "Object key"
+// @Param expires query integer true "Signed url expiration (unix time)"
+// @Param signature query string true "Signed url signature"
+// @Param uploadId query string false "Multipart upload id"
+// @Param partNumber query integer false "Multipart upload part number"
+// @Success 200
+// @Failure 400 {object} model.ErrorResponse
+// @Failure 403 {object} model.ErrorResponse
+// @Failure 404 {object} model.ErrorResponse
+// @Router /storage/{key} [put]
+func PutStorageObject(c *fiber.Ctx) error {
+	if !localStorage.IsUsed() {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"status": "error", "message": "not found", "data": nil})
+	}
+
+	key := c.Params("*")
+	uploadId := c.Query("uploadId")
+
+	expires, _ := strconv.ParseInt(c.Query("expires"), 10, 64)
+	partNumber, _ := strconv.ParseInt(c.Query("partNumber"), 10, 64)
+	if !localStorage.VerifySignature(fiber.MethodPut, key, expires, uploadId, partNumber, c.Query("signature")) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"status": "error", "message": "forbidden", "data": nil})
+	}
+
+	// The body is streamed to the storage if the server is configured to stream request bodies
+	var body io.Reader = c.Context().RequestBodyStream()
+	if body == nil {
+		body = bytes.NewReader(c.Body())
+	}
+
+	if uploadId != "" {
+		etag, err := localStorage.PutUploadPart(key, uploadId, partNumber, body)
+		if err != nil {
+			logrus.Errorf("failed to store upload part %s #%d: %v", key, partNumber, err)
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "error", "message": err.Error(), "data": nil})
+		}
+
+		c.Set(fiber.HeaderETag, etag)
+		return c.SendStatus(fiber.StatusOK)
+	}
+
+	if err := localStorage.PutObject(key, body, c.Get(fiber.HeaderContentType)); err != nil {
+		logrus.Errorf("failed to store object %s: %v", key, err)
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "error", "message": err.Error(), "data": nil})
+	}
+
+	return c.SendStatus(fiber.StatusOK)
+}
@@ -0,0 +1,302 @@
+package handler
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofrs/uuid"
+	"github.com/sirupsen/logrus"
+	"strconv"
+	"veverse-api/aws/s3"
+	"veverse-api/helper"
+	"veverse-api/model"
+)
+
+// InitiateFileUpload godoc
+// @Summary Initiate multipart file upload
+// @Description Initiate a resumable multipart upload of a large file, parts are uploaded directly to S3 using presigned links
+// @Tags Files
+// @Accept json
+// @Produce json
+// @Param request body model.FileUploadInitiateMetadata true "Upload"
+// @Security	 Bearer
+// @Success 200 {object} model.FileUpload
+// @Failure 400 {object} model.ErrorResponse
+// @Failure 403 {object} model.ErrorResponse
+// @Failure 404 {object} model.ErrorResponse
+// @Failure 413 {object} model.ErrorResponse
+// @Router /files/uploads [post]
+func InitiateFileUpload(c *fiber.Ctx) error {
+	//region Requester
+
+	// Get requester
+	requester, err := helper.GetRequester(c)
+	if err != nil {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"status": "error", "message": "no requester", "data": nil})
+	}
+
+	// Check if requester is banned
+	if requester.IsBanned {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"status": "error", "message": "banned", "data": nil})
+	}
+
+	//endregion
+
+	m := model.FileUploadInitiateMetadata{}
+	if err = c.BodyParser(&m); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "error", "message": err.Error(), "data": nil})
+	}
+
+	if m.EntityId.IsNil() {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "error", "message": "no entity id", "data": nil})
+	}
+
+	var upload *model.FileUpload
+	if requester.IsAdmin || requester.IsInternal {
+		upload, err = model.InitiateFileUploadForAdmin(c.UserContext(), requester, m)
+	} else {
+		upload, err = model.InitiateFileUploadForRequester(c.UserContext(), requester, m)
+	}
+
+	if err != nil {
+		logrus.Warningf("failed to initiate file upload for %s: %v", m.EntityId, err)
+		if err.Error() == "no rows in result set" {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"status": "error", "message": "not found", "data": nil})
+		} else if err.Error() == "no access" {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"status": "error", "message": "forbidden", "data": nil})
+		} else if err.Error() == "storage quota exceeded" {
+			return c.Status(fiber.StatusRequestEntityTooLarge).JSON(fiber.Map{"status": "error", "message": "storage quota exceeded", "data": nil})
+		}
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "error", "message": err.Error(), "data": nil})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"status": "ok", "message": nil, "data": upload})
+}
+
+// GetFileUploadPartLink godoc
+// @Summary Get multipart file upload part link
+// @Description Get a presigned link to upload the part of the file with a PUT request, the ETag response header must be kept to complete the upload
+// @Tags Files
+// @Accept json
+// @Produce json
+// @Param id path string true "Upload ID"
+// @Param part path integer true "Part number (starting from 1)"
+// @Security	 Bearer
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} model.ErrorResponse
+// @Failure 403 {object} model.ErrorResponse
+// @Failure 404 {object} model.ErrorResponse
+// @Router /files/uploads/{id}/parts/{part} [get]
+func GetFileUploadPartLink(c *fiber.Ctx) error {
+	//region Requester
+
+	// Get requester
+	requester, err := helper.GetRequester(c)
+	if err != nil {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"status": "error", "message": "no requester", "data": nil})
+	}
+
+	// Check if requester is banned
+	if requester.IsBanned {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"status": "error", "message": "banned", "data": nil})
+	}
+
+	//endregion
+
+	id := uuid.FromStringOrNil(c.Params("id"))
+	if id.IsNil() {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "error", "message": "no id", "data": nil})
+	}
+
+	part, err := strconv.ParseInt(c.Params("part"), 10, 64)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "error", "message": "invalid part number", "data": nil})
+	}
+
+	var url string
+	if requester.IsAdmin || requester.IsInternal {
+		url, err = model.GetFileUploadPartLinkForAdmin(c.UserContext(), id, part)
+	} else {
+		url, err = model.GetFileUploadPartLinkForRequester(c.UserContext(), requester, id, part)
+	}
+
+	if err != nil {
+		if err.Error() == "no rows in result set" {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"status": "error", "message": "not found", "data": nil})
+		} else if err.Error() == "no access" {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"status": "error", "message": "forbidden", "data": nil})
+		}
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "error", "message": err.Error(), "data": nil})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"status": "ok", "message": nil, "data": fiber.Map{"partNumber": part, "url": url}})
+}
+
+// IndexFileUploadParts godoc
+// @Summary Index multipart file upload parts
+// @Description List parts uploaded so far to resume an interrupted upload
+// @Tags Files
+// @Accept json
+// @Produce json
+// @Param id path string true "Upload ID"
+// @Security	 Bearer
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} model.ErrorResponse
+// @Failure 403 {object} model.ErrorResponse
+// @Failure 404 {object} model.ErrorResponse
+// @Router /files/uploads/{id}/parts [get]
+func IndexFileUploadParts(c *fiber.Ctx) error {
+	//region Requester
+
+	// Get requester
+	requester, err := helper.GetRequester(c)
+	if err != nil {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"status": "error", "message": "no requester", "data": nil})
+	}
+
+	// Check if requester is banned
+	if requester.IsBanned {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"status": "error", "message": "banned", "data": nil})
+	}
+
+	//endregion
+
+	id := uuid.FromStringOrNil(c.Params("id"))
+	if id.IsNil() {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "error", "message": "no id", "data": nil})
+	}
+
+	var (
+		upload *model.FileUpload
+		parts  []s3.UploadedPart
+	)
+
+	if requester.IsAdmin || requester.IsInternal {
+		upload, parts, err = model.ListFileUploadPartsForAdmin(c.UserContext(), id)
+	} else {
+		upload, parts, err = model.ListFileUploadPartsForRequester(c.UserContext(), requester, id)
+	}
+
+	if err != nil {
+		if err.Error() == "no rows in result set" {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"status": "error", "message": "not found", "data": nil})
+		} else if err.Error() == "no access" {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"status": "error", "message": "forbidden", "data": nil})
+		}
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "error", "message": err.Error(), "data": nil})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"status": "ok", "message": nil, "data": fiber.Map{"upload": upload, "parts": parts}})
+}
+
+// CompleteFileUpload godoc
+// @Summary Complete multipart file upload
+// @Description Complete the multipart upload, creates or replaces the file record with the size and MIME type of the uploaded file, the file can be downloaded once its contents have been verified against the declared hash in the background
+// @Tags Files
+// @Accept json
+// @Produce json
+// @Param id path string true "Upload ID"
+// @Param request body model.FileUploadCompleteMetadata false "Uploaded parts"
+// @Security	 Bearer
+// @Success 200 {object} model.File
+// @Failure 400 {object} model.ErrorResponse
+// @Failure 403 {object} model.ErrorResponse
+// @Failure 404 {object} model.ErrorResponse
+// @Router /files/uploads/{id}/complete [post]
+func CompleteFileUpload(c *fiber.Ctx) error {
+	//region Requester
+
+	// Get requester
+	requester, err := helper.GetRequester(c)
+	if err != nil {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"status": "error", "message": "no requester", "data": nil})
+	}
+
+	// Check if requester is banned
+	if requester.IsBanned {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"status": "error", "message": "banned", "data": nil})
+	}
+
+	//endregion
+
+	id := uuid.FromStringOrNil(c.Params("id"))
+	if id.IsNil() {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "error", "message": "no id", "data": nil})
+	}
+
+	m := model.FileUploadCompleteMetadata{}
+	if len(c.Body()) > 0 {
+		if err = c.BodyParser(&m); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "error", "message": err.Error(), "data": nil})
+		}
+	}
+
+	var file *model.File
+	if requester.IsAdmin || requester.IsInternal {
+		file, err = model.CompleteFileUploadForAdmin(c, requester, id, m)
+	} else {
+		file, err = model.CompleteFileUploadForRequester(c, requester, id, m)
+	}
+
+	if err != nil {
+		logrus.Warningf("failed to complete file upload %s: %v", id, err)
+		if err.Error() == "no rows in result set" {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"status": "error", "message": "not found", "data": nil})
+		} else if err.Error() == "no access" {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"status": "error", "message": "forbidden", "data": nil})
+		}
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "error", "message": err.Error(), "data": nil})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"status": "ok", "message": nil, "data": file})
+}
+
+// AbortFileUpload godoc
+// @Summary Abort multipart file upload
+// @Description Abort the multipart upload and remove the uploaded parts
+// @Tags Files
+// @Accept json
+// @Produce json
+// @Param id path string true "Upload ID"
+// @Security	 Bearer
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} model.ErrorResponse
+// @Failure 403 {object} model.ErrorResponse
+// @Failure 404 {object} model.ErrorResponse
+// @Router /files/uploads/{id} [delete]
+func AbortFileUpload(c *fiber.Ctx) error {
+	//region Requester
+
+	// Get requester
+	requester, err := helper.GetRequester(c)
+	if err != nil {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"status": "error", "message": "no requester", "data": nil})
+	}
+
+	// Check if requester is banned
+	if requester.IsBanned {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"status": "error", "message": "banned", "data": nil})
+	}
+
+	//endregion
+
+	id := uuid.FromStringOrNil(c.Params("id"))
+	if id.IsNil() {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "error", "message": "no id", "data": nil})
+	}
+
+	if requester.IsAdmin || requester.IsInternal {
+		err = model.AbortFileUploadForAdmin(c.UserContext(), id)
+	} else {
+		err = model.AbortFileUploadForRequester(c.UserContext(), requester, id)
+	}
+
+	if err != nil {
+		if err.Error() == "no rows in result set" {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"status": "error", "message": "not found", "data": nil})
+		} else if err.Error() == "no access" {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"status": "error", "message": "forbidden", "data": nil})
+		}
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "error", "message": err.Error(), "data": nil})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"status": "ok", "message": "ok", "data": nil})
+}
@@ -2,6 +2,7 @@ package handler
 
 import (
 	sm "dev.hackerman.me/artheon/veverse-shared/model"
+	"errors"
 	"fmt"
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofrs/uuid"
@@ -11,6 +12,24 @@ import (
 	"veverse-api/model"
 )
 
+// IndexWorlds godoc
+// @Summary      Index Worlds
+// @Description  Fetch worlds, the trending sort orders worlds by the trending score
+// @Tags         worlds
+// @Accept       json
+// @Produce      json
+// @Security	 Bearer
+// @Param        offset query int false "Offset"
+// @Param        limit query int false "Limit"
+// @Param        query query string false "Search query"
+// @Param        sort query string false "Sort order" Enums(trending)
+// @Param        metaverseId query string false "Package ID"
+// @Param        platform query string false "Specify to attach the pak file"
+// @Param        deployment query string false "Specify to attach the pak file"
+// @Success      200  {object}  []model.World
+// @Failure      400  {object}  error
+// @Failure      500  {object}  error
+// @Router       /worlds [get]
 func IndexWorlds(c *fiber.Ctx) error {
 	var (
 		status      = fiber.StatusOK
@@ -85,6 +104,11 @@ func IndexWorlds(c *fiber.Ctx) error {
 		deployment = m.Deployment
 	}
 
+	if m.Sort != "" && m.Sort != model.SortTrending {
+		status = fiber.StatusBadRequest
+		return c.Status(status).JSON(fiber.Map{"status": "error", "message": "invalid sort", "data": nil})
+	}
+
 	//endregion
 
 	var (
@@ -92,7 +116,13 @@ func IndexWorlds(c *fiber.Ctx) error {
 		total    int64
 	)
 
-	if requester.IsAdmin || requester.IsInternal {
+	if m.Sort == model.SortTrending {
+		if requester.IsAdmin || requester.IsInternal {
+			entities, total, err = model.IndexWorldsTrendingForAdmin(c.UserContext(), requester, packageId, offset, limit, query, platform, deployment)
+		} else {
+			entities, total, err = model.IndexWorldsTrendingForRequester(c.UserContext(), requester, packageId, offset, limit, query, platform, deployment)
+		}
+	} else if requester.IsAdmin || requester.IsInternal {
 		if query == "" {
 			if packageId.IsNil() {
 				entities, total, err = model.IndexWorldsForAdminWithPak(c.UserContext(), requester, offset, limit, platform, deployment)
@@ -340,6 +370,32 @@ func GetWorld(c *fiber.Ctx) error {
 	return c.Status(status).JSON(fiber.Map{"data": entity})
 }
 
+// IndexWorldPlaceables godoc
+// @Summary      Index world objects
+// @Description  Objects of the world, spatial filters limit objects to the radius of the point, the axis-aligned box or the nearest to the point, objects are ordered by the distance to the point if it is set
+// @Tags         worlds
+// @Accept       json
+// @Produce      json
+// @Security	 Bearer
+// @Param        id path string true "World ID"
+// @Param        offset query int false "Offset"
+// @Param        limit query int false "Limit"
+// @Param        x query number false "Point X"
+// @Param        y query number false "Point Y"
+// @Param        z query number false "Point Z"
+// @Param        radius query number false "Radius around the point"
+// @Param        minX query number false "Box min X"
+// @Param        minY query number false "Box min Y"
+// @Param        minZ query number false "Box min Z"
+// @Param        maxX query number false "Box max X"
+// @Param        maxY query number false "Box max Y"
+// @Param        maxZ query number false "Box max Z"
+// @Param        nearest query int false "Number of objects nearest to the point, the total is -1"
+// @Success      200  {object}  []model.Object
+// @Failure      400  {object}  error
+// @Failure      403  {object}  error
+// @Failure      500  {object}  error
+// @Router       /worlds/:id/objects [get]
 func IndexWorldPlaceables(c *fiber.Ctx) error {
 	var (
 		status      = fiber.StatusOK
@@ -399,6 +455,27 @@ func IndexWorldPlaceables(c *fiber.Ctx) error {
 		worldId = uuid.FromStringOrNil(id)
 	}
 
+	// Parse spatial filters
+	spatial := model.ObjectSpatialQuery{}
+	err = c.QueryParser(&spatial)
+	if err != nil {
+		status = fiber.StatusBadRequest
+		return c.Status(status).JSON(fiber.Map{"status": "error", "message": err.Error(), "data": nil})
+	}
+
+	if err = spatial.Validate(); err != nil {
+		status = fiber.StatusBadRequest
+		return c.Status(status).JSON(fiber.Map{"status": "error", "message": err.Error(), "data": nil})
+	}
+
+	if spatial.Nearest > 0 {
+		offset = 0
+		if spatial.Nearest < limit {
+			limit = spatial.Nearest
+		}
+		spatial.Nearest = limit
+	}
+
 	//endregion
 
 	var (
@@ -406,7 +483,13 @@ func IndexWorldPlaceables(c *fiber.Ctx) error {
 		total      int64
 	)
 
-	if requester.IsAdmin || requester.IsInternal {
+	if spatial.IsSet() {
+		if requester.IsAdmin || requester.IsInternal {
+			placeables, total, err = model.IndexSpatialObjectsForAdminForWorld(c.UserContext(), worldId, spatial, offset, limit)
+		} else {
+			placeables, total, err = model.IndexSpatialObjectsForRequesterForWorld(c.UserContext(), requester, worldId, spatial, offset, limit)
+		}
+	} else if requester.IsAdmin || requester.IsInternal {
 		placeables, total, err = model.IndexObjectsForAdminForWorld(c.UserContext(), worldId, offset, limit)
 	} else {
 		placeables, total, err = model.IndexObjectsForRequesterForWorld(c.UserContext(), requester, worldId, offset, limit)
@@ -533,6 +616,104 @@ func CreateWorldPlaceable(c *fiber.Ctx) error {
 	return c.Status(status).JSON(fiber.Map{"status": "error", "message": "not implemented", "data": m.Id})
 }
 
+// BatchWorldPlaceables godoc
+// @Summary      Batch edit world objects
+// @Description  Create, update and delete world objects in a single transaction, nothing is applied if any operation fails
+// @Tags         worlds
+// @Accept       json
+// @Produce      json
+// @Security	 Bearer
+// @Param        id path string true "World ID"
+// @Param        operations body model.ObjectBatchEditMetadata true "Operations"
+// @Success      200  {object}  []model.ObjectBatchResult
+// @Failure      400  {object}  error
+// @Failure      403  {object}  error
+// @Failure      404  {object}  error
+// @Failure      500  {object}  error
+// @Router       /worlds/:id/objects:batch [post]
+func BatchWorldPlaceables(c *fiber.Ctx) error {
+	var (
+		status      = fiber.StatusOK
+		requesterId = uuid.Nil
+	)
+	defer func() {
+		err := database.ReportRequestEvent(c, requesterId, status)
+		if err != nil {
+			logrus.Errorf("failed to report request: %v", err)
+		}
+	}()
+
+	//region Requester
+
+	// Get requester
+	requester, err := helper.GetRequester(c)
+	if err != nil {
+		status = fiber.StatusBadRequest
+		return c.Status(status).JSON(fiber.Map{"status": "error", "message": "no requester", "data": nil})
+	}
+
+	// Check if requester is banned
+	if requester.IsBanned {
+		status = fiber.StatusForbidden
+		return c.Status(status).JSON(fiber.Map{"status": "error", "message": "banned", "data": nil})
+	}
+
+	requesterId = requester.Id
+	//endregion
+
+	//region Request metadata
+
+	worldId, err := uuid.FromString(c.Params("id"))
+	if err != nil || worldId.IsNil() {
+		status = fiber.StatusBadRequest
+		return c.Status(status).JSON(fiber.Map{"status": "error", "message": "invalid id", "data": nil})
+	}
+
+	var m model.ObjectBatchEditMetadata
+	err = c.BodyParser(&m)
+	if err != nil {
+		status = fiber.StatusBadRequest
+		return c.Status(status).JSON(fiber.Map{"status": "error", "message": err.Error(), "data": nil})
+	}
+
+	if len(m.Operations) == 0 {
+		status = fiber.StatusBadRequest
+		return c.Status(status).JSON(fiber.Map{"status": "error", "message": "no operations", "data": nil})
+	}
+
+	if len(m.Operations) > model.ObjectBatchMaxOperations {
+		status = fiber.StatusBadRequest
+		return c.Status(status).JSON(fiber.Map{"status": "error", "message": fmt.Sprintf("too many operations, max %d", model.ObjectBatchMaxOperations), "data": nil})
+	}
+
+	//endregion
+
+	var results []model.ObjectBatchResult
+	if requester.IsAdmin || requester.IsInternal {
+		results, err = model.BatchWorldObjectsForAdmin(c.UserContext(), requester, worldId, m.Operations)
+	} else {
+		results, err = model.BatchWorldObjectsForRequester(c.UserContext(), requester, worldId, m.Operations)
+	}
+
+	if err != nil {
+		if errors.Is(err, model.ErrObjectBatchInvalid) {
+			status = fiber.StatusBadRequest
+		} else if err.Error() == "no rows in result set" {
+			status = fiber.StatusNotFound
+			return c.Status(status).JSON(fiber.Map{"status": "error", "message": "world not found", "data": nil})
+		} else if err.Error() == "no access" {
+			status = fiber.StatusForbidden
+			return c.Status(status).JSON(fiber.Map{"status": "error", "message": "no access", "data": nil})
+		} else {
+			logrus.Errorf("failed to batch edit world %s objects: %v", worldId, err)
+			status = fiber.StatusInternalServerError
+		}
+		return c.Status(status).JSON(fiber.Map{"status": "error", "message": err.Error(), "data": results})
+	}
+
+	return c.Status(status).JSON(fiber.Map{"status": "ok", "message": "ok", "data": results})
+}
+
 func CreateWorld(c *fiber.Ctx) error {
 	var (
 		status      = fiber.StatusOK
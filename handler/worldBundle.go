@@ -0,0 +1,194 @@
+package handler
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofrs/uuid"
+	"github.com/sirupsen/logrus"
+	"veverse-api/database"
+	"veverse-api/helper"
+	"veverse-api/model"
+)
+
+// ExportWorld godoc
+// @Summary      Export world
+// @Description  Streams the world bundle, a ZIP archive with the manifest.json of the world, its objects, object classes, portals, properties and file references followed by file contents
+// @Tags         worlds
+// @Accept       json
+// @Produce      application/zip
+// @Security	 Bearer
+// @Param        id path string true "World ID"
+// @Success      200  {file}    file
+// @Failure      400  {object}  error
+// @Failure      403  {object}  error
+// @Failure      404  {object}  error
+// @Failure      500  {object}  error
+// @Router       /worlds/:id/export [get]
+func ExportWorld(c *fiber.Ctx) error {
+	var (
+		status      = fiber.StatusOK
+		requesterId = uuid.Nil
+	)
+	defer func() {
+		err := database.ReportRequestEvent(c, requesterId, status)
+		if err != nil {
+			logrus.Errorf("failed to report request: %v", err)
+		}
+	}()
+
+	//region Requester
+
+	// Get requester
+	requester, err := helper.GetRequester(c)
+	if err != nil {
+		status = fiber.StatusBadRequest
+		return c.Status(status).JSON(fiber.Map{"status": "error", "message": "no requester", "data": nil})
+	}
+
+	// Check if requester is banned
+	if requester.IsBanned {
+		status = fiber.StatusForbidden
+		return c.Status(status).JSON(fiber.Map{"status": "error", "message": "banned", "data": nil})
+	}
+
+	requesterId = requester.Id
+	//endregion
+
+	worldId := uuid.FromStringOrNil(c.Params("id"))
+	if worldId.IsNil() {
+		status = fiber.StatusBadRequest
+		return c.Status(status).JSON(fiber.Map{"status": "error", "message": "invalid id", "data": nil})
+	}
+
+	// Check access before the response is started
+	if err = model.CheckWorldBundleAccess(c.UserContext(), requester, worldId); err != nil {
+		if err.Error() == "no rows in result set" {
+			status = fiber.StatusNotFound
+			return c.Status(status).JSON(fiber.Map{"status": "error", "message": "world not found", "data": nil})
+		} else if err.Error() == "no access" {
+			status = fiber.StatusForbidden
+			return c.Status(status).JSON(fiber.Map{"status": "error", "message": "no access", "data": nil})
+		}
+		status = fiber.StatusInternalServerError
+		return c.Status(status).JSON(fiber.Map{"status": "error", "message": err.Error(), "data": nil})
+	}
+
+	isAdmin := requester.IsAdmin || requester.IsInternal
+
+	c.Set(fiber.HeaderContentType, "application/zip")
+	c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="world-%s.zip"`, worldId))
+
+	// The bundle is written while the response is sent, errors can only be logged
+	ctx := c.UserContext()
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		var err error
+		if isAdmin {
+			_, err = model.ExportWorldBundleForAdmin(ctx, w, worldId)
+		} else {
+			_, err = model.ExportWorldBundleForRequester(ctx, w, requester, worldId)
+		}
+
+		if err == nil {
+			err = w.Flush()
+		}
+
+		if err != nil {
+			logrus.Errorf("failed to stream the bundle of %s: %v", worldId, err)
+		}
+	})
+
+	return nil
+}
+
+// ImportWorld godoc
+// @Summary      Import world
+// @Description  Creates a new world owned by the requester from the world bundle with new ids, the report lists validation errors and warnings, nothing is imported on dry runs or if the bundle is invalid
+// @Tags         worlds
+// @Accept       mpfd
+// @Produce      json
+// @Security	 Bearer
+// @Param        file formData file true "World bundle"
+// @Param        dryRun query bool false "Validate the bundle without importing"
+// @Param        classConflict query string false "Handling of object classes conflicting with existing classes: reuse (default), create or fail"
+// @Success      200  {object}  model.WorldBundleImportReport
+// @Failure      400  {object}  model.WorldBundleImportReport
+// @Failure      500  {object}  error
+// @Router       /worlds/import [post]
+func ImportWorld(c *fiber.Ctx) error {
+	var (
+		status      = fiber.StatusOK
+		requesterId = uuid.Nil
+	)
+	defer func() {
+		err := database.ReportRequestEvent(c, requesterId, status)
+		if err != nil {
+			logrus.Errorf("failed to report request: %v", err)
+		}
+	}()
+
+	//region Requester
+
+	// Get requester
+	requester, err := helper.GetRequester(c)
+	if err != nil {
+		status = fiber.StatusBadRequest
+		return c.Status(status).JSON(fiber.Map{"status": "error", "message": "no requester", "data": nil})
+	}
+
+	// Check if requester is banned
+	if requester.IsBanned {
+		status = fiber.StatusForbidden
+		return c.Status(status).JSON(fiber.Map{"status": "error", "message": "banned", "data": nil})
+	}
+
+	requesterId = requester.Id
+	//endregion
+
+	//region Request metadata
+
+	var m model.WorldBundleImportOptions
+	if err = c.QueryParser(&m); err != nil {
+		status = fiber.StatusBadRequest
+		return c.Status(status).JSON(fiber.Map{"status": "error", "message": err.Error(), "data": nil})
+	}
+
+	formFile, err := c.FormFile("file")
+	if err != nil {
+		status = fiber.StatusBadRequest
+		return c.Status(status).JSON(fiber.Map{"status": "error", "message": "no bundle", "data": nil})
+	}
+
+	bundle, err := formFile.Open()
+	if err != nil {
+		status = fiber.StatusBadRequest
+		return c.Status(status).JSON(fiber.Map{"status": "error", "message": err.Error(), "data": nil})
+	}
+	defer bundle.Close()
+
+	//endregion
+
+	var report *model.WorldBundleImportReport
+	if requester.IsAdmin || requester.IsInternal {
+		report, err = model.ImportWorldBundleForAdmin(c.UserContext(), requester, bundle, formFile.Size, m)
+	} else {
+		report, err = model.ImportWorldBundleForRequester(c.UserContext(), requester, bundle, formFile.Size, m)
+	}
+
+	if err != nil {
+		if errors.Is(err, model.ErrInvalidWorldBundle) {
+			status = fiber.StatusBadRequest
+		} else {
+			status = fiber.StatusInternalServerError
+		}
+		return c.Status(status).JSON(fiber.Map{"status": "error", "message": err.Error(), "data": report})
+	}
+
+	if !report.Valid {
+		status = fiber.StatusBadRequest
+		return c.Status(status).JSON(fiber.Map{"status": "error", "message": "invalid bundle", "data": report})
+	}
+
+	return c.Status(status).JSON(fiber.Map{"status": "ok", "message": "ok", "data": report})
+}
@@ -0,0 +1,493 @@
+package handler
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofrs/uuid"
+	"github.com/sirupsen/logrus"
+	"veverse-api/database"
+	"veverse-api/helper"
+	"veverse-api/model"
+)
+
+// worldSnapshotErrorStatus maps model errors to response statuses
+func worldSnapshotErrorStatus(err error) int {
+	switch err.Error() {
+	case "no rows in result set":
+		return fiber.StatusNotFound
+	case "no access":
+		return fiber.StatusForbidden
+	}
+	return fiber.StatusInternalServerError
+}
+
+// IndexWorldSnapshots godoc
+// @Summary      Index world snapshots
+// @Description  Snapshots of the world layout starting from the latest, objects are not included
+// @Tags         worlds
+// @Accept       json
+// @Produce      json
+// @Security	 Bearer
+// @Param        id path string true "World ID"
+// @Param        offset query int false "Offset"
+// @Param        limit query int false "Limit"
+// @Success      200  {object}  []model.WorldSnapshot
+// @Failure      400  {object}  error
+// @Failure      403  {object}  error
+// @Failure      404  {object}  error
+// @Failure      500  {object}  error
+// @Router       /worlds/:id/snapshots [get]
+func IndexWorldSnapshots(c *fiber.Ctx) error {
+	var (
+		status      = fiber.StatusOK
+		requesterId = uuid.Nil
+	)
+	defer func() {
+		err := database.ReportRequestEvent(c, requesterId, status)
+		if err != nil {
+			logrus.Errorf("failed to report request: %v", err)
+		}
+	}()
+
+	//region Requester
+
+	// Get requester
+	requester, err := helper.GetRequester(c)
+	if err != nil {
+		status = fiber.StatusBadRequest
+		return c.Status(status).JSON(fiber.Map{"status": "error", "message": "no requester", "data": nil})
+	}
+
+	// Check if requester is banned
+	if requester.IsBanned {
+		status = fiber.StatusForbidden
+		return c.Status(status).JSON(fiber.Map{"status": "error", "message": "banned", "data": nil})
+	}
+
+	requesterId = requester.Id
+	//endregion
+
+	//region Request metadata
+
+	m := model.BatchRequestMetadata{}
+	if err = c.QueryParser(&m); err != nil {
+		status = fiber.StatusBadRequest
+		return c.Status(status).JSON(fiber.Map{"status": "error", "message": err.Error(), "data": nil})
+	}
+
+	worldId := uuid.FromStringOrNil(c.Params("id"))
+	if worldId.IsNil() {
+		status = fiber.StatusBadRequest
+		return c.Status(status).JSON(fiber.Map{"status": "error", "message": "invalid id", "data": nil})
+	}
+
+	var (
+		offset int64 = 0
+		limit  int64 = 100
+	)
+
+	if m.Offset > 0 {
+		offset = m.Offset
+	}
+
+	if m.Limit > 0 && m.Limit < 100 {
+		limit = m.Limit
+	}
+
+	//endregion
+
+	var (
+		entities []model.WorldSnapshot
+		total    int64
+	)
+
+	if requester.IsAdmin || requester.IsInternal {
+		entities, total, err = model.IndexWorldSnapshotsForAdmin(c.UserContext(), worldId, offset, limit)
+	} else {
+		entities, total, err = model.IndexWorldSnapshotsForRequester(c.UserContext(), requester, worldId, offset, limit)
+	}
+
+	if err != nil {
+		status = worldSnapshotErrorStatus(err)
+		return c.Status(status).JSON(fiber.Map{"status": "error", "message": err.Error(), "data": nil})
+	}
+
+	return c.Status(status).JSON(fiber.Map{"data": fiber.Map{"entities": entities, "offset": offset, "limit": limit, "total": total}})
+}
+
+// CreateWorldSnapshot godoc
+// @Summary      Create world snapshot
+// @Description  Stores the current world layout (objects with transforms, classes, properties and file references) as the named snapshot
+// @Tags         worlds
+// @Accept       json
+// @Produce      json
+// @Security	 Bearer
+// @Param        id path string true "World ID"
+// @Param        name body string true "Snapshot name"
+// @Success      200  {object}  model.WorldSnapshot
+// @Failure      400  {object}  error
+// @Failure      403  {object}  error
+// @Failure      404  {object}  error
+// @Failure      500  {object}  error
+// @Router       /worlds/:id/snapshots [post]
+func CreateWorldSnapshot(c *fiber.Ctx) error {
+	var (
+		status      = fiber.StatusOK
+		requesterId = uuid.Nil
+	)
+	defer func() {
+		err := database.ReportRequestEvent(c, requesterId, status)
+		if err != nil {
+			logrus.Errorf("failed to report request: %v", err)
+		}
+	}()
+
+	//region Requester
+
+	// Get requester
+	requester, err := helper.GetRequester(c)
+	if err != nil {
+		status = fiber.StatusBadRequest
+		return c.Status(status).JSON(fiber.Map{"status": "error", "message": "no requester", "data": nil})
+	}
+
+	// Check if requester is banned
+	if requester.IsBanned {
+		status = fiber.StatusForbidden
+		return c.Status(status).JSON(fiber.Map{"status": "error", "message": "banned", "data": nil})
+	}
+
+	requesterId = requester.Id
+	//endregion
+
+	//region Request metadata
+
+	worldId := uuid.FromStringOrNil(c.Params("id"))
+	if worldId.IsNil() {
+		status = fiber.StatusBadRequest
+		return c.Status(status).JSON(fiber.Map{"status": "error", "message": "invalid id", "data": nil})
+	}
+
+	m := struct {
+		Name string `json:"name"`
+	}{}
+
+	if err = c.BodyParser(&m); err != nil {
+		status = fiber.StatusBadRequest
+		return c.Status(status).JSON(fiber.Map{"status": "error", "message": err.Error(), "data": nil})
+	}
+
+	if m.Name == "" {
+		status = fiber.StatusBadRequest
+		return c.Status(status).JSON(fiber.Map{"status": "error", "message": "no name", "data": nil})
+	}
+
+	//endregion
+
+	var snapshot *model.WorldSnapshot
+	if requester.IsAdmin || requester.IsInternal {
+		snapshot, err = model.CreateWorldSnapshotForAdmin(c.UserContext(), requester, worldId, m.Name)
+	} else {
+		snapshot, err = model.CreateWorldSnapshotForRequester(c.UserContext(), requester, worldId, m.Name)
+	}
+
+	if err != nil {
+		status = worldSnapshotErrorStatus(err)
+		return c.Status(status).JSON(fiber.Map{"status": "error", "message": err.Error(), "data": nil})
+	}
+
+	return c.Status(status).JSON(fiber.Map{"status": "ok", "message": "ok", "data": snapshot})
+}
+
+// GetWorldSnapshot godoc
+// @Summary      Get world snapshot
+// @Description  Fetch a single world snapshot with its objects
+// @Tags         worlds
+// @Accept       json
+// @Produce      json
+// @Security	 Bearer
+// @Param        id path string true "World ID"
+// @Param        snapshotId path string true "Snapshot ID"
+// @Success      200  {object}  model.WorldSnapshot
+// @Failure      400  {object}  error
+// @Failure      403  {object}  error
+// @Failure      404  {object}  error
+// @Failure      500  {object}  error
+// @Router       /worlds/:id/snapshots/:snapshotId [get]
+func GetWorldSnapshot(c *fiber.Ctx) error {
+	var (
+		status      = fiber.StatusOK
+		requesterId = uuid.Nil
+	)
+	defer func() {
+		err := database.ReportRequestEvent(c, requesterId, status)
+		if err != nil {
+			logrus.Errorf("failed to report request: %v", err)
+		}
+	}()
+
+	//region Requester
+
+	// Get requester
+	requester, err := helper.GetRequester(c)
+	if err != nil {
+		status = fiber.StatusBadRequest
+		return c.Status(status).JSON(fiber.Map{"status": "error", "message": "no requester", "data": nil})
+	}
+
+	// Check if requester is banned
+	if requester.IsBanned {
+		status = fiber.StatusForbidden
+		return c.Status(status).JSON(fiber.Map{"status": "error", "message": "banned", "data": nil})
+	}
+
+	requesterId = requester.Id
+	//endregion
+
+	worldId := uuid.FromStringOrNil(c.Params("id"))
+	snapshotId := uuid.FromStringOrNil(c.Params("snapshotId"))
+	if worldId.IsNil() || snapshotId.IsNil() {
+		status = fiber.StatusBadRequest
+		return c.Status(status).JSON(fiber.Map{"status": "error", "message": "invalid id", "data": nil})
+	}
+
+	var snapshot *model.WorldSnapshot
+	if requester.IsAdmin || requester.IsInternal {
+		snapshot, err = model.GetWorldSnapshotForAdmin(c.UserContext(), worldId, snapshotId)
+	} else {
+		snapshot, err = model.GetWorldSnapshotForRequester(c.UserContext(), requester, worldId, snapshotId)
+	}
+
+	if err != nil {
+		status = worldSnapshotErrorStatus(err)
+		return c.Status(status).JSON(fiber.Map{"status": "error", "message": err.Error(), "data": nil})
+	}
+
+	return c.Status(status).JSON(fiber.Map{"status": "ok", "message": "ok", "data": snapshot})
+}
+
+// DiffWorldSnapshots godoc
+// @Summary      Diff world snapshots
+// @Description  Lists objects added, removed and changed between two snapshots, the current layout is used if a snapshot is not specified
+// @Tags         worlds
+// @Accept       json
+// @Produce      json
+// @Security	 Bearer
+// @Param        id path string true "World ID"
+// @Param        from query string false "Snapshot ID, current layout if empty"
+// @Param        to query string false "Snapshot ID, current layout if empty"
+// @Success      200  {object}  model.WorldSnapshotDiff
+// @Failure      400  {object}  error
+// @Failure      403  {object}  error
+// @Failure      404  {object}  error
+// @Failure      500  {object}  error
+// @Router       /worlds/:id/snapshots/diff [get]
+func DiffWorldSnapshots(c *fiber.Ctx) error {
+	var (
+		status      = fiber.StatusOK
+		requesterId = uuid.Nil
+	)
+	defer func() {
+		err := database.ReportRequestEvent(c, requesterId, status)
+		if err != nil {
+			logrus.Errorf("failed to report request: %v", err)
+		}
+	}()
+
+	//region Requester
+
+	// Get requester
+	requester, err := helper.GetRequester(c)
+	if err != nil {
+		status = fiber.StatusBadRequest
+		return c.Status(status).JSON(fiber.Map{"status": "error", "message": "no requester", "data": nil})
+	}
+
+	// Check if requester is banned
+	if requester.IsBanned {
+		status = fiber.StatusForbidden
+		return c.Status(status).JSON(fiber.Map{"status": "error", "message": "banned", "data": nil})
+	}
+
+	requesterId = requester.Id
+	//endregion
+
+	//region Request metadata
+
+	worldId := uuid.FromStringOrNil(c.Params("id"))
+	if worldId.IsNil() {
+		status = fiber.StatusBadRequest
+		return c.Status(status).JSON(fiber.Map{"status": "error", "message": "invalid id", "data": nil})
+	}
+
+	var fromId, toId *uuid.UUID
+	for _, p := range []struct {
+		name string
+		id   **uuid.UUID
+	}{{"from", &fromId}, {"to", &toId}} {
+		value := c.Query(p.name)
+		if value == "" {
+			continue
+		}
+
+		id, err := uuid.FromString(value)
+		if err != nil {
+			status = fiber.StatusBadRequest
+			return c.Status(status).JSON(fiber.Map{"status": "error", "message": "invalid " + p.name, "data": nil})
+		}
+		*p.id = &id
+	}
+
+	if fromId == nil && toId == nil {
+		status = fiber.StatusBadRequest
+		return c.Status(status).JSON(fiber.Map{"status": "error", "message": "no snapshot", "data": nil})
+	}
+
+	//endregion
+
+	var diff *model.WorldSnapshotDiff
+	if requester.IsAdmin || requester.IsInternal {
+		diff, err = model.DiffWorldSnapshotsForAdmin(c.UserContext(), worldId, fromId, toId)
+	} else {
+		diff, err = model.DiffWorldSnapshotsForRequester(c.UserContext(), requester, worldId, fromId, toId)
+	}
+
+	if err != nil {
+		status = worldSnapshotErrorStatus(err)
+		return c.Status(status).JSON(fiber.Map{"status": "error", "message": err.Error(), "data": nil})
+	}
+
+	return c.Status(status).JSON(fiber.Map{"status": "ok", "message": "ok", "data": diff})
+}
+
+// RestoreWorldSnapshot godoc
+// @Summary      Restore world snapshot
+// @Description  Replaces the world layout with the snapshot in a single transaction, the replaced layout is kept as an automatic snapshot
+// @Tags         worlds
+// @Accept       json
+// @Produce      json
+// @Security	 Bearer
+// @Param        id path string true "World ID"
+// @Param        snapshotId path string true "Snapshot ID"
+// @Success      200  {object}  model.WorldSnapshotRestoreResult
+// @Failure      400  {object}  error
+// @Failure      403  {object}  error
+// @Failure      404  {object}  error
+// @Failure      500  {object}  error
+// @Router       /worlds/:id/snapshots/:snapshotId/restore [post]
+func RestoreWorldSnapshot(c *fiber.Ctx) error {
+	var (
+		status      = fiber.StatusOK
+		requesterId = uuid.Nil
+	)
+	defer func() {
+		err := database.ReportRequestEvent(c, requesterId, status)
+		if err != nil {
+			logrus.Errorf("failed to report request: %v", err)
+		}
+	}()
+
+	//region Requester
+
+	// Get requester
+	requester, err := helper.GetRequester(c)
+	if err != nil {
+		status = fiber.StatusBadRequest
+		return c.Status(status).JSON(fiber.Map{"status": "error", "message": "no requester", "data": nil})
+	}
+
+	// Check if requester is banned
+	if requester.IsBanned {
+		status = fiber.StatusForbidden
+		return c.Status(status).JSON(fiber.Map{"status": "error", "message": "banned", "data": nil})
+	}
+
+	requesterId = requester.Id
+	//endregion
+
+	worldId := uuid.FromStringOrNil(c.Params("id"))
+	snapshotId := uuid.FromStringOrNil(c.Params("snapshotId"))
+	if worldId.IsNil() || snapshotId.IsNil() {
+		status = fiber.StatusBadRequest
+		return c.Status(status).JSON(fiber.Map{"status": "error", "message": "invalid id", "data": nil})
+	}
+
+	var result *model.WorldSnapshotRestoreResult
+	if requester.IsAdmin || requester.IsInternal {
+		result, err = model.RestoreWorldSnapshotForAdmin(c.UserContext(), requester, worldId, snapshotId)
+	} else {
+		result, err = model.RestoreWorldSnapshotForRequester(c.UserContext(), requester, worldId, snapshotId)
+	}
+
+	if err != nil {
+		status = worldSnapshotErrorStatus(err)
+		return c.Status(status).JSON(fiber.Map{"status": "error", "message": err.Error(), "data": nil})
+	}
+
+	return c.Status(status).JSON(fiber.Map{"status": "ok", "message": "ok", "data": result})
+}
+
+// DeleteWorldSnapshot godoc
+// @Summary      Delete world snapshot
+// @Description  Deletes the world snapshot, file contents kept only by the snapshot are cleaned up later
+// @Tags         worlds
+// @Accept       json
+// @Produce      json
+// @Security	 Bearer
+// @Param        id path string true "World ID"
+// @Param        snapshotId path string true "Snapshot ID"
+// @Success      200  {object}  nil
+// @Failure      400  {object}  error
+// @Failure      403  {object}  error
+// @Failure      404  {object}  error
+// @Failure      500  {object}  error
+// @Router       /worlds/:id/snapshots/:snapshotId [delete]
+func DeleteWorldSnapshot(c *fiber.Ctx) error {
+	var (
+		status      = fiber.StatusOK
+		requesterId = uuid.Nil
+	)
+	defer func() {
+		err := database.ReportRequestEvent(c, requesterId, status)
+		if err != nil {
+			logrus.Errorf("failed to report request: %v", err)
+		}
+	}()
+
+	//region Requester
+
+	// Get requester
+	requester, err := helper.GetRequester(c)
+	if err != nil {
+		status = fiber.StatusBadRequest
+		return c.Status(status).JSON(fiber.Map{"status": "error", "message": "no requester", "data": nil})
+	}
+
+	// Check if requester is banned
+	if requester.IsBanned {
+		status = fiber.StatusForbidden
+		return c.Status(status).JSON(fiber.Map{"status": "error", "message": "banned", "data": nil})
+	}
+
+	requesterId = requester.Id
+	//endregion
+
+	worldId := uuid.FromStringOrNil(c.Params("id"))
+	snapshotId := uuid.FromStringOrNil(c.Params("snapshotId"))
+	if worldId.IsNil() || snapshotId.IsNil() {
+		status = fiber.StatusBadRequest
+		return c.Status(status).JSON(fiber.Map{"status": "error", "message": "invalid id", "data": nil})
+	}
+
+	if requester.IsAdmin || requester.IsInternal {
+		err = model.DeleteWorldSnapshotForAdmin(c.UserContext(), worldId, snapshotId)
+	} else {
+		err = model.DeleteWorldSnapshotForRequester(c.UserContext(), requester, worldId, snapshotId)
+	}
+
+	if err != nil {
+		status = worldSnapshotErrorStatus(err)
+		return c.Status(status).JSON(fiber.Map{"status": "error", "message": err.Error(), "data": nil})
+	}
+
+	return c.Status(status).JSON(fiber.Map{"status": "ok", "message": "ok", "data": nil})
+}
@@ -0,0 +1,266 @@
+package handler
+
+import (
+	"errors"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofrs/uuid"
+	"github.com/sirupsen/logrus"
+	"veverse-api/database"
+	"veverse-api/helper"
+	"veverse-api/model"
+)
+
+// IndexWorldTemplates godoc
+// @Summary      Index world templates
+// @Description  Worlds marked as templates by admins to be listed in the template picker, requesters see public templates and templates they can view
+// @Tags         worlds
+// @Accept       json
+// @Produce      json
+// @Security	 Bearer
+// @Param        offset query int false "Offset"
+// @Param        limit query int false "Limit"
+// @Success      200  {object}  []model.WorldTemplate
+// @Failure      400  {object}  error
+// @Failure      403  {object}  error
+// @Failure      500  {object}  error
+// @Router       /worlds/templates [get]
+func IndexWorldTemplates(c *fiber.Ctx) error {
+	var (
+		status      = fiber.StatusOK
+		requesterId = uuid.Nil
+	)
+	defer func() {
+		err := database.ReportRequestEvent(c, requesterId, status)
+		if err != nil {
+			logrus.Errorf("failed to report request: %v", err)
+		}
+	}()
+
+	//region Requester
+
+	// Get requester
+	requester, err := helper.GetRequester(c)
+	if err != nil {
+		status = fiber.StatusBadRequest
+		return c.Status(status).JSON(fiber.Map{"status": "error", "message": "no requester", "data": nil})
+	}
+
+	// Check if requester is banned
+	if requester.IsBanned {
+		status = fiber.StatusForbidden
+		return c.Status(status).JSON(fiber.Map{"status": "error", "message": "banned", "data": nil})
+	}
+
+	requesterId = requester.Id
+	//endregion
+
+	//region Request metadata
+
+	m := model.BatchRequestMetadata{}
+	if err = c.QueryParser(&m); err != nil {
+		status = fiber.StatusBadRequest
+		return c.Status(status).JSON(fiber.Map{"status": "error", "message": err.Error(), "data": nil})
+	}
+
+	var (
+		offset int64 = 0
+		limit  int64 = 100
+	)
+
+	if m.Offset > 0 {
+		offset = m.Offset
+	}
+
+	if m.Limit > 0 && m.Limit < 100 {
+		limit = m.Limit
+	}
+
+	//endregion
+
+	var (
+		entities []model.WorldTemplate
+		total    int64
+	)
+
+	if requester.IsAdmin || requester.IsInternal {
+		entities, total, err = model.IndexWorldTemplatesForAdmin(c.UserContext(), offset, limit)
+	} else {
+		entities, total, err = model.IndexWorldTemplatesForRequester(c.UserContext(), requester, offset, limit)
+	}
+
+	if err != nil {
+		status = fiber.StatusInternalServerError
+		return c.Status(status).JSON(fiber.Map{"status": "error", "message": err.Error(), "data": nil})
+	}
+
+	return c.Status(status).JSON(fiber.Map{"data": fiber.Map{"entities": entities, "offset": offset, "limit": limit, "total": total}})
+}
+
+// CloneWorld godoc
+// @Summary      Clone world
+// @Description  Copies the world metadata, objects, portals, properties and optionally files into a new world owned by the requester, requesters can clone worlds they can edit and templates they can view
+// @Tags         worlds
+// @Accept       json
+// @Produce      json
+// @Security	 Bearer
+// @Param        id path string true "World ID"
+// @Param        request body model.WorldCloneMetadata false "Clone options"
+// @Success      200  {object}  model.World
+// @Failure      400  {object}  error
+// @Failure      403  {object}  error
+// @Failure      404  {object}  error
+// @Failure      413  {object}  error
+// @Failure      500  {object}  error
+// @Router       /worlds/:id/clone [post]
+func CloneWorld(c *fiber.Ctx) error {
+	var (
+		status      = fiber.StatusOK
+		requesterId = uuid.Nil
+	)
+	defer func() {
+		err := database.ReportRequestEvent(c, requesterId, status)
+		if err != nil {
+			logrus.Errorf("failed to report request: %v", err)
+		}
+	}()
+
+	//region Requester
+
+	// Get requester
+	requester, err := helper.GetRequester(c)
+	if err != nil {
+		status = fiber.StatusBadRequest
+		return c.Status(status).JSON(fiber.Map{"status": "error", "message": "no requester", "data": nil})
+	}
+
+	// Check if requester is banned
+	if requester.IsBanned {
+		status = fiber.StatusForbidden
+		return c.Status(status).JSON(fiber.Map{"status": "error", "message": "banned", "data": nil})
+	}
+
+	requesterId = requester.Id
+	//endregion
+
+	//region Request metadata
+
+	worldId := uuid.FromStringOrNil(c.Params("id"))
+	if worldId.IsNil() {
+		status = fiber.StatusBadRequest
+		return c.Status(status).JSON(fiber.Map{"status": "error", "message": "invalid id", "data": nil})
+	}
+
+	var m model.WorldCloneMetadata
+	if len(c.Body()) > 0 {
+		if err = c.BodyParser(&m); err != nil {
+			status = fiber.StatusBadRequest
+			return c.Status(status).JSON(fiber.Map{"status": "error", "message": err.Error(), "data": nil})
+		}
+	}
+
+	//endregion
+
+	var entity *model.World
+	if requester.IsAdmin || requester.IsInternal {
+		entity, err = model.CloneWorldForAdmin(c.UserContext(), requester, worldId, m)
+	} else {
+		entity, err = model.CloneWorldForRequester(c.UserContext(), requester, worldId, m)
+	}
+
+	if err != nil {
+		if errors.Is(err, model.ErrStorageQuotaExceeded) {
+			status = fiber.StatusRequestEntityTooLarge
+			logrus.Warningf("%d: storage quota of requester %s exceeded", status, requester.Id.String())
+			return c.Status(status).JSON(fiber.Map{"status": "error", "message": "storage quota exceeded", "data": nil})
+		} else if err.Error() == "no rows in result set" {
+			status = fiber.StatusNotFound
+			return c.Status(status).JSON(fiber.Map{"status": "error", "message": "world not found", "data": nil})
+		} else if err.Error() == "no access" {
+			status = fiber.StatusForbidden
+			return c.Status(status).JSON(fiber.Map{"status": "error", "message": "no access", "data": nil})
+		}
+		status = fiber.StatusInternalServerError
+		return c.Status(status).JSON(fiber.Map{"status": "error", "message": err.Error(), "data": nil})
+	}
+
+	return c.Status(status).JSON(fiber.Map{"status": "ok", "message": "ok", "data": entity})
+}
+
+// SetWorldTemplate godoc
+// @Summary      Set world template
+// @Description  Marks the world as the template listed in the template picker or removes it from templates, admin only
+// @Tags         worlds
+// @Accept       json
+// @Produce      json
+// @Security	 Bearer
+// @Param        id path string true "World ID"
+// @Param        request body model.WorldTemplateUpdateMetadata true "Template flag"
+// @Success      200  {object}  error
+// @Failure      400  {object}  error
+// @Failure      403  {object}  error
+// @Failure      404  {object}  error
+// @Failure      500  {object}  error
+// @Router       /worlds/:id/template [put]
+func SetWorldTemplate(c *fiber.Ctx) error {
+	var (
+		status      = fiber.StatusOK
+		requesterId = uuid.Nil
+	)
+	defer func() {
+		err := database.ReportRequestEvent(c, requesterId, status)
+		if err != nil {
+			logrus.Errorf("failed to report request: %v", err)
+		}
+	}()
+
+	//region Requester
+
+	// Get requester
+	requester, err := helper.GetRequester(c)
+	if err != nil {
+		status = fiber.StatusBadRequest
+		return c.Status(status).JSON(fiber.Map{"status": "error", "message": "no requester", "data": nil})
+	}
+
+	// Check if requester is banned
+	if requester.IsBanned {
+		status = fiber.StatusForbidden
+		return c.Status(status).JSON(fiber.Map{"status": "error", "message": "banned", "data": nil})
+	}
+
+	requesterId = requester.Id
+
+	if !requester.IsAdmin {
+		status = fiber.StatusForbidden
+		return c.Status(status).JSON(fiber.Map{"status": "error", "message": "forbidden", "data": nil})
+	}
+
+	//endregion
+
+	//region Request metadata
+
+	worldId := uuid.FromStringOrNil(c.Params("id"))
+	if worldId.IsNil() {
+		status = fiber.StatusBadRequest
+		return c.Status(status).JSON(fiber.Map{"status": "error", "message": "invalid id", "data": nil})
+	}
+
+	var m model.WorldTemplateUpdateMetadata
+	if err = c.BodyParser(&m); err != nil {
+		status = fiber.StatusBadRequest
+		return c.Status(status).JSON(fiber.Map{"status": "error", "message": err.Error(), "data": nil})
+	}
+
+	//endregion
+
+	if err = model.SetWorldTemplateForAdmin(c.UserContext(), worldId, m.Template); err != nil {
+		if err.Error() == "no rows in result set" {
+			status = fiber.StatusNotFound
+			return c.Status(status).JSON(fiber.Map{"status": "error", "message": "world not found", "data": nil})
+		}
+		status = fiber.StatusInternalServerError
+		return c.Status(status).JSON(fiber.Map{"status": "error", "message": err.Error(), "data": nil})
+	}
+
+	return c.Status(status).JSON(fiber.Map{"status": "ok", "message": "ok", "data": nil})
+}
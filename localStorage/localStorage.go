@@ -0,0 +1,671 @@
+package localStorage
+
+import (
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gofrs/uuid"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"veverse-api/aws/s3"
+)
+
+var storageRoot = os.Getenv("STORAGE_LOCAL_ROOT")        // Directory to store objects at
+var storageUrl = os.Getenv("STORAGE_LOCAL_URL")          // Public address of the API used to build object urls (e.g. https://api.example.com)
+var storageSigningKey = os.Getenv("STORAGE_SIGNING_KEY") // Key to sign temporary urls, AUTH_SECRET is used if not set
+
+// Backend is the STORAGE_BACKEND value selecting the local storage
+const Backend = "local"
+
+// Route is the API route serving locally stored objects
+const Route = "/v2/storage"
+
+var ErrObjectNotFound = errors.New("object not found")
+
+var errListStopped = errors.New("listing stopped")
+
+// store stores objects at the local filesystem, presigned urls are emulated by signed API routes
+type store struct {
+	root string
+	url  string
+	key  []byte
+}
+
+// objectMetadata is stored next to the object as S3 keeps it with the object
+type objectMetadata struct {
+	Mime     string            `json:"mime"`
+	Public   bool              `json:"public"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+	Tags     map[string]string `json:"tags,omitempty"`
+}
+
+// multipartUpload is a pending multipart upload, parts are stored as separate files until the upload is completed
+type multipartUpload struct {
+	Key       string            `json:"key"`
+	Mime      string            `json:"mime"`
+	Public    bool              `json:"public"`
+	Metadata  map[string]string `json:"metadata,omitempty"`
+	Initiated time.Time         `json:"initiated"`
+}
+
+// Object is a locally stored object served by the API
+type Object struct {
+	Path     string
+	Mime     string
+	Public   bool
+	Filename string
+}
+
+func newStore() (*store, error) {
+	if storageRoot == "" || storageUrl == "" {
+		return nil, fmt.Errorf("required local storage env not provided (STORAGE_LOCAL_ROOT, STORAGE_LOCAL_URL)")
+	}
+
+	key := storageSigningKey
+	if key == "" {
+		key = os.Getenv("AUTH_SECRET")
+	}
+	if key == "" {
+		return nil, fmt.Errorf("required local storage env not provided (STORAGE_SIGNING_KEY)")
+	}
+
+	for _, dir := range []string{"objects", "metadata", "uploads"} {
+		if err := os.MkdirAll(filepath.Join(storageRoot, dir), 0755); err != nil {
+			return nil, fmt.Errorf("failed to create local storage directory: %v", err)
+		}
+	}
+
+	return &store{root: storageRoot, url: strings.TrimSuffix(storageUrl, "/"), key: []byte(key)}, nil
+}
+
+func init() {
+	s3.RegisterStorageBackend(Backend, func() (s3.Storage, error) {
+		s, err := newStore()
+		if err != nil {
+			return nil, err
+		}
+		return s, nil
+	})
+}
+
+// IsUsed returns true if objects are stored at the local filesystem and served by the API
+func IsUsed() bool {
+	_, ok := s3.GetStorage().(*store)
+	return ok
+}
+
+// getStore returns the local storage if it is used
+func getStore() (*store, error) {
+	s, ok := s3.GetStorage().(*store)
+	if !ok {
+		return nil, fmt.Errorf("local storage is not used")
+	}
+	return s, nil
+}
+
+// validKey returns true if the key can not escape the storage directory
+func validKey(key string) bool {
+	return key != "" && !strings.HasPrefix(key, "/") && path.Clean(key) == key && !strings.HasPrefix(key, "..")
+}
+
+func (s *store) objectPath(key string) (string, error) {
+	if !validKey(key) {
+		return "", fmt.Errorf("invalid key: %s", key)
+	}
+	return filepath.Join(s.root, "objects", filepath.FromSlash(key)), nil
+}
+
+func (s *store) metadataPath(key string) (string, error) {
+	if !validKey(key) {
+		return "", fmt.Errorf("invalid key: %s", key)
+	}
+	return filepath.Join(s.root, "metadata", filepath.FromSlash(key)+".json"), nil
+}
+
+func (s *store) uploadPath(uploadId string) (string, error) {
+	if uuid.FromStringOrNil(uploadId).IsNil() {
+		return "", fmt.Errorf("invalid upload id: %s", uploadId)
+	}
+	return filepath.Join(s.root, "uploads", uploadId), nil
+}
+
+// sign calculates the signature of the temporary url
+func (s *store) sign(method string, key string, expires int64, uploadId string, partNumber int64) string {
+	mac := hmac.New(sha256.New, s.key)
+	_, _ = fmt.Fprintf(mac, "%s\n%s\n%d\n%s\n%d", method, key, expires, uploadId, partNumber)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (s *store) signedUrl(method string, key string, duration time.Duration, uploadId string, partNumber int64) string {
+	expires := time.Now().Add(duration).Unix()
+
+	q := url.Values{}
+	q.Set("expires", strconv.FormatInt(expires, 10))
+	if uploadId != "" {
+		q.Set("uploadId", uploadId)
+		q.Set("partNumber", strconv.FormatInt(partNumber, 10))
+	}
+	q.Set("signature", s.sign(method, key, expires, uploadId, partNumber))
+
+	return s.Url(key) + "?" + q.Encode()
+}
+
+// writeFile atomically writes the file creating parent directories
+func writeFile(p string, body io.Reader) (written int64, err error) {
+	if err = os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return 0, err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(p), ".tmp-*")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(tmp.Name())
+
+	written, err = io.Copy(tmp, body)
+	if err1 := tmp.Close(); err == nil {
+		err = err1
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return written, os.Rename(tmp.Name(), p)
+}
+
+func writeJson(p string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = writeFile(p, strings.NewReader(string(data)))
+	return err
+}
+
+func readJson(p string, v interface{}) error {
+	data, err := os.ReadFile(p)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+func (s *store) readMetadata(key string) (m objectMetadata, err error) {
+	p, err := s.metadataPath(key)
+	if err != nil {
+		return m, err
+	}
+
+	if err = readJson(p, &m); err != nil && !os.IsNotExist(err) {
+		return m, err
+	}
+
+	return m, nil
+}
+
+func (s *store) Url(key string) string {
+	return fmt.Sprintf("%s%s/%s", s.url, Route, key)
+}
+
+func (s *store) PresignDownload(key string, duration time.Duration) (string, error) {
+	if !validKey(key) {
+		return "", fmt.Errorf("invalid key: %s", key)
+	}
+	return s.signedUrl("GET", key, duration, "", 0), nil
+}
+
+func (s *store) PresignUpload(key string, duration time.Duration) (string, error) {
+	if !validKey(key) {
+		return "", fmt.Errorf("invalid key: %s", key)
+	}
+	return s.signedUrl("PUT", key, duration, "", 0), nil
+}
+
+func (s *store) Upload(key string, body io.Reader, mime string, public bool, metadata *map[string]string, tags *map[string]string) (err error) {
+	p, err := s.objectPath(key)
+	if err != nil {
+		return err
+	}
+
+	if _, err = writeFile(p, body); err != nil {
+		return err
+	}
+
+	m := objectMetadata{Mime: mime, Public: public}
+	if metadata != nil {
+		m.Metadata = *metadata
+	}
+	if tags != nil {
+		m.Tags = *tags
+	}
+
+	mp, _ := s.metadataPath(key)
+	return writeJson(mp, m)
+}
+
+func (s *store) Exists(key string) bool {
+	p, err := s.objectPath(key)
+	if err != nil {
+		return false
+	}
+
+	_, err = os.Stat(p)
+	return err == nil
+}
+
+func (s *store) Delete(key string) error {
+	p, err := s.objectPath(key)
+	if err != nil {
+		return err
+	}
+
+	if err = os.Remove(p); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	mp, _ := s.metadataPath(key)
+	if err = os.Remove(mp); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
+
+func (s *store) SetPublic(key string, public bool) error {
+	if !s.Exists(key) {
+		return ErrObjectNotFound
+	}
+
+	m, err := s.readMetadata(key)
+	if err != nil {
+		return err
+	}
+
+	m.Public = public
+
+	mp, _ := s.metadataPath(key)
+	return writeJson(mp, m)
+}
+
+func (s *store) Info(key string) (size int64, mime string, err error) {
+	p, err := s.objectPath(key)
+	if err != nil {
+		return 0, "", err
+	}
+
+	fi, err := os.Stat(p)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, "", ErrObjectNotFound
+		}
+		return 0, "", err
+	}
+
+	m, err := s.readMetadata(key)
+	if err != nil {
+		return 0, "", err
+	}
+
+	return fi.Size(), m.Mime, nil
+}
+
+func (s *store) Head(key string, n int64) ([]byte, error) {
+	p, err := s.objectPath(key)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(p)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrObjectNotFound
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	return io.ReadAll(io.LimitReader(f, n))
+}
+
+func (s *store) Stat(key string) (s3.ObjectStat, error) {
+	p, err := s.objectPath(key)
+	if err != nil {
+		return s3.ObjectStat{}, err
+	}
+
+	fi, err := os.Stat(p)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return s3.ObjectStat{}, ErrObjectNotFound
+		}
+		return s3.ObjectStat{}, err
+	}
+
+	m, err := s.readMetadata(key)
+	if err != nil {
+		return s3.ObjectStat{}, err
+	}
+
+	// Objects are rewritten on upload so the modification time and size identify the contents
+	return s3.ObjectStat{
+		Size:         fi.Size(),
+		Mime:         m.Mime,
+		ETag:         fmt.Sprintf("\"%x-%x\"", fi.ModTime().UnixNano(), fi.Size()),
+		LastModified: fi.ModTime(),
+	}, nil
+}
+
+// rangeReader closes the file after reading the range
+type rangeReader struct {
+	io.Reader
+	f *os.File
+}
+
+func (r *rangeReader) Close() error {
+	return r.f.Close()
+}
+
+func (s *store) Read(key string, offset int64, length int64) (io.ReadCloser, error) {
+	f, err := s.Open(key)
+	if err != nil {
+		return nil, err
+	}
+
+	file := f.(*os.File)
+	return &rangeReader{Reader: io.NewSectionReader(file, offset, length), f: file}, nil
+}
+
+func (s *store) Open(key string) (io.ReadCloser, error) {
+	p, err := s.objectPath(key)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(p)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrObjectNotFound
+		}
+		return nil, err
+	}
+
+	return f, nil
+}
+
+func (s *store) CreateMultipartUpload(key string, mime string, public bool, metadata *map[string]string) (uploadId string, err error) {
+	if !validKey(key) {
+		return "", fmt.Errorf("invalid key: %s", key)
+	}
+
+	id, err := uuid.NewV4()
+	if err != nil {
+		return "", err
+	}
+
+	u := multipartUpload{Key: key, Mime: mime, Public: public, Initiated: time.Now()}
+	if metadata != nil {
+		u.Metadata = *metadata
+	}
+
+	p, _ := s.uploadPath(id.String())
+	if err = writeJson(filepath.Join(p, "upload.json"), u); err != nil {
+		return "", err
+	}
+
+	return id.String(), nil
+}
+
+func (s *store) readUpload(key string, uploadId string) (u multipartUpload, p string, err error) {
+	p, err = s.uploadPath(uploadId)
+	if err != nil {
+		return u, "", err
+	}
+
+	if err = readJson(filepath.Join(p, "upload.json"), &u); err != nil {
+		if os.IsNotExist(err) {
+			return u, "", fmt.Errorf("no such upload: %s", uploadId)
+		}
+		return u, "", err
+	}
+
+	if u.Key != key {
+		return u, "", fmt.Errorf("no such upload: %s", uploadId)
+	}
+
+	return u, p, nil
+}
+
+func (s *store) PresignUploadPart(key string, uploadId string, partNumber int64, duration time.Duration) (string, error) {
+	if _, _, err := s.readUpload(key, uploadId); err != nil {
+		return "", err
+	}
+	return s.signedUrl("PUT", key, duration, uploadId, partNumber), nil
+}
+
+func (s *store) ListUploadedParts(key string, uploadId string) (parts []s3.UploadedPart, err error) {
+	_, p, err := s.readUpload(key, uploadId)
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(p)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, e := range entries {
+		n, err1 := strconv.ParseInt(e.Name(), 10, 64)
+		if err1 != nil {
+			continue // not a part
+		}
+
+		fi, err1 := e.Info()
+		if err1 != nil {
+			return nil, err1
+		}
+
+		etag, err1 := os.ReadFile(filepath.Join(p, e.Name()+".etag"))
+		if err1 != nil {
+			continue // part is being written
+		}
+
+		parts = append(parts, s3.UploadedPart{PartNumber: n, ETag: string(etag), Size: fi.Size(), LastModified: fi.ModTime()})
+	}
+
+	sort.Slice(parts, func(i, j int) bool { return parts[i].PartNumber < parts[j].PartNumber })
+
+	return parts, nil
+}
+
+func (s *store) CompleteMultipartUpload(key string, uploadId string, parts []s3.UploadedPart) error {
+	u, p, err := s.readUpload(key, uploadId)
+	if err != nil {
+		return err
+	}
+
+	readers := make([]io.Reader, 0, len(parts))
+	for _, part := range parts {
+		etag, err := os.ReadFile(filepath.Join(p, fmt.Sprintf("%d.etag", part.PartNumber)))
+		if err != nil {
+			return fmt.Errorf("invalid part: %d", part.PartNumber)
+		}
+
+		if strings.Trim(part.ETag, "\"") != strings.Trim(string(etag), "\"") {
+			return fmt.Errorf("invalid part: %d", part.PartNumber)
+		}
+
+		f, err := os.Open(filepath.Join(p, strconv.FormatInt(part.PartNumber, 10)))
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		readers = append(readers, f)
+	}
+
+	if err = s.Upload(key, io.MultiReader(readers...), u.Mime, u.Public, &u.Metadata, nil); err != nil {
+		return err
+	}
+
+	return os.RemoveAll(p)
+}
+
+func (s *store) AbortMultipartUpload(key string, uploadId string) error {
+	_, p, err := s.readUpload(key, uploadId)
+	if err != nil {
+		return nil // Already aborted or completed
+	}
+
+	return os.RemoveAll(p)
+}
+
+func (s *store) List(prefix string, fn func(object s3.ObjectInfo) bool) error {
+	root := filepath.Join(s.root, "objects")
+
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+
+		key := filepath.ToSlash(rel)
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		if !fn(s3.ObjectInfo{Key: key, Size: fi.Size(), LastModified: fi.ModTime()}) {
+			return errListStopped
+		}
+
+		return nil
+	})
+
+	if err == errListStopped {
+		return nil
+	}
+
+	return err
+}
+
+// VerifySignature checks the signature of the temporary url issued by the local storage
+func VerifySignature(method string, key string, expires int64, uploadId string, partNumber int64, signature string) bool {
+	s, err := getStore()
+	if err != nil {
+		return false
+	}
+
+	return s.verify(method, key, expires, uploadId, partNumber, signature)
+}
+
+func (s *store) verify(method string, key string, expires int64, uploadId string, partNumber int64, signature string) bool {
+	if time.Now().Unix() > expires {
+		return false
+	}
+
+	return hmac.Equal([]byte(s.sign(method, key, expires, uploadId, partNumber)), []byte(signature))
+}
+
+// GetObject returns the locally stored object to be served by the API
+func GetObject(key string) (*Object, error) {
+	s, err := getStore()
+	if err != nil {
+		return nil, err
+	}
+
+	p, err := s.objectPath(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err = os.Stat(p); err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrObjectNotFound
+		}
+		return nil, err
+	}
+
+	m, err := s.readMetadata(key)
+	if err != nil {
+		return nil, err
+	}
+
+	o := &Object{Path: p, Mime: m.Mime, Public: m.Public}
+	if originalPath, ok := m.Metadata["originalPath"]; ok && originalPath != "" {
+		o.Filename = filepath.Base(originalPath)
+	}
+
+	return o, nil
+}
+
+// PutObject stores the object uploaded using the temporary url, such objects are private as presigned S3 uploads
+func PutObject(key string, body io.Reader, mime string) error {
+	s, err := getStore()
+	if err != nil {
+		return err
+	}
+
+	if mime == "" {
+		mime = "application/octet-stream" // Default MIME
+	}
+
+	return s.Upload(key, body, mime, false, nil, nil)
+}
+
+// PutUploadPart stores the part of the multipart upload and returns its ETag
+func PutUploadPart(key string, uploadId string, partNumber int64, body io.Reader) (etag string, err error) {
+	s, err := getStore()
+	if err != nil {
+		return "", err
+	}
+
+	return s.putUploadPart(key, uploadId, partNumber, body)
+}
+
+func (s *store) putUploadPart(key string, uploadId string, partNumber int64, body io.Reader) (etag string, err error) {
+	if partNumber < 1 {
+		return "", fmt.Errorf("invalid part number: %d", partNumber)
+	}
+
+	_, p, err := s.readUpload(key, uploadId)
+	if err != nil {
+		return "", err
+	}
+
+	h := md5.New()
+	partPath := filepath.Join(p, strconv.FormatInt(partNumber, 10))
+	if _, err = writeFile(partPath, io.TeeReader(body, h)); err != nil {
+		return "", err
+	}
+
+	etag = fmt.Sprintf("\"%s\"", hex.EncodeToString(h.Sum(nil)))
+	if _, err = writeFile(partPath+".etag", strings.NewReader(etag)); err != nil {
+		return "", err
+	}
+
+	return etag, nil
+}
@@ -0,0 +1,187 @@
+package localStorage
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+	"veverse-api/aws/s3"
+)
+
+func newTestStore(t *testing.T) *store {
+	return &store{root: t.TempDir(), url: "https://api.example.com", key: []byte("test")}
+}
+
+func TestValidKey(t *testing.T) {
+	tests := []struct {
+		name     string
+		key      string
+		expected bool
+	}{
+		{"entity file key", "00000000-0000-4000-8000-000000000001/00000000-0000-4000-8000-000000000002", true},
+		{"nested key", "a/b/c.pak", true},
+		{"empty key", "", false},
+		{"absolute key", "/etc/passwd", false},
+		{"parent directory", "../a", false},
+		{"escaping key", "a/../../b", false},
+		{"unclean key", "a//b", false},
+		{"trailing slash", "a/", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, validKey(tt.key), tt.key)
+		})
+	}
+}
+
+func TestSignedUrl(t *testing.T) {
+	s := newTestStore(t)
+
+	u, err := s.PresignUpload("a/b", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parsed, err := url.Parse(u)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, Route+"/a/b", parsed.Path)
+
+	q := parsed.Query()
+	expires, _ := strconv.ParseInt(q.Get("expires"), 10, 64)
+	signature := q.Get("signature")
+
+	assert.True(t, s.verify("PUT", "a/b", expires, "", 0, signature), "valid signature")
+	assert.False(t, s.verify("GET", "a/b", expires, "", 0, signature), "other method")
+	assert.False(t, s.verify("PUT", "a/c", expires, "", 0, signature), "other key")
+	assert.False(t, s.verify("PUT", "a/b", expires+1, "", 0, signature), "other expiration")
+	assert.False(t, s.verify("PUT", "a/b", expires, "", 0, ""), "missing signature")
+
+	expired := time.Now().Add(-time.Minute).Unix()
+	assert.False(t, s.verify("PUT", "a/b", expired, "", 0, s.sign("PUT", "a/b", expired, "", 0)), "expired signature")
+
+	_, err = s.PresignDownload("../a", time.Minute)
+	assert.Error(t, err, "invalid key")
+}
+
+func TestUploadAndRead(t *testing.T) {
+	s := newTestStore(t)
+
+	metadata := map[string]string{"originalPath": "dir/file.txt"}
+	if err := s.Upload("a/b", strings.NewReader("hello world"), "text/plain", true, &metadata, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	assert.True(t, s.Exists("a/b"))
+	assert.False(t, s.Exists("a/c"))
+
+	size, mime, err := s.Info("a/b")
+	if assert.NoError(t, err) {
+		assert.Equal(t, int64(11), size)
+		assert.Equal(t, "text/plain", mime)
+	}
+
+	head, err := s.Head("a/b", 5)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "hello", string(head))
+	}
+
+	r, err := s.Read("a/b", 6, 5)
+	if assert.NoError(t, err) {
+		data, _ := io.ReadAll(r)
+		_ = r.Close()
+		assert.Equal(t, "world", string(data))
+	}
+
+	stat, err := s.Stat("a/b")
+	if assert.NoError(t, err) {
+		assert.Equal(t, int64(11), stat.Size)
+		assert.NotEmpty(t, stat.ETag)
+	}
+
+	if assert.NoError(t, s.SetPublic("a/b", false)) {
+		m, _ := s.readMetadata("a/b")
+		assert.False(t, m.Public)
+		assert.Equal(t, "text/plain", m.Mime)
+	}
+	assert.Equal(t, ErrObjectNotFound, s.SetPublic("a/c", true), "missing object")
+
+	var keys []string
+	err = s.List("a/", func(object s3.ObjectInfo) bool {
+		keys = append(keys, object.Key)
+		return true
+	})
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{"a/b"}, keys)
+	}
+
+	if assert.NoError(t, s.Delete("a/b")) {
+		assert.False(t, s.Exists("a/b"))
+		_, err = s.Open("a/b")
+		assert.Equal(t, ErrObjectNotFound, err)
+	}
+
+	assert.Error(t, s.Upload("../a", strings.NewReader(""), "", false, nil, nil), "invalid key")
+}
+
+func TestMultipartUpload(t *testing.T) {
+	s := newTestStore(t)
+
+	uploadId, err := s.CreateMultipartUpload("a/b", "text/plain", false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	etag2, err := s.putUploadPart("a/b", uploadId, 2, strings.NewReader("world"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	etag1, err := s.putUploadPart("a/b", uploadId, 1, strings.NewReader("hello "))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = s.putUploadPart("a/c", uploadId, 3, strings.NewReader("!"))
+	assert.Error(t, err, "other key")
+
+	_, err = s.putUploadPart("a/b", uploadId, 0, strings.NewReader("!"))
+	assert.Error(t, err, "invalid part number")
+
+	parts, err := s.ListUploadedParts("a/b", uploadId)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if assert.Len(t, parts, 2) {
+		assert.Equal(t, int64(1), parts[0].PartNumber)
+		assert.Equal(t, etag1, parts[0].ETag)
+		assert.Equal(t, int64(2), parts[1].PartNumber)
+		assert.Equal(t, etag2, parts[1].ETag)
+	}
+
+	invalid := []s3.UploadedPart{{PartNumber: 1, ETag: etag2}}
+	assert.Error(t, s.CompleteMultipartUpload("a/b", uploadId, invalid), "mismatching etag")
+
+	if err = s.CompleteMultipartUpload("a/b", uploadId, parts); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := s.Open("a/b")
+	if assert.NoError(t, err) {
+		data, _ := io.ReadAll(r)
+		_ = r.Close()
+		assert.Equal(t, "hello world", string(data))
+	}
+
+	_, err = s.ListUploadedParts("a/b", uploadId)
+	assert.Error(t, err, "completed upload")
+
+	assert.NoError(t, s.AbortMultipartUpload("a/b", uploadId), "completed upload abort is ignored")
+}
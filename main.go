@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"os"
@@ -13,7 +14,9 @@ import (
 	_ "veverse-api/docs"
 	"veverse-api/google/tts"
 	"veverse-api/k8s"
+	"veverse-api/model"
 	"veverse-api/router"
+	"veverse-api/scanner"
 	"veverse-api/translation"
 	"veverse-api/validation"
 
@@ -51,9 +54,10 @@ func main() {
 	validation.RegisterValidations()
 
 	app := fiber.New(fiber.Config{
-		BodyLimit:   4 * 1024 * 1024 * 1024, // 4 GiB upload limit
-		IdleTimeout: idleTimeout,
-		ReadTimeout: readTimeout,
+		BodyLimit:         4 * 1024 * 1024 * 1024, // 4 GiB upload limit
+		StreamRequestBody: true,                   // Large bodies (e.g. local storage uploads) are streamed instead of being buffered
+		IdleTimeout:       idleTimeout,
+		ReadTimeout:       readTimeout,
 		ErrorHandler: func(ctx *fiber.Ctx, err error) error {
 			headers := make(map[string]string)
 			ctx.Request().Header.VisitAll(func(key, value []byte) {
@@ -141,11 +145,23 @@ func main() {
 		log.Fatal(err)
 	}
 
+	if err := scanner.Setup(); err != nil {
+		log.Fatal(err)
+	}
+
 	if err := ai.Setup(); err != nil {
 		log.Println(err)
 	}
 	app.Use(ai.NewMiddleware())
 
+	model.StartTrendingRefresher(context.Background())
+	model.StartFileUploadJanitor(context.Background())
+	model.StartFileUploadVerifier(context.Background())
+	model.StartImageDerivativeWorker(context.Background())
+	model.StartFileScanWorker(context.Background())
+	model.StartFileAclWorker(context.Background())
+	model.StartObjectGc(context.Background())
+
 	router.SetupRoutes(app)
 
 	port := os.Getenv("API_PORT")
@@ -25,6 +25,17 @@ func ProtectedJwt() func(*fiber.Ctx) error {
 	})
 }
 
+// OptionalJwt parses the token if the request has one, routes using it serve anonymous requests too
+func OptionalJwt() func(*fiber.Ctx) error {
+	return jwtMiddleware.New(jwtMiddleware.Config{
+		Filter: func(c *fiber.Ctx) bool {
+			return c.Get(fiber.HeaderAuthorization) == ""
+		},
+		SigningKey:   []byte(secret),
+		ErrorHandler: jwtError,
+	})
+}
+
 func jwtError(c *fiber.Ctx, err error) error {
 	if err.Error() == "Missing or malformed JWT" {
 		c.Status(fiber.StatusBadRequest)
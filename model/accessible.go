@@ -49,6 +49,38 @@ WHERE e.id = $2`
 	return isOwner, canView, canEdit, canDelete, err
 }
 
+// EntityViewable checks if the entity is public or the user is allowed to view it
+func EntityViewable(ctx context.Context, userId uuid.UUID, entityId uuid.UUID) (canView bool, err error) {
+	q := `SELECT coalesce(e.public, false) OR coalesce(a.can_view OR a.is_owner, false)
+FROM entities e
+	LEFT JOIN accessibles a ON a.entity_id = e.id AND a.user_id = $1
+WHERE e.id = $2`
+
+	db := database.DB
+	err = db.QueryRow(ctx, q, userId, entityId).Scan(&canView)
+	if err != nil {
+		return false, err
+	}
+
+	return canView, nil
+}
+
+// EntityEditable checks if the user is the owner of the entity or is allowed to edit it
+func EntityEditable(ctx context.Context, userId uuid.UUID, entityId uuid.UUID) (canEdit bool, err error) {
+	q := `SELECT coalesce(a.can_edit OR a.is_owner, false)
+FROM entities e
+	LEFT JOIN accessibles a ON a.entity_id = e.id AND a.user_id = $1
+WHERE e.id = $2`
+
+	db := database.DB
+	err = db.QueryRow(ctx, q, userId, entityId).Scan(&canEdit)
+	if err != nil {
+		return false, err
+	}
+
+	return canEdit, nil
+}
+
 func GetAccessEntityForAdmin(ctx context.Context, user *sm.User, entityId uuid.UUID, offset int64, limit int64) (accessibles []Accessible, total int32, err error) {
 	db := database.DB
 
@@ -177,7 +209,7 @@ WHERE e.id = $2`
 		if data.Public != nil {
 			q = `UPDATE entities SET public = $1 WHERE id = $2`
 
-			row = db.QueryRow(ctx, q, data.Public, user.Id)
+			row = db.QueryRow(ctx, q, data.Public, entityId)
 
 			if err = row.Scan(); err != nil {
 				if err.Error() != "no rows in result set" {
@@ -276,7 +308,7 @@ WHERE e.id = $3`
 		if data.Public != nil {
 			q = `UPDATE entities SET public = $1 WHERE id = $2`
 
-			row = db.QueryRow(ctx, q, data.Public, user.Id)
+			row = db.QueryRow(ctx, q, data.Public, entityId)
 
 			if err = row.Scan(); err != nil {
 				if err.Error() != "no rows in result set" {
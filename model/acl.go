@@ -0,0 +1,212 @@
+package model
+
+import (
+	"context"
+	"fmt"
+	"github.com/gofrs/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/sirupsen/logrus"
+	"os"
+	"time"
+	"veverse-api/aws/s3"
+	"veverse-api/database"
+	"veverse-api/reflect"
+	"veverse-api/scanner"
+)
+
+var (
+	fileAclSingular = "file acl"
+	fileAclPlural   = "file acls"
+)
+
+// File acl job statuses, jobs are queued by the entities trigger when the entity is published or unpublished
+const (
+	FileAclJobPending   = "pending"
+	FileAclJobCompleted = "completed"
+	FileAclJobFailed    = "failed"
+)
+
+const (
+	fileAclMaxAttempts  = 3  // Jobs are marked as failed after this number of attempts
+	fileAclBatchSize    = 10 // Number of jobs processed per worker run
+	fileAclJobRetention = 7 * 24 * time.Hour
+)
+
+var fileAclWorkerInterval = os.Getenv("FILE_ACL_WORKER_INTERVAL") // Interval between acl worker runs (default 10s)
+
+// setFileObjectAcls Updates ACLs of the stored objects of the file and its derivatives or of all files of the entity, objects are publicly readable if any file stored at the object (e.g. a shared blob) belongs to a public entity and can be downloaded, plugin sources are never public
+func setFileObjectAcls(ctx context.Context, fileId *uuid.UUID, entityId *uuid.UUID) (err error) {
+	db := database.DB
+
+	q := `SELECT f.url,
+       bool_or(coalesce(e.public, false) AND
+               f.type NOT IN ('uplugin', 'uplugin_content') AND
+               (f.scan_status = ANY ($3::text[]) OR (f.scan_status IS NULL AND NOT $4::boolean)))
+FROM files f
+    LEFT JOIN entities e ON e.id = f.entity_id
+WHERE f.url IN (SELECT t.url FROM files t WHERE t.id = $1 OR t.derivative_of = $1 OR t.entity_id = $2)
+GROUP BY f.url`
+	rows, err := db.Query(ctx, q, fileId /*$1*/, entityId /*$2*/, []string{FileScanClean, FileScanExternal} /*$3*/, scanner.Enabled() /*$4*/)
+	if err != nil {
+		return err
+	}
+
+	objects := map[string]bool{}
+	for rows.Next() {
+		var (
+			url    string
+			public bool
+		)
+		if err = rows.Scan(&url, &public); err != nil {
+			rows.Close()
+			return err
+		}
+		if s3.IsStorageUrl(url) {
+			objects[s3.GetS3KeyForEntityUrl(url)] = public
+		}
+	}
+	rows.Close()
+
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	var failed int
+	for key, public := range objects {
+		if err = s3.SetObjectPublic(key, public); err != nil {
+			logrus.Errorf("failed to update the acl of the object %s @ %s: %v", key, reflect.FunctionName(), err)
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("failed to update acls of %d of %d objects", failed, len(objects))
+	}
+
+	return nil
+}
+
+// updateFileObjectAcls Updates ACLs of the stored objects of the file and its derivatives (e.g. when the file has been scanned)
+func updateFileObjectAcls(ctx context.Context, fileId uuid.UUID) error {
+	return setFileObjectAcls(ctx, &fileId, nil)
+}
+
+// updateEntityFileObjectAcls Updates ACLs of the stored objects of all files of the entity (e.g. when the entity has been published)
+func updateEntityFileObjectAcls(ctx context.Context, entityId uuid.UUID) error {
+	return setFileObjectAcls(ctx, nil, &entityId)
+}
+
+// processFileAclJob Claims the next pending job and updates object ACLs of the entity files, returns false if there are no pending jobs
+func processFileAclJob(ctx context.Context) (processed bool, err error) {
+	db := database.DB
+
+	tx, err1 := db.Begin(ctx)
+	if err1 != nil {
+		return false, fmt.Errorf("failed to begin tx: %v", err1)
+	}
+
+	var (
+		jobId    uuid.UUID
+		entityId uuid.UUID
+	)
+
+	// The job stays locked while it is processed so other API instances skip it
+	q := `SELECT j.id, j.entity_id FROM file_acl_jobs j WHERE j.status = $1 ORDER BY j.created_at LIMIT 1 FOR UPDATE SKIP LOCKED`
+	err1 = tx.QueryRow(ctx, q, FileAclJobPending /*$1*/).Scan(&jobId, &entityId)
+	if err1 != nil {
+		if err2 := tx.Rollback(ctx); err2 != nil {
+			return false, fmt.Errorf("failed to rollback failed tx: %v, %v", err1, err2)
+		}
+		if err1 == pgx.ErrNoRows {
+			return false, nil
+		}
+		return false, err1
+	}
+
+	if err1 = updateEntityFileObjectAcls(ctx, entityId); err1 == nil {
+		q = `UPDATE file_acl_jobs SET status = $2, attempts = attempts + 1, error = null, updated_at = now() WHERE id = $1`
+		if _, err1 = tx.Exec(ctx, q, jobId /*$1*/, FileAclJobCompleted /*$2*/); err1 == nil {
+			if err1 = tx.Commit(ctx); err1 != nil {
+				return true, fmt.Errorf("failed to commit tx: %v", err1)
+			}
+			return true, nil
+		}
+	}
+
+	logrus.Errorf("failed to update %s of entity %s @ %s: %v", fileAclPlural, entityId, reflect.FunctionName(), err1)
+	if err2 := tx.Rollback(ctx); err2 != nil {
+		return true, fmt.Errorf("failed to rollback failed tx: %v, %v", err1, err2)
+	}
+
+	q = `UPDATE file_acl_jobs
+SET attempts   = attempts + 1,
+    error      = $2,
+    status     = CASE WHEN attempts + 1 >= $3 THEN $4 ELSE status END,
+    updated_at = now()
+WHERE id = $1`
+	if _, err = db.Exec(ctx, q, jobId /*$1*/, err1.Error() /*$2*/, fileAclMaxAttempts /*$3*/, FileAclJobFailed /*$4*/); err != nil {
+		return true, fmt.Errorf("failed to update the job: %v", err)
+	}
+
+	return true, nil
+}
+
+// ProcessFileAclJobs Processes up to the limit of pending acl jobs
+func ProcessFileAclJobs(ctx context.Context, limit int) (processed int, err error) {
+	for processed < limit {
+		ok, err := processFileAclJob(ctx)
+		if err != nil {
+			return processed, err
+		}
+		if !ok {
+			break
+		}
+		processed++
+	}
+
+	return processed, nil
+}
+
+// DeleteFinishedFileAclJobs Deletes old completed and failed acl jobs
+func DeleteFinishedFileAclJobs(ctx context.Context) (deleted int64, err error) {
+	db := database.DB
+
+	q := `DELETE FROM file_acl_jobs j WHERE j.status <> $1 AND j.updated_at < $2`
+	res, err := db.Exec(ctx, q, FileAclJobPending /*$1*/, time.Now().Add(-fileAclJobRetention) /*$2*/)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected(), nil
+}
+
+// StartFileAclWorker periodically updates object ACLs of published and unpublished entities until the context is cancelled
+func StartFileAclWorker(ctx context.Context) {
+	interval, err := time.ParseDuration(fileAclWorkerInterval)
+	if err != nil || interval <= 0 {
+		interval = 10 * time.Second
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			if processed, err := ProcessFileAclJobs(ctx, fileAclBatchSize); err != nil {
+				logrus.Errorf("failed to process %s jobs: %v", fileAclSingular, err)
+			} else if processed > 0 {
+				logrus.Infof("processed %d %s jobs", processed, fileAclSingular)
+			}
+
+			if _, err := DeleteFinishedFileAclJobs(ctx); err != nil {
+				logrus.Errorf("failed to delete finished %s jobs: %v", fileAclSingular, err)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
@@ -847,7 +847,7 @@ func GetAppForAdmin(ctx context.Context, id uuid.UUID) (entity *AppWithRelease,
 FROM apps a
     	LEFT JOIN entities e ON a.id = e.id
     	LEFT JOIN releases r ON a.id = r.app_id AND r.version = (SELECT max(r1.version) FROM releases r1 WHERE r1.app_id = $1::uuid AND r1.published)
-        LEFT JOIN files f ON f.entity_id = a.id
+        LEFT JOIN files f ON f.entity_id = a.id AND f.derivative_of IS NULL
 		LEFT JOIN links l ON l.entity_id = e.id
 	WHERE a.id = $1`
 
@@ -1039,7 +1039,7 @@ func GetAppSdkLinkForAdmin(ctx context.Context, id uuid.UUID) (url *string, err
 	q := `SELECT f.url
 FROM apps a
     	LEFT JOIN entities e ON a.id = e.id
-        LEFT JOIN files f ON f.entity_id = a.id
+        LEFT JOIN files f ON f.entity_id = a.id AND f.derivative_of IS NULL
 	WHERE a.id = $1 AND f.type = 'app-sdk'`
 
 	var rows pgx.Row
@@ -1100,7 +1100,7 @@ FROM apps a
 	      LEFT JOIN entities e2 on r1.id = e2.id
 	      LEFT JOIN accessibles ac1 ON e2.id = ac1.entity_id AND ac1.user_id=$1::uuid 
 	  	WHERE r1.app_id = $2::uuid AND (e2.public OR (ac1.is_owner OR ac1.can_view)))
-	LEFT JOIN files f ON f.entity_id = a.id
+	LEFT JOIN files f ON f.entity_id = a.id AND f.derivative_of IS NULL
 	LEFT JOIN links l ON l.entity_id = e.id
 	LEFT JOIN accessibles ac ON e.id = ac.entity_id AND ac.user_id=$1::uuid
 WHERE a.id = $2::uuid
@@ -0,0 +1,180 @@
+package model
+
+import (
+	"archive/zip"
+	"context"
+	sm "dev.hackerman.me/artheon/veverse-shared/model"
+	"fmt"
+	"github.com/gofrs/uuid"
+	"github.com/sirupsen/logrus"
+	"io"
+	"path"
+	"strings"
+	"time"
+	"veverse-api/aws/s3"
+)
+
+const (
+	fileArchivePageSize    = 100
+	fileArchiveSkippedName = "_skipped.txt" // Lists files which could not be added to the archive
+	fileArchiveLinksName   = "_links.txt"   // Lists files linked to external urls, their contents are not downloaded by the API
+)
+
+// fileArchiveEntryName returns the archive path of the file keeping its original path, names of other files with the same path are suffixed with the file id
+func fileArchiveEntryName(f File, seen map[string]bool) string {
+	var name string
+	if f.OriginalPath != nil {
+		// Original paths are relative, leading slashes and parent references are dropped
+		name = strings.TrimPrefix(path.Clean("/"+strings.ReplaceAll(*f.OriginalPath, `\`, "/")), "/")
+	}
+
+	var id string
+	if f.Id != nil {
+		id = f.Id.String()
+	}
+
+	if name == "" || name == fileArchiveSkippedName || name == fileArchiveLinksName {
+		name = path.Join(f.Type, id)
+	}
+
+	if seen[name] {
+		ext := path.Ext(name)
+		name = fmt.Sprintf("%s.%s%s", strings.TrimSuffix(name, ext), id, ext)
+	}
+	seen[name] = true
+
+	return name
+}
+
+// isCompressedMime returns true for formats which are not worth deflating
+func isCompressedMime(mime *string) bool {
+	if mime == nil {
+		return false
+	}
+
+	m := *mime
+	return strings.HasPrefix(m, "image/") || strings.HasPrefix(m, "video/") || strings.HasPrefix(m, "audio/") ||
+		m == "application/zip" || m == "application/gzip" || m == "application/x-7z-compressed"
+}
+
+// writeFileArchiveEntry copies the file contents to the archive without buffering the whole object, returns true if the entry has been started
+func writeFileArchiveEntry(ctx context.Context, w *zip.Writer, f File, name string) (started bool, err error) {
+	if err = CheckFileScanStatus(&f); err != nil {
+		return false, err
+	}
+
+	body, err := openFileContents(ctx, f.Url)
+	if err != nil {
+		return false, err
+	}
+	defer body.Close()
+
+	header := &zip.FileHeader{Name: name, Method: zip.Deflate, Modified: f.CreatedAt}
+	if f.UpdatedAt != nil {
+		header.Modified = *f.UpdatedAt
+	}
+	if isCompressedMime(f.Mime) {
+		header.Method = zip.Store
+	}
+
+	entry, err := w.CreateHeader(header)
+	if err != nil {
+		return true, err
+	}
+
+	_, err = io.Copy(entry, body)
+	return true, err
+}
+
+// writeFileArchiveList Adds the text entry listing files one per line
+func writeFileArchiveList(w *zip.Writer, name string, lines []string) error {
+	entry, err := w.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: time.Now()})
+	if err != nil {
+		return err
+	}
+
+	_, err = io.WriteString(entry, strings.Join(lines, "\n")+"\n")
+	return err
+}
+
+// writeFileArchive Writes the ZIP archive of entity files matching the query page by page, files which can not be read are listed in the _skipped.txt entry and linked files in the _links.txt entry
+func writeFileArchive(ctx context.Context, out io.Writer, requester *sm.User, entityId uuid.UUID, query FileQuery) (count int, err error) {
+	w := zip.NewWriter(out)
+
+	query.Offset = 0
+	query.Cursor = ""
+	query.Limit = fileArchivePageSize
+
+	var (
+		seen    = map[string]bool{}
+		skipped []string
+		links   []string
+	)
+
+	for {
+		files, _, next, err := indexFiles(ctx, requester, entityId, query)
+		if err != nil {
+			return count, err
+		}
+
+		for _, f := range files {
+			if err = ctx.Err(); err != nil {
+				return count, err
+			}
+
+			name := fileArchiveEntryName(f, seen)
+
+			if !s3.IsStorageUrl(f.Url) {
+				links = append(links, fmt.Sprintf("%s: %s", name, f.Url))
+				continue
+			}
+
+			// Objects of other entities linked to the file are not archived
+			if err = CheckFileObject(ctx, &f); err != nil {
+				skipped = append(skipped, fmt.Sprintf("%s: %v", name, err))
+				continue
+			}
+
+			started, err := writeFileArchiveEntry(ctx, w, f, name)
+			if err != nil {
+				// Partially written entries can not be skipped
+				if started {
+					return count, err
+				}
+				logrus.Warningf("failed to add file %s to the archive of %s: %v", name, entityId, err)
+				skipped = append(skipped, fmt.Sprintf("%s: %v", name, err))
+				continue
+			}
+			count++
+		}
+
+		if next == "" {
+			break
+		}
+		query.Cursor = next
+	}
+
+	if len(links) > 0 {
+		if err = writeFileArchiveList(w, fileArchiveLinksName, links); err != nil {
+			return count, err
+		}
+	}
+
+	if len(skipped) > 0 {
+		if err = writeFileArchiveList(w, fileArchiveSkippedName, skipped); err != nil {
+			return count, err
+		}
+	}
+
+	return count, w.Close()
+}
+
+// WriteFileArchiveForAdmin Writes the ZIP archive of entity files matching the query
+func WriteFileArchiveForAdmin(ctx context.Context, w io.Writer, entityId uuid.UUID, query FileQuery) (count int, err error) {
+	return writeFileArchive(ctx, w, nil, entityId, query)
+}
+
+// WriteFileArchiveForRequester Writes the ZIP archive of entity files matching the query if the requester can view the entity
+func WriteFileArchiveForRequester(ctx context.Context, w io.Writer, requester *sm.User, entityId uuid.UUID, query FileQuery) (count int, err error) {
+	return writeFileArchive(ctx, w, requester, entityId, query)
+}
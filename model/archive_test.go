@@ -0,0 +1,31 @@
+package model
+
+import (
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestFileArchiveEntryName(t *testing.T) {
+	id := uuid.FromStringOrNil("8f1d2c3b-4a5e-4f60-8b7a-9c0d1e2f3a4b")
+
+	tests := []struct {
+		name         string
+		originalPath string
+		expected     string
+	}{
+		{"original path", "Content/Mesh.glb", "Content/Mesh.glb"},
+		{"parent references", "../../etc/passwd", "etc/passwd"},
+		{"skipped list", "_skipped.txt", "mesh/" + id.String()},
+		{"links list", "/_links.txt", "mesh/" + id.String()},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := tt.originalPath
+			f := File{Type: "mesh", OriginalPath: &path}
+			f.Id = &id
+			assert.Equal(t, tt.expected, fileArchiveEntryName(f, map[string]bool{}))
+		})
+	}
+}
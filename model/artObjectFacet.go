@@ -0,0 +1,387 @@
+package model
+
+import (
+	"context"
+	sm "dev.hackerman.me/artheon/veverse-shared/model"
+	"fmt"
+	"github.com/jackc/pgtype"
+	pgtypeuuid "github.com/jackc/pgtype/ext/gofrs-uuid"
+	"github.com/sirupsen/logrus"
+	"sort"
+	"strings"
+	"veverse-api/database"
+	"veverse-api/reflect"
+)
+
+// Art object sort values used by the index endpoint in addition to trending
+const (
+	ArtObjectSortDate   = "date"   // Year parsed from the date
+	ArtObjectSortWidth  = "width"  // Width
+	ArtObjectSortHeight = "height" // Height
+	ArtObjectSortSize   = "size"   // Area of the width and the height
+)
+
+// ArtObjectSorts maps supported sort values to the sort expressions
+var ArtObjectSorts = map[string]string{
+	ArtObjectSortDate:   "o.year",
+	ArtObjectSortWidth:  "o.width",
+	ArtObjectSortHeight: "o.height",
+	ArtObjectSortSize:   "o.width * o.height",
+}
+
+// ArtObjectFacetLimit limits the number of values of each facet
+const ArtObjectFacetLimit = 50
+
+// ArtObjectFacetValue is the facet value with the number of matching objects
+type ArtObjectFacetValue struct {
+	Value string `json:"value"`
+	Count int64  `json:"count"`
+}
+
+// ArtObjectFacets are counts of art objects by metadata values, each facet applies every filter except its own so other values of the facet can be selected
+type ArtObjectFacets struct {
+	Artists  []ArtObjectFacetValue `json:"artists"`
+	Mediums  []ArtObjectFacetValue `json:"mediums"`
+	Licenses []ArtObjectFacetValue `json:"licenses"`
+	Origins  []ArtObjectFacetValue `json:"origins"`
+	MinYear  *int                  `json:"minYear,omitempty"`
+	MaxYear  *int                  `json:"maxYear,omitempty"`
+	Total    int64                 `json:"total"`
+}
+
+// artObjectFacetColumns maps facet names to the filtered columns
+var artObjectFacetColumns = map[string]string{
+	"artist":  "o.artist",
+	"medium":  "o.medium",
+	"license": "o.license",
+	"origin":  "o.origin",
+}
+
+// IsSet returns true if any of the filters is set
+func (f SearchArtObject) IsSet() bool {
+	return len(f.Artist) > 0 || len(f.Medium) > 0 || len(f.License) > 0 || len(f.Origin) > 0 || f.YearFrom != nil || f.YearTo != nil
+}
+
+// values returns the selected values of the facet
+func (f SearchArtObject) values(facet string) []string {
+	switch facet {
+	case "artist":
+		return f.Artist
+	case "medium":
+		return f.Medium
+	case "license":
+		return f.License
+	case "origin":
+		return f.Origin
+	}
+	return nil
+}
+
+// artObjectConditions Composes conditions of the filter except the excluded facet, the requester ($1) and the query ($2) are the first arguments
+func artObjectConditions(visibility string, filter SearchArtObject, exclude string, args *[]interface{}) string {
+	arg := func(v interface{}) string {
+		*args = append(*args, v)
+		return fmt.Sprintf("$%d", len(*args))
+	}
+
+	conditions := []string{visibility, "o.type <> 'NFT'", "o.name ILIKE $2::text"}
+
+	// Facets are sorted so the same filter always composes the same query and arguments
+	facets := make([]string, 0, len(artObjectFacetColumns))
+	for facet := range artObjectFacetColumns {
+		facets = append(facets, facet)
+	}
+	sort.Strings(facets)
+
+	for _, facet := range facets {
+		if facet == exclude {
+			continue
+		}
+		if values := filter.values(facet); len(values) > 0 {
+			conditions = append(conditions, artObjectFacetColumns[facet]+" = ANY("+arg(values)+"::text[])")
+		}
+	}
+
+	if exclude != "year" {
+		if filter.YearFrom != nil {
+			conditions = append(conditions, "o.year >= "+arg(*filter.YearFrom))
+		}
+		if filter.YearTo != nil {
+			conditions = append(conditions, "o.year <= "+arg(*filter.YearTo))
+		}
+	}
+
+	return strings.Join(conditions, "\n\tAND ")
+}
+
+// GetArtObjectsFilteredForAdmin Get art objects matching the filter ordered by the sort for admin
+func GetArtObjectsFilteredForAdmin(ctx context.Context, requester *sm.User, offset int64, limit int64, query string, filter SearchArtObject, sort string) (objects []ArtObject, total int32, err error) {
+	return getArtObjectsFiltered(ctx, requester, trendingVisibilityForAdmin, offset, limit, query, filter, sort)
+}
+
+// GetArtObjectsFilteredForRequester Get art objects visible to the requester matching the filter ordered by the sort
+func GetArtObjectsFilteredForRequester(ctx context.Context, requester *sm.User, offset int64, limit int64, query string, filter SearchArtObject, sort string) (objects []ArtObject, total int32, err error) {
+	return getArtObjectsFiltered(ctx, requester, trendingVisibilityForRequester, offset, limit, query, filter, sort)
+}
+
+func getArtObjectsFiltered(ctx context.Context, requester *sm.User, visibility string, offset int64, limit int64, query string, filter SearchArtObject, sort string) (objects []ArtObject, total int32, err error) {
+	db := database.DB
+
+	args := []interface{}{requester.Id /*$1*/, query /*$2*/}
+	conditions := artObjectConditions(visibility, filter, "", &args)
+
+	q := `SELECT COUNT(*) FROM objects o
+	LEFT JOIN entities e ON o.id = e.id
+	WHERE ` + conditions
+
+	if err = db.QueryRow(ctx, q, args...).Scan(&total); err != nil {
+		logrus.Errorf("failed to scan %s @ %s: %v", objectSingular, reflect.FunctionName(), err)
+		return nil, -1, fmt.Errorf("failed to get %s", objectSingular)
+	}
+
+	order := "o.id"
+	if expression, ok := ArtObjectSorts[sort]; ok {
+		direction := "ASC"
+		if strings.EqualFold(filter.Order, "desc") {
+			direction = "DESC"
+		}
+		order = fmt.Sprintf("%s %s NULLS LAST, o.id", expression, direction)
+	}
+
+	n := len(args)
+	q = fmt.Sprintf(`WITH t AS (SELECT o.id, row_number() OVER (ORDER BY %s) ord
+	FROM objects o
+		LEFT JOIN entities e ON e.id = o.id
+	WHERE %s
+	ORDER BY ord
+	OFFSET $%d LIMIT $%d)
+SELECT
+	o.id,
+	o.type,
+	o.name,
+	o.artist,
+	o.date,
+	o.description,
+	o.medium,
+	o.width,
+	o.height,
+	o.scale_multiplier,
+	o.source,
+	o.source_url,
+	o.license,
+	o.copyright,
+	o.credit,
+	o.origin,
+	o.location,
+	o.dimensions,
+	owner.name ownerName,
+	f.id fId,
+	f.type fType,
+	f.mime fMime,
+	f.url fUrl,
+	l2.value liked,
+	r.total_likes,
+	r.total_dislikes,
+	e.views
+FROM t
+	LEFT JOIN objects o ON o.id = t.id
+   	LEFT JOIN entities e ON e.id = o.id
+	LEFT JOIN files f ON f.entity_id = e.id AND f.derivative_of IS NULL
+    LEFT JOIN accessibles a on e.id = a.entity_id AND a.is_owner
+	LEFT JOIN users owner ON owner.id = a.user_id
+	LEFT JOIN entity_ratings r ON r.entity_id = e.id
+	LEFT JOIN likables l2 ON l2.entity_id = e.id AND l2.user_id = $1
+ORDER BY t.ord`, order, conditions, n+1, n+2)
+
+	rows, err := db.Query(ctx, q, append(args, offset, limit)...)
+	if err != nil {
+		logrus.Errorf("failed to query %s @ %s: %v", objectPlural, reflect.FunctionName(), err)
+		return nil, -1, fmt.Errorf("failed to get %s", objectPlural)
+	}
+
+	defer func() {
+		rows.Close()
+		database.LogPgxStat("GetArtObjectsFiltered")
+	}()
+	for rows.Next() {
+		var (
+			o         ArtObject
+			fileId    pgtypeuuid.UUID
+			fileType  *string
+			fileMime  *string
+			fileUrl   *string
+			ownerName *string
+		)
+
+		err = rows.Scan(
+			&o.Id,
+			&o.ObjectType,
+			&o.Name,
+			&o.Artist,
+			&o.Date,
+			&o.Description,
+			&o.Medium,
+			&o.Width,
+			&o.Height,
+			&o.ScaleMultiplier,
+			&o.Source,
+			&o.SourceUrl,
+			&o.License,
+			&o.Copyright,
+			&o.Credit,
+			&o.Origin,
+			&o.Location,
+			&o.Dimensions,
+			&ownerName,
+			&fileId,
+			&fileType,
+			&fileMime,
+			&fileUrl,
+			&o.Liked,
+			&o.TotalLikes,
+			&o.TotalDislikes,
+			&o.Views,
+		)
+
+		if err != nil {
+			logrus.Errorf("failed to scan %s @ %s: %v", objectPlural, reflect.FunctionName(), err)
+			return nil, -1, fmt.Errorf("failed to get %s", objectPlural)
+		}
+
+		var file *File
+		if fileId.Status != pgtype.Null {
+			file = new(File)
+			file.Id = &fileId.UUID
+
+			if fileType != nil {
+				file.Type = *fileType
+			}
+
+			if fileMime != nil {
+				file.Mime = fileMime
+			}
+
+			if fileUrl != nil {
+				file.Url = *fileUrl
+			}
+		}
+
+		if i := findArtObject(objects, o.Id); i >= 0 {
+			if file != nil && !containsFile(objects[i].Files, *file.Id) {
+				objects[i].Files = append(objects[i].Files, *file)
+			}
+			continue
+		}
+
+		if file != nil {
+			o.Files = append(o.Files, *file)
+		}
+
+		if o.TotalLikes == nil {
+			o.TotalLikes = new(int32)
+			*o.TotalLikes = 0
+		}
+
+		if o.TotalDislikes == nil {
+			o.TotalDislikes = new(int32)
+			*o.TotalDislikes = 0
+		}
+
+		o.Owner = new(User)
+		if ownerName != nil {
+			o.Owner.Name = ownerName
+		}
+
+		objects = append(objects, o)
+	}
+
+	return objects, total, nil
+}
+
+// GetArtObjectFacetsForAdmin Get art object facets for admin
+func GetArtObjectFacetsForAdmin(ctx context.Context, requester *sm.User, query string, filter SearchArtObject) (facets *ArtObjectFacets, err error) {
+	return getArtObjectFacets(ctx, requester, trendingVisibilityForAdmin, query, filter)
+}
+
+// GetArtObjectFacetsForRequester Get facets of art objects visible to the requester
+func GetArtObjectFacetsForRequester(ctx context.Context, requester *sm.User, query string, filter SearchArtObject) (facets *ArtObjectFacets, err error) {
+	return getArtObjectFacets(ctx, requester, trendingVisibilityForRequester, query, filter)
+}
+
+func getArtObjectFacets(ctx context.Context, requester *sm.User, visibility string, query string, filter SearchArtObject) (facets *ArtObjectFacets, err error) {
+	db := database.DB
+
+	facets = &ArtObjectFacets{}
+
+	//region Total and year range
+	args := []interface{}{requester.Id /*$1*/, query /*$2*/}
+	q := `SELECT COUNT(*) FROM objects o
+	LEFT JOIN entities e ON o.id = e.id
+	WHERE ` + artObjectConditions(visibility, filter, "", &args)
+
+	if err = db.QueryRow(ctx, q, args...).Scan(&facets.Total); err != nil {
+		logrus.Errorf("failed to scan %s @ %s: %v", objectSingular, reflect.FunctionName(), err)
+		return nil, fmt.Errorf("failed to get %s facets", objectSingular)
+	}
+
+	// The year range ignores the year filter to keep the whole range selectable
+	args = []interface{}{requester.Id /*$1*/, query /*$2*/}
+	q = `SELECT MIN(o.year), MAX(o.year) FROM objects o
+	LEFT JOIN entities e ON o.id = e.id
+	WHERE ` + artObjectConditions(visibility, filter, "year", &args)
+
+	if err = db.QueryRow(ctx, q, args...).Scan(&facets.MinYear, &facets.MaxYear); err != nil {
+		logrus.Errorf("failed to scan %s @ %s: %v", objectSingular, reflect.FunctionName(), err)
+		return nil, fmt.Errorf("failed to get %s facets", objectSingular)
+	}
+	//endregion
+
+	//region Values
+	for facet, column := range artObjectFacetColumns {
+		args = []interface{}{requester.Id /*$1*/, query /*$2*/}
+		q = fmt.Sprintf(`SELECT %[1]s, COUNT(*) FROM objects o
+	LEFT JOIN entities e ON o.id = e.id
+	WHERE %[2]s
+	AND %[1]s IS NOT NULL AND %[1]s <> ''
+	GROUP BY %[1]s
+	ORDER BY COUNT(*) DESC, %[1]s
+	LIMIT %[3]d`, column, artObjectConditions(visibility, filter, facet, &args), ArtObjectFacetLimit)
+
+		rows, err := db.Query(ctx, q, args...)
+		if err != nil {
+			logrus.Errorf("failed to query %s @ %s: %v", objectPlural, reflect.FunctionName(), err)
+			return nil, fmt.Errorf("failed to get %s facets", objectSingular)
+		}
+
+		values := []ArtObjectFacetValue{}
+		for rows.Next() {
+			var v ArtObjectFacetValue
+			if err = rows.Scan(&v.Value, &v.Count); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			values = append(values, v)
+		}
+		rows.Close()
+
+		if err = rows.Err(); err != nil {
+			return nil, err
+		}
+
+		switch facet {
+		case "artist":
+			facets.Artists = values
+		case "medium":
+			facets.Mediums = values
+		case "license":
+			facets.Licenses = values
+		case "origin":
+			facets.Origins = values
+		}
+	}
+	//endregion
+
+	database.LogPgxStat("GetArtObjectFacets")
+
+	return facets, nil
+}
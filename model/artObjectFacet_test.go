@@ -0,0 +1,24 @@
+package model
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestArtObjectConditions(t *testing.T) {
+	filter := SearchArtObject{
+		Artist:  []string{"Monet"},
+		Medium:  []string{"Oil"},
+		License: []string{"CC0"},
+		Origin:  []string{"France"},
+	}
+
+	// Facets are composed in the order of their names regardless of the map iteration order
+	for i := 0; i < 10; i++ {
+		args := []interface{}{nil, "%"}
+		conditions := artObjectConditions("true", filter, "medium", &args)
+
+		assert.Equal(t, "true\n\tAND o.type <> 'NFT'\n\tAND o.name ILIKE $2::text\n\tAND o.artist = ANY($3::text[])\n\tAND o.license = ANY($4::text[])\n\tAND o.origin = ANY($5::text[])", conditions)
+		assert.Equal(t, []interface{}{nil, "%", []string{"Monet"}, []string{"CC0"}, []string{"France"}}, args)
+	}
+}
@@ -0,0 +1,439 @@
+package model
+
+import (
+	"context"
+	"crypto/sha256"
+	sm "dev.hackerman.me/artheon/veverse-shared/model"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/gofrs/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/sirupsen/logrus"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+	"veverse-api/aws/s3"
+	"veverse-api/database"
+	"veverse-api/reflect"
+)
+
+var (
+	fileBlobSingular = "file blob"
+	fileBlobPlural   = "file blobs"
+)
+
+const fileBlobGracePeriod = time.Hour // Unreferenced blobs younger than this are kept by the janitor
+
+var fileBlobHashRegex = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// FileBlob is a content-addressed S3 object shared by files with identical contents
+type FileBlob struct {
+	Hash     string `json:"hash"`
+	Url      string `json:"url"`
+	Size     int64  `json:"size"`
+	Mime     string `json:"mime,omitempty"`
+	RefCount int64  `json:"refCount"`
+
+	Key string `json:"-"` // S3 object key
+}
+
+type FileBlobExistsRequestMetadata struct {
+	Hash string `json:"hash,omitempty" query:"hash"` // SHA-256 of the file contents (hex)
+}
+
+// NormalizeFileBlobHash returns the lowercase hash and whether it is a valid SHA-256 hex digest
+func NormalizeFileBlobHash(hash string) (string, bool) {
+	hash = strings.ToLower(strings.TrimSpace(hash))
+	return hash, fileBlobHashRegex.MatchString(hash)
+}
+
+// isFileBlobType returns true if files of the type can be stored as shared blobs, protected source files always own their objects
+func isFileBlobType(fileType string) bool {
+	return fileType != "uplugin_content" && fileType != "uplugin"
+}
+
+// hashFileContents calculates SHA-256 of the seekable file contents and rewinds it
+func hashFileContents(r io.ReadSeeker) (hash string, err error) {
+	if _, err = r.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+
+	h := sha256.New()
+	if _, err = io.Copy(h, r); err != nil {
+		return "", err
+	}
+
+	if _, err = r.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// GetFileBlob Get the blob by the content hash
+func GetFileBlob(ctx context.Context, hash string) (blob *FileBlob, err error) {
+	db := database.DB
+
+	q := `SELECT b.hash, b.key, b.url, b.size, coalesce(b.mime, ''), b.ref_count FROM file_blobs b WHERE b.hash = $1`
+
+	blob = &FileBlob{}
+	err = db.QueryRow(ctx, q, hash /*$1*/).Scan(&blob.Hash, &blob.Key, &blob.Url, &blob.Size, &blob.Mime, &blob.RefCount)
+	if err != nil {
+		return nil, err
+	}
+
+	return blob, nil
+}
+
+// ErrFileObjectNotOwned is returned for storage objects which neither belong to the entity nor are shared blobs
+var ErrFileObjectNotOwned = errors.New("invalid storage url")
+
+// isEntityFileObjectKey returns true if the key is the object of the entity file ({entityId}/{fileId})
+func isEntityFileObjectKey(entityId uuid.UUID, key string) bool {
+	return strings.HasPrefix(key, entityId.String()+"/")
+}
+
+// getFileBlobByKey Get the blob stored at the object key
+func getFileBlobByKey(ctx context.Context, key string) (blob *FileBlob, err error) {
+	db := database.DB
+
+	q := `SELECT b.hash, b.key, b.url, b.size, coalesce(b.mime, ''), b.ref_count FROM file_blobs b WHERE b.key = $1`
+
+	blob = &FileBlob{}
+	err = db.QueryRow(ctx, q, key /*$1*/).Scan(&blob.Hash, &blob.Key, &blob.Url, &blob.Size, &blob.Mime, &blob.RefCount)
+	if err != nil {
+		return nil, err
+	}
+
+	return blob, nil
+}
+
+// isFileBlobViewable returns true if the requester can view a file stored in the blob
+func isFileBlobViewable(ctx context.Context, requester *sm.User, hash string) (viewable bool, err error) {
+	if requester.IsAdmin {
+		return true, nil
+	}
+
+	db := database.DB
+
+	q := `SELECT EXISTS (SELECT 1
+              FROM files f
+                  LEFT JOIN entities e ON e.id = f.entity_id
+                  LEFT JOIN accessibles a ON a.entity_id = f.entity_id AND a.user_id = $2
+              WHERE f.blob_hash = $1
+                AND (coalesce(e.public, false) OR coalesce(a.can_view OR a.is_owner, false)))`
+	err = db.QueryRow(ctx, q, hash /*$1*/, requester.Id /*$2*/).Scan(&viewable)
+	return viewable, err
+}
+
+// CheckFileObject returns ErrFileObjectNotOwned if the storage object of the file neither belongs to the file entity nor is a shared blob, external urls are not checked
+func CheckFileObject(ctx context.Context, file *File) error {
+	if file == nil || !s3.IsStorageUrl(file.Url) {
+		return nil
+	}
+
+	key := s3.GetS3KeyForEntityUrl(file.Url)
+	if file.EntityId != nil && isEntityFileObjectKey(*file.EntityId, key) {
+		return nil
+	}
+
+	if _, err := getFileBlobByKey(ctx, key); err != nil {
+		if err == pgx.ErrNoRows {
+			return ErrFileObjectNotOwned
+		}
+		return err
+	}
+
+	return nil
+}
+
+// resolveFileLinkBlob Fills the link url, size and MIME type from the blob if the link has the contents hash but no url, returns the hash of the linked blob, the requester must be able to view a file stored in the blob
+// Storage urls must point to objects of the entity or to blobs the requester can view, so objects of other entities can not be linked
+func resolveFileLinkBlob(ctx context.Context, requester *sm.User, entityId uuid.UUID, m *FileLinkRequestMetadata) (blobHash *string, err error) {
+	if m.Url != "" {
+		if !s3.IsStorageUrl(m.Url) {
+			return nil, nil
+		}
+
+		key := s3.GetS3KeyForEntityUrl(m.Url)
+		if isEntityFileObjectKey(entityId, key) {
+			return nil, nil
+		}
+
+		blob, err := getFileBlobByKey(ctx, key)
+		if err != nil {
+			if err == pgx.ErrNoRows {
+				return nil, ErrFileObjectNotOwned
+			}
+			return nil, err
+		}
+
+		viewable, err := isFileBlobViewable(ctx, requester, blob.Hash)
+		if err != nil {
+			return nil, err
+		}
+
+		if !viewable {
+			return nil, ErrFileObjectNotOwned
+		}
+
+		m.Hash = blob.Hash
+		return &blob.Hash, nil
+	}
+
+	if m.Hash == "" {
+		return nil, nil
+	}
+
+	hash, ok := NormalizeFileBlobHash(m.Hash)
+	if !ok {
+		return nil, fmt.Errorf("invalid hash")
+	}
+
+	if !isFileBlobType(m.Type) {
+		return nil, fmt.Errorf("file type can not be linked by hash")
+	}
+
+	blob, err := GetFileBlob(ctx, hash)
+	if err != nil {
+		return nil, err
+	}
+
+	// Blobs the requester can not view are reported the same way as missing ones
+	viewable, err := isFileBlobViewable(ctx, requester, blob.Hash)
+	if err != nil {
+		return nil, err
+	}
+
+	if !viewable {
+		return nil, pgx.ErrNoRows
+	}
+
+	size := int(blob.Size)
+	m.Url = blob.Url
+	m.Size = &size
+	if blob.Mime != "" {
+		m.Mime = &blob.Mime
+	}
+	m.Hash = blob.Hash
+
+	return &blob.Hash, nil
+}
+
+// storeFileBlob Uploads the object under the key unless a blob with the same contents already exists, returns the url and the hash of the blob to reference from the file record
+// Private objects become public once a file stored at them can be downloaded (e.g. when the scan comes back clean)
+func storeFileBlob(ctx context.Context, tx pgx.Tx, key string, body io.ReadSeeker, size int64, mime string, public bool, metadata *map[string]string) (url string, hash string, err error) {
+	hash, err = hashFileContents(body)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to hash the file: %v", err)
+	}
+
+	var blobKey string
+	q := `SELECT b.key, b.url FROM file_blobs b WHERE b.hash = $1 FOR UPDATE`
+	err = tx.QueryRow(ctx, q, hash /*$1*/).Scan(&blobKey, &url)
+	if err == nil {
+		logrus.Infof("reusing the existing %s %s for %s", fileBlobSingular, hash, key)
+		if public {
+			// The existing blob could have been stored for a private entity or a file waiting for the scan
+			if err = s3.SetObjectPublic(blobKey, true); err != nil {
+				return "", "", err
+			}
+		}
+		return url, hash, nil
+	} else if err != pgx.ErrNoRows {
+		return "", "", err
+	}
+
+	if err = s3.UploadObject(key, body, mime, public, metadata, nil); err != nil {
+		return "", "", err
+	}
+
+	// Another upload of the same contents could have registered the blob in the meantime, link to it and drop the object uploaded by this one
+	url = s3.GetS3UrlForFile(key)
+	q = `INSERT INTO file_blobs (hash, key, url, size, mime, ref_count, created_at)
+VALUES ($1, $2, $3, $4, $5, 0, now())
+ON CONFLICT (hash) DO UPDATE SET updated_at = now()
+RETURNING key, url`
+	err = tx.QueryRow(ctx, q, hash /*$1*/, key /*$2*/, url /*$3*/, size /*$4*/, mime /*$5*/).Scan(&blobKey, &url)
+	if err != nil {
+		return "", "", err
+	}
+
+	if blobKey != key {
+		if err1 := s3.DeleteObject(key); err1 != nil {
+			logrus.Errorf("failed to delete the duplicate object %s @ %s: %v", key, reflect.FunctionName(), err1)
+		}
+	}
+
+	return url, hash, nil
+}
+
+// registerFileObjectBlob Registers the stored object of the file as a blob or links the file to the blob already storing the same contents, returns true if the object duplicates the existing blob and should be deleted after the tx has been committed
+func registerFileObjectBlob(ctx context.Context, tx pgx.Tx, fileId uuid.UUID, key string, hash string, size int64, mime *string) (duplicate bool, err error) {
+	var blobKey, url string
+
+	q := `INSERT INTO file_blobs (hash, key, url, size, mime, ref_count, created_at)
+VALUES ($1, $2, $3, $4, $5, 0, now())
+ON CONFLICT (hash) DO UPDATE SET updated_at = now()
+RETURNING key, url`
+	if err = tx.QueryRow(ctx, q, hash /*$1*/, key /*$2*/, s3.GetS3UrlForFile(key) /*$3*/, size /*$4*/, mime /*$5*/).Scan(&blobKey, &url); err != nil {
+		return false, err
+	}
+
+	q = `UPDATE files f SET url = $2, blob_hash = $3 WHERE f.id = $1`
+	if _, err = tx.Exec(ctx, q, fileId /*$1*/, url /*$2*/, hash /*$3*/); err != nil {
+		return false, err
+	}
+
+	return blobKey != key, nil
+}
+
+// uploadFileObject Uploads the file object, files are stored as content-addressed blobs and the file record is linked to the blob, protected source files own their objects
+func uploadFileObject(ctx context.Context, tx pgx.Tx, fileId uuid.UUID, fileType string, key string, body io.ReadSeeker, size int64, mime string, public bool, metadata *map[string]string) (err error) {
+	if !isFileBlobType(fileType) {
+		return s3.UploadObject(key, body, mime, public, metadata, nil)
+	}
+
+	url, hash, err := storeFileBlob(ctx, tx, key, body, size, mime, public, metadata)
+	if err != nil {
+		return err
+	}
+
+	q := `UPDATE files f SET url = $2, blob_hash = $3 WHERE f.id = $1`
+	_, err = tx.Exec(ctx, q, fileId /*$1*/, url /*$2*/, hash /*$3*/)
+	return err
+}
+
+// deleteFileObject Deletes the S3 object unless it is a blob still referenced by other files, the blob record is deleted together with its object
+func deleteFileObject(ctx context.Context, tx pgx.Tx, key string) (err error) {
+	var refCount int64
+
+	q := `SELECT b.ref_count FROM file_blobs b WHERE b.key = $1 FOR UPDATE`
+	err = tx.QueryRow(ctx, q, key /*$1*/).Scan(&refCount)
+	if err == nil {
+		if refCount > 0 {
+			return nil // still referenced
+		}
+
+		q = `DELETE FROM file_blobs b WHERE b.key = $1`
+		if _, err = tx.Exec(ctx, q, key /*$1*/); err != nil {
+			return err
+		}
+	} else if err != pgx.ErrNoRows {
+		return err
+	}
+
+	if s3.ObjectExists(key) {
+		return s3.DeleteObject(key)
+	}
+
+	return nil
+}
+
+// deleteEntityFileObject Deletes the object of the entity file, storage objects which neither belong to the entity nor are shared blobs are never deleted
+func deleteEntityFileObject(ctx context.Context, tx pgx.Tx, entityId uuid.UUID, key string) (err error) {
+	if !isEntityFileObjectKey(entityId, key) {
+		var isBlob bool
+		q := `SELECT EXISTS (SELECT 1 FROM file_blobs b WHERE b.key = $1)`
+		if err = tx.QueryRow(ctx, q, key /*$1*/).Scan(&isBlob); err != nil {
+			return err
+		}
+
+		if !isBlob {
+			logrus.Warningf("skipped deleting the object %s not owned by the entity %s @ %s", key, entityId, reflect.FunctionName())
+			return nil
+		}
+	}
+
+	return deleteFileObject(ctx, tx, key)
+}
+
+// deleteReplacedFileObject Deletes the object of the replaced or deleted entity file unless other files or versions of the entity are stored at it (e.g. links to the same object), blobs are kept while they are referenced
+func deleteReplacedFileObject(ctx context.Context, tx pgx.Tx, entityId uuid.UUID, url string) (err error) {
+	if !s3.IsStorageUrl(url) {
+		return nil
+	}
+
+	var referenced bool
+	q := `SELECT EXISTS (SELECT 1 FROM files f WHERE f.entity_id = $1 AND f.url = $2) OR
+       EXISTS (SELECT 1 FROM file_versions v WHERE v.entity_id = $1 AND v.url = $2)`
+	if err = tx.QueryRow(ctx, q, entityId /*$1*/, url /*$2*/).Scan(&referenced); err != nil {
+		return err
+	}
+
+	if referenced {
+		return nil
+	}
+
+	return deleteEntityFileObject(ctx, tx, entityId, s3.GetS3KeyForEntityUrl(url))
+}
+
+// deleteReplacedFileObjectAfterCommit Deletes the object of the replaced file in its own tx, called once the replacing file is committed so the object is kept if the replacement fails, errors are logged as the replacement has already succeeded
+func deleteReplacedFileObjectAfterCommit(ctx context.Context, entityId uuid.UUID, url string) {
+	db := database.DB
+
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		logrus.Errorf("failed to begin tx @ %s: %v", reflect.FunctionName(), err)
+		return
+	}
+
+	if err = deleteReplacedFileObject(ctx, tx, entityId, url); err != nil {
+		logrus.Errorf("failed to delete the replaced object %s @ %s: %v", url, reflect.FunctionName(), err)
+		if err1 := tx.Rollback(ctx); err1 != nil {
+			logrus.Errorf("failed to rollback failed tx @ %s: %v, %v", reflect.FunctionName(), err, err1)
+		}
+		return
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		logrus.Errorf("failed to commit tx @ %s: %v", reflect.FunctionName(), err)
+	}
+}
+
+// DeleteUnreferencedFileBlobs Deletes blobs left without references (e.g. when files are removed together with their entity)
+func DeleteUnreferencedFileBlobs(ctx context.Context) (deleted int64, err error) {
+	db := database.DB
+
+	q := `SELECT b.key FROM file_blobs b WHERE b.ref_count <= 0 AND coalesce(b.updated_at, b.created_at) < $1`
+	rows, err := db.Query(ctx, q, time.Now().Add(-fileBlobGracePeriod) /*$1*/)
+	if err != nil {
+		return 0, fmt.Errorf("failed to query unreferenced %s: %v", fileBlobPlural, err)
+	}
+
+	var keys []string
+	for rows.Next() {
+		var key string
+		if err = rows.Scan(&key); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		keys = append(keys, key)
+	}
+	rows.Close()
+
+	for _, key := range keys {
+		tx, err1 := db.Begin(ctx)
+		if err1 != nil {
+			return deleted, fmt.Errorf("failed to begin tx: %v", err1)
+		}
+
+		if err1 = deleteFileObject(ctx, tx, key); err1 != nil {
+			logrus.Errorf("failed to delete the %s %s @ %s: %v", fileBlobSingular, key, reflect.FunctionName(), err1)
+			if err2 := tx.Rollback(ctx); err2 != nil {
+				return deleted, fmt.Errorf("failed to rollback failed tx: %v, %v", err1, err2)
+			}
+			continue
+		}
+
+		if err1 = tx.Commit(ctx); err1 != nil {
+			return deleted, fmt.Errorf("failed to commit tx: %v", err1)
+		}
+
+		deleted++
+	}
+
+	return deleted, nil
+}
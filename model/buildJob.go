@@ -159,7 +159,7 @@ func ScheduleBuildJobsForPackage(c *fiber.Ctx, requester *sm.User, entityId uuid
 func NotifyBuildJobCompleted(c *fiber.Ctx, entityId uuid.UUID) (err error) {
 	db := database.DB
 
-	q := "SELECT m.name, u.name, u.email, u.allow_emails FROM mods m LEFT JOIN entities e on m.id = e.id LEFT JOIN accessibles a ON e.id = a.entity_id LEFT JOIN users u ON a.user_id = u.id AND a.is_owner WHERE m.id = $1"
+	q := "SELECT m.name, u.name, u.email, u.allow_emails FROM mods m LEFT JOIN entities e on m.id = e.id LEFT JOIN accessibles a ON e.id = a.entity_id LEFT JOIN users u ON a.user_id = u.id AND a.is_owner WHERE m.id = coalesce((SELECT pv.package_id FROM package_versions pv WHERE pv.id = $1::uuid), $1::uuid)"
 	row := db.QueryRow(c.UserContext(), q, entityId /*$1*/)
 	var (
 		packageName string
@@ -0,0 +1,747 @@
+package model
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/gofrs/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/nfnt/resize"
+	"github.com/sirupsen/logrus"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"math"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"veverse-api/aws/s3"
+	"veverse-api/database"
+	"veverse-api/reflect"
+)
+
+var (
+	imageDerivativeSingular = "image derivative"
+	imageDerivativePlural   = "image derivatives"
+)
+
+const (
+	ImageDerivativePending    = "pending"
+	ImageDerivativeProcessing = "processing"
+	ImageDerivativeCompleted  = "completed"
+	ImageDerivativeFailed     = "failed"
+)
+
+const (
+	ImageDerivativeFormatJpeg = "jpeg"
+	ImageDerivativeFormatPng  = "png"
+	ImageDerivativeFormatWebp = "webp"
+)
+
+// ImageDerivativeTexture is the size name of power-of-two texture variants
+const ImageDerivativeTexture = "texture"
+
+const (
+	imageDerivativeMaxSourceSize int64 = 64 * 1024 * 1024 // Larger source images are not processed
+	imageDerivativeMaxAttempts         = 3                // Jobs are marked as failed after this number of attempts
+	imageDerivativeBatchSize           = 10               // Number of jobs processed per worker run
+	imageDerivativeJobRetention        = 7 * 24 * time.Hour
+	imageDerivativeJobTimeout          = 10 * time.Minute // Processing jobs are reclaimed after this time (e.g. if the API instance has been stopped)
+	imageDerivativeJpegQuality         = 85
+	imageDerivativeWebpQuality         = 80
+)
+
+var (
+	imageDerivativeSizes          = os.Getenv("IMAGE_DERIVATIVE_SIZES")           // Comma separated name:max-dimension list, power-of-two texture variants are named "texture" with an optional max dimension (default preview:256,medium:1024,large:2048,texture)
+	imageDerivativeFormats        = os.Getenv("IMAGE_DERIVATIVE_FORMATS")         // Comma separated list of jpeg, png and webp (default jpeg,webp)
+	imageDerivativeWorkerInterval = os.Getenv("IMAGE_DERIVATIVE_WORKER_INTERVAL") // Interval between derivative worker runs (default 10s)
+	imageDerivativeCwebp          = os.Getenv("IMAGE_DERIVATIVE_CWEBP")           // Path to the cwebp encoder used to produce WebP derivatives (default cwebp at PATH)
+)
+
+var imageDerivativeMimes = map[string]string{
+	ImageDerivativeFormatJpeg: "image/jpeg",
+	ImageDerivativeFormatPng:  "image/png",
+	ImageDerivativeFormatWebp: "image/webp",
+}
+
+// ImageDerivativeSize is a named bounding size of generated derivatives
+type ImageDerivativeSize struct {
+	Name         string `json:"name"`
+	MaxDimension uint   `json:"maxDimension,omitempty"` // Longest side of the derivative, 0 to keep the original dimensions
+	PowerOfTwo   bool   `json:"powerOfTwo,omitempty"`   // Dimensions are rounded up to the next power of two (textures)
+}
+
+var (
+	imageDerivativeConfigOnce   sync.Once
+	imageDerivativeSizeList     []ImageDerivativeSize
+	imageDerivativeFormatList   []string
+	imageDerivativeCwebpPath    string
+	imageDerivativeCwebpMissing bool
+)
+
+// loadImageDerivativeConfig Parses the configured derivative sizes and formats
+func loadImageDerivativeConfig() {
+	imageDerivativeConfigOnce.Do(func() {
+		sizes := imageDerivativeSizes
+		if sizes == "" {
+			sizes = "preview:256,medium:1024,large:2048," + ImageDerivativeTexture
+		}
+
+		for _, s := range strings.Split(sizes, ",") {
+			s = strings.TrimSpace(s)
+			if s == "" {
+				continue
+			}
+
+			name, dimension, _ := strings.Cut(s, ":")
+			size := ImageDerivativeSize{Name: strings.ToLower(strings.TrimSpace(name)), PowerOfTwo: strings.EqualFold(name, ImageDerivativeTexture)}
+			if dimension != "" {
+				d, err := strconv.ParseUint(strings.TrimSpace(dimension), 10, 32)
+				if err != nil {
+					logrus.Errorf("invalid %s size %s: %v", imageDerivativeSingular, s, err)
+					continue
+				}
+				size.MaxDimension = uint(d)
+			} else if !size.PowerOfTwo {
+				logrus.Errorf("invalid %s size %s: no max dimension", imageDerivativeSingular, s)
+				continue
+			}
+
+			imageDerivativeSizeList = append(imageDerivativeSizeList, size)
+		}
+
+		formats := imageDerivativeFormats
+		if formats == "" {
+			formats = ImageDerivativeFormatJpeg + "," + ImageDerivativeFormatWebp
+		}
+
+		for _, f := range strings.Split(formats, ",") {
+			f = NormalizeImageDerivativeFormat(f)
+			if _, ok := imageDerivativeMimes[f]; !ok {
+				logrus.Errorf("unsupported %s format %s", imageDerivativeSingular, f)
+				continue
+			}
+			imageDerivativeFormatList = append(imageDerivativeFormatList, f)
+		}
+
+		imageDerivativeCwebpPath = imageDerivativeCwebp
+		if imageDerivativeCwebpPath == "" {
+			imageDerivativeCwebpPath = "cwebp"
+		}
+		if _, err := exec.LookPath(imageDerivativeCwebpPath); err != nil {
+			imageDerivativeCwebpMissing = true
+			for _, f := range imageDerivativeFormatList {
+				if f == ImageDerivativeFormatWebp {
+					logrus.Warningf("webp %s are disabled, cwebp encoder not found: %v", imageDerivativePlural, err)
+					break
+				}
+			}
+		}
+	})
+}
+
+// NormalizeImageDerivativeFormat returns the lowercase format name, jpg is an alias of jpeg
+func NormalizeImageDerivativeFormat(format string) string {
+	format = strings.ToLower(strings.TrimSpace(format))
+	if format == "jpg" {
+		return ImageDerivativeFormatJpeg
+	}
+	return format
+}
+
+// imageDerivativeType returns the file type of the derivative, derivatives of different sources, sizes and formats must not share the type to keep file lookups by type unique
+func imageDerivativeType(sourceType string, size string, format string) string {
+	return fmt.Sprintf("%s_%s_%s", sourceType, size, format)
+}
+
+// isImageDerivativeSourceType returns true if derivatives should be generated for uploaded files of the type
+func isImageDerivativeSourceType(fileType string) bool {
+	if !strings.HasPrefix(fileType, "image_") {
+		return false
+	}
+
+	// Do not generate derivatives of derivatives
+	for format := range imageDerivativeMimes {
+		if strings.HasSuffix(fileType, "_"+format) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// enqueueImageDerivatives Queues derivative generation for the uploaded image file, the job is processed by the worker after the tx has been committed
+func enqueueImageDerivatives(ctx context.Context, tx pgx.Tx, fileId uuid.UUID, fileType string) (err error) {
+	if !isImageDerivativeSourceType(fileType) {
+		return nil
+	}
+
+	loadImageDerivativeConfig()
+	if len(imageDerivativeSizeList) == 0 || len(imageDerivativeFormatList) == 0 {
+		return nil
+	}
+
+	q := `INSERT INTO image_derivative_jobs (file_id, status, created_at) VALUES ($1, $2, now())`
+	_, err = tx.Exec(ctx, q, fileId /*$1*/, ImageDerivativePending /*$2*/)
+	return err
+}
+
+// imageDerivativeDimensions returns the dimensions of the derivative fitting the size, images are never upscaled except for power-of-two textures
+func imageDerivativeDimensions(w uint, h uint, size ImageDerivativeSize) (uint, uint) {
+	if size.PowerOfTwo {
+		w, h = nextPowerOfTwo(w), nextPowerOfTwo(h)
+		if size.MaxDimension > 0 {
+			for w > size.MaxDimension && w > 1 {
+				w /= 2
+			}
+			for h > size.MaxDimension && h > 1 {
+				h /= 2
+			}
+		}
+		return w, h
+	}
+
+	if size.MaxDimension == 0 || (w <= size.MaxDimension && h <= size.MaxDimension) {
+		return w, h
+	}
+
+	if w >= h {
+		return size.MaxDimension, uint(math.Max(1, math.Round(float64(h)*float64(size.MaxDimension)/float64(w))))
+	}
+
+	return uint(math.Max(1, math.Round(float64(w)*float64(size.MaxDimension)/float64(h)))), size.MaxDimension
+}
+
+// encodeImageDerivative Encodes the image in the format, WebP images are encoded by the external cwebp encoder as there is no pure Go one
+func encodeImageDerivative(ctx context.Context, img image.Image, format string) (data []byte, err error) {
+	buf := new(bytes.Buffer)
+
+	switch format {
+	case ImageDerivativeFormatJpeg:
+		err = jpeg.Encode(buf, img, &jpeg.Options{Quality: imageDerivativeJpegQuality})
+	case ImageDerivativeFormatPng:
+		err = png.Encode(buf, img)
+	case ImageDerivativeFormatWebp:
+		if err = png.Encode(buf, img); err != nil {
+			return nil, err
+		}
+
+		out := new(bytes.Buffer)
+		stderr := new(bytes.Buffer)
+		cmd := exec.CommandContext(ctx, imageDerivativeCwebpPath, "-quiet", "-q", strconv.Itoa(imageDerivativeWebpQuality), "-o", "-", "--", "-")
+		cmd.Stdin = buf
+		cmd.Stdout = out
+		cmd.Stderr = stderr
+		if err = cmd.Run(); err != nil {
+			return nil, fmt.Errorf("cwebp failed: %v: %s", err, strings.TrimSpace(stderr.String()))
+		}
+		return out.Bytes(), nil
+	default:
+		return nil, fmt.Errorf("unsupported format %s", format)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// imageDerivativeObject is a generated derivative uploaded to the storage before its file record is inserted
+type imageDerivativeObject struct {
+	id       uuid.UUID
+	key      string
+	url      string
+	fileType string
+	mime     string
+	size     int
+	width    uint
+	height   uint
+	sizeName string
+	format   string
+}
+
+// deleteImageDerivativeObjects Deletes objects of replaced or discarded derivatives, blobs still referenced by other files are kept
+func deleteImageDerivativeObjects(ctx context.Context, keys []string) {
+	db := database.DB
+
+	for _, key := range keys {
+		tx, err := db.Begin(ctx)
+		if err != nil {
+			logrus.Errorf("failed to begin tx @ %s: %v", reflect.FunctionName(), err)
+			return
+		}
+
+		if err = deleteFileObject(ctx, tx, key); err != nil {
+			logrus.Errorf("failed to delete %s object %s @ %s: %v", imageDerivativeSingular, key, reflect.FunctionName(), err)
+			if err1 := tx.Rollback(ctx); err1 != nil {
+				logrus.Errorf("failed to rollback failed tx @ %s: %v, %v", reflect.FunctionName(), err, err1)
+			}
+			continue
+		}
+
+		if err = tx.Commit(ctx); err != nil {
+			logrus.Errorf("failed to commit tx @ %s: %v", reflect.FunctionName(), err)
+		}
+	}
+}
+
+// generateImageDerivatives Replaces derivatives of the source image file with the newly generated ones, objects are uploaded before the short tx replacing the file records
+func generateImageDerivatives(ctx context.Context, fileId uuid.UUID) (err error) {
+	loadImageDerivativeConfig()
+
+	db := database.DB
+
+	var (
+		entityId   uuid.UUID
+		fileType   string
+		url        string
+		variation  int64
+		uploadedBy *uuid.UUID
+		scanStatus *string
+	)
+
+	q := `SELECT f.entity_id, f.type, f.url, f.variation, f.uploaded_by, f.scan_status FROM files f WHERE f.id = $1`
+	err = db.QueryRow(ctx, q, fileId /*$1*/).Scan(&entityId, &fileType, &url, &variation, &uploadedBy, &scanStatus)
+	if err == pgx.ErrNoRows {
+		return nil // source has been deleted or replaced, replacements have their own jobs
+	} else if err != nil {
+		return err
+	}
+
+	//region Source image
+	key := s3.GetS3KeyForEntityUrl(url)
+	size, _, err := s3.GetObjectInfo(key)
+	if err != nil {
+		return fmt.Errorf("failed to get source object info: %v", err)
+	}
+
+	if size > imageDerivativeMaxSourceSize {
+		return fmt.Errorf("source image is too large: %d bytes", size)
+	}
+
+	data, err := s3.GetObjectHead(key, size)
+	if err != nil {
+		return fmt.Errorf("failed to read source object: %v", err)
+	}
+
+	source, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("failed to decode source image: %v", err)
+	}
+
+	w := uint(source.Bounds().Dx())
+	h := uint(source.Bounds().Dy())
+	//endregion
+
+	// Derivatives are publicly readable only if the source is, acls are updated after the records are committed in case the source has been scanned meanwhile
+	public := false
+	if CheckFileScanStatus(&File{ScanStatus: scanStatus}) == nil {
+		public, err = isEntityPublic(ctx, entityId)
+		if err != nil {
+			return err
+		}
+	}
+
+	//region Upload derivatives
+	var (
+		objects  []imageDerivativeObject
+		uploaded []string
+	)
+
+	// Uploaded objects are removed unless their file records are committed
+	committed := false
+	defer func() {
+		if !committed {
+			deleteImageDerivativeObjects(ctx, uploaded)
+		}
+	}()
+
+	for _, s := range imageDerivativeSizeList {
+		dw, dh := imageDerivativeDimensions(w, h, s)
+
+		var resized image.Image = source
+		if dw != w || dh != h {
+			resized = resize.Resize(dw, dh, source, resize.Lanczos3)
+		}
+
+		for _, format := range imageDerivativeFormatList {
+			if format == ImageDerivativeFormatWebp && imageDerivativeCwebpMissing {
+				continue
+			}
+
+			encoded, err1 := encodeImageDerivative(ctx, resized, format)
+			if err1 != nil {
+				return fmt.Errorf("failed to encode %s %s %s: %v", s.Name, format, imageDerivativeSingular, err1)
+			}
+
+			id, err1 := uuid.NewV4()
+			if err1 != nil {
+				return err1
+			}
+
+			o := imageDerivativeObject{
+				id:       id,
+				key:      s3.GetS3KeyForEntityFile(entityId, id),
+				url:      s3.GetS3UrlForEntityFile(entityId, id),
+				fileType: imageDerivativeType(fileType, s.Name, format),
+				mime:     imageDerivativeMimes[format],
+				size:     len(encoded),
+				width:    dw,
+				height:   dh,
+				sizeName: s.Name,
+				format:   format,
+			}
+
+			metadata := map[string]string{
+				"type":   o.fileType,
+				"source": fileId.String(),
+				"size":   s.Name,
+			}
+
+			if err1 = s3.UploadObject(o.key, bytes.NewReader(encoded), o.mime, public, &metadata, nil); err1 != nil {
+				return fmt.Errorf("failed to upload %s: %v", imageDerivativeSingular, err1)
+			}
+
+			uploaded = append(uploaded, o.key)
+			objects = append(objects, o)
+		}
+	}
+	//endregion
+
+	//region Replace derivative records
+	tx, err1 := db.Begin(ctx)
+	if err1 != nil {
+		return fmt.Errorf("failed to begin tx: %v", err1)
+	}
+
+	// The source could have been replaced while the derivatives were generated, the replacement has its own job
+	var exists bool
+	q = `SELECT EXISTS (SELECT 1 FROM files f WHERE f.id = $1 AND f.url = $2 FOR UPDATE)`
+	if err1 = tx.QueryRow(ctx, q, fileId /*$1*/, url /*$2*/).Scan(&exists); err1 != nil || !exists {
+		if err2 := tx.Rollback(ctx); err2 != nil {
+			return fmt.Errorf("failed to rollback failed tx: %v, %v", err1, err2)
+		}
+		return err1
+	}
+
+	var types []string
+	for _, s := range imageDerivativeSizeList {
+		for _, f := range imageDerivativeFormatList {
+			types = append(types, imageDerivativeType(fileType, s.Name, f))
+		}
+	}
+
+	q = `DELETE FROM files f
+WHERE f.entity_id = $1
+  AND f.variation = $2
+  AND (f.derivative_of = $3 OR (f.derivative_of IS NOT NULL AND f.type = ANY ($4::text[])))
+RETURNING f.url`
+	rows, err1 := tx.Query(ctx, q, entityId /*$1*/, variation /*$2*/, fileId /*$3*/, types /*$4*/)
+	if err1 != nil {
+		if err2 := tx.Rollback(ctx); err2 != nil {
+			return fmt.Errorf("failed to rollback failed tx: %v, %v", err1, err2)
+		}
+		return fmt.Errorf("failed to delete previous %s: %v", imageDerivativePlural, err1)
+	}
+
+	var previousKeys []string
+	for rows.Next() {
+		var previousUrl string
+		if err1 = rows.Scan(&previousUrl); err1 != nil {
+			break
+		}
+		previousKeys = append(previousKeys, s3.GetS3KeyForEntityUrl(previousUrl))
+	}
+	rows.Close()
+
+	if err1 == nil {
+		err1 = rows.Err()
+	}
+
+	for _, o := range objects {
+		if err1 != nil {
+			break
+		}
+
+		// Derivatives share the scan status of the source locked above
+		q = `INSERT INTO files AS f (id, entity_id, url, type, mime, size, version, deployment_type, platform, uploaded_by, width, height, created_at, updated_at, variation, original_path, derivative_of, derivative_size, derivative_format, scan_status)
+VALUES ($1, $2, $3, $4, $5, $6, 0, '', '', $7, $8, $9, now(), null, $10, '', $11, $12, $13, (SELECT s.scan_status FROM files s WHERE s.id = $11))`
+		_, err1 = tx.Exec(ctx, q, o.id /*$1*/, entityId /*$2*/, o.url /*$3*/, o.fileType /*$4*/, o.mime /*$5*/, o.size /*$6*/, uploadedBy /*$7*/, o.width /*$8*/, o.height /*$9*/, variation /*$10*/, fileId /*$11*/, o.sizeName /*$12*/, o.format /*$13*/)
+		if err1 != nil {
+			err1 = fmt.Errorf("failed to insert %s: %v", imageDerivativeSingular, err1)
+		}
+	}
+
+	if err1 != nil {
+		if err2 := tx.Rollback(ctx); err2 != nil {
+			return fmt.Errorf("failed to rollback failed tx: %v, %v", err1, err2)
+		}
+		return err1
+	}
+
+	if err1 = tx.Commit(ctx); err1 != nil {
+		return fmt.Errorf("failed to commit tx: %v", err1)
+	}
+	committed = true
+	//endregion
+
+	deleteImageDerivativeObjects(ctx, previousKeys)
+
+	if err = updateFileObjectAcls(ctx, fileId); err != nil {
+		logrus.Errorf("failed to update acls of %s of %s @ %s: %v", imageDerivativePlural, fileId, reflect.FunctionName(), err)
+	}
+
+	return nil
+}
+
+// processImageDerivativeJob Claims the next pending job and generates derivatives, returns false if there are no pending jobs
+func processImageDerivativeJob(ctx context.Context) (processed bool, err error) {
+	db := database.DB
+
+	var (
+		jobId    uuid.UUID
+		fileId   uuid.UUID
+		attempts int
+	)
+
+	// The job is claimed by a short update so other API instances skip it, jobs of stopped instances are reclaimed after the timeout
+	q := `UPDATE image_derivative_jobs j
+SET status     = $2,
+    attempts   = j.attempts + 1,
+    updated_at = now()
+WHERE j.id = (SELECT c.id
+              FROM image_derivative_jobs c
+              WHERE c.status = $1
+                 OR (c.status = $2 AND c.updated_at < $3)
+              ORDER BY c.created_at
+              LIMIT 1 FOR UPDATE SKIP LOCKED)
+RETURNING j.id, j.file_id, j.attempts`
+	err = db.QueryRow(ctx, q, ImageDerivativePending /*$1*/, ImageDerivativeProcessing /*$2*/, time.Now().Add(-imageDerivativeJobTimeout) /*$3*/).Scan(&jobId, &fileId, &attempts)
+	if err == pgx.ErrNoRows {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	var err1 error
+	if attempts > imageDerivativeMaxAttempts {
+		err1 = fmt.Errorf("timed out")
+	} else if err1 = generateImageDerivatives(ctx, fileId); err1 == nil {
+		q = `UPDATE image_derivative_jobs SET status = $2, error = null, updated_at = now() WHERE id = $1`
+		if _, err = db.Exec(ctx, q, jobId /*$1*/, ImageDerivativeCompleted /*$2*/); err != nil {
+			return true, fmt.Errorf("failed to update the job: %v", err)
+		}
+		return true, nil
+	}
+
+	logrus.Errorf("failed to generate %s for %s @ %s: %v", imageDerivativePlural, fileId, reflect.FunctionName(), err1)
+
+	q = `UPDATE image_derivative_jobs
+SET error      = $2,
+    status     = CASE WHEN attempts >= $3 THEN $4 ELSE $5 END,
+    updated_at = now()
+WHERE id = $1`
+	if _, err = db.Exec(ctx, q, jobId /*$1*/, err1.Error() /*$2*/, imageDerivativeMaxAttempts /*$3*/, ImageDerivativeFailed /*$4*/, ImageDerivativePending /*$5*/); err != nil {
+		return true, fmt.Errorf("failed to update the job: %v", err)
+	}
+
+	return true, nil
+}
+
+// ProcessImageDerivativeJobs Processes up to the limit of pending derivative jobs
+func ProcessImageDerivativeJobs(ctx context.Context, limit int) (processed int, err error) {
+	for processed < limit {
+		ok, err := processImageDerivativeJob(ctx)
+		if err != nil {
+			return processed, err
+		}
+		if !ok {
+			break
+		}
+		processed++
+	}
+
+	return processed, nil
+}
+
+// DeleteOrphanedImageDerivatives Deletes derivatives of removed source files and old finished jobs
+func DeleteOrphanedImageDerivatives(ctx context.Context) (deleted int64, err error) {
+	db := database.DB
+
+	tx, err1 := db.Begin(ctx)
+	if err1 != nil {
+		return 0, fmt.Errorf("failed to begin tx: %v", err1)
+	}
+
+	q := `DELETE FROM files d
+WHERE d.derivative_of IS NOT NULL
+  AND NOT EXISTS (SELECT 1 FROM files s WHERE s.id = d.derivative_of)
+RETURNING d.url`
+	rows, err1 := tx.Query(ctx, q)
+	if err1 != nil {
+		if err2 := tx.Rollback(ctx); err2 != nil {
+			return 0, fmt.Errorf("failed to rollback failed tx: %v, %v", err1, err2)
+		}
+		return 0, fmt.Errorf("failed to delete orphaned %s: %v", imageDerivativePlural, err1)
+	}
+
+	var keys []string
+	for rows.Next() {
+		var url string
+		if err1 = rows.Scan(&url); err1 != nil {
+			rows.Close()
+			_ = tx.Rollback(ctx)
+			return 0, err1
+		}
+		keys = append(keys, s3.GetS3KeyForEntityUrl(url))
+	}
+	rows.Close()
+
+	q = `DELETE FROM image_derivative_jobs j WHERE j.status = ANY ($1::text[]) AND j.updated_at < $2`
+	if _, err1 = tx.Exec(ctx, q, []string{ImageDerivativeCompleted, ImageDerivativeFailed} /*$1*/, time.Now().Add(-imageDerivativeJobRetention) /*$2*/); err1 != nil {
+		if err2 := tx.Rollback(ctx); err2 != nil {
+			return 0, fmt.Errorf("failed to rollback failed tx: %v, %v", err1, err2)
+		}
+		return 0, fmt.Errorf("failed to delete finished jobs: %v", err1)
+	}
+
+	if err1 = tx.Commit(ctx); err1 != nil {
+		return 0, fmt.Errorf("failed to commit tx: %v", err1)
+	}
+
+	// Objects are deleted after the records so the tx is not held during storage requests
+	deleteImageDerivativeObjects(ctx, keys)
+
+	return int64(len(keys)), nil
+}
+
+// StartImageDerivativeWorker periodically generates queued image derivatives and removes orphaned ones until the context is cancelled
+func StartImageDerivativeWorker(ctx context.Context) {
+	loadImageDerivativeConfig()
+
+	interval, err := time.ParseDuration(imageDerivativeWorkerInterval)
+	if err != nil || interval <= 0 {
+		interval = 10 * time.Second
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			if processed, err := ProcessImageDerivativeJobs(ctx, imageDerivativeBatchSize); err != nil {
+				logrus.Errorf("failed to process %s jobs: %v", imageDerivativeSingular, err)
+			} else if processed > 0 {
+				logrus.Infof("processed %d %s jobs", processed, imageDerivativeSingular)
+			}
+
+			if deleted, err := DeleteOrphanedImageDerivatives(ctx); err != nil {
+				logrus.Errorf("failed to delete orphaned %s: %v", imageDerivativePlural, err)
+			} else if deleted > 0 {
+				logrus.Infof("deleted %d orphaned %s", deleted, imageDerivativePlural)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// ResolveImageDerivatives Replaces files with their derivatives of the requested size and format, files without a matching derivative are kept as is
+func ResolveImageDerivatives(ctx context.Context, files []File, size string, format string) (resolved []File, err error) {
+	size = strings.ToLower(strings.TrimSpace(size))
+	format = NormalizeImageDerivativeFormat(format)
+	if size == "" && format == "" {
+		return files, nil
+	}
+
+	var ids []string
+	for _, f := range files {
+		if f.Id != nil && isImageDerivativeSourceType(f.Type) {
+			ids = append(ids, f.Id.String())
+		}
+	}
+
+	if len(ids) == 0 {
+		return files, nil
+	}
+
+	db := database.DB
+
+	// Prefer the largest derivative if the size is not specified and jpeg if the format is not specified
+	q := `SELECT DISTINCT ON (d.derivative_of) d.id, d.entity_id, d.type, d.url, d.mime, d.size, d.version, d.uploaded_by, d.width, d.height, d.created_at, d.variation, d.derivative_of, d.derivative_size, d.derivative_format
+FROM files d
+WHERE d.derivative_of = ANY ($1::uuid[])
+  AND ($2 = '' OR d.derivative_size = $2)
+  AND ($3 = '' OR d.derivative_format = $3)
+ORDER BY d.derivative_of, d.width * d.height DESC, d.derivative_format = $4 DESC`
+	rows, err := db.Query(ctx, q, ids /*$1*/, size /*$2*/, format /*$3*/, ImageDerivativeFormatJpeg /*$4*/)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	derivatives := map[uuid.UUID]File{}
+	for rows.Next() {
+		var (
+			e         File
+			id        uuid.UUID
+			entityId  uuid.UUID
+			sourceId  uuid.UUID
+			dSize     string
+			dFormat   string
+			createdAt time.Time
+		)
+
+		err = rows.Scan(&id, &entityId, &e.Type, &e.Url, &e.Mime, &e.Size, &e.Version, &e.UploadedBy, &e.Width, &e.Height, &createdAt, &e.Index, &sourceId, &dSize, &dFormat)
+		if err != nil {
+			return nil, err
+		}
+
+		e.Id = &id
+		e.EntityId = &entityId
+		e.CreatedAt = createdAt
+		e.DerivativeOf = &sourceId
+		e.DerivativeSize = &dSize
+		e.DerivativeFormat = &dFormat
+		derivatives[sourceId] = e
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	resolved = make([]File, len(files))
+	for i, f := range files {
+		if f.Id != nil {
+			if d, ok := derivatives[*f.Id]; ok {
+				resolved[i] = d
+				continue
+			}
+		}
+		resolved[i] = f
+	}
+
+	return resolved, nil
+}
+
+// GetImageDerivative Get the derivative of the file with the requested size and format, returns the file itself if there is no matching derivative
+func GetImageDerivative(ctx context.Context, file *File, size string, format string) (*File, error) {
+	if file == nil {
+		return nil, nil
+	}
+
+	resolved, err := ResolveImageDerivatives(ctx, []File{*file}, size, format)
+	if err != nil {
+		return nil, err
+	}
+
+	return &resolved[0], nil
+}
@@ -0,0 +1,115 @@
+package model
+
+import (
+	"context"
+	sm "dev.hackerman.me/artheon/veverse-shared/model"
+	"errors"
+	"github.com/gofrs/uuid"
+	"strconv"
+	"strings"
+	"veverse-api/database"
+)
+
+// FileDownloadEvent is the analytics event reported for each download served by the proxy
+const FileDownloadEvent = "file_download"
+
+var ErrInvalidRange = errors.New("invalid range")
+
+// isEntityPublic returns true if the entity is public, files of private entities are stored without public ACLs
+func isEntityPublic(ctx context.Context, entityId uuid.UUID) (public bool, err error) {
+	db := database.DB
+
+	q := `SELECT coalesce(e.public, false) FROM entities e WHERE e.id = $1`
+	err = db.QueryRow(ctx, q, entityId /*$1*/).Scan(&public)
+	return public, err
+}
+
+// isRangeNumber returns true if the range position is empty or consists of digits only (signs are not allowed)
+func isRangeNumber(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// ParseByteRange Parses the single range of the Range header, returns the offset and length of the requested part, multiple ranges are not supported
+func ParseByteRange(header string, size int64) (offset int64, length int64, err error) {
+	if !strings.HasPrefix(header, "bytes=") || strings.Contains(header, ",") {
+		return 0, 0, ErrInvalidRange
+	}
+	spec := strings.TrimPrefix(header, "bytes=")
+
+	first, last, ok := strings.Cut(strings.TrimSpace(spec), "-")
+	if !ok || !isRangeNumber(first) || !isRangeNumber(last) {
+		return 0, 0, ErrInvalidRange
+	}
+
+	if first == "" {
+		// Suffix range with the number of last bytes
+		n, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || n <= 0 || size <= 0 {
+			return 0, 0, ErrInvalidRange
+		}
+		if n > size {
+			n = size
+		}
+		return size - n, n, nil
+	}
+
+	offset, err = strconv.ParseInt(first, 10, 64)
+	if err != nil || offset < 0 || offset >= size {
+		return 0, 0, ErrInvalidRange
+	}
+
+	end := size - 1
+	if last != "" {
+		end, err = strconv.ParseInt(last, 10, 64)
+		if err != nil || end < offset {
+			return 0, 0, ErrInvalidRange
+		}
+		if end >= size {
+			end = size - 1
+		}
+	}
+
+	return offset, end - offset + 1, nil
+}
+
+// ReportFileDownload Reports the download served by the proxy to analytics, anonymous downloads are reported without the user
+func ReportFileDownload(ctx context.Context, requester *sm.User, file *File, offset int64, length int64) error {
+	if requester == nil {
+		requester = &sm.User{}
+	}
+
+	payload := map[string]interface{}{
+		"type":   file.Type,
+		"offset": offset,
+		"length": length,
+	}
+
+	event := AnalyticEventRequest{
+		ContextEntityType: "file",
+		UserId:            convertUuid(requester.Id),
+		Platform:          file.Platform,
+		Deployment:        file.Deployment,
+		Event:             FileDownloadEvent,
+		Payload:           payload,
+	}
+
+	if file.Id != nil {
+		event.ContextEntityId = convertUuid(*file.Id)
+	}
+
+	if file.EntityId != nil {
+		payload["entityId"] = file.EntityId.String()
+
+		// Downloads of app, release and launcher files are reported for the app
+		if appId, err := getEntityStorageApp(ctx, *file.EntityId); err == nil && appId != nil {
+			event.AppId = convertUuid(*appId)
+		}
+	}
+
+	return ReportEvent(ctx, requester, event)
+}
@@ -10,3 +10,5 @@ var ACTIVATION_SECURITY_PASSWORD_SALT = os.Getenv("ACTIVATION_SECURITY_PASSWORD_
 var STRIPE_API_SECRET_KEY = os.Getenv("STRIPE_API_SECRET_KEY")
 var STRIPE_EVENT_PAYMENT_WEBHOOK_SECRET = os.Getenv("STRIPE_EVENT_PAYMENT_WEBHOOK_SECRET")
 var OPENSEA_API_KEY = os.Getenv("OPENSEA_API_KEY")
+var TRENDING_HALF_LIFE_HOURS = os.Getenv("TRENDING_HALF_LIFE_HOURS")
+var TRENDING_REFRESH_INTERVAL = os.Getenv("TRENDING_REFRESH_INTERVAL")
@@ -1,8 +1,6 @@
 package model
 
 import (
-	"bufio"
-	"bytes"
 	"context"
 	sm "dev.hackerman.me/artheon/veverse-shared/model"
 	st "dev.hackerman.me/artheon/veverse-shared/telegram"
@@ -14,11 +12,7 @@ import (
 	"github.com/jackc/pgtype"
 	pgtypeuuid "github.com/jackc/pgtype/ext/gofrs-uuid"
 	"github.com/jackc/pgx/v5"
-	"github.com/nfnt/resize"
 	"github.com/sirupsen/logrus"
-	"image"
-	"image/jpeg"
-	"image/png"
 	"io"
 	"math"
 	"mime/multipart"
@@ -27,6 +21,7 @@ import (
 	"time"
 	"veverse-api/aws/s3"
 	"veverse-api/database"
+	"veverse-api/gltf"
 	"veverse-api/reflect"
 )
 
@@ -34,15 +29,6 @@ var (
 	avatarPlural = "avatars"
 )
 
-type UploadImageType int64
-
-//goland:noinspection GoUnusedConst
-const (
-	ImageFull UploadImageType = iota
-	ImagePreview
-	ImageTexture
-)
-
 var PlatformDependentFileTypes = map[string]bool{
 	"pak":                 true,
 	"release":             true,
@@ -70,6 +56,14 @@ type File struct {
 	OriginalPath *string    `json:"originalPath,omitempty"` // original relative path to maintain directory structure (e.g. for releases)
 	Hash         *string    `json:"hash,omitempty"`
 
+	DerivativeOf     *uuid.UUID `json:"derivativeOf,omitempty"`     // source image of the derivative
+	DerivativeSize   *string    `json:"derivativeSize,omitempty"`   // named size of the derivative (e.g. preview)
+	DerivativeFormat *string    `json:"derivativeFormat,omitempty"` // image format of the derivative (jpeg, png or webp)
+
+	ScanStatus *string `json:"scanStatus,omitempty"` // malware scan status (pending, clean, infected, failed, external or verifying), not set for files which have not been queued for the scan yet
+
+	Metadata *gltf.Metadata `json:"metadata,omitempty"` // metadata extracted from uploaded glTF assets
+
 	Timestamps
 }
 
@@ -94,9 +88,17 @@ func containsLink(h []Link, id uuid.UUID) bool {
 // FileBatchRequestMetadata Batch request metadata for requesting File entities
 type FileBatchRequestMetadata struct {
 	BatchRequestMetadata
-	Type       string `json:"type,omitempty" query:"type"`             // SupportedPlatform (OS) of the pak file (Win64, Mac, Linux, IOS, Android)
-	Platform   string `json:"platform,omitempty" query:"platform"`     // SupportedPlatform (OS) of the pak file (Win64, Mac, Linux, IOS, Android)
-	Deployment string `json:"deployment,omitempty" query:"deployment"` // SupportedDeployment for the pak file (Server or Client)
+	Type         string `json:"type,omitempty" query:"type"`                  // Comma separated file types (e.g. pak,release,image-preview)
+	Platform     string `json:"platform,omitempty" query:"platform"`          // Comma separated SupportedPlatform (OS) list of the pak file (Win64, Mac, Linux, IOS, Android)
+	Deployment   string `json:"deployment,omitempty" query:"deployment"`      // Comma separated SupportedDeployment list for the pak file (Server or Client)
+	Mime         string `json:"mime,omitempty" query:"mime"`                  // Prefix of the MIME type (e.g. image/)
+	MinSize      *int64 `json:"minSize,omitempty" query:"min-size"`           // Minimum file size in bytes
+	MaxSize      *int64 `json:"maxSize,omitempty" query:"max-size"`           // Maximum file size in bytes
+	Version      *int   `json:"version,omitempty" query:"version"`            // Exact file version
+	UpdatedSince string `json:"updatedSince,omitempty" query:"updated-since"` // Files created or updated since the time (RFC 3339)
+	Cursor       string `json:"cursor,omitempty" query:"cursor"`              // Cursor of the next page returned with the previous page, used instead of the offset, the total is not counted for cursor pages (-1)
+	Size         string `json:"size,omitempty" query:"size"`                  // Named size of image derivatives to return instead of the original images (e.g. preview)
+	Format       string `json:"format,omitempty" query:"format"`              // Format of image derivatives to return instead of the original images (jpeg, png or webp)
 }
 
 type FileRequestMetadata struct {
@@ -107,7 +109,7 @@ type FileLinkRequestMetadata struct {
 	Type         string  `json:"type,omitempty" query:"type"`                            // Type of the file
 	Url          string  `json:"url,omitempty" query:"url"`                              // Url of the file
 	Mime         *string `json:"mime,omitempty" query:"mime"`                            // Mime type (optional), by default set to binary/octet-stream)
-	Size         *int    `json:"size,omitempty" query:"size"`                            // Size of the file (optional)
+	Size         *int    `json:"size,omitempty" query:"size"`                            // Size of the file, required for non-admin requesters to check the storage quota
 	Version      int64   `json:"version,omitempty" query:"version"`                      // Version of the file, automatically incremented if the file is re-uploaded or re-linked, used to check if the file has been updated and should be re-downloaded even if it has been cached
 	Deployment   string  `json:"deployment,omitempty" query:"deployment"`                // Deployment for the destination pak file (Server or Client), usually set for package and release files
 	Platform     string  `json:"platform,omitempty" query:"platform"`                    // Platform (OS) of the destination pak file (Win64, Mac, Linux, IOS, Android), usually set for package and release files
@@ -137,7 +139,7 @@ type FileUploadLinkRequestMetadata struct {
 	Type         string  `json:"type,omitempty" query:"type"`                            // Type of the file
 	Url          *string `json:"url,omitempty" query:"url"`                              // Url of the file
 	Mime         *string `json:"mime,omitempty" query:"mime"`                            // Mime type (optional), by default set to binary/octet-stream)
-	Size         *int    `json:"size,omitempty" query:"size"`                            // Size of the file (optional)
+	Size         *int    `json:"size,omitempty" query:"size"`                            // Size of the file, required for non-admin requesters to check the storage quota
 	Version      int64   `json:"version,omitempty" query:"version"`                      // Version of the file, automatically incremented if the file is re-uploaded or re-linked, used to check if the file has been updated and should be re-downloaded even if it has been cached
 	Deployment   string  `json:"deployment,omitempty" query:"deployment"`                // Deployment for the destination pak file (Server or Client), usually set for package and release files
 	Platform     string  `json:"platform,omitempty" query:"platform"`                    // Platform (OS) of the destination pak file (Win64, Mac, Linux, IOS, Android), usually set for package and release files
@@ -154,6 +156,8 @@ type FileDownloadByURLRequestMetadata struct {
 type FileDownloadRequestMetadata struct {
 	EntityId string `json:"entityId,omitempty"` // SupportedPlatform (OS) of the pak file (Win64, Mac, Linux, IOS, Android)
 	FileId   string `json:"fileId,omitempty"`   // SupportedPlatform (OS) of the pak file (Win64, Mac, Linux, IOS, Android)
+	Size     string `json:"size,omitempty"`     // Named size of the image derivative to download instead of the original image (e.g. preview)
+	Format   string `json:"format,omitempty"`   // Format of the image derivative to download instead of the original image (jpeg, png or webp)
 }
 
 func uintPow(x, n uint) uint {
@@ -178,3161 +182,177 @@ func nextPowerOfTwo(x uint) uint {
 	return uintPow(2, uint(math.Ceil(math.Log2(float64(x)))))
 }
 
-// IndexFilesForAdmin Index packages for admin
-func IndexFilesForAdmin(ctx context.Context, entityId uuid.UUID, offset int64, limit int64) (entities []File, total int64, err error) {
+func UploadFileForAdmin(c *fiber.Ctx, requester *sm.User, entityId uuid.UUID, m FileUploadRequestMetadata) (fileId uuid.UUID, err error) {
 	db := database.DB
+	ctx := c.UserContext()
 
-	//region Total
-	q := `SELECT COUNT(*) FROM files f WHERE entity_id = $1`
-
-	row := db.QueryRow(ctx, q, entityId /*$1*/)
+	var (
+		q        string                // query string
+		tx       pgx.Tx                // pgx transaction
+		row      pgx.Row               // pgx row
+		fId      pgtypeuuid.UUID       // id of the file from the db
+		fVersion int64                 // file version from the db
+		id       uuid.UUID             // file id to use
+		formFile *multipart.FileHeader // uploaded file
+		buffer   multipart.File        // uploaded file contents
+		mime     string                // MIME type to use
+		pMIME    *mimetype.MIME        // auto-detected MIME type
+	)
 
-	err = row.Scan(&total)
-	if err != nil {
-		return nil, -1, err
-	}
-	//endregion
+	if PlatformDependentFileTypes[m.Type] {
+		if m.Deployment == "" {
+			err = fmt.Errorf("file requires a deployment configuration")
+			return uuid.UUID{}, err
+		}
 
-	if total == 0 {
-		return []File{}, total, nil
+		if m.Platform == "" {
+			err = fmt.Errorf("file requires a platform")
+			return uuid.UUID{}, err
+		}
 	}
 
-	q = `SELECT
-f.id fileId,
-f.entity_id fileEntityId,
-f.type fileType,
-f.url fileUrl,
-f.mime fileMime,
-f.size fileSize,
-f.version fileVersion,
-f.deployment_type fileDeployment,
-f.platform filePlatform,
-f.uploaded_by fileUploadedBy,
-f.width fileWidth,
-f.height fileHeight,
-f.created_at fileCreatedAt,
-f.updated_at fileUpdatedAt,
-f.variation fileIndex,
-f.hash fileHash,
-f.original_path fileOriginalPath
-FROM files f
-WHERE entity_id = $1
-ORDER BY type, platform, deployment_type, version DESC, variation`
+	// Try to find existing file with same properties
+	q = `SELECT f.id, f.version
+FROM files AS f
+WHERE f.entity_id = $1
+  AND f.type = $2
+  AND f.deployment_type = $3
+  AND f.platform = $4
+  AND f.variation = $5
+  AND f.original_path = $6`
 
-	var (
-		rows pgx.Rows
-		ei   int64 = 0
-	)
+	row = db.QueryRow(ctx, q, entityId, m.Type, m.Deployment, m.Platform, m.Index, m.OriginalPath)
 
-	rows, err = db.Query(ctx, q, entityId)
+	logrus.Infof("uploading file, entityId: %v, type: %v, deployment: %v, platform: %v, index: %v, originalPath: %v", entityId, m.Type, m.Deployment, m.Platform, m.Index, m.OriginalPath)
 
-	if err != nil {
-		return []File{}, total, err
-	}
+	err = row.Scan(&fId, &fVersion)
+	if err != nil && err.Error() == "no rows in result set" {
+		logrus.Infof("inserting a new file")
 
-	defer func() {
-		rows.Close()
-		database.LogPgxStat("IndexFilesForAdmin")
-	}()
+		//region Insert a new file
+		tx, err = db.Begin(ctx)
+		if err != nil {
+			return uuid.UUID{}, err // failed to initiate tx
+		}
 
-	for rows.Next() {
-		var (
-			id           pgtypeuuid.UUID
-			eId          pgtypeuuid.UUID
-			fileType     string
-			url          string
-			mime         *string
-			size         *int64
-			version      int
-			deployment   string
-			platform     string
-			uploadedBy   pgtypeuuid.UUID
-			width        *int
-			height       *int
-			createdAt    pgtype.Timestamp
-			updatedAt    *pgtype.Timestamp
-			index        int
-			hash         *string
-			originalPath *string
-		)
+		//region Process multipart form uploaded file
 
-		err = rows.Scan(
-			&id,
-			&eId,
-			&fileType,
-			&url,
-			&mime,
-			&size,
-			&version,
-			&deployment,
-			&platform,
-			&uploadedBy,
-			&width,
-			&height,
-			&createdAt,
-			&updatedAt,
-			&index,
-			&hash,
-			&originalPath,
-		)
+		// Get upload file
+		formFile, err = c.FormFile("file")
 		if err != nil {
-			return nil, -1, err
+			_ = tx.Rollback(ctx)
+			return uuid.UUID{}, err
 		}
 
-		if ei < offset {
-			ei++
-			continue
+		// Get upload file buffer
+		buffer, err = formFile.Open()
+		if err != nil {
+			_ = tx.Rollback(ctx)
+			return uuid.UUID{}, err
 		}
+		defer func(buffer multipart.File) {
+			err := buffer.Close()
+			if err != nil {
+				logrus.Errorf("failed to close multipart file buffer: %v", err)
+			}
+		}(buffer)
+		//endregion
 
-		if ei-offset >= limit {
-			break
-		}
+		//region Determine MIME type
+		if m.Mime != nil && *m.Mime != "" {
+			// Use explicitly specified MIME type
+			mime = *m.Mime
+		} else {
+			// Seek back to the start of the file
+			_, err = buffer.Seek(0, io.SeekStart)
+			if err != nil {
+				return uuid.UUID{}, err
+			}
 
-		var e File
-		e.Id = &id.UUID
-		e.EntityId = &eId.UUID
-		e.Type = fileType
-		e.Url = url
-		e.Mime = mime
-		e.Size = size
-		e.Version = version
-		e.Deployment = deployment
-		e.Platform = platform
-		e.Index = index
-		e.Hash = hash
-		e.OriginalPath = originalPath
-		if uploadedBy.Status == pgtype.Present {
-			e.UploadedBy = &uploadedBy.UUID
-		}
-		e.Width = width
-		e.Height = height
-		e.CreatedAt = createdAt.Time
-		if updatedAt != nil {
-			e.UpdatedAt = &updatedAt.Time
+			// Try to detect MIME
+			pMIME, _ = mimetype.DetectReader(buffer)
+			mime = pMIME.String()
+
+			// Seek back to the start of the file
+			_, err = buffer.Seek(0, io.SeekStart)
+			if err != nil {
+				return uuid.UUID{}, err
+			}
 		}
+		//endregion
 
-		entities = append(entities, e)
-		ei++
-	}
+		//region S3 Object data
 
-	return entities, total, err
-}
+		// Generate a new uuid for the file
+		id, err = uuid.NewV4()
+		if err != nil {
+			return uuid.UUID{}, err
+		}
 
-// IndexFilesForAdminForDeployment Index packages for admin
-func IndexFilesForAdminForDeployment(ctx context.Context, entityId uuid.UUID, offset int64, limit int64, deployment string) (entities []File, total int64, err error) {
-	db := database.DB
+		// Get url and the key for the entity file
+		url := s3.GetS3UrlForEntityFile(entityId, id)
+		key := s3.GetS3KeyForEntityFile(entityId, id)
 
-	//region Total
-	q := `SELECT COUNT(*) FROM files f WHERE f.entity_id = $1 AND f.deployment_type = $2`
+		//endregion
 
-	row := db.QueryRow(ctx, q, entityId, deployment)
+		//region Add a new file metadata record and upload the Object to S3
 
-	err = row.Scan(&total)
-	if err != nil {
-		return nil, -1, err
-	}
-	//endregion
+		q = `INSERT INTO files AS f (id, entity_id, url, type, mime, size, version, deployment_type, platform, uploaded_by, width, height, created_at, updated_at, variation, original_path, hash)
+			VALUES ($1::uuid, $2::uuid, $3::text, $4::text, $5::text, $6::bigint, $7::bigint, $8::text, $9::text, $10::uuid, $11::integer, $12::integer, now(), null, $13::bigint, $14::text, $15::text)`
+		_, err = tx.Exec(ctx, q, id, entityId, url, m.Type, mime, formFile.Size, m.Version, m.Deployment, m.Platform, requester.Id, m.Width, m.Height, m.Index, m.OriginalPath, m.Hash)
+		if err != nil {
+			_ = tx.Rollback(ctx)
+			return uuid.UUID{}, err
+		}
 
-	if total == 0 {
-		return []File{}, total, nil
-	}
+		// Store glTF metadata, assets exceeding the budget of the file type are rejected
+		err = extractFileMetadata(ctx, tx, id, m.Type, mime, m.OriginalPath, buffer, formFile.Size)
+		if err != nil {
+			_ = tx.Rollback(ctx)
+			return uuid.UUID{}, err
+		}
 
-	q = `SELECT
-f.id fileId,
-f.entity_id fileEntityId,
-f.type fileType,
-f.url fileUrl,
-f.mime fileMime,
-f.size fileSize,
-f.version fileVersion,
-f.deployment_type fileDeployment,
-f.platform filePlatform,
-f.uploaded_by fileUploadedBy,
-f.width fileWidth,
-f.height fileHeight,
-f.created_at fileCreatedAt,
-f.updated_at fileUpdatedAt,
-f.variation fileIndex,
-f.hash fileHash,
-f.original_path fileOriginalPath
-FROM files f
-	LEFT JOIN entities e on e.id = f.entity_id
-WHERE f.entity_id = $1 AND f.deployment_type = $2
-ORDER BY e.updated_at DESC, e.created_at DESC, e.id`
+		var public = true
+		if m.Type == "uplugin_content" || m.Type == "uplugin" {
+			// Protect source files
+			public = false
+		}
 
-	var (
-		rows pgx.Rows
-		ei   int64 = 0
-	)
+		if public {
+			// Files of private entities are only served by the download proxy
+			public, err = isFileObjectPublic(ctx, entityId)
+			if err != nil {
+				_ = tx.Rollback(ctx)
+				return uuid.UUID{}, err
+			}
+		}
 
-	rows, err = db.Query(ctx, q, entityId, deployment)
+		if m.Type == "uplugin_content" {
+			// Send the job status email to the requester
+			if err = SendPackageJobStatusEmail(c, requester, entityId, "unclaimed"); err != nil {
+				logrus.Errorf("failed to send job status email: %v", err)
+			}
 
-	if err != nil {
-		return []File{}, total, err
-	}
+			if err = st.SendTelegramMessage(fmt.Sprintf("Creating a new job for %s", entityId)); err != nil {
+				logrus.Errorf("failed to send a job status telegram message: %v", err)
+			}
 
-	defer func() {
-		rows.Close()
-		database.LogPgxStat("IndexFilesForAdminForDeployment")
-	}()
+			// Schedule package jobs
+			if err = CreatePackageJobs(c, requester, entityId); err != nil {
+				logrus.Errorf("failed to create package jobs: %v", err)
+			}
 
-	for rows.Next() {
-		var (
-			id           pgtypeuuid.UUID
-			eId          pgtypeuuid.UUID
-			fileType     string
-			url          string
-			mime         *string
-			size         *int64
-			version      int
-			fDeployment  string
-			platform     string
-			uploadedBy   pgtypeuuid.UUID
-			width        *int
-			height       *int
-			createdAt    pgtype.Timestamp
-			updatedAt    *pgtype.Timestamp
-			index        int
-			hash         *string
-			originalPath *string
-		)
-
-		err = rows.Scan(
-			&id,
-			&eId,
-			&fileType,
-			&url,
-			&mime,
-			&size,
-			&version,
-			&fDeployment,
-			&platform,
-			&uploadedBy,
-			&width,
-			&height,
-			&createdAt,
-			&updatedAt,
-			&index,
-			&hash,
-			&originalPath,
-		)
-		if err != nil {
-			return nil, -1, err
-		}
-
-		if ei < offset {
-			ei++
-			continue
-		}
-
-		if ei-offset >= limit {
-			break
-		}
-
-		var e File
-		e.Id = &id.UUID
-		e.EntityId = &eId.UUID
-		e.Type = fileType
-		e.Url = url
-		e.Mime = mime
-		e.Size = size
-		e.Version = version
-		e.Deployment = fDeployment
-		e.Platform = platform
-		e.Index = index
-		e.Hash = hash
-		e.OriginalPath = originalPath
-		if uploadedBy.Status == pgtype.Present {
-			e.UploadedBy = &uploadedBy.UUID
-		}
-		e.Width = width
-		e.Height = height
-		e.CreatedAt = createdAt.Time
-		if updatedAt != nil {
-			e.UpdatedAt = &updatedAt.Time
-		}
-
-		entities = append(entities, e)
-		ei++
-	}
-
-	return entities, total, err
-}
-
-// IndexFilesForAdminForPlatform Index packages for admin
-func IndexFilesForAdminForPlatform(ctx context.Context, entityId uuid.UUID, offset int64, limit int64, platform string) (entities []File, total int64, err error) {
-	db := database.DB
-
-	//region Total
-	q := `SELECT COUNT(*) FROM files f WHERE f.entity_id = $1 AND f.platform = $2`
-
-	row := db.QueryRow(ctx, q, entityId, platform)
-
-	err = row.Scan(&total)
-	if err != nil {
-		return nil, -1, err
-	}
-	//endregion
-
-	if total == 0 {
-		return []File{}, total, nil
-	}
-
-	q = `SELECT
-f.id fileId,
-f.entity_id fileEntityId,
-f.type fileType,
-f.url fileUrl,
-f.mime fileMime,
-f.size fileSize,
-f.version fileVersion,
-f.deployment_type fileDeployment,
-f.platform filePlatform,
-f.uploaded_by fileUploadedBy,
-f.width fileWidth,
-f.height fileHeight,
-f.created_at fileCreatedAt,
-f.updated_at fileUpdatedAt,
-f.variation fileIndex,
-f.hash fileHash,
-f.original_path fileOriginalPath
-FROM files f
-	LEFT JOIN entities e on e.id = f.entity_id
-WHERE f.entity_id = $1 AND f.platform = $2
-ORDER BY e.updated_at DESC, e.created_at DESC, e.id`
-
-	var (
-		rows pgx.Rows
-		ei   int64 = 0
-	)
-
-	rows, err = db.Query(ctx, q, entityId, platform)
-
-	if err != nil {
-		return []File{}, total, err
-	}
-
-	defer func() {
-		rows.Close()
-		database.LogPgxStat("IndexFilesForAdminForPlatform")
-	}()
-
-	for rows.Next() {
-		var (
-			id           pgtypeuuid.UUID
-			eId          pgtypeuuid.UUID
-			fileType     string
-			url          string
-			mime         *string
-			size         *int64
-			version      int
-			deployment   string
-			fPlatform    string
-			uploadedBy   pgtypeuuid.UUID
-			width        *int
-			height       *int
-			createdAt    pgtype.Timestamp
-			updatedAt    *pgtype.Timestamp
-			index        int
-			hash         *string
-			originalPath *string
-		)
-
-		err = rows.Scan(
-			&id,
-			&eId,
-			&fileType,
-			&url,
-			&mime,
-			&size,
-			&version,
-			&deployment,
-			&fPlatform,
-			&uploadedBy,
-			&width,
-			&height,
-			&createdAt,
-			&updatedAt,
-			&index,
-			&hash,
-			&originalPath,
-		)
-		if err != nil {
-			return nil, -1, err
-		}
-
-		if ei < offset {
-			ei++
-			continue
-		}
-
-		if ei-offset >= limit {
-			break
-		}
-
-		var e File
-		e.Id = &id.UUID
-		e.EntityId = &eId.UUID
-		e.Type = fileType
-		e.Url = url
-		e.Mime = mime
-		e.Size = size
-		e.Version = version
-		e.Deployment = deployment
-		e.Platform = fPlatform
-		e.Index = index
-		e.Hash = hash
-		e.OriginalPath = originalPath
-		if uploadedBy.Status == pgtype.Present {
-			e.UploadedBy = &uploadedBy.UUID
-		}
-		e.Width = width
-		e.Height = height
-		e.CreatedAt = createdAt.Time
-		if updatedAt != nil {
-			e.UpdatedAt = &updatedAt.Time
-		}
-
-		entities = append(entities, e)
-		ei++
-	}
-
-	return entities, total, err
-}
-
-// IndexFilesForAdminForPlatformForDeployment Index packages for admin
-func IndexFilesForAdminForPlatformForDeployment(ctx context.Context, entityId uuid.UUID, offset int64, limit int64, platform string, deployment string) (entities []File, total int64, err error) {
-	db := database.DB
-
-	//region Total
-	q := `SELECT COUNT(*) FROM files f WHERE f.entity_id = $1 AND f.platform = $2 AND f.deployment_type = $3`
-
-	row := db.QueryRow(ctx, q, entityId, platform, deployment)
-
-	err = row.Scan(&total)
-	if err != nil {
-		return nil, -1, err
-	}
-	//endregion
-
-	if total == 0 {
-		return []File{}, total, nil
-	}
-
-	q = `SELECT
-f.id fileId,
-f.entity_id fileEntityId,
-f.type fileType,
-f.url fileUrl,
-f.mime fileMime,
-f.size fileSize,
-f.version fileVersion,
-f.deployment_type fileDeployment,
-f.platform filePlatform,
-f.uploaded_by fileUploadedBy,
-f.width fileWidth,
-f.height fileHeight,
-f.created_at fileCreatedAt,
-f.updated_at fileUpdatedAt,
-f.variation fileIndex,
-f.hash fileHash,
-f.original_path fileOriginalPath
-FROM files f
-	LEFT JOIN entities e on e.id = f.entity_id
-WHERE f.entity_id = $1 AND f.platform = $2 AND f.deployment_type = $3
-ORDER BY e.updated_at DESC, e.created_at DESC, e.id`
-
-	var (
-		rows pgx.Rows
-		ei   int64 = 0
-	)
-
-	rows, err = db.Query(ctx, q, entityId, platform, deployment)
-
-	if err != nil {
-		return []File{}, total, err
-	}
-
-	defer func() {
-		rows.Close()
-		database.LogPgxStat("IndexFilesForAdminForPlatformForDeployment")
-	}()
-
-	for rows.Next() {
-		var (
-			id           pgtypeuuid.UUID
-			eId          pgtypeuuid.UUID
-			fileType     string
-			url          string
-			mime         *string
-			size         *int64
-			version      int
-			fDeployment  string
-			fPlatform    string
-			uploadedBy   pgtypeuuid.UUID
-			width        *int
-			height       *int
-			createdAt    pgtype.Timestamp
-			updatedAt    *pgtype.Timestamp
-			index        int
-			hash         *string
-			originalPath *string
-		)
-
-		err = rows.Scan(
-			&id,
-			&eId,
-			&fileType,
-			&url,
-			&mime,
-			&size,
-			&version,
-			&fDeployment,
-			&fPlatform,
-			&uploadedBy,
-			&width,
-			&height,
-			&createdAt,
-			&updatedAt,
-			&index,
-			&hash,
-			&originalPath,
-		)
-		if err != nil {
-			return nil, -1, err
-		}
-
-		if ei < offset {
-			ei++
-			continue
-		}
-
-		if ei-offset >= limit {
-			break
-		}
-
-		var e File
-		e.Id = &id.UUID
-		e.EntityId = &eId.UUID
-		e.Type = fileType
-		e.Url = url
-		e.Mime = mime
-		e.Size = size
-		e.Version = version
-		e.Deployment = fDeployment
-		e.Platform = fPlatform
-		e.Index = index
-		e.Hash = hash
-		e.OriginalPath = originalPath
-		if uploadedBy.Status == pgtype.Present {
-			e.UploadedBy = &uploadedBy.UUID
-		}
-		e.Width = width
-		e.Height = height
-		e.CreatedAt = createdAt.Time
-		if updatedAt != nil {
-			e.UpdatedAt = &updatedAt.Time
-		}
-
-		entities = append(entities, e)
-		ei++
-	}
-
-	return entities, total, err
-}
-
-// IndexFilesForAdminForType Index packages for admin
-func IndexFilesForAdminForType(ctx context.Context, entityId uuid.UUID, offset int64, limit int64, fileType string) (entities []File, total int64, err error) {
-	db := database.DB
-
-	//region Total
-	q := `SELECT COUNT(*) FROM files f WHERE f.entity_id = $1 AND f.type = $2`
-
-	row := db.QueryRow(ctx, q, entityId, fileType)
-
-	err = row.Scan(&total)
-	if err != nil {
-		return nil, -1, err
-	}
-	//endregion
-
-	if total == 0 {
-		return []File{}, total, nil
-	}
-
-	q = `SELECT
-f.id fileId,
-f.entity_id fileEntityId,
-f.type fileType,
-f.url fileUrl,
-f.mime fileMime,
-f.size fileSize,
-f.version fileVersion,
-f.deployment_type fileDeployment,
-f.platform filePlatform,
-f.uploaded_by fileUploadedBy,
-f.width fileWidth,
-f.height fileHeight,
-f.created_at fileCreatedAt,
-f.updated_at fileUpdatedAt,
-f.variation fileIndex,
-f.hash fileHash,
-f.original_path fileOriginalPath
-FROM files f
-	LEFT JOIN entities e on e.id = f.entity_id
-WHERE f.entity_id = $1 AND f.type = $2
-ORDER BY e.updated_at DESC, e.created_at DESC, e.id`
-
-	var (
-		rows pgx.Rows
-		ei   int64 = 0
-	)
-
-	rows, err = db.Query(ctx, q, entityId, fileType)
-
-	if err != nil {
-		return []File{}, total, err
-	}
-
-	defer func() {
-		rows.Close()
-		database.LogPgxStat("IndexFilesForAdminForType")
-	}()
-
-	for rows.Next() {
-		var (
-			id           pgtypeuuid.UUID
-			eId          pgtypeuuid.UUID
-			fFileType    string
-			url          string
-			mime         *string
-			size         *int64
-			version      int
-			deployment   string
-			platform     string
-			uploadedBy   pgtypeuuid.UUID
-			width        *int
-			height       *int
-			createdAt    pgtype.Timestamp
-			updatedAt    *pgtype.Timestamp
-			index        int
-			hash         *string
-			originalPath *string
-		)
-
-		err = rows.Scan(
-			&id,
-			&eId,
-			&fFileType,
-			&url,
-			&mime,
-			&size,
-			&version,
-			&deployment,
-			&platform,
-			&uploadedBy,
-			&width,
-			&height,
-			&createdAt,
-			&updatedAt,
-			&index,
-			&hash,
-			&originalPath,
-		)
-		if err != nil {
-			return nil, -1, err
-		}
-
-		if ei < offset {
-			ei++
-			continue
-		}
-
-		if ei-offset >= limit {
-			break
-		}
-
-		var e File
-		e.Id = &id.UUID
-		e.EntityId = &eId.UUID
-		e.Type = fileType
-		e.Url = url
-		e.Mime = mime
-		e.Size = size
-		e.Version = version
-		e.Deployment = deployment
-		e.Platform = platform
-		e.Index = index
-		e.Hash = hash
-		e.OriginalPath = originalPath
-		if uploadedBy.Status == pgtype.Present {
-			e.UploadedBy = &uploadedBy.UUID
-		}
-		e.Width = width
-		e.Height = height
-		e.CreatedAt = createdAt.Time
-		if updatedAt != nil {
-			e.UpdatedAt = &updatedAt.Time
-		}
-
-		entities = append(entities, e)
-		ei++
-	}
-
-	return entities, total, err
-}
-
-// IndexFilesForAdminForTypeForDeployment Index packages for admin
-func IndexFilesForAdminForTypeForDeployment(ctx context.Context, entityId uuid.UUID, offset int64, limit int64, fileType string, deployment string) (entities []File, total int64, err error) {
-	db := database.DB
-
-	//region Total
-	q := `SELECT COUNT(*) FROM files f WHERE f.entity_id = $1 AND f.deployment_type = $2 AND f.type = $3`
-
-	row := db.QueryRow(ctx, q, entityId, deployment, fileType)
-
-	err = row.Scan(&total)
-	if err != nil {
-		return nil, -1, err
-	}
-	//endregion
-
-	if total == 0 {
-		return []File{}, total, nil
-	}
-
-	q = `SELECT
-f.id fileId,
-f.entity_id fileEntityId,
-f.type fileType,
-f.url fileUrl,
-f.mime fileMime,
-f.size fileSize,
-f.version fileVersion,
-f.deployment_type fileDeployment,
-f.platform filePlatform,
-f.uploaded_by fileUploadedBy,
-f.width fileWidth,
-f.height fileHeight,
-f.created_at fileCreatedAt,
-f.updated_at fileUpdatedAt,
-f.variation fileIndex,
-f.hash fileHash,
-f.original_path fileOriginalPath
-FROM files f
-	LEFT JOIN entities e on e.id = f.entity_id
-WHERE f.entity_id = $1 AND f.platform = $2 AND f.deployment_type = $3
-ORDER BY e.updated_at DESC, e.created_at DESC, e.id`
-
-	var (
-		rows pgx.Rows
-		ei   int64 = 0
-	)
-
-	rows, err = db.Query(ctx, q)
-
-	if err != nil {
-		return []File{}, total, err
-	}
-
-	defer func() {
-		rows.Close()
-		database.LogPgxStat("IndexFilesForAdminForTypeForDeployment")
-	}()
-
-	for rows.Next() {
-		var (
-			id           pgtypeuuid.UUID
-			eId          pgtypeuuid.UUID
-			fFileType    string
-			url          string
-			mime         *string
-			size         *int64
-			version      int
-			fDeployment  string
-			fPlatform    string
-			uploadedBy   pgtypeuuid.UUID
-			width        *int
-			height       *int
-			createdAt    pgtype.Timestamp
-			updatedAt    *pgtype.Timestamp
-			index        int
-			hash         *string
-			originalPath *string
-		)
-
-		err = rows.Scan(
-			&id,
-			&eId,
-			&fFileType,
-			&url,
-			&mime,
-			&size,
-			&version,
-			&fDeployment,
-			&fPlatform,
-			&uploadedBy,
-			&width,
-			&height,
-			&createdAt,
-			&updatedAt,
-			&index,
-			&hash,
-			&originalPath,
-		)
-		if err != nil {
-			return nil, -1, err
-		}
-
-		if ei < offset {
-			ei++
-			continue
-		}
-
-		if ei-offset >= limit {
-			break
-		}
-
-		var e File
-		e.Id = &id.UUID
-		e.EntityId = &eId.UUID
-		e.Type = fFileType
-		e.Url = url
-		e.Mime = mime
-		e.Size = size
-		e.Version = version
-		e.Deployment = fDeployment
-		e.Platform = fPlatform
-		e.Index = index
-		e.Hash = hash
-		e.OriginalPath = originalPath
-		if uploadedBy.Status == pgtype.Present {
-			e.UploadedBy = &uploadedBy.UUID
-		}
-		e.Width = width
-		e.Height = height
-		e.CreatedAt = createdAt.Time
-		if updatedAt != nil {
-			e.UpdatedAt = &updatedAt.Time
-		}
-
-		entities = append(entities, e)
-		ei++
-	}
-
-	return entities, total, err
-}
-
-// IndexFilesForAdminForTypeForPlatform Index packages for admin
-func IndexFilesForAdminForTypeForPlatform(ctx context.Context, entityId uuid.UUID, offset int64, limit int64, fileType string, platform string) (entities []File, total int64, err error) {
-	db := database.DB
-
-	//region Total
-	q := `SELECT COUNT(*) FROM files f WHERE f.entity_id = $1 AND f.type = $2 AND f.platform = $3`
-
-	row := db.QueryRow(ctx, q, entityId, fileType, platform)
-
-	err = row.Scan(&total)
-	if err != nil {
-		return nil, -1, err
-	}
-	//endregion
-
-	if total == 0 {
-		return []File{}, total, nil
-	}
-
-	q = `SELECT
-f.id fileId,
-f.entity_id fileEntityId,
-f.type fileType,
-f.url fileUrl,
-f.mime fileMime,
-f.size fileSize,
-f.version fileVersion,
-f.deployment_type fileDeployment,
-f.platform filePlatform,
-f.uploaded_by fileUploadedBy,
-f.width fileWidth,
-f.height fileHeight,
-f.created_at fileCreatedAt,
-f.updated_at fileUpdatedAt,
-f.variation fileIndex,
-f.hash fileHash,
-f.original_path fileOriginalPath
-FROM files f
-	LEFT JOIN entities e on e.id = f.entity_id
-WHERE f.entity_id = $1 AND f.type = $2 AND f.platform = $3
-ORDER BY e.updated_at DESC, e.created_at DESC, e.id`
-
-	var (
-		rows pgx.Rows
-		ei   int64 = 0
-	)
-
-	rows, err = db.Query(ctx, q, entityId, fileType, platform)
-
-	if err != nil {
-		return []File{}, total, err
-	}
-
-	defer func() {
-		rows.Close()
-		database.LogPgxStat("IndexFilesForAdminForTypeForPlatform")
-	}()
-
-	for rows.Next() {
-		var (
-			id           pgtypeuuid.UUID
-			eId          pgtypeuuid.UUID
-			fFileType    string
-			url          string
-			mime         *string
-			size         *int64
-			version      int
-			fDeployment  string
-			fPlatform    string
-			uploadedBy   pgtypeuuid.UUID
-			width        *int
-			height       *int
-			createdAt    pgtype.Timestamp
-			updatedAt    *pgtype.Timestamp
-			index        int
-			hash         *string
-			originalPath *string
-		)
-
-		err = rows.Scan(
-			&id,
-			&eId,
-			&fFileType,
-			&url,
-			&mime,
-			&size,
-			&version,
-			&fDeployment,
-			&fPlatform,
-			&uploadedBy,
-			&width,
-			&height,
-			&createdAt,
-			&updatedAt,
-			&index,
-			&hash,
-			&originalPath,
-		)
-		if err != nil {
-			return nil, -1, err
-		}
-
-		if ei < offset {
-			ei++
-			continue
-		}
-
-		if ei-offset >= limit {
-			break
-		}
-
-		var e File
-		e.Id = &id.UUID
-		e.EntityId = &eId.UUID
-		e.Type = fFileType
-		e.Url = url
-		e.Mime = mime
-		e.Size = size
-		e.Version = version
-		e.Deployment = fDeployment
-		e.Platform = fPlatform
-		e.Index = index
-		e.Hash = hash
-		e.OriginalPath = originalPath
-		if uploadedBy.Status == pgtype.Present {
-			e.UploadedBy = &uploadedBy.UUID
-		}
-		e.Width = width
-		e.Height = height
-		e.CreatedAt = createdAt.Time
-		if updatedAt != nil {
-			e.UpdatedAt = &updatedAt.Time
-		}
-		entities = append(entities, e)
-		ei++
-	}
-
-	return entities, total, err
-}
-
-// IndexFilesForAdminForTypeForPlatformForDeployment Index packages for admin
-func IndexFilesForAdminForTypeForPlatformForDeployment(ctx context.Context, entityId uuid.UUID, offset int64, limit int64, fileType string, platform string, deployment string) (entities []File, total int64, err error) {
-	db := database.DB
-
-	//region Total
-	q := `SELECT COUNT(*) FROM files f WHERE f.entity_id = $1 AND f.platform = $2 AND f.type = $3 AND f.deployment_type = $4`
-
-	row := db.QueryRow(ctx, q, entityId, platform, fileType, deployment)
-
-	err = row.Scan(&total)
-	if err != nil {
-		return nil, -1, err
-	}
-	//endregion
-
-	if total == 0 {
-		return []File{}, total, nil
-	}
-
-	q = `SELECT
-f.id fileId,
-f.entity_id fileEntityId,
-f.type fileType,
-f.url fileUrl,
-f.mime fileMime,
-f.size fileSize,
-f.version fileVersion,
-f.deployment_type fileDeployment,
-f.platform filePlatform,
-f.uploaded_by fileUploadedBy,
-f.width fileWidth,
-f.height fileHeight,
-f.created_at fileCreatedAt,
-f.updated_at fileUpdatedAt,
-f.variation fileIndex,
-f.hash fileHash,
-f.original_path fileOriginalPath
-FROM files f
-	LEFT JOIN entities e on e.id = f.entity_id
-	WHERE f.entity_id = $1 AND f.platform = $2 AND f.type = $3 AND f.deployment_type = $4
-ORDER BY e.updated_at DESC, e.created_at DESC, e.id`
-
-	var (
-		rows pgx.Rows
-		ei   int64 = 0
-	)
-
-	rows, err = db.Query(ctx, q, entityId, platform, fileType, deployment)
-
-	if err != nil {
-		return []File{}, total, err
-	}
-
-	defer func() {
-		rows.Close()
-		database.LogPgxStat("IndexFilesForAdminForTypeForPlatformForDeployment")
-	}()
-
-	for rows.Next() {
-		var (
-			id           pgtypeuuid.UUID
-			eId          pgtypeuuid.UUID
-			fFileType    string
-			url          string
-			mime         *string
-			size         *int64
-			version      int
-			fDeployment  string
-			fPlatform    string
-			uploadedBy   pgtypeuuid.UUID
-			width        *int
-			height       *int
-			createdAt    pgtype.Timestamp
-			updatedAt    *pgtype.Timestamp
-			index        int
-			hash         *string
-			originalPath *string
-		)
-
-		err = rows.Scan(
-			&id,
-			&eId,
-			&fFileType,
-			&url,
-			&mime,
-			&size,
-			&version,
-			&fDeployment,
-			&fPlatform,
-			&uploadedBy,
-			&width,
-			&height,
-			&createdAt,
-			&updatedAt,
-			&index,
-			&hash,
-			&originalPath,
-		)
-		if err != nil {
-			return nil, -1, err
-		}
-
-		if ei < offset {
-			ei++
-			continue
-		}
-
-		if ei-offset >= limit {
-			break
-		}
-
-		var e File
-		e.Id = &id.UUID
-		e.EntityId = &eId.UUID
-		e.Type = fFileType
-		e.Url = url
-		e.Mime = mime
-		e.Size = size
-		e.Version = version
-		e.Deployment = fDeployment
-		e.Platform = fPlatform
-		e.Index = index
-		e.Hash = hash
-		e.OriginalPath = originalPath
-		if uploadedBy.Status == pgtype.Present {
-			e.UploadedBy = &uploadedBy.UUID
-		}
-		e.Width = width
-		e.Height = height
-		e.CreatedAt = createdAt.Time
-		if updatedAt != nil {
-			e.UpdatedAt = &updatedAt.Time
-		}
-
-		entities = append(entities, e)
-		ei++
-	}
-
-	return entities, total, err
-}
-
-// IndexFilesForRequester Index files for requester
-func IndexFilesForRequester(ctx context.Context, requester *sm.User, entityId uuid.UUID, offset int64, limit int64) (entities []File, total int64, err error) {
-	db := database.DB
-
-	//region Total
-	q := `SELECT COUNT(*) 
-FROM files f 
-    LEFT JOIN entities e ON e.id = f.entity_id
-    LEFT JOIN accessibles a ON e.id = a.entity_id AND a.user_id = $1::uuid 
-WHERE e.id = $2 AND (e.public OR a.can_view OR a.is_owner)`
-
-	row := db.QueryRow(ctx, q, requester.Id /*$1*/, entityId /*$2*/)
-
-	err = row.Scan(&total)
-	if err != nil {
-		return nil, -1, err
-	}
-	//endregion
-
-	if total == 0 {
-		return []File{}, total, nil
-	}
-
-	q = `SELECT
-f.id fileId,
-f.entity_id fileEntityId,
-f.type fileType,
-f.url fileUrl,
-f.mime fileMime,
-f.size fileSize,
-f.version fileVersion,
-f.deployment_type fileDeployment,
-f.platform filePlatform,
-f.uploaded_by fileUploadedBy,
-f.width fileWidth,
-f.height fileHeight,
-f.created_at fileCreatedAt,
-f.updated_at fileUpdatedAt,
-f.variation fileIndex,
-f.hash fileHash,
-f.original_path fileOriginalPath
-FROM files f
-	LEFT JOIN entities e ON f.entity_id = e.id
-	LEFT JOIN accessibles a ON e.id = a.entity_id AND a.user_id = $1::uuid
-WHERE f.entity_id = $2 AND (e.public OR a.can_view OR a.is_owner)
-ORDER BY type, platform, deployment_type, version DESC, variation`
-
-	var (
-		rows pgx.Rows
-		ei   int64 = 0
-	)
-
-	rows, err = db.Query(ctx, q, requester.Id, entityId)
-
-	if err != nil {
-		return []File{}, total, err
-	}
-
-	defer func() {
-		rows.Close()
-		database.LogPgxStat("IndexFilesForRequester")
-	}()
-
-	for rows.Next() {
-		var (
-			id         pgtypeuuid.UUID
-			eId        pgtypeuuid.UUID
-			fileType   string
-			url        string
-			mime       *string
-			size       *int64
-			version    int
-			deployment string
-			platform   string
-			uploadedBy pgtypeuuid.UUID
-			width      *int
-			height     *int
-			createdAt  pgtype.Timestamp
-			updatedAt  *pgtype.Timestamp
-			index      int
-			hash       *string
-			original   *string
-		)
-
-		err = rows.Scan(
-			&id,
-			&eId,
-			&fileType,
-			&url,
-			&mime,
-			&size,
-			&version,
-			&deployment,
-			&platform,
-			&uploadedBy,
-			&width,
-			&height,
-			&createdAt,
-			&updatedAt,
-			&index,
-			&hash,
-			&original,
-		)
-		if err != nil {
-			return nil, -1, err
-		}
-
-		var e File
-		e.Id = &id.UUID
-		e.EntityId = &eId.UUID
-		e.Type = fileType
-		e.Url = url
-		e.Mime = mime
-		e.Size = size
-		e.Version = version
-		e.Deployment = deployment
-		e.Platform = platform
-		e.Index = index
-		e.Hash = hash
-		e.OriginalPath = original
-		if uploadedBy.Status == pgtype.Present {
-			e.UploadedBy = &uploadedBy.UUID
-		}
-		e.Width = width
-		e.Height = height
-		e.CreatedAt = createdAt.Time
-		if updatedAt != nil {
-			e.UpdatedAt = &updatedAt.Time
-		}
-
-		if ei < offset {
-			ei++
-			continue
-		}
-
-		if ei-offset >= limit {
-			break
-		}
-
-		entities = append(entities, e)
-	}
-
-	return entities, total, err
-}
-
-// IndexFilesForRequesterForDeployment Index packages for admin
-func IndexFilesForRequesterForDeployment(ctx context.Context, requester *sm.User, entityId uuid.UUID, offset int64, limit int64, deployment string) (entities []File, total int64, err error) {
-	db := database.DB
-
-	//region Total
-	q := `SELECT COUNT(*) FROM files f 
-    LEFT JOIN entities e ON e.id = f.entity_id 
-    LEFT JOIN accessibles a ON e.id = a.entity_id AND a.user_id = $1::uuid 
-WHERE e.id = $2 AND (e.public OR a.can_view OR a.is_owner) AND f.deployment_type = $3`
-
-	row := db.QueryRow(ctx, q, requester.Id /*$1*/, entityId /*$2*/, deployment)
-
-	err = row.Scan(&total)
-	if err != nil {
-		return nil, -1, err
-	}
-	//endregion
-
-	if total == 0 {
-		return []File{}, total, nil
-	}
-
-	q = `SELECT
-f.id fileId,
-f.entity_id fileEntityId,
-f.type fileType,
-f.url fileUrl,
-f.mime fileMime,
-f.size fileSize,
-f.version fileVersion,
-f.deployment_type fileDeployment,
-f.platform filePlatform,
-f.uploaded_by fileUploadedBy,
-f.width fileWidth,
-f.height fileHeight,
-f.created_at fileCreatedAt,
-f.updated_at fileUpdatedAt,
-f.variation fileIndex,
-f.hash fileHash,
-f.original_path fileOriginalPath
-FROM files f
-	LEFT JOIN entities e ON e.id = f.entity_id
-    LEFT JOIN accessibles a ON e.id = a.entity_id AND a.user_id = $1::uuid
-WHERE e.id = $2 AND (e.public OR a.can_view OR a.is_owner) AND f.deployment_type = $3
-ORDER BY e.updated_at DESC, e.created_at DESC, e.id`
-
-	var (
-		rows pgx.Rows
-		ei   int64 = 0
-	)
-
-	rows, err = db.Query(ctx, q, requester.Id, entityId, deployment)
-
-	if err != nil {
-		return []File{}, total, err
-	}
-
-	defer func() {
-		rows.Close()
-		database.LogPgxStat("IndexFilesForRequesterForDeployment")
-	}()
-
-	for rows.Next() {
-		var (
-			id          pgtypeuuid.UUID
-			eId         pgtypeuuid.UUID
-			fileType    string
-			url         string
-			mime        *string
-			size        *int64
-			version     int
-			fDeployment string
-			platform    string
-			uploadedBy  pgtypeuuid.UUID
-			width       *int
-			height      *int
-			createdAt   pgtype.Timestamp
-			updatedAt   *pgtype.Timestamp
-			index       int
-			hash        *string
-			original    *string
-		)
-
-		err = rows.Scan(
-			&id,
-			&eId,
-			&fileType,
-			&url,
-			&mime,
-			&size,
-			&version,
-			&fDeployment,
-			&platform,
-			&uploadedBy,
-			&width,
-			&height,
-			&createdAt,
-			&updatedAt,
-			&index,
-			&hash,
-			&original,
-		)
-		if err != nil {
-			return nil, -1, err
-		}
-
-		if ei < offset {
-			ei++
-			continue
-		}
-
-		if ei-offset >= limit {
-			break
-		}
-
-		var e File
-		e.Id = &id.UUID
-		e.EntityId = &eId.UUID
-		e.Type = fileType
-		e.Url = url
-		e.Mime = mime
-		e.Size = size
-		e.Version = version
-		e.Deployment = fDeployment
-		e.Platform = platform
-		e.Index = index
-		e.Hash = hash
-		e.OriginalPath = original
-		if uploadedBy.Status == pgtype.Present {
-			e.UploadedBy = &uploadedBy.UUID
-		}
-		e.Width = width
-		e.Height = height
-		e.CreatedAt = createdAt.Time
-		if updatedAt != nil {
-			e.UpdatedAt = &updatedAt.Time
-		}
-
-		entities = append(entities, e)
-		ei++
-	}
-
-	return entities, total, err
-}
-
-// IndexFilesForRequesterForPlatform Index packages for Requester
-func IndexFilesForRequesterForPlatform(ctx context.Context, requester *sm.User, entityId uuid.UUID, offset int64, limit int64, platform string) (entities []File, total int64, err error) {
-	db := database.DB
-
-	//region Total
-	q := `SELECT COUNT(*) FROM files f
-LEFT JOIN entities e ON e.id = f.entity_id 
-LEFT JOIN accessibles a ON e.id = a.entity_id AND a.user_id = $1::uuid 
-WHERE e.id = $2 AND (e.public OR a.can_view OR a.is_owner) AND f.platform = $3`
-
-	row := db.QueryRow(ctx, q, requester.Id /*$1*/, entityId /*$2*/, platform)
-
-	err = row.Scan(&total)
-	if err != nil {
-		return nil, -1, err
-	}
-	//endregion
-
-	if total == 0 {
-		return []File{}, total, nil
-	}
-
-	q = `SELECT
-f.id fileId,
-f.entity_id fileEntityId,
-f.type fileType,
-f.url fileUrl,
-f.mime fileMime,
-f.size fileSize,
-f.version fileVersion,
-f.deployment_type fileDeployment,
-f.platform filePlatform,
-f.uploaded_by fileUploadedBy,
-f.width fileWidth,
-f.height fileHeight,
-f.created_at fileCreatedAt,
-f.updated_at fileUpdatedAt,
-f.variation fileIndex,
-f.hash fileHash,
-f.original_path fileOriginalPath
-FROM files f
-	LEFT JOIN entities e on e.id = f.entity_id
-    LEFT JOIN accessibles a ON e.id = a.entity_id AND a.user_id = $1::uuid
-WHERE f.entity_id = $2 AND (e.public OR a.can_view OR a.is_owner) AND f.platform = $3
-ORDER BY e.updated_at DESC, e.created_at DESC, e.id`
-
-	var (
-		rows pgx.Rows
-		ei   int64 = 0
-	)
-
-	rows, err = db.Query(ctx, q, requester.Id, entityId, platform)
-
-	if err != nil {
-		return []File{}, total, err
-	}
-
-	defer func() {
-		rows.Close()
-		database.LogPgxStat("IndexFilesForRequesterForPlatform")
-	}()
-
-	for rows.Next() {
-		var (
-			id           pgtypeuuid.UUID
-			eId          pgtypeuuid.UUID
-			fileType     string
-			url          string
-			mime         *string
-			size         *int64
-			version      int
-			fDeployment  string
-			fPlatform    string
-			uploadedBy   pgtypeuuid.UUID
-			width        *int
-			height       *int
-			createdAt    pgtype.Timestamp
-			updatedAt    *pgtype.Timestamp
-			index        int
-			hash         *string
-			originalPath *string
-		)
-
-		err = rows.Scan(
-			&id,
-			&eId,
-			&fileType,
-			&url,
-			&mime,
-			&size,
-			&version,
-			&fDeployment,
-			&fPlatform,
-			&uploadedBy,
-			&width,
-			&height,
-			&createdAt,
-			&updatedAt,
-			&index,
-			&hash,
-			&originalPath,
-		)
-		if err != nil {
-			return nil, -1, err
-		}
-
-		if ei < offset {
-			ei++
-			continue
-		}
-
-		if ei-offset >= limit {
-			break
-		}
-
-		var e File
-		e.Id = &id.UUID
-		e.EntityId = &eId.UUID
-		e.Type = fileType
-		e.Url = url
-		e.Mime = mime
-		e.Size = size
-		e.Version = version
-		e.Deployment = fDeployment
-		e.Platform = fPlatform
-		e.Index = index
-		e.Hash = hash
-		e.OriginalPath = originalPath
-		if uploadedBy.Status == pgtype.Present {
-			e.UploadedBy = &uploadedBy.UUID
-		}
-		e.Width = width
-		e.Height = height
-		e.CreatedAt = createdAt.Time
-		if updatedAt != nil {
-			e.UpdatedAt = &updatedAt.Time
-		}
-
-		entities = append(entities, e)
-		ei++
-	}
-
-	return entities, total, err
-}
-
-// IndexFilesForRequesterForPlatformForDeployment Index packages for Requester
-func IndexFilesForRequesterForPlatformForDeployment(ctx context.Context, requester *sm.User, entityId uuid.UUID, offset int64, limit int64, platform string, deployment string) (entities []File, total int64, err error) {
-	db := database.DB
-
-	//region Total
-	q := `SELECT COUNT(*) FROM files f 
-    LEFT JOIN entities e ON e.id = f.entity_id 
-    LEFT JOIN accessibles a ON e.id = a.entity_id AND a.user_id = $1::uuid 
-WHERE e.id = $2 AND (e.public OR a.can_view OR a.is_owner) AND f.platform = $3 AND f.deployment_type = $4`
-
-	row := db.QueryRow(ctx, q, requester.Id /*$1*/, entityId /*$2*/, platform, deployment)
-
-	err = row.Scan(&total)
-	if err != nil {
-		return nil, -1, err
-	}
-	//endregion
-
-	if total == 0 {
-		return []File{}, total, nil
-	}
-
-	q = `SELECT
-f.id fileId,
-f.entity_id fileEntityId,
-f.type fileType,
-f.url fileUrl,
-f.mime fileMime,
-f.size fileSize,
-f.version fileVersion,
-f.deployment_type fileDeployment,
-f.platform filePlatform,
-f.uploaded_by fileUploadedBy,
-f.width fileWidth,
-f.height fileHeight,
-f.created_at fileCreatedAt,
-f.updated_at fileUpdatedAt,
-f.variation fileIndex,
-f.hash fileHash,
-f.original_path fileOriginalPath
-FROM files f
-	LEFT JOIN entities e on e.id = f.entity_id
-    LEFT JOIN accessibles a ON e.id = a.entity_id AND a.user_id = $1::uuid
-WHERE f.entity_id = $2 AND (e.public OR a.can_view OR a.is_owner) AND f.platform = $3  AND f.deployment_type = $4
-ORDER BY e.updated_at DESC, e.created_at DESC, e.id`
-
-	var (
-		rows pgx.Rows
-		ei   int64 = 0
-	)
-
-	rows, err = db.Query(ctx, q, requester.Id, entityId, platform, deployment)
-
-	if err != nil {
-		return []File{}, total, err
-	}
-
-	defer func() {
-		rows.Close()
-		database.LogPgxStat("IndexFilesForRequesterForPlatformForDeployment")
-	}()
-
-	for rows.Next() {
-		var (
-			id           pgtypeuuid.UUID
-			eId          pgtypeuuid.UUID
-			fileType     string
-			url          string
-			mime         *string
-			size         *int64
-			version      int
-			fDeployment  string
-			fPlatform    string
-			uploadedBy   pgtypeuuid.UUID
-			width        *int
-			height       *int
-			createdAt    pgtype.Timestamp
-			updatedAt    *pgtype.Timestamp
-			index        int
-			hash         *string
-			originalPath *string
-		)
-
-		err = rows.Scan(
-			&id,
-			&eId,
-			&fileType,
-			&url,
-			&mime,
-			&size,
-			&version,
-			&fDeployment,
-			&fPlatform,
-			&uploadedBy,
-			&width,
-			&height,
-			&createdAt,
-			&updatedAt,
-			&index,
-			&hash,
-			&originalPath,
-		)
-		if err != nil {
-			return nil, -1, err
-		}
-
-		if ei < offset {
-			ei++
-			continue
-		}
-
-		if ei-offset >= limit {
-			break
-		}
-
-		var e File
-		e.Id = &id.UUID
-		e.EntityId = &eId.UUID
-		e.Type = fileType
-		e.Url = url
-		e.Mime = mime
-		e.Size = size
-		e.Version = version
-		e.Deployment = fDeployment
-		e.Platform = fPlatform
-		e.Index = index
-		e.Hash = hash
-		e.OriginalPath = originalPath
-		if uploadedBy.Status == pgtype.Present {
-			e.UploadedBy = &uploadedBy.UUID
-		}
-		e.Width = width
-		e.Height = height
-		e.CreatedAt = createdAt.Time
-		if updatedAt != nil {
-			e.UpdatedAt = &updatedAt.Time
-		}
-
-		entities = append(entities, e)
-		ei++
-	}
-
-	return entities, total, err
-}
-
-// IndexFilesForRequesterForType Index packages for Requester
-func IndexFilesForRequesterForType(ctx context.Context, requester *sm.User, entityId uuid.UUID, offset int64, limit int64, fileType string) (entities []File, total int64, err error) {
-	db := database.DB
-
-	//region Total
-	q := `SELECT COUNT(*) FROM files f 
-    LEFT JOIN entities e ON e.id = f.entity_id 
-    LEFT JOIN accessibles a ON e.id = a.entity_id AND a.user_id = $1::uuid 
-WHERE e.id = $2 AND (e.public OR a.can_view OR a.is_owner) AND f.type = $3`
-
-	row := db.QueryRow(ctx, q, requester.Id /*$1*/, entityId /*$2*/, fileType)
-
-	err = row.Scan(&total)
-	if err != nil {
-		return nil, -1, err
-	}
-	//endregion
-
-	if total == 0 {
-		return []File{}, total, nil
-	}
-
-	q = `SELECT
-f.id fileId,
-f.entity_id fileEntityId,
-f.type fileType,
-f.url fileUrl,
-f.mime fileMime,
-f.size fileSize,
-f.version fileVersion,
-f.deployment_type fileDeployment,
-f.platform filePlatform,
-f.uploaded_by fileUploadedBy,
-f.width fileWidth,
-f.height fileHeight,
-f.created_at fileCreatedAt,
-f.updated_at fileUpdatedAt,
-f.variation fileIndex,
-f.hash fileHash,
-f.original_path fileOriginalPath
-FROM files f
-	LEFT JOIN entities e on e.id = f.entity_id
-	LEFT JOIN accessibles a ON e.id = a.entity_id AND a.user_id = $1::uuid
-WHERE e.id = $2 AND (e.public OR a.can_view OR a.is_owner) AND f.type = $3
-ORDER BY e.updated_at DESC, e.created_at DESC, e.id`
-
-	var (
-		rows pgx.Rows
-		ei   int64 = 0
-	)
-
-	rows, err = db.Query(ctx, q, requester.Id, entityId, fileType)
-
-	if err != nil {
-		return []File{}, total, err
-	}
-
-	defer func() {
-		rows.Close()
-		database.LogPgxStat("IndexFilesForRequesterForType")
-	}()
-
-	for rows.Next() {
-		var (
-			id           pgtypeuuid.UUID
-			eId          pgtypeuuid.UUID
-			fFileType    string
-			url          string
-			mime         *string
-			size         *int64
-			version      int
-			fDeployment  string
-			fPlatform    string
-			uploadedBy   pgtypeuuid.UUID
-			width        *int
-			height       *int
-			createdAt    pgtype.Timestamp
-			updatedAt    *pgtype.Timestamp
-			index        int
-			hash         *string
-			originalPath *string
-		)
-
-		err = rows.Scan(
-			&id,
-			&eId,
-			&fFileType,
-			&url,
-			&mime,
-			&size,
-			&version,
-			&fDeployment,
-			&fPlatform,
-			&uploadedBy,
-			&width,
-			&height,
-			&createdAt,
-			&updatedAt,
-			&index,
-			&hash,
-			&originalPath,
-		)
-		if err != nil {
-			return nil, -1, err
-		}
-
-		if ei < offset {
-			ei++
-			continue
-		}
-
-		if ei-offset >= limit {
-			break
-		}
-
-		var e File
-		e.Id = &id.UUID
-		e.EntityId = &eId.UUID
-		e.Type = fFileType
-		e.Url = url
-		e.Mime = mime
-		e.Size = size
-		e.Version = version
-		e.Deployment = fDeployment
-		e.Platform = fPlatform
-		e.Index = index
-		e.Hash = hash
-		e.OriginalPath = originalPath
-		if uploadedBy.Status == pgtype.Present {
-			e.UploadedBy = &uploadedBy.UUID
-		}
-		e.Width = width
-		e.Height = height
-		e.CreatedAt = createdAt.Time
-		if updatedAt != nil {
-			e.UpdatedAt = &updatedAt.Time
-		}
-
-		entities = append(entities, e)
-		ei++
-	}
-
-	return entities, total, err
-}
-
-// IndexFilesForRequesterForTypeForDeployment Index packages for Requester
-func IndexFilesForRequesterForTypeForDeployment(ctx context.Context, requester *sm.User, entityId uuid.UUID, offset int64, limit int64, fileType string, deployment string) (entities []File, total int64, err error) {
-	db := database.DB
-
-	//region Total
-	q := `SELECT COUNT(*) FROM files f 
-    LEFT JOIN entities e ON e.id = f.entity_id
-    LEFT JOIN accessibles a ON e.id = a.entity_id AND a.user_id = $1::uuid
-WHERE e.id = $2 AND (e.public OR a.can_view OR a.is_owner) AND f.type = $3 AND f.deployment_type = $4`
-
-	row := db.QueryRow(ctx, q, entityId /*$1*/, requester.Id /*$2*/, fileType, deployment)
-
-	err = row.Scan(&total)
-	if err != nil {
-		return nil, -1, err
-	}
-	//endregion
-
-	if total == 0 {
-		return []File{}, total, nil
-	}
-
-	q = `SELECT
-f.id fileId,
-f.entity_id fileEntityId,
-f.type fileType,
-f.url fileUrl,
-f.mime fileMime,
-f.size fileSize,
-f.version fileVersion,
-f.deployment_type fileDeployment,
-f.platform filePlatform,
-f.uploaded_by fileUploadedBy,
-f.width fileWidth,
-f.height fileHeight,
-f.created_at fileCreatedAt,
-f.updated_at fileUpdatedAt,
-f.variation fileIndex,
-f.hash fileHash,
-f.original_path fileOriginalPath
-FROM files f
-	LEFT JOIN entities e on e.id = f.entity_id
-	LEFT JOIN accessibles a ON e.id = a.entity_id AND a.user_id = $1::uuid
-WHERE f.entity_id = $2 AND (e.public OR a.can_view OR a.is_owner) AND f.type = $3 AND f.deployment_type = $4
-ORDER BY e.updated_at DESC, e.created_at DESC, e.id`
-
-	var (
-		rows pgx.Rows
-		ei   int64 = 0
-	)
-
-	rows, err = db.Query(ctx, q, requester.Id, entityId, fileType, deployment)
-
-	if err != nil {
-		return []File{}, total, err
-	}
-
-	defer func() {
-		rows.Close()
-		database.LogPgxStat("IndexFilesForRequesterForTypeForDeployment")
-	}()
-
-	for rows.Next() {
-		var (
-			id           pgtypeuuid.UUID
-			eId          pgtypeuuid.UUID
-			fFileType    string
-			url          string
-			mime         *string
-			size         *int64
-			version      int
-			fDeployment  string
-			fPlatform    string
-			uploadedBy   pgtypeuuid.UUID
-			width        *int
-			height       *int
-			createdAt    pgtype.Timestamp
-			updatedAt    *pgtype.Timestamp
-			index        int
-			hash         *string
-			originalPath *string
-		)
-
-		err = rows.Scan(
-			&id,
-			&eId,
-			&fFileType,
-			&url,
-			&mime,
-			&size,
-			&version,
-			&fDeployment,
-			&fPlatform,
-			&uploadedBy,
-			&width,
-			&height,
-			&createdAt,
-			&updatedAt,
-			&index,
-			&hash,
-			&originalPath,
-		)
-		if err != nil {
-			return nil, -1, err
-		}
-
-		if ei < offset {
-			ei++
-			continue
-		}
-
-		if ei-offset >= limit {
-			break
-		}
-
-		var e File
-		e.Id = &id.UUID
-		e.EntityId = &eId.UUID
-		e.Type = fFileType
-		e.Url = url
-		e.Mime = mime
-		e.Size = size
-		e.Version = version
-		e.Deployment = fDeployment
-		e.Platform = fPlatform
-		e.Index = index
-		e.Hash = hash
-		e.OriginalPath = originalPath
-		if uploadedBy.Status == pgtype.Present {
-			e.UploadedBy = &uploadedBy.UUID
-		}
-		e.Width = width
-		e.Height = height
-		e.CreatedAt = createdAt.Time
-		if updatedAt != nil {
-			e.UpdatedAt = &updatedAt.Time
-		}
-
-		entities = append(entities, e)
-		ei++
-	}
-
-	return entities, total, err
-}
-
-// IndexFilesForRequesterForTypeForPlatform Index packages for Requester
-func IndexFilesForRequesterForTypeForPlatform(ctx context.Context, requester *sm.User, entityId uuid.UUID, offset int64, limit int64, fileType string, platform string) (entities []File, total int64, err error) {
-	db := database.DB
-
-	//region Total
-	q := `SELECT COUNT(*) FROM files f 
-    LEFT JOIN entities e ON e.id = f.entity_id 
-    LEFT JOIN accessibles a ON e.id = a.entity_id AND a.user_id = $1::uuid 
-WHERE e.id = $2 AND (e.public OR a.can_view OR a.is_owner) AND f.type = $3 AND f.platform = $4`
-
-	row := db.QueryRow(ctx, q, requester.Id /*$1*/, entityId /*$2*/, fileType, platform)
-
-	err = row.Scan(&total)
-	if err != nil {
-		return nil, -1, err
-	}
-	//endregion
-
-	if total == 0 {
-		return []File{}, total, nil
-	}
-
-	q = `SELECT
-f.id fileId,
-f.entity_id fileEntityId,
-f.type fileType,
-f.url fileUrl,
-f.mime fileMime,
-f.size fileSize,
-f.version fileVersion,
-f.deployment_type fileDeployment,
-f.platform filePlatform,
-f.uploaded_by fileUploadedBy,
-f.width fileWidth,
-f.height fileHeight,
-f.created_at fileCreatedAt,
-f.updated_at fileUpdatedAt,
-f.variation fileIndex,
-f.hash fileHash,
-f.original_path fileOriginalPath
-FROM files f
-	LEFT JOIN entities e on e.id = f.entity_id
-	LEFT JOIN accessibles a ON e.id = a.entity_id AND a.user_id = $1::uuid
-	WHERE f.entity_id = $2 AND (e.public OR a.can_view OR a.is_owner) AND f.type = $3 AND f.platform = $4
-ORDER BY e.updated_at DESC, e.created_at DESC, e.id`
-
-	var (
-		rows pgx.Rows
-		ei   int64 = 0
-	)
-
-	rows, err = db.Query(ctx, q, requester.Id, entityId, fileType, platform)
-
-	if err != nil {
-		return []File{}, total, err
-	}
-
-	defer func() {
-		rows.Close()
-		database.LogPgxStat("IndexFilesForRequesterForTypeForPlatform")
-	}()
-
-	for rows.Next() {
-		var (
-			id           pgtypeuuid.UUID
-			eId          pgtypeuuid.UUID
-			fFileType    string
-			url          string
-			mime         *string
-			size         *int64
-			version      int
-			fDeployment  string
-			fPlatform    string
-			uploadedBy   pgtypeuuid.UUID
-			width        *int
-			height       *int
-			createdAt    pgtype.Timestamp
-			updatedAt    *pgtype.Timestamp
-			index        int
-			hash         *string
-			originalPath *string
-		)
-
-		err = rows.Scan(
-			&id,
-			&eId,
-			&fFileType,
-			&url,
-			&mime,
-			&size,
-			&version,
-			&fDeployment,
-			&fPlatform,
-			&uploadedBy,
-			&width,
-			&height,
-			&createdAt,
-			&updatedAt,
-			&index,
-			&hash,
-			&originalPath,
-		)
-		if err != nil {
-			return nil, -1, err
-		}
-
-		if ei < offset {
-			ei++
-			continue
-		}
-
-		if ei-offset >= limit {
-			break
-		}
-
-		var e File
-		e.Id = &id.UUID
-		e.EntityId = &eId.UUID
-		e.Type = fFileType
-		e.Url = url
-		e.Mime = mime
-		e.Size = size
-		e.Version = version
-		e.Deployment = fDeployment
-		e.Platform = fPlatform
-		e.Index = index
-		e.Hash = hash
-		e.OriginalPath = originalPath
-		if uploadedBy.Status == pgtype.Present {
-			e.UploadedBy = &uploadedBy.UUID
-		}
-		e.Width = width
-		e.Height = height
-		e.CreatedAt = createdAt.Time
-		if updatedAt != nil {
-			e.UpdatedAt = &updatedAt.Time
-		}
-
-		entities = append(entities, e)
-		ei++
-	}
-
-	return entities, total, err
-}
-
-// IndexFilesForRequesterForTypeForPlatformForDeployment Index packages for Requester
-func IndexFilesForRequesterForTypeForPlatformForDeployment(ctx context.Context, requester *sm.User, entityId uuid.UUID, offset int64, limit int64, fileType string, platform string, deployment string) (entities []File, total int64, err error) {
-	db := database.DB
-
-	//region Total
-	q := `SELECT COUNT(*) FROM files f 
-    LEFT JOIN entities e ON e.id = f.entity_id 
-    LEFT JOIN accessibles a ON e.id = a.entity_id AND a.user_id = $1::uuid 
-WHERE e.id = $2 AND (e.public OR a.can_view OR a.is_owner) AND f.type = $3 AND f.platform = $4 AND f.deployment_type = $5`
-
-	row := db.QueryRow(ctx, q, requester.Id, entityId, fileType, platform, deployment)
-
-	err = row.Scan(&total)
-	if err != nil {
-		return nil, -1, err
-	}
-	//endregion
-
-	if total == 0 {
-		return []File{}, total, nil
-	}
-
-	q = `SELECT
-f.id fileId,
-f.entity_id fileEntityId,
-f.type fileType,
-f.url fileUrl,
-f.mime fileMime,
-f.size fileSize,
-f.version fileVersion,
-f.deployment_type fileDeployment,
-f.platform filePlatform,
-f.uploaded_by fileUploadedBy,
-f.width fileWidth,
-f.height fileHeight,
-f.created_at fileCreatedAt,
-f.updated_at fileUpdatedAt,
-f.variation fileIndex,
-f.hash fileHash,
-f.original_path fileOriginalPath
-FROM files f
-	LEFT JOIN entities e on e.id = f.entity_id
-	LEFT JOIN accessibles a ON e.id = a.entity_id AND a.user_id = $1::uuid
-WHERE f.entity_id = $2 AND (e.public OR a.can_view OR a.is_owner) AND f.type = $3 AND f.platform = $4 AND f.deployment_type = $5
-ORDER BY e.updated_at DESC, e.created_at DESC, e.id`
-
-	var (
-		rows pgx.Rows
-		ei   int64 = 0
-	)
-
-	rows, err = db.Query(ctx, q, requester.Id, entityId, fileType, platform, deployment)
-
-	if err != nil {
-		return []File{}, total, err
-	}
-
-	defer func() {
-		rows.Close()
-		database.LogPgxStat("IndexFilesForRequesterForTypeForPlatformForDeployment")
-	}()
-
-	for rows.Next() {
-		var (
-			id           pgtypeuuid.UUID
-			eId          pgtypeuuid.UUID
-			fFileType    string
-			url          string
-			mime         *string
-			size         *int64
-			version      int
-			fDeployment  string
-			fPlatform    string
-			uploadedBy   pgtypeuuid.UUID
-			width        *int
-			height       *int
-			createdAt    pgtype.Timestamp
-			updatedAt    *pgtype.Timestamp
-			index        int
-			hash         *string
-			originalPath *string
-		)
-
-		err = rows.Scan(
-			&id,
-			&eId,
-			&fFileType,
-			&url,
-			&mime,
-			&size,
-			&version,
-			&fDeployment,
-			&fPlatform,
-			&uploadedBy,
-			&width,
-			&height,
-			&createdAt,
-			&updatedAt,
-			&index,
-			&hash,
-			&originalPath,
-		)
-		if err != nil {
-			return nil, -1, err
-		}
-
-		if ei < offset {
-			ei++
-			continue
-		}
-
-		if ei-offset >= limit {
-			break
-		}
-
-		var e File
-		e.Id = &id.UUID
-		e.EntityId = &eId.UUID
-		e.Type = fFileType
-		e.Url = url
-		e.Mime = mime
-		e.Size = size
-		e.Version = version
-		e.Deployment = fDeployment
-		e.Platform = fPlatform
-		e.Index = index
-		e.Hash = hash
-		e.OriginalPath = originalPath
-		if uploadedBy.Status == pgtype.Present {
-			e.UploadedBy = &uploadedBy.UUID
-		}
-		e.Width = width
-		e.Height = height
-		e.CreatedAt = createdAt.Time
-		if updatedAt != nil {
-			e.UpdatedAt = &updatedAt.Time
-		}
-
-		entities = append(entities, e)
-		ei++
-	}
-
-	return entities, total, err
-}
-
-func UploadFileForAdmin(c *fiber.Ctx, requester *sm.User, entityId uuid.UUID, m FileUploadRequestMetadata) (fileId uuid.UUID, err error) {
-	db := database.DB
-	ctx := c.UserContext()
-
-	var (
-		q        string                // query string
-		tx       pgx.Tx                // pgx transaction
-		row      pgx.Row               // pgx row
-		fId      pgtypeuuid.UUID       // id of the file from the db
-		fVersion int64                 // file version from the db
-		id       uuid.UUID             // file id to use
-		formFile *multipart.FileHeader // uploaded file
-		buffer   multipart.File        // uploaded file contents
-		mime     string                // MIME type to use
-		pMIME    *mimetype.MIME        // auto-detected MIME type
-	)
-
-	if PlatformDependentFileTypes[m.Type] {
-		if m.Deployment == "" {
-			err = fmt.Errorf("file requires a deployment configuration")
-			return uuid.UUID{}, err
-		}
-
-		if m.Platform == "" {
-			err = fmt.Errorf("file requires a platform")
-			return uuid.UUID{}, err
-		}
-	}
-
-	// Try to find existing file with same properties
-	q = `SELECT f.id, f.version
-FROM files AS f
-WHERE f.entity_id = $1
-  AND f.type = $2
-  AND f.deployment_type = $3
-  AND f.platform = $4
-  AND f.variation = $5
-  AND f.original_path = $6`
-
-	row = db.QueryRow(ctx, q, entityId, m.Type, m.Deployment, m.Platform, m.Index, m.OriginalPath)
-
-	logrus.Infof("uploading file, entityId: %v, type: %v, deployment: %v, platform: %v, index: %v, originalPath: %v", entityId, m.Type, m.Deployment, m.Platform, m.Index, m.OriginalPath)
-
-	err = row.Scan(&fId, &fVersion)
-	if err != nil && err.Error() == "no rows in result set" {
-		logrus.Infof("inserting a new file")
-
-		//region Insert a new file
-		tx, err = db.Begin(ctx)
-		if err != nil {
-			return uuid.UUID{}, err // failed to initiate tx
-		}
-
-		//region Process multipart form uploaded file
-
-		// Get upload file
-		formFile, err = c.FormFile("file")
-		if err != nil {
-			_ = tx.Rollback(ctx)
-			return uuid.UUID{}, err
-		}
-
-		// Get upload file buffer
-		buffer, err = formFile.Open()
-		if err != nil {
-			_ = tx.Rollback(ctx)
-			return uuid.UUID{}, err
-		}
-		defer func(buffer multipart.File) {
-			err := buffer.Close()
-			if err != nil {
-				logrus.Errorf("failed to close multipart file buffer: %v", err)
-			}
-		}(buffer)
-		//endregion
-
-		//region Determine MIME type
-		if m.Mime != nil && *m.Mime != "" {
-			// Use explicitly specified MIME type
-			mime = *m.Mime
-		} else {
-			// Seek back to the start of the file
-			_, err = buffer.Seek(0, io.SeekStart)
-			if err != nil {
-				return uuid.UUID{}, err
-			}
-
-			// Try to detect MIME
-			pMIME, _ = mimetype.DetectReader(buffer)
-			mime = pMIME.String()
-
-			// Seek back to the start of the file
-			_, err = buffer.Seek(0, io.SeekStart)
-			if err != nil {
-				return uuid.UUID{}, err
-			}
-		}
-		//endregion
-
-		//region S3 Object data
-
-		// Generate a new uuid for the file
-		id, err = uuid.NewV4()
-		if err != nil {
-			return uuid.UUID{}, err
-		}
-
-		// Get url and the key for the entity file
-		url := s3.GetS3UrlForEntityFile(entityId, id)
-		key := s3.GetS3KeyForEntityFile(entityId, id)
-
-		//endregion
-
-		//region Add a new file metadata record and upload the Object to S3
-
-		q = `INSERT INTO files AS f (id, entity_id, url, type, mime, size, version, deployment_type, platform, uploaded_by, width, height, created_at, updated_at, variation, original_path, hash)
-			VALUES ($1::uuid, $2::uuid, $3::text, $4::text, $5::text, $6::bigint, $7::bigint, $8::text, $9::text, $10::uuid, $11::integer, $12::integer, now(), null, $13::bigint, $14::text, $15::text)`
-		_, err = tx.Exec(ctx, q, id, entityId, url, m.Type, mime, formFile.Size, m.Version, m.Deployment, m.Platform, requester.Id, m.Width, m.Height, m.Index, m.OriginalPath, m.Hash)
-		if err != nil {
-			_ = tx.Rollback(ctx)
-			return uuid.UUID{}, err
-		}
-
-		var public = true
-		if m.Type == "uplugin_content" || m.Type == "uplugin" {
-			// Protect source files
-			public = false
-		}
-
-		if m.Type == "uplugin_content" {
-			// Send the job status email to the requester
-			if err = SendPackageJobStatusEmail(c, requester, entityId, "unclaimed"); err != nil {
-				logrus.Errorf("failed to send job status email: %v", err)
-			}
-
-			if err = st.SendTelegramMessage(fmt.Sprintf("Creating a new job for %s", entityId)); err != nil {
-				logrus.Errorf("failed to send a job status telegram message: %v", err)
-			}
-
-			// Schedule package jobs
-			if err = CreatePackageJobs(c, requester, entityId); err != nil {
-				logrus.Errorf("failed to create package jobs: %v", err)
-			}
-
-			// deprecated
-			if err = ScheduleBuildJobsForPackage(c, requester, entityId); err != nil {
-				fmt.Printf("failed to schedule a build jobs: %s", err.Error())
-			}
-		}
-
-		metadata := map[string]string{
-			"version":      strconv.FormatInt(m.Version, 10),
-			"index":        strconv.FormatInt(m.Index, 10),
-			"type":         m.Type,
-			"originalPath": m.OriginalPath,
-		}
-
-		if m.Deployment != "" {
-			metadata["deployment"] = m.Deployment
-		}
-
-		if m.Platform != "" {
-			metadata["platform"] = m.Platform
-		}
-
-		err = s3.UploadObject(key, buffer, mime, public, &metadata, nil)
-		if err != nil {
-			_ = tx.Rollback(ctx)
-			return uuid.UUID{}, err
-		}
-
-		//endregion
-
-		err = tx.Commit(ctx)
-		if err == nil {
-			if m.Type == "pak" {
-				// Deprecated
-				if err = NotifyBuildJobCompleted(c, entityId); err != nil {
-					fmt.Printf("failed to notify job complete: %s", err.Error())
-				}
-			}
-		}
-
-		return id, err
-
-		//endregion
-
-	} else if err == nil {
-		logrus.Infof("replacing an existing file")
-
-		//region Replace an existing file
-
-		tx, err = db.Begin(ctx)
-		if err != nil {
-			return uuid.UUID{}, err
-		}
-
-		//region Process multipart form uploaded file
-
-		// Get upload file
-		formFile, err = c.FormFile("file")
-		if err != nil {
-			_ = tx.Rollback(ctx)
-			return uuid.UUID{}, err
-		}
-
-		// Get upload file buffer
-		buffer, err = formFile.Open()
-		if err != nil {
-			_ = tx.Rollback(ctx)
-			return uuid.UUID{}, err
-		}
-		defer func(buffer multipart.File) {
-			err := buffer.Close()
-			if err != nil {
-				logrus.Errorf("error closing multipart file: %v", err)
-			}
-		}(buffer)
-		//endregion
-
-		//region Determine MIME type
-		if m.Mime != nil && *m.Mime != "" {
-			// Use explicitly specified MIME type
-			mime = *m.Mime
-		} else {
-			// Seek back to the start of the file
-			_, err = buffer.Seek(0, io.SeekStart)
-			if err != nil {
-				return uuid.UUID{}, err
-			}
-
-			// Try to detect MIME
-			pMIME, _ = mimetype.DetectReader(buffer)
-			mime = pMIME.String()
-
-			// Seek back to the start of the file
-			_, err = buffer.Seek(0, io.SeekStart)
-			if err != nil {
-				return uuid.UUID{}, err
-			}
-		}
-		//endregion
-
-		//region S3 Object data
-
-		// Generate a new uuid for the file
-		id, err = uuid.NewV4()
-
-		// Get url and the key for the entity file
-		url := s3.GetS3UrlForEntityFile(entityId, id)
-		previousKey := s3.GetS3KeyForEntityFile(entityId, fId.UUID)
-		newKey := s3.GetS3KeyForEntityFile(entityId, id)
-
-		//endregion
-
-		//region Remove old file metadata record and S3 object
-
-		// Delete the old file record
-		q = `DELETE FROM files f WHERE f.id = $1`
-		_, err = tx.Exec(ctx, q, fId.UUID)
-		if err != nil {
-			_ = tx.Rollback(ctx)
-			return uuid.UUID{}, err
-		}
-
-		// Delete the old object
-		exists := s3.ObjectExists(previousKey)
-		if exists {
-			err = s3.DeleteObject(previousKey)
-			if err != nil {
-				_ = tx.Rollback(ctx)
-				return uuid.UUID{}, err
-			}
-		}
-
-		//endregion
-
-		//region Add a new file metadata record and upload the object to S3
-
-		fVersion++
-
-		// Add a new file record
-		q = `INSERT INTO files AS f (id, entity_id, url, type, mime, size, version, deployment_type, platform, uploaded_by, width, height, created_at, updated_at, variation, original_path, hash)
-			VALUES ($1::uuid, $2::uuid, $3::text, $4::text, $5::text, $6::bigint, $7::bigint, $8::text, $9::text, $10::uuid, $11::integer, $12::integer, now(), null, $13::bigint, $14::text, $15::text)`
-		_, err = tx.Exec(ctx, q, id, entityId, url, m.Type, mime, formFile.Size, fVersion, m.Deployment, m.Platform, requester.Id, m.Width, m.Height, m.Index, m.OriginalPath, m.Hash)
-		if err != nil {
-			_ = tx.Rollback(ctx)
-			return uuid.UUID{}, err
-		}
-
-		var public = true
-		if m.Type == "uplugin_content" || m.Type == "uplugin" {
-			// Protect source files
-			public = false
-		}
-
-		if m.Type == "uplugin_content" {
-			// Send the job status email to the requester
-			if err = SendPackageJobStatusEmail(c, requester, entityId, "unclaimed"); err != nil {
-				logrus.Errorf("failed to send a job status email: %v", err)
-			}
-
-			if err = st.SendTelegramMessage(fmt.Sprintf("Creating a new job for %s", entityId)); err != nil {
-				logrus.Errorf("failed to send a telegram message: %v", err)
-			}
-
-			// Schedule package jobs
-			if err = CreatePackageJobs(c, requester, entityId); err != nil {
-				logrus.Errorf("failed to create package jobs: %v", err)
-			}
-
-			// deprecated
-			if err = ScheduleBuildJobsForPackage(c, requester, entityId); err != nil {
-				fmt.Printf("failed to schedule a build jobs: %s", err.Error())
-			}
-		}
-
-		metadata := map[string]string{
-			"version":      strconv.FormatInt(fVersion, 10),
-			"index":        strconv.FormatInt(m.Index, 10),
-			"type":         m.Type,
-			"originalPath": m.OriginalPath,
-		}
-
-		if m.Deployment != "" {
-			metadata["deployment"] = m.Deployment
-		}
-
-		if m.Platform != "" {
-			metadata["platform"] = m.Platform
-		}
-
-		// Upload the new Object
-		err = s3.UploadObject(newKey, buffer, mime, public, &metadata, nil)
-		if err != nil {
-			_ = tx.Rollback(ctx)
-			return uuid.UUID{}, err
-		}
-
-		//endregion
-
-		err = tx.Commit(ctx)
-		if err == nil {
-			if m.Type == "pak" {
-				if err = NotifyBuildJobCompleted(c, entityId); err != nil {
-					fmt.Printf("failed to notify job complete: %s", err.Error())
-				}
-			}
-		}
-
-		return id, err
-
-		//endregion
-	}
-
-	return uuid.UUID{}, err
-}
-
-func UploadFileForRequester(c *fiber.Ctx, requester *sm.User, entityId uuid.UUID, m FileUploadRequestMetadata) (fileId uuid.UUID, err error) {
-	db := database.DB
-	ctx := c.UserContext()
-
-	var (
-		q        string                // query string
-		tx       pgx.Tx                // pgx transaction
-		row      pgx.Row               // pgx row
-		fId      pgtypeuuid.UUID       // id of the file from the db
-		fVersion int64                 // file version from the db
-		id       uuid.UUID             // file id to use
-		formFile *multipart.FileHeader // uploaded file
-		buffer   multipart.File        // uploaded file contents
-		mime     string                // MIME type to use
-		pMIME    *mimetype.MIME        // auto-detected MIME type
-		isOwner  bool
-		canEdit  bool
-	)
-
-	if m.Type == "pak" || m.Type == "release-archive" {
-		if m.Deployment == "" {
-			err = fmt.Errorf("pak file has no deployment configuration set")
-			return uuid.UUID{}, err
-		}
-
-		if m.Platform == "" {
-			err = fmt.Errorf("pak file has no platform set")
-			return uuid.UUID{}, err
-		}
-	} else {
-		m.Deployment = ""
-		m.Platform = ""
-	}
-
-	// Try to find existing file with same properties
-	q = `SELECT f.id,
-       f.version,
-       a.is_owner,
-	   a.can_edit
-FROM files AS f
-	LEFT JOIN entities e on f.entity_id = e.id
-	LEFT JOIN accessibles a on e.id = a.entity_id AND a.user_id = $1::uuid
-WHERE f.entity_id = $2
-  AND f.type = $3
-  AND f.deployment_type = $4
-  AND f.platform = $5
-  AND f.variation = $6
-  AND f.original_path = $7`
-
-	row = db.QueryRow(ctx, q, requester.Id, entityId, m.Type, m.Deployment, m.Platform, m.Index, m.OriginalPath)
-
-	err = row.Scan(&fId, &fVersion, &isOwner, &canEdit)
-	if err != nil && err.Error() == "no rows in result set" {
-		// Check entity access
-		q = `SELECT a.is_owner, a.can_edit FROM entities e LEFT JOIN accessibles a on e.id = a.entity_id AND a.user_id = $1::uuid WHERE e.id = $2`
-		row = db.QueryRow(ctx, q, requester.Id, entityId)
-		err = row.Scan(&isOwner, &canEdit)
-
-		if !(isOwner || canEdit) {
-			return uuid.UUID{}, errors.New("no access")
-		}
-
-		//region Insert a new file
-		tx, err = db.Begin(ctx)
-		if err != nil {
-			return uuid.UUID{}, err // failed to initiate tx
-		}
-
-		//region Process multipart form uploaded file
-
-		// Get upload file
-		formFile, err = c.FormFile("file")
-		if err != nil {
-			_ = tx.Rollback(ctx)
-			return uuid.UUID{}, err
-		}
-
-		// Get upload file buffer
-		buffer, err = formFile.Open()
-		if err != nil {
-			_ = tx.Rollback(ctx)
-			return uuid.UUID{}, err
-		}
-		defer func(buffer multipart.File) {
-			err := buffer.Close()
-			if err != nil {
-				logrus.Errorf("failed to close multipart file buffer: %v", err)
-			}
-		}(buffer)
-		//endregion
-
-		//region Determine MIME type
-		if m.Mime != nil && *m.Mime != "" {
-			// Use explicitly specified MIME type
-			mime = *m.Mime
-		} else {
-			// Seek back to the start of the file
-			_, err = buffer.Seek(0, io.SeekStart)
-			if err != nil {
-				return uuid.UUID{}, err
-			}
-
-			// Try to detect MIME
-			pMIME, _ = mimetype.DetectReader(buffer)
-			mime = pMIME.String()
-
-			// Seek back to the start of the file
-			_, err = buffer.Seek(0, io.SeekStart)
-			if err != nil {
-				return uuid.UUID{}, err
-			}
-		}
-		//endregion
-
-		//region S3 Object data
-
-		// Generate a new uuid for the file
-		id, err = uuid.NewV4()
-		if err != nil {
-			return uuid.UUID{}, err
-		}
-
-		// Get url and the key for the entity file
-		url := s3.GetS3UrlForEntityFile(entityId, id)
-		key := s3.GetS3KeyForEntityFile(entityId, id)
-
-		//endregion
-
-		//region Upload the Object to S3
-
-		var public = true
-		if m.Type == "uplugin_content" || m.Type == "uplugin" {
-			// Protect source files
-			public = false
-		}
-
-		metadata := map[string]string{
-			"version": strconv.FormatInt(m.Version, 10),
-			"index":   strconv.FormatInt(m.Index, 10),
-			"type":    m.Type,
-		}
-
-		if m.Deployment != "" {
-			metadata["deployment"] = m.Deployment
-		}
-
-		if m.Platform != "" {
-			metadata["platform"] = m.Platform
-		}
-
-		err = s3.UploadObject(key, buffer, mime, public, &metadata, nil)
-		if err != nil {
-			_ = tx.Rollback(ctx)
-			return uuid.UUID{}, err
-		}
-
-		//endregion
-
-		//region Add a file record
-		q = `INSERT INTO files AS f (id, entity_id, url, type, mime, size, version, deployment_type, platform, uploaded_by, width, height, created_at, updated_at, variation, original_path, hash)
-			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, now(), null, $13, $14, $15)`
-		_, err = tx.Exec(ctx, q, id, entityId, url, m.Type, mime, formFile.Size, m.Version, m.Deployment, m.Platform, requester.Id, m.Width, m.Height, m.Index, m.OriginalPath, m.Hash)
-		if err != nil {
-			_ = tx.Rollback(ctx)
-			return uuid.UUID{}, err
-		}
-
-		err = tx.Commit(ctx)
-		if err == nil {
-			if m.Type == "pak" {
-				if err = NotifyBuildJobCompleted(c, entityId); err != nil {
-					fmt.Printf("failed to notify job complete: %s", err.Error())
-				}
-			}
-		}
-
-		return id, err
-		//endregion
-
-		//endregion
-	} else if err == nil {
-		if !isOwner || !canEdit {
-			return uuid.UUID{}, errors.New("no access")
-		}
-
-		//region Replace an existing file
-		fVersion++
-
-		tx, err = db.Begin(ctx)
-		if err != nil {
-			return uuid.UUID{}, err
-		}
-
-		//region Process multipart form uploaded file
-
-		// Get upload file
-		formFile, err = c.FormFile("file")
-		if err != nil {
-			_ = tx.Rollback(ctx)
-			return uuid.UUID{}, err
-		}
-
-		// Get upload file buffer
-		buffer, err = formFile.Open()
-		if err != nil {
-			_ = tx.Rollback(ctx)
-			return uuid.UUID{}, err
-		}
-		defer func(buffer multipart.File) {
-			err := buffer.Close()
-			if err != nil {
-				logrus.Errorf("failed to close multipart file buffer: %v", err)
-			}
-		}(buffer)
-		//endregion
-
-		//region Determine MIME type
-		if m.Mime != nil && *m.Mime != "" {
-			// Use explicitly specified MIME type
-			mime = *m.Mime
-		} else {
-			// Seek back to the start of the file
-			_, err = buffer.Seek(0, io.SeekStart)
-			if err != nil {
-				return uuid.UUID{}, err
-			}
-
-			// Try to detect MIME
-			pMIME, _ = mimetype.DetectReader(buffer)
-			mime = pMIME.String()
-
-			// Seek back to the start of the file
-			_, err = buffer.Seek(0, io.SeekStart)
-			if err != nil {
-				return uuid.UUID{}, err
-			}
-		}
-		//endregion
-
-		//region S3 Object data
-
-		// Generate a new uuid for the file
-		id, err = uuid.NewV4()
-
-		// Get url and the key for the entity file
-		url := s3.GetS3UrlForEntityFile(entityId, id)
-		previousKey := s3.GetS3KeyForEntityFile(entityId, fId.UUID)
-		newKey := s3.GetS3KeyForEntityFile(entityId, id)
-
-		//endregion
-
-		//region Upload the Object to S3
-
-		// Delete the old Object
-
-		exists := s3.ObjectExists(previousKey)
-		if exists {
-			err = s3.DeleteObject(previousKey)
-			if err != nil {
-				_ = tx.Rollback(ctx)
-				return uuid.UUID{}, err
-			}
-		}
-
-		var public = true
-		if strings.HasPrefix(m.Type, "uplugin") {
-			// Protect package source files
-			public = false
-		}
-
-		metadata := map[string]string{
-			"version": strconv.FormatInt(fVersion, 10),
-			"index":   strconv.FormatInt(m.Index, 10),
-			"type":    m.Type,
-		}
-
-		if m.Deployment != "" {
-			metadata["deployment"] = m.Deployment
-		}
-
-		if m.Platform != "" {
-			metadata["platform"] = m.Platform
-		}
-
-		// Upload the new Object
-		err = s3.UploadObject(newKey, buffer, mime, public, &metadata, nil)
-		if err != nil {
-			_ = tx.Rollback(ctx)
-			return uuid.UUID{}, err
-		}
-
-		//endregion
-
-		//region Update a file record
-		_, err = tx.Exec(ctx, "SET CONSTRAINTS files_pkey DEFERRED")
-		if err != nil {
-			_ = tx.Rollback(ctx)
-			return uuid.UUID{}, err
-		}
-
-		q = `UPDATE files f
-SET id=$1,
-    url=$2,
-    mime=$3,
-    size=$4,
-    version=$5,
-    uploaded_by=$6,
-    width=$7,
-    height=$8,
-    updated_at=now(),
-    original_path=$14
-WHERE f.entity_id = $9
-  AND f.type = $10
-  AND f.deployment_type = $11
-  AND f.platform = $12
-  AND f.variation = $13`
-		_, err = tx.Exec(ctx, q, id, url, mime, formFile.Size, fVersion, requester.Id, m.Width, m.Height, entityId, m.Type, m.Deployment, m.Platform, m.Index, m.OriginalPath)
-		if err != nil {
-			_ = tx.Rollback(ctx)
-			return uuid.UUID{}, err
-		}
-
-		err = tx.Commit(ctx)
-		if err == nil {
-			if m.Type == "pak" {
-				if err = NotifyBuildJobCompleted(c, entityId); err != nil {
-					fmt.Printf("failed to notify job complete: %s", err.Error())
-				}
-			}
-		}
-
-		return id, err
-		//endregion
-
-		//endregion
-	}
-
-	return uuid.UUID{}, err
-}
-
-func UploadResizedImageForAdmin(c *fiber.Ctx, requester *sm.User, entityId uuid.UUID, m FileUploadRequestMetadata, uploadImageType UploadImageType) (fileId uuid.UUID, err error) {
-	db := database.DB
-	ctx := c.UserContext()
-
-	var (
-		q         string                // query string
-		tx        pgx.Tx                // pgx transaction
-		row       pgx.Row               // pgx row
-		fId       pgtypeuuid.UUID       // id of the file from the db
-		fVersion  int64                 // version of the file from the db
-		id        uuid.UUID             // file id to use
-		formFile  *multipart.FileHeader // uploaded file
-		buffer    multipart.File        // uploaded file contents
-		mime      string                // MIME type to use
-		pMIME     *mimetype.MIME        // auto-detected MIME type
-		imageType string                // image type to use
-	)
-
-	switch uploadImageType {
-	case ImagePreview:
-		imageType = "image_preview"
-	case ImageTexture:
-		imageType = "texture_diffuse"
-	default:
-		imageType = "image_full"
-	}
-
-	// Try to find existing file with same properties
-	q = `SELECT id, version
-FROM files AS f
-WHERE f.entity_id = $1
-  AND f.type = $2
-  AND f.deployment_type = $3
-  AND f.platform = $4
-  AND f.variation = $5`
-
-	row = db.QueryRow(ctx, q, entityId, imageType, m.Deployment, m.Platform, m.Index)
-
-	err = row.Scan(&fId, &fVersion)
-	if err != nil && err.Error() == "no rows in result set" {
-		//region Insert a new file
-		tx, err = db.Begin(ctx)
-		if err != nil {
-			return uuid.UUID{}, err // failed to initiate tx
-		}
-
-		//region Process multipart form uploaded file
-
-		// Get upload file
-		formFile, err = c.FormFile("file")
-		if err != nil {
-			_ = tx.Rollback(ctx)
-			return uuid.UUID{}, err
-		}
-
-		// Get upload file buffer
-		buffer, err = formFile.Open()
-		if err != nil {
-			_ = tx.Rollback(ctx)
-			return uuid.UUID{}, err
-		}
-		defer func(buffer multipart.File) {
-			err := buffer.Close()
-			if err != nil {
-				logrus.Errorf("failed to close multipart file buffer: %v", err)
-			}
-		}(buffer)
-		//endregion
-
-		//region Determine MIME type
-		if m.Mime != nil && *m.Mime != "" {
-			// Use explicitly specified MIME type
-			mime = *m.Mime
-		} else {
-			// Seek back to the start of the file
-			_, err = buffer.Seek(0, io.SeekStart)
-			if err != nil {
-				_ = tx.Rollback(ctx)
-				return uuid.UUID{}, err
-			}
-
-			// Try to detect MIME
-			pMIME, _ = mimetype.DetectReader(buffer)
-			mime = pMIME.String()
-
-			// Seek back to the start of the file
-			_, err = buffer.Seek(0, io.SeekStart)
-			if err != nil {
-				_ = tx.Rollback(ctx)
-				return uuid.UUID{}, err
-			}
-		}
-
-		var (
-			resizedImageBuffer bytes.Buffer
-			originalImage      image.Image
-			newImage           image.Image
-		)
-
-		if mime == "image/jpeg" {
-			// Decode to bitmap
-			originalImage, err = jpeg.Decode(buffer)
-			if err != nil {
-				_ = tx.Rollback(ctx)
-				return uuid.UUID{}, err
-			}
-
-			if uploadImageType == ImagePreview {
-				// Resize to generate preview
-				newImage = resize.Resize(256, 0, originalImage, resize.Lanczos3)
-			} else if uploadImageType == ImageTexture {
-				w := uint(originalImage.Bounds().Size().X)
-				h := uint(originalImage.Bounds().Size().Y)
-				newImage = resize.Resize(nextPowerOfTwo(w), nextPowerOfTwo(h), originalImage, resize.Lanczos3)
-			}
-
-			// Encode back to JPEG
-			buf := bufio.NewWriter(&resizedImageBuffer)
-			err = jpeg.Encode(buf, newImage, nil)
-			if err != nil {
-				_ = tx.Rollback(ctx)
-				return uuid.UUID{}, err
-			}
-		} else if mime == "image/png" {
-			// Decode to bitmap
-			originalImage, err = png.Decode(buffer)
-			if err != nil {
-				_ = tx.Rollback(ctx)
-				return uuid.UUID{}, err
-			}
-
-			if uploadImageType == ImagePreview {
-				// Resize to generate preview
-				newImage = resize.Resize(256, 0, originalImage, resize.Lanczos3)
-			} else if uploadImageType == ImageTexture {
-				w := uint(originalImage.Bounds().Size().X)
-				h := uint(originalImage.Bounds().Size().Y)
-				newImage = resize.Resize(nextPowerOfTwo(w), nextPowerOfTwo(h), originalImage, resize.Lanczos3)
-			}
-
-			// Encode back to JPEG
-			buf := bufio.NewWriter(&resizedImageBuffer)
-			err = png.Encode(buf, newImage)
-			if err != nil {
-				_ = tx.Rollback(ctx)
-				return uuid.UUID{}, err
-			}
-		} else {
-			_ = tx.Rollback(ctx)
-			return uuid.UUID{}, errors.New(fmt.Sprintf("unsupported image MIME type: %s", mime))
-		}
-
-		//endregion
-
-		//region S3 Object data
-
-		// Generate a new uuid for the file
-		id, err = uuid.NewV4()
-
-		// Get url and the key for the entity file
-		url := s3.GetS3UrlForEntityFile(entityId, id)
-		key := s3.GetS3KeyForEntityFile(entityId, id)
-
-		//endregion
-
-		//region Upload the Object to S3
+			// deprecated
+			if err = ScheduleBuildJobsForPackage(c, requester, entityId); err != nil {
+				fmt.Printf("failed to schedule a build jobs: %s", err.Error())
+			}
+		}
 
 		metadata := map[string]string{
-			"version": strconv.FormatInt(m.Version, 10),
-			"index":   strconv.FormatInt(m.Index, 10),
-			"type":    imageType,
+			"version":      strconv.FormatInt(m.Version, 10),
+			"index":        strconv.FormatInt(m.Index, 10),
+			"type":         m.Type,
+			"originalPath": m.OriginalPath,
 		}
 
 		if m.Deployment != "" {
@@ -3343,31 +363,46 @@ WHERE f.entity_id = $1
 			metadata["platform"] = m.Platform
 		}
 
-		err = s3.UploadObject(key, bufio.NewReaderSize(&resizedImageBuffer, resizedImageBuffer.Len()), mime, true, &metadata, nil)
+		err = uploadFileObject(ctx, tx, id, m.Type, key, buffer, formFile.Size, mime, public, &metadata)
 		if err != nil {
 			_ = tx.Rollback(ctx)
 			return uuid.UUID{}, err
 		}
 
-		//endregion
+		// Queue image derivatives generation
+		err = enqueueImageDerivatives(ctx, tx, id, m.Type)
+		if err != nil {
+			_ = tx.Rollback(ctx)
+			return uuid.UUID{}, err
+		}
 
-		//region Add a file record
-		q = `INSERT INTO files AS f (id, entity_id, url, type, mime, size, version, deployment_type, platform, uploaded_by, width, height, created_at, updated_at, variation)
-			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, now(), null, $13)`
-		_, err = tx.Exec(ctx, q, id, entityId, url, imageType, mime, formFile.Size, m.Version, m.Deployment, m.Platform, requester.Id, m.Width, m.Height, m.Index)
+		// Queue the malware scan, the file can not be downloaded until it is clean
+		err = enqueueFileScan(ctx, tx, id)
 		if err != nil {
 			_ = tx.Rollback(ctx)
 			return uuid.UUID{}, err
 		}
 
-		return id, tx.Commit(ctx)
 		//endregion
 
+		err = tx.Commit(ctx)
+		if err == nil {
+			if m.Type == "pak" {
+				// Deprecated
+				if err = NotifyBuildJobCompleted(c, entityId); err != nil {
+					fmt.Printf("failed to notify job complete: %s", err.Error())
+				}
+			}
+		}
+
+		return id, err
+
 		//endregion
+
 	} else if err == nil {
-		//region Replace an existing file
+		logrus.Infof("replacing an existing file")
 
-		fVersion++
+		//region Replace an existing file
 
 		tx, err = db.Begin(ctx)
 		if err != nil {
@@ -3392,7 +427,7 @@ WHERE f.entity_id = $1
 		defer func(buffer multipart.File) {
 			err := buffer.Close()
 			if err != nil {
-				logrus.Errorf("failed to close multipart file buffer: %v", err)
+				logrus.Errorf("error closing multipart file: %v", err)
 			}
 		}(buffer)
 		//endregion
@@ -3427,28 +462,94 @@ WHERE f.entity_id = $1
 
 		// Get url and the key for the entity file
 		url := s3.GetS3UrlForEntityFile(entityId, id)
-		previousKey := s3.GetS3KeyForEntityFile(entityId, fId.UUID)
 		newKey := s3.GetS3KeyForEntityFile(entityId, id)
 
 		//endregion
 
-		//region Upload the Object to S3
+		//region Remove old file metadata record and S3 object
+
+		// Keep the old file as a version if the history is enabled for its type
+		var (
+			archived    bool
+			previousUrl string
+		)
+		previousUrl, archived, err = archiveFileVersion(ctx, tx, fId.UUID)
+		if err != nil {
+			_ = tx.Rollback(ctx)
+			return uuid.UUID{}, err
+		}
+
+		// Delete the old file record
+		q = `DELETE FROM files f WHERE f.id = $1`
+		_, err = tx.Exec(ctx, q, fId.UUID)
+		if err != nil {
+			_ = tx.Rollback(ctx)
+			return uuid.UUID{}, err
+		}
+
+		//endregion
+
+		//region Add a new file metadata record and upload the object to S3
+
+		fVersion++
+
+		// Add a new file record
+		q = `INSERT INTO files AS f (id, entity_id, url, type, mime, size, version, deployment_type, platform, uploaded_by, width, height, created_at, updated_at, variation, original_path, hash)
+			VALUES ($1::uuid, $2::uuid, $3::text, $4::text, $5::text, $6::bigint, $7::bigint, $8::text, $9::text, $10::uuid, $11::integer, $12::integer, now(), null, $13::bigint, $14::text, $15::text)`
+		_, err = tx.Exec(ctx, q, id, entityId, url, m.Type, mime, formFile.Size, fVersion, m.Deployment, m.Platform, requester.Id, m.Width, m.Height, m.Index, m.OriginalPath, m.Hash)
+		if err != nil {
+			_ = tx.Rollback(ctx)
+			return uuid.UUID{}, err
+		}
+
+		// Store glTF metadata, assets exceeding the budget of the file type are rejected
+		err = extractFileMetadata(ctx, tx, id, m.Type, mime, m.OriginalPath, buffer, formFile.Size)
+		if err != nil {
+			_ = tx.Rollback(ctx)
+			return uuid.UUID{}, err
+		}
 
-		// Delete the old Object
+		var public = true
+		if m.Type == "uplugin_content" || m.Type == "uplugin" {
+			// Protect source files
+			public = false
+		}
 
-		exists := s3.ObjectExists(previousKey)
-		if exists {
-			err = s3.DeleteObject(previousKey)
+		if public {
+			// Files of private entities are only served by the download proxy
+			public, err = isFileObjectPublic(ctx, entityId)
 			if err != nil {
 				_ = tx.Rollback(ctx)
 				return uuid.UUID{}, err
 			}
 		}
 
+		if m.Type == "uplugin_content" {
+			// Send the job status email to the requester
+			if err = SendPackageJobStatusEmail(c, requester, entityId, "unclaimed"); err != nil {
+				logrus.Errorf("failed to send a job status email: %v", err)
+			}
+
+			if err = st.SendTelegramMessage(fmt.Sprintf("Creating a new job for %s", entityId)); err != nil {
+				logrus.Errorf("failed to send a telegram message: %v", err)
+			}
+
+			// Schedule package jobs
+			if err = CreatePackageJobs(c, requester, entityId); err != nil {
+				logrus.Errorf("failed to create package jobs: %v", err)
+			}
+
+			// deprecated
+			if err = ScheduleBuildJobsForPackage(c, requester, entityId); err != nil {
+				fmt.Printf("failed to schedule a build jobs: %s", err.Error())
+			}
+		}
+
 		metadata := map[string]string{
-			"version": strconv.FormatInt(fVersion, 10),
-			"index":   strconv.FormatInt(m.Index, 10),
-			"type":    imageType,
+			"version":      strconv.FormatInt(fVersion, 10),
+			"index":        strconv.FormatInt(m.Index, 10),
+			"type":         m.Type,
+			"originalPath": m.OriginalPath,
 		}
 
 		if m.Deployment != "" {
@@ -3460,77 +561,87 @@ WHERE f.entity_id = $1
 		}
 
 		// Upload the new Object
-		err = s3.UploadObject(newKey, buffer, mime, true, &metadata, nil)
+		err = uploadFileObject(ctx, tx, id, m.Type, newKey, buffer, formFile.Size, mime, public, &metadata)
 		if err != nil {
 			_ = tx.Rollback(ctx)
 			return uuid.UUID{}, err
 		}
 
-		//endregion
+		// Queue image derivatives generation
+		err = enqueueImageDerivatives(ctx, tx, id, m.Type)
+		if err != nil {
+			_ = tx.Rollback(ctx)
+			return uuid.UUID{}, err
+		}
 
-		//region Update a file record
-		q = `UPDATE files f
-SET id=$1,
-    url=$2,
-    mime=$3,
-    size=$4,
-    version=(f.version + 1),
-    uploaded_by=$5,
-    width=$6,
-    height=$7,
-    updated_at=now()
-WHERE f.entity_id = $8
-  AND f.type = $9
-  AND f.deployment_type = $10
-  AND f.platform = $11
-  AND f.variation = $12`
-		_, err = tx.Exec(ctx, q, id, url, mime, formFile.Size, requester.Id, m.Width, m.Height, entityId, imageType, m.Deployment, m.Platform, m.Index)
+		// Queue the malware scan, the file can not be downloaded until it is clean
+		err = enqueueFileScan(ctx, tx, id)
 		if err != nil {
 			_ = tx.Rollback(ctx)
 			return uuid.UUID{}, err
 		}
 
-		return id, tx.Commit(ctx)
 		//endregion
 
+		err = tx.Commit(ctx)
+		if err == nil {
+			// The old object is deleted once the new file is committed unless it is kept as a version
+			if !archived {
+				deleteReplacedFileObjectAfterCommit(ctx, entityId, previousUrl)
+			}
+
+			if m.Type == "pak" {
+				if err = NotifyBuildJobCompleted(c, entityId); err != nil {
+					fmt.Printf("failed to notify job complete: %s", err.Error())
+				}
+			}
+		}
+
+		return id, err
+
 		//endregion
 	}
 
 	return uuid.UUID{}, err
 }
 
-func UploadResizedImageForRequester(c *fiber.Ctx, requester *sm.User, entityId uuid.UUID, m FileUploadRequestMetadata, uploadImageType UploadImageType) (fileId uuid.UUID, err error) {
+func UploadFileForRequester(c *fiber.Ctx, requester *sm.User, entityId uuid.UUID, m FileUploadRequestMetadata) (fileId uuid.UUID, err error) {
 	db := database.DB
 	ctx := c.UserContext()
 
 	var (
-		q         string                // query string
-		tx        pgx.Tx                // pgx transaction
-		row       pgx.Row               // pgx row
-		fId       pgtypeuuid.UUID       // id of the file from the db
-		fVersion  int64                 // version of the file from the db
-		id        uuid.UUID             // file id to use
-		formFile  *multipart.FileHeader // uploaded file
-		buffer    multipart.File        // uploaded file contents
-		mime      string                // MIME type to use
-		pMIME     *mimetype.MIME        // auto-detected MIME type
-		imageType string                // image type to use
-		isOwner   bool
-		canEdit   bool
+		q        string                // query string
+		tx       pgx.Tx                // pgx transaction
+		row      pgx.Row               // pgx row
+		fId      pgtypeuuid.UUID       // id of the file from the db
+		fVersion int64                 // file version from the db
+		id       uuid.UUID             // file id to use
+		formFile *multipart.FileHeader // uploaded file
+		buffer   multipart.File        // uploaded file contents
+		mime     string                // MIME type to use
+		pMIME    *mimetype.MIME        // auto-detected MIME type
+		isOwner  bool
+		canEdit  bool
 	)
 
-	switch uploadImageType {
-	case ImagePreview:
-		imageType = "image_preview"
-	case ImageTexture:
-		imageType = "texture_diffuse"
-	default:
-		imageType = "image_full"
+	if m.Type == "pak" || m.Type == "release-archive" {
+		if m.Deployment == "" {
+			err = fmt.Errorf("pak file has no deployment configuration set")
+			return uuid.UUID{}, err
+		}
+
+		if m.Platform == "" {
+			err = fmt.Errorf("pak file has no platform set")
+			return uuid.UUID{}, err
+		}
+	} else {
+		m.Deployment = ""
+		m.Platform = ""
 	}
 
 	// Try to find existing file with same properties
 	q = `SELECT f.id,
-       version,
+       f.version,
        a.is_owner,
 	   a.can_edit
 FROM files AS f
@@ -3540,13 +651,13 @@ WHERE f.entity_id = $2
   AND f.type = $3
   AND f.deployment_type = $4
   AND f.platform = $5
-  AND f.variation = $6`
+  AND f.variation = $6
+  AND f.original_path = $7`
 
-	row = db.QueryRow(ctx, q, requester.Id, entityId, imageType, m.Deployment, m.Platform, m.Index)
+	row = db.QueryRow(ctx, q, requester.Id, entityId, m.Type, m.Deployment, m.Platform, m.Index, m.OriginalPath)
 
 	err = row.Scan(&fId, &fVersion, &isOwner, &canEdit)
 	if err != nil && err.Error() == "no rows in result set" {
-
 		// Check entity access
 		q = `SELECT a.is_owner, a.can_edit FROM entities e LEFT JOIN accessibles a on e.id = a.entity_id AND a.user_id = $1::uuid WHERE e.id = $2`
 		row = db.QueryRow(ctx, q, requester.Id, entityId)
@@ -3571,6 +682,13 @@ WHERE f.entity_id = $2
 			return uuid.UUID{}, err
 		}
 
+		// Check if the requester and the app have enough storage left
+		err = checkStorageQuota(ctx, requester.Id, entityId, formFile.Size, uuid.Nil)
+		if err != nil {
+			_ = tx.Rollback(ctx)
+			return uuid.UUID{}, err
+		}
+
 		// Get upload file buffer
 		buffer, err = formFile.Open()
 		if err != nil {
@@ -3593,7 +711,6 @@ WHERE f.entity_id = $2
 			// Seek back to the start of the file
 			_, err = buffer.Seek(0, io.SeekStart)
 			if err != nil {
-				_ = tx.Rollback(ctx)
 				return uuid.UUID{}, err
 			}
 
@@ -3604,76 +721,18 @@ WHERE f.entity_id = $2
 			// Seek back to the start of the file
 			_, err = buffer.Seek(0, io.SeekStart)
 			if err != nil {
-				_ = tx.Rollback(ctx)
-				return uuid.UUID{}, err
-			}
-		}
-
-		var (
-			resizedImageBuffer bytes.Buffer
-			originalImage      image.Image
-			newImage           image.Image
-		)
-
-		if mime == "image/jpeg" {
-			// Decode to bitmap
-			originalImage, err = jpeg.Decode(buffer)
-			if err != nil {
-				_ = tx.Rollback(ctx)
-				return uuid.UUID{}, err
-			}
-
-			if uploadImageType == ImagePreview {
-				// Resize to generate preview
-				newImage = resize.Resize(256, 0, originalImage, resize.Lanczos3)
-			} else if uploadImageType == ImageTexture {
-				w := uint(originalImage.Bounds().Size().X)
-				h := uint(originalImage.Bounds().Size().Y)
-				newImage = resize.Resize(nextPowerOfTwo(w), nextPowerOfTwo(h), originalImage, resize.Lanczos3)
-			}
-
-			// Encode back to JPEG
-			buf := bufio.NewWriter(&resizedImageBuffer)
-			err = jpeg.Encode(buf, newImage, nil)
-			if err != nil {
-				_ = tx.Rollback(ctx)
-				return uuid.UUID{}, err
-			}
-		} else if mime == "image/png" {
-			// Decode to bitmap
-			originalImage, err = png.Decode(buffer)
-			if err != nil {
-				_ = tx.Rollback(ctx)
-				return uuid.UUID{}, err
-			}
-
-			if uploadImageType == ImagePreview {
-				// Resize to generate preview
-				newImage = resize.Resize(256, 0, originalImage, resize.Lanczos3)
-			} else if uploadImageType == ImageTexture {
-				w := uint(originalImage.Bounds().Size().X)
-				h := uint(originalImage.Bounds().Size().Y)
-				newImage = resize.Resize(nextPowerOfTwo(w), nextPowerOfTwo(h), originalImage, resize.Lanczos3)
-			}
-
-			// Encode back to JPEG
-			buf := bufio.NewWriter(&resizedImageBuffer)
-			err = png.Encode(buf, newImage)
-			if err != nil {
-				_ = tx.Rollback(ctx)
 				return uuid.UUID{}, err
 			}
-		} else {
-			_ = tx.Rollback(ctx)
-			return uuid.UUID{}, errors.New(fmt.Sprintf("unsupported image MIME type: %s", mime))
 		}
-
 		//endregion
 
 		//region S3 Object data
 
 		// Generate a new uuid for the file
 		id, err = uuid.NewV4()
+		if err != nil {
+			return uuid.UUID{}, err
+		}
 
 		// Get url and the key for the entity file
 		url := s3.GetS3UrlForEntityFile(entityId, id)
@@ -3683,10 +742,25 @@ WHERE f.entity_id = $2
 
 		//region Upload the Object to S3
 
+		var public = true
+		if m.Type == "uplugin_content" || m.Type == "uplugin" {
+			// Protect source files
+			public = false
+		}
+
+		if public {
+			// Files of private entities are only served by the download proxy
+			public, err = isFileObjectPublic(ctx, entityId)
+			if err != nil {
+				_ = tx.Rollback(ctx)
+				return uuid.UUID{}, err
+			}
+		}
+
 		metadata := map[string]string{
 			"version": strconv.FormatInt(m.Version, 10),
 			"index":   strconv.FormatInt(m.Index, 10),
-			"type":    imageType,
+			"type":    m.Type,
 		}
 
 		if m.Deployment != "" {
@@ -3697,34 +771,64 @@ WHERE f.entity_id = $2
 			metadata["platform"] = m.Platform
 		}
 
-		err = s3.UploadObject(key, bufio.NewReaderSize(&resizedImageBuffer, resizedImageBuffer.Len()), mime, true, &metadata, nil)
+		//endregion
+
+		//region Add a file record
+		q = `INSERT INTO files AS f (id, entity_id, url, type, mime, size, version, deployment_type, platform, uploaded_by, width, height, created_at, updated_at, variation, original_path, hash)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, now(), null, $13, $14, $15)`
+		_, err = tx.Exec(ctx, q, id, entityId, url, m.Type, mime, formFile.Size, m.Version, m.Deployment, m.Platform, requester.Id, m.Width, m.Height, m.Index, m.OriginalPath, m.Hash)
+		if err != nil {
+			_ = tx.Rollback(ctx)
+			return uuid.UUID{}, err
+		}
+
+		// Store glTF metadata, assets exceeding the budget of the file type are rejected
+		err = extractFileMetadata(ctx, tx, id, m.Type, mime, m.OriginalPath, buffer, formFile.Size)
 		if err != nil {
 			_ = tx.Rollback(ctx)
 			return uuid.UUID{}, err
 		}
 
-		//endregion
+		// Upload the object after the file record has been added so it can be linked to an existing blob
+		err = uploadFileObject(ctx, tx, id, m.Type, key, buffer, formFile.Size, mime, public, &metadata)
+		if err != nil {
+			_ = tx.Rollback(ctx)
+			return uuid.UUID{}, err
+		}
 
-		//region Add a file record
-		q = `INSERT INTO files AS f (id, entity_id, url, type, mime, size, version, deployment_type, platform, uploaded_by, width, height, created_at, updated_at, variation)
-			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, now(), null, $13)`
-		_, err = tx.Exec(ctx, q, id, entityId, url, imageType, mime, formFile.Size, m.Version, m.Deployment, m.Platform, requester.Id, m.Width, m.Height, m.Index)
+		// Queue image derivatives generation
+		err = enqueueImageDerivatives(ctx, tx, id, m.Type)
+		if err != nil {
+			_ = tx.Rollback(ctx)
+			return uuid.UUID{}, err
+		}
+
+		// Queue the malware scan, the file can not be downloaded until it is clean
+		err = enqueueFileScan(ctx, tx, id)
 		if err != nil {
 			_ = tx.Rollback(ctx)
 			return uuid.UUID{}, err
 		}
 
-		return id, tx.Commit(ctx)
+		err = tx.Commit(ctx)
+		if err == nil {
+			if m.Type == "pak" {
+				if err = NotifyBuildJobCompleted(c, entityId); err != nil {
+					fmt.Printf("failed to notify job complete: %s", err.Error())
+				}
+			}
+		}
+
+		return id, err
 		//endregion
 
 		//endregion
 	} else if err == nil {
-		if !(isOwner || canEdit) {
+		if !isOwner || !canEdit {
 			return uuid.UUID{}, errors.New("no access")
 		}
 
 		//region Replace an existing file
-
 		fVersion++
 
 		tx, err = db.Begin(ctx)
@@ -3741,6 +845,13 @@ WHERE f.entity_id = $2
 			return uuid.UUID{}, err
 		}
 
+		// Check if the requester and the app have enough storage left, the replaced file is not counted
+		err = checkStorageQuota(ctx, requester.Id, entityId, formFile.Size, fId.UUID)
+		if err != nil {
+			_ = tx.Rollback(ctx)
+			return uuid.UUID{}, err
+		}
+
 		// Get upload file buffer
 		buffer, err = formFile.Open()
 		if err != nil {
@@ -3785,18 +896,32 @@ WHERE f.entity_id = $2
 
 		// Get url and the key for the entity file
 		url := s3.GetS3UrlForEntityFile(entityId, id)
-		previousKey := s3.GetS3KeyForEntityFile(entityId, fId.UUID)
 		newKey := s3.GetS3KeyForEntityFile(entityId, id)
 
 		//endregion
 
 		//region Upload the Object to S3
 
-		// Delete the old Object
+		// Keep the old file as a version if the history is enabled for its type
+		var (
+			archived    bool
+			previousUrl string
+		)
+		previousUrl, archived, err = archiveFileVersion(ctx, tx, fId.UUID)
+		if err != nil {
+			_ = tx.Rollback(ctx)
+			return uuid.UUID{}, err
+		}
+
+		var public = true
+		if strings.HasPrefix(m.Type, "uplugin") {
+			// Protect package source files
+			public = false
+		}
 
-		exists := s3.ObjectExists(previousKey)
-		if exists {
-			err = s3.DeleteObject(previousKey)
+		if public {
+			// Files of private entities are only served by the download proxy
+			public, err = isFileObjectPublic(ctx, entityId)
 			if err != nil {
 				_ = tx.Rollback(ctx)
 				return uuid.UUID{}, err
@@ -3806,7 +931,7 @@ WHERE f.entity_id = $2
 		metadata := map[string]string{
 			"version": strconv.FormatInt(fVersion, 10),
 			"index":   strconv.FormatInt(m.Index, 10),
-			"type":    imageType,
+			"type":    m.Type,
 		}
 
 		if m.Deployment != "" {
@@ -3817,39 +942,82 @@ WHERE f.entity_id = $2
 			metadata["platform"] = m.Platform
 		}
 
-		// Upload the new Object
-		err = s3.UploadObject(newKey, buffer, mime, true, &metadata, nil)
+		//endregion
+
+		//region Update a file record
+		_, err = tx.Exec(ctx, "SET CONSTRAINTS files_pkey DEFERRED")
 		if err != nil {
 			_ = tx.Rollback(ctx)
 			return uuid.UUID{}, err
 		}
 
-		//endregion
-
-		//region Update a file record
 		q = `UPDATE files f
 SET id=$1,
     url=$2,
     mime=$3,
     size=$4,
-    version=(f.version + 1),
-    uploaded_by=$5,
-    width=$6,
-    height=$7,
-    updated_at=now()
-WHERE f.entity_id = $8
-  AND f.type = $9
-  AND f.deployment_type = $10
-  AND f.platform = $11
-  AND f.variation = $12`
-		_, err = tx.Exec(ctx, q, id, url, mime, formFile.Size, requester.Id, m.Width, m.Height, entityId, imageType, m.Deployment, m.Platform, m.Index)
+    version=$5,
+    uploaded_by=$6,
+    width=$7,
+    height=$8,
+    updated_at=now(),
+    original_path=$14,
+    blob_hash=null,
+    metadata=null
+WHERE f.entity_id = $9
+  AND f.type = $10
+  AND f.deployment_type = $11
+  AND f.platform = $12
+  AND f.variation = $13`
+		_, err = tx.Exec(ctx, q, id, url, mime, formFile.Size, fVersion, requester.Id, m.Width, m.Height, entityId, m.Type, m.Deployment, m.Platform, m.Index, m.OriginalPath)
+		if err != nil {
+			_ = tx.Rollback(ctx)
+			return uuid.UUID{}, err
+		}
+
+		// Store glTF metadata, assets exceeding the budget of the file type are rejected
+		err = extractFileMetadata(ctx, tx, id, m.Type, mime, m.OriginalPath, buffer, formFile.Size)
+		if err != nil {
+			_ = tx.Rollback(ctx)
+			return uuid.UUID{}, err
+		}
+
+		// Upload the new Object
+		err = uploadFileObject(ctx, tx, id, m.Type, newKey, buffer, formFile.Size, mime, public, &metadata)
+		if err != nil {
+			_ = tx.Rollback(ctx)
+			return uuid.UUID{}, err
+		}
+
+		// Queue image derivatives generation
+		err = enqueueImageDerivatives(ctx, tx, id, m.Type)
+		if err != nil {
+			_ = tx.Rollback(ctx)
+			return uuid.UUID{}, err
+		}
+
+		// Queue the malware scan, the file can not be downloaded until it is clean
+		err = enqueueFileScan(ctx, tx, id)
 		if err != nil {
 			_ = tx.Rollback(ctx)
 			return uuid.UUID{}, err
 		}
 
-		return id, tx.Commit(ctx)
+		err = tx.Commit(ctx)
+		if err == nil {
+			// The old object is deleted once the new file is committed unless it is kept as a version
+			if !archived {
+				deleteReplacedFileObjectAfterCommit(ctx, entityId, previousUrl)
+			}
+
+			if m.Type == "pak" {
+				if err = NotifyBuildJobCompleted(c, entityId); err != nil {
+					fmt.Printf("failed to notify job complete: %s", err.Error())
+				}
+			}
+		}
 
+		return id, err
 		//endregion
 
 		//endregion
@@ -3862,12 +1030,20 @@ func LinkFileForAdmin(ctx context.Context, requester *sm.User, entityId uuid.UUI
 	db := database.DB
 
 	var (
-		q   string
-		row pgx.Row
-		fId pgtypeuuid.UUID
-		id  uuid.UUID
+		q        string
+		tx       pgx.Tx
+		row      pgx.Row
+		fId      pgtypeuuid.UUID
+		id       uuid.UUID
+		blobHash *string
 	)
 
+	// Link to the existing blob if the file is referenced by its contents hash, storage urls must point to objects of the entity or to blobs
+	blobHash, err = resolveFileLinkBlob(ctx, requester, entityId, &m)
+	if err != nil {
+		return err
+	}
+
 	// Try to find existing file with same properties
 	q = `SELECT id
 FROM files AS f
@@ -3885,11 +1061,36 @@ WHERE f.entity_id = $1
 
 		//region Add a file record
 		q = `INSERT INTO files AS f (
-                        id, entity_id, url, type, mime, size, version, deployment_type, platform, uploaded_by, width, height, created_at, updated_at, variation, original_path, hash)
-			VALUES (gen_random_uuid(), $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, now(), null, $12, $13, $14)`
+                        id, entity_id, url, type, mime, size, version, deployment_type, platform, uploaded_by, width, height, created_at, updated_at, variation, original_path, hash, blob_hash)
+			VALUES (gen_random_uuid(), $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, now(), null, $12, $13, $14, $15)
+			RETURNING f.id`
 
-		_, err = db.Exec(ctx, q, entityId /*$1*/, m.Url /*$2*/, m.Type /*$3*/, m.Mime /*$4*/, m.Size /*$5*/, m.Version /*$6*/, m.Deployment /*$7*/, m.Platform /*$8*/, requester.Id /*$9*/, m.Width /*$10*/, m.Height /*$11*/, m.Index /*$12*/, m.OriginalPath /*$13*/, m.Hash /*$14*/)
-		return err
+		tx, err = db.Begin(ctx)
+		if err != nil {
+			return err
+		}
+
+		err = tx.QueryRow(ctx, q, entityId /*$1*/, m.Url /*$2*/, m.Type /*$3*/, m.Mime /*$4*/, m.Size /*$5*/, m.Version /*$6*/, m.Deployment /*$7*/, m.Platform /*$8*/, requester.Id /*$9*/, m.Width /*$10*/, m.Height /*$11*/, m.Index /*$12*/, m.OriginalPath /*$13*/, m.Hash /*$14*/, blobHash /*$15*/).Scan(&id)
+		if err != nil {
+			_ = tx.Rollback(ctx)
+			return err
+		}
+
+		// Linked storage objects (e.g. uploaded using a presigned url) are checked against the mesh budgets
+		err = extractLinkedFileMetadata(ctx, tx, id, m.Type, m.Mime, m.OriginalPath, m.Url)
+		if err != nil {
+			_ = tx.Rollback(ctx)
+			return err
+		}
+
+		// Queue the malware scan, the file can not be downloaded until it is clean
+		err = enqueueFileScan(ctx, tx, id)
+		if err != nil {
+			_ = tx.Rollback(ctx)
+			return err
+		}
+
+		return tx.Commit(ctx)
 		//endregion
 
 		//endregion
@@ -3901,23 +1102,21 @@ WHERE f.entity_id = $1
 		// Generate a new uuid for the file
 		id, err = uuid.NewV4()
 
-		// Get url and the key for the entity file
-		previousKey := s3.GetS3KeyForEntityFile(entityId, fId.UUID)
-
 		//endregion
 
-		//region Delete the Object from S3 if required
-
-		exists := s3.ObjectExists(previousKey)
-		if exists {
-			// Delete the old Object
-			err = s3.DeleteObject(previousKey)
-			if err != nil {
-				return err
-			}
+		tx, err = db.Begin(ctx)
+		if err != nil {
+			return err
 		}
 
-		//endregion
+		// Get the url of the replaced file
+		var previousUrl string
+		q = `SELECT f.url FROM files f WHERE f.id = $1 FOR UPDATE`
+		err = tx.QueryRow(ctx, q, fId.UUID /*$1*/).Scan(&previousUrl)
+		if err != nil {
+			_ = tx.Rollback(ctx)
+			return err
+		}
 
 		//region Update a file record
 
@@ -3932,20 +1131,43 @@ SET id=$1,
     height=$7,
     updated_at=now(),
     original_path=$13,
-	hash=$14
+	hash=$14,
+	blob_hash=$15
 WHERE f.entity_id = $8
   AND f.type = $9
   AND f.deployment_type = $10
   AND f.platform = $11
   AND f.variation = $12`
-		_, err = db.Exec(ctx, q, id /*$1*/, m.Url /*$2*/, m.Mime /*$3*/, m.Size /*$4*/, requester.Id /*$5*/, m.Width /*$6*/, m.Height /*$7*/, entityId /*$8*/, m.Type /*$9*/, m.Deployment /*$10*/, m.Platform /*$11*/, m.Index /*$12*/, m.OriginalPath /*$13*/, m.Hash /*$14*/)
+		_, err = tx.Exec(ctx, q, id /*$1*/, m.Url /*$2*/, m.Mime /*$3*/, m.Size /*$4*/, requester.Id /*$5*/, m.Width /*$6*/, m.Height /*$7*/, entityId /*$8*/, m.Type /*$9*/, m.Deployment /*$10*/, m.Platform /*$11*/, m.Index /*$12*/, m.OriginalPath /*$13*/, m.Hash /*$14*/, blobHash /*$15*/)
 		if err != nil {
+			_ = tx.Rollback(ctx)
 			return err
 		}
 
-		return nil
 		//endregion
 
+		// Linked storage objects (e.g. uploaded using a presigned url) are checked against the mesh budgets
+		err = extractLinkedFileMetadata(ctx, tx, id, m.Type, m.Mime, m.OriginalPath, m.Url)
+		if err != nil {
+			_ = tx.Rollback(ctx)
+			return err
+		}
+
+		// Queue the malware scan, the file can not be downloaded until it is clean
+		err = enqueueFileScan(ctx, tx, id)
+		if err != nil {
+			_ = tx.Rollback(ctx)
+			return err
+		}
+
+		err = tx.Commit(ctx)
+		if err == nil {
+			// The old object is deleted once the new file is committed
+			deleteReplacedFileObjectAfterCommit(ctx, entityId, previousUrl)
+		}
+
+		return err
+
 		//endregion
 	}
 
@@ -3955,6 +1177,18 @@ WHERE f.entity_id = $8
 func LinkFileForRequester(ctx context.Context, requester *sm.User, id uuid.UUID, m FileLinkRequestMetadata) (err error) {
 	db := database.DB
 
+	// Link to the existing blob if the file is referenced by its contents hash, storage urls must point to objects of the entity or to blobs
+	blobHash, err := resolveFileLinkBlob(ctx, requester, id, &m)
+	if err != nil {
+		return err
+	}
+
+	// Links to objects of the storage use the quota, links to external urls do not store anything
+	size, err := getFileLinkSize(m)
+	if err != nil {
+		return err
+	}
+
 	q := `SELECT f.id,
 	   f.url,
 	   f.version,
@@ -3971,6 +1205,7 @@ WHERE f.entity_id = $2
 
 	row := db.QueryRow(ctx, q, requester.Id, id, m.Type, m.Deployment, m.Platform, m.Index)
 	var (
+		tx       pgx.Tx
 		fId      pgtypeuuid.UUID
 		fUrl     string
 		fVersion int64
@@ -3984,16 +1219,41 @@ WHERE f.entity_id = $2
 		}
 
 		if err.Error() == "no rows in result set" {
+			if err = checkStorageQuota(ctx, requester.Id, id, size, uuid.Nil); err != nil {
+				return err
+			}
+
 			q = `INSERT INTO files AS f (
-                        id, entity_id, url, type, mime, size, version, deployment_type, platform, uploaded_by, width, height, created_at, updated_at, variation, original_path, hash)
-			VALUES (gen_random_uuid(), $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, now(), null, $12, $13, $14)`
+                        id, entity_id, url, type, mime, size, version, deployment_type, platform, uploaded_by, width, height, created_at, updated_at, variation, original_path, hash, blob_hash)
+			VALUES (gen_random_uuid(), $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, now(), null, $12, $13, $14, $15)
+			RETURNING f.id`
+
+			tx, err = db.Begin(ctx)
+			if err != nil {
+				return err
+			}
+
+			err = tx.QueryRow(ctx, q, id /*$1*/, m.Url /*$2*/, m.Type /*$3*/, m.Mime /*$4*/, m.Size /*$5*/, m.Version /*$6*/, m.Deployment /*$7*/, m.Platform /*$8*/, requester.Id /*$9*/, m.Width /*$10*/, m.Height /*$11*/, m.Index /*$12*/, m.OriginalPath /*$13*/, m.Hash /*$14*/, blobHash /*$15*/).Scan(&fId)
+			if err != nil {
+				_ = tx.Rollback(ctx)
+				return err
+			}
+
+			// Linked storage objects (e.g. uploaded using a presigned url) are checked against the mesh budgets
+			err = extractLinkedFileMetadata(ctx, tx, fId.UUID, m.Type, m.Mime, m.OriginalPath, m.Url)
+			if err != nil {
+				_ = tx.Rollback(ctx)
+				return err
+			}
 
-			_, err = db.Exec(ctx, q, id /*$1*/, m.Url /*$2*/, m.Type /*$3*/, m.Mime /*$4*/, m.Size /*$5*/, m.Version /*$6*/, m.Deployment /*$7*/, m.Platform /*$8*/, requester.Id /*$9*/, m.Width /*$10*/, m.Height /*$11*/, m.Index /*$12*/, m.OriginalPath /*$13*/, m.Hash /*$14*/)
+			// Queue the malware scan, the file can not be downloaded until it is clean
+			err = enqueueFileScan(ctx, tx, fId.UUID)
 			if err != nil {
+				_ = tx.Rollback(ctx)
 				return err
 			}
 
-			return nil
+			return tx.Commit(ctx)
 		} else {
 			return err
 		}
@@ -4003,6 +1263,10 @@ WHERE f.entity_id = $2
 		return errors.New("no access")
 	}
 
+	if err = checkStorageQuota(ctx, requester.Id, id, size, fId.UUID); err != nil {
+		return err
+	}
+
 	q = `UPDATE files f
 SET url=$1,
     mime=$2,
@@ -4013,21 +1277,43 @@ SET url=$1,
     height=$6,
     updated_at=now(),
     original_path=$12,
-	hash=$13
+	hash=$13,
+	blob_hash=$14
 WHERE f.entity_id = $7
   AND f.type = $8
   AND f.deployment_type = $9
   AND f.platform = $10
   AND f.variation = $11`
-	_, err = db.Exec(ctx, q, m.Url /*$1*/, m.Mime /*$2*/, m.Size /*$3*/, requester.Id /*$4*/, m.Width /*$5*/, m.Height /*$6*/, id /*$7*/, m.Type /*$8*/, m.Deployment /*$9*/, m.Platform /*$10*/, m.Index /*$11*/, m.OriginalPath /*$12*/, m.Hash /*$13*/)
+	tx, err = db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, q, m.Url /*$1*/, m.Mime /*$2*/, m.Size /*$3*/, requester.Id /*$4*/, m.Width /*$5*/, m.Height /*$6*/, id /*$7*/, m.Type /*$8*/, m.Deployment /*$9*/, m.Platform /*$10*/, m.Index /*$11*/, m.OriginalPath /*$12*/, m.Hash /*$13*/, blobHash /*$14*/)
+	if err != nil {
+		_ = tx.Rollback(ctx)
+		return err
+	}
+
+	// Linked storage objects (e.g. uploaded using a presigned url) are checked against the mesh budgets
+	err = extractLinkedFileMetadata(ctx, tx, fId.UUID, m.Type, m.Mime, m.OriginalPath, m.Url)
+	if err != nil {
+		_ = tx.Rollback(ctx)
+		return err
+	}
+
+	// Queue the malware scan, the file can not be downloaded until it is clean
+	err = enqueueFileScan(ctx, tx, fId.UUID)
 	if err != nil {
+		_ = tx.Rollback(ctx)
 		return err
 	}
 
-	return nil
+	return tx.Commit(ctx)
 }
 
 // PreCreateFileForAdmin Pre-create the file record allowing requester to upload file separately to the storage using presigned URL
+// glTF assets are checked against the mesh budgets by the scan worker once their objects have been uploaded or when the uploaded object is linked
 func PreCreateFileForAdmin(c *fiber.Ctx, requester *sm.User, entityId uuid.UUID, fileId uuid.UUID, m FileUploadLinkRequestMetadata) (err error) {
 	db := database.DB
 	ctx := c.UserContext()
@@ -4079,13 +1365,20 @@ WHERE f.entity_id = $1
 		//region Add a new file metadata record
 		q = `INSERT INTO files AS f (id, entity_id, url, type, mime, size, version, deployment_type, platform, uploaded_by, width, height, created_at, updated_at, variation, original_path)
 			VALUES ($1::uuid, $2::uuid, $3::text, $4::text, $5::text, $6::bigint, $7::bigint, $8::text, $9::text, $10::uuid, $11::integer, $12::integer, now(), null, $13::bigint, $14::text)`
-		_, err = db.Exec(ctx, q, fileId /*$1*/, entityId /*$2*/, m.Url /*$3*/, m.Type /*$4*/, m.Mime /*$5*/, m.Size /*$6*/, m.Version /*$7*/, m.Deployment /*$8*/, m.Platform /*$9*/, requester.Id /*$10*/, m.Width /*$11*/, m.Height /*$12*/, m.Index /*$13*/, m.OriginalPath /*$14*/)
+		_, err = tx.Exec(ctx, q, fileId /*$1*/, entityId /*$2*/, m.Url /*$3*/, m.Type /*$4*/, m.Mime /*$5*/, m.Size /*$6*/, m.Version /*$7*/, m.Deployment /*$8*/, m.Platform /*$9*/, requester.Id /*$10*/, m.Width /*$11*/, m.Height /*$12*/, m.Index /*$13*/, m.OriginalPath /*$14*/)
 		if err != nil {
 			_ = tx.Rollback(ctx)
 			return err
 		}
 		//endregion
 
+		// Queue the malware scan, the job waits until the object is uploaded using the presigned url
+		err = enqueueFileScan(ctx, tx, fileId)
+		if err != nil {
+			_ = tx.Rollback(ctx)
+			return err
+		}
+
 		err = tx.Commit(ctx)
 		if err == nil {
 			if m.Type == "pak" {
@@ -4110,7 +1403,17 @@ WHERE f.entity_id = $1
 		//region Remove old file metadata record and S3 object
 		// Get url and the key for the entity file
 		url := s3.GetS3UrlForEntityFile(entityId, fileId)
-		previousKey := s3.GetS3KeyForEntityFile(entityId, fId.UUID)
+
+		// Keep the old file as a version if the history is enabled for its type
+		var (
+			archived    bool
+			previousUrl string
+		)
+		previousUrl, archived, err = archiveFileVersion(ctx, tx, fId.UUID)
+		if err != nil {
+			_ = tx.Rollback(ctx)
+			return err
+		}
 
 		// Delete the old file record
 		q = `DELETE FROM files f WHERE f.id = $1`
@@ -4119,16 +1422,6 @@ WHERE f.entity_id = $1
 			_ = tx.Rollback(ctx)
 			return err
 		}
-
-		// Delete the old object
-		exists := s3.ObjectExists(previousKey)
-		if exists {
-			err = s3.DeleteObject(previousKey)
-			if err != nil {
-				_ = tx.Rollback(ctx)
-				return err
-			}
-		}
 		//endregion
 
 		fVersion++
@@ -4142,7 +1435,19 @@ WHERE f.entity_id = $1
 			return err
 		}
 
+		// Queue the malware scan, the job waits until the object is uploaded using the presigned url
+		err = enqueueFileScan(ctx, tx, fileId)
+		if err != nil {
+			_ = tx.Rollback(ctx)
+			return err
+		}
+
 		err = tx.Commit(ctx)
+		if err == nil && !archived {
+			// The old object is deleted once the new file is committed unless it is kept as a version
+			deleteReplacedFileObjectAfterCommit(ctx, entityId, previousUrl)
+		}
+
 		return err
 
 		//endregion
@@ -4152,6 +1457,7 @@ WHERE f.entity_id = $1
 }
 
 // PreCreateFileForRequester Pre-create the file record allowing requester to upload file separately to the storage using presigned URL
+// glTF assets are checked against the mesh budgets by the scan worker once their objects have been uploaded or when the uploaded object is linked
 func PreCreateFileForRequester(c *fiber.Ctx, requester *sm.User, entityId uuid.UUID, fileId uuid.UUID, m FileUploadLinkRequestMetadata) (err error) {
 	db := database.DB
 	ctx := c.UserContext()
@@ -4178,6 +1484,11 @@ func PreCreateFileForRequester(c *fiber.Ctx, requester *sm.User, entityId uuid.U
 		}
 	}
 
+	// The presigned upload bypasses the API so the quota is checked against the declared size
+	if m.Size == nil || *m.Size <= 0 {
+		return ErrFileSizeRequired
+	}
+
 	qAccess := `SELECT a.is_owner, a.can_edit
 FROM entities e
 	LEFT JOIN accessibles a ON a.entity_id = e.id AND a.user_id = $1::uuid
@@ -4219,6 +1530,10 @@ WHERE f.entity_id = $1
 			return errors.New("no access")
 		}
 
+		if err = checkStorageQuota(ctx, requester.Id, entityId, int64(*m.Size), uuid.Nil); err != nil {
+			return err
+		}
+
 		logrus.Infof("inserting a new file")
 
 		//region Insert a new file
@@ -4230,13 +1545,20 @@ WHERE f.entity_id = $1
 		//region Add a new file metadata record
 		q = `INSERT INTO files AS f (id, entity_id, url, type, mime, size, version, deployment_type, platform, uploaded_by, width, height, created_at, updated_at, variation, original_path)
 			VALUES ($1::uuid, $2::uuid, $3::text, $4::text, $5::text, $6::bigint, $7::bigint, $8::text, $9::text, $10::uuid, $11::integer, $12::integer, now(), null, $13::bigint, $14::text)`
-		_, err = db.Exec(ctx, q, fileId /*$1*/, entityId /*$2*/, m.Url /*$3*/, m.Type /*$4*/, m.Mime /*$5*/, m.Size /*$6*/, m.Version /*$7*/, m.Deployment /*$8*/, m.Platform /*$9*/, requester.Id /*$10*/, m.Width /*$11*/, m.Height /*$12*/, m.Index /*$13*/, m.OriginalPath /*$14*/)
+		_, err = tx.Exec(ctx, q, fileId /*$1*/, entityId /*$2*/, m.Url /*$3*/, m.Type /*$4*/, m.Mime /*$5*/, m.Size /*$6*/, m.Version /*$7*/, m.Deployment /*$8*/, m.Platform /*$9*/, requester.Id /*$10*/, m.Width /*$11*/, m.Height /*$12*/, m.Index /*$13*/, m.OriginalPath /*$14*/)
 		if err != nil {
 			_ = tx.Rollback(ctx)
 			return err
 		}
 		//endregion
 
+		// Queue the malware scan, the job waits until the object is uploaded using the presigned url
+		err = enqueueFileScan(ctx, tx, fileId)
+		if err != nil {
+			_ = tx.Rollback(ctx)
+			return err
+		}
+
 		err = tx.Commit(ctx)
 		if err == nil {
 			if m.Type == "pak" {
@@ -4251,6 +1573,10 @@ WHERE f.entity_id = $1
 		//endregion
 	} else if err == nil {
 		logrus.Infof("replacing an existing file")
+
+		if err = checkStorageQuota(ctx, requester.Id, entityId, int64(*m.Size), fId.UUID); err != nil {
+			return err
+		}
 		//region Replace an existing file
 
 		tx, err = db.Begin(ctx)
@@ -4261,7 +1587,17 @@ WHERE f.entity_id = $1
 		//region Remove old file metadata record and S3 object
 		// Get url and the key for the entity file
 		url := s3.GetS3UrlForEntityFile(entityId, fileId)
-		previousKey := s3.GetS3KeyForEntityFile(entityId, fId.UUID)
+
+		// Keep the old file as a version if the history is enabled for its type
+		var (
+			archived    bool
+			previousUrl string
+		)
+		previousUrl, archived, err = archiveFileVersion(ctx, tx, fId.UUID)
+		if err != nil {
+			_ = tx.Rollback(ctx)
+			return err
+		}
 
 		// Delete the old file record
 		q = `DELETE FROM files f WHERE f.id = $1`
@@ -4270,16 +1606,6 @@ WHERE f.entity_id = $1
 			_ = tx.Rollback(ctx)
 			return err
 		}
-
-		// Delete the old object
-		exists := s3.ObjectExists(previousKey)
-		if exists {
-			err = s3.DeleteObject(previousKey)
-			if err != nil {
-				_ = tx.Rollback(ctx)
-				return err
-			}
-		}
 		//endregion
 
 		fVersion++
@@ -4293,7 +1619,19 @@ WHERE f.entity_id = $1
 			return err
 		}
 
+		// Queue the malware scan, the job waits until the object is uploaded using the presigned url
+		err = enqueueFileScan(ctx, tx, fileId)
+		if err != nil {
+			_ = tx.Rollback(ctx)
+			return err
+		}
+
 		err = tx.Commit(ctx)
+		if err == nil && !archived {
+			// The old object is deleted once the new file is committed unless it is kept as a version
+			deleteReplacedFileObjectAfterCommit(ctx, entityId, previousUrl)
+		}
+
 		return err
 
 		//endregion
@@ -4323,20 +1661,32 @@ WHERE f.id = $1`
 		return err
 	}
 
-	var key = s3.GetS3KeyForEntityFile(eId.UUID, fId.UUID)
-	if err = s3.DeleteObject(key); err != nil {
+	q = `DELETE FROM files f WHERE f.id = $1`
+
+	tx, err := db.Begin(ctx)
+	if err != nil {
 		return err
 	}
 
-	q = `DELETE FROM files f WHERE f.id = $1`
-
-	_, err = db.Exec(ctx, q, id /*$1*/)
+	// Delete previous versions of the file together with their objects
+	if err = deleteFileVersions(ctx, tx, id); err != nil {
+		_ = tx.Rollback(ctx)
+		return err
+	}
 
+	_, err = tx.Exec(ctx, q, id /*$1*/)
 	if err != nil {
+		_ = tx.Rollback(ctx)
+		return err
+	}
+
+	// Delete the object unless it is a blob or a linked object shared with other files
+	if err = deleteReplacedFileObject(ctx, tx, eId.UUID, url); err != nil {
+		_ = tx.Rollback(ctx)
 		return err
 	}
 
-	return nil
+	return tx.Commit(ctx)
 }
 
 func DeleteFileForRequester(ctx context.Context, requester *sm.User, id uuid.UUID) (err error) {
@@ -4370,20 +1720,32 @@ WHERE f.id = $2`
 		return errors.New("no access")
 	}
 
-	var key = s3.GetS3KeyForEntityFile(eId.UUID, fId.UUID)
-	if err = s3.DeleteObject(key); err != nil {
+	q = `DELETE FROM files f WHERE f.id = $1`
+
+	tx, err := db.Begin(ctx)
+	if err != nil {
 		return err
 	}
 
-	q = `DELETE FROM files f WHERE f.id = $1`
-
-	_, err = db.Exec(ctx, q, id /*$1*/)
+	// Delete previous versions of the file together with their objects
+	if err = deleteFileVersions(ctx, tx, id); err != nil {
+		_ = tx.Rollback(ctx)
+		return err
+	}
 
+	_, err = tx.Exec(ctx, q, id /*$1*/)
 	if err != nil {
+		_ = tx.Rollback(ctx)
+		return err
+	}
+
+	// Delete the object unless it is a blob or a linked object shared with other files
+	if err = deleteReplacedFileObject(ctx, tx, eId.UUID, url); err != nil {
+		_ = tx.Rollback(ctx)
 		return err
 	}
 
-	return nil
+	return tx.Commit(ctx)
 }
 
 func GetFileForAdmin(ctx context.Context, fileId uuid.UUID) (file *File, err error) {
@@ -4405,7 +1767,9 @@ f.height fileHeight,
 f.created_at fileCreatedAt,
 f.updated_at fileUpdatedAt,
 f.variation fileVariation,
-f.original_path fileOriginalPath
+f.original_path fileOriginalPath,
+f.scan_status fileScanStatus,
+f.metadata fileMetadata
 FROM files f
 WHERE id = $1::uuid
 ORDER BY type, platform, deployment_type, version DESC, variation`
@@ -4443,6 +1807,8 @@ ORDER BY type, platform, deployment_type, version DESC, variation`
 			updatedAt    *pgtype.Timestamp
 			variation    int
 			originalPath string
+			scanStatus   *string
+			metadata     *gltf.Metadata
 		)
 
 		err = rows.Scan(
@@ -4462,6 +1828,8 @@ ORDER BY type, platform, deployment_type, version DESC, variation`
 			&updatedAt,
 			&variation,
 			&originalPath,
+			&scanStatus,
+			&metadata,
 		)
 		if err != nil {
 			return nil, err
@@ -4478,6 +1846,8 @@ ORDER BY type, platform, deployment_type, version DESC, variation`
 		e.Deployment = deployment
 		e.Platform = platform
 		e.OriginalPath = &originalPath
+		e.ScanStatus = scanStatus
+		e.Metadata = metadata
 		if uploadedBy.Status == pgtype.Present {
 			e.UploadedBy = &uploadedBy.UUID
 		}
@@ -4513,7 +1883,9 @@ f.height fileHeight,
 f.created_at fileCreatedAt,
 f.updated_at fileUpdatedAt,
 f.variation fileVariation,
-f.original_path fileOriginalPath
+f.original_path fileOriginalPath,
+f.scan_status fileScanStatus,
+f.metadata fileMetadata
 FROM files f
     LEFT JOIN entities e ON f.entity_id = e.id
 	LEFT JOIN accessibles a ON e.id = a.entity_id AND a.user_id = $1::uuid 
@@ -4553,6 +1925,8 @@ ORDER BY type, platform, deployment_type, version DESC, variation`
 			updatedAt    *pgtype.Timestamp
 			variation    int
 			originalPath string
+			scanStatus   *string
+			metadata     *gltf.Metadata
 		)
 
 		err = rows.Scan(
@@ -4572,6 +1946,8 @@ ORDER BY type, platform, deployment_type, version DESC, variation`
 			&updatedAt,
 			&variation,
 			&originalPath,
+			&scanStatus,
+			&metadata,
 		)
 		if err != nil {
 			return nil, err
@@ -4588,6 +1964,8 @@ ORDER BY type, platform, deployment_type, version DESC, variation`
 		e.Deployment = deployment
 		e.Platform = platform
 		e.OriginalPath = &originalPath
+		e.ScanStatus = scanStatus
+		e.Metadata = metadata
 		if uploadedBy.Status == pgtype.Present {
 			e.UploadedBy = &uploadedBy.UUID
 		}
@@ -4623,7 +2001,9 @@ f.height fileHeight,
 f.created_at fileCreatedAt,
 f.updated_at fileUpdatedAt,
 f.variation fileVariation,
-f.original_path fileOriginalPath
+f.original_path fileOriginalPath,
+f.scan_status fileScanStatus,
+f.metadata fileMetadata
 FROM files f
     LEFT JOIN entities e ON f.entity_id = e.id
 	LEFT JOIN accessibles a ON e.id = a.entity_id AND a.user_id = $1::uuid 
@@ -4663,6 +2043,8 @@ ORDER BY type, platform, deployment_type, version DESC, variation`
 			updatedAt    *pgtype.Timestamp
 			variation    int
 			originalPath string
+			scanStatus   *string
+			metadata     *gltf.Metadata
 		)
 
 		err = rows.Scan(
@@ -4682,6 +2064,8 @@ ORDER BY type, platform, deployment_type, version DESC, variation`
 			&updatedAt,
 			&variation,
 			&originalPath,
+			&scanStatus,
+			&metadata,
 		)
 		if err != nil {
 			return nil, err
@@ -4698,6 +2082,8 @@ ORDER BY type, platform, deployment_type, version DESC, variation`
 		e.Deployment = deployment
 		e.Platform = platform
 		e.OriginalPath = &originalPath
+		e.ScanStatus = scanStatus
+		e.Metadata = metadata
 		if uploadedBy.Status == pgtype.Present {
 			e.UploadedBy = &uploadedBy.UUID
 		}
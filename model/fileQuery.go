@@ -0,0 +1,292 @@
+package model
+
+import (
+	"context"
+	sm "dev.hackerman.me/artheon/veverse-shared/model"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/gofrs/uuid"
+	"github.com/jackc/pgx/v5"
+	"strings"
+	"time"
+	"veverse-api/database"
+)
+
+// FileQuery is a filter of entity files, empty filters match all files
+type FileQuery struct {
+	Types        []string   // File types to match any of
+	Platforms    []string   // Platforms to match any of
+	Deployments  []string   // Deployments to match any of
+	MimePrefix   string     // Prefix of the MIME type (e.g. image/)
+	MinSize      *int64     // Minimum size in bytes
+	MaxSize      *int64     // Maximum size in bytes
+	Version      *int       // Exact file version
+	UpdatedSince *time.Time // Files created or updated at or after the time
+	Cursor       string     // Keyset cursor returned with the previous page, the offset is ignored if set
+	Offset       int64
+	Limit        int64
+}
+
+// fileCursor is the sort key of the last file of the page
+type fileCursor struct {
+	Type       string    `json:"t"`
+	Platform   string    `json:"p"`
+	Deployment string    `json:"d"`
+	Version    int       `json:"v"`
+	Index      int       `json:"i"`
+	Id         uuid.UUID `json:"id"`
+}
+
+func encodeFileCursor(f File) string {
+	c := fileCursor{Type: f.Type, Platform: f.Platform, Deployment: f.Deployment, Version: f.Version, Index: f.Index}
+	if f.Id != nil {
+		c.Id = *f.Id
+	}
+
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeFileCursor(s string) (c fileCursor, err error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, fmt.Errorf("invalid cursor")
+	}
+
+	if err = json.Unmarshal(data, &c); err != nil {
+		return c, fmt.Errorf("invalid cursor")
+	}
+
+	return c, nil
+}
+
+// ParseFileQueryList splits the comma separated list keeping only allowed values, all values are allowed if the allowed set is nil
+func ParseFileQueryList(s string, allowed map[string]bool) (values []string) {
+	for _, v := range strings.Split(s, ",") {
+		v = strings.TrimSpace(v)
+		if v == "" || (allowed != nil && !allowed[v]) {
+			continue
+		}
+		values = append(values, v)
+	}
+	return values
+}
+
+// fileQueryBuilder composes the file index query with positional arguments
+type fileQueryBuilder struct {
+	joins      []string
+	conditions []string
+	args       []interface{}
+}
+
+// arg adds the argument and returns its placeholder
+func (b *fileQueryBuilder) arg(v interface{}) string {
+	b.args = append(b.args, v)
+	return fmt.Sprintf("$%d", len(b.args))
+}
+
+func (b *fileQueryBuilder) where(condition string) {
+	b.conditions = append(b.conditions, condition)
+}
+
+func (b *fileQueryBuilder) from() string {
+	q := "FROM files f"
+	if len(b.joins) > 0 {
+		q += "\n    " + strings.Join(b.joins, "\n    ")
+	}
+	if len(b.conditions) > 0 {
+		q += "\nWHERE " + strings.Join(b.conditions, "\n  AND ")
+	}
+	return q
+}
+
+// newFileQueryBuilder Adds the entity and query filters, requester visibility is added if the requester is set
+func newFileQueryBuilder(requester *sm.User, entityId uuid.UUID, query FileQuery) *fileQueryBuilder {
+	b := &fileQueryBuilder{}
+
+	b.where("f.entity_id = " + b.arg(entityId))
+	b.where("f.derivative_of IS NULL") // Derivatives are requested by the size and format of their source images
+
+	if requester != nil {
+		b.joins = append(b.joins,
+			"LEFT JOIN entities e ON e.id = f.entity_id",
+			"LEFT JOIN accessibles a ON a.entity_id = e.id AND a.user_id = "+b.arg(requester.Id)+"::uuid")
+		b.where("(e.public OR a.can_view OR a.is_owner)")
+	}
+
+	if len(query.Types) > 0 {
+		b.where("f.type = ANY(" + b.arg(query.Types) + "::text[])")
+	}
+
+	if len(query.Platforms) > 0 {
+		b.where("f.platform = ANY(" + b.arg(query.Platforms) + "::text[])")
+	}
+
+	if len(query.Deployments) > 0 {
+		b.where("f.deployment_type = ANY(" + b.arg(query.Deployments) + "::text[])")
+	}
+
+	if query.MimePrefix != "" {
+		b.where("f.mime LIKE " + b.arg(strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(query.MimePrefix)+"%"))
+	}
+
+	if query.MinSize != nil {
+		b.where("f.size >= " + b.arg(*query.MinSize))
+	}
+
+	if query.MaxSize != nil {
+		b.where("f.size <= " + b.arg(*query.MaxSize))
+	}
+
+	if query.Version != nil {
+		b.where("f.version = " + b.arg(*query.Version))
+	}
+
+	if query.UpdatedSince != nil {
+		b.where("coalesce(f.updated_at, f.created_at) >= " + b.arg(*query.UpdatedSince))
+	}
+
+	return b
+}
+
+// indexFiles Index entity files matching the query, returns the cursor of the next page if there are more files
+// The total is counted for the first page only, pages requested with the cursor return -1 as the total
+func indexFiles(ctx context.Context, requester *sm.User, entityId uuid.UUID, query FileQuery) (entities []File, total int64, next string, err error) {
+	db := database.DB
+
+	var cursor *fileCursor
+	if query.Cursor != "" {
+		c, err := decodeFileCursor(query.Cursor)
+		if err != nil {
+			return nil, -1, "", err
+		}
+		cursor = &c
+	}
+
+	b := newFileQueryBuilder(requester, entityId, query)
+
+	//region Total
+	total = -1
+	if cursor == nil {
+		q := `SELECT COUNT(*) ` + b.from()
+		err = db.QueryRow(ctx, q, b.args...).Scan(&total)
+		if err != nil {
+			return nil, -1, "", err
+		}
+
+		if total == 0 {
+			return []File{}, total, "", nil
+		}
+	}
+	//endregion
+
+	// Versions are sorted in descending order so the cursor compares the negated version
+	var page string
+	if cursor != nil {
+		c := *cursor
+		b.where(fmt.Sprintf("(f.type, f.platform, f.deployment_type, -f.version, f.variation, f.id) > (%s, %s, %s, %s, %s, %s)",
+			b.arg(c.Type), b.arg(c.Platform), b.arg(c.Deployment), b.arg(-c.Version), b.arg(c.Index), b.arg(c.Id)))
+		page = "LIMIT " + b.arg(query.Limit+1)
+	} else {
+		page = "OFFSET " + b.arg(query.Offset) + " LIMIT " + b.arg(query.Limit+1)
+	}
+
+	q := `SELECT
+f.id fileId,
+f.entity_id fileEntityId,
+f.type fileType,
+f.url fileUrl,
+f.mime fileMime,
+f.size fileSize,
+f.version fileVersion,
+f.deployment_type fileDeployment,
+f.platform filePlatform,
+f.uploaded_by fileUploadedBy,
+f.width fileWidth,
+f.height fileHeight,
+f.created_at fileCreatedAt,
+f.updated_at fileUpdatedAt,
+f.variation fileIndex,
+f.hash fileHash,
+f.original_path fileOriginalPath,
+f.scan_status fileScanStatus,
+f.metadata fileMetadata
+` + b.from() + `
+ORDER BY f.type, f.platform, f.deployment_type, f.version DESC, f.variation, f.id
+` + page
+
+	var rows pgx.Rows
+	rows, err = db.Query(ctx, q, b.args...)
+	if err != nil {
+		return []File{}, total, "", err
+	}
+
+	defer func() {
+		rows.Close()
+		database.LogPgxStat("indexFiles")
+	}()
+
+	entities = []File{}
+	for rows.Next() {
+		var (
+			e         File
+			id        uuid.UUID
+			eId       uuid.UUID
+			createdAt time.Time
+		)
+
+		err = rows.Scan(
+			&id,
+			&eId,
+			&e.Type,
+			&e.Url,
+			&e.Mime,
+			&e.Size,
+			&e.Version,
+			&e.Deployment,
+			&e.Platform,
+			&e.UploadedBy,
+			&e.Width,
+			&e.Height,
+			&createdAt,
+			&e.UpdatedAt,
+			&e.Index,
+			&e.Hash,
+			&e.OriginalPath,
+			&e.ScanStatus,
+			&e.Metadata,
+		)
+		if err != nil {
+			return nil, -1, "", err
+		}
+
+		e.Id = &id
+		e.EntityId = &eId
+		e.CreatedAt = createdAt
+
+		entities = append(entities, e)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, -1, "", err
+	}
+
+	// One extra file is requested to find out if there is the next page
+	if int64(len(entities)) > query.Limit {
+		entities = entities[:query.Limit]
+		next = encodeFileCursor(entities[len(entities)-1])
+	}
+
+	return entities, total, next, nil
+}
+
+// IndexFilesForAdmin Index entity files matching the query
+func IndexFilesForAdmin(ctx context.Context, entityId uuid.UUID, query FileQuery) (entities []File, total int64, next string, err error) {
+	return indexFiles(ctx, nil, entityId, query)
+}
+
+// IndexFilesForRequester Index entity files matching the query if the requester can view the entity
+func IndexFilesForRequester(ctx context.Context, requester *sm.User, entityId uuid.UUID, query FileQuery) (entities []File, total int64, next string, err error) {
+	return indexFiles(ctx, requester, entityId, query)
+}
@@ -0,0 +1,405 @@
+package model
+
+import (
+	"context"
+	sm "dev.hackerman.me/artheon/veverse-shared/model"
+	"errors"
+	"fmt"
+	"github.com/gofrs/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/sirupsen/logrus"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"veverse-api/aws/s3"
+	"veverse-api/database"
+	"veverse-api/gltf"
+	"veverse-api/reflect"
+)
+
+var (
+	fileVersionSingular = "file version"
+	fileVersionPlural   = "file versions"
+)
+
+const fileVersionDefaultRetention = 5
+
+var fileVersionRetention = os.Getenv("FILE_VERSION_RETENTION") // Comma separated type:count list of previous versions kept for replaced files, * matches all types, 0 disables the history (default *:5)
+
+// FileVersion is the previous version of the replaced file
+type FileVersion struct {
+	File
+	BlobHash   *string   `json:"blobHash,omitempty"`
+	ArchivedAt time.Time `json:"archivedAt"` // time the version has been replaced
+}
+
+// fileSlot is the set of properties identifying the file across its versions
+type fileSlot struct {
+	EntityId     uuid.UUID
+	Type         string
+	Platform     string
+	Deployment   string
+	Variation    int
+	OriginalPath *string
+}
+
+var (
+	fileVersionConfigOnce    sync.Once
+	fileVersionRetentionList map[string]int
+)
+
+// getFileVersionRetention returns the number of previous versions kept for the file type
+func getFileVersionRetention(fileType string) int {
+	fileVersionConfigOnce.Do(func() {
+		fileVersionRetentionList = map[string]int{}
+
+		list := fileVersionRetention
+		if list == "" {
+			list = "*:" + strconv.Itoa(fileVersionDefaultRetention)
+		}
+
+		for _, s := range strings.Split(list, ",") {
+			s = strings.TrimSpace(s)
+			if s == "" {
+				continue
+			}
+
+			t, value, ok := strings.Cut(s, ":")
+			count, err := strconv.Atoi(strings.TrimSpace(value))
+			if !ok || err != nil || count < 0 {
+				logrus.Errorf("invalid %s retention %s", fileVersionSingular, s)
+				continue
+			}
+
+			fileVersionRetentionList[strings.TrimSpace(t)] = count
+		}
+	})
+
+	if count, ok := fileVersionRetentionList[fileType]; ok {
+		return count
+	}
+
+	return fileVersionRetentionList["*"]
+}
+
+// getFileSlot returns the properties identifying the file across its versions
+func getFileSlot(ctx context.Context, tx pgx.Tx, fileId uuid.UUID) (slot fileSlot, err error) {
+	q := `SELECT f.entity_id, f.type, f.platform, f.deployment_type, f.variation, f.original_path FROM files f WHERE f.id = $1`
+	err = tx.QueryRow(ctx, q, fileId /*$1*/).Scan(&slot.EntityId, &slot.Type, &slot.Platform, &slot.Deployment, &slot.Variation, &slot.OriginalPath)
+	return slot, err
+}
+
+// archiveFileVersion Keeps the file being replaced as a version if the history is enabled for its type, returns the url of the file and false if its object is not needed anymore
+func archiveFileVersion(ctx context.Context, tx pgx.Tx, fileId uuid.UUID) (url string, archived bool, err error) {
+	slot, err := getFileSlot(ctx, tx, fileId)
+	if err != nil {
+		return "", false, err
+	}
+
+	q := `SELECT f.url FROM files f WHERE f.id = $1`
+	if err = tx.QueryRow(ctx, q, fileId /*$1*/).Scan(&url); err != nil {
+		return "", false, err
+	}
+
+	// Versions get their own ids as the file keeps its id when a version is restored
+	retention := getFileVersionRetention(slot.Type)
+	if retention > 0 {
+		q = `INSERT INTO file_versions (id, entity_id, type, url, mime, size, version, deployment_type, platform, variation, original_path, hash, blob_hash, uploaded_by, width, height, metadata, created_at, archived_at)
+SELECT gen_random_uuid(), f.entity_id, f.type, f.url, f.mime, f.size, f.version, f.deployment_type, f.platform, f.variation, f.original_path, f.hash, f.blob_hash, f.uploaded_by, f.width, f.height, f.metadata, coalesce(f.updated_at, f.created_at), now()
+FROM files f
+WHERE f.id = $1`
+		if _, err = tx.Exec(ctx, q, fileId /*$1*/); err != nil {
+			return "", false, fmt.Errorf("failed to archive the %s: %v", fileVersionSingular, err)
+		}
+	}
+
+	if err = pruneFileVersions(ctx, tx, slot, retention); err != nil {
+		return "", false, err
+	}
+
+	return url, retention > 0, nil
+}
+
+// pruneFileVersions Deletes versions of the file beyond the number to keep together with their objects unless they are blobs shared with other files
+func pruneFileVersions(ctx context.Context, tx pgx.Tx, slot fileSlot, keep int) (err error) {
+	q := `DELETE FROM file_versions
+WHERE id IN (SELECT v.id
+             FROM file_versions v
+             WHERE v.entity_id = $1
+               AND v.type = $2
+               AND v.platform = $3
+               AND v.deployment_type = $4
+               AND v.variation = $5
+               AND v.original_path IS NOT DISTINCT FROM $6
+             ORDER BY v.version DESC, v.archived_at DESC
+             OFFSET $7)
+RETURNING url`
+	rows, err := tx.Query(ctx, q, slot.EntityId /*$1*/, slot.Type /*$2*/, slot.Platform /*$3*/, slot.Deployment /*$4*/, slot.Variation /*$5*/, slot.OriginalPath /*$6*/, keep /*$7*/)
+	if err != nil {
+		return fmt.Errorf("failed to delete %s: %v", fileVersionPlural, err)
+	}
+
+	var keys []string
+	for rows.Next() {
+		var url string
+		if err = rows.Scan(&url); err != nil {
+			rows.Close()
+			return err
+		}
+
+		// Linked files stored outside the storage have no objects
+		if key := s3.GetS3KeyForEntityUrl(url); url == s3.GetS3UrlForFile(key) {
+			keys = append(keys, key)
+		}
+	}
+	rows.Close()
+
+	for _, key := range keys {
+		if err = deleteEntityFileObject(ctx, tx, slot.EntityId, key); err != nil {
+			return fmt.Errorf("failed to delete the %s object %s: %v", fileVersionSingular, key, err)
+		}
+	}
+
+	return nil
+}
+
+// deleteFileVersions Deletes all versions of the file being deleted
+func deleteFileVersions(ctx context.Context, tx pgx.Tx, fileId uuid.UUID) (err error) {
+	slot, err := getFileSlot(ctx, tx, fileId)
+	if err != nil {
+		return err
+	}
+
+	return pruneFileVersions(ctx, tx, slot, 0)
+}
+
+// indexFileVersions Index previous versions of the file starting from the latest
+func indexFileVersions(ctx context.Context, file *File, offset int64, limit int64) (entities []FileVersion, total int64, err error) {
+	db := database.DB
+
+	var entityId uuid.UUID
+	if file.EntityId != nil {
+		entityId = *file.EntityId
+	}
+
+	q := `FROM file_versions v
+WHERE v.entity_id = $1
+  AND v.type = $2
+  AND v.platform = $3
+  AND v.deployment_type = $4
+  AND v.variation = $5
+  AND v.original_path IS NOT DISTINCT FROM $6`
+	args := []interface{}{entityId /*$1*/, file.Type /*$2*/, file.Platform /*$3*/, file.Deployment /*$4*/, file.Index /*$5*/, file.OriginalPath /*$6*/}
+
+	if err = db.QueryRow(ctx, `SELECT COUNT(*) `+q, args...).Scan(&total); err != nil {
+		return nil, -1, err
+	}
+
+	if total == 0 {
+		return []FileVersion{}, 0, nil
+	}
+
+	q = `SELECT v.id, v.entity_id, v.type, v.url, v.mime, v.size, v.version, v.deployment_type, v.platform, v.uploaded_by, v.width, v.height, v.created_at, v.variation, v.original_path, v.hash, v.blob_hash, v.metadata, v.archived_at
+` + q + `
+ORDER BY v.version DESC, v.archived_at DESC
+OFFSET $7 LIMIT $8`
+	rows, err := db.Query(ctx, q, append(args, offset /*$7*/, limit /*$8*/)...)
+	if err != nil {
+		return nil, -1, err
+	}
+
+	defer func() {
+		rows.Close()
+		database.LogPgxStat("indexFileVersions")
+	}()
+
+	entities = []FileVersion{}
+	for rows.Next() {
+		var (
+			e        FileVersion
+			id       uuid.UUID
+			eId      uuid.UUID
+			metadata *gltf.Metadata
+		)
+
+		err = rows.Scan(&id, &eId, &e.Type, &e.Url, &e.Mime, &e.Size, &e.Version, &e.Deployment, &e.Platform, &e.UploadedBy, &e.Width, &e.Height, &e.CreatedAt, &e.Index, &e.OriginalPath, &e.Hash, &e.BlobHash, &metadata, &e.ArchivedAt)
+		if err != nil {
+			return nil, -1, err
+		}
+
+		e.Id = &id
+		e.EntityId = &eId
+		e.Metadata = metadata
+
+		entities = append(entities, e)
+	}
+
+	return entities, total, rows.Err()
+}
+
+// IndexFileVersionsForAdmin Index previous versions of the file
+func IndexFileVersionsForAdmin(ctx context.Context, fileId uuid.UUID, offset int64, limit int64) (entities []FileVersion, total int64, err error) {
+	file, err := GetFileForAdmin(ctx, fileId)
+	if err != nil {
+		return nil, -1, err
+	}
+
+	if file == nil {
+		return nil, -1, pgx.ErrNoRows
+	}
+
+	return indexFileVersions(ctx, file, offset, limit)
+}
+
+// IndexFileVersionsForRequester Index previous versions of the file if the requester can view the entity
+func IndexFileVersionsForRequester(ctx context.Context, requester *sm.User, fileId uuid.UUID, offset int64, limit int64) (entities []FileVersion, total int64, err error) {
+	file, err := GetFileForRequester(ctx, requester, fileId)
+	if err != nil {
+		return nil, -1, err
+	}
+
+	if file == nil {
+		return nil, -1, pgx.ErrNoRows
+	}
+
+	return indexFileVersions(ctx, file, offset, limit)
+}
+
+// rollbackFileVersion Makes the version current again, the current file is kept as a version, the file keeps its id and gets the contents of the version with the next version number so clients download it again
+func rollbackFileVersion(ctx context.Context, fileId uuid.UUID, versionId uuid.UUID) (err error) {
+	db := database.DB
+
+	tx, err1 := db.Begin(ctx)
+	if err1 != nil {
+		return fmt.Errorf("failed to begin tx: %v", err1)
+	}
+
+	//region Check the version belongs to the file
+	var (
+		version  int64
+		fileType string
+	)
+
+	q := `SELECT f.version, f.type
+FROM files f
+    JOIN file_versions v ON v.entity_id = f.entity_id
+        AND v.type = f.type
+        AND v.platform = f.platform
+        AND v.deployment_type = f.deployment_type
+        AND v.variation = f.variation
+        AND v.original_path IS NOT DISTINCT FROM f.original_path
+WHERE f.id = $1
+  AND v.id = $2
+FOR UPDATE OF f, v`
+	err1 = tx.QueryRow(ctx, q, fileId /*$1*/, versionId /*$2*/).Scan(&version, &fileType)
+	if err1 != nil {
+		if err2 := tx.Rollback(ctx); err2 != nil {
+			return fmt.Errorf("failed to rollback failed tx: %v, %v", err1, err2)
+		}
+		return err1
+	}
+	//endregion
+
+	//region Swap the contents of the current file with the version
+
+	// The current file is always kept, otherwise its object would be lost
+	q = `INSERT INTO file_versions (id, entity_id, type, url, mime, size, version, deployment_type, platform, variation, original_path, hash, blob_hash, uploaded_by, width, height, metadata, created_at, archived_at)
+SELECT gen_random_uuid(), f.entity_id, f.type, f.url, f.mime, f.size, f.version, f.deployment_type, f.platform, f.variation, f.original_path, f.hash, f.blob_hash, f.uploaded_by, f.width, f.height, f.metadata, coalesce(f.updated_at, f.created_at), now()
+FROM files f
+WHERE f.id = $1`
+	_, err1 = tx.Exec(ctx, q, fileId /*$1*/)
+
+	if err1 == nil {
+		// The file record keeps its id, so references to the file (e.g. derivatives and jobs) stay valid
+		q = `UPDATE files f
+SET url         = v.url,
+    mime        = v.mime,
+    size        = v.size,
+    version     = $3,
+    hash        = v.hash,
+    blob_hash   = v.blob_hash,
+    uploaded_by = v.uploaded_by,
+    width       = v.width,
+    height      = v.height,
+    metadata    = v.metadata,
+    updated_at  = now()
+FROM file_versions v
+WHERE f.id = $1
+  AND v.id = $2`
+		_, err1 = tx.Exec(ctx, q, fileId /*$1*/, versionId /*$2*/, version+1 /*$3*/)
+	}
+
+	if err1 == nil {
+		q = `DELETE FROM file_versions v WHERE v.id = $1`
+		_, err1 = tx.Exec(ctx, q, versionId /*$1*/)
+	}
+
+	if err1 == nil {
+		// The scan result of the version has not been kept
+		err1 = enqueueFileScan(ctx, tx, fileId)
+	}
+
+	if err1 == nil {
+		// Derivatives of the replaced contents are regenerated
+		err1 = enqueueImageDerivatives(ctx, tx, fileId, fileType)
+	}
+
+	if err1 != nil {
+		logrus.Errorf("failed to rollback file %s to %s @ %s: %v", fileId, versionId, reflect.FunctionName(), err1)
+		if err2 := tx.Rollback(ctx); err2 != nil {
+			return fmt.Errorf("failed to rollback failed tx: %v, %v", err1, err2)
+		}
+		return fmt.Errorf("failed to restore the %s", fileVersionSingular)
+	}
+
+	//endregion
+
+	if err1 = tx.Commit(ctx); err1 != nil {
+		return fmt.Errorf("failed to commit tx: %v", err1)
+	}
+
+	// Objects of clean files of public entities become publicly readable
+	if err1 = updateFileObjectAcls(ctx, fileId); err1 != nil {
+		logrus.Errorf("failed to update acls of the file %s: %v", fileId, err1)
+	}
+
+	return nil
+}
+
+// RollbackFileVersionForAdmin Makes the previous version of the file current again, returns the restored file
+func RollbackFileVersionForAdmin(ctx context.Context, fileId uuid.UUID, versionId uuid.UUID) (file *File, err error) {
+	if err = rollbackFileVersion(ctx, fileId, versionId); err != nil {
+		return nil, err
+	}
+
+	return GetFileForAdmin(ctx, fileId)
+}
+
+// RollbackFileVersionForRequester Makes the previous version of the file current again if the requester can edit the entity, returns the restored file
+func RollbackFileVersionForRequester(ctx context.Context, requester *sm.User, fileId uuid.UUID, versionId uuid.UUID) (file *File, err error) {
+	file, err = GetFileForRequester(ctx, requester, fileId)
+	if err != nil {
+		return nil, err
+	}
+
+	if file == nil || file.EntityId == nil {
+		return nil, pgx.ErrNoRows
+	}
+
+	canEdit, err := EntityEditable(ctx, requester.Id, *file.EntityId)
+	if err != nil {
+		return nil, err
+	}
+
+	if !canEdit {
+		return nil, errors.New("no access")
+	}
+
+	if err = rollbackFileVersion(ctx, fileId, versionId); err != nil {
+		return nil, err
+	}
+
+	return GetFileForRequester(ctx, requester, fileId)
+}
@@ -0,0 +1,434 @@
+package model
+
+import (
+	"context"
+	sm "dev.hackerman.me/artheon/veverse-shared/model"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gofrs/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/sirupsen/logrus"
+	"os"
+	"strings"
+	"time"
+	"veverse-api/aws/s3"
+	"veverse-api/database"
+	"veverse-api/reflect"
+)
+
+const (
+	ObjectOrphanUnreferenced = "unreferenced" // Entity file object without a file record (e.g. the entity has been deleted)
+	ObjectOrphanExpired      = "expired"      // Temporary object older than its retention period (e.g. TTS output)
+)
+
+const (
+	ObjectGcRunning  = "running"
+	ObjectGcFinished = "finished"
+	ObjectGcFailed   = "failed"
+)
+
+const (
+	objectGcTtsPrefix       = "tts/"
+	objectGcMaxReported     = 1000 // Maximum number of orphans listed in the report, all orphans are counted and deleted
+	objectGcDefaultGrace    = 24 * time.Hour
+	objectGcDefaultTtsTTL   = 7 * 24 * time.Hour
+	objectGcDefaultInterval = 24 * time.Hour
+	objectGcRunTimeout      = 12 * time.Hour // Runs not finished within the timeout are considered interrupted (e.g. the API instance has been stopped)
+	// objectGcLockKey is the advisory lock key held while a run is recorded, so only one run is started at a time across replicas
+	objectGcLockKey int64 = 0x6f626a6563746763
+)
+
+var ErrObjectGcRunning = errors.New("object gc is already running")
+
+var (
+	objectGcGracePeriod  = os.Getenv("OBJECT_GC_GRACE_PERIOD")  // Objects modified within the period are never deleted (default 24h)
+	objectGcTtsRetention = os.Getenv("OBJECT_GC_TTS_RETENTION") // Retention period of text-to-speech output (default 168h)
+	objectGcInterval     = os.Getenv("OBJECT_GC_INTERVAL")      // Interval between background runs, the background job is disabled if not set
+	objectGcDryRun       = os.Getenv("OBJECT_GC_DRY_RUN")       // Background runs only report orphans unless set to false
+)
+
+// ObjectOrphan is a storage object not referenced by any file
+type ObjectOrphan struct {
+	Key          string    `json:"key"`
+	Size         int64     `json:"size"`
+	LastModified time.Time `json:"lastModified"`
+	Reason       string    `json:"reason"`
+}
+
+// ObjectGcReport is the result of the storage reconciliation
+type ObjectGcReport struct {
+	DryRun        bool           `json:"dryRun"`
+	GracePeriod   string         `json:"gracePeriod"`
+	Scanned       int64          `json:"scanned"`      // Number of listed objects
+	Referenced    int64          `json:"referenced"`   // Objects referenced by files, file versions, blobs or pending uploads
+	Recent        int64          `json:"recent"`       // Orphans kept as they are within the grace period
+	Unknown       int64          `json:"unknown"`      // Objects with keys of unknown layout, never deleted
+	OrphanCount   int64          `json:"orphanCount"`  // Orphans older than the grace period
+	OrphanSize    int64          `json:"orphanSize"`   // Total size of orphans
+	Deleted       int64          `json:"deleted"`      // Number of deleted orphans
+	DeletedSize   int64          `json:"deletedSize"`  // Total size of deleted orphans
+	MissingCount  int64          `json:"missingCount"` // File records without objects (e.g. presigned uploads that never completed)
+	Orphans       []ObjectOrphan `json:"orphans"`      // Orphans (up to 1000)
+	MissingFiles  []uuid.UUID    `json:"missingFiles"` // Ids of file records without objects (up to 1000)
+	StartedAt     time.Time      `json:"startedAt"`
+	FinishedAt    time.Time      `json:"finishedAt"`
+	FailedDeletes int64          `json:"failedDeletes"` // Number of orphans failed to delete
+}
+
+// ObjectGcRun is a background run of the storage reconciliation
+type ObjectGcRun struct {
+	Id         uuid.UUID       `json:"id"`
+	DryRun     bool            `json:"dryRun"`
+	Status     string          `json:"status"` // running, finished or failed
+	Report     *ObjectGcReport `json:"report,omitempty"`
+	Error      *string         `json:"error,omitempty"`
+	CreatedBy  *uuid.UUID      `json:"createdBy,omitempty"`
+	CreatedAt  time.Time       `json:"createdAt"`
+	FinishedAt *time.Time      `json:"finishedAt,omitempty"`
+}
+
+func parseObjectGcDuration(value string, fallback time.Duration) time.Duration {
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		return fallback
+	}
+	return d
+}
+
+// isEntityFileKey returns true if the key has the {entityId}/{fileId} layout of entity file objects
+func isEntityFileKey(key string) bool {
+	entityId, fileId, ok := strings.Cut(key, "/")
+	return ok && !uuid.FromStringOrNil(entityId).IsNil() && !uuid.FromStringOrNil(fileId).IsNil()
+}
+
+// getReferencedObjectKeys returns keys of objects referenced by file records, file versions, world snapshots, blobs and pending uploads, and keys of files referencing them
+func getReferencedObjectKeys(ctx context.Context, before time.Time) (keys map[string]struct{}, files map[string]uuid.UUID, err error) {
+	db := database.DB
+
+	keys = map[string]struct{}{}
+	files = map[string]uuid.UUID{}
+
+	q := `SELECT f.id, f.url, f.created_at < $1 FROM files f WHERE f.url <> ''`
+	rows, err := db.Query(ctx, q, before /*$1*/)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to query files: %v", err)
+	}
+
+	for rows.Next() {
+		var (
+			id  uuid.UUID
+			url string
+			old bool
+		)
+		if err = rows.Scan(&id, &url, &old); err != nil {
+			rows.Close()
+			return nil, nil, err
+		}
+
+		key := s3.GetS3KeyForEntityUrl(url)
+		keys[key] = struct{}{}
+
+		// Only files stored at the storage and old enough to have been uploaded are checked for missing objects
+		if old && isEntityFileKey(key) && url == s3.GetS3UrlForFile(key) {
+			files[key] = id
+		}
+	}
+	rows.Close()
+
+	// Objects of previous file versions are kept until the versions are pruned
+	q = `SELECT v.url FROM file_versions v`
+	rows, err = db.Query(ctx, q)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to query file versions: %v", err)
+	}
+
+	for rows.Next() {
+		var url string
+		if err = rows.Scan(&url); err != nil {
+			rows.Close()
+			return nil, nil, err
+		}
+		keys[s3.GetS3KeyForEntityUrl(url)] = struct{}{}
+	}
+	rows.Close()
+
+	// Objects of files referenced by world snapshots are kept until the snapshots are deleted
+	q = `SELECT f ->> 'url'
+FROM world_snapshots s
+    CROSS JOIN jsonb_array_elements(s.objects) o
+    CROSS JOIN jsonb_array_elements(o -> 'files') f`
+	rows, err = db.Query(ctx, q)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to query world snapshots: %v", err)
+	}
+
+	for rows.Next() {
+		var url string
+		if err = rows.Scan(&url); err != nil {
+			rows.Close()
+			return nil, nil, err
+		}
+		keys[s3.GetS3KeyForEntityUrl(url)] = struct{}{}
+	}
+	rows.Close()
+
+	q = `SELECT b.key FROM file_blobs b
+UNION ALL
+SELECT u.key FROM file_uploads u WHERE u.status = ANY ($1::text[])`
+	rows, err = db.Query(ctx, q, []string{FileUploadPending, FileUploadCompleting} /*$1*/)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to query blobs and uploads: %v", err)
+	}
+
+	for rows.Next() {
+		var key string
+		if err = rows.Scan(&key); err != nil {
+			rows.Close()
+			return nil, nil, err
+		}
+		keys[key] = struct{}{}
+	}
+	rows.Close()
+
+	return keys, files, nil
+}
+
+// CollectOrphanedObjects Lists storage objects, compares them with file records and deletes orphans older than the grace period unless it is a dry run
+func CollectOrphanedObjects(ctx context.Context, dryRun bool) (report *ObjectGcReport, err error) {
+	grace := parseObjectGcDuration(objectGcGracePeriod, objectGcDefaultGrace)
+	ttsRetention := parseObjectGcDuration(objectGcTtsRetention, objectGcDefaultTtsTTL)
+
+	report = &ObjectGcReport{DryRun: dryRun, GracePeriod: grace.String(), StartedAt: time.Now(), Orphans: []ObjectOrphan{}, MissingFiles: []uuid.UUID{}}
+	cutoff := report.StartedAt.Add(-grace)
+
+	// References are loaded before listing, objects uploaded later are within the grace period
+	referenced, files, err := getReferencedObjectKeys(ctx, cutoff)
+	if err != nil {
+		return nil, err
+	}
+
+	var orphans []ObjectOrphan
+	err = s3.ListObjects("", func(o s3.ObjectInfo) bool {
+		report.Scanned++
+
+		var reason string
+		if strings.HasPrefix(o.Key, objectGcTtsPrefix) {
+			if o.LastModified.After(report.StartedAt.Add(-ttsRetention)) {
+				report.Referenced++
+				return true
+			}
+			reason = ObjectOrphanExpired
+		} else if isEntityFileKey(o.Key) {
+			if _, ok := referenced[o.Key]; ok {
+				delete(files, o.Key)
+				report.Referenced++
+				return true
+			}
+			reason = ObjectOrphanUnreferenced
+		} else {
+			report.Unknown++
+			return true
+		}
+
+		if o.LastModified.After(cutoff) {
+			report.Recent++
+			return true
+		}
+
+		report.OrphanCount++
+		report.OrphanSize += o.Size
+		orphans = append(orphans, ObjectOrphan{Key: o.Key, Size: o.Size, LastModified: o.LastModified, Reason: reason})
+		return ctx.Err() == nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list objects: %v", err)
+	}
+
+	if err = ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	for i, o := range orphans {
+		if i < objectGcMaxReported {
+			report.Orphans = append(report.Orphans, o)
+		}
+
+		if dryRun {
+			continue
+		}
+
+		if err1 := s3.DeleteObject(o.Key); err1 != nil {
+			logrus.Errorf("failed to delete orphaned object %s @ %s: %v", o.Key, reflect.FunctionName(), err1)
+			report.FailedDeletes++
+			continue
+		}
+
+		report.Deleted++
+		report.DeletedSize += o.Size
+	}
+
+	// Remaining files have no objects
+	for _, id := range files {
+		report.MissingCount++
+		if len(report.MissingFiles) < objectGcMaxReported {
+			report.MissingFiles = append(report.MissingFiles, id)
+		}
+	}
+
+	report.FinishedAt = time.Now()
+
+	return report, nil
+}
+
+// createObjectGcRun Records a new run unless another run is in progress
+func createObjectGcRun(ctx context.Context, dryRun bool, createdBy *uuid.UUID) (run *ObjectGcRun, err error) {
+	db := database.DB
+
+	tx, err1 := db.Begin(ctx)
+	if err1 != nil {
+		return nil, fmt.Errorf("failed to begin tx: %v", err1)
+	}
+
+	run = &ObjectGcRun{DryRun: dryRun, Status: ObjectGcRunning, CreatedBy: createdBy}
+
+	// The lock is released when the tx ends, concurrent requests wait and see the recorded run
+	q := `SELECT pg_advisory_xact_lock($1)`
+	if _, err1 = tx.Exec(ctx, q, objectGcLockKey /*$1*/); err1 == nil {
+		q = `INSERT INTO object_gc_runs (dry_run, status, created_by, created_at)
+SELECT $1, $2, $3, now()
+WHERE NOT EXISTS (SELECT 1 FROM object_gc_runs r WHERE r.status = $2 AND r.created_at > $4)
+RETURNING id, created_at`
+		err1 = tx.QueryRow(ctx, q, dryRun /*$1*/, ObjectGcRunning /*$2*/, createdBy /*$3*/, time.Now().Add(-objectGcRunTimeout) /*$4*/).Scan(&run.Id, &run.CreatedAt)
+	}
+
+	if err1 != nil {
+		if err2 := tx.Rollback(ctx); err2 != nil {
+			return nil, fmt.Errorf("failed to rollback failed tx: %v, %v", err1, err2)
+		}
+		if err1 == pgx.ErrNoRows {
+			return nil, ErrObjectGcRunning
+		}
+		return nil, err1
+	}
+
+	if err1 = tx.Commit(ctx); err1 != nil {
+		return nil, fmt.Errorf("failed to commit tx: %v", err1)
+	}
+
+	return run, nil
+}
+
+// runObjectGc Collects orphaned objects and records the report of the run
+func runObjectGc(ctx context.Context, run *ObjectGcRun) {
+	db := database.DB
+
+	report, err := CollectOrphanedObjects(ctx, run.DryRun)
+
+	var (
+		data    []byte
+		message *string
+	)
+
+	run.Status = ObjectGcFinished
+	if err != nil {
+		logrus.Errorf("failed to collect orphaned objects @ %s: %v", reflect.FunctionName(), err)
+		run.Status = ObjectGcFailed
+		m := err.Error()
+		message = &m
+	} else {
+		if run.DryRun {
+			logrus.Infof("found %d orphaned objects (%d bytes) and %d files without objects out of %d objects, dry run", report.OrphanCount, report.OrphanSize, report.MissingCount, report.Scanned)
+		} else {
+			logrus.Infof("deleted %d of %d orphaned objects (%d bytes), %d files without objects out of %d objects", report.Deleted, report.OrphanCount, report.DeletedSize, report.MissingCount, report.Scanned)
+		}
+
+		if data, err = json.Marshal(report); err != nil {
+			logrus.Errorf("failed to marshal the object gc report @ %s: %v", reflect.FunctionName(), err)
+		}
+	}
+
+	// The run is recorded even if the request that started it has been cancelled
+	q := `UPDATE object_gc_runs SET status = $2, report = $3::jsonb, error = $4, finished_at = now() WHERE id = $1`
+	if _, err = db.Exec(context.Background(), q, run.Id /*$1*/, run.Status /*$2*/, data /*$3*/, message /*$4*/); err != nil {
+		logrus.Errorf("failed to update the object gc run %s @ %s: %v", run.Id, reflect.FunctionName(), err)
+	}
+}
+
+// StartObjectGcRun Starts the storage reconciliation in the background and returns the recorded run, only one run is allowed at a time
+func StartObjectGcRun(ctx context.Context, requester *sm.User, dryRun bool) (run *ObjectGcRun, err error) {
+	run, err = createObjectGcRun(ctx, dryRun, &requester.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	// Listing the whole storage outlives the request
+	go runObjectGc(context.Background(), run)
+
+	return run, nil
+}
+
+// GetObjectGcRun Get the run with its report, the latest run if the id is nil
+func GetObjectGcRun(ctx context.Context, id uuid.UUID) (run *ObjectGcRun, err error) {
+	db := database.DB
+
+	q := `SELECT r.id, r.dry_run, r.status, r.report, r.error, r.created_by, r.created_at, r.finished_at
+FROM object_gc_runs r
+WHERE $1::uuid IS NULL OR r.id = $1
+ORDER BY r.created_at DESC
+LIMIT 1`
+
+	var runId *uuid.UUID
+	if !id.IsNil() {
+		runId = &id
+	}
+
+	var data []byte
+	run = &ObjectGcRun{}
+	err = db.QueryRow(ctx, q, runId /*$1*/).Scan(&run.Id, &run.DryRun, &run.Status, &data, &run.Error, &run.CreatedBy, &run.CreatedAt, &run.FinishedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) > 0 {
+		run.Report = &ObjectGcReport{}
+		if err = json.Unmarshal(data, run.Report); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal the object gc report: %v", err)
+		}
+	}
+
+	return run, nil
+}
+
+// StartObjectGc periodically collects orphaned objects if OBJECT_GC_INTERVAL is set until the context is cancelled, replicas skip runs started by other replicas
+func StartObjectGc(ctx context.Context) {
+	if objectGcInterval == "" {
+		return
+	}
+
+	interval := parseObjectGcDuration(objectGcInterval, objectGcDefaultInterval)
+	dryRun := objectGcDryRun != "false"
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			run, err := createObjectGcRun(ctx, dryRun, nil)
+			if err == ErrObjectGcRunning {
+				continue
+			} else if err != nil {
+				logrus.Errorf("failed to start the object gc: %v", err)
+				continue
+			}
+
+			runObjectGc(ctx, run)
+		}
+	}()
+}
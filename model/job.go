@@ -143,7 +143,7 @@ func GetUnclaimedJob(ctx context.Context, workerId uuid.UUID, platforms []string
 	p.id				packageId,
 	p.name				packageName,
 	p.map				packageMap,
-	p.version			packageVersion,
+	coalesce(pv.version, p.version)	packageVersion,
 	p.release_name		packageBase,
 	f.id				fileId,
 	f.entity_id			fileEntityId,
@@ -160,17 +160,18 @@ func GetUnclaimedJob(ctx context.Context, workerId uuid.UUID, platforms []string
 	f.variation			fileVariation,
 	f.original_path		fileOriginalPath
 FROM jobs j
-	LEFT JOIN entities e ON j.entity_id = e.id /* app, release or package */ 
-    LEFT JOIN mods p ON e.id = p.id /* package */
+	LEFT JOIN entities e ON j.entity_id = e.id /* app, release, package or package version */ 
+    LEFT JOIN package_versions pv ON e.id = pv.id /* package version */
+    LEFT JOIN mods p ON p.id = coalesce(pv.package_id, e.id) /* package */
 	LEFT JOIN releases r ON e.id = r.id /* release */
     LEFT JOIN apps ra ON r.app_id = ra.id /* release apps */
     LEFT JOIN apps a ON e.id = a.id /* apps */
-	LEFT JOIN files f ON f.entity_id = j.entity_id AND f.type IN ('uplugin', 'uplugin_content', 'image-app-icon') /* possibly required source files */
+	LEFT JOIN files f ON f.entity_id = coalesce(pv.package_id, j.entity_id) AND f.type IN ('uplugin', 'uplugin_content', 'image-app-icon') /* possibly required source files */
 WHERE j.status = 'unclaimed' /* only unclaimed jobs */
   AND (j.platform = ANY ($1::text[])) /* only platforms supported by the builder */ 
   AND (j.type = ANY ($2::text[])) /* only types supported by the builder */
   AND (j.deployment = ANY ($3::text[])) /* only deployments supported by the builder */
-ORDER BY r.version DESC, p.version DESC`
+ORDER BY r.version DESC, coalesce(pv.version, p.version) DESC`
 
 	var (
 		rows pgx.Rows
@@ -491,7 +492,7 @@ func GetJobForAdmin(c *fiber.Ctx, id uuid.UUID) (entity *Job, err error) {
 	p.id				packageId,
 	p.name				packageName,
 	p.map				packageMap,
-	p.version			packageVersion,
+	coalesce(pv.version, p.version)	packageVersion,
 	p.release_name		packageBase,
 	f.id				fileId,
 	f.entity_id			fileEntityId,
@@ -508,14 +509,15 @@ func GetJobForAdmin(c *fiber.Ctx, id uuid.UUID) (entity *Job, err error) {
 	f.variation			fileVariation,
 	f.original_path		fileOriginalPath
 FROM jobs j
-	LEFT JOIN entities e ON j.entity_id = e.id /* package or release */
-    LEFT JOIN mods p ON e.id = p.id
+	LEFT JOIN entities e ON j.entity_id = e.id /* package, package version or release */
+    LEFT JOIN package_versions pv ON e.id = pv.id
+    LEFT JOIN mods p ON p.id = coalesce(pv.package_id, e.id)
 	LEFT JOIN releases r ON e.id = r.id
     LEFT JOIN apps ra ON r.app_id = ra.id
     LEFT JOIN apps a ON e.id = a.id
-	LEFT JOIN files f ON f.entity_id = j.entity_id AND f.type IN ('uplugin', 'uplugin_content') /* possibly required source files */
+	LEFT JOIN files f ON f.entity_id = coalesce(pv.package_id, j.entity_id) AND f.type IN ('uplugin', 'uplugin_content') /* possibly required source files */
 WHERE j.id = $1
-ORDER BY r.version DESC, p.version DESC`
+ORDER BY r.version DESC, coalesce(pv.version, p.version) DESC`
 
 	var (
 		rows pgx.Rows
@@ -817,11 +819,18 @@ func UpdateJobStatus(c *fiber.Ctx, id uuid.UUID, status string, message string)
 
 	if job.Type == "Package" {
 		// Send the job status email to the requester
-		if err = SendPackageJobStatusEmail(c, user, job.EntityId, job.Status); err != nil {
+		if err = SendPackageJobStatusEmail(c, user, getJobPackageId(job), job.Status); err != nil {
 			return fmt.Errorf("failed to send a job status email: %v", err)
 		}
 	}
 
+	if job.Type == "Package" && job.Status == "completed" {
+		// Rebuild packages depending on the updated package
+		if err := ScheduleDependentPackageJobs(c, job); err != nil {
+			logrus.Errorf("failed to schedule dependent package jobs: %v", err)
+		}
+	}
+
 	// Notify the discord channel using the hook
 	if job.Type == "Package" {
 		if job.Package != nil {
@@ -885,7 +894,7 @@ func ReportJobLogs(c *fiber.Ctx, id uuid.UUID, warnings []string, errors []strin
 		}
 
 		// Send the job status email to the requester
-		if err = SendPackageJobLogEmail(c, user, job.EntityId, warnings, errors); err != nil {
+		if err = SendPackageJobLogEmail(c, user, getJobPackageId(job), warnings, errors); err != nil {
 			return fmt.Errorf("failed to send a job status email: %v", err)
 		}
 
@@ -943,7 +952,20 @@ func ReportJobLogs(c *fiber.Ctx, id uuid.UUID, warnings []string, errors []strin
 	return err
 }
 
+// getJobPackageId returns the package of the package job, the job entity is either the package or its version
+func getJobPackageId(job *Job) uuid.UUID {
+	if job.Package != nil && job.Package.Id != nil {
+		return *job.Package.Id
+	}
+	return job.EntityId
+}
+
+// CreatePackageJobs Schedules package jobs, jobs for the package are built into its latest version so pak files of previous versions are kept
 func CreatePackageJobs(c *fiber.Ctx, requester *sm.User, entityId uuid.UUID) (err error) {
+	if entityId, err = getPackageBuildEntity(c.UserContext(), entityId); err != nil {
+		return fmt.Errorf("failed to get the %s to build: %v", packageVersionSingular, err)
+	}
+
 	configuration := "Development"
 	env := os.Getenv("ENVIRONMENT")
 	if env == "test" {
@@ -32,6 +32,7 @@ var (
 	RatingPlural   = "ratings"
 )
 
+// GetRatingsFor returns the materialized like and dislike counters of the entity
 func GetRatingsFor(ctx context.Context, entityId uuid.UUID) (rating *Rating, err error) {
 
 	var (
@@ -40,19 +41,19 @@ func GetRatingsFor(ctx context.Context, entityId uuid.UUID) (rating *Rating, err
 		db  *pgxpool.Pool
 	)
 
-	q = `SELECT 
-    SUM(CASE WHEN value >= 0 THEN value END) as total_likes,
-  	SUM(CASE WHEN value < 0 THEN value END) as total_dislikes
-FROM likables WHERE entity_id = $1`
+	q = `SELECT total_likes, total_dislikes FROM entity_ratings WHERE entity_id = $1`
 
+	db = database.DB
 	row = db.QueryRow(ctx, q, entityId)
-	if err != nil {
-		logrus.Errorf("failed to query %s @ %s: %v", RatingSingular, reflect.FunctionName(), err)
-		return nil, fmt.Errorf("failed to get entity rating")
-	}
 
+	rating = new(Rating)
 	err = row.Scan(&rating.TotalLikes, &rating.TotalDislikes)
 	if err != nil {
+		if err == pgx.ErrNoRows {
+			// Entity has not been rated yet
+			return rating, nil
+		}
+
 		logrus.Errorf("failed to scan %s @ %s: %v", RatingPlural, reflect.FunctionName(), err)
 		return nil, fmt.Errorf("failed to get entity ratings")
 	}
@@ -161,6 +162,7 @@ WHERE e.id = $1 AND a.user_id = $2 AND (e.public OR a.can_view OR a.is_owner) OF
 	return ratings, total, nil
 }
 
+// SetRating sets the requester rating of the entity and updates the entity rating counters and trending score within the same transaction
 func SetRating(ctx context.Context, requester *sm.User, entityId uuid.UUID, rating int8) (err error) {
 	db := database.DB
 
@@ -172,25 +174,88 @@ func SetRating(ctx context.Context, requester *sm.User, entityId uuid.UUID, rati
 		rating = 0
 	}
 
-	q := `UPDATE likables SET value = $1 WHERE user_id = $2 AND entity_id = $3`
-	res, err := db.Exec(ctx, q, rating, requester.Id, entityId)
+	tx, err1 := db.Begin(ctx)
+	if err1 != nil {
+		logrus.Errorf("failed to begin tx %s @ %s: %v", RatingSingular, reflect.FunctionName(), err1)
+		return fmt.Errorf("failed to set %s", RatingSingular)
+	}
+
+	likableId, err1 := uuid.NewV4()
+	if err1 != nil {
+		if err2 := tx.Rollback(ctx); err2 != nil {
+			return fmt.Errorf("failed to rollback failed tx: %v, %v", err1, err2)
+		}
+		logrus.Errorf("failed to generate uuid %s @ %s: %v", RatingSingular, reflect.FunctionName(), err1)
+		return fmt.Errorf("failed to set %s", RatingSingular)
+	}
+
+	// The first rating of the requester is inserted, a concurrent request inserting the same rating waits for this one and updates it below
+	q := `INSERT INTO likables (id, user_id, entity_id, value) VALUES ($1, $2, $3, $4) ON CONFLICT (user_id, entity_id) DO NOTHING`
+	tag, err1 := tx.Exec(ctx, q, likableId, requester.Id, entityId, rating)
+	if err1 != nil {
+		if err2 := tx.Rollback(ctx); err2 != nil {
+			return fmt.Errorf("failed to rollback failed tx: %v, %v", err1, err2)
+		}
+		logrus.Errorf("failed to insert query %s @ %s: %v", RatingSingular, reflect.FunctionName(), err1)
+		return fmt.Errorf("failed to set %s", RatingSingular)
+	}
 
-	if err == nil {
-		if count := res.RowsAffected(); count == 0 {
-			likableId, err1 := uuid.NewV4()
-			if err1 != nil {
-				logrus.Errorf("failed to generate uuid %s @ %s: %v", RatingSingular, reflect.FunctionName(), err)
-				return fmt.Errorf("failed to set %s", RatingSingular)
+	// Lock the previous rating of the requester to calculate counter deltas
+	var previous int8
+	if tag.RowsAffected() == 0 {
+		q = `SELECT value FROM likables WHERE user_id = $1 AND entity_id = $2 FOR UPDATE`
+		if err1 = tx.QueryRow(ctx, q, requester.Id, entityId).Scan(&previous); err1 != nil {
+			if err2 := tx.Rollback(ctx); err2 != nil {
+				return fmt.Errorf("failed to rollback failed tx: %v, %v", err1, err2)
 			}
+			logrus.Errorf("failed to query %s @ %s: %v", RatingSingular, reflect.FunctionName(), err1)
+			return fmt.Errorf("failed to set %s", RatingSingular)
+		}
 
-			q := `INSERT INTO likables (id, user_id, entity_id, value) VALUES ($1, $2, $3, $4)`
-			if _, err = db.Query(ctx, q, likableId, requester.Id, entityId, rating); err != nil {
-				logrus.Errorf("failed to insert query %s @ %s: %v", RatingSingular, reflect.FunctionName(), err)
-				return fmt.Errorf("failed to set %s", RatingSingular)
+		q = `UPDATE likables SET value = $1, updated_at = now() WHERE user_id = $2 AND entity_id = $3`
+		if _, err1 = tx.Exec(ctx, q, rating, requester.Id, entityId); err1 != nil {
+			if err2 := tx.Rollback(ctx); err2 != nil {
+				return fmt.Errorf("failed to rollback failed tx: %v, %v", err1, err2)
 			}
+			logrus.Errorf("failed to query %s @ %s: %v", RatingSingular, reflect.FunctionName(), err1)
+			return fmt.Errorf("failed to set %s", RatingSingular)
 		}
-	} else {
-		logrus.Errorf("failed to query %s @ %s: %v", RatingSingular, reflect.FunctionName(), err)
+	}
+
+	// Dislikes are counted negatively, the same way as the sum of likable values returned before the counters were materialized
+	var likesDelta, dislikesDelta int32
+	if previous > 0 {
+		likesDelta--
+	} else if previous < 0 {
+		dislikesDelta++
+	}
+	if rating > 0 {
+		likesDelta++
+	} else if rating < 0 {
+		dislikesDelta--
+	}
+
+	q = `INSERT INTO entity_ratings (entity_id, total_likes, total_dislikes) VALUES ($1, greatest($2, 0), least($3, 0))
+ON CONFLICT (entity_id) DO UPDATE SET total_likes = greatest(entity_ratings.total_likes + $2, 0), total_dislikes = least(entity_ratings.total_dislikes + $3, 0)`
+	if _, err1 = tx.Exec(ctx, q, entityId /*$1*/, likesDelta /*$2*/, dislikesDelta /*$3*/); err1 != nil {
+		if err2 := tx.Rollback(ctx); err2 != nil {
+			return fmt.Errorf("failed to rollback failed tx: %v, %v", err1, err2)
+		}
+		logrus.Errorf("failed to update counters %s @ %s: %v", RatingSingular, reflect.FunctionName(), err1)
+		return fmt.Errorf("failed to set %s", RatingSingular)
+	}
+
+	q = `UPDATE entity_ratings SET trending_score = coalesce(entity_trending_score(entity_id, $2), 0), trending_updated_at = now() WHERE entity_id = $1`
+	if _, err1 = tx.Exec(ctx, q, entityId /*$1*/, TrendingHalfLifeHours() /*$2*/); err1 != nil {
+		if err2 := tx.Rollback(ctx); err2 != nil {
+			return fmt.Errorf("failed to rollback failed tx: %v, %v", err1, err2)
+		}
+		logrus.Errorf("failed to update trending score %s @ %s: %v", RatingSingular, reflect.FunctionName(), err1)
+		return fmt.Errorf("failed to set %s", RatingSingular)
+	}
+
+	if err1 = tx.Commit(ctx); err1 != nil {
+		logrus.Errorf("failed to commit tx %s @ %s: %v", RatingSingular, reflect.FunctionName(), err1)
 		return fmt.Errorf("failed to set %s", RatingSingular)
 	}
 
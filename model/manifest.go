@@ -0,0 +1,265 @@
+package model
+
+import (
+	"context"
+	sm "dev.hackerman.me/artheon/veverse-shared/model"
+	"errors"
+	"fmt"
+	"github.com/gofrs/uuid"
+	"sort"
+	"veverse-api/database"
+	"veverse-api/reflect"
+	"veverse-api/scanner"
+)
+
+// ReleaseManifestFile is a file of the release identified by its original path
+type ReleaseManifestFile struct {
+	Id         uuid.UUID `json:"id"`
+	Path       string    `json:"path"` // Original path of the file, the file type for files without the path
+	Type       string    `json:"type"`
+	Url        string    `json:"url"`
+	Mime       *string   `json:"mime,omitempty"`
+	Size       int64     `json:"size"`
+	Hash       *string   `json:"hash,omitempty"`
+	Version    int       `json:"version,omitempty"`
+	Variation  int64     `json:"variation,omitempty"` // Files with the same path are distinguished by the variation
+	Platform   string    `json:"platform,omitempty"`
+	Deployment string    `json:"deploymentType,omitempty"`
+}
+
+// ReleaseManifest is the full list of release files
+type ReleaseManifest struct {
+	ReleaseId      uuid.UUID             `json:"releaseId"`
+	AppId          *uuid.UUID            `json:"appId,omitempty"`
+	Version        string                `json:"version,omitempty"`
+	CodeVersion    string                `json:"codeVersion,omitempty"`
+	ContentVersion string                `json:"contentVersion,omitempty"`
+	Published      bool                  `json:"published"`
+	Size           int64                 `json:"size"` // Total size of the files
+	Files          []ReleaseManifestFile `json:"files"`
+}
+
+// ReleaseDeltaTarget is the difference between releases for a platform and deployment
+type ReleaseDeltaTarget struct {
+	Platform     string                `json:"platform,omitempty"`
+	Deployment   string                `json:"deploymentType,omitempty"`
+	Added        []ReleaseManifestFile `json:"added"`
+	Changed      []ReleaseManifestFile `json:"changed"`
+	Removed      []ReleaseManifestFile `json:"removed"`      // Files to remove
+	DownloadSize int64                 `json:"downloadSize"` // Total size of added and changed files
+}
+
+// ReleaseDelta is the difference between two releases of the app
+type ReleaseDelta struct {
+	FromId      uuid.UUID            `json:"fromId"`
+	ToId        uuid.UUID            `json:"toId"`
+	FromVersion string               `json:"fromVersion,omitempty"`
+	ToVersion   string               `json:"toVersion,omitempty"`
+	Targets     []ReleaseDeltaTarget `json:"targets"`
+}
+
+type ReleaseManifestRequestMetadata struct {
+	Platform   string `json:"platform,omitempty" query:"platform"`     // Optional platform (OS) to filter files by (Win64, Mac, Linux, IOS, Android)
+	Deployment string `json:"deployment,omitempty" query:"deployment"` // Optional deployment to filter files by (Server or Client)
+}
+
+type ReleaseDeltaRequestMetadata struct {
+	ReleaseManifestRequestMetadata
+	From string `json:"from,omitempty" query:"from"` // Release to update from
+}
+
+// releaseManifestFileChanged returns true if the file should be downloaded again, files without hashes are compared by size and url
+func releaseManifestFileChanged(from ReleaseManifestFile, to ReleaseManifestFile) bool {
+	if from.Hash != nil && to.Hash != nil && *from.Hash != "" && *to.Hash != "" {
+		return *from.Hash != *to.Hash
+	}
+
+	return from.Size != to.Size || from.Url != to.Url
+}
+
+// GetReleaseManifestForAdmin Get the release file list filtered by the platform and deployment if set, files not scanned yet or rejected by the scanner are not listed
+func GetReleaseManifestForAdmin(ctx context.Context, id uuid.UUID, platform string, deployment string) (manifest *ReleaseManifest, err error) {
+	db := database.DB
+
+	manifest = &ReleaseManifest{ReleaseId: id}
+
+	q := `SELECT r.app_id, coalesce(r.version, ''), coalesce(r.code_version, ''), coalesce(r.content_version, ''), coalesce(r.published, false) FROM releases r WHERE r.id = $1`
+	err = db.QueryRow(ctx, q, id /*$1*/).Scan(&manifest.AppId, &manifest.Version, &manifest.CodeVersion, &manifest.ContentVersion, &manifest.Published)
+	if err != nil {
+		return nil, err
+	}
+
+	// Only files which can be downloaded are listed, scan statuses are checked the same way as by CheckFileScanStatus
+	q = `SELECT f.id,
+       coalesce(nullif(f.original_path, ''), f.type),
+       f.type,
+       f.url,
+       f.mime,
+       coalesce(f.size, 0),
+       f.hash,
+       f.version,
+       f.variation,
+       f.platform,
+       f.deployment_type
+FROM files f
+WHERE f.entity_id = $1
+  AND ($2 = '' OR f.platform = $2)
+  AND ($3 = '' OR f.deployment_type = $3)
+  AND f.derivative_of IS NULL
+  AND (f.scan_status = ANY ($4::text[]) OR (f.scan_status IS NULL AND NOT $5::boolean))
+ORDER BY f.platform, f.deployment_type, 2, f.variation`
+	rows, err := db.Query(ctx, q, id /*$1*/, platform /*$2*/, deployment /*$3*/, []string{FileScanClean, FileScanExternal} /*$4*/, scanner.Enabled() /*$5*/)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query %s files @ %s: %v", ReleaseSingular, reflect.FunctionName(), err)
+	}
+	defer rows.Close()
+
+	manifest.Files = []ReleaseManifestFile{}
+	for rows.Next() {
+		var f ReleaseManifestFile
+		err = rows.Scan(&f.Id, &f.Path, &f.Type, &f.Url, &f.Mime, &f.Size, &f.Hash, &f.Version, &f.Variation, &f.Platform, &f.Deployment)
+		if err != nil {
+			return nil, err
+		}
+
+		manifest.Size += f.Size
+		manifest.Files = append(manifest.Files, f)
+	}
+
+	return manifest, rows.Err()
+}
+
+// GetReleaseManifestForRequester Get the release file list if the requester can view the release
+func GetReleaseManifestForRequester(ctx context.Context, requester *sm.User, id uuid.UUID, platform string, deployment string) (manifest *ReleaseManifest, err error) {
+	canView, err := EntityViewable(ctx, requester.Id, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if !canView {
+		return nil, errors.New("no access")
+	}
+
+	return GetReleaseManifestForAdmin(ctx, id, platform, deployment)
+}
+
+// diffReleaseManifests returns added, changed and removed files grouped by platform and deployment, files are matched by the path and the variation
+func diffReleaseManifests(from *ReleaseManifest, to *ReleaseManifest) (delta *ReleaseDelta) {
+	type targetKey struct {
+		platform   string
+		deployment string
+	}
+
+	type fileKey struct {
+		path      string
+		variation int64
+	}
+
+	var (
+		fromFiles = map[targetKey]map[fileKey]ReleaseManifestFile{}
+		targets   = map[targetKey]*ReleaseDeltaTarget{}
+		keys      []targetKey
+	)
+
+	target := func(k targetKey) *ReleaseDeltaTarget {
+		t, ok := targets[k]
+		if !ok {
+			t = &ReleaseDeltaTarget{Platform: k.platform, Deployment: k.deployment, Added: []ReleaseManifestFile{}, Changed: []ReleaseManifestFile{}, Removed: []ReleaseManifestFile{}}
+			targets[k] = t
+			keys = append(keys, k)
+		}
+		return t
+	}
+
+	for _, f := range from.Files {
+		k := targetKey{f.Platform, f.Deployment}
+		if fromFiles[k] == nil {
+			fromFiles[k] = map[fileKey]ReleaseManifestFile{}
+		}
+		fromFiles[k][fileKey{f.Path, f.Variation}] = f
+	}
+
+	for _, f := range to.Files {
+		k := targetKey{f.Platform, f.Deployment}
+		t := target(k)
+
+		previous, ok := fromFiles[k][fileKey{f.Path, f.Variation}]
+		if !ok {
+			t.Added = append(t.Added, f)
+			t.DownloadSize += f.Size
+			continue
+		}
+
+		delete(fromFiles[k], fileKey{f.Path, f.Variation})
+		if releaseManifestFileChanged(previous, f) {
+			t.Changed = append(t.Changed, f)
+			t.DownloadSize += f.Size
+		}
+	}
+
+	for k, files := range fromFiles {
+		if len(files) == 0 {
+			continue
+		}
+
+		t := target(k)
+		for _, f := range files {
+			t.Removed = append(t.Removed, f)
+		}
+		sort.Slice(t.Removed, func(i, j int) bool {
+			if t.Removed[i].Path != t.Removed[j].Path {
+				return t.Removed[i].Path < t.Removed[j].Path
+			}
+			return t.Removed[i].Variation < t.Removed[j].Variation
+		})
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].platform != keys[j].platform {
+			return keys[i].platform < keys[j].platform
+		}
+		return keys[i].deployment < keys[j].deployment
+	})
+
+	delta = &ReleaseDelta{FromId: from.ReleaseId, ToId: to.ReleaseId, FromVersion: from.Version, ToVersion: to.Version, Targets: []ReleaseDeltaTarget{}}
+	for _, k := range keys {
+		delta.Targets = append(delta.Targets, *targets[k])
+	}
+
+	return delta
+}
+
+// GetReleaseDeltaForAdmin Get files to add, update and remove to update the app from one release to another
+func GetReleaseDeltaForAdmin(ctx context.Context, fromId uuid.UUID, toId uuid.UUID, platform string, deployment string) (delta *ReleaseDelta, err error) {
+	from, err := GetReleaseManifestForAdmin(ctx, fromId, platform, deployment)
+	if err != nil {
+		return nil, err
+	}
+
+	to, err := GetReleaseManifestForAdmin(ctx, toId, platform, deployment)
+	if err != nil {
+		return nil, err
+	}
+
+	if from.AppId == nil || to.AppId == nil || *from.AppId != *to.AppId {
+		return nil, fmt.Errorf("%s belong to different apps", ReleasePlural)
+	}
+
+	return diffReleaseManifests(from, to), nil
+}
+
+// GetReleaseDeltaForRequester Get the release delta if the requester can view both releases
+func GetReleaseDeltaForRequester(ctx context.Context, requester *sm.User, fromId uuid.UUID, toId uuid.UUID, platform string, deployment string) (delta *ReleaseDelta, err error) {
+	for _, id := range []uuid.UUID{fromId, toId} {
+		canView, err := EntityViewable(ctx, requester.Id, id)
+		if err != nil {
+			return nil, err
+		}
+
+		if !canView {
+			return nil, errors.New("no access")
+		}
+	}
+
+	return GetReleaseDeltaForAdmin(ctx, fromId, toId, platform, deployment)
+}
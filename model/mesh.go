@@ -0,0 +1,257 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/gofrs/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/sirupsen/logrus"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"veverse-api/aws/s3"
+	"veverse-api/gltf"
+)
+
+var (
+	meshBudgetTriangles   = os.Getenv("MESH_BUDGET_TRIANGLES")    // Comma separated type:max list of triangles of uploaded glTF assets, * matches all types (e.g. avatar:70000,*:500000)
+	meshBudgetVertices    = os.Getenv("MESH_BUDGET_VERTICES")     // Comma separated type:max list of vertices of uploaded glTF assets
+	meshBudgetMaterials   = os.Getenv("MESH_BUDGET_MATERIALS")    // Comma separated type:max list of materials of uploaded glTF assets
+	meshBudgetTextureSize = os.Getenv("MESH_BUDGET_TEXTURE_SIZE") // Comma separated type:max list of the longest side of embedded textures of uploaded glTF assets
+)
+
+var ErrMeshBudgetExceeded = errors.New("mesh budget exceeded")
+
+// MeshBudget is the limit of glTF assets of the file type, zero values are not limited
+type MeshBudget struct {
+	Triangles   int64 `json:"triangles,omitempty"`
+	Vertices    int64 `json:"vertices,omitempty"`
+	Materials   int64 `json:"materials,omitempty"`
+	TextureSize int64 `json:"textureSize,omitempty"`
+}
+
+var (
+	meshBudgetConfigOnce sync.Once
+	meshBudgets          map[string]*MeshBudget
+)
+
+// parseMeshBudgetList Parses the type:max list and sets the limit of each type budget
+func parseMeshBudgetList(list string, name string, set func(b *MeshBudget, max int64)) {
+	for _, s := range strings.Split(list, ",") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+
+		fileType, value, ok := strings.Cut(s, ":")
+		max, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+		if !ok || err != nil || max < 0 {
+			logrus.Errorf("invalid mesh %s budget %s", name, s)
+			continue
+		}
+
+		fileType = strings.TrimSpace(fileType)
+		if meshBudgets[fileType] == nil {
+			meshBudgets[fileType] = &MeshBudget{}
+		}
+		set(meshBudgets[fileType], max)
+	}
+}
+
+// loadMeshBudgetConfig Parses the configured mesh budgets
+func loadMeshBudgetConfig() {
+	meshBudgetConfigOnce.Do(func() {
+		meshBudgets = map[string]*MeshBudget{}
+		parseMeshBudgetList(meshBudgetTriangles, "triangles", func(b *MeshBudget, max int64) { b.Triangles = max })
+		parseMeshBudgetList(meshBudgetVertices, "vertices", func(b *MeshBudget, max int64) { b.Vertices = max })
+		parseMeshBudgetList(meshBudgetMaterials, "materials", func(b *MeshBudget, max int64) { b.Materials = max })
+		parseMeshBudgetList(meshBudgetTextureSize, "texture size", func(b *MeshBudget, max int64) { b.TextureSize = max })
+	})
+}
+
+// getMeshBudget returns the budget of the file type, limits not set for the type fall back to the * budget
+func getMeshBudget(fileType string) (budget MeshBudget) {
+	loadMeshBudgetConfig()
+
+	if b := meshBudgets["*"]; b != nil {
+		budget = *b
+	}
+
+	if b := meshBudgets[fileType]; b != nil {
+		if b.Triangles > 0 {
+			budget.Triangles = b.Triangles
+		}
+		if b.Vertices > 0 {
+			budget.Vertices = b.Vertices
+		}
+		if b.Materials > 0 {
+			budget.Materials = b.Materials
+		}
+		if b.TextureSize > 0 {
+			budget.TextureSize = b.TextureSize
+		}
+	}
+
+	return budget
+}
+
+// checkMeshBudget returns an error if the asset exceeds the budget of the file type
+func checkMeshBudget(fileType string, m *gltf.Metadata) error {
+	budget := getMeshBudget(fileType)
+
+	if budget.Triangles > 0 && m.Triangles > budget.Triangles {
+		return fmt.Errorf("%w: %d triangles, %s files are limited to %d", ErrMeshBudgetExceeded, m.Triangles, fileType, budget.Triangles)
+	}
+
+	if budget.Vertices > 0 && m.Vertices > budget.Vertices {
+		return fmt.Errorf("%w: %d vertices, %s files are limited to %d", ErrMeshBudgetExceeded, m.Vertices, fileType, budget.Vertices)
+	}
+
+	if budget.Materials > 0 && int64(m.Materials) > budget.Materials {
+		return fmt.Errorf("%w: %d materials, %s files are limited to %d", ErrMeshBudgetExceeded, m.Materials, fileType, budget.Materials)
+	}
+
+	if budget.TextureSize > 0 && int64(m.MaxTextureSize) > budget.TextureSize {
+		return fmt.Errorf("%w: %dpx textures, %s files are limited to %dpx", ErrMeshBudgetExceeded, m.MaxTextureSize, fileType, budget.TextureSize)
+	}
+
+	return nil
+}
+
+const objectReaderChunkSize = 1 << 20 // Object ranges are fetched in chunks of this size (1 MiB) as the glTF parser reads many small adjacent ranges
+
+// objectReaderAt reads ranges of the storage object, the last fetched chunk is cached so small reads do not request the object range each
+type objectReaderAt struct {
+	key  string
+	size int64
+
+	mu          sync.Mutex
+	chunk       []byte
+	chunkOffset int64
+}
+
+func newObjectReaderAt(key string, size int64) *objectReaderAt {
+	return &objectReaderAt{key: key, size: size}
+}
+
+// readRange fetches length bytes of the object starting at the offset
+func (o *objectReaderAt) readRange(p []byte, offset int64) (n int, err error) {
+	body, err := s3.ReadObject(o.key, offset, int64(len(p)))
+	if err != nil {
+		return 0, err
+	}
+	defer body.Close()
+
+	return io.ReadFull(body, p)
+}
+
+func (o *objectReaderAt) ReadAt(p []byte, offset int64) (n int, err error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	for n < len(p) {
+		off := offset + int64(n)
+		if off >= o.size {
+			return n, io.EOF
+		}
+
+		remaining := p[n:]
+		if int64(len(remaining)) > o.size-off {
+			remaining = remaining[:o.size-off]
+		}
+
+		// Large reads (e.g. embedded buffers) are fetched directly without caching
+		if len(remaining) >= objectReaderChunkSize {
+			read, err := o.readRange(remaining, off)
+			n += read
+			if err != nil {
+				return n, err
+			}
+			continue
+		}
+
+		if o.chunk == nil || off < o.chunkOffset || off >= o.chunkOffset+int64(len(o.chunk)) {
+			start := off - off%objectReaderChunkSize
+			length := int64(objectReaderChunkSize)
+			if length > o.size-start {
+				length = o.size - start
+			}
+
+			chunk := make([]byte, length)
+			if _, err = o.readRange(chunk, start); err != nil {
+				o.chunk = nil
+				return n, err
+			}
+			o.chunk, o.chunkOffset = chunk, start
+		}
+
+		n += copy(remaining, o.chunk[off-o.chunkOffset:])
+	}
+
+	return n, nil
+}
+
+// parseFileMetadata Parses glTF assets and checks them against the budget of the file type, returns nil metadata for other files
+func parseFileMetadata(fileType string, mime string, originalPath string, r io.ReaderAt, size int64) (metadata *gltf.Metadata, err error) {
+	if !gltf.IsGltf(mime, originalPath) {
+		return nil, nil
+	}
+
+	metadata, err = gltf.Parse(r, size)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = checkMeshBudget(fileType, metadata); err != nil {
+		return nil, err
+	}
+
+	return metadata, nil
+}
+
+// parseStoredFileMetadata Parses glTF assets stored at the storage, assets linked to external urls are not downloaded by the API
+func parseStoredFileMetadata(fileType string, mime *string, originalPath string, url string) (metadata *gltf.Metadata, err error) {
+	var m string
+	if mime != nil {
+		m = *mime
+	}
+
+	if !gltf.IsGltf(m, originalPath) || !s3.IsStorageUrl(url) {
+		return nil, nil
+	}
+
+	key := s3.GetS3KeyForEntityUrl(url)
+	size, _, err := s3.GetObjectInfo(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the stored object info: %v", err)
+	}
+
+	return parseFileMetadata(fileType, m, originalPath, newObjectReaderAt(key, size), size)
+}
+
+// extractFileMetadata Parses uploaded glTF assets, stores their metadata and rejects assets exceeding the budget of the file type, other files are ignored
+func extractFileMetadata(ctx context.Context, tx pgx.Tx, fileId uuid.UUID, fileType string, mime string, originalPath string, r io.ReaderAt, size int64) (err error) {
+	metadata, err := parseFileMetadata(fileType, mime, originalPath, r, size)
+	if err != nil || metadata == nil {
+		return err
+	}
+
+	q := `UPDATE files SET metadata = $2 WHERE id = $1`
+	_, err = tx.Exec(ctx, q, fileId /*$1*/, metadata /*$2*/)
+	return err
+}
+
+// extractLinkedFileMetadata Parses glTF assets linked to storage objects, assets linked to external urls are not downloaded by the API
+func extractLinkedFileMetadata(ctx context.Context, tx pgx.Tx, fileId uuid.UUID, fileType string, mime *string, originalPath string, url string) (err error) {
+	metadata, err := parseStoredFileMetadata(fileType, mime, originalPath, url)
+	if err != nil || metadata == nil {
+		return err
+	}
+
+	q := `UPDATE files SET metadata = $2 WHERE id = $1`
+	_, err = tx.Exec(ctx, q, fileId /*$1*/, metadata /*$2*/)
+	return err
+}
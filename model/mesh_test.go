@@ -0,0 +1,38 @@
+package model
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"veverse-api/gltf"
+)
+
+func TestCheckMeshBudget(t *testing.T) {
+	meshBudgetConfigOnce.Do(func() {})
+	meshBudgets = map[string]*MeshBudget{}
+	parseMeshBudgetList("avatar:100,*:1000", "triangles", func(b *MeshBudget, max int64) { b.Triangles = max })
+	parseMeshBudgetList("*:4", "materials", func(b *MeshBudget, max int64) { b.Materials = max })
+	parseMeshBudgetList("avatar:1024,invalid", "texture size", func(b *MeshBudget, max int64) { b.TextureSize = max })
+
+	tests := []struct {
+		name     string
+		fileType string
+		metadata gltf.Metadata
+		exceeded bool
+	}{
+		{"within the type budget", "avatar", gltf.Metadata{Triangles: 100, Materials: 4, MaxTextureSize: 1024}, false},
+		{"triangles of the type budget", "avatar", gltf.Metadata{Triangles: 101}, true},
+		{"triangles of the fallback budget", "mesh", gltf.Metadata{Triangles: 1001}, true},
+		{"within the fallback budget", "mesh", gltf.Metadata{Triangles: 1000, MaxTextureSize: 8192}, false},
+		{"materials of the fallback budget", "avatar", gltf.Metadata{Materials: 5}, true},
+		{"texture size of the type budget", "avatar", gltf.Metadata{MaxTextureSize: 2048}, true},
+		{"vertices are not limited", "avatar", gltf.Metadata{Vertices: 1 << 40}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkMeshBudget(tt.fileType, &tt.metadata)
+			assert.Equal(t, tt.exceeded, errors.Is(err, ErrMeshBudgetExceeded), "%v", err)
+		})
+	}
+}
@@ -197,7 +197,7 @@ FROM nft_assets AS na
 	LEFT JOIN entities e on na.id = e.id
     LEFT JOIN objects o on e.id = o.id
 	LEFT JOIN accessibles a on e.id = a.entity_id
-	LEFT JOIN files f on f.entity_id = e.id
+	LEFT JOIN files f on f.entity_id = e.id AND f.derivative_of IS NULL
 WHERE o.type = 'NFT' AND a.user_id = $1::uuid`
 
 	db := database.DB
@@ -31,6 +31,7 @@ type Object struct {
 	Type          string      `json:"type,omitempty"`
 	TotalLikes    *int32      `json:"totalLikes,omitempty"`
 	TotalDislikes *int32      `json:"totalDislikes,omitempty"`
+	Distance      *float64    `json:"distance,omitempty"` // Distance to the point of the spatial query
 }
 
 type ArtObject struct {
@@ -57,10 +58,15 @@ type ArtObject struct {
 	TotalDislikes   *int32   `json:"totalDislikes,omitempty"`
 }
 
+// SearchArtObject Art object filters, list filters are values of repeated query parameters to match any of, empty filters match all objects
 type SearchArtObject struct {
-	Name   *string `json:"name,omitempty"  validate:"required"`
-	Type   *string `json:"type,omitempty" validate:"required"`
-	Artist *string `json:"artist,omitempty" validate:"required"`
+	Artist   []string `json:"artist,omitempty" query:"-"`
+	Medium   []string `json:"medium,omitempty" query:"-"`
+	License  []string `json:"license,omitempty" query:"-"`
+	Origin   []string `json:"origin,omitempty" query:"-"`
+	YearFrom *int     `json:"yearFrom,omitempty" query:"yearFrom"` // Objects dated in or after the year
+	YearTo   *int     `json:"yearTo,omitempty" query:"yearTo"`     // Objects dated in or before the year
+	Order    string   `json:"order,omitempty" query:"order"`       // Sort order, asc (default) or desc
 }
 
 // ObjectBatchRequestMetadata Batch request metadata for requesting Object entities
@@ -135,7 +141,7 @@ WHERE p.space_id = $1
 	props.value prop_value
 FROM placeables p
    	LEFT JOIN entities e ON e.id = p.id -- Entity (public flag)
-   	LEFT JOIN files f ON f.entity_id = e.id
+   	LEFT JOIN files f ON f.entity_id = e.id AND f.derivative_of IS NULL
     LEFT JOIN properties props ON e.id = props.entity_id
 	LEFT JOIN placeable_classes pc ON p.placeable_class_id = pc.id
 WHERE p.space_id = $1 AND (f.type != 'image_full' OR f.type IS NULL) ORDER BY e.updated_at DESC, e.created_at DESC, e.id`
@@ -368,7 +374,7 @@ WHERE p.space_id = $1 and pe.public`
 	props.value prop_value
 FROM placeables p
 	LEFT JOIN entities pe ON pe.id = p.id
-	LEFT JOIN files pf ON pf.entity_id = pe.id
+	LEFT JOIN files pf ON pf.entity_id = pe.id AND pf.derivative_of IS NULL
 	LEFT JOIN properties props ON pe.id = props.entity_id
 	LEFT JOIN placeable_classes pc ON p.placeable_class_id = pc.id
 WHERE p.space_id = $1 AND (pf.type != 'image_full' OR pf.type IS NULL)
@@ -563,7 +569,7 @@ func GetObjectForAdmin(ctx context.Context, id uuid.UUID) (entity *Object, err e
 	props.value prop_value
 FROM placeables o
    	LEFT JOIN entities e ON e.id = o.id -- Entity (public flag)
-   	LEFT JOIN files f ON f.entity_id = e.id
+   	LEFT JOIN files f ON f.entity_id = e.id AND f.derivative_of IS NULL
     LEFT JOIN properties props ON e.id = props.entity_id
 	LEFT JOIN placeable_classes pc ON o.placeable_class_id = pc.id
 WHERE e.id = $1 ORDER BY e.id`
@@ -742,7 +748,7 @@ func GetObjectForRequester(ctx context.Context, requester *sm.User, id uuid.UUID
 FROM placeables o
    	LEFT JOIN entities e ON e.id = o.id -- Entity (public flag)
 	LEFT JOIN accessibles a ON e.id = a.entity_id AND a.user_id = $1::uuid
-   	LEFT JOIN files f ON f.entity_id = e.id
+   	LEFT JOIN files f ON f.entity_id = e.id AND f.derivative_of IS NULL
     LEFT JOIN properties props ON e.id = props.entity_id
 	LEFT JOIN placeable_classes pc ON o.placeable_class_id = pc.id
 WHERE e.id = $2 ORDER BY e.id`
@@ -926,15 +932,15 @@ func GetObjectsForAdmin(ctx context.Context, offset int64, limit int64) (objects
 	props.name prop_name,
 	props.type prop_type,
 	props.value prop_value,
-	sum(case when l.value >= 0 then l.value end) as total_likes,
-	sum(case when l.value < 0 then l.value end) as total_dislikes
+	r.total_likes,
+	r.total_dislikes
 FROM placeables o
    	LEFT JOIN entities e ON e.id = o.id -- Entity (public flag)
-	LEFT JOIN likables l ON l.entity_id = e.id
-   	LEFT JOIN files f ON f.entity_id = e.id
+	LEFT JOIN entity_ratings r ON r.entity_id = e.id
+   	LEFT JOIN files f ON f.entity_id = e.id AND f.derivative_of IS NULL
     LEFT JOIN properties props ON e.id = props.entity_id
 	LEFT JOIN placeable_classes pc ON o.placeable_class_id = pc.id
-	GROUP BY o.id, e.public, pc.cls, f.id, f.type, f.mime, f.url, props.name, props.type, props.value
+	GROUP BY o.id, e.public, pc.cls, f.id, f.type, f.mime, f.url, props.name, props.type, props.value, r.total_likes, r.total_dislikes
 	OFFSET $1
 	LIMIT $2`
 
@@ -1154,17 +1160,17 @@ WHERE a.user_id = $1 AND (pe.public OR a.can_view OR a.is_owner)`
 	props.name prop_name,
 	props.type prop_type,
 	props.value prop_value,
-	sum(case when l.value >= 0 then l.value end) as total_likes,
-	sum(case when l.value < 0 then l.value end) as total_dislikes
+	r.total_likes,
+	r.total_dislikes
 FROM placeables p
    	LEFT JOIN entities pe ON pe.id = p.id -- Entity (public flag)
 	LEFT JOIN accessibles a on pe.id = a.entity_id
-	LEFT JOIN likables l ON l.entity_id = pe.id
-   	LEFT JOIN files f ON f.entity_id = pe.id
+	LEFT JOIN entity_ratings r ON r.entity_id = pe.id
+   	LEFT JOIN files f ON f.entity_id = pe.id AND f.derivative_of IS NULL
     LEFT JOIN properties props ON pe.id = props.entity_id
 	LEFT JOIN placeable_classes pc ON p.placeable_class_id = pc.id
 WHERE a.user_id = $1 AND (pe.public OR a.can_view OR a.is_owner)
-GROUP BY p.id, pe.public, pc.cls, f.id, f.type, f.mime, f.url, props.name, props.type, props.value
+GROUP BY p.id, pe.public, pc.cls, f.id, f.type, f.mime, f.url, props.name, props.type, props.value, r.total_likes, r.total_dislikes
 OFFSET $2
 LIMIT $3`
 
@@ -1384,18 +1390,18 @@ func GetArtObjectsForAdmin(ctx context.Context, requester *sm.User, offset int64
 	f.mime fMime,
 	f.url fUrl,
 	l2.value liked,
-	sum(case when l.value >= 0 then l.value end) as total_likes,
-	sum(case when l.value < 0 then l.value end) as total_dislikes,
+	r.total_likes,
+	r.total_dislikes,
 	e.views
 FROM objects o
    	LEFT JOIN entities e ON e.id = o.id
-	LEFT JOIN files f ON f.entity_id = e.id
-	LEFT JOIN likables l ON l.entity_id = e.id
+	LEFT JOIN files f ON f.entity_id = e.id AND f.derivative_of IS NULL
+	LEFT JOIN entity_ratings r ON r.entity_id = e.id
 	LEFT JOIN likables l2 ON l2.entity_id = e.id AND l2.user_id = $1
 	LEFT JOIN accessibles a ON a.entity_id = e.id
 	LEFT JOIN users owner ON owner.id = a.user_id
 WHERE o.type <> 'NFT' AND o.name ILIKE $2::text
-	GROUP BY o.id, owner.id, f.id, f.type, f.mime, f.url, l2.value, e.views
+	GROUP BY o.id, owner.id, f.id, f.type, f.mime, f.url, l2.value, e.views, r.total_likes, r.total_dislikes
 	ORDER BY o.id`
 
 	rows, err = db.Query(ctx, q, requester.Id, query)
@@ -1585,18 +1591,18 @@ func GetArtObjectsForRequester(ctx context.Context, requester *sm.User, offset i
 	f.mime fMime,
 	f.url fUrl,
 	l2.value liked,
-	sum(case when l.value >= 0 then l.value end) as total_likes,
-	sum(case when l.value < 0 then l.value end) as total_dislikes,
+	r.total_likes,
+	r.total_dislikes,
 	e.views
 FROM objects o
    	LEFT JOIN entities e ON e.id = o.id
-	LEFT JOIN files f ON f.entity_id = e.id
+	LEFT JOIN files f ON f.entity_id = e.id AND f.derivative_of IS NULL
     LEFT JOIN accessibles a on e.id = a.entity_id
 	LEFT JOIN users owner ON owner.id = a.user_id
-	LEFT JOIN likables l ON l.entity_id = e.id
+	LEFT JOIN entity_ratings r ON r.entity_id = e.id
 	LEFT JOIN likables l2 ON l2.entity_id = e.id AND l2.user_id = $1
 WHERE e.public AND o.type <> 'NFT' AND o.name ILIKE $2::text
-	GROUP BY o.id, owner.name, f.id, f.type, f.mime, f.url, l2.value, e.views
+	GROUP BY o.id, owner.name, f.id, f.type, f.mime, f.url, l2.value, e.views, r.total_likes, r.total_dislikes
 	ORDER BY o.id`
 
 	rows, err = db.Query(ctx, q, requester.Id, query)
@@ -1769,18 +1775,18 @@ func GetArtObjectForAdmin(ctx context.Context, requester *sm.User, entityId uuid
 	f.mime fMime,
 	f.url fUrl,
 	l2.value liked,
-	sum(case when l.value >= 0 then l.value end) as total_likes,
-	sum(case when l.value < 0 then l.value end) as total_dislikes,
+	r.total_likes,
+	r.total_dislikes,
 	e.views
 FROM objects o
    	LEFT JOIN entities e ON e.id = o.id
-	LEFT JOIN files f ON f.entity_id = e.id
-	LEFT JOIN likables l ON l.entity_id = e.id
+	LEFT JOIN files f ON f.entity_id = e.id AND f.derivative_of IS NULL
+	LEFT JOIN entity_ratings r ON r.entity_id = e.id
 	LEFT JOIN likables l2 ON l2.entity_id = e.id AND l2.user_id = $1
 	LEFT JOIN accessibles a ON a.entity_id = e.id
 	LEFT JOIN users owner ON owner.id = a.user_id
 WHERE o.type <> 'NFT' AND o.id = $2
-	GROUP BY o.id, owner.id, f.id, f.type, f.mime, f.url, l2.value, e.views
+	GROUP BY o.id, owner.id, f.id, f.type, f.mime, f.url, l2.value, e.views, r.total_likes, r.total_dislikes
 	ORDER BY o.id`
 
 	rows, err = db.Query(ctx, q, requester.Id, entityId)
@@ -1967,18 +1973,18 @@ func GetArtObjectForRequester(ctx context.Context, requester *sm.User, entityId
 	f.mime fMime,
 	f.url fUrl,
 	l2.value liked,
-	sum(case when l.value >= 0 then l.value end) as total_likes,
-	sum(case when l.value < 0 then l.value end) as total_dislikes,
+	r.total_likes,
+	r.total_dislikes,
 	e.views
 FROM objects o
    	LEFT JOIN entities e ON e.id = o.id
 	LEFT JOIN accessibles a ON a.entity_id = e.id AND a.user_id = $1::uuid
 	LEFT JOIN users owner ON owner.id = a.user_id
-	LEFT JOIN files f ON f.entity_id = e.id
-	LEFT JOIN likables l ON l.entity_id = e.id
+	LEFT JOIN files f ON f.entity_id = e.id AND f.derivative_of IS NULL
+	LEFT JOIN entity_ratings r ON r.entity_id = e.id
 	LEFT JOIN likables l2 ON l2.entity_id = e.id AND l2.user_id = $1
 WHERE o.type <> 'NFT' AND o.id = $2 AND (e.public OR a.can_view OR a.is_owner)
-	GROUP BY o.id,e.created_at, owner.id, owner.name, f.id, f.type, f.mime, f.url, l2.value, e.views
+	GROUP BY o.id,e.created_at, owner.id, owner.name, f.id, f.type, f.mime, f.url, l2.value, e.views, r.total_likes, r.total_dislikes
 	ORDER BY e.created_at DESC, o.id`
 
 	rows, err = db.Query(ctx, q, requester.Id, entityId)
@@ -2128,3 +2134,185 @@ WHERE o.type <> 'NFT' AND o.id = $2 AND (e.public OR a.can_view OR a.is_owner)
 
 	return object, nil
 }
+
+// GetArtObjectsTrendingForAdmin Get art objects ordered by the trending score for admin
+func GetArtObjectsTrendingForAdmin(ctx context.Context, requester *sm.User, offset int64, limit int64, query string) (objects []ArtObject, total int32, err error) {
+	return getArtObjectsTrending(ctx, requester, trendingVisibilityForAdmin, offset, limit, query)
+}
+
+// GetArtObjectsTrendingForRequester Get art objects visible to the requester ordered by the trending score
+func GetArtObjectsTrendingForRequester(ctx context.Context, requester *sm.User, offset int64, limit int64, query string) (objects []ArtObject, total int32, err error) {
+	return getArtObjectsTrending(ctx, requester, trendingVisibilityForRequester, offset, limit, query)
+}
+
+func getArtObjectsTrending(ctx context.Context, requester *sm.User, visibility string, offset int64, limit int64, query string) (objects []ArtObject, total int32, err error) {
+
+	var (
+		q    string
+		row  pgx.Row
+		rows pgx.Rows
+		db   *pgxpool.Pool
+	)
+
+	db = database.DB
+	q = `SELECT COUNT(*) FROM objects o
+	LEFT JOIN entities e ON o.id = e.id
+	WHERE ` + visibility + ` AND o.type <> 'NFT' AND o.name ILIKE $2::text`
+
+	row = db.QueryRow(ctx, q, requester.Id, query)
+	err = row.Scan(&total)
+	if err != nil {
+		logrus.Errorf("failed to scan %s @ %s: %v", objectSingular, reflect.FunctionName(), err)
+		return nil, -1, fmt.Errorf("failed to get %s", objectSingular)
+	}
+
+	q = `WITH t AS (SELECT o.id, coalesce(r.trending_score, 0) score
+	FROM objects o
+		LEFT JOIN entities e ON e.id = o.id
+		LEFT JOIN entity_ratings r ON r.entity_id = o.id
+	WHERE ` + visibility + ` AND o.type <> 'NFT' AND o.name ILIKE $2::text
+	ORDER BY score DESC, o.id
+	OFFSET $3 LIMIT $4)
+SELECT
+	o.id,
+	o.type,
+	o.name,
+	o.artist,
+	o.date,
+	o.description,
+	o.medium,
+	o.width,
+	o.height,
+	o.scale_multiplier,
+	o.source,
+	o.source_url,
+	o.license,
+	o.copyright,
+	o.credit,
+	o.origin,
+	o.location,
+	o.dimensions,
+	owner.name ownerName,
+	f.id fId,
+	f.type fType,
+	f.mime fMime,
+	f.url fUrl,
+	l2.value liked,
+	r.total_likes,
+	r.total_dislikes,
+	e.views
+FROM t
+	LEFT JOIN objects o ON o.id = t.id
+   	LEFT JOIN entities e ON e.id = o.id
+	LEFT JOIN files f ON f.entity_id = e.id AND f.derivative_of IS NULL
+    LEFT JOIN accessibles a on e.id = a.entity_id AND a.is_owner
+	LEFT JOIN users owner ON owner.id = a.user_id
+	LEFT JOIN entity_ratings r ON r.entity_id = e.id
+	LEFT JOIN likables l2 ON l2.entity_id = e.id AND l2.user_id = $1
+ORDER BY t.score DESC, o.id`
+
+	rows, err = db.Query(ctx, q, requester.Id /*$1*/, query /*$2*/, offset /*$3*/, limit /*$4*/)
+
+	if err != nil {
+		logrus.Errorf("failed to query %s @ %s: %v", objectPlural, reflect.FunctionName(), err)
+		return nil, -1, fmt.Errorf("failed to get %s", objectPlural)
+	}
+
+	defer func() {
+		rows.Close()
+		database.LogPgxStat("GetArtObjectsTrending")
+	}()
+	for rows.Next() {
+		var (
+			o         ArtObject
+			fileId    pgtypeuuid.UUID
+			fileType  *string
+			fileMime  *string
+			fileUrl   *string
+			ownerName *string
+		)
+
+		err = rows.Scan(
+			&o.Id,
+			&o.ObjectType,
+			&o.Name,
+			&o.Artist,
+			&o.Date,
+			&o.Description,
+			&o.Medium,
+			&o.Width,
+			&o.Height,
+			&o.ScaleMultiplier,
+			&o.Source,
+			&o.SourceUrl,
+			&o.License,
+			&o.Copyright,
+			&o.Credit,
+			&o.Origin,
+			&o.Location,
+			&o.Dimensions,
+			&ownerName,
+			&fileId,
+			&fileType,
+			&fileMime,
+			&fileUrl,
+			&o.Liked,
+			&o.TotalLikes,
+			&o.TotalDislikes,
+			&o.Views,
+		)
+
+		if err != nil {
+			logrus.Errorf("failed to scan %s @ %s: %v", objectPlural, reflect.FunctionName(), err)
+			return nil, -1, fmt.Errorf("failed to get %s", objectPlural)
+		}
+
+		var file *File
+		if fileId.Status != pgtype.Null {
+			file = new(File)
+			file.Id = &fileId.UUID
+
+			if fileType != nil {
+				file.Type = *fileType
+			}
+
+			if fileMime != nil {
+				file.Mime = fileMime
+			}
+
+			if fileUrl != nil {
+				file.Url = *fileUrl
+			}
+		}
+
+		if i := findArtObject(objects, o.Id); i >= 0 {
+			if file != nil && !containsFile(objects[i].Files, *file.Id) {
+				objects[i].Files = append(objects[i].Files, *file)
+			}
+			continue
+		}
+
+		if file != nil {
+			o.Files = append(o.Files, *file)
+		}
+
+		if o.TotalLikes == nil {
+			o.TotalLikes = new(int32)
+			*o.TotalLikes = 0
+		}
+
+		if o.TotalDislikes == nil {
+			o.TotalDislikes = new(int32)
+			*o.TotalDislikes = 0
+		}
+
+		o.Owner = new(User)
+		if ownerName != nil {
+			o.Owner.Name = ownerName
+		}
+
+		objects = append(objects, o)
+	}
+
+	return objects, total, nil
+}
@@ -0,0 +1,331 @@
+package model
+
+import (
+	"context"
+	sm "dev.hackerman.me/artheon/veverse-shared/model"
+	"errors"
+	"fmt"
+	"github.com/gofrs/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/sirupsen/logrus"
+	"veverse-api/database"
+	"veverse-api/reflect"
+)
+
+const (
+	ObjectBatchCreate = "create"
+	ObjectBatchUpdate = "update"
+	ObjectBatchDelete = "delete"
+)
+
+const (
+	ObjectBatchStatusOk      = "ok"
+	ObjectBatchStatusError   = "error"
+	ObjectBatchStatusSkipped = "skipped" // Valid operation not applied because of errors of other operations
+)
+
+const ObjectBatchMaxOperations = 1000
+
+var ErrObjectBatchInvalid = errors.New("invalid operations")
+
+// ObjectBatchOperation is the create, update or delete operation of the world object, transform properties not set are kept on update
+type ObjectBatchOperation struct {
+	Op               string     `json:"op"`                         // create, update or delete
+	Id               *uuid.UUID `json:"id,omitempty"`               // Object to update or delete, ignored on create
+	EntityId         *uuid.UUID `json:"entityId,omitempty"`         // Linked entity
+	PlaceableClassId *uuid.UUID `json:"placeableClassId,omitempty"` // Required on create
+	OffsetX          *float64   `json:"offsetX,omitempty"`
+	OffsetY          *float64   `json:"offsetY,omitempty"`
+	OffsetZ          *float64   `json:"offsetZ,omitempty"`
+	RotationX        *float64   `json:"rotationX,omitempty"`
+	RotationY        *float64   `json:"rotationY,omitempty"`
+	RotationZ        *float64   `json:"rotationZ,omitempty"`
+	ScaleX           *float64   `json:"scaleX,omitempty"` // Default 1 on create
+	ScaleY           *float64   `json:"scaleY,omitempty"` // Default 1 on create
+	ScaleZ           *float64   `json:"scaleZ,omitempty"` // Default 1 on create
+}
+
+// ObjectBatchEditMetadata Batch edit request metadata for Object entities of the world
+type ObjectBatchEditMetadata struct {
+	Operations []ObjectBatchOperation `json:"operations"`
+}
+
+// ObjectBatchResult is the result of the operation with the same index
+type ObjectBatchResult struct {
+	Index  int        `json:"index"`
+	Op     string     `json:"op"`
+	Id     *uuid.UUID `json:"id,omitempty"` // Id of the object, new objects get generated ids
+	Status string     `json:"status"`       // ok, error or skipped
+	Error  string     `json:"error,omitempty"`
+}
+
+func defaultObjectScale(v *float64) float64 {
+	if v == nil {
+		return 1
+	}
+	return *v
+}
+
+// queryExistingIds returns the subset of ids found by the query
+func queryExistingIds(ctx context.Context, tx pgx.Tx, q string, args ...interface{}) (ids map[uuid.UUID]bool, err error) {
+	rows, err := tx.Query(ctx, q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids = map[uuid.UUID]bool{}
+	for rows.Next() {
+		var id uuid.UUID
+		if err = rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids[id] = true
+	}
+
+	return ids, rows.Err()
+}
+
+// validateObjectBatch Checks operations against the world objects, classes and linked entities, returns the results with errors of invalid operations, linked entities have to be viewable by the viewer unless it is nil
+func validateObjectBatch(ctx context.Context, tx pgx.Tx, viewer *sm.User, worldId uuid.UUID, ops []ObjectBatchOperation) (results []ObjectBatchResult, valid bool, err error) {
+	var (
+		objectIds []uuid.UUID
+		classIds  []uuid.UUID
+		entityIds []uuid.UUID
+	)
+
+	for _, op := range ops {
+		if op.Id != nil && op.Op != ObjectBatchCreate {
+			objectIds = append(objectIds, *op.Id)
+		}
+		if op.PlaceableClassId != nil {
+			classIds = append(classIds, *op.PlaceableClassId)
+		}
+		if op.EntityId != nil {
+			entityIds = append(entityIds, *op.EntityId)
+		}
+	}
+
+	// Objects are locked until the end of the tx so concurrent batches can not change them
+	objects, err := queryExistingIds(ctx, tx, `SELECT p.id FROM placeables p WHERE p.space_id = $1 AND p.id = ANY($2) FOR UPDATE`, worldId /*$1*/, objectIds /*$2*/)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to query %s: %v", objectPlural, err)
+	}
+
+	classes, err := queryExistingIds(ctx, tx, `SELECT pc.id FROM placeable_classes pc WHERE pc.id = ANY($1)`, classIds /*$1*/)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to query classes: %v", err)
+	}
+
+	var entities map[uuid.UUID]bool
+	if viewer == nil {
+		entities, err = queryExistingIds(ctx, tx, `SELECT e.id FROM entities e WHERE e.id = ANY($1)`, entityIds /*$1*/)
+	} else {
+		// Entities the requester can not view are reported as not found
+		q := `SELECT e.id FROM entities e LEFT JOIN accessibles a ON a.entity_id = e.id AND a.user_id = $2 WHERE e.id = ANY($1) AND (coalesce(e.public, false) OR coalesce(a.can_view OR a.is_owner, false))`
+		entities, err = queryExistingIds(ctx, tx, q, entityIds /*$1*/, viewer.Id /*$2*/)
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to query entities: %v", err)
+	}
+
+	valid = true
+	results = make([]ObjectBatchResult, len(ops))
+	for i, op := range ops {
+		r := ObjectBatchResult{Index: i, Op: op.Op, Status: ObjectBatchStatusSkipped}
+
+		var reason string
+		switch op.Op {
+		case ObjectBatchCreate:
+			if op.PlaceableClassId == nil || op.PlaceableClassId.IsNil() {
+				reason = "no class"
+			}
+		case ObjectBatchUpdate, ObjectBatchDelete:
+			if op.Id == nil || op.Id.IsNil() {
+				reason = "no id"
+			} else if !objects[*op.Id] {
+				reason = "object not found"
+			} else if op.Op == ObjectBatchDelete {
+				// Later operations can not refer to the deleted object
+				delete(objects, *op.Id)
+			}
+			r.Id = op.Id
+		default:
+			reason = fmt.Sprintf("unsupported op %q", op.Op)
+		}
+
+		if reason == "" && op.Op != ObjectBatchDelete {
+			if op.PlaceableClassId != nil && !classes[*op.PlaceableClassId] {
+				reason = "class not found"
+			} else if op.EntityId != nil && !entities[*op.EntityId] {
+				reason = "entity not found"
+			}
+		}
+
+		if reason != "" {
+			r.Status = ObjectBatchStatusError
+			r.Error = reason
+			valid = false
+		}
+
+		results[i] = r
+	}
+
+	return results, valid, nil
+}
+
+// applyObjectBatchOperation Executes the validated operation, returns the id of the object
+func applyObjectBatchOperation(ctx context.Context, tx pgx.Tx, requester *sm.User, worldId uuid.UUID, public bool, op ObjectBatchOperation) (id uuid.UUID, err error) {
+	switch op.Op {
+	case ObjectBatchCreate:
+		if id, err = uuid.NewV4(); err != nil {
+			return id, fmt.Errorf("failed to generate uuid: %v", err)
+		}
+
+		q := `INSERT INTO entities (id, entity_type, public) VALUES ($1, $2, $3)`
+		if _, err = tx.Exec(ctx, q, id /*$1*/, "placeable" /*$2*/, public /*$3*/); err != nil {
+			return id, err
+		}
+
+		q = `INSERT INTO accessibles (user_id, entity_id, is_owner, can_view, can_edit, can_delete) VALUES ($1, $2, true, true, true, true)`
+		if _, err = tx.Exec(ctx, q, requester.Id /*$1*/, id /*$2*/); err != nil {
+			return id, err
+		}
+
+		q = `INSERT INTO placeables (id, space_id, entity_id, placeable_class_id, offset_x, offset_y, offset_z, rotation_x, rotation_y, rotation_z, scale_x, scale_y, scale_z)
+VALUES ($1, $2, $3, $4, coalesce($5, 0), coalesce($6, 0), coalesce($7, 0), coalesce($8, 0), coalesce($9, 0), coalesce($10, 0), $11, $12, $13)`
+		_, err = tx.Exec(ctx, q, id /*$1*/, worldId /*$2*/, op.EntityId /*$3*/, op.PlaceableClassId /*$4*/, op.OffsetX /*$5*/, op.OffsetY /*$6*/, op.OffsetZ /*$7*/, op.RotationX /*$8*/, op.RotationY /*$9*/, op.RotationZ /*$10*/, defaultObjectScale(op.ScaleX) /*$11*/, defaultObjectScale(op.ScaleY) /*$12*/, defaultObjectScale(op.ScaleZ) /*$13*/)
+		return id, err
+
+	case ObjectBatchUpdate:
+		id = *op.Id
+
+		q := `UPDATE placeables
+SET entity_id          = coalesce($3, entity_id),
+    placeable_class_id = coalesce($4, placeable_class_id),
+    offset_x           = coalesce($5, offset_x),
+    offset_y           = coalesce($6, offset_y),
+    offset_z           = coalesce($7, offset_z),
+    rotation_x         = coalesce($8, rotation_x),
+    rotation_y         = coalesce($9, rotation_y),
+    rotation_z         = coalesce($10, rotation_z),
+    scale_x            = coalesce($11, scale_x),
+    scale_y            = coalesce($12, scale_y),
+    scale_z            = coalesce($13, scale_z)
+WHERE id = $1
+  AND space_id = $2`
+		_, err = tx.Exec(ctx, q, id /*$1*/, worldId /*$2*/, op.EntityId /*$3*/, op.PlaceableClassId /*$4*/, op.OffsetX /*$5*/, op.OffsetY /*$6*/, op.OffsetZ /*$7*/, op.RotationX /*$8*/, op.RotationY /*$9*/, op.RotationZ /*$10*/, op.ScaleX /*$11*/, op.ScaleY /*$12*/, op.ScaleZ /*$13*/)
+		if err != nil {
+			return id, err
+		}
+
+		q = `UPDATE entities SET updated_at = now() WHERE id = $1`
+		_, err = tx.Exec(ctx, q, id /*$1*/)
+		return id, err
+
+	case ObjectBatchDelete:
+		id = *op.Id
+
+		q := `DELETE FROM placeables WHERE id = $1 AND space_id = $2`
+		if _, err = tx.Exec(ctx, q, id /*$1*/, worldId /*$2*/); err != nil {
+			return id, err
+		}
+
+		q = `DELETE FROM entities WHERE id = $1`
+		_, err = tx.Exec(ctx, q, id /*$1*/)
+		return id, err
+	}
+
+	return id, fmt.Errorf("unsupported op %q", op.Op)
+}
+
+// batchWorldObjects Applies all operations in a single tx, nothing is applied if any operation fails, admins can link any entity
+func batchWorldObjects(ctx context.Context, requester *sm.User, admin bool, worldId uuid.UUID, ops []ObjectBatchOperation) (results []ObjectBatchResult, err error) {
+	db := database.DB
+
+	tx, err1 := db.Begin(ctx)
+	if err1 != nil {
+		return nil, fmt.Errorf("failed to begin tx: %v", err1)
+	}
+
+	// New objects inherit the visibility of the world
+	var public bool
+	q := `SELECT coalesce(e.public, false) FROM spaces s JOIN entities e ON e.id = s.id WHERE s.id = $1`
+	err1 = tx.QueryRow(ctx, q, worldId /*$1*/).Scan(&public)
+	if err1 == nil {
+		viewer := requester
+		if admin {
+			viewer = nil
+		}
+
+		var valid bool
+		results, valid, err1 = validateObjectBatch(ctx, tx, viewer, worldId, ops)
+		if err1 == nil && !valid {
+			err1 = ErrObjectBatchInvalid
+		}
+	}
+
+	if err1 == nil {
+		// The layout before the edit can be restored
+		_, err1 = takeAutomaticWorldSnapshot(ctx, tx, requester, worldId, "before batch edit")
+	}
+
+	if err1 == nil {
+		for i, op := range ops {
+			var id uuid.UUID
+			if id, err1 = applyObjectBatchOperation(ctx, tx, requester, worldId, public, op); err1 != nil {
+				logrus.Errorf("failed to apply %s %s operation %d @ %s: %v", objectSingular, op.Op, i, reflect.FunctionName(), err1)
+				results[i].Status = ObjectBatchStatusError
+				results[i].Error = "failed to apply the operation"
+				err1 = fmt.Errorf("failed to apply operation %d: %v", i, err1)
+				break
+			}
+
+			results[i].Id = &id
+			results[i].Status = ObjectBatchStatusOk
+		}
+	}
+
+	if err1 != nil {
+		if err2 := tx.Rollback(ctx); err2 != nil {
+			return nil, fmt.Errorf("failed to rollback failed tx: %v, %v", err1, err2)
+		}
+
+		// Applied operations have been rolled back
+		for i := range results {
+			if results[i].Status == ObjectBatchStatusOk {
+				results[i].Status = ObjectBatchStatusSkipped
+				if ops[i].Op == ObjectBatchCreate {
+					results[i].Id = nil
+				}
+			}
+		}
+
+		return results, err1
+	}
+
+	if err1 = tx.Commit(ctx); err1 != nil {
+		return nil, fmt.Errorf("failed to commit tx: %v", err1)
+	}
+
+	return results, nil
+}
+
+// BatchWorldObjectsForAdmin Applies create, update and delete operations to objects of the world in a single tx
+func BatchWorldObjectsForAdmin(ctx context.Context, requester *sm.User, worldId uuid.UUID, ops []ObjectBatchOperation) (results []ObjectBatchResult, err error) {
+	return batchWorldObjects(ctx, requester, true, worldId, ops)
+}
+
+// BatchWorldObjectsForRequester Applies create, update and delete operations to objects of the world in a single tx if the requester can edit the world and view the linked entities
+func BatchWorldObjectsForRequester(ctx context.Context, requester *sm.User, worldId uuid.UUID, ops []ObjectBatchOperation) (results []ObjectBatchResult, err error) {
+	canEdit, err := EntityEditable(ctx, requester.Id, worldId)
+	if err != nil {
+		return nil, err
+	}
+
+	if !canEdit {
+		return nil, errors.New("no access")
+	}
+
+	return batchWorldObjects(ctx, requester, false, worldId, ops)
+}
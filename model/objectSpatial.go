@@ -0,0 +1,283 @@
+package model
+
+import (
+	"context"
+	sm "dev.hackerman.me/artheon/veverse-shared/model"
+	"errors"
+	"fmt"
+	"github.com/gofrs/uuid"
+	"math"
+	"strings"
+	"veverse-api/database"
+	"veverse-api/reflect"
+)
+
+// ErrInvalidSpatialQuery is returned for incomplete or inconsistent spatial filters
+var ErrInvalidSpatialQuery = errors.New("invalid spatial query")
+
+// ObjectSpatialQuery is a spatial filter of world objects by their offset, filters are combined
+type ObjectSpatialQuery struct {
+	// Point to measure distance from, objects are ordered by distance if set
+	X *float64 `query:"x"`
+	Y *float64 `query:"y"`
+	Z *float64 `query:"z"`
+
+	Radius *float64 `query:"radius"` // Objects within the radius of the point
+
+	// Objects inside the axis-aligned box
+	MinX *float64 `query:"minX"`
+	MinY *float64 `query:"minY"`
+	MinZ *float64 `query:"minZ"`
+	MaxX *float64 `query:"maxX"`
+	MaxY *float64 `query:"maxY"`
+	MaxZ *float64 `query:"maxZ"`
+
+	Nearest int64 `query:"nearest"` // Number of objects nearest to the point, overrides the offset and the limit, the total is not counted
+}
+
+// IsSet returns true if any of the spatial filters is set
+func (q ObjectSpatialQuery) IsSet() bool {
+	return q.Radius != nil || q.Nearest > 0 ||
+		q.X != nil || q.Y != nil || q.Z != nil ||
+		q.MinX != nil || q.MinY != nil || q.MinZ != nil || q.MaxX != nil || q.MaxY != nil || q.MaxZ != nil
+}
+
+func (q ObjectSpatialQuery) hasPoint() bool {
+	return q.X != nil && q.Y != nil && q.Z != nil
+}
+
+func (q ObjectSpatialQuery) hasBox() bool {
+	return q.MinX != nil && q.MinY != nil && q.MinZ != nil && q.MaxX != nil && q.MaxY != nil && q.MaxZ != nil
+}
+
+// Validate checks that the point and the box are complete and the radius and nearest filters have the point
+func (q ObjectSpatialQuery) Validate() error {
+	if (q.X != nil || q.Y != nil || q.Z != nil) && !q.hasPoint() {
+		return fmt.Errorf("%w: point requires x, y and z", ErrInvalidSpatialQuery)
+	}
+
+	if (q.MinX != nil || q.MinY != nil || q.MinZ != nil || q.MaxX != nil || q.MaxY != nil || q.MaxZ != nil) && !q.hasBox() {
+		return fmt.Errorf("%w: box requires minX, minY, minZ, maxX, maxY and maxZ", ErrInvalidSpatialQuery)
+	}
+
+	if q.hasBox() && (*q.MinX > *q.MaxX || *q.MinY > *q.MaxY || *q.MinZ > *q.MaxZ) {
+		return fmt.Errorf("%w: box min is greater than max", ErrInvalidSpatialQuery)
+	}
+
+	if q.Radius != nil && (!q.hasPoint() || *q.Radius < 0 || math.IsNaN(*q.Radius)) {
+		return fmt.Errorf("%w: radius requires the point and must not be negative", ErrInvalidSpatialQuery)
+	}
+
+	if q.Nearest < 0 || (q.Nearest > 0 && !q.hasPoint()) {
+		return fmt.Errorf("%w: nearest requires the point", ErrInvalidSpatialQuery)
+	}
+
+	return nil
+}
+
+// objectSpatialQueryBuilder composes the spatial object index query with positional arguments
+type objectSpatialQueryBuilder struct {
+	conditions []string
+	args       []interface{}
+	distance   string // Distance expression if the point is set
+}
+
+// arg adds the argument and returns its placeholder
+func (b *objectSpatialQueryBuilder) arg(v interface{}) string {
+	b.args = append(b.args, v)
+	return fmt.Sprintf("$%d", len(b.args))
+}
+
+func (b *objectSpatialQueryBuilder) where(condition string) {
+	b.conditions = append(b.conditions, condition)
+}
+
+func (b *objectSpatialQueryBuilder) from() string {
+	return `FROM placeables p
+    LEFT JOIN entities pe ON pe.id = p.id
+    LEFT JOIN placeable_classes pc ON pc.id = p.placeable_class_id
+WHERE ` + strings.Join(b.conditions, "\n  AND ")
+}
+
+// newObjectSpatialQueryBuilder Adds the world and spatial filters, requester visibility is added if the requester is set
+func newObjectSpatialQueryBuilder(requester *sm.User, worldId uuid.UUID, query ObjectSpatialQuery) *objectSpatialQueryBuilder {
+	b := &objectSpatialQueryBuilder{}
+
+	b.where("p.space_id = " + b.arg(worldId))
+
+	if requester != nil {
+		b.where("(pe.public OR EXISTS(SELECT 1 FROM accessibles a WHERE a.entity_id = pe.id AND a.user_id = " + b.arg(requester.Id) + "::uuid AND (a.can_view OR a.is_owner)))")
+	}
+
+	// Containment in the cube is answered by the index, the radius is checked precisely afterwards
+	if query.hasBox() {
+		b.where(fmt.Sprintf("p.position <@ cube(%s::float8[], %s::float8[])",
+			b.arg([]float64{*query.MinX, *query.MinY, *query.MinZ}),
+			b.arg([]float64{*query.MaxX, *query.MaxY, *query.MaxZ})))
+	}
+
+	if query.hasPoint() {
+		point := b.arg([]float64{*query.X, *query.Y, *query.Z})
+		b.distance = fmt.Sprintf("(p.position <-> cube(%s::float8[]))", point)
+
+		if query.Radius != nil {
+			r := *query.Radius
+			b.where(fmt.Sprintf("p.position <@ cube(%s::float8[], %s::float8[])",
+				b.arg([]float64{*query.X - r, *query.Y - r, *query.Z - r}),
+				b.arg([]float64{*query.X + r, *query.Y + r, *query.Z + r})))
+			b.where(b.distance + " <= " + b.arg(r))
+		}
+	}
+
+	return b
+}
+
+// indexSpatialObjectsForWorld Index world objects matching the spatial query ordered by the distance to the point if set, the total is -1 for the nearest objects
+func indexSpatialObjectsForWorld(ctx context.Context, requester *sm.User, worldId uuid.UUID, query ObjectSpatialQuery, offset int64, limit int64) (entities []Object, total int64, err error) {
+	if err = query.Validate(); err != nil {
+		return nil, -1, err
+	}
+
+	db := database.DB
+
+	b := newObjectSpatialQueryBuilder(requester, worldId, query)
+
+	entities = []Object{}
+
+	// The nearest objects are not paged, so matching objects are not counted
+	total = -1
+	if query.Nearest > 0 {
+		offset, limit = 0, query.Nearest
+	} else {
+		if err = db.QueryRow(ctx, "SELECT COUNT(*) "+b.from(), b.args...).Scan(&total); err != nil {
+			return nil, -1, err
+		}
+
+		if total == 0 {
+			return entities, 0, nil
+		}
+	}
+
+	distance, order := "NULL::float8", "p.id"
+	if b.distance != "" {
+		distance, order = b.distance, b.distance+", p.id"
+	}
+
+	q := fmt.Sprintf(`SELECT p.id,
+       p.entity_id,
+       p.offset_x, p.offset_y, p.offset_z,
+       p.rotation_x, p.rotation_y, p.rotation_z,
+       p.scale_x, p.scale_y, p.scale_z,
+       pe.public,
+       pc.id,
+       pc.cls,
+       %s
+%s
+ORDER BY %s
+OFFSET %s LIMIT %s`, distance, b.from(), order, b.arg(offset), b.arg(limit))
+
+	rows, err := db.Query(ctx, q, b.args...)
+	if err != nil {
+		return nil, -1, fmt.Errorf("failed to query %s @ %s: %v", objectPlural, reflect.FunctionName(), err)
+	}
+
+	var ids []uuid.UUID
+	index := map[uuid.UUID]int{}
+	for rows.Next() {
+		var (
+			e        Object
+			id       uuid.UUID
+			classId  *uuid.UUID
+			class    *string
+			distance *float64
+		)
+
+		err = rows.Scan(&id, &e.EntityId,
+			&e.OffsetX, &e.OffsetY, &e.OffsetZ,
+			&e.RotationX, &e.RotationY, &e.RotationZ,
+			&e.ScaleX, &e.ScaleY, &e.ScaleZ,
+			&e.Public, &classId, &class, &distance)
+		if err != nil {
+			rows.Close()
+			return nil, -1, err
+		}
+
+		e.Id = &id
+		e.WorldId = &worldId
+		e.Distance = distance
+		e.Class.Id = classId
+		if class != nil {
+			e.Class.Class = *class
+		}
+
+		index[id] = len(entities)
+		ids = append(ids, id)
+		entities = append(entities, e)
+	}
+	rows.Close()
+	database.LogPgxStat("indexSpatialObjectsForWorld")
+
+	if err = rows.Err(); err != nil {
+		return nil, -1, err
+	}
+
+	if len(ids) == 0 {
+		return entities, total, nil
+	}
+
+	//region Files
+	q = `SELECT f.id, f.entity_id, f.type, f.mime, f.url FROM files f WHERE f.entity_id = ANY($1) AND f.type != 'image_full' AND f.derivative_of IS NULL ORDER BY f.type, f.variation`
+	rows, err = db.Query(ctx, q, ids /*$1*/)
+	if err != nil {
+		return nil, -1, fmt.Errorf("failed to query files: %v", err)
+	}
+
+	for rows.Next() {
+		var f File
+		if err = rows.Scan(&f.Id, &f.EntityId, &f.Type, &f.Mime, &f.Url); err != nil {
+			rows.Close()
+			return nil, -1, err
+		}
+		i := index[*f.EntityId]
+		entities[i].Files = append(entities[i].Files, f)
+	}
+	rows.Close()
+
+	if err = rows.Err(); err != nil {
+		return nil, -1, err
+	}
+	//endregion
+
+	//region Properties
+	q = `SELECT p.entity_id, p.type, p.name, p.value FROM properties p WHERE p.entity_id = ANY($1) ORDER BY p.name`
+	rows, err = db.Query(ctx, q, ids /*$1*/)
+	if err != nil {
+		return nil, -1, fmt.Errorf("failed to query properties: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			entityId uuid.UUID
+			p        Property
+		)
+		if err = rows.Scan(&entityId, &p.Type, &p.Name, &p.Value); err != nil {
+			return nil, -1, err
+		}
+		i := index[entityId]
+		entities[i].Properties = append(entities[i].Properties, p)
+	}
+	//endregion
+
+	return entities, total, rows.Err()
+}
+
+// IndexSpatialObjectsForAdminForWorld Index world objects matching the spatial query for admin
+func IndexSpatialObjectsForAdminForWorld(ctx context.Context, worldId uuid.UUID, query ObjectSpatialQuery, offset int64, limit int64) (entities []Object, total int64, err error) {
+	return indexSpatialObjectsForWorld(ctx, nil, worldId, query, offset, limit)
+}
+
+// IndexSpatialObjectsForRequesterForWorld Index world objects matching the spatial query the requester can view
+func IndexSpatialObjectsForRequesterForWorld(ctx context.Context, requester *sm.User, worldId uuid.UUID, query ObjectSpatialQuery, offset int64, limit int64) (entities []Object, total int64, err error) {
+	return indexSpatialObjectsForWorld(ctx, requester, worldId, query, offset, limit)
+}
@@ -32,6 +32,9 @@ type Package struct {
 	Release       string     `json:"release,omitempty"`
 	Price         *float64   `json:"price,omitempty"`
 	Version       string     `json:"version,omitempty"`
+	VersionId     *uuid.UUID `json:"versionId,omitempty"` // Published version the version and pak files belong to
+	Changelog     string     `json:"changelog,omitempty"`
+	Deprecated    bool       `json:"deprecated,omitempty"`
 	ReleasedAt    *time.Time `json:"releasedAt,omitempty"`
 	Downloads     *int32     `json:"downloads,omitempty"`
 	Liked         *int32     `json:"liked,omitempty"`
@@ -50,6 +53,7 @@ type PackageRequestMetadata struct {
 	IdRequestMetadata
 	Platform   string `json:"platform,omitempty"`   // SupportedPlatform (OS) of the destination pak file (Win64, Mac, Linux, IOS, Android)
 	Deployment string `json:"deployment,omitempty"` // SupportedDeployment for the destination pak file (Server or Client)
+	Version    string `json:"version,omitempty"`    // Published version of the package, the latest version by default
 }
 
 type PackageCreateMetadata struct {
@@ -71,7 +75,8 @@ type PackageUpdateMetadata struct {
 	Description *string `json:"description,omitempty"` // Full Description
 	Release     *string `json:"releaseName,omitempty"` // Release
 	Map         *string `json:"map,omitempty"`         // Map (list of maps included into the package)
-	Version     *string `json:"version,omitempty"`     // Version of the package
+	Version     *string `json:"version,omitempty"`     // Version of the package, a new version is published if it differs from the current one
+	Changelog   *string `json:"changelog,omitempty"`   // Changelog of the published version
 }
 
 func findPackage(h []Package, id uuid.UUID) int {
@@ -125,14 +130,14 @@ func IndexPackagesForAdmin(ctx context.Context, requester *sm.User, offset int64
 	u.id 					ownerId,
 	u.name 					ownerName,
 	l2.value				liked,
-	sum(case when l.value >= 0 then l.value end) as total_likes,
-	sum(case when l.value < 0 then l.value end) as total_dislikes
+	r.total_likes,
+	r.total_dislikes
 FROM mods m
 	LEFT JOIN entities e on m.id = e.id
-	LEFT JOIN files preview ON e.id = preview.entity_id
+	LEFT JOIN files preview ON e.id = preview.entity_id AND preview.derivative_of IS NULL
 	LEFT JOIN accessibles aa on e.id = aa.entity_id
 	LEFT JOIN users u ON aa.user_id = u.id AND aa.is_owner
-	LEFT JOIN likables l ON l.entity_id = e.id
+	LEFT JOIN entity_ratings r ON r.entity_id = e.id
 	LEFT JOIN likables l2 ON l2.entity_id = e.id AND l2.user_id = $1
 GROUP BY m.id,
 		e.id,
@@ -151,7 +156,7 @@ GROUP BY m.id,
 		l2.value,
 		e.updated_at,
 		e.created_at,
-		aa.created_at
+		aa.created_at, r.total_likes, r.total_dislikes
 ORDER BY e.updated_at DESC, e.created_at DESC, aa.created_at, e.id`
 
 	var (
@@ -369,15 +374,15 @@ func IndexPackagesForAdminWithPak(ctx context.Context, requester *sm.User, offse
 	u.id 					ownerId,
 	u.name 					ownerName,
 	l2.value				liked,
-	sum(case when l.value >= 0 then l.value end) as total_likes,
-	sum(case when l.value < 0 then l.value end) as total_dislikes
+	r.total_likes,
+	r.total_dislikes
 FROM mods m
     LEFT JOIN entities e ON m.id = e.id
-	LEFT JOIN files pak ON pak.entity_id = m.id AND pak.type = 'pak' AND pak.platform = $1::text AND pak.deployment_type = $2::text
+	LEFT JOIN files pak ON pak.entity_id = coalesce(package_latest_version(m.id, $1::text, $2::text), m.id) AND pak.type = 'pak' AND pak.platform = $1::text AND pak.deployment_type = $2::text
 	LEFT JOIN files preview ON e.id = preview.entity_id AND preview.type = 'image_preview'
 	LEFT JOIN accessibles aa on e.id = aa.entity_id
 	LEFT JOIN users u ON aa.user_id = u.id AND aa.is_owner
-	LEFT JOIN likables l ON l.entity_id = e.id
+	LEFT JOIN entity_ratings r ON r.entity_id = e.id
 	LEFT JOIN likables l2 ON l2.entity_id = e.id AND l2.user_id = $3
 GROUP BY m.id,
 	 	e.id,
@@ -405,7 +410,7 @@ GROUP BY m.id,
 		l2.value,
 		e.updated_at,
 		e.created_at,
-		aa.created_at
+		aa.created_at, r.total_likes, r.total_dislikes
 ORDER BY e.updated_at DESC, e.created_at DESC, aa.created_at, e.id`
 
 	var (
@@ -672,14 +677,14 @@ func IndexPackagesForAdminWithQuery(ctx context.Context, requester *sm.User, off
 	u.id 					ownerId,
 	u.name 					ownerName,
 	l2.value				liked,
-	sum(case when l.value >= 0 then l.value end) as total_likes,
-	sum(case when l.value < 0 then l.value end) as total_dislikes
+	r.total_likes,
+	r.total_dislikes
 FROM mods m
     LEFT JOIN entities e ON m.id = e.id
-	LEFT JOIN files preview ON e.id = preview.entity_id
+	LEFT JOIN files preview ON e.id = preview.entity_id AND preview.derivative_of IS NULL
 	LEFT JOIN accessibles a on e.id = a.entity_id
 	LEFT JOIN users u ON a.user_id = u.id AND a.is_owner
-	LEFT JOIN likables l ON l.entity_id = e.id
+	LEFT JOIN entity_ratings r ON r.entity_id = e.id
 	LEFT JOIN likables l2 ON l2.entity_id = e.id AND l2.user_id = $1
 WHERE m.name ILIKE $2::text
 GROUP BY m.id,
@@ -699,7 +704,7 @@ GROUP BY m.id,
 		l2.value,
 		e.updated_at,
 		e.created_at,
-		a.created_at
+		a.created_at, r.total_likes, r.total_dislikes
 ORDER BY e.updated_at DESC, e.created_at DESC, a.created_at, e.id`
 
 	var (
@@ -918,15 +923,15 @@ func IndexPackagesForAdminWithQueryWithPak(ctx context.Context, requester *sm.Us
 	u.id 					ownerId,
 	u.name 					ownerName,
 	l2.value				liked,
-	sum(case when l.value >= 0 then l.value end) as total_likes,
-	sum(case when l.value < 0 then l.value end) as total_dislikes
+	r.total_likes,
+	r.total_dislikes
 FROM mods m
     LEFT JOIN entities e ON m.id = e.id
-	LEFT JOIN files pak ON pak.entity_id = m.id AND pak.type = 'pak' AND pak.platform = $1::text AND pak.deployment_type = $2::text
+	LEFT JOIN files pak ON pak.entity_id = coalesce(package_latest_version(m.id, $1::text, $2::text), m.id) AND pak.type = 'pak' AND pak.platform = $1::text AND pak.deployment_type = $2::text
 	LEFT JOIN files preview ON e.id = preview.entity_id AND preview.type = 'image_preview'
 	LEFT JOIN accessibles a on e.id = a.entity_id
 	LEFT JOIN users u ON a.user_id = u.id AND a.is_owner
-	LEFT JOIN likables l ON l.entity_id = e.id
+	LEFT JOIN entity_ratings r ON r.entity_id = e.id
 	LEFT JOIN likables l2 ON l2.entity_id = e.id AND l2.user_id = $4
 WHERE m.name ILIKE $3::text
 GROUP BY m.id,
@@ -955,7 +960,7 @@ GROUP BY m.id,
 		l2.value,
 		e.updated_at,
 		e.created_at,
-		a.created_at
+		a.created_at, r.total_likes, r.total_dislikes
 ORDER BY e.updated_at DESC, e.created_at DESC, a.created_at, e.id`
 
 	var (
@@ -1222,15 +1227,15 @@ WHERE e.public OR a.can_view OR a.is_owner`
 	u.id					ownerId,
 	u.name					ownerName,
 	l2.value				liked,
-	sum(case when l.value >= 0 then l.value end) as total_likes,
-	sum(case when l.value < 0 then l.value end) as total_dislikes
+	r.total_likes,
+	r.total_dislikes
 FROM mods m
     LEFT JOIN entities e ON m.id = e.id
 	LEFT JOIN files preview ON e.id = preview.entity_id AND preview.type = 'image_preview'
 	LEFT JOIN accessibles a ON e.id = a.entity_id AND a.user_id = $1::uuid
 	LEFT JOIN accessibles aa on e.id = aa.entity_id
 	LEFT JOIN users u ON aa.user_id = u.id AND aa.is_owner
-	LEFT JOIN likables l ON l.entity_id = e.id
+	LEFT JOIN entity_ratings r ON r.entity_id = e.id
 	LEFT JOIN likables l2 ON l2.entity_id = e.id AND l2.user_id = $1::uuid
 WHERE e.public OR a.can_view OR a.is_owner
 GROUP BY u.id,
@@ -1259,7 +1264,7 @@ GROUP BY u.id,
 		l2.value,
 		e.updated_at,
 		e.created_at,
-		aa.created_at
+		aa.created_at, r.total_likes, r.total_dislikes
 ORDER BY e.updated_at DESC, e.created_at DESC, aa.created_at, e.id`
 	var (
 		rows      pgx.Rows
@@ -1486,16 +1491,16 @@ WHERE /*e.public OR a.can_view*/ a.can_edit OR a.is_owner`
 	u.id 					ownerId,
 	u.name 					ownerName,
 	l2.value				liked,
-	sum(case when l.value >= 0 then l.value end) as total_likes,
-	sum(case when l.value < 0 then l.value end) as total_dislikes
+	r.total_likes,
+	r.total_dislikes
 FROM mods m
     LEFT JOIN entities e ON m.id = e.id
-	LEFT JOIN files pak ON pak.entity_id = m.id AND pak.type = 'pak' AND pak.platform = $1::text AND pak.deployment_type = $2::text
+	LEFT JOIN files pak ON pak.entity_id = coalesce(package_latest_version(m.id, $1::text, $2::text), m.id) AND pak.type = 'pak' AND pak.platform = $1::text AND pak.deployment_type = $2::text
 	LEFT JOIN files preview ON e.id = preview.entity_id AND preview.type = 'image_preview'
 	LEFT JOIN accessibles a ON e.id = a.entity_id AND a.user_id = $3::uuid
 	LEFT JOIN accessibles aa on e.id = aa.entity_id
 	LEFT JOIN users u ON aa.user_id = u.id AND aa.is_owner
-	LEFT JOIN likables l ON l.entity_id = e.id
+	LEFT JOIN entity_ratings r ON r.entity_id = e.id
 	LEFT JOIN likables l2 ON l2.entity_id = e.id AND l2.user_id = $3
 WHERE /*e.public OR a.can_view*/ a.can_edit OR a.is_owner
 GROUP BY m.id,
@@ -1524,7 +1529,7 @@ GROUP BY m.id,
 		l2.value,
 		e.updated_at,
 		e.created_at,
-		aa.created_at
+		aa.created_at, r.total_likes, r.total_dislikes
 ORDER BY e.updated_at DESC, e.created_at DESC, aa.created_at, e.id`
 
 	var (
@@ -1792,15 +1797,15 @@ WHERE m.name ILIKE $2::text OR m.title ILIKE $2::text AND (/*e.public OR a.can_v
 	u.id					ownerId,
 	u.name					ownerName,
 	l2.value				liked,
-	sum(case when l.value >= 0 then l.value end) as total_likes,
-	sum(case when l.value < 0 then l.value end) as total_dislikes
+	r.total_likes,
+	r.total_dislikes
 FROM mods m
     LEFT JOIN entities e ON m.id = e.id
 	LEFT JOIN files preview ON e.id = preview.entity_id AND preview.type = 'image_preview'
 	LEFT JOIN accessibles a ON e.id = a.entity_id AND a.user_id = $1::uuid
 	LEFT JOIN accessibles aa on e.id = aa.entity_id
 	LEFT JOIN users u ON aa.user_id = u.id AND aa.is_owner
-	LEFT JOIN likables l ON l.entity_id = e.id
+	LEFT JOIN entity_ratings r ON r.entity_id = e.id
 	LEFT JOIN likables l2 ON l2.entity_id = e.id AND l2.user_id = $1
 WHERE m.name ILIKE $2::text OR m.title ILIKE $2::text AND (/*e.public OR a.can_view*/ a.can_edit OR a.is_owner)
 GROUP BY m.id,
@@ -1820,7 +1825,7 @@ GROUP BY m.id,
 		l2.value,
 		e.updated_at,
 		e.created_at,
-		a.created_at
+		a.created_at, r.total_likes, r.total_dislikes
 ORDER BY e.updated_at DESC, e.created_at DESC, e.id`
 
 	var (
@@ -2043,16 +2048,16 @@ WHERE m.name ILIKE $2::text OR m.title ILIKE $2::text AND (/*e.public OR a.can_v
 	u.id 					ownerId,
 	u.name 					ownerName,
 	l2.value				liked,
-	sum(case when l.value >= 0 then l.value end) as total_likes,
-	sum(case when l.value < 0 then l.value end) as total_dislikes
+	r.total_likes,
+	r.total_dislikes
 FROM mods m
     LEFT JOIN entities e ON m.id = e.id
-	LEFT JOIN files pak ON pak.entity_id = m.id AND pak.type = 'pak' AND pak.platform = $1::text AND pak.deployment_type = $2::text
+	LEFT JOIN files pak ON pak.entity_id = coalesce(package_latest_version(m.id, $1::text, $2::text), m.id) AND pak.type = 'pak' AND pak.platform = $1::text AND pak.deployment_type = $2::text
 	LEFT JOIN files preview ON e.id = preview.entity_id AND preview.type = 'image_preview'
 	LEFT JOIN accessibles a ON e.id = a.entity_id AND a.user_id = $3 
 	LEFT JOIN accessibles aa on e.id = aa.entity_id
 	LEFT JOIN users u ON aa.user_id = u.id AND aa.is_owner
-	LEFT JOIN likables l ON l.entity_id = e.id
+	LEFT JOIN entity_ratings r ON r.entity_id = e.id
 	LEFT JOIN likables l2 ON l2.entity_id = e.id AND l2.user_id = $3
 WHERE (/*e.public OR a.can_view*/ a.can_edit OR a.is_owner) AND m.name ILIKE $4::text OR m.title ILIKE $4::text
 GROUP BY u.id,
@@ -2089,7 +2094,7 @@ GROUP BY u.id,
 		l2.value,
 		e.updated_at,
 		e.created_at,
-		aa.created_at
+		aa.created_at, r.total_likes, r.total_dislikes
 ORDER BY e.updated_at DESC, e.created_at DESC, aa.created_at, e.id`
 
 	var (
@@ -2349,15 +2354,15 @@ func GetPackageForAdminWithPak(ctx context.Context, requester *sm.User, id uuid.
 	u.id 					ownerId,
 	u.name 					ownerName,
 	l2.value				liked,
-	sum(case when l.value >= 0 then l.value end) as total_likes,
-	sum(case when l.value < 0 then l.value end) as total_dislikes
+	r.total_likes,
+	r.total_dislikes
 FROM mods m
     LEFT JOIN entities e ON m.id = e.id
-	LEFT JOIN files pak ON pak.entity_id = m.id AND pak.type = 'pak' AND pak.platform = $1::text AND pak.deployment_type = $2::text
+	LEFT JOIN files pak ON pak.entity_id = coalesce(package_latest_version(m.id, $1::text, $2::text), m.id) AND pak.type = 'pak' AND pak.platform = $1::text AND pak.deployment_type = $2::text
 	LEFT JOIN files preview ON e.id = preview.entity_id AND preview.type = 'image_preview'
 	LEFT JOIN accessibles aa on e.id = aa.entity_id
 	LEFT JOIN users u ON aa.user_id = u.id AND aa.is_owner
-	LEFT JOIN likables l ON l.entity_id = e.id
+	LEFT JOIN entity_ratings r ON r.entity_id = e.id
 	LEFT JOIN likables l2 ON l2.entity_id = e.id AND l2.user_id = $3
 WHERE m.id = $4
 GROUP BY m.id,
@@ -2383,7 +2388,7 @@ GROUP BY m.id,
 	preview.created_at,
 	u.id,
 	u.name,
-    l2.value`
+    l2.value, r.total_likes, r.total_dislikes`
 
 	var (
 		rows pgx.Rows
@@ -2612,14 +2617,14 @@ func GetPackageForAdmin(ctx context.Context, requester *sm.User, id uuid.UUID) (
 	u.id					ownerId,
 	u.name					ownerName,
 	l2.value				liked,
-	sum(case when l.value >= 0 then l.value end) as total_likes,
-	sum(case when l.value < 0 then l.value end) as total_dislikes
+	r.total_likes,
+	r.total_dislikes
 FROM mods m
     LEFT JOIN entities e ON m.id = e.id
-	LEFT JOIN files preview ON e.id = preview.entity_id
+	LEFT JOIN files preview ON e.id = preview.entity_id AND preview.derivative_of IS NULL
 	LEFT JOIN accessibles aa on e.id = aa.entity_id
 	LEFT JOIN users u ON aa.user_id = u.id AND aa.is_owner
-	LEFT JOIN likables l ON l.entity_id = e.id
+	LEFT JOIN entity_ratings r ON r.entity_id = e.id
 	LEFT JOIN likables l2 ON l2.entity_id = e.id AND l2.user_id = $1
 WHERE m.id = $2
 GROUP BY m.id,
@@ -2635,7 +2640,7 @@ GROUP BY m.id,
          preview.hash,
          preview.created_at,
          u.id,
-         l2.value`
+         l2.value, r.total_likes, r.total_dislikes`
 
 	var (
 		rows pgx.Rows
@@ -2818,16 +2823,16 @@ func GetPackageForRequesterWithPak(ctx context.Context, requester *sm.User, id u
 	u.id 					ownerId,
 	u.name 					ownerName,
 	l2.value				liked,
-	sum(case when l.value >= 0 then l.value end) as total_likes,
-	sum(case when l.value < 0 then l.value end) as total_dislikes
+	r.total_likes,
+	r.total_dislikes
 FROM mods m
     LEFT JOIN entities e ON m.id = e.id
     LEFT JOIN accessibles a ON e.id = a.entity_id AND a.user_id = $4::uuid
-	LEFT JOIN files pak ON pak.entity_id = m.id AND pak.type = 'pak' AND pak.platform = $1::text AND pak.deployment_type = $2::text
+	LEFT JOIN files pak ON pak.entity_id = coalesce(package_latest_version(m.id, $1::text, $2::text), m.id) AND pak.type = 'pak' AND pak.platform = $1::text AND pak.deployment_type = $2::text
 	LEFT JOIN files preview ON e.id = preview.entity_id AND preview.type = 'image_preview'
 	LEFT JOIN accessibles aa on e.id = aa.entity_id
 	LEFT JOIN users u ON aa.user_id = u.id AND aa.is_owner
-	LEFT JOIN likables l ON l.entity_id = e.id
+	LEFT JOIN entity_ratings r ON r.entity_id = e.id
 	LEFT JOIN likables l2 ON l2.entity_id = e.id AND l2.user_id = $4
 WHERE m.id = $3 AND (e.public OR a.can_view OR a.is_owner)
 GROUP BY m.id,
@@ -2852,7 +2857,7 @@ GROUP BY m.id,
 		preview.original_path,
 		preview.hash,
 		preview.created_at,
-		l2.value`
+		l2.value, r.total_likes, r.total_dislikes`
 
 	var (
 		rows pgx.Rows
@@ -3078,15 +3083,15 @@ func GetPackageForRequester(ctx context.Context, requester *sm.User, id uuid.UUI
 	u.id    				ownerId,
 	u.name 					ownerName,
 	l2.value				liked,
-	sum(case when l.value >= 0 then l.value end) as total_likes,
-	sum(case when l.value < 0 then l.value end) as total_dislikes
+	r.total_likes,
+	r.total_dislikes
 FROM mods m
     LEFT JOIN entities e ON m.id = e.id
     LEFT JOIN accessibles a ON e.id = a.entity_id AND a.user_id = $2::uuid
 	LEFT JOIN files preview ON e.id = preview.entity_id AND (preview.type = 'image_preview' or preview.type = 'pak-extra-content')
 	LEFT JOIN accessibles aa on e.id = aa.entity_id
 	LEFT JOIN users u ON aa.user_id = u.id AND aa.is_owner
-	LEFT JOIN likables l ON l.entity_id = e.id
+	LEFT JOIN entity_ratings r ON r.entity_id = e.id
 	LEFT JOIN likables l2 ON l2.entity_id = e.id AND l2.user_id = $2::uuid
 WHERE m.id = $1 AND (e.public OR a.can_view OR a.is_owner)
 GROUP BY m.id,
@@ -3105,7 +3110,7 @@ GROUP BY m.id,
 		preview.original_path,
 		preview.hash,
 		preview.created_at,
-		l2.value
+		l2.value, r.total_likes, r.total_dislikes
 ORDER BY e.updated_at DESC, e.created_at DESC, aa.created_at`
 
 	var (
@@ -3318,6 +3323,17 @@ func CreatePackageForRequester(ctx context.Context, requester *sm.User, m Packag
 	}
 	//endregion
 
+	//region Version
+	if m.Version != nil && *m.Version != "" {
+		if _, err1 = createPackageVersion(ctx, tx, requester, id, PackageVersionCreateMetadata{Version: *m.Version}); err1 != nil {
+			if err2 := tx.Rollback(ctx); err2 != nil {
+				return nil, fmt.Errorf("failed to rollback failed tx: %v, %v", err1, err2)
+			}
+			return nil, err1
+		}
+	}
+	//endregion
+
 	if err1 = tx.Commit(ctx); err1 != nil {
 		if err2 := tx.Rollback(ctx); err2 != nil {
 			return nil, fmt.Errorf("failed to rollback failed tx: %v, %v", err1, err2)
@@ -3379,22 +3395,35 @@ func UpdatePackageForRequester(ctx context.Context, requester *sm.User, id uuid.
 		e.Release = *m.Release
 	}
 
-	if m.Version != nil {
-		e.Version = *m.Version
-	}
+	// Versions are immutable, a new version is published instead of overwriting the current one
+	publish := m.Version != nil && *m.Version != "" && *m.Version != e.Version
 
 	if m.Title != nil {
 		e.Title = *m.Title
 	}
 
-	q := `UPDATE mods SET name=$1, description=$2, summary=$3, map=$4, release_name=$5, version=$6, title=$7 WHERE id = $8`
-	if _, err1 = tx.Exec(ctx, q, e.Name /*$1*/, e.Description /*$2*/, e.Summary /*$3*/, e.Map /*$4*/, e.Release /*$5*/, e.Version /*$6*/, e.Title /*$7*/, id); err1 != nil {
+	q := `UPDATE mods SET name=$1, description=$2, summary=$3, map=$4, release_name=$5, title=$6 WHERE id = $7`
+	if _, err1 = tx.Exec(ctx, q, e.Name /*$1*/, e.Description /*$2*/, e.Summary /*$3*/, e.Map /*$4*/, e.Release /*$5*/, e.Title /*$6*/, id); err1 != nil {
 		if err2 := tx.Rollback(ctx); err2 != nil {
 			return nil, fmt.Errorf("failed to rollback failed tx: %v, %v", err1, err2)
 		}
 		return nil, fmt.Errorf("failed to exec world update tx: %v", err1)
 	}
 
+	if publish {
+		v := PackageVersionCreateMetadata{Version: *m.Version}
+		if m.Changelog != nil {
+			v.Changelog = *m.Changelog
+		}
+
+		if _, err1 = createPackageVersion(ctx, tx, requester, id, v); err1 != nil {
+			if err2 := tx.Rollback(ctx); err2 != nil {
+				return nil, fmt.Errorf("failed to rollback failed tx: %v, %v", err1, err2)
+			}
+			return nil, err1
+		}
+	}
+
 	if err1 = tx.Commit(ctx); err1 != nil {
 		if err2 := tx.Rollback(ctx); err2 != nil {
 			return nil, fmt.Errorf("failed to rollback failed tx: %v, %v", err1, err2)
@@ -3434,7 +3463,7 @@ func GetLatestPackageForAdminWithPak(ctx context.Context, platform string, deplo
 	u.name ownerName
 FROM mods m
     LEFT JOIN entities e ON m.id = e.id
-	LEFT JOIN files pak ON pak.entity_id = m.id AND pak.type = 'pak' AND pak.platform = $1::text AND pak.deployment_type = $2::text
+	LEFT JOIN files pak ON pak.entity_id = coalesce(package_latest_version(m.id, $1::text, $2::text), m.id) AND pak.type = 'pak' AND pak.platform = $1::text AND pak.deployment_type = $2::text
 	LEFT JOIN files preview ON e.id = preview.entity_id AND preview.type = 'image_preview'
 	LEFT JOIN accessibles aa on e.id = aa.entity_id
 	LEFT JOIN users u ON aa.user_id = u.id AND aa.is_owner
@@ -3632,3 +3661,294 @@ OFFSET $3::int LIMIT $4::int`
 
 	return maps, nil
 }
+
+// IndexPackagesTrendingForAdmin Index packages ordered by the trending score for admin, optionally filtered by query
+func IndexPackagesTrendingForAdmin(ctx context.Context, requester *sm.User, offset int64, limit int64, query string, platform string, deployment string) (entities []Package, total int64, err error) {
+	return indexPackagesTrending(ctx, requester, trendingVisibilityForAdmin, offset, limit, query, platform, deployment)
+}
+
+// IndexPackagesTrendingForRequester Index packages visible to the requester ordered by the trending score, optionally filtered by query
+func IndexPackagesTrendingForRequester(ctx context.Context, requester *sm.User, offset int64, limit int64, query string, platform string, deployment string) (entities []Package, total int64, err error) {
+	return indexPackagesTrending(ctx, requester, trendingVisibilityForRequester, offset, limit, query, platform, deployment)
+}
+
+func indexPackagesTrending(ctx context.Context, requester *sm.User, visibility string, offset int64, limit int64, query string, platform string, deployment string) (entities []Package, total int64, err error) {
+	db := database.DB
+
+	q := `SELECT COUNT(*)
+FROM mods m
+    LEFT JOIN entities e ON e.id = m.id
+WHERE ` + visibility + ` AND ($2::text = '' OR m.name ILIKE $2::text)`
+
+	row := db.QueryRow(ctx, q, requester.Id /*$1*/, query /*$2*/)
+
+	err = row.Scan(&total)
+	if err != nil {
+		return nil, -1, fmt.Errorf("failed to scan total @ %s: %v", reflect.FunctionName(), err)
+	}
+
+	q = `WITH t AS (SELECT m.id, coalesce(r.trending_score, 0) score
+	FROM mods m
+		LEFT JOIN entities e ON e.id = m.id
+		LEFT JOIN entity_ratings r ON r.entity_id = m.id
+	WHERE ` + visibility + ` AND ($4::text = '' OR m.name ILIKE $4::text)
+	ORDER BY score DESC, e.updated_at DESC, m.id
+	OFFSET $5 LIMIT $6)
+SELECT 
+	m.id                    packageId,
+	m.name                  packageName,
+	m.title                 packageMap,
+	m.description           packageDescription,
+	m.price					packagePrice,
+	m.version 				packageVersion,
+	m.released_at			packageReleasedAt,
+	m.downloads 			packageDownloads,
+	e.public                entityPublic,
+	e.views					entityViews,
+	pak.id                  pakId,
+	pak.url                 pakUrl,
+	pak.type                pakType,
+	pak.mime            	pakMime,
+	pak.size            	pakSize,
+	pak.platform 			pakPlatform,
+	pak.original_path 		pakOriginalPath,
+	pak.hash				pakHash,
+	pak.created_at			pakCreatedAt,
+	preview.id              previewId,
+	preview.url             previewUrl,
+	preview.type            previewType,
+	preview.mime        	previewMime,
+	preview.size			previewSize,
+	preview.platform 		previewPlatform,
+	preview.original_path 	previewOriginalPath,
+	preview.hash			previewHash,
+	preview.created_at		previewCreatedAt,
+	u.id 					ownerId,
+	u.name 					ownerName,
+	l2.value				liked,
+	r.total_likes,
+	r.total_dislikes
+FROM t
+	LEFT JOIN mods m ON m.id = t.id
+    LEFT JOIN entities e ON m.id = e.id
+	LEFT JOIN files pak ON pak.entity_id = coalesce(package_latest_version(m.id, $2::text, $3::text), m.id) AND pak.type = 'pak' AND pak.platform = $2::text AND pak.deployment_type = $3::text
+	LEFT JOIN files preview ON e.id = preview.entity_id AND preview.type = 'image_preview'
+	LEFT JOIN accessibles aa ON e.id = aa.entity_id AND aa.is_owner
+	LEFT JOIN users u ON aa.user_id = u.id
+	LEFT JOIN entity_ratings r ON r.entity_id = e.id
+	LEFT JOIN likables l2 ON l2.entity_id = e.id AND l2.user_id = $1
+ORDER BY t.score DESC, e.updated_at DESC, m.id`
+
+	var rows pgx.Rows
+	rows, err = db.Query(ctx, q, requester.Id /*$1*/, platform /*$2*/, deployment /*$3*/, query /*$4*/, offset /*$5*/, limit /*$6*/)
+	if err != nil {
+		return nil, -1, fmt.Errorf("failed to query %s @ %s: %v", packagePlural, reflect.FunctionName(), err)
+	}
+
+	defer func() {
+		rows.Close()
+		database.LogPgxStat("IndexPackagesTrending")
+	}()
+	for rows.Next() {
+		var (
+			id               pgtypeuuid.UUID
+			name             *string
+			title            *string
+			description      *string
+			price            *float64
+			version          *string
+			releasedAt       *time.Time
+			downloads        *int32
+			public           *bool
+			views            *int32
+			pakId            pgtypeuuid.UUID
+			pakUrl           *string
+			pakType          *string
+			pakMime          *string
+			pakSize          *int64
+			pakPlatform      *string
+			pakOriginalPath  *string
+			pakHash          *string
+			pakCreatedAt     *time.Time
+			fileId           pgtypeuuid.UUID
+			fileUrl          *string
+			fileType         *string
+			fileMime         *string
+			fileSize         *int64
+			filePlatform     *string
+			fileOriginalPath *string
+			fileHash         *string
+			fileCreatedAt    *time.Time
+			ownerId          pgtypeuuid.UUID
+			ownerName        *string
+			liked            *int32
+			totalLikes       *int32
+			totalDislikes    *int32
+		)
+
+		err = rows.Scan(
+			&id,
+			&name,
+			&title,
+			&description,
+			&price,
+			&version,
+			&releasedAt,
+			&downloads,
+			&public,
+			&views,
+			&pakId,
+			&pakUrl,
+			&pakType,
+			&pakMime,
+			&pakSize,
+			&pakPlatform,
+			&pakOriginalPath,
+			&pakHash,
+			&pakCreatedAt,
+			&fileId,
+			&fileUrl,
+			&fileType,
+			&fileMime,
+			&fileSize,
+			&filePlatform,
+			&fileOriginalPath,
+			&fileHash,
+			&fileCreatedAt,
+			&ownerId,
+			&ownerName,
+			&liked,
+			&totalLikes,
+			&totalDislikes,
+		)
+		if err != nil {
+			return nil, -1, fmt.Errorf("failed to scan %s @ %s: %v", packageSingular, reflect.FunctionName(), err)
+		}
+
+		if id.Status == pgtype.Null {
+			continue
+		}
+
+		//region Pak
+		var pak *File
+		if pakId.Status != pgtype.Null {
+			pak = new(File)
+			pak.Id = &pakId.UUID
+			if pakType != nil {
+				pak.Type = *pakType
+			}
+			if pakMime != nil {
+				pak.Mime = pakMime
+			}
+			if pakSize != nil {
+				pak.Size = pakSize
+			}
+			if pakUrl != nil {
+				pak.Url = *pakUrl
+			}
+			if pakPlatform != nil {
+				pak.Platform = *pakPlatform
+			}
+			if pakOriginalPath != nil {
+				pak.OriginalPath = pakOriginalPath
+			}
+			if pakHash != nil {
+				pak.Hash = pakHash
+			}
+			if pakCreatedAt != nil {
+				pak.CreatedAt = *pakCreatedAt
+			}
+		}
+		//endregion
+
+		//region File
+		var file *File
+		if fileId.Status != pgtype.Null {
+			file = new(File)
+			file.Id = &fileId.UUID
+			if fileUrl != nil {
+				file.Url = *fileUrl
+			}
+			if fileType != nil {
+				file.Type = *fileType
+			}
+			if fileMime != nil {
+				file.Mime = fileMime
+			}
+			if filePlatform != nil {
+				file.Platform = *filePlatform
+			}
+			if fileSize != nil {
+				file.Size = fileSize
+			}
+			if fileOriginalPath != nil {
+				file.OriginalPath = fileOriginalPath
+			}
+			if fileHash != nil {
+				file.Hash = fileHash
+			}
+			if fileCreatedAt != nil {
+				file.CreatedAt = *fileCreatedAt
+			}
+		}
+		//endregion
+
+		if i := findPackage(entities, id.UUID); i >= 0 {
+			if file != nil && !containsFile(entities[i].Files, *file.Id) {
+				entities[i].Files = append(entities[i].Files, *file)
+			}
+			if pak != nil && !containsFile(entities[i].Files, *pak.Id) {
+				entities[i].Files = append(entities[i].Files, *pak)
+			}
+			continue
+		}
+
+		var e Package
+		e.Id = &id.UUID
+		if name != nil {
+			e.Name = *name
+		}
+		if title != nil {
+			e.Title = *title
+		}
+		if description != nil {
+			e.Description = *description
+		}
+		if version != nil {
+			e.Version = *version
+		}
+		e.Price = price
+		e.ReleasedAt = releasedAt
+		e.Downloads = downloads
+		e.Public = public
+		e.Views = views
+		e.Liked = liked
+
+		if ownerId.Status != pgtype.Null {
+			e.Owner = new(User)
+			e.Owner.Id = &ownerId.UUID
+			e.Owner.Name = ownerName
+		}
+
+		e.TotalLikes = new(int32)
+		if totalLikes != nil {
+			*e.TotalLikes = *totalLikes
+		}
+
+		e.TotalDislikes = new(int32)
+		if totalDislikes != nil {
+			*e.TotalDislikes = *totalDislikes
+		}
+
+		if pak != nil {
+			e.Files = append(e.Files, *pak)
+		}
+		if file != nil {
+			e.Files = append(e.Files, *file)
+		}
+
+		entities = append(entities, e)
+	}
+
+	return entities, total, err
+}
@@ -0,0 +1,967 @@
+package model
+
+import (
+	"context"
+	sm "dev.hackerman.me/artheon/veverse-shared/model"
+	"errors"
+	"fmt"
+	"github.com/Masterminds/semver/v3"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofrs/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/sirupsen/logrus"
+	"sort"
+	"strings"
+	"veverse-api/database"
+)
+
+// PackageDependencyMaxCount limits the number of direct dependencies of the package
+const PackageDependencyMaxCount = 64
+
+// packageDependencyLockKey is the advisory lock key held while dependencies are replaced, so concurrent updates of different packages can not form a cycle
+const packageDependencyLockKey int64 = 0x7061636b64657073
+
+// packageDependencyEdges Dependencies of any version of the package, current dependencies and snapshots of published versions, the resolution may select any of them
+const packageDependencyEdges = `(SELECT pd.package_id, pd.dependency_id FROM package_dependencies pd
+              UNION ALL
+              SELECT pv.package_id, vd.dependency_id FROM package_version_dependencies vd JOIN package_versions pv ON pv.id = vd.version_id)`
+
+// packageResolvedVersion Version of the dependency d the resolution uses by default, the latest published version or the current version of the package without published versions
+const packageResolvedVersion = `coalesce((SELECT lv.version FROM package_versions lv WHERE lv.id = package_latest_version(d.id, '', '')), d.version, '')`
+
+// ErrInvalidPackageDependency is returned for dependencies that do not exist, lead to the package itself, form a cycle or have invalid constraints
+var ErrInvalidPackageDependency = errors.New("invalid package dependency")
+
+// PackageDependency is the package required by another package
+type PackageDependency struct {
+	Id         uuid.UUID `json:"id"`
+	Name       string    `json:"name"`
+	Title      string    `json:"title,omitempty"`
+	Version    string    `json:"version,omitempty"` // Latest version of the dependency
+	Constraint string    `json:"constraint"`        // Semver constraint the dependency version must satisfy
+	Satisfied  bool      `json:"satisfied"`         // Whether the latest version satisfies the constraint
+}
+
+// PackageDependencyMetadata Dependency declared by the package
+type PackageDependencyMetadata struct {
+	Id         uuid.UUID `json:"id"`
+	Constraint string    `json:"constraint"` // Semver constraint, e.g. ^1.2 or >= 1.0, < 2.0
+}
+
+// PackageDependenciesUpdateMetadata Replaces all dependencies of the package
+type PackageDependenciesUpdateMetadata struct {
+	Dependencies []PackageDependencyMetadata `json:"dependencies"`
+}
+
+// PackageConflict describes the reason the package set can not be resolved
+type PackageConflict struct {
+	Id             uuid.UUID  `json:"id"`
+	Name           string     `json:"name"`
+	Version        string     `json:"version,omitempty"`
+	Constraint     string     `json:"constraint,omitempty"`
+	RequiredById   *uuid.UUID `json:"requiredById,omitempty"`
+	RequiredByName string     `json:"requiredByName,omitempty"`
+	Reason         string     `json:"reason"`
+}
+
+// PackageResolutionError is returned if the package set has conflicts
+type PackageResolutionError struct {
+	Conflicts []PackageConflict
+}
+
+func (e *PackageResolutionError) Error() string {
+	var reasons []string
+	for _, c := range e.Conflicts {
+		reasons = append(reasons, c.Reason)
+	}
+	return "package conflicts: " + strings.Join(reasons, "; ")
+}
+
+// ResolvedPackage is the package version of the resolved set with its pak file
+type ResolvedPackage struct {
+	Id         uuid.UUID  `json:"id"`
+	Name       string     `json:"name"`
+	Version    string     `json:"version"`
+	VersionId  *uuid.UUID `json:"versionId,omitempty"` // Not set for packages without published versions
+	Deprecated bool       `json:"deprecated,omitempty"`
+	Pak        *File      `json:"pak"`
+}
+
+// PackageResolution is the full pak set required to load the package, dependencies are listed before their dependents
+type PackageResolution struct {
+	Id         uuid.UUID         `json:"id"`
+	Platform   string            `json:"platform"`
+	Deployment string            `json:"deployment"`
+	Packages   []ResolvedPackage `json:"packages"`
+}
+
+// packageCandidate is the version of the package considered by the resolution
+type packageCandidate struct {
+	entityId     uuid.UUID // Entity the pak files are attached to, the version or the package without published versions
+	versionId    *uuid.UUID
+	version      string
+	semver       *semver.Version // Not set for invalid versions
+	deprecated   bool
+	dependencies []packageEdge // Snapshot of the version or the current dependencies of the package without published versions
+}
+
+// packageNode is the package of the dependency graph
+type packageNode struct {
+	id         uuid.UUID
+	name       string
+	viewable   bool
+	candidates []packageCandidate // Sorted from the greatest version
+	selected   *packageCandidate
+}
+
+type packageEdge struct {
+	id         uuid.UUID
+	constraint string
+}
+
+//region Dependencies
+
+// indexPackageDependencies Lists direct dependencies of the package
+func indexPackageDependencies(ctx context.Context, id uuid.UUID) (entities []PackageDependency, err error) {
+	db := database.DB
+
+	q := `SELECT d.id, coalesce(d.name, ''), coalesce(d.title, ''), ` + packageResolvedVersion + `, pd.version_constraint
+FROM package_dependencies pd
+    JOIN mods d ON d.id = pd.dependency_id
+WHERE pd.package_id = $1
+ORDER BY d.name, d.id`
+
+	rows, err := db.Query(ctx, q, id /*$1*/)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query %s dependencies: %v", packageSingular, err)
+	}
+
+	defer func() {
+		rows.Close()
+		database.LogPgxStat("indexPackageDependencies")
+	}()
+
+	entities = []PackageDependency{}
+	for rows.Next() {
+		var e PackageDependency
+		if err = rows.Scan(&e.Id, &e.Name, &e.Title, &e.Version, &e.Constraint); err != nil {
+			return nil, err
+		}
+		e.Satisfied = versionSatisfies(e.Version, e.Constraint)
+		entities = append(entities, e)
+	}
+
+	return entities, rows.Err()
+}
+
+// IndexPackageDependenciesForAdmin Lists direct dependencies of the package
+func IndexPackageDependenciesForAdmin(ctx context.Context, id uuid.UUID) (entities []PackageDependency, err error) {
+	if _, err = getPackageLatestVersion(ctx, id); err != nil {
+		return nil, err
+	}
+
+	return indexPackageDependencies(ctx, id)
+}
+
+// IndexPackageDependenciesForRequester Lists direct dependencies of the package the requester can view
+func IndexPackageDependenciesForRequester(ctx context.Context, requester *sm.User, id uuid.UUID) (entities []PackageDependency, err error) {
+	if ok, err := EntityViewable(ctx, requester.Id, id); err != nil {
+		return nil, err
+	} else if !ok {
+		return nil, errors.New("no access")
+	}
+
+	return indexPackageDependencies(ctx, id)
+}
+
+// setPackageDependencies Replaces dependencies of the package, requester dependencies are limited to packages the requester can view
+func setPackageDependencies(ctx context.Context, requester *sm.User, id uuid.UUID, dependencies []PackageDependencyMetadata) (entities []PackageDependency, err error) {
+	db := database.DB
+
+	if len(dependencies) > PackageDependencyMaxCount {
+		return nil, fmt.Errorf("%w: too many dependencies, max %d", ErrInvalidPackageDependency, PackageDependencyMaxCount)
+	}
+
+	seen := map[uuid.UUID]bool{}
+	for i, d := range dependencies {
+		if d.Id.IsNil() {
+			return nil, fmt.Errorf("%w: no dependency id", ErrInvalidPackageDependency)
+		}
+
+		if d.Id == id {
+			return nil, fmt.Errorf("%w: package depends on itself", ErrInvalidPackageDependency)
+		}
+
+		if seen[d.Id] {
+			return nil, fmt.Errorf("%w: duplicate dependency %s", ErrInvalidPackageDependency, d.Id)
+		}
+		seen[d.Id] = true
+
+		dependencies[i].Constraint = strings.TrimSpace(d.Constraint)
+		if _, err = semver.NewConstraint(dependencies[i].Constraint); err != nil {
+			return nil, fmt.Errorf("%w: invalid constraint %q of %s: %v", ErrInvalidPackageDependency, d.Constraint, d.Id, err)
+		}
+	}
+
+	tx, err1 := db.Begin(ctx)
+	if err1 != nil {
+		return nil, fmt.Errorf("failed to begin tx: %v", err1)
+	}
+
+	// Row locks of the package do not keep concurrent updates of other packages from closing a cycle (e.g. A to B and B to A), the lock serializes updates so the cycle check sees committed dependencies
+	q := `SELECT pg_advisory_xact_lock($1)`
+	if _, err1 = tx.Exec(ctx, q, packageDependencyLockKey /*$1*/); err1 != nil {
+		if err2 := tx.Rollback(ctx); err2 != nil {
+			return nil, fmt.Errorf("failed to rollback failed tx: %v, %v", err1, err2)
+		}
+		return nil, fmt.Errorf("failed to lock %s dependencies: %v", packageSingular, err1)
+	}
+
+	q = `SELECT m.id FROM mods m WHERE m.id = $1 FOR UPDATE`
+	if err1 = tx.QueryRow(ctx, q, id /*$1*/).Scan(&id); err1 != nil {
+		if err2 := tx.Rollback(ctx); err2 != nil {
+			return nil, fmt.Errorf("failed to rollback failed tx: %v, %v", err1, err2)
+		}
+		return nil, err1
+	}
+
+	// Dependencies are locked to keep them from being deleted before the tx is committed
+	q = `SELECT coalesce(e.public OR coalesce(a.can_view OR a.is_owner, false), false)
+FROM mods d
+    JOIN entities e ON e.id = d.id
+    LEFT JOIN accessibles a ON a.entity_id = e.id AND a.user_id = $2
+WHERE d.id = $1
+FOR SHARE OF d`
+
+	for _, d := range dependencies {
+		var (
+			viewable    bool
+			requesterId = uuid.Nil
+		)
+
+		if requester != nil {
+			requesterId = requester.Id
+		}
+
+		if err1 = tx.QueryRow(ctx, q, d.Id /*$1*/, requesterId /*$2*/).Scan(&viewable); err1 != nil {
+			if errors.Is(err1, pgx.ErrNoRows) {
+				err1 = fmt.Errorf("%w: dependency %s not found", ErrInvalidPackageDependency, d.Id)
+			}
+			if err2 := tx.Rollback(ctx); err2 != nil {
+				return nil, fmt.Errorf("failed to rollback failed tx: %v, %v", err1, err2)
+			}
+			return nil, err1
+		}
+
+		if requester != nil && !viewable {
+			err1 = fmt.Errorf("%w: no access to the dependency %s", ErrInvalidPackageDependency, d.Id)
+			if err2 := tx.Rollback(ctx); err2 != nil {
+				return nil, fmt.Errorf("failed to rollback failed tx: %v, %v", err1, err2)
+			}
+			return nil, err1
+		}
+	}
+
+	q = `DELETE FROM package_dependencies WHERE package_id = $1`
+	if _, err1 = tx.Exec(ctx, q, id /*$1*/); err1 != nil {
+		if err2 := tx.Rollback(ctx); err2 != nil {
+			return nil, fmt.Errorf("failed to rollback failed tx: %v, %v", err1, err2)
+		}
+		return nil, fmt.Errorf("failed to exec delete dependencies tx: %v", err1)
+	}
+
+	q = `INSERT INTO package_dependencies (package_id, dependency_id, version_constraint) VALUES ($1, $2, $3)`
+	for _, d := range dependencies {
+		if _, err1 = tx.Exec(ctx, q, id /*$1*/, d.Id /*$2*/, d.Constraint /*$3*/); err1 != nil {
+			if err2 := tx.Rollback(ctx); err2 != nil {
+				return nil, fmt.Errorf("failed to rollback failed tx: %v, %v", err1, err2)
+			}
+			return nil, fmt.Errorf("failed to exec insert dependency tx: %v", err1)
+		}
+	}
+
+	// The package must not be reachable from its own dependencies, including dependencies of published versions as the resolution follows them
+	q = `WITH RECURSIVE reachable AS (
+    SELECT d.dependency_id FROM ` + packageDependencyEdges + ` d WHERE d.package_id = $1
+    UNION
+    SELECT d.dependency_id FROM ` + packageDependencyEdges + ` d JOIN reachable r ON d.package_id = r.dependency_id
+)
+SELECT EXISTS(SELECT 1 FROM reachable r WHERE r.dependency_id = $1)`
+
+	var cycle bool
+	if err1 = tx.QueryRow(ctx, q, id /*$1*/).Scan(&cycle); err1 != nil || cycle {
+		if err1 == nil {
+			err1 = fmt.Errorf("%w: dependencies form a cycle", ErrInvalidPackageDependency)
+		}
+		if err2 := tx.Rollback(ctx); err2 != nil {
+			return nil, fmt.Errorf("failed to rollback failed tx: %v, %v", err1, err2)
+		}
+		return nil, err1
+	}
+
+	if err1 = tx.Commit(ctx); err1 != nil {
+		if err2 := tx.Rollback(ctx); err2 != nil {
+			return nil, fmt.Errorf("failed to rollback failed tx: %v, %v", err1, err2)
+		}
+		return nil, fmt.Errorf("failed to commit tx: %v", err1)
+	}
+
+	return indexPackageDependencies(ctx, id)
+}
+
+// SetPackageDependenciesForAdmin Replaces dependencies of the package
+func SetPackageDependenciesForAdmin(ctx context.Context, id uuid.UUID, dependencies []PackageDependencyMetadata) (entities []PackageDependency, err error) {
+	return setPackageDependencies(ctx, nil, id, dependencies)
+}
+
+// SetPackageDependenciesForRequester Replaces dependencies of the package the requester can edit
+func SetPackageDependenciesForRequester(ctx context.Context, requester *sm.User, id uuid.UUID, dependencies []PackageDependencyMetadata) (entities []PackageDependency, err error) {
+	if ok, err := EntityEditable(ctx, requester.Id, id); err != nil {
+		return nil, err
+	} else if !ok {
+		return nil, errors.New("no access")
+	}
+
+	return setPackageDependencies(ctx, requester, id, dependencies)
+}
+
+//endregion
+
+//region Resolution
+
+// versionSatisfies Checks the version against the constraint, invalid versions and constraints never match
+func versionSatisfies(version string, constraint string) bool {
+	c, err := semver.NewConstraint(constraint)
+	if err != nil {
+		return false
+	}
+
+	v, err := semver.NewVersion(version)
+	if err != nil {
+		return false
+	}
+
+	return c.Check(v)
+}
+
+// getPackageLatestVersion Returns the current version of the package
+func getPackageLatestVersion(ctx context.Context, id uuid.UUID) (version string, err error) {
+	db := database.DB
+
+	q := `SELECT coalesce(m.version, '') FROM mods m WHERE m.id = $1`
+	err = db.QueryRow(ctx, q, id /*$1*/).Scan(&version)
+	return version, err
+}
+
+// loadPackageGraph Loads the package with all its transitive dependencies of any version, their versions and the constraints between them
+func loadPackageGraph(ctx context.Context, requester *sm.User, id uuid.UUID) (nodes map[uuid.UUID]*packageNode, err error) {
+	db := database.DB
+
+	requesterId := uuid.Nil
+	if requester != nil {
+		requesterId = requester.Id
+	}
+
+	//region Packages
+	q := `WITH RECURSIVE graph AS (
+    SELECT $1::uuid AS id
+    UNION
+    SELECT d.dependency_id
+    FROM graph g
+        JOIN ` + packageDependencyEdges + ` d ON d.package_id = g.id
+)
+SELECT m.id,
+       coalesce(m.name, ''),
+       coalesce(m.version, ''),
+       coalesce(e.public OR coalesce(a.can_view OR a.is_owner, false), false)
+FROM graph g
+    JOIN mods m ON m.id = g.id
+    JOIN entities e ON e.id = m.id
+    LEFT JOIN accessibles a ON a.entity_id = e.id AND a.user_id = $2`
+
+	rows, err := db.Query(ctx, q, id /*$1*/, requesterId /*$2*/)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query %s dependencies: %v", packageSingular, err)
+	}
+
+	nodes = map[uuid.UUID]*packageNode{}
+	legacyVersions := map[uuid.UUID]string{}
+	for rows.Next() {
+		var (
+			n       packageNode
+			version string
+		)
+
+		if err = rows.Scan(&n.id, &n.name, &version, &n.viewable); err != nil {
+			rows.Close()
+			return nil, err
+		}
+
+		nodes[n.id] = &n
+		legacyVersions[n.id] = version
+	}
+	rows.Close()
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if _, ok := nodes[id]; !ok {
+		return nil, pgx.ErrNoRows
+	}
+
+	ids := make([]uuid.UUID, 0, len(nodes))
+	for nodeId := range nodes {
+		ids = append(ids, nodeId)
+	}
+	//endregion
+
+	//region Versions
+	q = `SELECT pv.id, pv.package_id, pv.version, pv.deprecated FROM package_versions pv WHERE pv.package_id = ANY($1)`
+
+	rows, err = db.Query(ctx, q, ids /*$1*/)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query %s: %v", packageVersionPlural, err)
+	}
+
+	for rows.Next() {
+		var (
+			c         packageCandidate
+			versionId uuid.UUID
+			packageId uuid.UUID
+		)
+
+		if err = rows.Scan(&versionId, &packageId, &c.version, &c.deprecated); err != nil {
+			rows.Close()
+			return nil, err
+		}
+
+		c.entityId = versionId
+		c.versionId = &versionId
+		if n, ok := nodes[packageId]; ok {
+			n.candidates = append(n.candidates, c)
+		}
+	}
+	rows.Close()
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, n := range nodes {
+		// Packages without published versions keep pak files attached to the package
+		if len(n.candidates) == 0 {
+			n.candidates = append(n.candidates, packageCandidate{entityId: n.id, version: legacyVersions[n.id]})
+		}
+
+		for i := range n.candidates {
+			n.candidates[i].semver, _ = semver.NewVersion(n.candidates[i].version)
+		}
+
+		sort.SliceStable(n.candidates, func(i, j int) bool {
+			a, b := n.candidates[i].semver, n.candidates[j].semver
+			if a == nil || b == nil {
+				return b == nil && a != nil
+			}
+			return a.GreaterThan(b)
+		})
+	}
+	//endregion
+
+	//region Dependencies
+
+	// Versions depend on the snapshot taken when they were published, packages without published versions on their current dependencies
+	q = `SELECT pd.package_id, NULL::uuid, pd.dependency_id, pd.version_constraint
+FROM package_dependencies pd
+WHERE pd.package_id = ANY($1)
+  AND NOT EXISTS(SELECT 1 FROM package_versions pv WHERE pv.package_id = pd.package_id)
+UNION ALL
+SELECT pv.package_id, pv.id, vd.dependency_id, vd.version_constraint
+FROM package_version_dependencies vd
+    JOIN package_versions pv ON pv.id = vd.version_id
+WHERE pv.package_id = ANY($1)
+ORDER BY 1, 3`
+
+	rows, err = db.Query(ctx, q, ids /*$1*/)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query %s dependencies: %v", packageSingular, err)
+	}
+
+	defer func() {
+		rows.Close()
+		database.LogPgxStat("loadPackageGraph")
+	}()
+
+	for rows.Next() {
+		var (
+			packageId uuid.UUID
+			versionId *uuid.UUID
+			edge      packageEdge
+		)
+
+		if err = rows.Scan(&packageId, &versionId, &edge.id, &edge.constraint); err != nil {
+			return nil, err
+		}
+
+		n, ok := nodes[packageId]
+		if !ok {
+			continue
+		}
+
+		for i, c := range n.candidates {
+			if (versionId == nil && c.versionId == nil) || (versionId != nil && c.versionId != nil && *versionId == *c.versionId) {
+				n.candidates[i].dependencies = append(n.candidates[i].dependencies, edge)
+				break
+			}
+		}
+	}
+	//endregion
+
+	return nodes, rows.Err()
+}
+
+// getPackagePaks returns the latest pak file of each entity for the platform and deployment
+func getPackagePaks(ctx context.Context, entityIds []uuid.UUID, platform string, deployment string) (paks map[uuid.UUID]*File, err error) {
+	db := database.DB
+
+	q := `SELECT DISTINCT ON (f.entity_id) f.entity_id, f.id, f.url, f.type, f.mime, f.size, f.platform, f.deployment_type, f.original_path, f.hash, f.created_at
+FROM files f
+WHERE f.entity_id = ANY($1) AND f.type = 'pak' AND f.platform = $2 AND f.deployment_type = $3
+ORDER BY f.entity_id, f.version DESC, f.created_at DESC`
+
+	rows, err := db.Query(ctx, q, entityIds /*$1*/, platform /*$2*/, deployment /*$3*/)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query %s paks: %v", packageSingular, err)
+	}
+
+	defer func() {
+		rows.Close()
+		database.LogPgxStat("getPackagePaks")
+	}()
+
+	paks = map[uuid.UUID]*File{}
+	for rows.Next() {
+		var (
+			pak      File
+			id       uuid.UUID
+			entityId uuid.UUID
+		)
+
+		if err = rows.Scan(&entityId, &id, &pak.Url, &pak.Type, &pak.Mime, &pak.Size, &pak.Platform, &pak.Deployment, &pak.OriginalPath, &pak.Hash, &pak.CreatedAt); err != nil {
+			return nil, err
+		}
+
+		pak.Id = &id
+		pak.EntityId = &entityId
+		paks[entityId] = &pak
+	}
+
+	return paks, rows.Err()
+}
+
+// resolvePackage Resolves the full pak set of the package version, the latest version is used if the version is empty.
+// Every dependency gets its greatest not deprecated version satisfying all constraints required by the selected versions of its dependents, deprecated versions are only used if nothing else matches.
+// All conflicts are collected to be reported at once.
+func resolvePackage(ctx context.Context, requester *sm.User, id uuid.UUID, version string, platform string, deployment string) (resolution *PackageResolution, err error) {
+	nodes, err := loadPackageGraph(ctx, requester, id)
+	if err != nil {
+		return nil, err
+	}
+
+	root := nodes[id]
+	if version != "" {
+		var candidates []packageCandidate
+		for _, c := range root.candidates {
+			if c.version == version {
+				candidates = append(candidates, c)
+			}
+		}
+
+		if len(candidates) == 0 {
+			return nil, fmt.Errorf("%w: version %s not found", ErrInvalidPackageVersion, version)
+		}
+
+		root.candidates = candidates
+	} else {
+		db := database.DB
+
+		// The latest version is the newest one with a pak for the platform and deployment, the same version is returned with the package
+		var latestId *uuid.UUID
+		q := `SELECT package_latest_version($1, $2, $3)`
+		if err = db.QueryRow(ctx, q, id /*$1*/, platform /*$2*/, deployment /*$3*/).Scan(&latestId); err != nil {
+			return nil, err
+		}
+
+		for _, c := range root.candidates {
+			if latestId != nil && c.versionId != nil && *c.versionId == *latestId {
+				root.candidates = []packageCandidate{c}
+				break
+			}
+		}
+	}
+
+	var conflicts []PackageConflict
+
+	//region Versions
+	type requirement struct {
+		by         *packageNode
+		constraint string
+		c          *semver.Constraints
+	}
+
+	pick := func(n *packageNode, required []requirement, deprecated bool) *packageCandidate {
+		for i, c := range n.candidates {
+			if c.deprecated && !deprecated {
+				continue
+			}
+
+			satisfied := true
+			for _, r := range required {
+				if c.semver == nil || !r.c.Check(c.semver) {
+					satisfied = false
+					break
+				}
+			}
+
+			if satisfied {
+				return &n.candidates[i]
+			}
+		}
+		return nil
+	}
+
+	// Dependencies of the selected versions constrain the versions of their dependencies, selection is repeated until no version changes as a different version can have different dependencies
+	stable := false
+	for i := 0; i <= 2*len(nodes) && !stable; i++ {
+		conflicts = nil
+		stable = true
+
+		//region Constraints
+		requirements := map[uuid.UUID][]requirement{}
+		reachable := []*packageNode{root}
+		reached := map[uuid.UUID]bool{root.id: true}
+		for k := 0; k < len(reachable); k++ {
+			n := reachable[k]
+			if n.selected == nil {
+				continue
+			}
+
+			for _, edge := range n.selected.dependencies {
+				d, ok := nodes[edge.id]
+				if !ok {
+					continue
+				}
+
+				if !reached[d.id] {
+					reached[d.id] = true
+					reachable = append(reachable, d)
+				}
+
+				c, err := semver.NewConstraint(edge.constraint)
+				if err != nil {
+					requiredById := n.id
+					conflicts = append(conflicts, PackageConflict{
+						Id:             d.id,
+						Name:           d.name,
+						Constraint:     edge.constraint,
+						RequiredById:   &requiredById,
+						RequiredByName: n.name,
+						Reason:         fmt.Sprintf("%s has an invalid constraint %q for %s", n.name, edge.constraint, d.name),
+					})
+					continue
+				}
+
+				requirements[d.id] = append(requirements[d.id], requirement{by: n, constraint: edge.constraint, c: c})
+			}
+		}
+		//endregion
+
+		for _, n := range reachable {
+			required := requirements[n.id]
+
+			selected := pick(n, required, false)
+			if selected == nil {
+				selected = pick(n, required, true)
+			}
+
+			if selected != n.selected {
+				n.selected = selected
+				stable = false
+			}
+
+			if selected != nil {
+				continue
+			}
+
+			var (
+				constraints []string
+				names       []string
+				available   []string
+			)
+
+			for _, r := range required {
+				constraints = append(constraints, r.constraint)
+				names = append(names, fmt.Sprintf("%s required by %s", r.constraint, r.by.name))
+			}
+
+			for _, c := range n.candidates {
+				available = append(available, c.version)
+			}
+
+			conflict := PackageConflict{
+				Id:         n.id,
+				Name:       n.name,
+				Constraint: strings.Join(constraints, ", "),
+				Reason:     fmt.Sprintf("no version of %s satisfies %s, available versions: %s", n.name, strings.Join(names, " and "), strings.Join(available, ", ")),
+			}
+
+			if len(required) == 1 {
+				conflict.RequiredById = &required[0].by.id
+				conflict.RequiredByName = required[0].by.name
+			}
+
+			conflicts = append(conflicts, conflict)
+		}
+	}
+
+	if !stable {
+		conflicts = append(conflicts, PackageConflict{
+			Id:     root.id,
+			Name:   root.name,
+			Reason: fmt.Sprintf("versions of the %s dependencies do not settle on a single set", root.name),
+		})
+	}
+	//endregion
+
+	//region Order
+
+	// Depth-first walk lists dependencies before their dependents and detects cycles
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+
+	var (
+		state = map[uuid.UUID]int{}
+		order []*packageNode
+		visit func(n *packageNode, path []string)
+	)
+
+	visit = func(n *packageNode, path []string) {
+		path = append(path, n.name)
+		state[n.id] = visiting
+
+		var edges []packageEdge
+		if n.selected != nil {
+			edges = n.selected.dependencies
+		}
+
+		for _, edge := range edges {
+			d, ok := nodes[edge.id]
+			if !ok {
+				continue
+			}
+
+			switch state[d.id] {
+			case visiting:
+				conflicts = append(conflicts, PackageConflict{
+					Id:     d.id,
+					Name:   d.name,
+					Reason: fmt.Sprintf("dependency cycle: %s -> %s", strings.Join(path, " -> "), d.name),
+				})
+			case unvisited:
+				visit(d, path)
+			}
+		}
+		state[n.id] = visited
+		order = append(order, n)
+	}
+
+	visit(root, nil)
+	//endregion
+
+	if len(conflicts) > 0 {
+		return nil, &PackageResolutionError{Conflicts: conflicts}
+	}
+
+	//region Paks
+	entityIds := make([]uuid.UUID, 0, 2*len(order))
+	for _, n := range order {
+		entityIds = append(entityIds, n.selected.entityId)
+		if n.selected.versionId != nil {
+			entityIds = append(entityIds, n.id)
+		}
+	}
+
+	paks, err := getPackagePaks(ctx, entityIds, platform, deployment)
+	if err != nil {
+		return nil, err
+	}
+
+	resolution = &PackageResolution{Id: id, Platform: platform, Deployment: deployment, Packages: []ResolvedPackage{}}
+	for _, n := range order {
+		if requester != nil && !n.viewable {
+			conflicts = append(conflicts, PackageConflict{
+				Id:      n.id,
+				Name:    n.name,
+				Version: n.selected.version,
+				Reason:  fmt.Sprintf("no access to %s", n.name),
+			})
+			continue
+		}
+
+		pak, ok := paks[n.selected.entityId]
+		if !ok && n.selected.versionId != nil {
+			// Paks built before versions were introduced stay on the package until the version is built
+			pak, ok = paks[n.id]
+		}
+
+		if !ok {
+			conflicts = append(conflicts, PackageConflict{
+				Id:      n.id,
+				Name:    n.name,
+				Version: n.selected.version,
+				Reason:  fmt.Sprintf("%s %s has no %s %s pak", n.name, n.selected.version, platform, deployment),
+			})
+			continue
+		}
+
+		resolution.Packages = append(resolution.Packages, ResolvedPackage{
+			Id:         n.id,
+			Name:       n.name,
+			Version:    n.selected.version,
+			VersionId:  n.selected.versionId,
+			Deprecated: n.selected.deprecated,
+			Pak:        pak,
+		})
+	}
+	//endregion
+
+	if len(conflicts) > 0 {
+		return nil, &PackageResolutionError{Conflicts: conflicts}
+	}
+
+	return resolution, nil
+}
+
+// ResolvePackageForAdmin Resolves the full pak set of the package version for the platform and deployment, the latest version is used if the version is empty
+func ResolvePackageForAdmin(ctx context.Context, id uuid.UUID, version string, platform string, deployment string) (resolution *PackageResolution, err error) {
+	return resolvePackage(ctx, nil, id, version, platform, deployment)
+}
+
+// ResolvePackageForRequester Resolves the full pak set of the package version for the platform and deployment, all packages of the set must be viewable by the requester
+func ResolvePackageForRequester(ctx context.Context, requester *sm.User, id uuid.UUID, version string, platform string, deployment string) (resolution *PackageResolution, err error) {
+	if ok, err := EntityViewable(ctx, requester.Id, id); err != nil {
+		return nil, err
+	} else if !ok {
+		return nil, errors.New("no access")
+	}
+
+	return resolvePackage(ctx, requester, id, version, platform, deployment)
+}
+
+//endregion
+
+//region Dependents
+
+// ScheduleDependentPackageJobs Schedules rebuilding of packages depending on the package of the completed job.
+// Only builds of the newest version affect dependents, their newest versions are rebuilt for the same platform, deployment and configuration if the new version still satisfies their constraints.
+func ScheduleDependentPackageJobs(c *fiber.Ctx, job *Job) (err error) {
+	db := database.DB
+	ctx := c.UserContext()
+
+	if job == nil || job.Type != "Package" {
+		return nil
+	}
+
+	packageId := getJobPackageId(job)
+
+	buildId, err := getPackageBuildEntity(ctx, packageId)
+	if err != nil {
+		return fmt.Errorf("failed to get the newest %s: %v", packageVersionSingular, err)
+	}
+
+	if buildId != job.EntityId {
+		return nil
+	}
+
+	version, err := getPackageLatestVersion(ctx, packageId)
+	if err != nil {
+		return fmt.Errorf("failed to get the %s version: %v", packageSingular, err)
+	}
+
+	// Dependents already waiting for a worker will pick up the new pak anyway
+	// Dependents are rebuilt if the newest version depends on the package, packages without published versions if their current dependencies do
+	q := `SELECT d.package_id, d.build_id, d.version_constraint, coalesce(o.user_id, $5::uuid)
+FROM (SELECT pd.package_id, pd.package_id AS build_id, pd.version_constraint
+      FROM package_dependencies pd
+      WHERE pd.dependency_id = $1
+        AND NOT EXISTS(SELECT 1 FROM package_versions pv WHERE pv.package_id = pd.package_id)
+      UNION ALL
+      SELECT pv.package_id, pv.id, vd.version_constraint
+      FROM package_version_dependencies vd
+          JOIN package_versions pv ON pv.id = vd.version_id
+      WHERE vd.dependency_id = $1
+        AND pv.id = package_newest_version(pv.package_id)) d
+    LEFT JOIN accessibles o ON o.entity_id = d.package_id AND o.is_owner
+WHERE NOT EXISTS(SELECT 1 FROM jobs j
+                 WHERE j.entity_id = d.build_id AND j.type = 'Package' AND j.status = 'unclaimed'
+                   AND j.platform = $2 AND j.deployment = $3 AND j.configuration = $4)`
+
+	rows, err := db.Query(ctx, q, packageId /*$1*/, job.Platform /*$2*/, job.Deployment /*$3*/, job.Configuration /*$4*/, job.OwnerId /*$5*/)
+	if err != nil {
+		return fmt.Errorf("failed to query dependent %s: %v", packagePlural, err)
+	}
+
+	type dependent struct {
+		id         uuid.UUID
+		buildId    uuid.UUID
+		constraint string
+		ownerId    uuid.UUID
+	}
+
+	var dependents []dependent
+	for rows.Next() {
+		var d dependent
+		if err = rows.Scan(&d.id, &d.buildId, &d.constraint, &d.ownerId); err != nil {
+			rows.Close()
+			return err
+		}
+		dependents = append(dependents, d)
+	}
+	rows.Close()
+
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	scheduled := map[uuid.UUID]bool{}
+	for _, d := range dependents {
+		if scheduled[d.id] {
+			continue
+		}
+
+		if !versionSatisfies(version, d.constraint) {
+			logrus.Warningf("dependent %s %s requires %s %s, latest version %s", packageSingular, d.id, packageId, d.constraint, version)
+			continue
+		}
+
+		if err = CreateJob(c, sm.User{Entity: sm.Entity{Identifier: sm.Identifier{Id: d.ownerId}}}, CreateJobRequestMetadata{
+			Platform:      job.Platform,
+			Type:          "Package",
+			Deployment:    job.Deployment,
+			Configuration: job.Configuration,
+			EntityId:      d.buildId,
+		}); err != nil {
+			logrus.Errorf("failed to create a dependent %s job: %v", packageSingular, err)
+			continue
+		}
+
+		scheduled[d.id] = true
+	}
+
+	return nil
+}
+
+//endregion
@@ -0,0 +1,534 @@
+package model
+
+import (
+	"context"
+	sm "dev.hackerman.me/artheon/veverse-shared/model"
+	"errors"
+	"fmt"
+	"github.com/Masterminds/semver/v3"
+	"github.com/gofrs/uuid"
+	"github.com/jackc/pgx/v5"
+	"strings"
+	"time"
+	"veverse-api/database"
+)
+
+var (
+	packageVersionSingular = "package version"
+	packageVersionPlural   = "package versions"
+)
+
+// ErrInvalidPackageVersion is returned for versions that are not valid semver, are not greater than previous versions or do not exist
+var ErrInvalidPackageVersion = errors.New("invalid package version")
+
+// PackageVersion is the published immutable version of the package with its own pak files
+type PackageVersion struct {
+	Id         uuid.UUID `json:"id"`
+	PackageId  uuid.UUID `json:"packageId"`
+	Version    string    `json:"version"`
+	Changelog  string    `json:"changelog"`
+	Deprecated bool      `json:"deprecated"`
+	ReleasedAt time.Time `json:"releasedAt"`
+	Files      []File    `json:"files,omitempty"` // Pak files of the version
+}
+
+// PackageVersionRequestMetadata Package version request metadata
+type PackageVersionRequestMetadata struct {
+	Platform   string `json:"platform,omitempty"`   // SupportedPlatform (OS) of the pak file (Win64, Mac, Linux, IOS, Android)
+	Deployment string `json:"deployment,omitempty"` // SupportedDeployment for the pak file (Server or Client)
+}
+
+// PackageVersionCreateMetadata Publishes the new version of the package
+type PackageVersionCreateMetadata struct {
+	Version   string `json:"version"`             // Semver, must be greater than all previous versions
+	Changelog string `json:"changelog,omitempty"` // Changes since the previous version
+}
+
+// PackageVersionUpdateMetadata Versions are immutable, only the deprecation flag can be changed
+type PackageVersionUpdateMetadata struct {
+	Deprecated *bool `json:"deprecated,omitempty"`
+}
+
+// WorldPackageVersion is the version of the world package used by the world
+type WorldPackageVersion struct {
+	WorldId   uuid.UUID       `json:"spaceId"`
+	PackageId *uuid.UUID      `json:"metaverseId,omitempty"`
+	Pinned    bool            `json:"pinned"`            // Whether the version is pinned or the latest version is used
+	Version   *PackageVersion `json:"version,omitempty"` // Not set for packages without published versions
+}
+
+// WorldPackageVersionMetadata Pins the world package version, the pin is removed if the version is not set
+type WorldPackageVersionMetadata struct {
+	Version *string `json:"version"`
+}
+
+// packageVersionQuery selects package versions, conditions are appended by callers
+const packageVersionQuery = `SELECT pv.id, pv.package_id, pv.version, pv.changelog, pv.deprecated, pv.released_at
+FROM package_versions pv`
+
+func scanPackageVersion(row pgx.Row) (entity *PackageVersion, err error) {
+	entity = &PackageVersion{}
+	if err = row.Scan(&entity.Id, &entity.PackageId, &entity.Version, &entity.Changelog, &entity.Deprecated, &entity.ReleasedAt); err != nil {
+		return nil, err
+	}
+	return entity, nil
+}
+
+//region Versions
+
+// indexPackageVersions Index versions of the package starting from the latest
+func indexPackageVersions(ctx context.Context, packageId uuid.UUID, offset int64, limit int64) (entities []PackageVersion, total int64, err error) {
+	db := database.DB
+
+	q := `SELECT COUNT(*) FROM package_versions pv WHERE pv.package_id = $1`
+	if err = db.QueryRow(ctx, q, packageId /*$1*/).Scan(&total); err != nil {
+		return nil, -1, err
+	}
+
+	entities = []PackageVersion{}
+	if total == 0 {
+		return entities, 0, nil
+	}
+
+	q = packageVersionQuery + `
+WHERE pv.package_id = $1
+ORDER BY pv.released_at DESC, pv.id
+OFFSET $2 LIMIT $3`
+
+	rows, err := db.Query(ctx, q, packageId /*$1*/, offset /*$2*/, limit /*$3*/)
+	if err != nil {
+		return nil, -1, fmt.Errorf("failed to query %s: %v", packageVersionPlural, err)
+	}
+
+	defer func() {
+		rows.Close()
+		database.LogPgxStat("indexPackageVersions")
+	}()
+
+	for rows.Next() {
+		e, err := scanPackageVersion(rows)
+		if err != nil {
+			return nil, -1, err
+		}
+		entities = append(entities, *e)
+	}
+
+	return entities, total, rows.Err()
+}
+
+// IndexPackageVersionsForAdmin Index versions of the package
+func IndexPackageVersionsForAdmin(ctx context.Context, packageId uuid.UUID, offset int64, limit int64) (entities []PackageVersion, total int64, err error) {
+	if _, err = getPackageLatestVersion(ctx, packageId); err != nil {
+		return nil, -1, err
+	}
+
+	return indexPackageVersions(ctx, packageId, offset, limit)
+}
+
+// IndexPackageVersionsForRequester Index versions of the package if the requester can view the package
+func IndexPackageVersionsForRequester(ctx context.Context, requester *sm.User, packageId uuid.UUID, offset int64, limit int64) (entities []PackageVersion, total int64, err error) {
+	if ok, err := EntityViewable(ctx, requester.Id, packageId); err != nil {
+		return nil, -1, err
+	} else if !ok {
+		return nil, -1, errors.New("no access")
+	}
+
+	return indexPackageVersions(ctx, packageId, offset, limit)
+}
+
+// getPackageVersionFiles returns pak files of the version, files of all platforms and deployments are returned if they are not set
+func getPackageVersionFiles(ctx context.Context, versionId uuid.UUID, platform string, deployment string) (files []File, err error) {
+	db := database.DB
+
+	q := `SELECT f.id, f.entity_id, f.type, f.url, f.mime, f.size, f.version, f.deployment_type, f.platform, f.uploaded_by, f.created_at, f.updated_at, f.original_path, f.hash
+FROM files f
+WHERE f.entity_id = $1
+  AND f.type = 'pak'
+  AND ($2::text = '' OR f.platform = $2::text)
+  AND ($3::text = '' OR f.deployment_type = $3::text)
+ORDER BY f.platform, f.deployment_type, f.created_at`
+
+	rows, err := db.Query(ctx, q, versionId /*$1*/, platform /*$2*/, deployment /*$3*/)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query %s files: %v", packageVersionSingular, err)
+	}
+
+	defer func() {
+		rows.Close()
+		database.LogPgxStat("getPackageVersionFiles")
+	}()
+
+	files = []File{}
+	for rows.Next() {
+		var (
+			f        File
+			id       uuid.UUID
+			entityId uuid.UUID
+		)
+		if err = rows.Scan(&id, &entityId, &f.Type, &f.Url, &f.Mime, &f.Size, &f.Version, &f.Deployment, &f.Platform, &f.UploadedBy, &f.CreatedAt, &f.UpdatedAt, &f.OriginalPath, &f.Hash); err != nil {
+			return nil, err
+		}
+		f.Id = &id
+		f.EntityId = &entityId
+		files = append(files, f)
+	}
+
+	return files, rows.Err()
+}
+
+// getPackageVersionByName returns the version of the package with its pak files, the latest version with a pak for the platform and deployment is returned if the version is empty, nil is returned if the package has no published versions
+func getPackageVersionByName(ctx context.Context, packageId uuid.UUID, version string, platform string, deployment string) (entity *PackageVersion, err error) {
+	db := database.DB
+
+	var row pgx.Row
+	if version == "" {
+		q := `SELECT package_latest_version(m.id, $2::text, $3::text) FROM mods m WHERE m.id = $1`
+
+		var versionId *uuid.UUID
+		if err = db.QueryRow(ctx, q, packageId /*$1*/, platform /*$2*/, deployment /*$3*/).Scan(&versionId); err != nil {
+			return nil, err
+		}
+
+		if versionId == nil {
+			return nil, nil
+		}
+
+		row = db.QueryRow(ctx, packageVersionQuery+"\nWHERE pv.id = $1", versionId /*$1*/)
+	} else {
+		row = db.QueryRow(ctx, packageVersionQuery+"\nWHERE pv.package_id = $1 AND pv.version = $2", packageId /*$1*/, version /*$2*/)
+	}
+
+	if entity, err = scanPackageVersion(row); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("%w: version %s not found", ErrInvalidPackageVersion, version)
+		}
+		return nil, err
+	}
+
+	if entity.Files, err = getPackageVersionFiles(ctx, entity.Id, platform, deployment); err != nil {
+		return nil, err
+	}
+
+	return entity, nil
+}
+
+// GetPackageVersionForAdmin returns the version of the package with its pak files, the latest version is returned if the version is empty
+func GetPackageVersionForAdmin(ctx context.Context, packageId uuid.UUID, version string, platform string, deployment string) (entity *PackageVersion, err error) {
+	return getPackageVersionByName(ctx, packageId, version, platform, deployment)
+}
+
+// GetPackageVersionForRequester returns the version of the package with its pak files if the requester can view the package, the latest version is returned if the version is empty
+func GetPackageVersionForRequester(ctx context.Context, requester *sm.User, packageId uuid.UUID, version string, platform string, deployment string) (entity *PackageVersion, err error) {
+	if ok, err := EntityViewable(ctx, requester.Id, packageId); err != nil {
+		return nil, err
+	} else if !ok {
+		return nil, errors.New("no access")
+	}
+
+	return getPackageVersionByName(ctx, packageId, version, platform, deployment)
+}
+
+// ApplyPackageVersion Replaces the version and pak files of the package with the ones of the version
+func ApplyPackageVersion(entity *Package, version *PackageVersion, withPak bool) {
+	if entity == nil || version == nil {
+		return
+	}
+
+	entity.VersionId = &version.Id
+	entity.Version = version.Version
+	entity.Changelog = version.Changelog
+	entity.Deprecated = version.Deprecated
+	entity.ReleasedAt = &version.ReleasedAt
+
+	if !withPak {
+		return
+	}
+
+	var files []File
+	for _, f := range entity.Files {
+		if f.Type != "pak" {
+			files = append(files, f)
+		}
+	}
+	entity.Files = append(files, version.Files...)
+}
+
+// createPackageVersion Publishes the new version of the package as a separate entity owned by the package owners with a snapshot of the package dependencies.
+// The version becomes the latest version once its paks are built, the visibility and accessibles of the package are kept in sync with its versions by triggers.
+func createPackageVersion(ctx context.Context, tx pgx.Tx, requester *sm.User, packageId uuid.UUID, m PackageVersionCreateMetadata) (id uuid.UUID, err error) {
+	m.Version = strings.TrimSpace(m.Version)
+	v, err := semver.NewVersion(m.Version)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("%w: %s is not a valid semver: %v", ErrInvalidPackageVersion, m.Version, err)
+	}
+
+	// The package is locked so concurrent versions are published in order
+	var public *bool
+	q := `SELECT e.public FROM mods m JOIN entities e ON e.id = m.id WHERE m.id = $1 FOR UPDATE OF m`
+	if err = tx.QueryRow(ctx, q, packageId /*$1*/).Scan(&public); err != nil {
+		return uuid.Nil, err
+	}
+
+	q = `SELECT pv.version FROM package_versions pv WHERE pv.package_id = $1`
+	rows, err := tx.Query(ctx, q, packageId /*$1*/)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("failed to query %s: %v", packageVersionPlural, err)
+	}
+
+	var versions []string
+	for rows.Next() {
+		var s string
+		if err = rows.Scan(&s); err != nil {
+			rows.Close()
+			return uuid.Nil, err
+		}
+		versions = append(versions, s)
+	}
+	rows.Close()
+
+	if err = rows.Err(); err != nil {
+		return uuid.Nil, err
+	}
+
+	for _, s := range versions {
+		previous, err := semver.NewVersion(s)
+		if err != nil {
+			continue
+		}
+
+		if !v.GreaterThan(previous) {
+			return uuid.Nil, fmt.Errorf("%w: version %s must be greater than %s", ErrInvalidPackageVersion, m.Version, s)
+		}
+	}
+
+	if id, err = uuid.NewV4(); err != nil {
+		return uuid.Nil, fmt.Errorf("failed to generate uuid: %v", err)
+	}
+
+	q = `INSERT INTO entities (id, entity_type, public) VALUES ($1, $2, $3)`
+	if _, err = tx.Exec(ctx, q, id /*$1*/, "mod_version" /*$2*/, public /*$3*/); err != nil {
+		return uuid.Nil, fmt.Errorf("failed to exec tx: %v", err)
+	}
+
+	// Package owners and editors can upload pak files of the version, later changes of the package accessibles are applied to the version by the trigger
+	q = `INSERT INTO accessibles (user_id, entity_id, is_owner, can_view, can_edit, can_delete)
+SELECT a.user_id, $2, a.is_owner, a.can_view, a.can_edit, a.can_delete FROM accessibles a WHERE a.entity_id = $1`
+	if _, err = tx.Exec(ctx, q, packageId /*$1*/, id /*$2*/); err != nil {
+		return uuid.Nil, fmt.Errorf("failed to exec tx: %v", err)
+	}
+
+	var createdBy *uuid.UUID
+	if requester != nil {
+		createdBy = &requester.Id
+	}
+
+	q = `INSERT INTO package_versions (id, package_id, version, changelog, created_by) VALUES ($1, $2, $3, $4, $5)`
+	if _, err = tx.Exec(ctx, q, id /*$1*/, packageId /*$2*/, m.Version /*$3*/, m.Changelog /*$4*/, createdBy /*$5*/); err != nil {
+		return uuid.Nil, fmt.Errorf("failed to exec tx: %v", err)
+	}
+
+	// Dependencies changed after publishing apply to the next version only
+	q = `INSERT INTO package_version_dependencies (version_id, dependency_id, version_constraint)
+SELECT $2, pd.dependency_id, pd.version_constraint FROM package_dependencies pd WHERE pd.package_id = $1`
+	if _, err = tx.Exec(ctx, q, packageId /*$1*/, id /*$2*/); err != nil {
+		return uuid.Nil, fmt.Errorf("failed to exec tx: %v", err)
+	}
+
+	q = `UPDATE mods SET version = $2 WHERE id = $1`
+	if _, err = tx.Exec(ctx, q, packageId /*$1*/, m.Version /*$2*/); err != nil {
+		return uuid.Nil, fmt.Errorf("failed to exec tx: %v", err)
+	}
+
+	return id, nil
+}
+
+// publishPackageVersion Publishes the new version of the package
+func publishPackageVersion(ctx context.Context, requester *sm.User, packageId uuid.UUID, m PackageVersionCreateMetadata) (entity *PackageVersion, err error) {
+	db := database.DB
+
+	tx, err1 := db.Begin(ctx)
+	if err1 != nil {
+		return nil, fmt.Errorf("failed to begin tx: %v", err1)
+	}
+
+	id, err1 := createPackageVersion(ctx, tx, requester, packageId, m)
+	if err1 != nil {
+		if err2 := tx.Rollback(ctx); err2 != nil {
+			return nil, fmt.Errorf("failed to rollback failed tx: %v, %v", err1, err2)
+		}
+		return nil, err1
+	}
+
+	if err1 = tx.Commit(ctx); err1 != nil {
+		if err2 := tx.Rollback(ctx); err2 != nil {
+			return nil, fmt.Errorf("failed to rollback failed tx: %v, %v", err1, err2)
+		}
+		return nil, fmt.Errorf("failed to commit tx: %v", err1)
+	}
+
+	return scanPackageVersion(db.QueryRow(ctx, packageVersionQuery+"\nWHERE pv.id = $1", id /*$1*/))
+}
+
+// CreatePackageVersionForAdmin Publishes the new version of the package
+func CreatePackageVersionForAdmin(ctx context.Context, requester *sm.User, packageId uuid.UUID, m PackageVersionCreateMetadata) (entity *PackageVersion, err error) {
+	return publishPackageVersion(ctx, requester, packageId, m)
+}
+
+// CreatePackageVersionForRequester Publishes the new version of the package if the requester can edit the package
+func CreatePackageVersionForRequester(ctx context.Context, requester *sm.User, packageId uuid.UUID, m PackageVersionCreateMetadata) (entity *PackageVersion, err error) {
+	if ok, err := EntityEditable(ctx, requester.Id, packageId); err != nil {
+		return nil, err
+	} else if !ok {
+		return nil, errors.New("no access")
+	}
+
+	return publishPackageVersion(ctx, requester, packageId, m)
+}
+
+// updatePackageVersion Changes the deprecation flag of the version, deprecated versions are skipped as the latest version unless all built versions are deprecated
+func updatePackageVersion(ctx context.Context, packageId uuid.UUID, version string, m PackageVersionUpdateMetadata) (entity *PackageVersion, err error) {
+	db := database.DB
+
+	if m.Deprecated == nil {
+		return getPackageVersionByName(ctx, packageId, version, "", "")
+	}
+
+	q := `UPDATE package_versions SET deprecated = $3 WHERE package_id = $1 AND version = $2`
+	tag, err := db.Exec(ctx, q, packageId /*$1*/, version /*$2*/, *m.Deprecated /*$3*/)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update the %s: %v", packageVersionSingular, err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return nil, fmt.Errorf("%w: version %s not found", ErrInvalidPackageVersion, version)
+	}
+
+	return getPackageVersionByName(ctx, packageId, version, "", "")
+}
+
+// UpdatePackageVersionForAdmin Changes the deprecation flag of the version
+func UpdatePackageVersionForAdmin(ctx context.Context, packageId uuid.UUID, version string, m PackageVersionUpdateMetadata) (entity *PackageVersion, err error) {
+	return updatePackageVersion(ctx, packageId, version, m)
+}
+
+// UpdatePackageVersionForRequester Changes the deprecation flag of the version if the requester can edit the package
+func UpdatePackageVersionForRequester(ctx context.Context, requester *sm.User, packageId uuid.UUID, version string, m PackageVersionUpdateMetadata) (entity *PackageVersion, err error) {
+	if ok, err := EntityEditable(ctx, requester.Id, packageId); err != nil {
+		return nil, err
+	} else if !ok {
+		return nil, errors.New("no access")
+	}
+
+	return updatePackageVersion(ctx, packageId, version, m)
+}
+
+// getPackageBuildEntity returns the entity package jobs are built into, the newest version of the package or the package itself if it has no published versions, other entities are returned as is
+func getPackageBuildEntity(ctx context.Context, entityId uuid.UUID) (id uuid.UUID, err error) {
+	db := database.DB
+
+	q := `SELECT coalesce(package_newest_version(m.id), m.id) FROM mods m WHERE m.id = $1`
+	if err = db.QueryRow(ctx, q, entityId /*$1*/).Scan(&id); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return entityId, nil
+		}
+		return uuid.Nil, err
+	}
+
+	return id, nil
+}
+
+//endregion
+
+//region World pinning
+
+// getWorldPackageVersion returns the pinned or the latest version of the world package
+func getWorldPackageVersion(ctx context.Context, worldId uuid.UUID) (entity *WorldPackageVersion, err error) {
+	db := database.DB
+
+	q := `SELECT s.mod_id, s.mod_version_id IS NOT NULL, coalesce(s.mod_version_id, package_latest_version(m.id, '', ''))
+FROM spaces s
+    LEFT JOIN mods m ON m.id = s.mod_id
+WHERE s.id = $1`
+
+	var versionId *uuid.UUID
+	entity = &WorldPackageVersion{WorldId: worldId}
+	if err = db.QueryRow(ctx, q, worldId /*$1*/).Scan(&entity.PackageId, &entity.Pinned, &versionId); err != nil {
+		return nil, err
+	}
+
+	if versionId == nil {
+		return entity, nil
+	}
+
+	if entity.Version, err = scanPackageVersion(db.QueryRow(ctx, packageVersionQuery+"\nWHERE pv.id = $1", versionId /*$1*/)); err != nil {
+		return nil, err
+	}
+
+	return entity, nil
+}
+
+// GetWorldPackageVersionForAdmin returns the pinned or the latest version of the world package
+func GetWorldPackageVersionForAdmin(ctx context.Context, worldId uuid.UUID) (entity *WorldPackageVersion, err error) {
+	return getWorldPackageVersion(ctx, worldId)
+}
+
+// GetWorldPackageVersionForRequester returns the pinned or the latest version of the world package if the requester can view the world
+func GetWorldPackageVersionForRequester(ctx context.Context, requester *sm.User, worldId uuid.UUID) (entity *WorldPackageVersion, err error) {
+	if ok, err := EntityViewable(ctx, requester.Id, worldId); err != nil {
+		return nil, err
+	} else if !ok {
+		return nil, errors.New("no access")
+	}
+
+	return getWorldPackageVersion(ctx, worldId)
+}
+
+// pinWorldPackageVersion Pins the version of the world package, the pin is removed if the version is not set
+func pinWorldPackageVersion(ctx context.Context, worldId uuid.UUID, version *string) (entity *WorldPackageVersion, err error) {
+	db := database.DB
+
+	current, err := getWorldPackageVersion(ctx, worldId)
+	if err != nil {
+		return nil, err
+	}
+
+	var versionId *uuid.UUID
+	if version != nil {
+		if current.PackageId == nil {
+			return nil, fmt.Errorf("%w: world has no package", ErrInvalidPackageVersion)
+		}
+
+		q := `SELECT pv.id FROM package_versions pv WHERE pv.package_id = $1 AND pv.version = $2`
+		if err = db.QueryRow(ctx, q, current.PackageId /*$1*/, *version /*$2*/).Scan(&versionId); err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return nil, fmt.Errorf("%w: version %s not found", ErrInvalidPackageVersion, *version)
+			}
+			return nil, err
+		}
+	}
+
+	q := `UPDATE spaces SET mod_version_id = $2 WHERE id = $1`
+	if _, err = db.Exec(ctx, q, worldId /*$1*/, versionId /*$2*/); err != nil {
+		return nil, fmt.Errorf("failed to pin the %s: %v", packageVersionSingular, err)
+	}
+
+	return getWorldPackageVersion(ctx, worldId)
+}
+
+// PinWorldPackageVersionForAdmin Pins the version of the world package
+func PinWorldPackageVersionForAdmin(ctx context.Context, worldId uuid.UUID, version *string) (entity *WorldPackageVersion, err error) {
+	return pinWorldPackageVersion(ctx, worldId, version)
+}
+
+// PinWorldPackageVersionForRequester Pins the version of the world package if the requester can edit the world
+func PinWorldPackageVersionForRequester(ctx context.Context, requester *sm.User, worldId uuid.UUID, version *string) (entity *WorldPackageVersion, err error) {
+	if ok, err := EntityEditable(ctx, requester.Id, worldId); err != nil {
+		return nil, err
+	} else if !ok {
+		return nil, errors.New("no access")
+	}
+
+	return pinWorldPackageVersion(ctx, worldId, version)
+}
+
+//endregion
@@ -336,7 +336,7 @@ FROM portals p
 	-- destination package
     LEFT JOIN mods m ON m.id = s.mod_id 
 	LEFT JOIN entities me ON me.id = m.id
-	LEFT JOIN files pak ON me.id = pak.entity_id AND pak.type = 'pak' AND pak.platform = $1::text AND pak.deployment_type = $2::text
+	LEFT JOIN files pak ON pak.entity_id = coalesce(s.mod_version_id, package_latest_version(m.id, $1::text, $2::text), me.id) AND pak.type = 'pak' AND pak.platform = $1::text AND pak.deployment_type = $2::text
 ORDER BY e.updated_at DESC, e.created_at DESC, e.id`
 
 	var (
@@ -585,7 +585,7 @@ FROM portals p
 	-- destination package
     LEFT JOIN mods m ON m.id = s.mod_id 
 	LEFT JOIN entities me ON me.id = m.id
-	LEFT JOIN files pak ON me.id = pak.entity_id AND pak.type = 'pak' AND pak.platform = $1::text AND pak.deployment_type = $2::text
+	LEFT JOIN files pak ON pak.entity_id = coalesce(s.mod_version_id, package_latest_version(m.id, $1::text, $2::text), me.id) AND pak.type = 'pak' AND pak.platform = $1::text AND pak.deployment_type = $2::text
 WHERE p.space_id = $3
 ORDER BY e.updated_at DESC, e.created_at DESC, e.id`
 
@@ -1049,7 +1049,7 @@ FROM portals p
 	-- destination package
     LEFT JOIN mods m ON m.id = s.mod_id
 	LEFT JOIN entities me ON me.id = m.id
-	LEFT JOIN files pak ON me.id = pak.entity_id AND pak.type = 'pak' AND pak.platform = $1::text AND pak.deployment_type = $2::text
+	LEFT JOIN files pak ON pak.entity_id = coalesce(s.mod_version_id, package_latest_version(m.id, $1::text, $2::text), me.id) AND pak.type = 'pak' AND pak.platform = $1::text AND pak.deployment_type = $2::text
 WHERE p.name ILIKE $3::text OR
       d.name ILIKE $3::text OR
       s.name ILIKE $3::text OR
@@ -1311,7 +1311,7 @@ FROM portals p
 	-- destination package
     LEFT JOIN mods m ON m.id = s.mod_id
 	LEFT JOIN entities me ON me.id = m.id
-	LEFT JOIN files pak ON me.id = pak.entity_id AND pak.type = 'pak' AND pak.platform = $1::text AND pak.deployment_type = $2::text
+	LEFT JOIN files pak ON pak.entity_id = coalesce(s.mod_version_id, package_latest_version(m.id, $1::text, $2::text), me.id) AND pak.type = 'pak' AND pak.platform = $1::text AND pak.deployment_type = $2::text
 WHERE p.space_id = $3 AND (
     p.name ILIKE $4::text OR
     d.name ILIKE $4::text OR
@@ -2025,7 +2025,7 @@ FROM portals p
     LEFT JOIN mods m ON m.id = s.mod_id
 	LEFT JOIN entities me ON me.id = m.id
     LEFT JOIN accessibles ma ON me.id = ma.entity_id AND a.user_id = $1::uuid
-	LEFT JOIN files pak ON me.id = pak.entity_id AND pak.type = 'pak' AND pak.platform = $2::text AND pak.deployment_type = $3::text
+	LEFT JOIN files pak ON pak.entity_id = coalesce(s.mod_version_id, package_latest_version(m.id, $2::text, $3::text), me.id) AND pak.type = 'pak' AND pak.platform = $2::text AND pak.deployment_type = $3::text
 WHERE (e.public OR a.can_view OR a.is_owner)
   AND (de.public OR da.can_view OR da.is_owner)
   AND (se.public OR sa.can_view OR sa.is_owner)
@@ -2302,7 +2302,7 @@ FROM portals p
     LEFT JOIN mods m ON m.id = s.mod_id
 	LEFT JOIN entities me ON me.id = m.id
     LEFT JOIN accessibles ma ON me.id = ma.entity_id AND a.user_id = $1::uuid
-	LEFT JOIN files pak ON me.id = pak.entity_id AND pak.type = 'pak' AND pak.platform = $2::text AND pak.deployment_type = $3::text
+	LEFT JOIN files pak ON pak.entity_id = coalesce(s.mod_version_id, package_latest_version(m.id, $2::text, $3::text), me.id) AND pak.type = 'pak' AND pak.platform = $2::text AND pak.deployment_type = $3::text
 WHERE p.space_id = $4 AND
       (e.public OR a.can_view OR a.is_owner) AND
       (de.public OR da.can_view OR da.is_owner) AND
@@ -3051,7 +3051,7 @@ FROM portals p
     LEFT JOIN mods m ON m.id = s.mod_id
 	LEFT JOIN entities me ON me.id = m.id
     LEFT JOIN accessibles ma ON me.id = ma.entity_id
-	LEFT JOIN files pak ON me.id = pak.entity_id AND pak.type = 'pak' AND pak.platform = $2::text AND pak.deployment_type = $3::text
+	LEFT JOIN files pak ON pak.entity_id = coalesce(s.mod_version_id, package_latest_version(m.id, $2::text, $3::text), me.id) AND pak.type = 'pak' AND pak.platform = $2::text AND pak.deployment_type = $3::text
 WHERE (e.public OR a.can_view OR a.is_owner)
   AND (de.public OR da.can_view OR da.is_owner)
   AND (se.public OR sa.can_view OR sa.is_owner)
@@ -3336,7 +3336,7 @@ FROM portals p
     LEFT JOIN mods m ON m.id = s.mod_id
 	LEFT JOIN entities me ON me.id = m.id
     LEFT JOIN accessibles ma ON me.id = ma.entity_id
-	LEFT JOIN files pak ON me.id = pak.entity_id AND pak.type = 'pak' AND pak.platform = $2::text AND pak.deployment_type = $3::text
+	LEFT JOIN files pak ON pak.entity_id = coalesce(s.mod_version_id, package_latest_version(m.id, $2::text, $3::text), me.id) AND pak.type = 'pak' AND pak.platform = $2::text AND pak.deployment_type = $3::text
 WHERE p.space_id = $4 
   AND (e.public OR a.can_view OR a.is_owner)
   AND (de.public OR da.can_view OR da.is_owner)
@@ -4067,7 +4067,7 @@ FROM portals p
 	-- destination package
     LEFT JOIN mods m ON m.id = s.mod_id 
 	LEFT JOIN entities me ON me.id = m.id
-	LEFT JOIN files pak ON me.id = pak.entity_id AND pak.type = 'pak' AND pak.platform = $1::text AND pak.deployment_type = $2::text
+	LEFT JOIN files pak ON pak.entity_id = coalesce(s.mod_version_id, package_latest_version(m.id, $1::text, $2::text), me.id) AND pak.type = 'pak' AND pak.platform = $1::text AND pak.deployment_type = $2::text
 WHERE p.id = $3
 ORDER BY e.id`
 
@@ -4462,7 +4462,7 @@ FROM portals p
     LEFT JOIN mods m ON m.id = s.mod_id 
 	LEFT JOIN entities me ON me.id = m.id
     LEFT JOIN accessibles ma ON me.id = ma.entity_id AND ma.user_id = $1::uuid
-	LEFT JOIN files pak ON me.id = pak.entity_id AND pak.type = 'pak' AND pak.platform = $2::text AND pak.deployment_type = $3::text
+	LEFT JOIN files pak ON pak.entity_id = coalesce(s.mod_version_id, package_latest_version(m.id, $2::text, $3::text), me.id) AND pak.type = 'pak' AND pak.platform = $2::text AND pak.deployment_type = $3::text
 WHERE p.id = $4
 ORDER BY e.id`
 
@@ -4855,6 +4855,17 @@ func CreatePortalForRequester(ctx context.Context, requester *sm.User, m PortalC
 	}
 	//endregion
 
+	//region Destination
+	if m.DestinationId != nil {
+		if err1 = validatePortalDestination(ctx, tx, requester, id, *m.DestinationId); err1 != nil {
+			if err2 := tx.Rollback(ctx); err2 != nil {
+				return nil, fmt.Errorf("failed to rollback failed tx: %v, %v", err1, err2)
+			}
+			return nil, err1
+		}
+	}
+	//endregion
+
 	//region World
 	q = `INSERT INTO portals (id, name, space_id, destination_id) VALUES ($1, $2, $3, $4)`
 
@@ -4917,6 +4928,13 @@ func UpdatePortalForRequester(ctx context.Context, requester *sm.User, id uuid.U
 	}
 
 	if m.DestinationId != nil {
+		if err1 = validatePortalDestination(ctx, tx, requester, id, *m.DestinationId); err1 != nil {
+			if err2 := tx.Rollback(ctx); err2 != nil {
+				return nil, fmt.Errorf("failed to rollback failed tx: %v, %v", err1, err2)
+			}
+			return nil, err1
+		}
+
 		if e.Destination != nil {
 			e.Destination.Id = m.DestinationId
 		} else {
@@ -4925,8 +4943,14 @@ func UpdatePortalForRequester(ctx context.Context, requester *sm.User, id uuid.U
 		}
 	}
 
-	q := `UPDATE portals SET name=$1, destination_id=$2, space_id=$3 WHERE id = $2`
-	if _, err1 = tx.Exec(ctx, q, e.Name /*$1*/, e.Destination.Id /*$2*/, e.World.Id /*$3*/); err1 != nil {
+	var destinationId *uuid.UUID
+	if e.Destination != nil {
+		destinationId = e.Destination.Id
+	}
+
+	// The world of the fetched portal is the destination world, the portal world is only changed if requested
+	q := `UPDATE portals SET name=$1, destination_id=$2, space_id=coalesce($3, space_id) WHERE id = $4`
+	if _, err1 = tx.Exec(ctx, q, e.Name /*$1*/, destinationId /*$2*/, m.WorldId /*$3*/, id /*$4*/); err1 != nil {
 		if err2 := tx.Rollback(ctx); err2 != nil {
 			return nil, fmt.Errorf("failed to rollback failed tx: %v, %v", err1, err2)
 		}
@@ -0,0 +1,277 @@
+package model
+
+import (
+	"context"
+	sm "dev.hackerman.me/artheon/veverse-shared/model"
+	"errors"
+	"fmt"
+	"github.com/gofrs/uuid"
+	"github.com/jackc/pgx/v5"
+	"strings"
+	"veverse-api/database"
+)
+
+// PortalRouteMaxHops limits the number of portals in the route
+const PortalRouteMaxHops = 16
+
+var (
+	// ErrInvalidPortalDestination is returned for destinations that do not exist, lead to the portal itself or to worlds the requester can not enter
+	ErrInvalidPortalDestination = errors.New("invalid portal destination")
+	// ErrNoPortalRoute is returned if the destination world can not be reached through portals the requester can use
+	ErrNoPortalRoute = errors.New("no route")
+)
+
+// PortalLink is the portal with its world and the destination portal with its world
+type PortalLink struct {
+	Id                   uuid.UUID `json:"id"`
+	Name                 string    `json:"name"`
+	WorldId              uuid.UUID `json:"spaceId"`
+	WorldName            string    `json:"spaceName"`
+	DestinationId        uuid.UUID `json:"destinationId"`
+	DestinationName      string    `json:"destinationName"`
+	DestinationWorldId   uuid.UUID `json:"destinationSpaceId"`
+	DestinationWorldName string    `json:"destinationSpaceName"`
+}
+
+// PortalRoute is the shortest sequence of portals leading from one world to another
+type PortalRoute struct {
+	FromId uuid.UUID    `json:"fromId"`
+	ToId   uuid.UUID    `json:"toId"`
+	Hops   []PortalLink `json:"hops"`
+}
+
+// portalLinkQuery selects links of portals with destinations, conditions are appended by callers
+const portalLinkQuery = `SELECT p.id,
+       coalesce(p.name, ''),
+       p.space_id,
+       coalesce(s.name, ''),
+       d.id,
+       coalesce(d.name, ''),
+       d.space_id,
+       coalesce(ds.name, '')
+FROM portals p
+    JOIN entities pe ON pe.id = p.id
+    JOIN spaces s ON s.id = p.space_id
+    JOIN portals d ON d.id = p.destination_id
+    JOIN entities de ON de.id = d.id
+    JOIN spaces ds ON ds.id = d.space_id
+    JOIN entities dse ON dse.id = ds.id`
+
+// portalLinkVisibility limits links to portals, destination portals and destination worlds the user can view
+func portalLinkVisibility(placeholder string) string {
+	return strings.NewReplacer("$user", placeholder).Replace(`(pe.public OR EXISTS(SELECT 1 FROM accessibles a WHERE a.entity_id = pe.id AND a.user_id = $user AND (a.can_view OR a.is_owner)))
+  AND (de.public OR EXISTS(SELECT 1 FROM accessibles a WHERE a.entity_id = de.id AND a.user_id = $user AND (a.can_view OR a.is_owner)))
+  AND (dse.public OR EXISTS(SELECT 1 FROM accessibles a WHERE a.entity_id = dse.id AND a.user_id = $user AND (a.can_view OR a.is_owner)))`)
+}
+
+func scanPortalLinks(rows pgx.Rows) (links []PortalLink, err error) {
+	defer rows.Close()
+
+	links = []PortalLink{}
+	for rows.Next() {
+		var l PortalLink
+		if err = rows.Scan(&l.Id, &l.Name, &l.WorldId, &l.WorldName, &l.DestinationId, &l.DestinationName, &l.DestinationWorldId, &l.DestinationWorldName); err != nil {
+			return nil, err
+		}
+		links = append(links, l)
+	}
+
+	return links, rows.Err()
+}
+
+// validatePortalDestination Checks that the destination portal exists, is not the portal itself and the requester can view the destination portal and its world
+func validatePortalDestination(ctx context.Context, tx pgx.Tx, requester *sm.User, portalId uuid.UUID, destinationId uuid.UUID) (err error) {
+	if destinationId == portalId {
+		return fmt.Errorf("%w: portal leads to itself", ErrInvalidPortalDestination)
+	}
+
+	// The destination is locked to keep it from being deleted before the tx is committed
+	q := `SELECT coalesce(de.public OR coalesce(da.can_view OR da.is_owner, false), false),
+       coalesce(se.public OR coalesce(sa.can_view OR sa.is_owner, false), false)
+FROM portals d
+    JOIN entities de ON de.id = d.id
+    JOIN entities se ON se.id = d.space_id
+    LEFT JOIN accessibles da ON da.entity_id = de.id AND da.user_id = $2
+    LEFT JOIN accessibles sa ON sa.entity_id = se.id AND sa.user_id = $2
+WHERE d.id = $1
+FOR SHARE OF d`
+
+	var portalViewable, worldViewable bool
+	if err = tx.QueryRow(ctx, q, destinationId /*$1*/, requester.Id /*$2*/).Scan(&portalViewable, &worldViewable); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return fmt.Errorf("%w: destination portal %s not found", ErrInvalidPortalDestination, destinationId)
+		}
+		return fmt.Errorf("failed to get the destination portal: %v", err)
+	}
+
+	if requester.IsAdmin || requester.IsInternal {
+		return nil
+	}
+
+	if !portalViewable || !worldViewable {
+		return fmt.Errorf("%w: no access to the destination %s", ErrInvalidPortalDestination, destinationId)
+	}
+
+	return nil
+}
+
+// indexInboundPortals Index portals leading into the world, requester portals are limited to the ones the requester can use
+func indexInboundPortals(ctx context.Context, requester *sm.User, worldId uuid.UUID, offset int64, limit int64) (entities []PortalLink, total int64, err error) {
+	db := database.DB
+
+	var (
+		q    = portalLinkQuery + "\nWHERE d.space_id = $1"
+		args = []interface{}{worldId /*$1*/}
+	)
+
+	if requester != nil {
+		q += "\n  AND " + portalLinkVisibility("$2")
+		args = append(args, requester.Id /*$2*/)
+	}
+
+	if err = db.QueryRow(ctx, `SELECT COUNT(*) FROM (`+q+`) l`, args...).Scan(&total); err != nil {
+		return nil, -1, err
+	}
+
+	if total == 0 {
+		return []PortalLink{}, 0, nil
+	}
+
+	q += fmt.Sprintf("\nORDER BY s.name, p.name, p.id\nOFFSET $%d LIMIT $%d", len(args)+1, len(args)+2)
+	rows, err := db.Query(ctx, q, append(args, offset, limit)...)
+	if err != nil {
+		return nil, -1, fmt.Errorf("failed to query %s: %v", portalPlural, err)
+	}
+
+	entities, err = scanPortalLinks(rows)
+	database.LogPgxStat("indexInboundPortals")
+	if err != nil {
+		return nil, -1, err
+	}
+
+	return entities, total, nil
+}
+
+// IndexInboundPortalsForAdmin Index portals leading into the world
+func IndexInboundPortalsForAdmin(ctx context.Context, worldId uuid.UUID, offset int64, limit int64) (entities []PortalLink, total int64, err error) {
+	return indexInboundPortals(ctx, nil, worldId, offset, limit)
+}
+
+// IndexInboundPortalsForRequester Index portals leading into the world the requester can view
+func IndexInboundPortalsForRequester(ctx context.Context, requester *sm.User, worldId uuid.UUID, offset int64, limit int64) (entities []PortalLink, total int64, err error) {
+	if ok, err := EntityViewable(ctx, requester.Id, worldId); err != nil {
+		return nil, -1, err
+	} else if !ok {
+		return nil, -1, errors.New("no access")
+	}
+
+	return indexInboundPortals(ctx, requester, worldId, offset, limit)
+}
+
+// findPortalRoute Breadth-first search of the shortest portal route, requester routes only use portals the requester can view, destinations the requester can not view are unreachable
+func findPortalRoute(ctx context.Context, requester *sm.User, fromId uuid.UUID, toId uuid.UUID) (route *PortalRoute, err error) {
+	db := database.DB
+
+	// The source world must exist
+	var exists bool
+	q := `SELECT EXISTS (SELECT 1 FROM spaces s WHERE s.id = $1)`
+	if err = db.QueryRow(ctx, q, fromId /*$1*/).Scan(&exists); err != nil {
+		return nil, err
+	}
+
+	if !exists {
+		return nil, pgx.ErrNoRows
+	}
+
+	route = &PortalRoute{FromId: fromId, ToId: toId, Hops: []PortalLink{}}
+	if fromId == toId {
+		return route, nil
+	}
+
+	// Missing destinations and destinations the requester can not view are reported as unreachable, so their existence is not disclosed
+	q = `SELECT EXISTS (SELECT 1 FROM spaces s JOIN entities e ON e.id = s.id WHERE s.id = $1`
+	args := []interface{}{toId /*$1*/}
+	if requester != nil {
+		q += ` AND (e.public OR EXISTS(SELECT 1 FROM accessibles a WHERE a.entity_id = e.id AND a.user_id = $2 AND (a.can_view OR a.is_owner)))`
+		args = append(args, requester.Id /*$2*/)
+	}
+	q += `)`
+	if err = db.QueryRow(ctx, q, args...).Scan(&exists); err != nil {
+		return nil, err
+	}
+
+	if !exists {
+		return nil, ErrNoPortalRoute
+	}
+
+	q = portalLinkQuery + "\nWHERE p.space_id = ANY($1) AND d.space_id != ALL($2)"
+	if requester != nil {
+		q += "\n  AND " + portalLinkVisibility("$3")
+	}
+	q += "\nORDER BY p.space_id, p.name, p.id"
+
+	var (
+		visited  = []uuid.UUID{fromId}
+		frontier = []uuid.UUID{fromId}
+		via      = map[uuid.UUID]PortalLink{} // Portal used to reach the world first
+	)
+
+	for hops := 0; hops < PortalRouteMaxHops && len(frontier) > 0; hops++ {
+		args := []interface{}{frontier /*$1*/, visited /*$2*/}
+		if requester != nil {
+			args = append(args, requester.Id /*$3*/)
+		}
+
+		rows, err := db.Query(ctx, q, args...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to query %s: %v", portalPlural, err)
+		}
+
+		links, err := scanPortalLinks(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		frontier = nil
+		for _, l := range links {
+			if _, ok := via[l.DestinationWorldId]; ok {
+				continue
+			}
+
+			via[l.DestinationWorldId] = l
+			visited = append(visited, l.DestinationWorldId)
+			frontier = append(frontier, l.DestinationWorldId)
+
+			if l.DestinationWorldId != toId {
+				continue
+			}
+
+			// Walk back to the source world
+			for worldId := toId; worldId != fromId; {
+				link := via[worldId]
+				route.Hops = append([]PortalLink{link}, route.Hops...)
+				worldId = link.WorldId
+			}
+
+			return route, nil
+		}
+	}
+
+	return nil, ErrNoPortalRoute
+}
+
+// FindPortalRouteForAdmin Finds the shortest portal route between worlds
+func FindPortalRouteForAdmin(ctx context.Context, fromId uuid.UUID, toId uuid.UUID) (route *PortalRoute, err error) {
+	return findPortalRoute(ctx, nil, fromId, toId)
+}
+
+// FindPortalRouteForRequester Finds the shortest portal route between worlds through portals and worlds the requester can view
+func FindPortalRouteForRequester(ctx context.Context, requester *sm.User, fromId uuid.UUID, toId uuid.UUID) (route *PortalRoute, err error) {
+	if ok, err := EntityViewable(ctx, requester.Id, fromId); err != nil {
+		return nil, err
+	} else if !ok {
+		return nil, errors.New("no access")
+	}
+
+	return findPortalRoute(ctx, requester, fromId, toId)
+}
@@ -0,0 +1,367 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/gofrs/uuid"
+	"os"
+	"strconv"
+	"veverse-api/aws/s3"
+	"veverse-api/database"
+)
+
+const (
+	StorageUsageGroupUser = "user"
+	StorageUsageGroupApp  = "app"
+)
+
+const (
+	storageDefaultUserQuota int64 = 10 * 1024 * 1024 * 1024 // Default per user quota
+	storageDefaultAppQuota  int64 = 0                       // Apps are not limited by default
+)
+
+var (
+	storageUserQuota = os.Getenv("STORAGE_USER_QUOTA") // Maximum number of bytes stored by files uploaded by a user, 0 for unlimited (default 10 GiB)
+	storageAppQuota  = os.Getenv("STORAGE_APP_QUOTA")  // Maximum number of bytes stored by files of an app, its releases and launchers, 0 for unlimited (default unlimited)
+)
+
+// storageUserObjects lists objects stored by users (owner_id) with the file (file_id) stored at the object: uploaded files except generated derivatives, kept file versions and blobs held by world snapshots the users have taken
+// Objects are identified by the url, so files sharing a blob and versions kept at the object of the current file are counted once
+const storageUserObjects = `SELECT f.uploaded_by owner_id, f.id file_id, f.url object, f.size
+FROM files f
+WHERE f.uploaded_by IS NOT NULL
+  AND f.derivative_of IS NULL
+UNION ALL
+SELECT v.uploaded_by, NULL, v.url, v.size
+FROM file_versions v
+WHERE v.uploaded_by IS NOT NULL
+UNION ALL
+SELECT ws.created_by, NULL, b.url, b.size
+FROM world_snapshots ws
+    INNER JOIN world_snapshot_blobs sb ON sb.snapshot_id = ws.id
+    INNER JOIN file_blobs b ON b.hash = sb.blob_hash
+WHERE ws.created_by IS NOT NULL`
+
+// storageEntityObjects lists objects stored for entities (entity_id) with the file (file_id) stored at the object: files except generated derivatives and kept file versions
+const storageEntityObjects = `SELECT f.entity_id, f.id file_id, f.url object, f.size
+FROM files f
+WHERE f.derivative_of IS NULL
+UNION ALL
+SELECT v.entity_id, NULL, v.url, v.size
+FROM file_versions v`
+
+var ErrStorageQuotaExceeded = errors.New("storage quota exceeded")
+
+var ErrFileSizeRequired = errors.New("file size is required")
+
+// StorageUsage is the number of bytes stored by files of the user or the app
+type StorageUsage struct {
+	OwnerId *uuid.UUID     `json:"ownerId,omitempty"` // User or app id
+	Name    *string        `json:"name,omitempty"`    // User or app name
+	Used    int64          `json:"used"`              // Bytes stored
+	Files   int64          `json:"files"`             // Number of files
+	Quota   int64          `json:"quota"`             // Maximum number of bytes, 0 if unlimited
+	Free    *int64         `json:"free,omitempty"`    // Bytes left, omitted if unlimited
+	Group   string         `json:"group"`             // user or app
+	Apps    []StorageUsage `json:"apps,omitempty"`    // Usage of apps owned by the user
+}
+
+type StorageUsageBatchRequestMetadata struct {
+	BatchRequestMetadata
+	Group string `json:"group,omitempty" query:"group"` // Group usage by user (default) or app
+}
+
+func defaultStorageQuota(group string) int64 {
+	var (
+		env   = storageUserQuota
+		quota = storageDefaultUserQuota
+	)
+
+	if group == StorageUsageGroupApp {
+		env = storageAppQuota
+		quota = storageDefaultAppQuota
+	}
+
+	if env != "" {
+		if v, err := strconv.ParseInt(env, 10, 64); err == nil && v >= 0 {
+			quota = v
+		}
+	}
+
+	return quota
+}
+
+func (u *StorageUsage) setFree() {
+	u.Free = nil
+	if u.Quota > 0 {
+		free := u.Quota - u.Used
+		if free < 0 {
+			free = 0
+		}
+		u.Free = &free
+	}
+}
+
+// getStorageQuota returns the quota of the user or the app, overrides take precedence over the defaults
+func getStorageQuota(ctx context.Context, ownerId uuid.UUID, group string) (quota int64, err error) {
+	db := database.DB
+
+	q := `SELECT coalesce((SELECT q.quota FROM storage_quotas q WHERE q.owner_id = $1), $2)`
+	err = db.QueryRow(ctx, q, ownerId /*$1*/, defaultStorageQuota(group) /*$2*/).Scan(&quota)
+	return quota, err
+}
+
+// getEntityStorageApp returns the app owning the entity (the app itself, its release or launcher), nil if the entity does not belong to an app
+func getEntityStorageApp(ctx context.Context, entityId uuid.UUID) (appId *uuid.UUID, err error) {
+	db := database.DB
+
+	q := `SELECT coalesce(a.id, r.app_id, l.app_id)
+FROM entities e
+    LEFT JOIN apps a ON a.id = e.id
+    LEFT JOIN releases r ON r.id = e.id
+    LEFT JOIN launchers l ON l.id = e.id
+WHERE e.id = $1`
+	err = db.QueryRow(ctx, q, entityId /*$1*/).Scan(&appId)
+	if err != nil {
+		return nil, err
+	}
+
+	return appId, nil
+}
+
+// getUserStorageUsed returns the number of bytes and files uploaded by the user, the excluded file is not counted (e.g. the file being replaced)
+// Files sharing a blob are counted once as the blob is stored once, kept versions and blobs held by snapshots are counted, generated image derivatives are not counted
+func getUserStorageUsed(ctx context.Context, userId uuid.UUID, excludeFileId uuid.UUID) (used int64, files int64, err error) {
+	db := database.DB
+
+	q := `SELECT coalesce(sum(b.size), 0)::bigint, coalesce(sum(b.files), 0)::bigint
+FROM (SELECT max(s.size) size, count(s.file_id) files
+      FROM (` + storageUserObjects + `) s
+      WHERE s.owner_id = $1
+        AND s.file_id IS DISTINCT FROM $2
+      GROUP BY s.object) b`
+	err = db.QueryRow(ctx, q, userId /*$1*/, excludeFileId /*$2*/).Scan(&used, &files)
+	return used, files, err
+}
+
+// getAppStorageUsed returns the number of bytes and files of the app, its releases and launchers, the excluded file is not counted (e.g. the file being replaced)
+// Files sharing a blob are counted once as the blob is stored once, kept versions are counted, generated image derivatives are not counted
+func getAppStorageUsed(ctx context.Context, appId uuid.UUID, excludeFileId uuid.UUID) (used int64, files int64, err error) {
+	db := database.DB
+
+	q := `SELECT coalesce(sum(b.size), 0)::bigint, coalesce(sum(b.files), 0)::bigint
+FROM (SELECT max(s.size) size, count(s.file_id) files
+      FROM (` + storageEntityObjects + `) s
+      WHERE s.entity_id IN (SELECT $1::uuid
+                            UNION ALL
+                            SELECT r.id FROM releases r WHERE r.app_id = $1
+                            UNION ALL
+                            SELECT l.id FROM launchers l WHERE l.app_id = $1)
+        AND s.file_id IS DISTINCT FROM $2
+      GROUP BY s.object) b`
+	err = db.QueryRow(ctx, q, appId /*$1*/, excludeFileId /*$2*/).Scan(&used, &files)
+	return used, files, err
+}
+
+// getFileLinkSize returns the size of the linked object if it is stored at the storage, links to external urls do not use the quota
+func getFileLinkSize(m FileLinkRequestMetadata) (size int64, err error) {
+	if !s3.IsStorageUrl(m.Url) {
+		return 0, nil
+	}
+
+	size, _, err = s3.GetObjectInfo(s3.GetS3KeyForEntityUrl(m.Url))
+	if err != nil {
+		return 0, fmt.Errorf("failed to get the linked object info: %v", err)
+	}
+
+	return size, nil
+}
+
+// checkStorageQuota Checks if the requester and the app owning the entity can store additional bytes, the size of the replaced file is released
+func checkStorageQuota(ctx context.Context, requesterId uuid.UUID, entityId uuid.UUID, size int64, replacedFileId uuid.UUID) (err error) {
+	if size <= 0 {
+		return nil
+	}
+
+	// The replaced file is kept as a version if the history is enabled for its type, so its size is not released
+	if !replacedFileId.IsNil() {
+		var fileType string
+		q := `SELECT f.type FROM files f WHERE f.id = $1`
+		if err = database.DB.QueryRow(ctx, q, replacedFileId /*$1*/).Scan(&fileType); err == nil && getFileVersionRetention(fileType) > 0 {
+			replacedFileId = uuid.Nil
+		}
+	}
+
+	//region User quota
+	quota, err := getStorageQuota(ctx, requesterId, StorageUsageGroupUser)
+	if err != nil {
+		return fmt.Errorf("failed to get the user storage quota: %v", err)
+	}
+
+	if quota > 0 {
+		used, _, err := getUserStorageUsed(ctx, requesterId, replacedFileId)
+		if err != nil {
+			return fmt.Errorf("failed to get the user storage usage: %v", err)
+		}
+
+		if used+size > quota {
+			return ErrStorageQuotaExceeded
+		}
+	}
+	//endregion
+
+	//region App quota
+	appId, err := getEntityStorageApp(ctx, entityId)
+	if err != nil {
+		return err
+	}
+
+	if appId != nil {
+		quota, err = getStorageQuota(ctx, *appId, StorageUsageGroupApp)
+		if err != nil {
+			return fmt.Errorf("failed to get the app storage quota: %v", err)
+		}
+
+		if quota > 0 {
+			used, _, err := getAppStorageUsed(ctx, *appId, replacedFileId)
+			if err != nil {
+				return fmt.Errorf("failed to get the app storage usage: %v", err)
+			}
+
+			if used+size > quota {
+				return ErrStorageQuotaExceeded
+			}
+		}
+	}
+	//endregion
+
+	return nil
+}
+
+// GetStorageUsageForRequester Get the storage usage of the requester and apps the requester owns
+func GetStorageUsageForRequester(ctx context.Context, requesterId uuid.UUID) (usage *StorageUsage, err error) {
+	db := database.DB
+
+	usage = &StorageUsage{OwnerId: &requesterId, Group: StorageUsageGroupUser}
+	usage.Used, usage.Files, err = getUserStorageUsed(ctx, requesterId, uuid.Nil)
+	if err != nil {
+		return nil, err
+	}
+
+	usage.Quota, err = getStorageQuota(ctx, requesterId, StorageUsageGroupUser)
+	if err != nil {
+		return nil, err
+	}
+	usage.setFree()
+
+	q := `SELECT a.id, a.name
+FROM apps a
+    INNER JOIN accessibles ac ON ac.entity_id = a.id AND ac.user_id = $1 AND ac.is_owner
+ORDER BY a.name`
+	rows, err := db.Query(ctx, q, requesterId /*$1*/)
+	if err != nil {
+		return nil, err
+	}
+
+	var apps []StorageUsage
+	for rows.Next() {
+		var (
+			appId uuid.UUID
+			name  *string
+		)
+		if err = rows.Scan(&appId, &name); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		apps = append(apps, StorageUsage{OwnerId: &appId, Name: name, Group: StorageUsageGroupApp})
+	}
+	rows.Close()
+
+	for i := range apps {
+		apps[i].Used, apps[i].Files, err = getAppStorageUsed(ctx, *apps[i].OwnerId, uuid.Nil)
+		if err != nil {
+			return nil, err
+		}
+
+		apps[i].Quota, err = getStorageQuota(ctx, *apps[i].OwnerId, StorageUsageGroupApp)
+		if err != nil {
+			return nil, err
+		}
+		apps[i].setFree()
+	}
+
+	usage.Apps = apps
+	return usage, nil
+}
+
+// IndexStorageUsageForAdmin Index storage usage by users or apps ordered by the number of stored bytes
+func IndexStorageUsageForAdmin(ctx context.Context, group string, offset int64, limit int64) (entities []StorageUsage, total int64, err error) {
+	db := database.DB
+
+	var (
+		qt string // total query
+		q  string // usage query
+	)
+
+	switch group {
+	case "", StorageUsageGroupUser:
+		group = StorageUsageGroupUser
+		qt = `SELECT count(DISTINCT s.owner_id) FROM (` + storageUserObjects + `) s`
+		q = `SELECT b.owner_id, u.name, coalesce(sum(b.size), 0)::bigint used, coalesce(sum(b.files), 0)::bigint, coalesce(q.quota, $3)
+FROM (SELECT s.owner_id, max(s.size) size, count(s.file_id) files
+      FROM (` + storageUserObjects + `) s
+      GROUP BY s.owner_id, s.object) b
+    LEFT JOIN users u ON u.id = b.owner_id
+    LEFT JOIN storage_quotas q ON q.owner_id = b.owner_id
+GROUP BY b.owner_id, u.name, q.quota
+ORDER BY used DESC, b.owner_id
+OFFSET $1 LIMIT $2`
+	case StorageUsageGroupApp:
+		qt = `SELECT count(*) FROM apps a`
+		q = `SELECT a.id, a.name, s.used, s.files, coalesce(q.quota, $3)
+FROM apps a
+    LEFT JOIN LATERAL (SELECT coalesce(sum(b.size), 0)::bigint used, coalesce(sum(b.files), 0)::bigint files
+                       FROM (SELECT max(o.size) size, count(o.file_id) files
+                             FROM (` + storageEntityObjects + `) o
+                             WHERE o.entity_id IN (SELECT a.id
+                                                   UNION ALL
+                                                   SELECT r.id FROM releases r WHERE r.app_id = a.id
+                                                   UNION ALL
+                                                   SELECT l.id FROM launchers l WHERE l.app_id = a.id)
+                             GROUP BY o.object) b) s ON true
+    LEFT JOIN storage_quotas q ON q.owner_id = a.id
+ORDER BY s.used DESC, a.id
+OFFSET $1 LIMIT $2`
+	default:
+		return nil, 0, fmt.Errorf("invalid group")
+	}
+
+	if err = db.QueryRow(ctx, qt).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := db.Query(ctx, q, offset /*$1*/, limit /*$2*/, defaultStorageQuota(group) /*$3*/)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			e       StorageUsage
+			ownerId uuid.UUID
+		)
+
+		if err = rows.Scan(&ownerId, &e.Name, &e.Used, &e.Files, &e.Quota); err != nil {
+			return nil, 0, err
+		}
+
+		e.OwnerId = &ownerId
+		e.Group = group
+		e.setFree()
+		entities = append(entities, e)
+	}
+
+	return entities, total, rows.Err()
+}
@@ -0,0 +1,314 @@
+package model
+
+import (
+	"context"
+	sm "dev.hackerman.me/artheon/veverse-shared/model"
+	"errors"
+	"fmt"
+	"github.com/gofrs/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/sirupsen/logrus"
+	"regexp"
+	"veverse-api/database"
+	"veverse-api/reflect"
+)
+
+// Relationship is a typed directed relationship between two entities
+type Relationship struct {
+	Identifier
+
+	SourceId   *uuid.UUID             `json:"sourceId,omitempty"`   // Entity the relationship starts from
+	SourceType *string                `json:"sourceType,omitempty"` // Entity type of the source
+	TargetId   *uuid.UUID             `json:"targetId,omitempty"`   // Entity the relationship points to
+	TargetType *string                `json:"targetType,omitempty"` // Entity type of the target
+	Type       string                 `json:"type"`                 // Relationship type
+	Metadata   map[string]interface{} `json:"metadata,omitempty"`   // Optional relationship metadata
+	Order      int32                  `json:"order"`                // Order among the relationships of the same source and type
+
+	Timestamps
+}
+
+// Well-known relationship types, any type matching relationshipTypePattern is accepted
+const (
+	RelationshipFeatures = "features" // World features an art object
+	RelationshipRequires = "requires" // Package requires another package
+	RelationshipBundles  = "bundles"  // App bundles a world
+)
+
+// RelationshipBatchRequestMetadata Batch request metadata for requesting entity relationships
+type RelationshipBatchRequestMetadata struct {
+	BatchRequestMetadata
+	Type string `json:"type,omitempty"` // Optional relationship type to filter by
+}
+
+type RelationshipCreateMetadata struct {
+	TargetId uuid.UUID              `json:"targetId"`           // Entity the relationship points to
+	Type     string                 `json:"type"`               // Relationship type
+	Metadata map[string]interface{} `json:"metadata,omitempty"` // Optional relationship metadata
+	Order    *int32                 `json:"order,omitempty"`    // Optional order, defaults to 0
+}
+
+type RelationshipUpdateMetadata struct {
+	Metadata map[string]interface{} `json:"metadata,omitempty"` // Relationship metadata, replaces the existing metadata
+	Order    *int32                 `json:"order,omitempty"`    // Order among the relationships of the same source and type
+}
+
+var (
+	relationshipSingular = "relationship"
+	relationshipPlural   = "relationships"
+)
+
+var relationshipTypePattern = regexp.MustCompile(`^[a-z][a-z0-9_-]{0,63}$`)
+
+// ValidRelationshipType checks if the relationship type is a lowercase identifier
+func ValidRelationshipType(t string) bool {
+	return relationshipTypePattern.MatchString(t)
+}
+
+// IndexRelationshipsForAdmin Index relationships of the entity, outbound relationships start from the entity, inbound relationships point to it
+func IndexRelationshipsForAdmin(ctx context.Context, entityId uuid.UUID, relationshipType string, inbound bool, offset int64, limit int64) (relationships []Relationship, total int64, err error) {
+	return indexRelationships(ctx, nil, entityId, relationshipType, inbound, offset, limit)
+}
+
+// IndexRelationshipsForRequester Index relationships of the entity visible to the requester, the other end of each relationship must be visible too
+func IndexRelationshipsForRequester(ctx context.Context, requester *sm.User, entityId uuid.UUID, relationshipType string, inbound bool, offset int64, limit int64) (relationships []Relationship, total int64, err error) {
+	canView, err := EntityViewable(ctx, requester.Id, entityId)
+	if err != nil {
+		return nil, -1, err
+	}
+
+	if !canView {
+		return nil, -1, errors.New("no access")
+	}
+
+	return indexRelationships(ctx, &requester.Id, entityId, relationshipType, inbound, offset, limit)
+}
+
+func indexRelationships(ctx context.Context, requesterId *uuid.UUID, entityId uuid.UUID, relationshipType string, inbound bool, offset int64, limit int64) (relationships []Relationship, total int64, err error) {
+	db := database.DB
+
+	// The entity is matched by the "self" column, "other" is the opposite end of the relationship
+	self, other := "source_id", "target_id"
+	if inbound {
+		self, other = "target_id", "source_id"
+	}
+
+	// Admins ($1 is null) see all relationships, requesters only the ones with a visible opposite end
+	filter := `r.` + self + ` = $2 AND ($3::text = '' OR r.type = $3::text)
+	AND ($1::uuid IS NULL OR o.public OR EXISTS (SELECT 1 FROM accessibles a WHERE a.entity_id = o.id AND a.user_id = $1::uuid AND (a.can_view OR a.is_owner)))`
+
+	q := `SELECT COUNT(*)
+FROM entity_relationships r
+	LEFT JOIN entities o ON o.id = r.` + other + `
+WHERE ` + filter
+
+	row := db.QueryRow(ctx, q, requesterId /*$1*/, entityId /*$2*/, relationshipType /*$3*/)
+	if err = row.Scan(&total); err != nil {
+		logrus.Errorf("failed to scan %s @ %s: %v", relationshipPlural, reflect.FunctionName(), err)
+		return nil, -1, fmt.Errorf("failed to get %s", relationshipPlural)
+	}
+
+	q = `SELECT r.id, r.source_id, s.entity_type, r.target_id, t.entity_type, r.type, r.metadata, r.sort_order, r.created_at, r.updated_at
+FROM entity_relationships r
+	LEFT JOIN entities o ON o.id = r.` + other + `
+	LEFT JOIN entities s ON s.id = r.source_id
+	LEFT JOIN entities t ON t.id = r.target_id
+WHERE ` + filter + `
+ORDER BY r.type, r.sort_order, r.created_at, r.id
+OFFSET $4 LIMIT $5`
+
+	var rows pgx.Rows
+	rows, err = db.Query(ctx, q, requesterId /*$1*/, entityId /*$2*/, relationshipType /*$3*/, offset /*$4*/, limit /*$5*/)
+	if err != nil {
+		logrus.Errorf("failed to query %s @ %s: %v", relationshipPlural, reflect.FunctionName(), err)
+		return nil, -1, fmt.Errorf("failed to get %s", relationshipPlural)
+	}
+
+	defer func() {
+		rows.Close()
+		database.LogPgxStat("indexRelationships")
+	}()
+	for rows.Next() {
+		var r Relationship
+		err = rows.Scan(&r.Id, &r.SourceId, &r.SourceType, &r.TargetId, &r.TargetType, &r.Type, &r.Metadata, &r.Order, &r.CreatedAt, &r.UpdatedAt)
+		if err != nil {
+			logrus.Errorf("failed to scan %s @ %s: %v", relationshipPlural, reflect.FunctionName(), err)
+			return nil, -1, fmt.Errorf("failed to get %s", relationshipPlural)
+		}
+
+		relationships = append(relationships, r)
+	}
+
+	return relationships, total, nil
+}
+
+// GetRelationship Get the relationship by id
+func GetRelationship(ctx context.Context, id uuid.UUID) (relationship *Relationship, err error) {
+	db := database.DB
+
+	q := `SELECT r.id, r.source_id, s.entity_type, r.target_id, t.entity_type, r.type, r.metadata, r.sort_order, r.created_at, r.updated_at
+FROM entity_relationships r
+	LEFT JOIN entities s ON s.id = r.source_id
+	LEFT JOIN entities t ON t.id = r.target_id
+WHERE r.id = $1`
+
+	var r Relationship
+	err = db.QueryRow(ctx, q, id).Scan(&r.Id, &r.SourceId, &r.SourceType, &r.TargetId, &r.TargetType, &r.Type, &r.Metadata, &r.Order, &r.CreatedAt, &r.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &r, nil
+}
+
+// CreateRelationshipForAdmin Creates a relationship from the source entity to the target entity
+func CreateRelationshipForAdmin(ctx context.Context, sourceId uuid.UUID, m RelationshipCreateMetadata) (relationship *Relationship, err error) {
+	if !ValidRelationshipType(m.Type) {
+		return nil, fmt.Errorf("invalid %s type", relationshipSingular)
+	}
+
+	if sourceId == m.TargetId {
+		return nil, fmt.Errorf("%s source and target must differ", relationshipSingular)
+	}
+
+	var order int32
+	if m.Order != nil {
+		order = *m.Order
+	}
+
+	var metadata interface{}
+	if m.Metadata != nil {
+		metadata = m.Metadata
+	}
+
+	db := database.DB
+
+	q := `INSERT INTO entity_relationships (source_id, target_id, type, metadata, sort_order)
+VALUES ($1, $2, $3, $4::jsonb, $5)
+ON CONFLICT (source_id, target_id, type) DO UPDATE SET metadata = excluded.metadata, sort_order = excluded.sort_order, updated_at = now()
+RETURNING id`
+
+	var id uuid.UUID
+	err = db.QueryRow(ctx, q, sourceId /*$1*/, m.TargetId /*$2*/, m.Type /*$3*/, metadata /*$4*/, order /*$5*/).Scan(&id)
+	if err != nil {
+		logrus.Errorf("failed to insert %s @ %s: %v", relationshipSingular, reflect.FunctionName(), err)
+		return nil, fmt.Errorf("failed to create %s", relationshipSingular)
+	}
+
+	return GetRelationship(ctx, id)
+}
+
+// CreateRelationshipForRequester Creates a relationship if the requester can edit the source entity and view the target entity
+func CreateRelationshipForRequester(ctx context.Context, requester *sm.User, sourceId uuid.UUID, m RelationshipCreateMetadata) (relationship *Relationship, err error) {
+	canEdit, err := EntityEditable(ctx, requester.Id, sourceId)
+	if err != nil {
+		return nil, err
+	}
+
+	if !canEdit {
+		return nil, errors.New("no access")
+	}
+
+	canView, err := EntityViewable(ctx, requester.Id, m.TargetId)
+	if err != nil {
+		return nil, err
+	}
+
+	if !canView {
+		return nil, errors.New("no access")
+	}
+
+	return CreateRelationshipForAdmin(ctx, sourceId, m)
+}
+
+// UpdateRelationshipForAdmin Updates the relationship metadata and order
+func UpdateRelationshipForAdmin(ctx context.Context, id uuid.UUID, m RelationshipUpdateMetadata) (relationship *Relationship, err error) {
+	// Keep the existing metadata if it is not provided
+	var metadata interface{}
+	if m.Metadata != nil {
+		metadata = m.Metadata
+	}
+
+	db := database.DB
+
+	q := `UPDATE entity_relationships
+SET metadata = coalesce($2::jsonb, metadata), sort_order = coalesce($3, sort_order), updated_at = now()
+WHERE id = $1`
+
+	res, err := db.Exec(ctx, q, id /*$1*/, metadata /*$2*/, m.Order /*$3*/)
+	if err != nil {
+		logrus.Errorf("failed to update %s @ %s: %v", relationshipSingular, reflect.FunctionName(), err)
+		return nil, fmt.Errorf("failed to update %s", relationshipSingular)
+	}
+
+	if res.RowsAffected() == 0 {
+		return nil, pgx.ErrNoRows
+	}
+
+	return GetRelationship(ctx, id)
+}
+
+// UpdateRelationshipForRequester Updates the relationship if the requester can edit its source entity
+func UpdateRelationshipForRequester(ctx context.Context, requester *sm.User, id uuid.UUID, m RelationshipUpdateMetadata) (relationship *Relationship, err error) {
+	relationship, err = GetRelationship(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	canEdit, err := EntityEditable(ctx, requester.Id, *relationship.SourceId)
+	if err != nil {
+		return nil, err
+	}
+
+	if !canEdit {
+		return nil, errors.New("no access")
+	}
+
+	return UpdateRelationshipForAdmin(ctx, id, m)
+}
+
+// DeleteRelationshipForAdmin Deletes the relationship
+func DeleteRelationshipForAdmin(ctx context.Context, id uuid.UUID) (err error) {
+	db := database.DB
+
+	q := `DELETE FROM entity_relationships WHERE id = $1`
+
+	res, err := db.Exec(ctx, q, id)
+	if err != nil {
+		logrus.Errorf("failed to delete %s @ %s: %v", relationshipSingular, reflect.FunctionName(), err)
+		return fmt.Errorf("failed to delete %s", relationshipSingular)
+	}
+
+	if res.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+
+	return nil
+}
+
+// DeleteRelationshipForRequester Deletes the relationship if the requester can edit either of its ends
+func DeleteRelationshipForRequester(ctx context.Context, requester *sm.User, id uuid.UUID) (err error) {
+	relationship, err := GetRelationship(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	canEdit, err := EntityEditable(ctx, requester.Id, *relationship.SourceId)
+	if err != nil {
+		return err
+	}
+
+	if !canEdit {
+		// The owner of the target is allowed to detach its entity from the source
+		canEdit, err = EntityEditable(ctx, requester.Id, *relationship.TargetId)
+		if err != nil {
+			return err
+		}
+	}
+
+	if !canEdit {
+		return errors.New("no access")
+	}
+
+	return DeleteRelationshipForAdmin(ctx, id)
+}
@@ -14,6 +14,7 @@ type BatchRequestMetadata struct {
 	Offset int64  `json:"offset"` // Start index
 	Limit  int64  `json:"limit"`  // Number of elements to fetch
 	Query  string `json:"query"`  // Search query string
+	Sort   string `json:"sort"`   // Optional sort order (trending)
 }
 
 type KeyRequestMetadata struct {
@@ -0,0 +1,507 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/gofrs/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/sirupsen/logrus"
+	"io"
+	"os"
+	"time"
+	"veverse-api/aws/s3"
+	"veverse-api/aws/ses"
+	"veverse-api/database"
+	"veverse-api/gltf"
+	"veverse-api/reflect"
+	"veverse-api/scanner"
+)
+
+var (
+	fileScanSingular = "file scan"
+	fileScanPlural   = "file scans"
+)
+
+// File scan statuses, files without the status have not been queued yet and can not be downloaded while scanning is enabled
+const (
+	FileScanPending   = "pending"   // File is queued for the scan and can not be downloaded
+	FileScanClean     = "clean"     // No threats found
+	FileScanInfected  = "infected"  // Threat found, the file can not be downloaded
+	FileScanFailed    = "failed"    // File could not be scanned, the file can not be downloaded
+	FileScanExternal  = "external"  // File is linked to an external url and is not stored by the API, the download redirects to the url
+	FileScanVerifying = "verifying" // Contents of the multipart upload are being verified, the file is queued for the scan afterwards and can not be downloaded
+)
+
+// File scan job statuses
+const (
+	FileScanJobPending    = "pending"
+	FileScanJobProcessing = "processing"
+	FileScanJobCompleted  = "completed"
+	FileScanJobFailed     = "failed"
+)
+
+const (
+	fileScanMaxAttempts  = 3  // Jobs are marked as failed after this number of attempts
+	fileScanBatchSize    = 10 // Number of jobs processed per worker run
+	fileScanJobRetention = 7 * 24 * time.Hour
+	fileScanUploadWindow = 7 * time.Hour    // Jobs of files uploaded using presigned urls wait for the object while the upload url is valid (6 hours by default)
+	fileScanUploadRetry  = 1 * time.Minute  // Delay before the job of a file which object has not been uploaded yet is processed again
+	fileScanJobTimeout   = 30 * time.Minute // Processing jobs are reclaimed after this time (e.g. if the API instance has been stopped)
+)
+
+var fileScanWorkerInterval = os.Getenv("FILE_SCANNER_WORKER_INTERVAL") // Interval between scan worker runs (default 10s)
+
+var ErrFileNotScanned = errors.New("file has not been scanned")
+var ErrFileInfected = errors.New("file is infected")
+var ErrFileNotVerified = errors.New("file upload has not been verified")
+
+var (
+	errFileNotStored         = errors.New("file is not stored at the storage")
+	errFileObjectNotUploaded = errors.New("file object has not been uploaded yet")
+)
+
+// CheckFileScanStatus returns an error if the file can not be downloaded because it has not been scanned or has been rejected
+func CheckFileScanStatus(file *File) error {
+	if file == nil {
+		return nil
+	}
+
+	// Files uploaded before scanning has been enabled are queued by the worker
+	if file.ScanStatus == nil {
+		if scanner.Enabled() {
+			return ErrFileNotScanned
+		}
+		return nil
+	}
+
+	switch *file.ScanStatus {
+	case FileScanClean, FileScanExternal:
+		return nil
+	case FileScanInfected:
+		return ErrFileInfected
+	case FileScanVerifying:
+		return ErrFileNotVerified
+	default:
+		return ErrFileNotScanned
+	}
+}
+
+// isFileObjectPublic returns true if the object of the uploaded entity file can be publicly readable right away, objects of scanned files are private until they are clean
+func isFileObjectPublic(ctx context.Context, entityId uuid.UUID) (public bool, err error) {
+	if scanner.Enabled() {
+		return false, nil
+	}
+
+	return isEntityPublic(ctx, entityId)
+}
+
+// enqueueFileScan Queues the scan of the uploaded file, the job is processed by the worker after the tx has been committed, files are available right away if scanning is disabled
+func enqueueFileScan(ctx context.Context, tx pgx.Tx, fileId uuid.UUID) (err error) {
+	var url string
+
+	q := `SELECT f.url FROM files f WHERE f.id = $1`
+	if err = tx.QueryRow(ctx, q, fileId /*$1*/).Scan(&url); err != nil {
+		return err
+	}
+
+	// Reset the result of the replaced file
+	var status *string
+	if !s3.IsStorageUrl(url) {
+		s := FileScanExternal
+		status = &s
+	} else if scanner.Enabled() {
+		s := FileScanPending
+		status = &s
+	}
+
+	q = `UPDATE files SET scan_status = $2, scan_signature = null, scanned_at = null WHERE id = $1`
+	if _, err = tx.Exec(ctx, q, fileId /*$1*/, status /*$2*/); err != nil {
+		return err
+	}
+
+	if status == nil || *status != FileScanPending {
+		return nil
+	}
+
+	q = `INSERT INTO file_scan_jobs (file_id, status, created_at, scheduled_at) VALUES ($1, $2, now(), now())`
+	_, err = tx.Exec(ctx, q, fileId /*$1*/, FileScanJobPending /*$2*/)
+	return err
+}
+
+// enqueueUnscannedFiles Queues scans of files uploaded before scanning has been enabled, derivatives get the status of their source files
+func enqueueUnscannedFiles(ctx context.Context, limit int) (queued int, err error) {
+	db := database.DB
+
+	tx, err1 := db.Begin(ctx)
+	if err1 != nil {
+		return 0, fmt.Errorf("failed to begin tx: %v", err1)
+	}
+
+	var ids []uuid.UUID
+
+	q := `SELECT f.id FROM files f WHERE f.scan_status IS NULL AND f.derivative_of IS NULL ORDER BY f.created_at LIMIT $1 FOR UPDATE SKIP LOCKED`
+	rows, err1 := tx.Query(ctx, q, limit /*$1*/)
+	if err1 == nil {
+		for rows.Next() {
+			var id uuid.UUID
+			if err1 = rows.Scan(&id); err1 != nil {
+				break
+			}
+			ids = append(ids, id)
+		}
+		rows.Close()
+		if err1 == nil {
+			err1 = rows.Err()
+		}
+	}
+
+	for _, id := range ids {
+		if err1 != nil {
+			break
+		}
+		err1 = enqueueFileScan(ctx, tx, id)
+	}
+
+	if err1 == nil {
+		q = `UPDATE files d SET scan_status = f.scan_status FROM files f WHERE d.derivative_of = f.id AND d.scan_status IS NULL AND f.scan_status IS NOT NULL`
+		_, err1 = tx.Exec(ctx, q)
+	}
+
+	if err1 != nil {
+		if err2 := tx.Rollback(ctx); err2 != nil {
+			return 0, fmt.Errorf("failed to rollback failed tx: %v, %v", err1, err2)
+		}
+		return 0, err1
+	}
+
+	if err1 = tx.Commit(ctx); err1 != nil {
+		return 0, fmt.Errorf("failed to commit tx: %v", err1)
+	}
+
+	return len(ids), nil
+}
+
+// openFileContents returns a reader of the stored file object which stops once the context is done, files linked to external urls are never downloaded by the API
+func openFileContents(ctx context.Context, url string) (io.ReadCloser, error) {
+	if !s3.IsStorageUrl(url) {
+		return nil, errFileNotStored
+	}
+
+	return s3.OpenObjectContext(ctx, s3.GetS3KeyForEntityUrl(url))
+}
+
+// scanFile Scans the file contents and stores the result in a short tx after the scan, returns the detected signature
+func scanFile(ctx context.Context, jobId uuid.UUID, fileId uuid.UUID) (signature string, found bool, err error) {
+	db := database.DB
+
+	var (
+		url          string
+		fileType     string
+		mime         *string
+		originalPath string
+		hasMetadata  bool
+	)
+
+	q := `SELECT f.url, f.type, f.mime, coalesce(f.original_path, ''), f.metadata IS NOT NULL FROM files f WHERE f.id = $1`
+	err = db.QueryRow(ctx, q, fileId /*$1*/).Scan(&url, &fileType, &mime, &originalPath, &hasMetadata)
+	if err == pgx.ErrNoRows {
+		return "", false, nil // file has been deleted or replaced, replacements have their own jobs
+	} else if err != nil {
+		return "", false, err
+	}
+
+	// The file has been replaced with a link, replacements have their own status
+	if !s3.IsStorageUrl(url) {
+		return "", false, nil
+	}
+
+	// Objects of files pre-created for presigned uploads are uploaded by clients later
+	if !s3.ObjectExists(s3.GetS3KeyForEntityUrl(url)) {
+		return "", false, errFileObjectNotUploaded
+	}
+
+	// glTF assets uploaded using presigned urls are checked against the mesh budgets once their objects have been uploaded
+	var metadata *gltf.Metadata
+	if !hasMetadata {
+		if metadata, err = parseStoredFileMetadata(fileType, mime, originalPath, url); err != nil {
+			return "", false, err
+		}
+	}
+
+	body, err := openFileContents(ctx, url)
+	if err != nil {
+		return "", false, fmt.Errorf("failed to open file contents: %v", err)
+	}
+	defer body.Close()
+
+	// No tx or row lock is held while the object is streamed to the scanner
+	signature, err = scanner.Scan(ctx, body)
+	if err != nil {
+		return "", false, err
+	}
+
+	status := FileScanClean
+	if signature != "" {
+		status = FileScanInfected
+	}
+
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return "", false, fmt.Errorf("failed to begin tx: %v", err)
+	}
+
+	// Derivatives share the result of their source file, the result is dropped if the file has been replaced during the scan
+	q = `UPDATE files f
+SET scan_status    = $2,
+    scan_signature = nullif($3, ''),
+    scanned_at     = now()
+WHERE (f.id = $1 OR f.derivative_of = $1)
+  AND EXISTS (SELECT 1 FROM files s WHERE s.id = $1 AND s.url = $4)`
+	res, err1 := tx.Exec(ctx, q, fileId /*$1*/, status /*$2*/, signature /*$3*/, url /*$4*/)
+	if err1 == nil && metadata != nil {
+		q = `UPDATE files SET metadata = $2 WHERE id = $1 AND url = $3`
+		_, err1 = tx.Exec(ctx, q, fileId /*$1*/, metadata /*$2*/, url /*$3*/)
+	}
+	if err1 == nil {
+		q = `UPDATE file_scan_jobs SET status = $2, error = null, updated_at = now() WHERE id = $1`
+		_, err1 = tx.Exec(ctx, q, jobId /*$1*/, FileScanJobCompleted /*$2*/)
+	}
+
+	if err1 != nil {
+		if err2 := tx.Rollback(ctx); err2 != nil {
+			return "", false, fmt.Errorf("failed to rollback failed tx: %v, %v", err1, err2)
+		}
+		return "", false, err1
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return "", false, fmt.Errorf("failed to commit tx: %v", err)
+	}
+
+	return signature, res.RowsAffected() > 0, nil
+}
+
+// notifyFileScanRejected Sends an email to the uploader and owners of the entity about the rejected file
+func notifyFileScanRejected(ctx context.Context, fileId uuid.UUID, reason string) (err error) {
+	db := database.DB
+
+	var (
+		entityId uuid.UUID
+		fileType string
+		path     string
+	)
+
+	q := `SELECT f.entity_id, f.type, coalesce(f.original_path, '') FROM files f WHERE f.id = $1`
+	if err = db.QueryRow(ctx, q, fileId /*$1*/).Scan(&entityId, &fileType, &path); err != nil {
+		return fmt.Errorf("failed to get the file: %v", err)
+	}
+
+	if path == "" {
+		path = fileType
+	}
+
+	q = `SELECT DISTINCT u.email
+FROM users u
+WHERE u.allow_emails
+  AND u.email IS NOT NULL
+  AND u.email <> ''
+  AND (u.id = (SELECT f.uploaded_by FROM files f WHERE f.id = $1) OR
+       u.id IN (SELECT a.user_id FROM accessibles a WHERE a.entity_id = $2 AND a.is_owner))`
+	rows, err := db.Query(ctx, q, fileId /*$1*/, entityId /*$2*/)
+	if err != nil {
+		return fmt.Errorf("failed to get recipients: %v", err)
+	}
+
+	var emails []string
+	for rows.Next() {
+		var email string
+		if err = rows.Scan(&email); err != nil {
+			rows.Close()
+			return err
+		}
+		emails = append(emails, email)
+	}
+	rows.Close()
+
+	if len(emails) == 0 {
+		return nil
+	}
+
+	text := fmt.Sprintf("Your uploaded file %s (%s) of %s has been rejected: %s", path, fileId, entityId, reason)
+	htmlTemplate := fmt.Sprintf(`<!DOCTYPE HTML PUBLIC "-//W3C//DTD XHTML 1.0 Transitional //EN" "http://www.w3.org/TR/xhtml1/DTD/xhtml1-transitional.dtd">
+<html xmlns="http://www.w3.org/1999/xhtml" xmlns:v="urn:schemas-microsoft-com:vml" xmlns:o="urn:schemas-microsoft-com:office:office">
+<head></head><body>%s</body></html>`, text)
+	if err = ses.Send("VeVerse - File Rejected", text, htmlTemplate, emails, []string{}, []string{}, "no-reply@veverse.com"); err != nil {
+		return fmt.Errorf("failed to send file rejected email: %v", err)
+	}
+
+	return nil
+}
+
+// processFileScanJob Claims the next pending job and scans the file, returns false if there are no pending jobs
+func processFileScanJob(ctx context.Context) (processed bool, err error) {
+	db := database.DB
+
+	var (
+		jobId     uuid.UUID
+		fileId    uuid.UUID
+		createdAt time.Time
+		attempts  int
+	)
+
+	// The job is claimed by a short update so other API instances skip it, jobs of stopped instances are reclaimed after the timeout
+	q := `UPDATE file_scan_jobs j
+SET status     = $2,
+    attempts   = j.attempts + 1,
+    updated_at = now()
+WHERE j.id = (SELECT c.id
+              FROM file_scan_jobs c
+              WHERE (c.status = $1 AND c.scheduled_at <= now())
+                 OR (c.status = $2 AND c.updated_at < $3)
+              ORDER BY c.scheduled_at
+              LIMIT 1 FOR UPDATE SKIP LOCKED)
+RETURNING j.id, j.file_id, j.created_at, j.attempts`
+	err = db.QueryRow(ctx, q, FileScanJobPending /*$1*/, FileScanJobProcessing /*$2*/, time.Now().Add(-fileScanJobTimeout) /*$3*/).Scan(&jobId, &fileId, &createdAt, &attempts)
+	if err == pgx.ErrNoRows {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	var (
+		signature string
+		found     bool
+		err1      error
+	)
+	if attempts > fileScanMaxAttempts {
+		err1 = fmt.Errorf("timed out")
+	} else if signature, found, err1 = scanFile(ctx, jobId, fileId); err1 == nil {
+		if !found {
+			// The file has been deleted or replaced, the job is completed without the result
+			q = `UPDATE file_scan_jobs SET status = $2, error = null, updated_at = now() WHERE id = $1 AND status = $3`
+			if _, err = db.Exec(ctx, q, jobId /*$1*/, FileScanJobCompleted /*$2*/, FileScanJobProcessing /*$3*/); err != nil {
+				return true, fmt.Errorf("failed to update the job: %v", err)
+			}
+		} else if signature != "" {
+			logrus.Warnf("file %s is infected: %s", fileId, signature)
+			if err = notifyFileScanRejected(ctx, fileId, fmt.Sprintf("threat detected (%s)", signature)); err != nil {
+				logrus.Errorf("failed to notify about the infected file %s: %v", fileId, err)
+			}
+		} else {
+			// Objects of clean files of public entities become publicly readable
+			if err = updateFileObjectAcls(ctx, fileId); err != nil {
+				logrus.Errorf("failed to update acls of the file %s: %v", fileId, err)
+			}
+		}
+
+		return true, nil
+	}
+
+	// Wait for the presigned upload without counting the attempt
+	if err1 == errFileObjectNotUploaded && time.Since(createdAt) < fileScanUploadWindow {
+		q = `UPDATE file_scan_jobs SET status = $2, attempts = attempts - 1, scheduled_at = $3, updated_at = now() WHERE id = $1`
+		if _, err = db.Exec(ctx, q, jobId /*$1*/, FileScanJobPending /*$2*/, time.Now().Add(fileScanUploadRetry) /*$3*/); err != nil {
+			return true, fmt.Errorf("failed to postpone the job: %v", err)
+		}
+		return true, nil
+	}
+
+	logrus.Errorf("failed to scan file %s @ %s: %v", fileId, reflect.FunctionName(), err1)
+
+	// Assets exceeding the mesh budget are rejected without retrying
+	maxAttempts, reason := fileScanMaxAttempts, "the file could not be scanned"
+	if errors.Is(err1, ErrMeshBudgetExceeded) {
+		maxAttempts, reason = 0, err1.Error()
+	}
+
+	var status string
+	q = `UPDATE file_scan_jobs
+SET error      = $2,
+    status     = CASE WHEN attempts >= $3 THEN $4 ELSE $5 END,
+    updated_at = now()
+WHERE id = $1
+RETURNING status`
+	if err = db.QueryRow(ctx, q, jobId /*$1*/, err1.Error() /*$2*/, maxAttempts /*$3*/, FileScanJobFailed /*$4*/, FileScanJobPending /*$5*/).Scan(&status); err != nil {
+		return true, fmt.Errorf("failed to update the job: %v", err)
+	}
+
+	if status == FileScanJobFailed {
+		q = `UPDATE files SET scan_status = $2 WHERE (id = $1 OR derivative_of = $1) AND scan_status = $3`
+		if _, err = db.Exec(ctx, q, fileId /*$1*/, FileScanFailed /*$2*/, FileScanPending /*$3*/); err != nil {
+			return true, fmt.Errorf("failed to update the file: %v", err)
+		}
+
+		if err = notifyFileScanRejected(ctx, fileId, reason); err != nil {
+			logrus.Errorf("failed to notify about the unscanned file %s: %v", fileId, err)
+		}
+	}
+
+	return true, nil
+}
+
+// ProcessFileScanJobs Processes up to the limit of pending scan jobs
+func ProcessFileScanJobs(ctx context.Context, limit int) (processed int, err error) {
+	for processed < limit {
+		ok, err := processFileScanJob(ctx)
+		if err != nil {
+			return processed, err
+		}
+		if !ok {
+			break
+		}
+		processed++
+	}
+
+	return processed, nil
+}
+
+// DeleteFinishedFileScanJobs Deletes old completed and failed scan jobs
+func DeleteFinishedFileScanJobs(ctx context.Context) (deleted int64, err error) {
+	db := database.DB
+
+	q := `DELETE FROM file_scan_jobs j WHERE j.status = ANY ($1::text[]) AND j.updated_at < $2`
+	res, err := db.Exec(ctx, q, []string{FileScanJobCompleted, FileScanJobFailed} /*$1*/, time.Now().Add(-fileScanJobRetention) /*$2*/)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected(), nil
+}
+
+// StartFileScanWorker periodically scans queued files until the context is cancelled
+func StartFileScanWorker(ctx context.Context) {
+	interval, err := time.ParseDuration(fileScanWorkerInterval)
+	if err != nil || interval <= 0 {
+		interval = 10 * time.Second
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			if scanner.Enabled() {
+				if _, err := enqueueUnscannedFiles(ctx, fileScanBatchSize); err != nil {
+					logrus.Errorf("failed to queue unscanned files: %v", err)
+				}
+			}
+
+			if processed, err := ProcessFileScanJobs(ctx, fileScanBatchSize); err != nil {
+				logrus.Errorf("failed to process %s: %v", fileScanPlural, err)
+			} else if processed > 0 {
+				logrus.Infof("processed %d %s", processed, fileScanPlural)
+			}
+
+			if _, err := DeleteFinishedFileScanJobs(ctx); err != nil {
+				logrus.Errorf("failed to delete finished %s jobs: %v", fileScanSingular, err)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
@@ -0,0 +1,204 @@
+package model
+
+import (
+	"context"
+	sm "dev.hackerman.me/artheon/veverse-shared/model"
+	"fmt"
+	"github.com/gofrs/uuid"
+	"html"
+	"strings"
+	"veverse-api/database"
+)
+
+// Search result types
+const (
+	SearchTypeWorld   = "world"
+	SearchTypePackage = "package"
+	SearchTypePortal  = "portal"
+	SearchTypeClass   = "class"
+	SearchTypeObject  = "object"
+)
+
+// SearchTypes are the searchable content types
+var SearchTypes = map[string]bool{
+	SearchTypeWorld:   true,
+	SearchTypePackage: true,
+	SearchTypePortal:  true,
+	SearchTypeClass:   true,
+	SearchTypeObject:  true,
+}
+
+// Snippet highlight markers, private use characters are removed from the text so the escaped snippet only gets tags of matched words
+const (
+	searchHighlightStart = "\uE000"
+	searchHighlightStop  = "\uE001"
+)
+
+// searchHeadlineOptions Snippet options, matched words are wrapped in the highlight markers
+const searchHeadlineOptions = `StartSel="` + searchHighlightStart + `", StopSel="` + searchHighlightStop + `", MaxWords=30, MinWords=10, MaxFragments=2`
+
+var searchHighlightReplacer = strings.NewReplacer(searchHighlightStart, "<b>", searchHighlightStop, "</b>")
+
+// searchSources Searched tables with the name, the snippet text and the entity visibility, %[1]s is the query placeholder, %[2]s is the visibility of the portal world
+var searchSources = []string{
+	`SELECT 'world' AS type, x.id, coalesce(x.name, '') AS name,
+       concat_ws(' ', x.name, x.description) AS text,
+       ts_rank_cd(x.search_vector, websearch_to_tsquery('english', %[1]s)) + word_similarity(%[1]s, coalesce(x.name, '')) AS rank
+FROM spaces x
+    JOIN entities e ON e.id = x.id
+WHERE (x.search_vector @@ websearch_to_tsquery('english', %[1]s) OR %[1]s <%% x.name)`,
+	`SELECT 'package' AS type, x.id, coalesce(x.title, x.name, '') AS name,
+       concat_ws(' ', x.name, x.title, x.description) AS text,
+       ts_rank_cd(x.search_vector, websearch_to_tsquery('english', %[1]s)) + greatest(word_similarity(%[1]s, coalesce(x.name, '')), word_similarity(%[1]s, coalesce(x.title, ''))) AS rank
+FROM mods x
+    JOIN entities e ON e.id = x.id
+WHERE (x.search_vector @@ websearch_to_tsquery('english', %[1]s) OR %[1]s <%% x.name OR %[1]s <%% x.title)`,
+	`SELECT 'portal' AS type, x.id, coalesce(x.name, '') AS name,
+       coalesce(x.name, '') AS text,
+       ts_rank_cd(x.search_vector, websearch_to_tsquery('english', %[1]s)) + word_similarity(%[1]s, coalesce(x.name, '')) AS rank
+FROM portals x
+    JOIN entities e ON e.id = x.id
+WHERE (x.search_vector @@ websearch_to_tsquery('english', %[1]s) OR %[1]s <%% x.name)%[2]s`,
+	`SELECT 'class' AS type, x.id, coalesce(x.name, '') AS name,
+       concat_ws(' ', x.name, x.category, x.description) AS text,
+       ts_rank_cd(x.search_vector, websearch_to_tsquery('english', %[1]s)) + word_similarity(%[1]s, coalesce(x.name, '')) AS rank
+FROM placeable_classes x
+    JOIN entities e ON e.id = x.id
+WHERE (x.search_vector @@ websearch_to_tsquery('english', %[1]s) OR %[1]s <%% x.name)`,
+	`SELECT 'object' AS type, x.id, coalesce(x.name, '') AS name,
+       concat_ws(' ', x.name, x.artist, x.description) AS text,
+       ts_rank_cd(x.search_vector, websearch_to_tsquery('english', %[1]s)) + word_similarity(%[1]s, coalesce(x.name, '')) AS rank
+FROM objects x
+    JOIN entities e ON e.id = x.id
+WHERE x.type <> 'NFT' AND (x.search_vector @@ websearch_to_tsquery('english', %[1]s) OR %[1]s <%% x.name)`,
+}
+
+// SearchResult is the matched entity ranked by the text relevance and the name similarity
+type SearchResult struct {
+	Type    string    `json:"type"`
+	Id      uuid.UUID `json:"id"`
+	Name    string    `json:"name"`
+	Snippet string    `json:"snippet,omitempty"` // HTML escaped matched text with words highlighted by <b> tags
+	Rank    float64   `json:"rank"`
+}
+
+// SearchRequestMetadata Search request metadata
+type SearchRequestMetadata struct {
+	BatchRequestMetadata
+	Types string `json:"types,omitempty"` // Comma separated result types to return, all types by default
+}
+
+// highlightSnippet Escapes the headline text and replaces the highlight markers with <b> tags
+func highlightSnippet(headline string) string {
+	return searchHighlightReplacer.Replace(html.EscapeString(headline))
+}
+
+// searchMatches Composes the union of matches of all types, requester matches are limited to entities the requester can view and portals of worlds the requester can view
+func searchMatches(requester *sm.User, args *[]interface{}, query string) string {
+	*args = append(*args, query)
+	q := fmt.Sprintf("$%d", len(*args))
+
+	var visibility, spaceVisibility string
+	if requester != nil {
+		*args = append(*args, requester.Id)
+		visibility = fmt.Sprintf("\n  AND (e.public OR EXISTS(SELECT 1 FROM accessibles a WHERE a.entity_id = e.id AND a.user_id = $%d AND (a.can_view OR a.is_owner)))", len(*args))
+		spaceVisibility = fmt.Sprintf("\n  AND EXISTS(SELECT 1 FROM entities w WHERE w.id = x.space_id AND (w.public OR EXISTS(SELECT 1 FROM accessibles wa WHERE wa.entity_id = w.id AND wa.user_id = $%d AND (wa.can_view OR wa.is_owner))))", len(*args))
+	}
+
+	var sources []string
+	for _, s := range searchSources {
+		// Sources use indexed verbs so the world visibility is only placed where it is referenced
+		sources = append(sources, fmt.Sprintf(s, q, spaceVisibility)+visibility)
+	}
+
+	return "WITH matches AS (\n" + strings.Join(sources, "\nUNION ALL\n") + "\n)"
+}
+
+// search Ranks entities of requested types matching the query, facets count matches of every type regardless of the requested types
+func search(ctx context.Context, requester *sm.User, query string, types []string, offset int64, limit int64) (entities []SearchResult, facets map[string]int64, total int64, err error) {
+	db := database.DB
+
+	if len(types) == 0 {
+		for t := range SearchTypes {
+			types = append(types, t)
+		}
+	}
+
+	var args []interface{}
+	matches := searchMatches(requester, &args, query)
+
+	//region Facets
+	facets = map[string]int64{}
+	for t := range SearchTypes {
+		facets[t] = 0
+	}
+
+	rows, err := db.Query(ctx, matches+"\nSELECT m.type, COUNT(*) FROM matches m GROUP BY m.type", args...)
+	if err != nil {
+		return nil, nil, -1, fmt.Errorf("failed to query search facets: %v", err)
+	}
+
+	for rows.Next() {
+		var (
+			t     string
+			count int64
+		)
+		if err = rows.Scan(&t, &count); err != nil {
+			rows.Close()
+			return nil, nil, -1, err
+		}
+		facets[t] = count
+	}
+	rows.Close()
+
+	if err = rows.Err(); err != nil {
+		return nil, nil, -1, err
+	}
+
+	for _, t := range types {
+		total += facets[t]
+	}
+	//endregion
+
+	entities = []SearchResult{}
+	if total == 0 {
+		return entities, facets, 0, nil
+	}
+
+	// Snippets are only generated for the page
+	n := len(args)
+	q := fmt.Sprintf(`%s
+SELECT p.type, p.id, p.name, ts_headline('english', translate(p.text, $%d, ''), websearch_to_tsquery('english', $1), $%d), p.rank
+FROM (SELECT m.* FROM matches m WHERE m.type = ANY($%d) ORDER BY m.rank DESC, m.id OFFSET $%d LIMIT $%d) p
+ORDER BY p.rank DESC, p.id`, matches, n+1, n+2, n+3, n+4, n+5)
+	rows, err = db.Query(ctx, q, append(args, searchHighlightStart+searchHighlightStop, searchHeadlineOptions, types, offset, limit)...)
+	if err != nil {
+		return nil, nil, -1, fmt.Errorf("failed to search: %v", err)
+	}
+
+	defer func() {
+		rows.Close()
+		database.LogPgxStat("search")
+	}()
+
+	for rows.Next() {
+		var e SearchResult
+		if err = rows.Scan(&e.Type, &e.Id, &e.Name, &e.Snippet, &e.Rank); err != nil {
+			return nil, nil, -1, err
+		}
+		e.Snippet = highlightSnippet(e.Snippet)
+		entities = append(entities, e)
+	}
+
+	return entities, facets, total, rows.Err()
+}
+
+// SearchForAdmin Searches all entities
+func SearchForAdmin(ctx context.Context, query string, types []string, offset int64, limit int64) (entities []SearchResult, facets map[string]int64, total int64, err error) {
+	return search(ctx, nil, query, types, offset, limit)
+}
+
+// SearchForRequester Searches entities the requester can view
+func SearchForRequester(ctx context.Context, requester *sm.User, query string, types []string, offset int64, limit int64) (entities []SearchResult, facets map[string]int64, total int64, err error) {
+	return search(ctx, requester, query, types, offset, limit)
+}
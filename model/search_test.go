@@ -0,0 +1,45 @@
+package model
+
+import (
+	sm "dev.hackerman.me/artheon/veverse-shared/model"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestHighlightSnippet(t *testing.T) {
+	tests := []struct {
+		name     string
+		headline string
+		expected string
+	}{
+		{"highlighted words", "the gallery of modern art", "the <b>gallery</b> of modern art"},
+		{"markup of the text", "gallery <script>alert(1)</script>", "<b>gallery</b> &lt;script&gt;alert(1)&lt;/script&gt;"},
+		{"tags of the text", "<b onmouseover=\"alert(1)\">gallery</b>", "&lt;b onmouseover=&#34;alert(1)&#34;&gt;gallery&lt;/b&gt;"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, highlightSnippet(tt.headline))
+		})
+	}
+}
+
+func TestSearchMatchesVisibility(t *testing.T) {
+	var args []interface{}
+	matches := searchMatches(&sm.User{}, &args, "gallery")
+
+	assert.Len(t, args, 2)
+	assert.NotContains(t, matches, "%!")
+	assert.Equal(t, len(searchSources), strings.Count(matches, "(e.public OR EXISTS"))
+	// Only portals are limited to the worlds the requester can view
+	assert.Equal(t, 1, strings.Count(matches, "(w.public OR EXISTS"))
+	assert.Equal(t, 1, strings.Count(matches, "w.id = x.space_id"))
+
+	args = nil
+	matches = searchMatches(nil, &args, "gallery")
+
+	assert.Len(t, args, 1)
+	assert.NotContains(t, matches, "%!")
+	assert.NotContains(t, matches, "accessibles")
+}
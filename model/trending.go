@@ -0,0 +1,124 @@
+package model
+
+import (
+	"context"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"strconv"
+	"time"
+	"veverse-api/database"
+	"veverse-api/reflect"
+)
+
+// SortTrending is the sort value used by the index endpoints to order entities by the trending score
+const SortTrending = "trending"
+
+const (
+	// trendingVisibilityForAdmin lets admins see every entity, the requester ($1) is referenced only to keep the query arguments the same
+	trendingVisibilityForAdmin = `$1::uuid IS NOT NULL`
+	// trendingVisibilityForRequester filters entities (e) visible to the requester ($1)
+	trendingVisibilityForRequester = `(e.public OR EXISTS (SELECT 1 FROM accessibles a WHERE a.entity_id = e.id AND a.user_id = $1 AND (a.can_view OR a.is_owner)))`
+)
+
+const (
+	defaultTrendingHalfLifeHours   = 72.0
+	defaultTrendingRefreshInterval = 15 * time.Minute
+	// trendingRefreshLockKey is the advisory lock key held while the trending scores are refreshed, so only one replica refreshes them at a time
+	trendingRefreshLockKey int64 = 0x7472656e64696e67
+)
+
+// TrendingHalfLifeHours returns the number of hours after which the trending score of an inactive entity is halved
+func TrendingHalfLifeHours() float64 {
+	if v, err := strconv.ParseFloat(TRENDING_HALF_LIFE_HOURS, 64); err == nil && v > 0 {
+		return v
+	}
+	return defaultTrendingHalfLifeHours
+}
+
+// TrendingRefreshInterval returns the interval between the trending score recalculations
+func TrendingRefreshInterval() time.Duration {
+	if v, err := time.ParseDuration(TRENDING_REFRESH_INTERVAL); err == nil && v > 0 {
+		return v
+	}
+	return defaultTrendingRefreshInterval
+}
+
+// RefreshTrendingScores recalculates the trending score of every world, package and art object, as views and plays are not tracked transactionally and the score decays over time.
+// Replicas that fail to take the advisory lock skip the refresh as another replica is already refreshing the scores.
+func RefreshTrendingScores(ctx context.Context) (err error) {
+	db := database.DB
+
+	tx, err1 := db.Begin(ctx)
+	if err1 != nil {
+		logrus.Errorf("failed to begin tx %s @ %s: %v", RatingPlural, reflect.FunctionName(), err1)
+		return fmt.Errorf("failed to refresh trending scores")
+	}
+
+	var locked bool
+	q := `SELECT pg_try_advisory_xact_lock($1)`
+	if err1 = tx.QueryRow(ctx, q, trendingRefreshLockKey /*$1*/).Scan(&locked); err1 != nil {
+		if err2 := tx.Rollback(ctx); err2 != nil {
+			return fmt.Errorf("failed to rollback failed tx: %v, %v", err1, err2)
+		}
+		logrus.Errorf("failed to lock %s @ %s: %v", RatingPlural, reflect.FunctionName(), err1)
+		return fmt.Errorf("failed to refresh trending scores")
+	}
+
+	if !locked {
+		// Another replica is refreshing the scores
+		return tx.Rollback(ctx)
+	}
+
+	q = `INSERT INTO entity_ratings (entity_id)
+SELECT id FROM spaces
+UNION SELECT id FROM mods
+UNION SELECT id FROM objects
+ON CONFLICT (entity_id) DO NOTHING`
+
+	if _, err1 = tx.Exec(ctx, q); err1 != nil {
+		if err2 := tx.Rollback(ctx); err2 != nil {
+			return fmt.Errorf("failed to rollback failed tx: %v, %v", err1, err2)
+		}
+		logrus.Errorf("failed to insert %s @ %s: %v", RatingPlural, reflect.FunctionName(), err1)
+		return fmt.Errorf("failed to refresh trending scores")
+	}
+
+	q = `UPDATE entity_ratings SET trending_score = coalesce(entity_trending_score(entity_id, $1), 0), trending_updated_at = now()`
+
+	if _, err1 = tx.Exec(ctx, q, TrendingHalfLifeHours() /*$1*/); err1 != nil {
+		if err2 := tx.Rollback(ctx); err2 != nil {
+			return fmt.Errorf("failed to rollback failed tx: %v, %v", err1, err2)
+		}
+		logrus.Errorf("failed to update %s @ %s: %v", RatingPlural, reflect.FunctionName(), err1)
+		return fmt.Errorf("failed to refresh trending scores")
+	}
+
+	if err1 = tx.Commit(ctx); err1 != nil {
+		logrus.Errorf("failed to commit tx %s @ %s: %v", RatingPlural, reflect.FunctionName(), err1)
+		return fmt.Errorf("failed to refresh trending scores")
+	}
+
+	return nil
+}
+
+// StartTrendingRefresher periodically refreshes the trending scores until the context is cancelled, it is started by every replica and guarded by the advisory lock in RefreshTrendingScores
+func StartTrendingRefresher(ctx context.Context) {
+	interval := TrendingRefreshInterval()
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			if err := RefreshTrendingScores(ctx); err != nil {
+				logrus.Errorf("failed to refresh trending scores: %v", err)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
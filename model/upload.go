@@ -0,0 +1,1009 @@
+package model
+
+import (
+	"context"
+	"crypto/sha256"
+	sm "dev.hackerman.me/artheon/veverse-shared/model"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/gabriel-vasile/mimetype"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofrs/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/sirupsen/logrus"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+	"veverse-api/aws/s3"
+	"veverse-api/database"
+	"veverse-api/reflect"
+)
+
+var (
+	fileUploadSingular = "file upload"
+	fileUploadPlural   = "file uploads"
+)
+
+const (
+	FileUploadPending    = "pending"
+	FileUploadCompleting = "completing"
+	FileUploadVerifying  = "verifying" // Parts have been assembled and the file record created, the contents are verified by the background worker
+	FileUploadCompleted  = "completed"
+	FileUploadAborted    = "aborted"
+)
+
+const (
+	fileUploadMinPartSize     int64 = 5 * 1024 * 1024               // S3 minimum part size (except the last part)
+	fileUploadMaxPartSize     int64 = 5 * 1024 * 1024 * 1024        // S3 maximum part size
+	fileUploadDefaultPartSize int64 = 64 * 1024 * 1024              // Default part size
+	fileUploadMaxParts        int64 = 10000                         // S3 maximum number of parts
+	fileUploadMaxSize         int64 = 5 * 1024 * 1024 * 1024 * 1024 // S3 maximum object size
+	fileUploadPartLinkTTL           = 60 * time.Minute              // Presigned part upload link expiration
+)
+
+const (
+	fileUploadVerifyMaxAttempts = 3                // Uploads are rejected after this number of failed verification attempts
+	fileUploadVerifyBatchSize   = 10               // Number of uploads verified per worker run
+	fileUploadVerifyTimeout     = 30 * time.Minute // Verifications are reclaimed after this time (e.g. if the API instance has been stopped)
+)
+
+var (
+	fileUploadAbandonAfter    = os.Getenv("FILE_UPLOAD_ABANDON_AFTER")    // Duration after which pending uploads are aborted by the janitor (default 24h)
+	fileUploadJanitorInterval = os.Getenv("FILE_UPLOAD_JANITOR_INTERVAL") // Interval between janitor runs (default 1h)
+	fileUploadVerifyInterval  = os.Getenv("FILE_UPLOAD_VERIFY_INTERVAL")  // Interval between verification worker runs (default 10s)
+)
+
+// FileUpload is a resumable multipart upload of a large file
+type FileUpload struct {
+	Identifier
+
+	EntityId     *uuid.UUID `json:"entityId,omitempty"`
+	FileId       *uuid.UUID `json:"fileId,omitempty"`
+	Type         string     `json:"type"`
+	Mime         *string    `json:"mime,omitempty"`
+	Size         int64      `json:"size"`
+	PartSize     int64      `json:"partSize"`
+	PartCount    int64      `json:"partCount"`
+	Deployment   string     `json:"deploymentType,omitempty"`
+	Platform     string     `json:"platform,omitempty"`
+	Index        int64      `json:"variation,omitempty"`
+	OriginalPath string     `json:"originalPath,omitempty"`
+	Hash         *string    `json:"hash,omitempty"`
+	Width        *int       `json:"width,omitempty"`
+	Height       *int       `json:"height,omitempty"`
+	Status       string     `json:"status"`
+	CreatedBy    *uuid.UUID `json:"createdBy,omitempty"`
+
+	Key      string `json:"-"` // S3 object key
+	UploadId string `json:"-"` // S3 multipart upload id
+
+	Timestamps
+}
+
+type FileUploadInitiateMetadata struct {
+	EntityId     uuid.UUID `json:"entityId"`               // Entity to upload the file for
+	Type         string    `json:"type"`                   // Type of the file
+	Mime         *string   `json:"mime,omitempty"`         // Mime type (optional), detected on completion if not set
+	Size         int64     `json:"size"`                   // Total size of the file in bytes
+	PartSize     int64     `json:"partSize,omitempty"`     // Preferred part size (optional), adjusted to S3 limits
+	Deployment   string    `json:"deployment,omitempty"`   // Deployment for the destination pak file (Server or Client)
+	Platform     string    `json:"platform,omitempty"`     // Platform (OS) of the destination pak file (Win64, Mac, Linux, IOS, Android)
+	Width        *int      `json:"width,omitempty"`        // Width of the media surface (optional)
+	Height       *int      `json:"height,omitempty"`       // Height of the media surface (optional)
+	Index        int64     `json:"index,omitempty"`        // Index of the file (for file arrays such as PDF pages rendered to images)
+	OriginalPath string    `json:"originalPath,omitempty"` // Original path of the file (used by app release files)
+	Hash         *string   `json:"hash,omitempty"`         // SHA-256 of the file contents (optional, hex), verified after the completion
+}
+
+type FileUploadCompleteMetadata struct {
+	Parts []s3.UploadedPart `json:"parts,omitempty"` // Uploaded parts (optional), listed from S3 if not set
+	Hash  *string           `json:"hash,omitempty"`  // SHA-256 of the file contents (optional, hex), overrides the hash provided on initiation, verified against the uploaded contents
+}
+
+func fileUploadPartSize(size int64, preferred int64) int64 {
+	partSize := preferred
+	if partSize <= 0 {
+		partSize = fileUploadDefaultPartSize
+	}
+
+	if partSize < fileUploadMinPartSize {
+		partSize = fileUploadMinPartSize
+	}
+
+	// Grow the part size to fit into the maximum number of parts, rounded up to MiB
+	if min := (size + fileUploadMaxParts - 1) / fileUploadMaxParts; partSize < min {
+		partSize = (min + 1024*1024 - 1) / (1024 * 1024) * (1024 * 1024)
+	}
+
+	if partSize > fileUploadMaxPartSize {
+		partSize = fileUploadMaxPartSize
+	}
+
+	return partSize
+}
+
+func (u *FileUpload) setPartCount() {
+	if u.PartSize > 0 {
+		u.PartCount = (u.Size + u.PartSize - 1) / u.PartSize
+	}
+}
+
+// GetFileUpload Get the file upload by id
+func GetFileUpload(ctx context.Context, id uuid.UUID) (upload *FileUpload, err error) {
+	db := database.DB
+
+	q := `SELECT id, upload_id, key, entity_id, file_id, type, mime, size, part_size, deployment_type, platform, variation, original_path, hash, width, height, status, created_by, created_at, updated_at
+FROM file_uploads
+WHERE id = $1`
+
+	var u FileUpload
+	err = db.QueryRow(ctx, q, id).Scan(&u.Id, &u.UploadId, &u.Key, &u.EntityId, &u.FileId, &u.Type, &u.Mime, &u.Size, &u.PartSize, &u.Deployment, &u.Platform, &u.Index, &u.OriginalPath, &u.Hash, &u.Width, &u.Height, &u.Status, &u.CreatedBy, &u.CreatedAt, &u.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	u.setPartCount()
+
+	return &u, nil
+}
+
+// getFileUploadForRequester Get the pending file upload if the requester has initiated it or can edit its entity
+func getFileUploadForRequester(ctx context.Context, requester *sm.User, id uuid.UUID) (upload *FileUpload, err error) {
+	upload, err = GetFileUpload(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if upload.CreatedBy == nil || *upload.CreatedBy != requester.Id {
+		canEdit, err := EntityEditable(ctx, requester.Id, *upload.EntityId)
+		if err != nil {
+			return nil, err
+		}
+
+		if !canEdit {
+			return nil, errors.New("no access")
+		}
+	}
+
+	return upload, nil
+}
+
+// InitiateFileUploadForAdmin Initiates a multipart upload of the entity file
+func InitiateFileUploadForAdmin(ctx context.Context, requester *sm.User, m FileUploadInitiateMetadata) (upload *FileUpload, err error) {
+	if m.Type == "" {
+		return nil, fmt.Errorf("no file type")
+	}
+
+	if m.Size <= 0 || m.Size > fileUploadMaxSize {
+		return nil, fmt.Errorf("invalid file size")
+	}
+
+	if m.Hash != nil && *m.Hash != "" {
+		hash, ok := NormalizeFileBlobHash(*m.Hash)
+		if !ok {
+			return nil, fmt.Errorf("invalid hash")
+		}
+		m.Hash = &hash
+	}
+
+	if PlatformDependentFileTypes[m.Type] {
+		if m.Deployment == "" {
+			return nil, fmt.Errorf("file requires a deployment configuration")
+		}
+
+		if m.Platform == "" {
+			return nil, fmt.Errorf("file requires a platform")
+		}
+	}
+
+	fileId, err := uuid.NewV4()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate uuid: %v", err)
+	}
+
+	key := s3.GetS3KeyForEntityFile(m.EntityId, fileId)
+
+	metadata := map[string]string{
+		"version": "0",
+		"index":   strconv.FormatInt(m.Index, 10),
+		"type":    m.Type,
+	}
+
+	if m.Deployment != "" {
+		metadata["deployment"] = m.Deployment
+	}
+
+	if m.Platform != "" {
+		metadata["platform"] = m.Platform
+	}
+
+	if m.OriginalPath != "" {
+		metadata["originalPath"] = m.OriginalPath
+	}
+
+	var mime string
+	if m.Mime != nil {
+		mime = *m.Mime
+	}
+
+	// Objects stay private until the uploaded contents have been verified, acls are updated by the verification worker
+	uploadId, err := s3.CreateMultipartUpload(key, mime, false, &metadata)
+	if err != nil {
+		logrus.Errorf("failed to create multipart upload %s @ %s: %v", key, reflect.FunctionName(), err)
+		return nil, fmt.Errorf("failed to initiate %s", fileUploadSingular)
+	}
+
+	partSize := fileUploadPartSize(m.Size, m.PartSize)
+
+	db := database.DB
+
+	q := `INSERT INTO file_uploads (upload_id, key, entity_id, file_id, type, mime, size, part_size, deployment_type, platform, variation, original_path, hash, width, height, status, created_by)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17)
+RETURNING id`
+
+	var id uuid.UUID
+	err = db.QueryRow(ctx, q, uploadId /*$1*/, key /*$2*/, m.EntityId /*$3*/, fileId /*$4*/, m.Type /*$5*/, m.Mime /*$6*/, m.Size /*$7*/, partSize /*$8*/, m.Deployment /*$9*/, m.Platform /*$10*/, m.Index /*$11*/, m.OriginalPath /*$12*/, m.Hash /*$13*/, m.Width /*$14*/, m.Height /*$15*/, FileUploadPending /*$16*/, requester.Id /*$17*/).Scan(&id)
+	if err != nil {
+		logrus.Errorf("failed to insert %s @ %s: %v", fileUploadSingular, reflect.FunctionName(), err)
+		if err1 := s3.AbortMultipartUpload(key, uploadId); err1 != nil {
+			logrus.Errorf("failed to abort multipart upload %s @ %s: %v", key, reflect.FunctionName(), err1)
+		}
+		return nil, fmt.Errorf("failed to initiate %s", fileUploadSingular)
+	}
+
+	return GetFileUpload(ctx, id)
+}
+
+// InitiateFileUploadForRequester Initiates a multipart upload of the entity file if the requester can edit the entity
+func InitiateFileUploadForRequester(ctx context.Context, requester *sm.User, m FileUploadInitiateMetadata) (upload *FileUpload, err error) {
+	canEdit, err := EntityEditable(ctx, requester.Id, m.EntityId)
+	if err != nil {
+		return nil, err
+	}
+
+	if !canEdit {
+		return nil, errors.New("no access")
+	}
+
+	// The file being replaced is released on completion, so it is not excluded here
+	if err = checkStorageQuota(ctx, requester.Id, m.EntityId, m.Size, uuid.Nil); err != nil {
+		return nil, err
+	}
+
+	return InitiateFileUploadForAdmin(ctx, requester, m)
+}
+
+func getFileUploadPartLink(upload *FileUpload, partNumber int64) (url string, err error) {
+	if upload.Status != FileUploadPending {
+		return "", fmt.Errorf("%s is %s", fileUploadSingular, upload.Status)
+	}
+
+	if partNumber < 1 || partNumber > upload.PartCount {
+		return "", fmt.Errorf("invalid part number")
+	}
+
+	url, err = s3.GetS3PresignedUploadPartUrl(upload.Key, upload.UploadId, partNumber, fileUploadPartLinkTTL)
+	if err != nil {
+		logrus.Errorf("failed to presign part %d of %s @ %s: %v", partNumber, upload.Key, reflect.FunctionName(), err)
+		return "", fmt.Errorf("failed to get part upload link")
+	}
+
+	return url, nil
+}
+
+// GetFileUploadPartLinkForAdmin Get a presigned link to upload the part of the file
+func GetFileUploadPartLinkForAdmin(ctx context.Context, id uuid.UUID, partNumber int64) (url string, err error) {
+	upload, err := GetFileUpload(ctx, id)
+	if err != nil {
+		return "", err
+	}
+
+	return getFileUploadPartLink(upload, partNumber)
+}
+
+// GetFileUploadPartLinkForRequester Get a presigned link to upload the part of the file if the requester has access to the upload
+func GetFileUploadPartLinkForRequester(ctx context.Context, requester *sm.User, id uuid.UUID, partNumber int64) (url string, err error) {
+	upload, err := getFileUploadForRequester(ctx, requester, id)
+	if err != nil {
+		return "", err
+	}
+
+	return getFileUploadPartLink(upload, partNumber)
+}
+
+func listFileUploadParts(upload *FileUpload) (parts []s3.UploadedPart, err error) {
+	if upload.Status != FileUploadPending {
+		return nil, fmt.Errorf("%s is %s", fileUploadSingular, upload.Status)
+	}
+
+	parts, err = s3.ListUploadedParts(upload.Key, upload.UploadId)
+	if err != nil {
+		logrus.Errorf("failed to list parts of %s @ %s: %v", upload.Key, reflect.FunctionName(), err)
+		return nil, fmt.Errorf("failed to list uploaded parts")
+	}
+
+	return parts, nil
+}
+
+// ListFileUploadPartsForAdmin List the parts uploaded so far to resume the upload
+func ListFileUploadPartsForAdmin(ctx context.Context, id uuid.UUID) (upload *FileUpload, parts []s3.UploadedPart, err error) {
+	upload, err = GetFileUpload(ctx, id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	parts, err = listFileUploadParts(upload)
+	return upload, parts, err
+}
+
+// ListFileUploadPartsForRequester List the parts uploaded so far to resume the upload if the requester has access to the upload
+func ListFileUploadPartsForRequester(ctx context.Context, requester *sm.User, id uuid.UUID) (upload *FileUpload, parts []s3.UploadedPart, err error) {
+	upload, err = getFileUploadForRequester(ctx, requester, id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	parts, err = listFileUploadParts(upload)
+	return upload, parts, err
+}
+
+// claimFileUpload Locks the pending upload and marks it as completing, so concurrent completions and aborts of the same upload fail instead of racing
+func claimFileUpload(ctx context.Context, id uuid.UUID) (err error) {
+	db := database.DB
+
+	tx, err1 := db.Begin(ctx)
+	if err1 != nil {
+		return fmt.Errorf("failed to begin tx: %v", err1)
+	}
+
+	var status string
+	q := `SELECT status FROM file_uploads WHERE id = $1 FOR UPDATE`
+	if err1 = tx.QueryRow(ctx, q, id /*$1*/).Scan(&status); err1 != nil {
+		if err2 := tx.Rollback(ctx); err2 != nil {
+			return fmt.Errorf("failed to rollback failed tx: %v, %v", err1, err2)
+		}
+		return err1
+	}
+
+	if status != FileUploadPending {
+		if err2 := tx.Rollback(ctx); err2 != nil {
+			return fmt.Errorf("failed to rollback failed tx: %v", err2)
+		}
+		return fmt.Errorf("%s is %s", fileUploadSingular, status)
+	}
+
+	q = `UPDATE file_uploads SET status = $2, updated_at = now() WHERE id = $1`
+	if _, err1 = tx.Exec(ctx, q, id /*$1*/, FileUploadCompleting /*$2*/); err1 != nil {
+		if err2 := tx.Rollback(ctx); err2 != nil {
+			return fmt.Errorf("failed to rollback failed tx: %v, %v", err1, err2)
+		}
+		return fmt.Errorf("failed to update the %s: %v", fileUploadSingular, err1)
+	}
+
+	if err1 = tx.Commit(ctx); err1 != nil {
+		return fmt.Errorf("failed to commit tx: %v", err1)
+	}
+
+	return nil
+}
+
+// releaseFileUpload Returns the claimed upload to the pending state so the client can retry the completion
+func releaseFileUpload(ctx context.Context, id uuid.UUID) {
+	db := database.DB
+
+	q := `UPDATE file_uploads SET status = $3, updated_at = now() WHERE id = $1 AND status = $2`
+	if _, err := db.Exec(ctx, q, id /*$1*/, FileUploadCompleting /*$2*/, FileUploadPending /*$3*/); err != nil {
+		logrus.Errorf("failed to release %s @ %s: %v", fileUploadSingular, reflect.FunctionName(), err)
+	}
+}
+
+// rejectFileUpload Removes the object assembled from the claimed upload and marks the upload aborted, the completed multipart upload can not be resumed
+func rejectFileUpload(ctx context.Context, upload *FileUpload) {
+	if err := s3.DeleteObject(upload.Key); err != nil {
+		logrus.Errorf("failed to delete the rejected object %s @ %s: %v", upload.Key, reflect.FunctionName(), err)
+	}
+
+	db := database.DB
+
+	q := `UPDATE file_uploads SET status = $3, updated_at = now() WHERE id = $1 AND status = $2`
+	if _, err := db.Exec(ctx, q, upload.Id /*$1*/, FileUploadCompleting /*$2*/, FileUploadAborted /*$3*/); err != nil {
+		logrus.Errorf("failed to update %s @ %s: %v", fileUploadSingular, reflect.FunctionName(), err)
+	}
+}
+
+// hashFileObject calculates SHA-256 and the size of the stored object contents
+func hashFileObject(key string) (hash string, size int64, err error) {
+	r, err := s3.OpenObject(key)
+	if err != nil {
+		return "", 0, err
+	}
+	defer r.Close()
+
+	h := sha256.New()
+	if size, err = io.Copy(h, r); err != nil {
+		return "", 0, err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), size, nil
+}
+
+func completeFileUpload(c *fiber.Ctx, requester *sm.User, upload *FileUpload, m FileUploadCompleteMetadata) (file *File, err error) {
+	ctx := c.UserContext()
+
+	if upload.Status != FileUploadPending {
+		return nil, fmt.Errorf("%s is %s", fileUploadSingular, upload.Status)
+	}
+
+	// Hash declared by the client, verified against the uploaded contents
+	var expectedHash string
+	if m.Hash != nil && *m.Hash != "" {
+		expectedHash = *m.Hash
+	} else if upload.Hash != nil {
+		expectedHash = *upload.Hash
+	}
+
+	if expectedHash != "" {
+		var ok bool
+		if expectedHash, ok = NormalizeFileBlobHash(expectedHash); !ok {
+			return nil, fmt.Errorf("invalid hash")
+		}
+	}
+
+	parts := m.Parts
+	if len(parts) == 0 {
+		parts, err = listFileUploadParts(upload)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(parts) == 0 {
+		return nil, fmt.Errorf("no uploaded parts")
+	}
+
+	sort.Slice(parts, func(i, j int) bool { return parts[i].PartNumber < parts[j].PartNumber })
+
+	if err = claimFileUpload(ctx, *upload.Id); err != nil {
+		return nil, err
+	}
+
+	if err = s3.CompleteMultipartUpload(upload.Key, upload.UploadId, parts); err != nil {
+		releaseFileUpload(ctx, *upload.Id)
+		logrus.Errorf("failed to complete multipart upload %s @ %s: %v", upload.Key, reflect.FunctionName(), err)
+		return nil, fmt.Errorf("failed to complete %s: %v", fileUploadSingular, err)
+	}
+
+	// The assembled object is removed unless the file record is committed
+	completed := false
+	defer func() {
+		if !completed {
+			rejectFileUpload(ctx, upload)
+		}
+	}()
+
+	//region File properties
+	// The size is checked right away, the contents are hashed and verified by the background worker as large objects take long to read
+	size, mime, err := s3.GetObjectInfo(upload.Key)
+	if err != nil {
+		logrus.Errorf("failed to get object info %s @ %s: %v", upload.Key, reflect.FunctionName(), err)
+		return nil, fmt.Errorf("failed to complete %s", fileUploadSingular)
+	}
+
+	if size != upload.Size {
+		return nil, fmt.Errorf("uploaded size %d does not match the declared size %d", size, upload.Size)
+	}
+
+	if upload.Mime != nil && *upload.Mime != "" {
+		mime = *upload.Mime
+	} else if mime == "" || mime == "application/octet-stream" || mime == "binary/octet-stream" {
+		// Detect the MIME type by the file header
+		if head, err1 := s3.GetObjectHead(upload.Key, 3072); err1 == nil {
+			mime = mimetype.Detect(head).String()
+		}
+	}
+	//endregion
+
+	db := database.DB
+
+	tx, err1 := db.Begin(ctx)
+	if err1 != nil {
+		return nil, fmt.Errorf("failed to begin tx: %v", err1)
+	}
+
+	//region Replace an existing file with the same properties
+	var (
+		previousId      uuid.UUID
+		previousUrl     string
+		previousVersion int64
+		version         int64
+		archived        bool // previous file is kept as a version
+	)
+
+	q := `SELECT f.id, f.version
+FROM files AS f
+WHERE f.entity_id = $1
+  AND f.type = $2
+  AND f.deployment_type = $3
+  AND f.platform = $4
+  AND f.variation = $5
+  AND f.original_path = $6
+FOR UPDATE`
+
+	err1 = tx.QueryRow(ctx, q, upload.EntityId /*$1*/, upload.Type /*$2*/, upload.Deployment /*$3*/, upload.Platform /*$4*/, upload.Index /*$5*/, upload.OriginalPath /*$6*/).Scan(&previousId, &previousVersion)
+	if err1 == nil {
+		version = previousVersion + 1
+
+		// Keep the previous file as a version if the history is enabled for its type
+		if previousUrl, archived, err1 = archiveFileVersion(ctx, tx, previousId); err1 != nil {
+			if err2 := tx.Rollback(ctx); err2 != nil {
+				return nil, fmt.Errorf("failed to rollback failed tx: %v, %v", err1, err2)
+			}
+			return nil, err1
+		}
+
+		q = `DELETE FROM files f WHERE f.id = $1`
+		if _, err1 = tx.Exec(ctx, q, previousId); err1 != nil {
+			if err2 := tx.Rollback(ctx); err2 != nil {
+				return nil, fmt.Errorf("failed to rollback failed tx: %v, %v", err1, err2)
+			}
+			return nil, fmt.Errorf("failed to replace the previous file: %v", err1)
+		}
+	} else if err1 != pgx.ErrNoRows {
+		if err2 := tx.Rollback(ctx); err2 != nil {
+			return nil, fmt.Errorf("failed to rollback failed tx: %v, %v", err1, err2)
+		}
+		return nil, fmt.Errorf("failed to query the previous file: %v", err1)
+	}
+	//endregion
+
+	url := s3.GetS3UrlForEntityFile(*upload.EntityId, *upload.FileId)
+
+	// The file can not be downloaded until its contents have been verified
+	q = `INSERT INTO files AS f (id, entity_id, url, type, mime, size, version, deployment_type, platform, uploaded_by, width, height, created_at, updated_at, variation, original_path, scan_status)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, now(), null, $13, $14, $15)`
+	if _, err1 = tx.Exec(ctx, q, upload.FileId /*$1*/, upload.EntityId /*$2*/, url /*$3*/, upload.Type /*$4*/, mime /*$5*/, size /*$6*/, version /*$7*/, upload.Deployment /*$8*/, upload.Platform /*$9*/, requester.Id /*$10*/, upload.Width /*$11*/, upload.Height /*$12*/, upload.Index /*$13*/, upload.OriginalPath /*$14*/, FileScanVerifying /*$15*/); err1 != nil {
+		if err2 := tx.Rollback(ctx); err2 != nil {
+			return nil, fmt.Errorf("failed to rollback failed tx: %v, %v", err1, err2)
+		}
+		return nil, fmt.Errorf("failed to insert the file: %v", err1)
+	}
+
+	// Store glTF metadata, assets exceeding the budget of the file type are rejected and their objects are removed
+	if err1 = extractFileMetadata(ctx, tx, *upload.FileId, upload.Type, mime, upload.OriginalPath, newObjectReaderAt(upload.Key, size), size); err1 != nil {
+		if err2 := tx.Rollback(ctx); err2 != nil {
+			return nil, fmt.Errorf("failed to rollback failed tx: %v, %v", err1, err2)
+		}
+		return nil, err1
+	}
+
+	// Derivatives and the scan are queued once the contents have been verified
+	var declaredHash *string
+	if expectedHash != "" {
+		declaredHash = &expectedHash
+	}
+
+	q = `UPDATE file_uploads SET status = $2, hash = $3, verify_attempts = 0, verify_error = null, verify_started_at = null, updated_at = now() WHERE id = $1`
+	if _, err1 = tx.Exec(ctx, q, upload.Id /*$1*/, FileUploadVerifying /*$2*/, declaredHash /*$3*/); err1 != nil {
+		if err2 := tx.Rollback(ctx); err2 != nil {
+			return nil, fmt.Errorf("failed to rollback failed tx: %v, %v", err1, err2)
+		}
+		return nil, fmt.Errorf("failed to update the %s: %v", fileUploadSingular, err1)
+	}
+
+	if err1 = tx.Commit(ctx); err1 != nil {
+		return nil, fmt.Errorf("failed to commit tx: %v", err1)
+	}
+
+	completed = true
+
+	// Remove the replaced object after the new file record has been committed unless it is kept as a version or is a blob shared with other files
+	if !previousId.IsNil() && !archived {
+		deleteReplacedFileObjectAfterCommit(ctx, *upload.EntityId, previousUrl)
+	}
+
+	if upload.Type == "pak" {
+		if err1 = NotifyBuildJobCompleted(c, *upload.EntityId); err1 != nil {
+			logrus.Errorf("failed to notify job complete @ %s: %v", reflect.FunctionName(), err1)
+		}
+	}
+
+	return GetFileForAdmin(ctx, *upload.FileId)
+}
+
+// CompleteFileUploadForAdmin Completes the multipart upload and creates or replaces the file record
+func CompleteFileUploadForAdmin(c *fiber.Ctx, requester *sm.User, id uuid.UUID, m FileUploadCompleteMetadata) (file *File, err error) {
+	upload, err := GetFileUpload(c.UserContext(), id)
+	if err != nil {
+		return nil, err
+	}
+
+	return completeFileUpload(c, requester, upload, m)
+}
+
+// CompleteFileUploadForRequester Completes the multipart upload if the requester has access to the upload
+func CompleteFileUploadForRequester(c *fiber.Ctx, requester *sm.User, id uuid.UUID, m FileUploadCompleteMetadata) (file *File, err error) {
+	upload, err := getFileUploadForRequester(c.UserContext(), requester, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return completeFileUpload(c, requester, upload, m)
+}
+
+// rejectVerifiedFileUpload Removes the file created by the completion and its object if the uploaded contents do not match the declared ones and notifies the uploader
+func rejectVerifiedFileUpload(ctx context.Context, upload *FileUpload, reason string) (err error) {
+	logrus.Warnf("%s %s has been rejected: %s", fileUploadSingular, upload.Id, reason)
+
+	if err1 := notifyFileScanRejected(ctx, *upload.FileId, reason); err1 != nil {
+		logrus.Errorf("failed to notify about the rejected %s %s: %v", fileUploadSingular, upload.Id, err1)
+	}
+
+	db := database.DB
+
+	tx, err1 := db.Begin(ctx)
+	if err1 != nil {
+		return fmt.Errorf("failed to begin tx: %v", err1)
+	}
+
+	// The file could have been replaced or removed meanwhile, its object is then removed together with the file
+	q := `DELETE FROM files f WHERE f.id = $1 AND f.url = $2`
+	res, err1 := tx.Exec(ctx, q, upload.FileId /*$1*/, s3.GetS3UrlForEntityFile(*upload.EntityId, *upload.FileId) /*$2*/)
+	if err1 != nil {
+		if err2 := tx.Rollback(ctx); err2 != nil {
+			return fmt.Errorf("failed to rollback failed tx: %v, %v", err1, err2)
+		}
+		return fmt.Errorf("failed to delete the file: %v", err1)
+	}
+
+	q = `UPDATE file_uploads SET status = $2, verify_error = $3, updated_at = now() WHERE id = $1`
+	if _, err1 = tx.Exec(ctx, q, upload.Id /*$1*/, FileUploadAborted /*$2*/, reason /*$3*/); err1 != nil {
+		if err2 := tx.Rollback(ctx); err2 != nil {
+			return fmt.Errorf("failed to rollback failed tx: %v, %v", err1, err2)
+		}
+		return fmt.Errorf("failed to update the %s: %v", fileUploadSingular, err1)
+	}
+
+	if err1 = tx.Commit(ctx); err1 != nil {
+		return fmt.Errorf("failed to commit tx: %v", err1)
+	}
+
+	if res.RowsAffected() > 0 {
+		if err = s3.DeleteObject(upload.Key); err != nil {
+			logrus.Errorf("failed to delete the rejected object %s @ %s: %v", upload.Key, reflect.FunctionName(), err)
+		}
+	}
+
+	return nil
+}
+
+// verifyFileUpload Hashes the assembled object and compares it with the declared size and hash, verified files are queued for derivatives and the scan, mismatching ones are removed
+func verifyFileUpload(ctx context.Context, upload *FileUpload) (err error) {
+	hash, size, err := hashFileObject(upload.Key)
+	if err != nil {
+		return fmt.Errorf("failed to hash object %s: %v", upload.Key, err)
+	}
+
+	if size != upload.Size {
+		return rejectVerifiedFileUpload(ctx, upload, fmt.Sprintf("uploaded size %d does not match the declared size %d", size, upload.Size))
+	}
+
+	if upload.Hash != nil && *upload.Hash != "" && *upload.Hash != hash {
+		return rejectVerifiedFileUpload(ctx, upload, fmt.Sprintf("uploaded file hash %s does not match the declared hash %s", hash, *upload.Hash))
+	}
+
+	db := database.DB
+
+	tx, err1 := db.Begin(ctx)
+	if err1 != nil {
+		return fmt.Errorf("failed to begin tx: %v", err1)
+	}
+
+	// The file could have been replaced or removed while it was hashed, the replacement has its own status
+	var (
+		exists    = true
+		mime      *string
+		duplicate bool // the object duplicates an existing blob and is deleted after the commit
+	)
+	q := `SELECT f.mime FROM files f WHERE f.id = $1 AND f.url = $2 FOR UPDATE`
+	if err1 = tx.QueryRow(ctx, q, upload.FileId /*$1*/, s3.GetS3UrlForEntityFile(*upload.EntityId, *upload.FileId) /*$2*/).Scan(&mime); err1 == pgx.ErrNoRows {
+		exists = false
+	} else if err1 != nil {
+		if err2 := tx.Rollback(ctx); err2 != nil {
+			return fmt.Errorf("failed to rollback failed tx: %v, %v", err1, err2)
+		}
+		return err1
+	}
+
+	if exists {
+		q = `UPDATE files SET hash = $2 WHERE id = $1`
+		if _, err1 = tx.Exec(ctx, q, upload.FileId /*$1*/, hash /*$2*/); err1 != nil {
+			if err2 := tx.Rollback(ctx); err2 != nil {
+				return fmt.Errorf("failed to rollback failed tx: %v, %v", err1, err2)
+			}
+			return fmt.Errorf("failed to update the file: %v", err1)
+		}
+
+		// Large uploads such as paks and release files are deduplicated the same way as the regular ones
+		if isFileBlobType(upload.Type) {
+			if duplicate, err1 = registerFileObjectBlob(ctx, tx, *upload.FileId, upload.Key, hash, size, mime); err1 != nil {
+				if err2 := tx.Rollback(ctx); err2 != nil {
+					return fmt.Errorf("failed to rollback failed tx: %v, %v", err1, err2)
+				}
+				return fmt.Errorf("failed to register the %s: %v", fileBlobSingular, err1)
+			}
+		}
+
+		if err1 = enqueueImageDerivatives(ctx, tx, *upload.FileId, upload.Type); err1 != nil {
+			if err2 := tx.Rollback(ctx); err2 != nil {
+				return fmt.Errorf("failed to rollback failed tx: %v, %v", err1, err2)
+			}
+			return fmt.Errorf("failed to queue %s: %v", imageDerivativePlural, err1)
+		}
+
+		// Resets the verifying status, files are available right away if scanning is disabled
+		if err1 = enqueueFileScan(ctx, tx, *upload.FileId); err1 != nil {
+			if err2 := tx.Rollback(ctx); err2 != nil {
+				return fmt.Errorf("failed to rollback failed tx: %v, %v", err1, err2)
+			}
+			return fmt.Errorf("failed to queue the %s: %v", fileScanSingular, err1)
+		}
+	}
+
+	q = `UPDATE file_uploads SET status = $2, hash = $3, verify_error = null, updated_at = now() WHERE id = $1`
+	if _, err1 = tx.Exec(ctx, q, upload.Id /*$1*/, FileUploadCompleted /*$2*/, hash /*$3*/); err1 != nil {
+		if err2 := tx.Rollback(ctx); err2 != nil {
+			return fmt.Errorf("failed to rollback failed tx: %v, %v", err1, err2)
+		}
+		return fmt.Errorf("failed to update the %s: %v", fileUploadSingular, err1)
+	}
+
+	if err1 = tx.Commit(ctx); err1 != nil {
+		return fmt.Errorf("failed to commit tx: %v", err1)
+	}
+
+	if duplicate {
+		if err = s3.DeleteObject(upload.Key); err != nil {
+			logrus.Errorf("failed to delete the duplicate object %s @ %s: %v", upload.Key, reflect.FunctionName(), err)
+		}
+	}
+
+	if exists {
+		// Objects of verified files of public entities become publicly readable unless they wait for the scan
+		if err = updateFileObjectAcls(ctx, *upload.FileId); err != nil {
+			logrus.Errorf("failed to update acls of the file %s @ %s: %v", *upload.FileId, reflect.FunctionName(), err)
+		}
+	}
+
+	return nil
+}
+
+// processFileUploadVerification Claims the next completed upload waiting for verification and verifies it, returns false if there are no uploads to verify
+func processFileUploadVerification(ctx context.Context) (processed bool, err error) {
+	db := database.DB
+
+	var (
+		id       uuid.UUID
+		attempts int
+	)
+
+	// The upload is claimed by a short update so other API instances skip it while its object is hashed, claims of stopped instances are reclaimed after the timeout
+	q := `UPDATE file_uploads u
+SET verify_attempts   = u.verify_attempts + 1,
+    verify_started_at = now()
+WHERE u.id = (SELECT c.id
+              FROM file_uploads c
+              WHERE c.status = $1
+                AND (c.verify_started_at IS NULL OR c.verify_started_at < $2)
+              ORDER BY c.updated_at
+              LIMIT 1 FOR UPDATE SKIP LOCKED)
+RETURNING u.id, u.verify_attempts`
+	err = db.QueryRow(ctx, q, FileUploadVerifying /*$1*/, time.Now().Add(-fileUploadVerifyTimeout) /*$2*/).Scan(&id, &attempts)
+	if err == pgx.ErrNoRows {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	upload, err := GetFileUpload(ctx, id)
+	if err != nil {
+		return true, fmt.Errorf("failed to get the %s: %v", fileUploadSingular, err)
+	}
+
+	var err1 error
+	if attempts > fileUploadVerifyMaxAttempts {
+		err1 = fmt.Errorf("timed out")
+	} else if err1 = verifyFileUpload(ctx, upload); err1 == nil {
+		return true, nil
+	}
+
+	logrus.Errorf("failed to verify %s %s @ %s: %v", fileUploadSingular, id, reflect.FunctionName(), err1)
+
+	if attempts >= fileUploadVerifyMaxAttempts {
+		if err = rejectVerifiedFileUpload(ctx, upload, "the file could not be verified"); err != nil {
+			return true, fmt.Errorf("failed to reject the %s: %v", fileUploadSingular, err)
+		}
+		return true, nil
+	}
+
+	q = `UPDATE file_uploads SET verify_error = $2, verify_started_at = null WHERE id = $1`
+	if _, err = db.Exec(ctx, q, id /*$1*/, err1.Error() /*$2*/); err != nil {
+		return true, fmt.Errorf("failed to update the %s: %v", fileUploadSingular, err)
+	}
+
+	return true, nil
+}
+
+// ProcessFileUploadVerifications Verifies up to the limit of completed uploads
+func ProcessFileUploadVerifications(ctx context.Context, limit int) (processed int, err error) {
+	for processed < limit {
+		ok, err := processFileUploadVerification(ctx)
+		if err != nil {
+			return processed, err
+		}
+		if !ok {
+			break
+		}
+		processed++
+	}
+
+	return processed, nil
+}
+
+// StartFileUploadVerifier periodically verifies contents of completed uploads until the context is cancelled
+func StartFileUploadVerifier(ctx context.Context) {
+	interval, err := time.ParseDuration(fileUploadVerifyInterval)
+	if err != nil || interval <= 0 {
+		interval = 10 * time.Second
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			if processed, err := ProcessFileUploadVerifications(ctx, fileUploadVerifyBatchSize); err != nil {
+				logrus.Errorf("failed to verify %s: %v", fileUploadPlural, err)
+			} else if processed > 0 {
+				logrus.Infof("verified %d %s", processed, fileUploadPlural)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func abortFileUpload(ctx context.Context, upload *FileUpload) (err error) {
+	db := database.DB
+
+	// Only a pending upload is aborted, an upload being completed is left to the completion
+	q := `UPDATE file_uploads SET status = $3, updated_at = now() WHERE id = $1 AND status = $2`
+	res, err := db.Exec(ctx, q, upload.Id /*$1*/, FileUploadPending /*$2*/, FileUploadAborted /*$3*/)
+	if err != nil {
+		logrus.Errorf("failed to update %s @ %s: %v", fileUploadSingular, reflect.FunctionName(), err)
+		return fmt.Errorf("failed to abort %s", fileUploadSingular)
+	}
+
+	if res.RowsAffected() == 0 {
+		return fmt.Errorf("%s is not %s", fileUploadSingular, FileUploadPending)
+	}
+
+	if err = s3.AbortMultipartUpload(upload.Key, upload.UploadId); err != nil {
+		logrus.Errorf("failed to abort multipart upload %s @ %s: %v", upload.Key, reflect.FunctionName(), err)
+		return fmt.Errorf("failed to abort %s", fileUploadSingular)
+	}
+
+	return nil
+}
+
+// AbortFileUploadForAdmin Aborts the multipart upload and removes the uploaded parts
+func AbortFileUploadForAdmin(ctx context.Context, id uuid.UUID) (err error) {
+	upload, err := GetFileUpload(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	return abortFileUpload(ctx, upload)
+}
+
+// AbortFileUploadForRequester Aborts the multipart upload if the requester has access to the upload
+func AbortFileUploadForRequester(ctx context.Context, requester *sm.User, id uuid.UUID) (err error) {
+	upload, err := getFileUploadForRequester(ctx, requester, id)
+	if err != nil {
+		return err
+	}
+
+	return abortFileUpload(ctx, upload)
+}
+
+// AbortAbandonedFileUploads Aborts pending uploads initiated before the cutoff and uploads left completing by an interrupted completion, only uploads recorded in file_uploads are aborted
+func AbortAbandonedFileUploads(ctx context.Context, before time.Time) (aborted int, err error) {
+	db := database.DB
+
+	q := `SELECT id FROM file_uploads WHERE (status = $1 AND created_at < $3) OR (status = $2 AND updated_at < $3)`
+
+	rows, err := db.Query(ctx, q, FileUploadPending /*$1*/, FileUploadCompleting /*$2*/, before /*$3*/)
+	if err != nil {
+		logrus.Errorf("failed to query %s @ %s: %v", fileUploadPlural, reflect.FunctionName(), err)
+		return 0, fmt.Errorf("failed to get abandoned %s", fileUploadPlural)
+	}
+
+	var ids []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err = rows.Scan(&id); err != nil {
+			rows.Close()
+			logrus.Errorf("failed to scan %s @ %s: %v", fileUploadPlural, reflect.FunctionName(), err)
+			return 0, fmt.Errorf("failed to get abandoned %s", fileUploadPlural)
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	database.LogPgxStat("AbortAbandonedFileUploads")
+
+	for _, id := range ids {
+		upload, err := GetFileUpload(ctx, id)
+		if err != nil {
+			logrus.Errorf("failed to get abandoned %s %s: %v", fileUploadSingular, id, err)
+			continue
+		}
+
+		if upload.Status == FileUploadCompleting {
+			// The completion has been interrupted, the parts may have been assembled into the object without a file record
+			if err = s3.AbortMultipartUpload(upload.Key, upload.UploadId); err != nil {
+				logrus.Warningf("failed to abort multipart upload %s of the interrupted %s %s: %v", upload.Key, fileUploadSingular, id, err)
+			}
+			rejectFileUpload(ctx, upload)
+		} else if err = abortFileUpload(ctx, upload); err != nil {
+			logrus.Errorf("failed to abort abandoned %s %s: %v", fileUploadSingular, id, err)
+			continue
+		}
+		aborted++
+	}
+
+	return aborted, nil
+}
+
+// StartFileUploadJanitor periodically aborts abandoned uploads and deletes unreferenced blobs until the context is cancelled
+func StartFileUploadJanitor(ctx context.Context) {
+	abandonAfter, err := time.ParseDuration(fileUploadAbandonAfter)
+	if err != nil || abandonAfter <= 0 {
+		abandonAfter = 24 * time.Hour
+	}
+
+	interval, err := time.ParseDuration(fileUploadJanitorInterval)
+	if err != nil || interval <= 0 {
+		interval = time.Hour
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			if aborted, err := AbortAbandonedFileUploads(ctx, time.Now().Add(-abandonAfter)); err != nil {
+				logrus.Errorf("failed to abort abandoned file uploads: %v", err)
+			} else if aborted > 0 {
+				logrus.Infof("aborted %d abandoned file uploads", aborted)
+			}
+
+			if deleted, err := DeleteUnreferencedFileBlobs(ctx); err != nil {
+				logrus.Errorf("failed to delete unreferenced file blobs: %v", err)
+			} else if deleted > 0 {
+				logrus.Infof("deleted %d unreferenced file blobs", deleted)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
@@ -1021,7 +1021,7 @@ func IndexFollowers(ctx context.Context, userId uuid.UUID, offset int64, limit i
 	FROM followers fw
 	LEFT JOIN users u ON fw.follower_id = u.id
 	LEFT JOIN entities e ON e.id = u.id
-	LEFT JOIN files f ON f.entity_id = e.id
+	LEFT JOIN files f ON f.entity_id = e.id AND f.derivative_of IS NULL
 	WHERE fw.leader_id = $1
 	OFFSET $2 LIMIT $3`
 
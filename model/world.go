@@ -109,18 +109,18 @@ func IndexWorldsForAdmin(ctx context.Context, requester *User, offset int64, lim
 	owner.id 				ownerId,
 	owner.name 				ownerName,
 	l2.value				liked,
-	sum(case when l.value >= 0 then l.value end) as total_likes,
-	sum(case when l.value < 0 then l.value end) as total_dislikes,
+	r.total_likes,
+	r.total_dislikes,
 	e.views
 FROM spaces w
     LEFT JOIN entities e ON w.id = e.id
-	LEFT JOIN likables l ON l.entity_id = e.id
+	LEFT JOIN entity_ratings r ON r.entity_id = e.id
     LEFT JOIN likables l2 ON l2.entity_id = e.id AND l2.user_id = $1
 	LEFT JOIN accessibles a ON a.entity_id = e.id
 	LEFT JOIN users owner ON owner.id = a.user_id
 	LEFT JOIN mods m ON w.mod_id = m.id
 	LEFT JOIN files preview ON e.id = preview.entity_id AND preview.type = 'image_preview'
-GROUP BY w.id, e.public, preview.id, preview.url, preview.type, preview.mime, preview.size, owner.id, e.updated_at, e.created_at, e.id, l2.value, e.views
+GROUP BY w.id, e.public, preview.id, preview.url, preview.type, preview.mime, preview.size, owner.id, e.updated_at, e.created_at, e.id, l2.value, e.views, r.total_likes, r.total_dislikes
 ORDER BY e.updated_at DESC, e.created_at DESC, e.id`
 
 	var rows pgx.Rows
@@ -332,20 +332,20 @@ func IndexWorldsForAdminWithPak(ctx context.Context, requester *sm.User, offset
 	owner.id 				ownerId,
 	owner.name 				ownerName,
 	l2.value				liked,
-	sum(case when l.value >= 0 then l.value end) as total_likes,
-	sum(case when l.value < 0 then l.value end) as total_dislikes,
+	r.total_likes,
+	r.total_dislikes,
 	e.views
 FROM spaces w
     LEFT JOIN entities e ON w.id = e.id
-	LEFT JOIN likables l ON l.entity_id = e.id
+	LEFT JOIN entity_ratings r ON r.entity_id = e.id
     LEFT JOIN likables l2 ON l2.entity_id = e.id AND l2.user_id = $1
 	LEFT JOIN mods m ON w.mod_id = m.id
-	LEFT JOIN files pak ON pak.entity_id = m.id AND ((pak.platform = $2::text AND pak.deployment_type = $3::text) OR (pak.platform = '' AND pak.deployment_type = ''))
+	LEFT JOIN files pak ON (pak.entity_id = coalesce(w.mod_version_id, package_latest_version(m.id, $2::text, $3::text), m.id) AND pak.platform = $2::text AND pak.deployment_type = $3::text) OR (pak.entity_id = m.id AND pak.platform = '' AND pak.deployment_type = '')
     LEFT JOIN accessibles a ON a.entity_id = e.id
 	LEFT JOIN users owner ON owner.id = a.user_id
 	LEFT JOIN files preview ON e.id = preview.entity_id AND preview.type = 'image_preview'
 GROUP BY w.id, m.id, e.updated_at, e.created_at, e.id, pak.id, pak.url, pak.type, pak.mime, pak.size, pak.original_path, pak.hash, preview.id,
-preview.url, preview.type, preview.mime, preview.size, preview.original_path, preview.hash, owner.id, l2.value, e.views
+preview.url, preview.type, preview.mime, preview.size, preview.original_path, preview.hash, owner.id, l2.value, e.views, r.total_likes, r.total_dislikes
 ORDER BY e.updated_at DESC, e.created_at DESC, e.id`
 
 	var (
@@ -634,19 +634,19 @@ WHERE w.mod_id = $1`
 	owner.id 				ownerId,
 	owner.name 				ownerName,
 	l2.value				liked,
-	sum(case when l.value >= 0 then l.value end) as total_likes,
-	sum(case when l.value < 0 then l.value end) as total_dislikes,
+	r.total_likes,
+	r.total_dislikes,
 	e.views
 FROM spaces w
     LEFT JOIN entities e ON w.id = e.id
-    LEFT JOIN likables l ON l.entity_id = e.id
+    LEFT JOIN entity_ratings r ON r.entity_id = e.id
 	LEFT JOIN likables l2 ON l2.entity_id = e.id AND l2.user_id = $1
 	LEFT JOIN accessibles a ON a.entity_id = e.id
 	LEFT JOIN users owner ON owner.id = a.user_id
 	LEFT JOIN mods m ON w.mod_id = m.id
 	LEFT JOIN files preview ON e.id = preview.entity_id AND preview.type = 'image_preview'
 WHERE w.mod_id = $2
-GROUP BY e.id, w.id, e.updated_at, e.created_at, preview.id, preview.url, preview.type, preview.mime, preview.size, owner.id, l2.value, e.views
+GROUP BY e.id, w.id, e.updated_at, e.created_at, preview.id, preview.url, preview.type, preview.mime, preview.size, owner.id, l2.value, e.views, r.total_likes, r.total_dislikes
 ORDER BY e.updated_at DESC, e.created_at DESC, e.id`
 
 	var rows pgx.Rows
@@ -860,20 +860,20 @@ WHERE w.mod_id = $1`
 	owner.id 				ownerId,
 	owner.name 				ownerName,
 	l2.value				liked,
-	sum(case when l.value >= 0 then l.value end) as total_likes,
-	sum(case when l.value < 0 then l.value end) as total_dislikes,
+	r.total_likes,
+	r.total_dislikes,
 	e.views
 FROM spaces w
     LEFT JOIN entities e ON w.id = e.id
-	LEFT JOIN likables l ON l.entity_id = e.id
+	LEFT JOIN entity_ratings r ON r.entity_id = e.id
     LEFT JOIN likables l2 ON l2.entity_id = e.id AND l2.user_id = $1
 	LEFT JOIN accessibles a ON a.entity_id = e.id
 	LEFT JOIN users owner ON owner.id = a.user_id
 	LEFT JOIN mods m ON w.mod_id = m.id
-	LEFT JOIN files pak ON pak.entity_id = m.id AND ((pak.platform = $2::text AND pak.deployment_type = $3::text) OR (pak.platform = '' AND pak.deployment_type = ''))
+	LEFT JOIN files pak ON (pak.entity_id = coalesce(w.mod_version_id, package_latest_version(m.id, $2::text, $3::text), m.id) AND pak.platform = $2::text AND pak.deployment_type = $3::text) OR (pak.entity_id = m.id AND pak.platform = '' AND pak.deployment_type = '')
 	LEFT JOIN files preview ON e.id = preview.entity_id AND preview.type = 'image_preview'
 WHERE w.mod_id = $4
-GROUP BY e.id, w.id, m.id, e.public, pak.id, pak.url, pak.type, pak.mime, pak.size, pak.original_path, pak.hash, preview.id, preview.url, preview.type, preview.mime, preview.size, preview.original_path, preview.hash, owner.id, l2.value, e.updated_at, e.created_at, e.views
+GROUP BY e.id, w.id, m.id, e.public, pak.id, pak.url, pak.type, pak.mime, pak.size, pak.original_path, pak.hash, preview.id, preview.url, preview.type, preview.mime, preview.size, preview.original_path, preview.hash, owner.id, l2.value, e.updated_at, e.created_at, e.views, r.total_likes, r.total_dislikes
 ORDER BY e.updated_at DESC, e.created_at DESC, e.id`
 
 	var rows pgx.Rows
@@ -1128,19 +1128,19 @@ func IndexWorldsForAdminWithQuery(ctx context.Context, requester *User, offset i
 	owner.id 				ownerId,
 	owner.name 				ownerName,
 	l2.value				liked,
-	sum(case when l.value >= 0 then l.value end) as total_likes,
-	sum(case when l.value < 0 then l.value end) as total_dislikes,
+	r.total_likes,
+	r.total_dislikes,
 	e.views
 FROM spaces w
     LEFT JOIN entities e ON w.id = e.id
-    LEFT JOIN likables l ON l.entity_id = e.id
+    LEFT JOIN entity_ratings r ON r.entity_id = e.id
     LEFT JOIN likables l2 ON l2.entity_id = e.id AND l2.user_id = $1
     LEFT JOIN accessibles a ON a.entity_id = e.id
 	LEFT JOIN users owner ON owner.id = a.user_id
 	LEFT JOIN mods m ON w.mod_id = m.id
 	LEFT JOIN files preview ON e.id = preview.entity_id AND preview.type = 'image_preview'
 WHERE w.name ILIKE $2::text OR m.name ILIKE $2::text
-GROUP BY e.id, w.id, e.public, preview.id, preview.url, preview.type, preview.mime, preview.size, owner.id, l2.value, e.updated_at, e.created_at, e.views
+GROUP BY e.id, w.id, e.public, preview.id, preview.url, preview.type, preview.mime, preview.size, owner.id, l2.value, e.updated_at, e.created_at, e.views, r.total_likes, r.total_dislikes
 ORDER BY e.updated_at DESC, e.created_at DESC, e.id`
 
 	var (
@@ -1352,20 +1352,20 @@ func IndexWorldsForAdminWithQueryWithPak(ctx context.Context, requester *sm.User
 	owner.id 				ownerId,
 	owner.name 				ownerName,
 	l2.value				liked,
-	sum(case when l.value >= 0 then l.value end) as total_likes,
-	sum(case when l.value < 0 then l.value end) as total_dislikes,
+	r.total_likes,
+	r.total_dislikes,
 	e.views
 FROM spaces w
     LEFT JOIN entities e ON w.id = e.id
-    LEFT JOIN likables l ON l.entity_id = e.id
+    LEFT JOIN entity_ratings r ON r.entity_id = e.id
     LEFT JOIN likables l2 ON l2.entity_id = e.id AND l2.user_id = $1
     LEFT JOIN accessibles a ON a.entity_id = e.id
 	LEFT JOIN users owner ON owner.id = a.user_id
 	LEFT JOIN mods m ON w.mod_id = m.id
-	LEFT JOIN files pak ON pak.entity_id = m.id AND ((pak.platform = $2::text AND pak.deployment_type = $3::text) OR (pak.platform = '' AND pak.deployment_type = ''))
+	LEFT JOIN files pak ON (pak.entity_id = coalesce(w.mod_version_id, package_latest_version(m.id, $2::text, $3::text), m.id) AND pak.platform = $2::text AND pak.deployment_type = $3::text) OR (pak.entity_id = m.id AND pak.platform = '' AND pak.deployment_type = '')
 	LEFT JOIN files preview ON e.id = preview.entity_id AND preview.type = 'image_preview'
 WHERE w.name ILIKE $4::text OR m.name ILIKE $4::text
-GROUP BY e.id, m.id, w.id, e.public, pak.id, pak.url, pak.type, pak.mime, pak.size, pak.original_path, pak.hash, preview.id, preview.url, preview.type, preview.mime, preview.size, preview.original_path, preview.hash, owner.id, l2.value, e.updated_at, e.created_at, e.views
+GROUP BY e.id, m.id, w.id, e.public, pak.id, pak.url, pak.type, pak.mime, pak.size, pak.original_path, pak.hash, preview.id, preview.url, preview.type, preview.mime, preview.size, preview.original_path, preview.hash, owner.id, l2.value, e.updated_at, e.created_at, e.views, r.total_likes, r.total_dislikes
 ORDER BY e.updated_at DESC, e.created_at DESC, e.id`
 
 	var (
@@ -1649,19 +1649,19 @@ WHERE w.mod_id = $1 AND (w.name ILIKE $2::text OR m.name ILIKE $2::text)`
 	owner.id 				ownerId,
 	owner.name 				ownerName,
 	l2.value				liked,
-	sum(case when l.value >= 0 then l.value end) as total_likes,
-	sum(case when l.value < 0 then l.value end) as total_dislikes,
+	r.total_likes,
+	r.total_dislikes,
 	e.views
 FROM spaces w
     LEFT JOIN entities e ON w.id = e.id
-	LEFT JOIN likables l ON l.entity_id = e.id
+	LEFT JOIN entity_ratings r ON r.entity_id = e.id
     LEFT JOIN likables l2 ON l2.entity_id = e.id AND l2.user_id = $1
 	LEFT JOIN accessibles a ON a.entity_id = e.id
 	LEFT JOIN users owner ON owner.id = a.user_id
 	LEFT JOIN mods m ON w.mod_id = m.id
 	LEFT JOIN files preview ON e.id = preview.entity_id AND preview.type = 'image_preview'
 WHERE w.mod_id = $2 AND (w.name ILIKE $3::text OR m.name ILIKE $3::text) 
-GROUP BY e.id, w.id, e.public, preview.id, preview.url, preview.type, preview.mime, preview.size, owner.id, l2.value, e.updated_at, e.created_at, e.views
+GROUP BY e.id, w.id, e.public, preview.id, preview.url, preview.type, preview.mime, preview.size, owner.id, l2.value, e.updated_at, e.created_at, e.views, r.total_likes, r.total_dislikes
 ORDER BY e.updated_at DESC, e.created_at DESC, e.id`
 
 	var rows pgx.Rows
@@ -1859,20 +1859,20 @@ WHERE w.mod_id = $1 AND (w.name ILIKE $2::text OR m.name ILIKE $2::text)`
 	owner.id 				ownerId,
 	owner.name 				ownerName,
 	l2.value				liked,
-	sum(case when l.value >= 0 then l.value end) as total_likes,
-	sum(case when l.value < 0 then l.value end) as total_dislikes,
+	r.total_likes,
+	r.total_dislikes,
 	e.views
 FROM spaces w
     LEFT JOIN entities e ON w.id = e.id
-	LEFT JOIN likables l ON l.entity_id = e.id
+	LEFT JOIN entity_ratings r ON r.entity_id = e.id
     LEFT JOIN likables l2 ON l2.entity_id = e.id AND l2.user_id = $1
     LEFT JOIN accessibles a ON a.entity_id = e.id
 	LEFT JOIN users owner ON owner.id = a.user_id
 	LEFT JOIN mods m ON w.mod_id = m.id
-	LEFT JOIN files pak ON pak.entity_id = m.id AND ((pak.platform = $2::text AND pak.deployment_type = $3::text) OR (pak.platform = '' AND pak.deployment_type = ''))
+	LEFT JOIN files pak ON (pak.entity_id = coalesce(w.mod_version_id, package_latest_version(m.id, $2::text, $3::text), m.id) AND pak.platform = $2::text AND pak.deployment_type = $3::text) OR (pak.entity_id = m.id AND pak.platform = '' AND pak.deployment_type = '')
 	LEFT JOIN files preview ON e.id = preview.entity_id AND preview.type = 'image_preview'
 WHERE w.mod_id = $4 AND (w.name ILIKE $5::text OR m.name ILIKE $5::text)
-GROUP BY e.id, m.id, e.public, pak.id, pak.url, pak.type, pak.mime, pak.size, pak.original_path, pak.hash, preview.id, preview.url, preview.type, preview.mime, preview.size, preview.original_path, preview.hash, owner.id, l2.value, w.id, e.updated_at, e.created_at, e.views
+GROUP BY e.id, m.id, e.public, pak.id, pak.url, pak.type, pak.mime, pak.size, pak.original_path, pak.hash, preview.id, preview.url, preview.type, preview.mime, preview.size, preview.original_path, preview.hash, owner.id, l2.value, w.id, e.updated_at, e.created_at, e.views, r.total_likes, r.total_dislikes
 ORDER BY e.updated_at DESC, e.created_at DESC, e.id`
 
 	var rows pgx.Rows
@@ -2132,19 +2132,19 @@ WHERE (e.public OR a.can_view OR a.is_owner)`
 	preview.size			previewSize,
 	owner.name 				ownerName,
 	l2.value				liked,
-	sum(case when l.value >= 0 then l.value end) as total_likes,
-	sum(case when l.value < 0 then l.value end) as total_dislikes,
+	r.total_likes,
+	r.total_dislikes,
 	e.views
 FROM spaces w
     LEFT JOIN entities e ON w.id = e.id
-	LEFT JOIN likables l ON l.entity_id = e.id
+	LEFT JOIN entity_ratings r ON r.entity_id = e.id
     LEFT JOIN likables l2 ON l2.entity_id = e.id AND l2.user_id = $1
 	LEFT JOIN mods m ON w.mod_id = m.id
 	LEFT JOIN files preview ON e.id = preview.entity_id AND preview.type = 'image_preview'
 	LEFT JOIN accessibles a ON e.id = a.entity_id
 	LEFT JOIN users owner ON owner.id = a.user_id
 WHERE (e.public OR a.can_view OR a.is_owner)
-GROUP BY e.id, w.id, e.public, preview.id, preview.url, preview.type, preview.mime, preview.size, owner.name, l2.value, e.updated_at, e.created_at, e.views
+GROUP BY e.id, w.id, e.public, preview.id, preview.url, preview.type, preview.mime, preview.size, owner.name, l2.value, e.updated_at, e.created_at, e.views, r.total_likes, r.total_dislikes
 ORDER BY e.updated_at DESC, e.created_at DESC, e.id`
 
 	var (
@@ -2354,20 +2354,20 @@ WHERE (e.public OR a.can_view OR a.is_owner)`
 	preview.hash			previewHash,
 	owner.name 				ownerName,
 	l2.value				liked,
-	sum(case when l.value >= 0 then l.value end) as total_likes,
-	sum(case when l.value < 0 then l.value end) as total_dislikes,
+	r.total_likes,
+	r.total_dislikes,
 	e.views
 FROM spaces w
     LEFT JOIN entities e ON w.id = e.id
 	LEFT JOIN mods m ON w.mod_id = m.id
-	LEFT JOIN likables l ON l.entity_id = e.id
+	LEFT JOIN entity_ratings r ON r.entity_id = e.id
     LEFT JOIN likables l2 ON l2.entity_id = e.id AND l2.user_id = $1
-	LEFT JOIN files pak ON pak.entity_id = m.id AND ((pak.platform = $2::text AND pak.deployment_type = $3::text) OR (pak.platform = '' AND pak.deployment_type = ''))
+	LEFT JOIN files pak ON (pak.entity_id = coalesce(w.mod_version_id, package_latest_version(m.id, $2::text, $3::text), m.id) AND pak.platform = $2::text AND pak.deployment_type = $3::text) OR (pak.entity_id = m.id AND pak.platform = '' AND pak.deployment_type = '')
 	LEFT JOIN files preview ON e.id = preview.entity_id AND preview.type = 'image_preview'
 	LEFT JOIN accessibles a ON e.id = a.entity_id
 	LEFT JOIN users owner ON owner.id = a.user_id
 WHERE (e.public OR a.can_view OR a.is_owner)
-GROUP BY e.id, w.id, m.id, e.public, pak.id, pak.url, pak.type, pak.mime, pak.size, pak.original_path, pak.hash, preview.id, preview.url, preview.type, preview.mime, preview.size, preview.original_path, preview.hash, owner.name, l2.value, e.updated_at, e.created_at, e.views
+GROUP BY e.id, w.id, m.id, e.public, pak.id, pak.url, pak.type, pak.mime, pak.size, pak.original_path, pak.hash, preview.id, preview.url, preview.type, preview.mime, preview.size, preview.original_path, preview.hash, owner.name, l2.value, e.updated_at, e.created_at, e.views, r.total_likes, r.total_dislikes
 ORDER BY e.updated_at DESC, e.created_at DESC, e.id`
 
 	var rows pgx.Rows
@@ -2621,19 +2621,19 @@ WHERE w.mod_id = $2 AND (e.public OR a.can_view OR a.is_owner)`
 	preview.size			previewSize,
 	owner.name 				ownerName,
 	l2.value				liked,
-	sum(case when l.value >= 0 then l.value end) as total_likes,
-	sum(case when l.value < 0 then l.value end) as total_dislikes,
+	r.total_likes,
+	r.total_dislikes,
 	e.views
 FROM spaces w
     LEFT JOIN entities e ON w.id = e.id
-	LEFT JOIN likables l ON l.entity_id = e.id
+	LEFT JOIN entity_ratings r ON r.entity_id = e.id
     LEFT JOIN likables l2 ON l2.entity_id = e.id AND l2.user_id = $1
 	LEFT JOIN mods m ON w.mod_id = m.id
 	LEFT JOIN files preview ON e.id = preview.entity_id AND preview.type = 'image_preview'
 	LEFT JOIN accessibles a on e.id = a.entity_id
 	LEFT JOIN users owner ON owner.id = a.user_id
 WHERE w.mod_id = $2
-GROUP BY e.id, w.id, e.public, preview.id, preview.url, preview.type, preview.mime, preview.size, owner.name, l2.value, e.updated_at, e.created_at, e.views
+GROUP BY e.id, w.id, e.public, preview.id, preview.url, preview.type, preview.mime, preview.size, owner.name, l2.value, e.updated_at, e.created_at, e.views, r.total_likes, r.total_dislikes
 ORDER BY e.updated_at DESC, e.created_at DESC, e.id`
 
 	var rows pgx.Rows
@@ -2826,20 +2826,20 @@ WHERE w.mod_id = $1 AND (e.public OR a.can_view OR a.is_owner)`
 	preview.hash			previewHash,	
 	owner.name 				ownerName,
 	l2.value				liked,
-	sum(case when l.value >= 0 then l.value end) as total_likes,
-	sum(case when l.value < 0 then l.value end) as total_dislikes,
+	r.total_likes,
+	r.total_dislikes,
 	e.views
 FROM spaces w
     LEFT JOIN entities e ON w.id = e.id
-	LEFT JOIN likables l ON l.entity_id = e.id
+	LEFT JOIN entity_ratings r ON r.entity_id = e.id
     LEFT JOIN likables l2 ON l2.entity_id = e.id AND l2.user_id = $1
 	LEFT JOIN mods m ON w.mod_id = m.id
-	LEFT JOIN files pak ON pak.entity_id = m.id AND ((pak.platform = $2::text AND pak.deployment_type = $3::text) OR (pak.platform = '' AND pak.deployment_type = ''))
+	LEFT JOIN files pak ON (pak.entity_id = coalesce(w.mod_version_id, package_latest_version(m.id, $2::text, $3::text), m.id) AND pak.platform = $2::text AND pak.deployment_type = $3::text) OR (pak.entity_id = m.id AND pak.platform = '' AND pak.deployment_type = '')
 	LEFT JOIN files preview ON e.id = preview.entity_id AND preview.type = 'image_preview'
 	LEFT JOIN accessibles a ON e.id = a.entity_id
 	LEFT JOIN users owner ON owner.id = a.user_id
 WHERE w.mod_id = $4 AND (e.public OR a.can_view OR a.is_owner)
-GROUP BY e.id, w.id, m.id, e.public, pak.id, pak.url, pak.type, pak.mime, pak.size, pak.original_path, pak.hash, preview.id, preview.url, preview.type, preview.mime, preview.size, preview.original_path, preview.hash, owner.name, l2.value, e.updated_at, e.created_at, e.views
+GROUP BY e.id, w.id, m.id, e.public, pak.id, pak.url, pak.type, pak.mime, pak.size, pak.original_path, pak.hash, preview.id, preview.url, preview.type, preview.mime, preview.size, preview.original_path, preview.hash, owner.name, l2.value, e.updated_at, e.created_at, e.views, r.total_likes, r.total_dislikes
 ORDER BY e.updated_at DESC, e.created_at DESC, e.id`
 
 	var rows pgx.Rows
@@ -3093,19 +3093,19 @@ WHERE (w.name ILIKE $1::text OR m.name ILIKE $1::text) AND (e.public OR a.can_vi
 	preview.size			previewSize,
 	owner.name 				ownerName,
 	l2.value				liked,
-	sum(case when l.value >= 0 then l.value end) as total_likes,
-	sum(case when l.value < 0 then l.value end) as total_dislikes,
+	r.total_likes,
+	r.total_dislikes,
 	e.views
 FROM spaces w
     LEFT JOIN entities e ON w.id = e.id
-	LEFT JOIN likables l ON l.entity_id = e.id
+	LEFT JOIN entity_ratings r ON r.entity_id = e.id
     LEFT JOIN likables l2 ON l2.entity_id = e.id AND l2.user_id = $1
 	LEFT JOIN mods m ON w.mod_id = m.id
 	LEFT JOIN files preview ON e.id = preview.entity_id AND preview.type = 'image_preview'
 	LEFT JOIN accessibles a ON e.id = a.entity_id
 	LEFT JOIN users owner ON owner.id = a.user_id
 WHERE (w.name ILIKE $2::text OR m.name ILIKE $2::text) AND (e.public OR a.can_view OR a.is_owner)
-GROUP BY e.id, w.id, e.public, preview.id, preview.url, preview.type, preview.mime, preview.size, owner.name, l2.value, e.updated_at, e.created_at, e.views
+GROUP BY e.id, w.id, e.public, preview.id, preview.url, preview.type, preview.mime, preview.size, owner.name, l2.value, e.updated_at, e.created_at, e.views, r.total_likes, r.total_dislikes
 ORDER BY e.updated_at DESC, e.created_at DESC, e.id`
 
 	var rows pgx.Rows
@@ -3299,20 +3299,20 @@ WHERE (w.name ILIKE $1::text OR m.name ILIKE $1::text) AND (e.public OR a.can_vi
 	preview.hash			previewHash,
 	owner.name 				ownerName,
 	l2.value				liked,
-	sum(case when l.value >= 0 then l.value end) as total_likes,
-	sum(case when l.value < 0 then l.value end) as total_dislikes,
+	r.total_likes,
+	r.total_dislikes,
 	e.views
 FROM spaces w
     LEFT JOIN entities e ON w.id = e.id
-	LEFT JOIN likables l ON l.entity_id = e.id
+	LEFT JOIN entity_ratings r ON r.entity_id = e.id
     LEFT JOIN likables l2 ON l2.entity_id = e.id AND l2.user_id = $1
 	LEFT JOIN mods m ON w.mod_id = m.id
-	LEFT JOIN files pak ON pak.entity_id = m.id AND ((pak.platform = $2::text AND pak.deployment_type = $3::text) OR (pak.platform = '' AND pak.deployment_type = ''))
+	LEFT JOIN files pak ON (pak.entity_id = coalesce(w.mod_version_id, package_latest_version(m.id, $2::text, $3::text), m.id) AND pak.platform = $2::text AND pak.deployment_type = $3::text) OR (pak.entity_id = m.id AND pak.platform = '' AND pak.deployment_type = '')
 	LEFT JOIN files preview ON e.id = preview.entity_id AND preview.type = 'image_preview'
 	LEFT JOIN accessibles a ON e.id = a.entity_id
 	LEFT JOIN users owner ON owner.id = a.user_id
 WHERE (w.name ILIKE $4::text OR m.name ILIKE $4::text)
-GROUP BY e.id, w.id, m.id, e.public, pak.id, pak.url, pak.type, pak.mime, pak.size, pak.original_path, pak.hash, preview.id, preview.url, preview.type, preview.mime, preview.size, preview.original_path, preview.hash, owner.name, l2.value, e.updated_at, e.created_at, e.views
+GROUP BY e.id, w.id, m.id, e.public, pak.id, pak.url, pak.type, pak.mime, pak.size, pak.original_path, pak.hash, preview.id, preview.url, preview.type, preview.mime, preview.size, preview.original_path, preview.hash, owner.name, l2.value, e.updated_at, e.created_at, e.views, r.total_likes, r.total_dislikes
 ORDER BY e.updated_at DESC, e.created_at DESC, e.id`
 
 	var rows pgx.Rows
@@ -3566,19 +3566,19 @@ WHERE w.mod_id = $1 AND (w.name ILIKE $2::text OR m.name ILIKE $2::text) AND (e.
 	preview.size			previewSize,
 	owner.name 				ownerName,
 	l2.value				liked,
-	sum(case when l.value >= 0 then l.value end) as total_likes,
-	sum(case when l.value < 0 then l.value end) as total_dislikes,
+	r.total_likes,
+	r.total_dislikes,
 	e.views
 FROM spaces w
     LEFT JOIN entities e ON w.id = e.id
-	LEFT JOIN likables l ON l.entity_id = e.id
+	LEFT JOIN entity_ratings r ON r.entity_id = e.id
     LEFT JOIN likables l2 ON l2.entity_id = e.id AND l2.user_id = $1
 	LEFT JOIN mods m ON w.mod_id = m.id
 	LEFT JOIN files preview ON e.id = preview.entity_id AND preview.type = 'image_preview'
 	LEFT JOIN accessibles a ON e.id = a.entity_id
 	LEFT JOIN users owner ON owner.id = a.user_id
 WHERE w.mod_id = $2 AND (w.name ILIKE $3::text OR m.name ILIKE $3::text)
-GROUP BY e.id, w.id, e.public, preview.id, preview.url, preview.type, preview.mime, preview.size, owner.name, l2.value, e.updated_at, e.created_at, e.views
+GROUP BY e.id, w.id, e.public, preview.id, preview.url, preview.type, preview.mime, preview.size, owner.name, l2.value, e.updated_at, e.created_at, e.views, r.total_likes, r.total_dislikes
 ORDER BY e.updated_at DESC, e.created_at DESC, e.id`
 
 	var rows pgx.Rows
@@ -3772,20 +3772,20 @@ WHERE w.mod_id = $1 AND (w.name ILIKE $2::text OR m.name ILIKE $2::text) AND (e.
 	preview.hash			previewHash,
 	owner.name 				ownerName,
 	l2.value				liked,
-	sum(case when l.value >= 0 then l.value end) as total_likes,
-	sum(case when l.value < 0 then l.value end) as total_dislikes,
+	r.total_likes,
+	r.total_dislikes,
 	e.views
 FROM spaces w
     LEFT JOIN entities e ON w.id = e.id
-	LEFT JOIN likables l ON l.entity_id = e.id
+	LEFT JOIN entity_ratings r ON r.entity_id = e.id
     LEFT JOIN likables l2 ON l2.entity_id = e.id AND l2.user_id = $1
 	LEFT JOIN mods m ON w.mod_id = m.id
-	LEFT JOIN files pak ON pak.entity_id = m.id AND ((pak.platform = $2::text AND pak.deployment_type = $3::text) OR (pak.platform = '' AND pak.deployment_type = ''))
+	LEFT JOIN files pak ON (pak.entity_id = coalesce(w.mod_version_id, package_latest_version(m.id, $2::text, $3::text), m.id) AND pak.platform = $2::text AND pak.deployment_type = $3::text) OR (pak.entity_id = m.id AND pak.platform = '' AND pak.deployment_type = '')
 	LEFT JOIN files preview ON e.id = preview.entity_id AND preview.type = 'image_preview'
 	LEFT JOIN accessibles a ON e.id = a.entity_id
 	LEFT JOIN users owner ON owner.id = a.user_id
 WHERE w.mod_id = $4 AND (w.name ILIKE $5::text OR m.name ILIKE $5::text) AND (e.public OR a.can_view OR a.is_owner)
-GROUP BY e.id, w.id, m.id, e.public, pak.id, pak.url, pak.type, pak.mime, pak.size, pak.original_path, pak.hash, preview.id, preview.url, preview.type, preview.mime, preview.size, preview.original_path, preview.hash, owner.name, l2.value, e.updated_at, e.created_at, e.views
+GROUP BY e.id, w.id, m.id, e.public, pak.id, pak.url, pak.type, pak.mime, pak.size, pak.original_path, pak.hash, preview.id, preview.url, preview.type, preview.mime, preview.size, preview.original_path, preview.hash, owner.name, l2.value, e.updated_at, e.created_at, e.views, r.total_likes, r.total_dislikes
 ORDER BY e.updated_at DESC, e.created_at DESC, e.id`
 
 	var rows pgx.Rows
@@ -4039,21 +4039,21 @@ func GetWorldForAdminWithPak(ctx context.Context, requester *sm.User, id uuid.UU
 	owner.id 			ownerId,
 	owner.name 			ownerName,
 	l2.value				liked,
-	sum(case when l.value >= 0 then l.value end) as total_likes,
-	sum(case when l.value < 0 then l.value end) as total_dislikes,
+	r.total_likes,
+	r.total_dislikes,
 	e.views
 FROM spaces w
 	LEFT JOIN entities e on w.id = e.id
-    LEFT JOIN likables l ON l.entity_id = e.id
+    LEFT JOIN entity_ratings r ON r.entity_id = e.id
     LEFT JOIN likables l2 ON l2.entity_id = e.id AND l2.user_id = $1
 	LEFT JOIN accessibles a ON a.entity_id = e.id
 	LEFT JOIN users owner ON owner.id = a.user_id
-	LEFT JOIN files f ON e.id = f.entity_id 
+	LEFT JOIN files f ON e.id = f.entity_id AND f.derivative_of IS NULL
     LEFT JOIN mods m ON m.id = w.mod_id 
 	LEFT JOIN entities me ON me.id = m.id
-	LEFT JOIN files pak ON me.id = pak.entity_id AND ((pak.platform = $2::text AND pak.deployment_type = $3::text) OR (pak.platform = '' AND pak.deployment_type = ''))
+	LEFT JOIN files pak ON (pak.entity_id = coalesce(w.mod_version_id, package_latest_version(m.id, $2::text, $3::text), m.id) AND pak.platform = $2::text AND pak.deployment_type = $3::text) OR (pak.entity_id = m.id AND pak.platform = '' AND pak.deployment_type = '')
 WHERE w.id = $4
-GROUP BY e.id, w.id, m.id, f.id, f.url, f.type, f.mime, f.size, f.original_path, f.hash, e.public, pak.id, pak.url, pak.type, pak.mime, pak.size, pak.original_path, pak.hash, owner.id, l2.value, e.views
+GROUP BY e.id, w.id, m.id, f.id, f.url, f.type, f.mime, f.size, f.original_path, f.hash, e.public, pak.id, pak.url, pak.type, pak.mime, pak.size, pak.original_path, pak.hash, owner.id, l2.value, e.views, r.total_likes, r.total_dislikes
 ORDER BY e.id`
 
 	var (
@@ -4303,18 +4303,18 @@ func GetWorldForAdmin(ctx context.Context, requester *sm.User, id uuid.UUID) (en
 	owner.id 			ownerId,
 	owner.name 			ownerName,
 	l2.value				liked,
-	sum(case when l.value >= 0 then l.value end) as total_likes,
-	sum(case when l.value < 0 then l.value end) as total_dislikes,
+	r.total_likes,
+	r.total_dislikes,
 	e.views
 FROM spaces w
 	LEFT JOIN entities e on w.id = e.id
-    LEFT JOIN likables l ON l.entity_id = e.id
+    LEFT JOIN entity_ratings r ON r.entity_id = e.id
     LEFT JOIN likables l2 ON l2.entity_id = e.id AND l2.user_id = $1
     LEFT JOIN accessibles a ON a.entity_id = e.id
 	LEFT JOIN users owner ON owner.id = a.user_id
-    LEFT JOIN files f ON e.id = f.entity_id
+    LEFT JOIN files f ON e.id = f.entity_id AND f.derivative_of IS NULL
 WHERE w.id = $2
-GROUP BY e.id, w.id, e.public, f.id, f.url, f.type, f.mime, f.size, owner.id, l2.value, e.views
+GROUP BY e.id, w.id, e.public, f.id, f.url, f.type, f.mime, f.size, owner.id, l2.value, e.views, r.total_likes, r.total_dislikes
 ORDER BY e.id`
 
 	var (
@@ -4493,21 +4493,21 @@ func GetWorldForRequesterWithPak(ctx context.Context, requester *sm.User, id uui
 	f.hash			previewHash,
 	owner.name 		ownerName,
 	l2.value				liked,
-	sum(case when l.value >= 0 then l.value end) as total_likes,
-	sum(case when l.value < 0 then l.value end) as total_dislikes,
+	r.total_likes,
+	r.total_dislikes,
 	e.views
 FROM spaces w
 	LEFT JOIN entities e on w.id = e.id
-	LEFT JOIN likables l ON l.entity_id = e.id
+	LEFT JOIN entity_ratings r ON r.entity_id = e.id
     LEFT JOIN likables l2 ON l2.entity_id = e.id AND l2.user_id = $1
 	LEFT JOIN accessibles a ON e.id = a.entity_id
 	LEFT JOIN users owner ON owner.id = a.user_id
-    LEFT JOIN files f ON w.id = f.entity_id
+    LEFT JOIN files f ON w.id = f.entity_id AND f.derivative_of IS NULL
     LEFT JOIN mods m ON m.id = w.mod_id 
 	LEFT JOIN entities me ON me.id = m.id
-	LEFT JOIN files pak ON me.id = pak.entity_id AND ((pak.platform = $2::text AND pak.deployment_type = $3::text) OR (pak.platform = '' AND pak.deployment_type = ''))
+	LEFT JOIN files pak ON (pak.entity_id = coalesce(w.mod_version_id, package_latest_version(m.id, $2::text, $3::text), m.id) AND pak.platform = $2::text AND pak.deployment_type = $3::text) OR (pak.entity_id = m.id AND pak.platform = '' AND pak.deployment_type = '')
 WHERE w.id = $4
-GROUP BY e.id, w.id, m.id, e.public, pak.id, pak.url, pak.type, pak.mime, pak.size, pak.original_path, pak.hash, f.id, f.url, f.type, f.mime, f.size, f.original_path, f.hash, owner.name, l2.value, e.views
+GROUP BY e.id, w.id, m.id, e.public, pak.id, pak.url, pak.type, pak.mime, pak.size, pak.original_path, pak.hash, f.id, f.url, f.type, f.mime, f.size, f.original_path, f.hash, owner.name, l2.value, e.views, r.total_likes, r.total_dislikes
 ORDER BY e.id`
 
 	var (
@@ -4751,18 +4751,18 @@ func GetWorldForRequester(ctx context.Context, requester *sm.User, id uuid.UUID)
 	f.size					fSize,
 	owner.name 				ownerName,
 	l2.value				liked,
-	sum(case when l.value >= 0 then l.value end) as total_likes,
-	sum(case when l.value < 0 then l.value end) as total_dislikes,
+	r.total_likes,
+	r.total_dislikes,
 	e.views
 FROM spaces w
 	LEFT JOIN entities e on w.id = e.id
-	LEFT JOIN likables l ON l.entity_id = e.id
+	LEFT JOIN entity_ratings r ON r.entity_id = e.id
     LEFT JOIN likables l2 ON l2.entity_id = e.id AND l2.user_id = $1
-    LEFT JOIN files f ON w.id = f.entity_id
+    LEFT JOIN files f ON w.id = f.entity_id AND f.derivative_of IS NULL
 	LEFT JOIN accessibles a ON e.id = a.entity_id
 	LEFT JOIN users owner ON owner.id = a.user_id
 WHERE w.id = $2
-GROUP BY e.id, w.id, e.public, f.id, f.url, f.type, f.mime, f.size, owner.name, l2.value, e.views
+GROUP BY e.id, w.id, e.public, f.id, f.url, f.type, f.mime, f.size, owner.name, l2.value, e.views, r.total_likes, r.total_dislikes
 ORDER BY e.id`
 
 	var (
@@ -4943,20 +4943,20 @@ func GetLatestWorldForAdminWithPak(ctx context.Context, requester *sm.User, plat
 	owner.id 				ownerId,
 	owner.name 				ownerName,
 	l2.value				liked,
-	sum(case when l.value >= 0 then l.value end) as total_likes,
-	sum(case when l.value < 0 then l.value end) as total_dislikes,
+	r.total_likes,
+	r.total_dislikes,
 	e.views
 FROM spaces w
 	LEFT JOIN entities e on w.id = e.id
-	LEFT JOIN likables l ON l.entity_id = e.id
+	LEFT JOIN entity_ratings r ON r.entity_id = e.id
     LEFT JOIN likables l2 ON l2.entity_id = e.id AND l2.user_id = $1
 	LEFT JOIN accessibles a ON a.entity_id = e.id
 	LEFT JOIN users owner ON owner.id = a.user_id
-	LEFT JOIN files f ON e.id = f.entity_id 
+	LEFT JOIN files f ON e.id = f.entity_id AND f.derivative_of IS NULL
     LEFT JOIN mods m ON m.id = w.mod_id 
 	LEFT JOIN entities me ON me.id = m.id
-	LEFT JOIN files pak ON me.id = pak.entity_id AND ((pak.platform = $2::text AND pak.deployment_type = $3::text) OR (pak.platform = '' AND pak.deployment_type = ''))
-GROUP BY w.id, w.name, w.description, w.map, w.game_mode, m.id, m.name, m.title, e.public, pak.id, pak.url, pak.type, pak.mime, pak.size, pak.original_path, pak.hash, f.id, f.url, f.type, f.mime, f.size, f.original_path, f.hash, owner.id, owner.name, l2.value, e.created_at, e.views
+	LEFT JOIN files pak ON (pak.entity_id = coalesce(w.mod_version_id, package_latest_version(m.id, $2::text, $3::text), m.id) AND pak.platform = $2::text AND pak.deployment_type = $3::text) OR (pak.entity_id = m.id AND pak.platform = '' AND pak.deployment_type = '')
+GROUP BY w.id, w.name, w.description, w.map, w.game_mode, m.id, m.name, m.title, e.public, pak.id, pak.url, pak.type, pak.mime, pak.size, pak.original_path, pak.hash, f.id, f.url, f.type, f.mime, f.size, f.original_path, f.hash, owner.id, owner.name, l2.value, e.created_at, e.views, r.total_likes, r.total_dislikes
 ORDER BY e.created_at DESC`
 
 	var (
@@ -5500,3 +5500,251 @@ func UpdateWorldForRequester(ctx context.Context, requester *sm.User, id uuid.UU
 
 	return e, nil
 }
+
+// IndexWorldsTrendingForAdmin Index worlds ordered by the trending score for admin, optionally filtered by package and query
+func IndexWorldsTrendingForAdmin(ctx context.Context, requester *sm.User, packageId uuid.UUID, offset int64, limit int64, query string, platform string, deployment string) (entities []World, total int64, err error) {
+	return indexWorldsTrending(ctx, requester, trendingVisibilityForAdmin, packageId, offset, limit, query, platform, deployment)
+}
+
+// IndexWorldsTrendingForRequester Index worlds visible to the requester ordered by the trending score, optionally filtered by package and query
+func IndexWorldsTrendingForRequester(ctx context.Context, requester *sm.User, packageId uuid.UUID, offset int64, limit int64, query string, platform string, deployment string) (entities []World, total int64, err error) {
+	return indexWorldsTrending(ctx, requester, trendingVisibilityForRequester, packageId, offset, limit, query, platform, deployment)
+}
+
+func indexWorldsTrending(ctx context.Context, requester *sm.User, visibility string, packageId uuid.UUID, offset int64, limit int64, query string, platform string, deployment string) (entities []World, total int64, err error) {
+	db := database.DB
+
+	var pkgId *uuid.UUID
+	if !packageId.IsNil() {
+		pkgId = &packageId
+	}
+
+	q := `SELECT COUNT(*)
+FROM spaces w
+    LEFT JOIN entities e ON e.id = w.id
+    LEFT JOIN mods m ON w.mod_id = m.id
+WHERE ` + visibility + ` AND ($2::uuid IS NULL OR w.mod_id = $2::uuid) AND ($3::text = '' OR w.name ILIKE $3::text OR m.name ILIKE $3::text)`
+
+	row := db.QueryRow(ctx, q, requester.Id /*$1*/, pkgId /*$2*/, query /*$3*/)
+
+	err = row.Scan(&total)
+	if err != nil {
+		return nil, -1, fmt.Errorf("failed to scan total @ %s: %v", reflect.FunctionName(), err)
+	}
+
+	q = `WITH t AS (SELECT w.id, coalesce(r.trending_score, 0) score
+	FROM spaces w
+		LEFT JOIN entities e ON e.id = w.id
+		LEFT JOIN mods m ON w.mod_id = m.id
+		LEFT JOIN entity_ratings r ON r.entity_id = w.id
+	WHERE ` + visibility + ` AND ($4::uuid IS NULL OR w.mod_id = $4::uuid) AND ($5::text = '' OR w.name ILIKE $5::text OR m.name ILIKE $5::text)
+	ORDER BY score DESC, e.updated_at DESC, w.id
+	OFFSET $6 LIMIT $7)
+SELECT 
+	w.id                    worldId,
+	w.name                  worldName,
+	w.description           worldDescription,
+	w.map                   worldMap,
+	w.game_mode             worldGameMode,
+	m.id					modId,
+	m.name					modName,
+	m.title					modTitle,
+	e.public                entityPublic,
+	pak.id                  pakId,
+	pak.url                 pakUrl,
+	pak.type                pakType,
+	pak.mime            	pakMime,
+	pak.size				pakSize,
+	pak.original_path		pakOriginalPath,
+	pak.hash				pakHash,
+	preview.id              previewId,
+	preview.url             previewUrl,
+	preview.type            previewType,
+	preview.mime        	previewMime,
+	preview.size			previewSize,
+	preview.original_path	previewOriginalPath,
+	preview.hash			previewHash,
+	owner.name 				ownerName,
+	l2.value				liked,
+	r.total_likes,
+	r.total_dislikes,
+	e.views
+FROM t
+	LEFT JOIN spaces w ON w.id = t.id
+    LEFT JOIN entities e ON w.id = e.id
+	LEFT JOIN mods m ON w.mod_id = m.id
+	LEFT JOIN entity_ratings r ON r.entity_id = e.id
+    LEFT JOIN likables l2 ON l2.entity_id = e.id AND l2.user_id = $1
+	LEFT JOIN files pak ON (pak.entity_id = coalesce(w.mod_version_id, package_latest_version(m.id, $2::text, $3::text), m.id) AND pak.platform = $2::text AND pak.deployment_type = $3::text) OR (pak.entity_id = m.id AND pak.platform = '' AND pak.deployment_type = '')
+	LEFT JOIN files preview ON e.id = preview.entity_id AND preview.type = 'image_preview'
+	LEFT JOIN accessibles oa ON e.id = oa.entity_id AND oa.is_owner
+	LEFT JOIN users owner ON owner.id = oa.user_id
+ORDER BY t.score DESC, e.updated_at DESC, w.id`
+
+	var rows pgx.Rows
+	rows, err = db.Query(ctx, q, requester.Id /*$1*/, platform /*$2*/, deployment /*$3*/, pkgId /*$4*/, query /*$5*/, offset /*$6*/, limit /*$7*/)
+	if err != nil {
+		return nil, -1, fmt.Errorf("failed to query %s @ %s: %v", worldPlural, reflect.FunctionName(), err)
+	}
+
+	defer func() {
+		rows.Close()
+		database.LogPgxStat("IndexWorldsTrending")
+	}()
+	for rows.Next() {
+		var (
+			id               pgtypeuuid.UUID
+			name             *string
+			description      *string
+			mapName          *string
+			gameMode         *string
+			modId            *uuid.UUID
+			modName          *string
+			modTitle         *string
+			public           *bool
+			pakId            pgtypeuuid.UUID
+			pakUrl           *string
+			pakType          *string
+			pakMime          *string
+			pakSize          *int64
+			pakOriginalPath  *string
+			pakHash          *string
+			fileId           pgtypeuuid.UUID
+			fileUrl          *string
+			fileType         *string
+			fileMime         *string
+			fileSize         *int64
+			fileOriginalPath *string
+			fileHash         *string
+			ownerName        *string
+			liked            *int32
+			totalLikes       *int32
+			totalDislikes    *int32
+			views            *int32
+		)
+
+		err = rows.Scan(&id, &name, &description, &mapName, &gameMode, &modId, &modName, &modTitle, &public,
+			&pakId, &pakUrl, &pakType, &pakMime, &pakSize, &pakOriginalPath, &pakHash,
+			&fileId, &fileUrl, &fileType, &fileMime, &fileSize, &fileOriginalPath, &fileHash,
+			&ownerName, &liked, &totalLikes, &totalDislikes, &views)
+		if err != nil {
+			return nil, -1, fmt.Errorf("failed to scan %s @ %s: %v", worldSingular, reflect.FunctionName(), err)
+		}
+
+		if id.Status == pgtype.Null {
+			continue
+		}
+
+		var file *File
+		if fileId.Status != pgtype.Null {
+			file = new(File)
+			file.Id = &fileId.UUID
+			if fileType != nil {
+				file.Type = *fileType
+			}
+			if fileMime != nil {
+				file.Mime = fileMime
+			}
+			if fileUrl != nil {
+				file.Url = *fileUrl
+			}
+			if fileSize != nil {
+				file.Size = fileSize
+			}
+			if fileOriginalPath != nil && *fileOriginalPath != "" {
+				file.OriginalPath = fileOriginalPath
+			}
+			if fileHash != nil && *fileHash != "" {
+				file.Hash = fileHash
+			}
+		}
+
+		var pak *File
+		if pakId.Status != pgtype.Null {
+			pak = new(File)
+			pak.Id = &pakId.UUID
+			if pakType != nil {
+				pak.Type = *pakType
+			}
+			if pakMime != nil {
+				pak.Mime = pakMime
+			}
+			if pakUrl != nil {
+				pak.Url = *pakUrl
+			}
+			if pakSize != nil {
+				pak.Size = pakSize
+			}
+			if pakOriginalPath != nil && *pakOriginalPath != "" {
+				pak.OriginalPath = pakOriginalPath
+			}
+			if pakHash != nil && *pakHash != "" {
+				pak.Hash = pakHash
+			}
+		}
+
+		if i := findWorld(entities, id.UUID); i >= 0 {
+			if file != nil && !containsFile(entities[i].Files, *file.Id) {
+				entities[i].Files = append(entities[i].Files, *file)
+			}
+
+			if pak != nil && entities[i].Package != nil && !containsFile(entities[i].Package.Files, *pak.Id) {
+				entities[i].Package.Files = append(entities[i].Package.Files, *pak)
+			}
+			continue
+		}
+
+		var e World
+		e.Id = &id.UUID
+		e.Public = public
+		if name != nil {
+			e.Name = *name
+		}
+		if description != nil {
+			e.Description = *description
+		}
+		if gameMode != nil {
+			e.GameMode = *gameMode
+		}
+		if mapName != nil {
+			e.Map = *mapName
+		}
+		if file != nil {
+			e.Files = append(e.Files, *file)
+		}
+
+		if modId != nil {
+			e.Package = new(Package)
+			e.Package.Id = modId
+			if modName != nil {
+				e.Package.Name = *modName
+			}
+			if modTitle != nil {
+				e.Package.Title = *modTitle
+			}
+			if pak != nil {
+				e.Package.Files = append(e.Package.Files, *pak)
+			}
+		}
+
+		e.Owner = new(User)
+		e.Owner.Name = ownerName
+		e.Liked = liked
+
+		e.TotalLikes = new(int32)
+		if totalLikes != nil {
+			*e.TotalLikes = *totalLikes
+		}
+
+		e.TotalDislikes = new(int32)
+		if totalDislikes != nil {
+			*e.TotalDislikes = *totalDislikes
+		}
+
+		e.Views = views
+
+		entities = append(entities, e)
+	}
+
+	return entities, total, err
+}
@@ -0,0 +1,1094 @@
+package model
+
+import (
+	"archive/zip"
+	"context"
+	sm "dev.hackerman.me/artheon/veverse-shared/model"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gofrs/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/sirupsen/logrus"
+	"io"
+	"os"
+	"path"
+	"time"
+	"veverse-api/aws/s3"
+	"veverse-api/database"
+	"veverse-api/gltf"
+	"veverse-api/reflect"
+)
+
+const WorldBundleFormatVersion = 1
+
+var ErrInvalidWorldBundle = errors.New("invalid bundle")
+
+const (
+	worldBundleManifestName = "manifest.json"
+	worldBundleFilesDir     = "files"
+)
+
+const (
+	WorldBundleClassReuse  = "reuse"  // Existing classes with the same class path are used instead of the bundle classes (default)
+	WorldBundleClassCreate = "create" // Conflicting bundle classes are created as new classes
+	WorldBundleClassFail   = "fail"   // Conflicting bundle classes fail the import
+)
+
+// WorldBundleManifest is the manifest.json of the world bundle, file contents are stored as separate archive entries
+type WorldBundleManifest struct {
+	FormatVersion int                 `json:"formatVersion"`
+	ExportedAt    time.Time           `json:"exportedAt"`
+	World         WorldBundleWorld    `json:"world"`
+	Classes       []WorldBundleClass  `json:"classes"`
+	Objects       []WorldBundleObject `json:"objects"`
+	Portals       []WorldBundlePortal `json:"portals"`
+	Skipped       []string            `json:"skipped,omitempty"` // Files which contents could not be exported
+}
+
+type WorldBundleWorld struct {
+	Id          uuid.UUID               `json:"id"`
+	Name        string                  `json:"name"`
+	Description string                  `json:"description,omitempty"`
+	Map         string                  `json:"map,omitempty"`
+	GameMode    string                  `json:"gameMode,omitempty"`
+	Type        *string                 `json:"type,omitempty"`
+	Public      bool                    `json:"public"`
+	PackageId   *uuid.UUID              `json:"metaverseId,omitempty"` // Package reference, the package is not exported
+	Properties  []WorldSnapshotProperty `json:"properties"`
+	Files       []WorldBundleFile       `json:"files"`
+}
+
+// WorldBundleClass is the object class used by objects of the world
+type WorldBundleClass struct {
+	Id          uuid.UUID `json:"id"`
+	Class       string    `json:"class"`
+	Name        string    `json:"name,omitempty"`
+	Description string    `json:"description,omitempty"`
+	Category    string    `json:"category,omitempty"`
+	Public      bool      `json:"public"`
+}
+
+type WorldBundleObject struct {
+	Id               uuid.UUID               `json:"id"`
+	Public           bool                    `json:"public"`
+	EntityId         *uuid.UUID              `json:"entityId,omitempty"`
+	PlaceableClassId uuid.UUID               `json:"placeableClassId"`
+	OffsetX          float64                 `json:"offsetX"`
+	OffsetY          float64                 `json:"offsetY"`
+	OffsetZ          float64                 `json:"offsetZ"`
+	RotationX        float64                 `json:"rotationX"`
+	RotationY        float64                 `json:"rotationY"`
+	RotationZ        float64                 `json:"rotationZ"`
+	ScaleX           float64                 `json:"scaleX"`
+	ScaleY           float64                 `json:"scaleY"`
+	ScaleZ           float64                 `json:"scaleZ"`
+	Properties       []WorldSnapshotProperty `json:"properties"`
+	Files            []WorldBundleFile       `json:"files"`
+}
+
+type WorldBundlePortal struct {
+	Id            uuid.UUID  `json:"id"`
+	Name          string     `json:"name"`
+	Public        bool       `json:"public"`
+	DestinationId *uuid.UUID `json:"destinationId,omitempty"` // Portals outside the bundle are kept if they exist at the target
+}
+
+// WorldBundleFile is the file of the world or the object, stored files have the archive entry, links keep their url
+type WorldBundleFile struct {
+	Id           uuid.UUID      `json:"id"`
+	Type         string         `json:"type"`
+	Entry        string         `json:"entry,omitempty"`
+	Url          string         `json:"url,omitempty"`
+	Mime         *string        `json:"mime,omitempty"`
+	Size         *int64         `json:"size,omitempty"`
+	Deployment   string         `json:"deploymentType"`
+	Platform     string         `json:"platform"`
+	Variation    int            `json:"variation"`
+	OriginalPath *string        `json:"originalPath,omitempty"`
+	Hash         *string        `json:"hash,omitempty"`
+	Width        *int           `json:"width,omitempty"`
+	Height       *int           `json:"height,omitempty"`
+	Metadata     *gltf.Metadata `json:"metadata,omitempty"`
+}
+
+// WorldBundleImportOptions controls the import of the bundle
+type WorldBundleImportOptions struct {
+	DryRun        bool   `json:"dryRun,omitempty" query:"dryRun"`               // Validate the bundle without importing it
+	ClassConflict string `json:"classConflict,omitempty" query:"classConflict"` // reuse, create or fail
+}
+
+// WorldBundleClassResolution is the class used for the bundle class at the target
+type WorldBundleClassResolution struct {
+	Id         uuid.UUID  `json:"id"` // Bundle class
+	Class      string     `json:"class"`
+	Resolution string     `json:"resolution"`         // existing, reuse, create or conflict
+	TargetId   *uuid.UUID `json:"targetId,omitempty"` // Class used by imported objects
+}
+
+// WorldBundleImportReport is the validation report of the bundle and the result of the import
+type WorldBundleImportReport struct {
+	DryRun   bool                         `json:"dryRun"`
+	Valid    bool                         `json:"valid"`
+	WorldId  *uuid.UUID                   `json:"worldId,omitempty"` // Id of the imported world
+	Name     string                       `json:"name"`
+	Objects  int                          `json:"objects"`
+	Portals  int                          `json:"portals"`
+	Files    int                          `json:"files"`
+	Bytes    int64                        `json:"bytes"` // Size of the stored files
+	Classes  []WorldBundleClassResolution `json:"classes"`
+	Warnings []string                     `json:"warnings"`
+	Errors   []string                     `json:"errors"`
+}
+
+func (r *WorldBundleImportReport) warn(format string, args ...interface{}) {
+	r.Warnings = append(r.Warnings, fmt.Sprintf(format, args...))
+}
+
+func (r *WorldBundleImportReport) fail(format string, args ...interface{}) {
+	r.Errors = append(r.Errors, fmt.Sprintf(format, args...))
+	r.Valid = false
+}
+
+//region Export
+
+// getEntityBundleData returns properties and files of the entity
+func getEntityBundleData(ctx context.Context, tx pgx.Tx, entityId uuid.UUID) (properties []WorldSnapshotProperty, files []WorldSnapshotFile, err error) {
+	q := `SELECT pr.type, pr.name, pr.value FROM properties pr WHERE pr.entity_id = $1 ORDER BY pr.name`
+	rows, err := tx.Query(ctx, q, entityId /*$1*/)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to query %s: %v", propertyPlural, err)
+	}
+
+	properties = []WorldSnapshotProperty{}
+	for rows.Next() {
+		var p WorldSnapshotProperty
+		if err = rows.Scan(&p.Type, &p.Name, &p.Value); err != nil {
+			rows.Close()
+			return nil, nil, err
+		}
+		properties = append(properties, p)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	q = `SELECT f.id, f.type, f.url, f.mime, f.size, f.version, f.deployment_type, f.platform, f.variation, f.original_path, f.hash, f.blob_hash, f.uploaded_by, f.width, f.height, f.metadata, f.scan_status, f.created_at
+FROM files f
+WHERE f.entity_id = $1
+  AND f.derivative_of IS NULL
+ORDER BY f.type, f.platform, f.deployment_type, f.variation, f.original_path`
+	rows, err = tx.Query(ctx, q, entityId /*$1*/)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to query files: %v", err)
+	}
+	defer rows.Close()
+
+	files = []WorldSnapshotFile{}
+	for rows.Next() {
+		var f WorldSnapshotFile
+		err = rows.Scan(&f.Id, &f.Type, &f.Url, &f.Mime, &f.Size, &f.Version, &f.Deployment, &f.Platform, &f.Variation, &f.OriginalPath, &f.Hash, &f.BlobHash, &f.UploadedBy, &f.Width, &f.Height, &f.Metadata, &f.ScanStatus, &f.CreatedAt)
+		if err != nil {
+			return nil, nil, err
+		}
+		files = append(files, f)
+	}
+
+	return properties, files, rows.Err()
+}
+
+// getWorldBundleManifest Reads the world, its objects, classes and portals consistently, file contents are not read
+func getWorldBundleManifest(ctx context.Context, worldId uuid.UUID) (manifest *WorldBundleManifest, files map[uuid.UUID]WorldSnapshotFile, err error) {
+	db := database.DB
+
+	tx, err := db.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.RepeatableRead, AccessMode: pgx.ReadOnly})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to begin tx: %v", err)
+	}
+	defer func() {
+		_ = tx.Rollback(ctx)
+	}()
+
+	manifest = &WorldBundleManifest{FormatVersion: WorldBundleFormatVersion, ExportedAt: time.Now().UTC(), Classes: []WorldBundleClass{}, Objects: []WorldBundleObject{}, Portals: []WorldBundlePortal{}}
+	files = map[uuid.UUID]WorldSnapshotFile{}
+
+	//region World
+	w := &manifest.World
+	w.Id = worldId
+
+	q := `SELECT coalesce(s.name, ''), coalesce(s.description, ''), coalesce(s.map, ''), coalesce(s.game_mode, ''), s.type, coalesce(e.public, false), s.mod_id
+FROM spaces s
+    JOIN entities e ON e.id = s.id
+WHERE s.id = $1`
+	if err = tx.QueryRow(ctx, q, worldId /*$1*/).Scan(&w.Name, &w.Description, &w.Map, &w.GameMode, &w.Type, &w.Public, &w.PackageId); err != nil {
+		return nil, nil, err
+	}
+
+	properties, worldFiles, err := getEntityBundleData(ctx, tx, worldId)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	w.Properties = properties
+	w.Files = []WorldBundleFile{}
+	for _, f := range worldFiles {
+		files[f.Id] = f
+		w.Files = append(w.Files, newWorldBundleFile(f))
+	}
+	//endregion
+
+	//region Objects
+	layout, err := getWorldLayout(ctx, tx, worldId)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var classIds []uuid.UUID
+	for _, o := range layout {
+		b := WorldBundleObject{
+			Id:               o.Id,
+			Public:           o.Public,
+			EntityId:         o.EntityId,
+			PlaceableClassId: o.PlaceableClassId,
+			OffsetX:          o.OffsetX,
+			OffsetY:          o.OffsetY,
+			OffsetZ:          o.OffsetZ,
+			RotationX:        o.RotationX,
+			RotationY:        o.RotationY,
+			RotationZ:        o.RotationZ,
+			ScaleX:           o.ScaleX,
+			ScaleY:           o.ScaleY,
+			ScaleZ:           o.ScaleZ,
+			Properties:       o.Properties,
+			Files:            []WorldBundleFile{},
+		}
+		for _, f := range o.Files {
+			files[f.Id] = f
+			b.Files = append(b.Files, newWorldBundleFile(f))
+		}
+		manifest.Objects = append(manifest.Objects, b)
+		classIds = append(classIds, o.PlaceableClassId)
+	}
+	//endregion
+
+	//region Classes
+	q = `SELECT pc.id, coalesce(pc.cls, ''), coalesce(pc.name, ''), coalesce(pc.description, ''), coalesce(pc.category, ''), coalesce(e.public, false)
+FROM placeable_classes pc
+    LEFT JOIN entities e ON e.id = pc.id
+WHERE pc.id = ANY($1)
+ORDER BY pc.cls`
+	rows, err := tx.Query(ctx, q, classIds /*$1*/)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to query classes: %v", err)
+	}
+
+	for rows.Next() {
+		var c WorldBundleClass
+		if err = rows.Scan(&c.Id, &c.Class, &c.Name, &c.Description, &c.Category, &c.Public); err != nil {
+			rows.Close()
+			return nil, nil, err
+		}
+		manifest.Classes = append(manifest.Classes, c)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, nil, err
+	}
+	//endregion
+
+	//region Portals
+	q = `SELECT p.id, coalesce(p.name, ''), coalesce(e.public, false), p.destination_id
+FROM portals p
+    LEFT JOIN entities e ON e.id = p.id
+WHERE p.space_id = $1
+ORDER BY p.name, p.id`
+	rows, err = tx.Query(ctx, q, worldId /*$1*/)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to query %s: %v", portalPlural, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var p WorldBundlePortal
+		if err = rows.Scan(&p.Id, &p.Name, &p.Public, &p.DestinationId); err != nil {
+			return nil, nil, err
+		}
+		manifest.Portals = append(manifest.Portals, p)
+	}
+	//endregion
+
+	return manifest, files, rows.Err()
+}
+
+// newWorldBundleFile returns the bundle file, contents of files stored at the storage are exported as entries named by the hash so identical files are stored once
+func newWorldBundleFile(f WorldSnapshotFile) WorldBundleFile {
+	b := WorldBundleFile{
+		Id:           f.Id,
+		Type:         f.Type,
+		Mime:         f.Mime,
+		Size:         f.Size,
+		Deployment:   f.Deployment,
+		Platform:     f.Platform,
+		Variation:    f.Variation,
+		OriginalPath: f.OriginalPath,
+		Hash:         f.Hash,
+		Width:        f.Width,
+		Height:       f.Height,
+		Metadata:     f.Metadata,
+	}
+
+	// Files linked to external urls are referenced, their contents are not downloaded by the API
+	if !s3.IsStorageUrl(f.Url) {
+		b.Url = f.Url
+	} else if f.Hash != nil {
+		b.Entry = path.Join(worldBundleFilesDir, *f.Hash)
+	} else {
+		b.Entry = path.Join(worldBundleFilesDir, f.Id.String())
+	}
+
+	return b
+}
+
+// writeWorldBundleEntry Copies the file contents to the bundle
+func writeWorldBundleEntry(ctx context.Context, w *zip.Writer, f WorldSnapshotFile, name string) (started bool, err error) {
+	if err = CheckFileScanStatus(&File{ScanStatus: f.ScanStatus}); err != nil {
+		return false, err
+	}
+
+	body, err := openFileContents(ctx, f.Url)
+	if err != nil {
+		return false, err
+	}
+	defer body.Close()
+
+	header := &zip.FileHeader{Name: name, Method: zip.Deflate, Modified: f.CreatedAt}
+	if isCompressedMime(f.Mime) {
+		header.Method = zip.Store
+	}
+
+	entry, err := w.CreateHeader(header)
+	if err != nil {
+		return true, err
+	}
+
+	_, err = io.Copy(entry, body)
+	return true, err
+}
+
+// exportWorldBundle Writes the ZIP bundle with file entries followed by the manifest, files which contents can not be read are dropped from the manifest
+func exportWorldBundle(ctx context.Context, out io.Writer, worldId uuid.UUID) (manifest *WorldBundleManifest, err error) {
+	manifest, files, err := getWorldBundleManifest(ctx, worldId)
+	if err != nil {
+		return nil, err
+	}
+
+	w := zip.NewWriter(out)
+
+	written := map[string]bool{}
+	writeFiles := func(bundleFiles []WorldBundleFile) (kept []WorldBundleFile, err error) {
+		kept = []WorldBundleFile{}
+		for _, b := range bundleFiles {
+			if b.Entry != "" && !written[b.Entry] {
+				if err = ctx.Err(); err != nil {
+					return nil, err
+				}
+
+				started, err := writeWorldBundleEntry(ctx, w, files[b.Id], b.Entry)
+				if err != nil {
+					// Partially written entries can not be skipped
+					if started {
+						return nil, err
+					}
+					logrus.Warningf("failed to add file %s to the bundle of %s: %v", b.Id, worldId, err)
+					manifest.Skipped = append(manifest.Skipped, fmt.Sprintf("%s: %v", b.Id, err))
+					continue
+				}
+				written[b.Entry] = true
+			}
+			kept = append(kept, b)
+		}
+		return kept, nil
+	}
+
+	if manifest.World.Files, err = writeFiles(manifest.World.Files); err != nil {
+		return nil, err
+	}
+
+	for i := range manifest.Objects {
+		if manifest.Objects[i].Files, err = writeFiles(manifest.Objects[i].Files); err != nil {
+			return nil, err
+		}
+	}
+
+	entry, err := w.CreateHeader(&zip.FileHeader{Name: worldBundleManifestName, Method: zip.Deflate, Modified: manifest.ExportedAt})
+	if err != nil {
+		return nil, err
+	}
+
+	encoder := json.NewEncoder(entry)
+	encoder.SetIndent("", "  ")
+	if err = encoder.Encode(manifest); err != nil {
+		return nil, err
+	}
+
+	return manifest, w.Close()
+}
+
+// ExportWorldBundleForAdmin Writes the world bundle
+func ExportWorldBundleForAdmin(ctx context.Context, w io.Writer, worldId uuid.UUID) (manifest *WorldBundleManifest, err error) {
+	return exportWorldBundle(ctx, w, worldId)
+}
+
+// ExportWorldBundleForRequester Writes the world bundle if the requester can edit the world
+func ExportWorldBundleForRequester(ctx context.Context, w io.Writer, requester *sm.User, worldId uuid.UUID) (manifest *WorldBundleManifest, err error) {
+	canEdit, err := EntityEditable(ctx, requester.Id, worldId)
+	if err != nil {
+		return nil, err
+	}
+
+	if !canEdit {
+		return nil, errors.New("no access")
+	}
+
+	return exportWorldBundle(ctx, w, worldId)
+}
+
+// CheckWorldBundleAccess Checks if the world exists and the requester can export it, so errors are reported before the bundle is streamed
+func CheckWorldBundleAccess(ctx context.Context, requester *sm.User, worldId uuid.UUID) (err error) {
+	db := database.DB
+
+	q := `SELECT s.id FROM spaces s WHERE s.id = $1`
+	if err = db.QueryRow(ctx, q, worldId /*$1*/).Scan(&worldId); err != nil {
+		return err
+	}
+
+	if requester.IsAdmin || requester.IsInternal {
+		return nil
+	}
+
+	canEdit, err := EntityEditable(ctx, requester.Id, worldId)
+	if err != nil {
+		return err
+	}
+
+	if !canEdit {
+		return errors.New("no access")
+	}
+
+	return nil
+}
+
+//endregion
+
+//region Import
+
+// worldBundleImport is the validated bundle with ids of the imported entities
+type worldBundleImport struct {
+	manifest     *WorldBundleManifest
+	entries      map[string]*zip.File
+	ids          map[uuid.UUID]uuid.UUID         // Bundle ids of the world, objects, portals and files to the new ids
+	classes      map[uuid.UUID]uuid.UUID         // Bundle class ids to the target class ids
+	newClasses   []WorldBundleClass              // Classes to create with their target ids
+	references   map[uuid.UUID]bool              // Existing entities referenced from outside the bundle
+	sources      map[uuid.UUID]WorldSnapshotFile // Files of the cloned world, contents are copied from them instead of entries
+	hasPackageId bool
+}
+
+// remap returns the new id of the bundle entity or the existing entity, nil if the entity is neither in the bundle nor exists
+func (b *worldBundleImport) remap(id *uuid.UUID) *uuid.UUID {
+	if id == nil {
+		return nil
+	}
+
+	if newId, ok := b.ids[*id]; ok {
+		return &newId
+	}
+
+	if b.references[*id] {
+		return id
+	}
+
+	return nil
+}
+
+// resolveReferences Finds existing entities linked by objects and portals from outside the bundle
+func (b *worldBundleImport) resolveReferences(ctx context.Context) (err error) {
+	var references []uuid.UUID
+	for _, o := range b.manifest.Objects {
+		if o.EntityId != nil {
+			if _, ok := b.ids[*o.EntityId]; !ok {
+				references = append(references, *o.EntityId)
+			}
+		}
+	}
+	for _, p := range b.manifest.Portals {
+		if p.DestinationId != nil {
+			if _, ok := b.ids[*p.DestinationId]; !ok {
+				references = append(references, *p.DestinationId)
+			}
+		}
+	}
+
+	if len(references) == 0 {
+		return nil
+	}
+
+	db := database.DB
+
+	q := `SELECT e.id FROM entities e WHERE e.id = ANY($1)`
+	rows, err := db.Query(ctx, q, references /*$1*/)
+	if err != nil {
+		return fmt.Errorf("failed to query entities: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id uuid.UUID
+		if err = rows.Scan(&id); err != nil {
+			return err
+		}
+		b.references[id] = true
+	}
+
+	return rows.Err()
+}
+
+// readWorldBundleManifest Reads the manifest and indexes entries of the bundle
+func readWorldBundleManifest(r io.ReaderAt, size int64) (manifest *WorldBundleManifest, entries map[string]*zip.File, err error) {
+	archive, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrInvalidWorldBundle, err)
+	}
+
+	entries = map[string]*zip.File{}
+	for _, f := range archive.File {
+		entries[f.Name] = f
+	}
+
+	m, ok := entries[worldBundleManifestName]
+	if !ok {
+		return nil, nil, fmt.Errorf("%w: no %s", ErrInvalidWorldBundle, worldBundleManifestName)
+	}
+
+	body, err := m.Open()
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrInvalidWorldBundle, err)
+	}
+	defer body.Close()
+
+	manifest = &WorldBundleManifest{}
+	if err = json.NewDecoder(body).Decode(manifest); err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrInvalidWorldBundle, err)
+	}
+
+	return manifest, entries, nil
+}
+
+// validateWorldBundle Checks the bundle against the target, resolves classes and references and assigns new ids
+func validateWorldBundle(ctx context.Context, requester *sm.User, admin bool, manifest *WorldBundleManifest, entries map[string]*zip.File, options WorldBundleImportOptions) (b *worldBundleImport, report *WorldBundleImportReport, err error) {
+	db := database.DB
+
+	report = &WorldBundleImportReport{
+		DryRun:   options.DryRun,
+		Valid:    true,
+		Name:     manifest.World.Name,
+		Objects:  len(manifest.Objects),
+		Portals:  len(manifest.Portals),
+		Classes:  []WorldBundleClassResolution{},
+		Warnings: []string{},
+		Errors:   []string{},
+	}
+
+	b = &worldBundleImport{manifest: manifest, entries: entries, ids: map[uuid.UUID]uuid.UUID{}, classes: map[uuid.UUID]uuid.UUID{}, references: map[uuid.UUID]bool{}}
+
+	if manifest.FormatVersion < 1 || manifest.FormatVersion > WorldBundleFormatVersion {
+		report.fail("unsupported format version %d", manifest.FormatVersion)
+		return b, report, nil
+	}
+
+	if manifest.World.Name == "" {
+		report.fail("no world name")
+	}
+
+	conflict := options.ClassConflict
+	if conflict == "" {
+		conflict = WorldBundleClassReuse
+	}
+	if conflict != WorldBundleClassReuse && conflict != WorldBundleClassCreate && conflict != WorldBundleClassFail {
+		report.fail("unsupported class conflict handling %q", conflict)
+		return b, report, nil
+	}
+
+	//region New ids
+	assign := func(id uuid.UUID, kind string) {
+		if _, ok := b.ids[id]; ok {
+			report.fail("duplicate %s id %s", kind, id)
+			return
+		}
+		newId, err := uuid.NewV4()
+		if err != nil {
+			report.fail("failed to generate uuid: %v", err)
+			return
+		}
+		b.ids[id] = newId
+	}
+
+	assign(manifest.World.Id, "world")
+	for _, o := range manifest.Objects {
+		assign(o.Id, objectSingular)
+	}
+	for _, p := range manifest.Portals {
+		assign(p.Id, portalSingular)
+	}
+	//endregion
+
+	//region Files
+	var bytes int64
+	checkFiles := func(files []WorldBundleFile, owner string) {
+		for _, f := range files {
+			if _, ok := b.ids[f.Id]; ok {
+				report.fail("duplicate file id %s", f.Id)
+				continue
+			}
+
+			newId, err := uuid.NewV4()
+			if err != nil {
+				report.fail("failed to generate uuid: %v", err)
+				continue
+			}
+			b.ids[f.Id] = newId
+			report.Files++
+
+			if f.Type == "" {
+				report.fail("file %s of %s has no type", f.Id, owner)
+			}
+
+			if f.Entry == "" {
+				if f.Url == "" {
+					report.fail("file %s of %s has neither the entry nor the url", f.Id, owner)
+				} else if s3.IsStorageUrl(f.Url) {
+					// Stored objects are imported from the bundle entries only, so objects of other entities can not be linked
+					report.fail("file %s of %s links the storage url without the entry", f.Id, owner)
+				}
+				continue
+			}
+
+			entry, ok := entries[f.Entry]
+			if !ok {
+				report.fail("file %s of %s has no entry %s", f.Id, owner, f.Entry)
+				continue
+			}
+
+			size := int64(entry.UncompressedSize64)
+			if f.Size != nil && *f.Size != size {
+				report.fail("file %s of %s has size %d, entry %s has %d", f.Id, owner, *f.Size, f.Entry, size)
+			}
+			bytes += size
+		}
+	}
+
+	checkFiles(manifest.World.Files, "the world")
+	for _, o := range manifest.Objects {
+		checkFiles(o.Files, fmt.Sprintf("%s %s", objectSingular, o.Id))
+	}
+	report.Bytes = bytes
+
+	if !admin && bytes > 0 {
+		if err = checkStorageQuota(ctx, requester.Id, uuid.Nil, bytes, uuid.Nil); err != nil {
+			if errors.Is(err, ErrStorageQuotaExceeded) {
+				report.fail("%v", err)
+			} else {
+				return nil, nil, err
+			}
+		}
+	}
+	//endregion
+
+	//region Classes
+	declared := map[uuid.UUID]bool{}
+	var ids []uuid.UUID
+	var names []string
+	for _, c := range manifest.Classes {
+		declared[c.Id] = true
+		ids = append(ids, c.Id)
+		names = append(names, c.Class)
+	}
+
+	type existingClass struct {
+		id    uuid.UUID
+		class string
+	}
+	byId := map[uuid.UUID]existingClass{}
+	byClass := map[string]existingClass{}
+
+	q := `SELECT pc.id, coalesce(pc.cls, '') FROM placeable_classes pc WHERE pc.id = ANY($1) OR pc.cls = ANY($2)`
+	rows, err := db.Query(ctx, q, ids /*$1*/, names /*$2*/)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to query classes: %v", err)
+	}
+	for rows.Next() {
+		var c existingClass
+		if err = rows.Scan(&c.id, &c.class); err != nil {
+			rows.Close()
+			return nil, nil, err
+		}
+		byId[c.id] = c
+		if _, ok := byClass[c.class]; !ok {
+			byClass[c.class] = c
+		}
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	for _, c := range manifest.Classes {
+		r := WorldBundleClassResolution{Id: c.Id, Class: c.Class}
+
+		sameId, idTaken := byId[c.Id]
+		sameClass, classTaken := byClass[c.Class]
+
+		switch {
+		case idTaken && sameId.class == c.Class:
+			r.Resolution = "existing"
+			r.TargetId = &sameId.id
+		case !idTaken && !classTaken:
+			// Classes missing at the target keep their ids, so later imports of the same class match
+			r.Resolution = "create"
+			r.TargetId = &c.Id
+		case conflict == WorldBundleClassReuse && classTaken:
+			r.Resolution = "reuse"
+			r.TargetId = &sameClass.id
+		case conflict == WorldBundleClassCreate:
+			id, err := uuid.NewV4()
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to generate uuid: %v", err)
+			}
+			r.Resolution = "create"
+			r.TargetId = &id
+		default:
+			r.Resolution = "conflict"
+			if idTaken {
+				report.fail("class %s (%s) conflicts with the existing class %s", c.Id, c.Class, sameId.class)
+			} else {
+				report.fail("class %s (%s) conflicts with the existing class %s", c.Id, c.Class, sameClass.id)
+			}
+		}
+
+		if r.TargetId != nil {
+			b.classes[c.Id] = *r.TargetId
+			if r.Resolution == "create" {
+				n := c
+				n.Id = *r.TargetId
+				b.newClasses = append(b.newClasses, n)
+			}
+		}
+
+		report.Classes = append(report.Classes, r)
+	}
+
+	// Object classes are shared by all worlds, only admins can add them
+	if len(b.newClasses) > 0 && !admin {
+		report.fail("%d classes do not exist at the target and can only be created by admins", len(b.newClasses))
+	}
+
+	for _, o := range manifest.Objects {
+		if !declared[o.PlaceableClassId] {
+			report.fail("%s %s has the undeclared class %s", objectSingular, o.Id, o.PlaceableClassId)
+		}
+	}
+	//endregion
+
+	//region References outside the bundle
+	if err = b.resolveReferences(ctx); err != nil {
+		return nil, nil, err
+	}
+
+	for _, o := range manifest.Objects {
+		if o.EntityId != nil && b.remap(o.EntityId) == nil {
+			report.warn("%s %s links the missing entity %s, the link is dropped", objectSingular, o.Id, *o.EntityId)
+		}
+	}
+	for _, p := range manifest.Portals {
+		if p.DestinationId != nil && b.remap(p.DestinationId) == nil {
+			report.warn("%s %s has the missing destination %s, the destination is dropped", portalSingular, p.Id, *p.DestinationId)
+		}
+	}
+
+	if manifest.World.PackageId != nil {
+		var exists bool
+		q = `SELECT EXISTS(SELECT 1 FROM mods m WHERE m.id = $1)`
+		if err = db.QueryRow(ctx, q, manifest.World.PackageId /*$1*/).Scan(&exists); err != nil {
+			return nil, nil, fmt.Errorf("failed to query the package: %v", err)
+		}
+		if exists {
+			b.hasPackageId = true
+		} else {
+			report.warn("package %s does not exist, the world is imported without the package", *manifest.World.PackageId)
+		}
+	}
+	//endregion
+
+	return b, report, nil
+}
+
+// importWorldBundleFile Inserts the file record and stores the contents under the new key, cloned blobs are shared with the source file, files without entries can only link external urls
+func importWorldBundleFile(ctx context.Context, tx pgx.Tx, requester *sm.User, b *worldBundleImport, entityId uuid.UUID, public bool, f WorldBundleFile, uploaded *[]string) (err error) {
+	fileId := b.ids[f.Id]
+
+	var (
+		url        = f.Url
+		key        = fmt.Sprintf("%s/%s", entityId, fileId)
+		blobHash   *string
+		scanStatus *string
+		open       func() (io.ReadCloser, error)
+	)
+
+	if f.Entry == "" && s3.IsStorageUrl(f.Url) {
+		return fmt.Errorf("file %s links the storage url without the entry", f.Id)
+	}
+
+	if f.Entry != "" {
+		url = s3.GetS3UrlForFile(key)
+		if source, ok := b.sources[f.Id]; ok {
+			if source.BlobHash != nil {
+				// Shared contents have already been scanned
+				url, blobHash, scanStatus = source.Url, source.BlobHash, source.ScanStatus
+			} else {
+				open = func() (io.ReadCloser, error) {
+					return openFileContents(ctx, source.Url)
+				}
+			}
+		} else {
+			open = b.entries[f.Entry].Open
+		}
+	}
+
+	q := `INSERT INTO files (id, entity_id, url, type, mime, size, version, deployment_type, platform, uploaded_by, width, height, created_at, updated_at, variation, original_path, hash, metadata, blob_hash, scan_status)
+VALUES ($1, $2, $3, $4, $5, $6, 0, $7, $8, $9, $10, $11, now(), null, $12, $13, $14, $15, $16, $17)`
+	_, err = tx.Exec(ctx, q, fileId /*$1*/, entityId /*$2*/, url /*$3*/, f.Type /*$4*/, f.Mime /*$5*/, f.Size /*$6*/, f.Deployment /*$7*/, f.Platform /*$8*/, requester.Id /*$9*/, f.Width /*$10*/, f.Height /*$11*/, f.Variation /*$12*/, f.OriginalPath /*$13*/, f.Hash /*$14*/, f.Metadata /*$15*/, blobHash /*$16*/, scanStatus /*$17*/)
+	if err != nil {
+		return err
+	}
+
+	if open == nil {
+		return nil
+	}
+
+	// Contents are spooled to a temporary file as the upload needs to seek the contents to hash them
+	body, err := open()
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	tmp, err := os.CreateTemp("", "bundle-*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+	}()
+
+	size, err := io.Copy(tmp, body)
+	if err != nil {
+		return err
+	}
+
+	var mime string
+	if f.Mime != nil {
+		mime = *f.Mime
+	}
+
+	*uploaded = append(*uploaded, key)
+	if err = uploadFileObject(ctx, tx, fileId, f.Type, key, tmp, size, mime, public, nil); err != nil {
+		return err
+	}
+
+	return enqueueFileScan(ctx, tx, fileId)
+}
+
+// importEntityBundleData Inserts properties and files of the imported entity
+func importEntityBundleData(ctx context.Context, tx pgx.Tx, requester *sm.User, b *worldBundleImport, entityId uuid.UUID, public bool, properties []WorldSnapshotProperty, files []WorldBundleFile, uploaded *[]string) (err error) {
+	for _, p := range properties {
+		q := `INSERT INTO properties (entity_id, type, name, value) VALUES ($1, $2, $3, $4)`
+		if _, err = tx.Exec(ctx, q, entityId /*$1*/, p.Type /*$2*/, p.Name /*$3*/, p.Value /*$4*/); err != nil {
+			return err
+		}
+	}
+
+	for _, f := range files {
+		if err = importWorldBundleFile(ctx, tx, requester, b, entityId, public, f, uploaded); err != nil {
+			return fmt.Errorf("failed to import file %s: %v", f.Id, err)
+		}
+	}
+
+	return nil
+}
+
+// insertBundleEntity Inserts the entity owned by the requester
+func insertBundleEntity(ctx context.Context, tx pgx.Tx, requester *sm.User, id uuid.UUID, entityType string, public bool) (err error) {
+	q := `INSERT INTO entities (id, entity_type, public) VALUES ($1, $2, $3)`
+	if _, err = tx.Exec(ctx, q, id /*$1*/, entityType /*$2*/, public /*$3*/); err != nil {
+		return err
+	}
+
+	q = `INSERT INTO accessibles (user_id, entity_id, is_owner, can_view, can_edit, can_delete) VALUES ($1, $2, true, true, true, true)`
+	_, err = tx.Exec(ctx, q, requester.Id /*$1*/, id /*$2*/)
+	return err
+}
+
+// importWorldBundle Creates the world from the validated bundle in a single tx
+func importWorldBundle(ctx context.Context, requester *sm.User, b *worldBundleImport) (worldId uuid.UUID, err error) {
+	db := database.DB
+	m := b.manifest
+	worldId = b.ids[m.World.Id]
+
+	tx, err1 := db.Begin(ctx)
+	if err1 != nil {
+		return uuid.Nil, fmt.Errorf("failed to begin tx: %v", err1)
+	}
+
+	var uploaded []string
+	err1 = func() (err error) {
+		//region Classes
+		for _, c := range b.newClasses {
+			if err = insertBundleEntity(ctx, tx, requester, c.Id, "placeable_class", c.Public); err != nil {
+				return err
+			}
+
+			q := `INSERT INTO placeable_classes (id, cls, name, description, category) VALUES ($1, $2, $3, $4, $5)`
+			if _, err = tx.Exec(ctx, q, c.Id /*$1*/, c.Class /*$2*/, c.Name /*$3*/, c.Description /*$4*/, c.Category /*$5*/); err != nil {
+				return fmt.Errorf("failed to create class %s: %v", c.Class, err)
+			}
+		}
+		//endregion
+
+		//region World
+		if err = insertBundleEntity(ctx, tx, requester, worldId, "space", m.World.Public); err != nil {
+			return err
+		}
+
+		var packageId *uuid.UUID
+		if b.hasPackageId {
+			packageId = m.World.PackageId
+		}
+
+		q := `INSERT INTO spaces (id, name, description, map, mod_id, type, game_mode) VALUES ($1, $2, $3, $4, $5, $6, $7)`
+		if _, err = tx.Exec(ctx, q, worldId /*$1*/, m.World.Name /*$2*/, m.World.Description /*$3*/, m.World.Map /*$4*/, packageId /*$5*/, m.World.Type /*$6*/, m.World.GameMode /*$7*/); err != nil {
+			return err
+		}
+
+		if err = importEntityBundleData(ctx, tx, requester, b, worldId, m.World.Public, m.World.Properties, m.World.Files, &uploaded); err != nil {
+			return err
+		}
+		//endregion
+
+		//region Portals
+		for _, p := range m.Portals {
+			id := b.ids[p.Id]
+			if err = insertBundleEntity(ctx, tx, requester, id, "portal", p.Public); err != nil {
+				return err
+			}
+
+			q = `INSERT INTO portals (id, name, space_id, destination_id) VALUES ($1, $2, $3, NULL)`
+			if _, err = tx.Exec(ctx, q, id /*$1*/, p.Name /*$2*/, worldId /*$3*/); err != nil {
+				return err
+			}
+		}
+
+		// Destinations are set once all portals exist as they can refer each other
+		for _, p := range m.Portals {
+			if destinationId := b.remap(p.DestinationId); destinationId != nil {
+				q = `UPDATE portals SET destination_id = $2 WHERE id = $1`
+				if _, err = tx.Exec(ctx, q, b.ids[p.Id] /*$1*/, destinationId /*$2*/); err != nil {
+					return err
+				}
+			}
+		}
+		//endregion
+
+		//region Objects
+		for _, o := range m.Objects {
+			id := b.ids[o.Id]
+			if err = insertBundleEntity(ctx, tx, requester, id, "placeable", o.Public); err != nil {
+				return err
+			}
+
+			q = `INSERT INTO placeables (id, space_id, entity_id, placeable_class_id, offset_x, offset_y, offset_z, rotation_x, rotation_y, rotation_z, scale_x, scale_y, scale_z)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)`
+			_, err = tx.Exec(ctx, q, id /*$1*/, worldId /*$2*/, b.remap(o.EntityId) /*$3*/, b.classes[o.PlaceableClassId] /*$4*/, o.OffsetX /*$5*/, o.OffsetY /*$6*/, o.OffsetZ /*$7*/, o.RotationX /*$8*/, o.RotationY /*$9*/, o.RotationZ /*$10*/, o.ScaleX /*$11*/, o.ScaleY /*$12*/, o.ScaleZ /*$13*/)
+			if err != nil {
+				return fmt.Errorf("failed to import %s %s: %v", objectSingular, o.Id, err)
+			}
+
+			if err = importEntityBundleData(ctx, tx, requester, b, id, o.Public, o.Properties, o.Files, &uploaded); err != nil {
+				return err
+			}
+		}
+		//endregion
+
+		return nil
+	}()
+
+	if err1 == nil {
+		err1 = tx.Commit(ctx)
+	}
+
+	if err1 != nil {
+		logrus.Errorf("failed to import world bundle %s @ %s: %v", m.World.Id, reflect.FunctionName(), err1)
+		_ = tx.Rollback(ctx)
+
+		// Objects uploaded under the new keys are not referenced by anything
+		for _, key := range uploaded {
+			if s3.ObjectExists(key) {
+				if err2 := s3.DeleteObject(key); err2 != nil {
+					logrus.Errorf("failed to delete the imported object %s @ %s: %v", key, reflect.FunctionName(), err2)
+				}
+			}
+		}
+
+		return uuid.Nil, fmt.Errorf("failed to import the world: %v", err1)
+	}
+
+	return worldId, nil
+}
+
+// importWorldBundleFrom Validates the bundle and creates the world owned by the requester unless it is a dry run, the report lists validation errors
+func importWorldBundleFrom(ctx context.Context, requester *sm.User, admin bool, r io.ReaderAt, size int64, options WorldBundleImportOptions) (report *WorldBundleImportReport, err error) {
+	manifest, entries, err := readWorldBundleManifest(r, size)
+	if err != nil {
+		return nil, err
+	}
+
+	b, report, err := validateWorldBundle(ctx, requester, admin, manifest, entries, options)
+	if err != nil {
+		return nil, err
+	}
+
+	if options.DryRun || !report.Valid {
+		return report, nil
+	}
+
+	worldId, err := importWorldBundle(ctx, requester, b)
+	if err != nil {
+		return report, err
+	}
+	report.WorldId = &worldId
+
+	return report, nil
+}
+
+// ImportWorldBundleForAdmin Creates the world from the bundle, classes missing at the target are created
+func ImportWorldBundleForAdmin(ctx context.Context, requester *sm.User, r io.ReaderAt, size int64, options WorldBundleImportOptions) (report *WorldBundleImportReport, err error) {
+	return importWorldBundleFrom(ctx, requester, true, r, size, options)
+}
+
+// ImportWorldBundleForRequester Creates the world from the bundle if the requester has enough storage quota, all classes have to exist at the target
+func ImportWorldBundleForRequester(ctx context.Context, requester *sm.User, r io.ReaderAt, size int64, options WorldBundleImportOptions) (report *WorldBundleImportReport, err error) {
+	return importWorldBundleFrom(ctx, requester, false, r, size, options)
+}
+
+//endregion
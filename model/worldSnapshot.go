@@ -0,0 +1,916 @@
+package model
+
+import (
+	"context"
+	sm "dev.hackerman.me/artheon/veverse-shared/model"
+	"errors"
+	"fmt"
+	"github.com/gofrs/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/sirupsen/logrus"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+	"veverse-api/aws/s3"
+	"veverse-api/database"
+	"veverse-api/gltf"
+	"veverse-api/reflect"
+)
+
+var (
+	worldSnapshotSingular = "world snapshot"
+	worldSnapshotPlural   = "world snapshots"
+)
+
+const worldSnapshotDefaultRetention = 20
+
+var worldSnapshotRetention = os.Getenv("WORLD_SNAPSHOT_RETENTION") // Number of automatic snapshots kept per world, 0 disables automatic snapshots (default 20), named snapshots are kept until deleted
+
+// WorldSnapshot is the named copy of the world placeable set
+type WorldSnapshot struct {
+	Id          uuid.UUID             `json:"id"`
+	WorldId     uuid.UUID             `json:"worldId"`
+	Name        string                `json:"name"`
+	Automatic   bool                  `json:"automatic"` // Taken before bulk edits and restores
+	CreatedBy   *uuid.UUID            `json:"createdBy,omitempty"`
+	ObjectCount int                   `json:"objectCount"`
+	Objects     []WorldSnapshotObject `json:"objects,omitempty"` // Only returned for a single snapshot
+	CreatedAt   time.Time             `json:"createdAt"`
+}
+
+// WorldSnapshotObject is the placeable of the world snapshot
+type WorldSnapshotObject struct {
+	Id               uuid.UUID               `json:"id"`
+	Public           bool                    `json:"public"`
+	EntityId         *uuid.UUID              `json:"entityId,omitempty"`
+	PlaceableClassId uuid.UUID               `json:"placeableClassId"`
+	OffsetX          float64                 `json:"offsetX"`
+	OffsetY          float64                 `json:"offsetY"`
+	OffsetZ          float64                 `json:"offsetZ"`
+	RotationX        float64                 `json:"rotationX"`
+	RotationY        float64                 `json:"rotationY"`
+	RotationZ        float64                 `json:"rotationZ"`
+	ScaleX           float64                 `json:"scaleX"`
+	ScaleY           float64                 `json:"scaleY"`
+	ScaleZ           float64                 `json:"scaleZ"`
+	Properties       []WorldSnapshotProperty `json:"properties"`
+	Files            []WorldSnapshotFile     `json:"files"`
+}
+
+type WorldSnapshotProperty struct {
+	Type  string `json:"type"`
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// WorldSnapshotFile is the reference to the placeable file, blob contents are kept while the snapshot exists
+type WorldSnapshotFile struct {
+	Id           uuid.UUID      `json:"id"`
+	Type         string         `json:"type"`
+	Url          string         `json:"url"`
+	Mime         *string        `json:"mime,omitempty"`
+	Size         *int64         `json:"size,omitempty"`
+	Version      int64          `json:"version"`
+	Deployment   string         `json:"deploymentType"`
+	Platform     string         `json:"platform"`
+	Variation    int            `json:"variation"`
+	OriginalPath *string        `json:"originalPath,omitempty"`
+	Hash         *string        `json:"hash,omitempty"`
+	BlobHash     *string        `json:"blobHash,omitempty"`
+	UploadedBy   *uuid.UUID     `json:"uploadedBy,omitempty"`
+	Width        *int           `json:"width,omitempty"`
+	Height       *int           `json:"height,omitempty"`
+	Metadata     *gltf.Metadata `json:"metadata,omitempty"`
+	ScanStatus   *string        `json:"scanStatus,omitempty"`
+	CreatedAt    time.Time      `json:"createdAt"`
+}
+
+// WorldSnapshotObjectChange lists the changed fields of the object present in both snapshots
+type WorldSnapshotObjectChange struct {
+	Id     uuid.UUID           `json:"id"`
+	Fields []string            `json:"fields"` // entityId, placeableClassId, transform, properties or files
+	From   WorldSnapshotObject `json:"from"`
+	To     WorldSnapshotObject `json:"to"`
+}
+
+// WorldSnapshotDiff is the difference between two snapshots, the current layout is used if a snapshot is not set
+type WorldSnapshotDiff struct {
+	From    *uuid.UUID                  `json:"from,omitempty"`
+	To      *uuid.UUID                  `json:"to,omitempty"`
+	Added   []WorldSnapshotObject       `json:"added"`
+	Removed []WorldSnapshotObject       `json:"removed"`
+	Changed []WorldSnapshotObjectChange `json:"changed"`
+}
+
+// WorldSnapshotRestoreResult is the summary of the restored snapshot
+type WorldSnapshotRestoreResult struct {
+	BackupId       *uuid.UUID  `json:"backupId,omitempty"` // Automatic snapshot of the layout replaced by the restore
+	Restored       int         `json:"restored"`
+	Removed        int         `json:"removed"`
+	SkippedObjects []uuid.UUID `json:"skippedObjects"` // Objects of deleted classes
+	SkippedFiles   []uuid.UUID `json:"skippedFiles"`   // Files which objects have been deleted from the storage
+}
+
+var (
+	worldSnapshotConfigOnce     sync.Once
+	worldSnapshotRetentionCount int
+)
+
+// getWorldSnapshotRetention returns the number of automatic snapshots kept per world
+func getWorldSnapshotRetention() int {
+	worldSnapshotConfigOnce.Do(func() {
+		worldSnapshotRetentionCount = worldSnapshotDefaultRetention
+		if worldSnapshotRetention == "" {
+			return
+		}
+
+		count, err := strconv.Atoi(worldSnapshotRetention)
+		if err != nil || count < 0 {
+			logrus.Errorf("invalid %s retention %s", worldSnapshotSingular, worldSnapshotRetention)
+			return
+		}
+
+		worldSnapshotRetentionCount = count
+	})
+
+	return worldSnapshotRetentionCount
+}
+
+//region Layout
+
+// getWorldLayout returns placeables of the world with their properties and files
+func getWorldLayout(ctx context.Context, tx pgx.Tx, worldId uuid.UUID) (objects []WorldSnapshotObject, err error) {
+	q := `SELECT p.id,
+       coalesce(e.public, false),
+       p.entity_id,
+       p.placeable_class_id,
+       coalesce(p.offset_x, 0),
+       coalesce(p.offset_y, 0),
+       coalesce(p.offset_z, 0),
+       coalesce(p.rotation_x, 0),
+       coalesce(p.rotation_y, 0),
+       coalesce(p.rotation_z, 0),
+       coalesce(p.scale_x, 1),
+       coalesce(p.scale_y, 1),
+       coalesce(p.scale_z, 1)
+FROM placeables p
+    LEFT JOIN entities e ON e.id = p.id
+WHERE p.space_id = $1
+ORDER BY p.id`
+	rows, err := tx.Query(ctx, q, worldId /*$1*/)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query %s: %v", objectPlural, err)
+	}
+
+	objects = []WorldSnapshotObject{}
+	index := map[uuid.UUID]int{}
+	for rows.Next() {
+		o := WorldSnapshotObject{Properties: []WorldSnapshotProperty{}, Files: []WorldSnapshotFile{}}
+		err = rows.Scan(&o.Id, &o.Public, &o.EntityId, &o.PlaceableClassId, &o.OffsetX, &o.OffsetY, &o.OffsetZ, &o.RotationX, &o.RotationY, &o.RotationZ, &o.ScaleX, &o.ScaleY, &o.ScaleZ)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		index[o.Id] = len(objects)
+		objects = append(objects, o)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(objects) == 0 {
+		return objects, nil
+	}
+
+	q = `SELECT pr.entity_id, pr.type, pr.name, pr.value
+FROM properties pr
+    JOIN placeables p ON p.id = pr.entity_id
+WHERE p.space_id = $1
+ORDER BY pr.name`
+	rows, err = tx.Query(ctx, q, worldId /*$1*/)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query %s: %v", propertyPlural, err)
+	}
+
+	for rows.Next() {
+		var (
+			id uuid.UUID
+			p  WorldSnapshotProperty
+		)
+		if err = rows.Scan(&id, &p.Type, &p.Name, &p.Value); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if i, ok := index[id]; ok {
+			objects[i].Properties = append(objects[i].Properties, p)
+		}
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	q = `SELECT f.entity_id, f.id, f.type, f.url, f.mime, f.size, f.version, f.deployment_type, f.platform, f.variation, f.original_path, f.hash, f.blob_hash, f.uploaded_by, f.width, f.height, f.metadata, f.scan_status, f.created_at
+FROM files f
+    JOIN placeables p ON p.id = f.entity_id
+WHERE p.space_id = $1
+ORDER BY f.type, f.platform, f.deployment_type, f.variation, f.original_path`
+	rows, err = tx.Query(ctx, q, worldId /*$1*/)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query files: %v", err)
+	}
+
+	for rows.Next() {
+		var (
+			id uuid.UUID
+			f  WorldSnapshotFile
+		)
+		err = rows.Scan(&id, &f.Id, &f.Type, &f.Url, &f.Mime, &f.Size, &f.Version, &f.Deployment, &f.Platform, &f.Variation, &f.OriginalPath, &f.Hash, &f.BlobHash, &f.UploadedBy, &f.Width, &f.Height, &f.Metadata, &f.ScanStatus, &f.CreatedAt)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if i, ok := index[id]; ok {
+			objects[i].Files = append(objects[i].Files, f)
+		}
+	}
+	rows.Close()
+
+	return objects, rows.Err()
+}
+
+//endregion
+
+//region Snapshots
+
+// createWorldSnapshot Stores the current layout of the world, automatic snapshots beyond the retention are pruned
+func createWorldSnapshot(ctx context.Context, tx pgx.Tx, requester *sm.User, worldId uuid.UUID, name string, automatic bool) (snapshot *WorldSnapshot, err error) {
+	objects, err := getWorldLayout(ctx, tx, worldId)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := uuid.NewV4()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate uuid: %v", err)
+	}
+
+	snapshot = &WorldSnapshot{Id: id, WorldId: worldId, Name: name, Automatic: automatic, ObjectCount: len(objects)}
+	if requester != nil {
+		snapshot.CreatedBy = &requester.Id
+	}
+
+	q := `INSERT INTO world_snapshots (id, world_id, name, automatic, created_by, object_count, objects) VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING created_at`
+	err = tx.QueryRow(ctx, q, id /*$1*/, worldId /*$2*/, name /*$3*/, automatic /*$4*/, snapshot.CreatedBy /*$5*/, len(objects) /*$6*/, objects /*$7*/).Scan(&snapshot.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to insert the %s: %v", worldSnapshotSingular, err)
+	}
+
+	// Blob contents are kept while the snapshot refers them
+	var hashes []string
+	for _, o := range objects {
+		for _, f := range o.Files {
+			if f.BlobHash != nil {
+				hashes = append(hashes, *f.BlobHash)
+			}
+		}
+	}
+
+	if len(hashes) > 0 {
+		q = `INSERT INTO world_snapshot_blobs (snapshot_id, blob_hash)
+SELECT $1, b.hash FROM file_blobs b WHERE b.hash = ANY($2)
+ON CONFLICT DO NOTHING`
+		if _, err = tx.Exec(ctx, q, id /*$1*/, hashes /*$2*/); err != nil {
+			return nil, fmt.Errorf("failed to reference %s blobs: %v", worldSnapshotSingular, err)
+		}
+	}
+
+	if automatic {
+		q = `DELETE FROM world_snapshots
+WHERE id IN (SELECT s.id
+             FROM world_snapshots s
+             WHERE s.world_id = $1
+               AND s.automatic
+             ORDER BY s.created_at DESC
+             OFFSET $2)`
+		if _, err = tx.Exec(ctx, q, worldId /*$1*/, getWorldSnapshotRetention() /*$2*/); err != nil {
+			return nil, fmt.Errorf("failed to prune %s: %v", worldSnapshotPlural, err)
+		}
+	}
+
+	return snapshot, nil
+}
+
+// takeAutomaticWorldSnapshot Stores the current layout before it is changed unless automatic snapshots are disabled
+func takeAutomaticWorldSnapshot(ctx context.Context, tx pgx.Tx, requester *sm.User, worldId uuid.UUID, name string) (snapshot *WorldSnapshot, err error) {
+	if getWorldSnapshotRetention() == 0 {
+		return nil, nil
+	}
+
+	return createWorldSnapshot(ctx, tx, requester, worldId, name, true)
+}
+
+// CreateWorldSnapshotForAdmin Stores the current layout of the world as the named snapshot
+func CreateWorldSnapshotForAdmin(ctx context.Context, requester *sm.User, worldId uuid.UUID, name string) (snapshot *WorldSnapshot, err error) {
+	db := database.DB
+
+	// Repeatable read, so the placeables, properties and files are read consistently
+	tx, err1 := db.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.RepeatableRead})
+	if err1 != nil {
+		return nil, fmt.Errorf("failed to begin tx: %v", err1)
+	}
+
+	q := `SELECT s.id FROM spaces s WHERE s.id = $1`
+	err1 = tx.QueryRow(ctx, q, worldId /*$1*/).Scan(&worldId)
+
+	if err1 == nil {
+		snapshot, err1 = createWorldSnapshot(ctx, tx, requester, worldId, name, false)
+	}
+
+	if err1 != nil {
+		if err2 := tx.Rollback(ctx); err2 != nil {
+			return nil, fmt.Errorf("failed to rollback failed tx: %v, %v", err1, err2)
+		}
+		return nil, err1
+	}
+
+	if err1 = tx.Commit(ctx); err1 != nil {
+		return nil, fmt.Errorf("failed to commit tx: %v", err1)
+	}
+
+	return snapshot, nil
+}
+
+// CreateWorldSnapshotForRequester Stores the current layout of the world as the named snapshot if the requester can edit the world
+func CreateWorldSnapshotForRequester(ctx context.Context, requester *sm.User, worldId uuid.UUID, name string) (snapshot *WorldSnapshot, err error) {
+	canEdit, err := EntityEditable(ctx, requester.Id, worldId)
+	if err != nil {
+		return nil, err
+	}
+
+	if !canEdit {
+		return nil, errors.New("no access")
+	}
+
+	return CreateWorldSnapshotForAdmin(ctx, requester, worldId, name)
+}
+
+// IndexWorldSnapshotsForAdmin Index snapshots of the world starting from the latest, objects are not included
+func IndexWorldSnapshotsForAdmin(ctx context.Context, worldId uuid.UUID, offset int64, limit int64) (entities []WorldSnapshot, total int64, err error) {
+	db := database.DB
+
+	q := `SELECT COUNT(*) FROM world_snapshots s WHERE s.world_id = $1`
+	if err = db.QueryRow(ctx, q, worldId /*$1*/).Scan(&total); err != nil {
+		return nil, -1, err
+	}
+
+	if total == 0 {
+		return []WorldSnapshot{}, 0, nil
+	}
+
+	q = `SELECT s.id, s.world_id, s.name, s.automatic, s.created_by, s.object_count, s.created_at
+FROM world_snapshots s
+WHERE s.world_id = $1
+ORDER BY s.created_at DESC
+OFFSET $2 LIMIT $3`
+	rows, err := db.Query(ctx, q, worldId /*$1*/, offset /*$2*/, limit /*$3*/)
+	if err != nil {
+		return nil, -1, err
+	}
+
+	defer func() {
+		rows.Close()
+		database.LogPgxStat("IndexWorldSnapshotsForAdmin")
+	}()
+
+	entities = []WorldSnapshot{}
+	for rows.Next() {
+		var e WorldSnapshot
+		if err = rows.Scan(&e.Id, &e.WorldId, &e.Name, &e.Automatic, &e.CreatedBy, &e.ObjectCount, &e.CreatedAt); err != nil {
+			return nil, -1, err
+		}
+		entities = append(entities, e)
+	}
+
+	return entities, total, rows.Err()
+}
+
+// IndexWorldSnapshotsForRequester Index snapshots of the world if the requester can view the world
+func IndexWorldSnapshotsForRequester(ctx context.Context, requester *sm.User, worldId uuid.UUID, offset int64, limit int64) (entities []WorldSnapshot, total int64, err error) {
+	canView, err := EntityViewable(ctx, requester.Id, worldId)
+	if err != nil {
+		return nil, -1, err
+	}
+
+	if !canView {
+		return nil, -1, errors.New("no access")
+	}
+
+	return IndexWorldSnapshotsForAdmin(ctx, worldId, offset, limit)
+}
+
+// getWorldSnapshot returns the snapshot of the world with its objects
+func getWorldSnapshot(ctx context.Context, worldId uuid.UUID, snapshotId uuid.UUID) (snapshot *WorldSnapshot, err error) {
+	db := database.DB
+
+	snapshot = &WorldSnapshot{}
+	q := `SELECT s.id, s.world_id, s.name, s.automatic, s.created_by, s.object_count, s.objects, s.created_at FROM world_snapshots s WHERE s.id = $1 AND s.world_id = $2`
+	err = db.QueryRow(ctx, q, snapshotId /*$1*/, worldId /*$2*/).Scan(&snapshot.Id, &snapshot.WorldId, &snapshot.Name, &snapshot.Automatic, &snapshot.CreatedBy, &snapshot.ObjectCount, &snapshot.Objects, &snapshot.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return snapshot, nil
+}
+
+// GetWorldSnapshotForAdmin returns the snapshot of the world with its objects
+func GetWorldSnapshotForAdmin(ctx context.Context, worldId uuid.UUID, snapshotId uuid.UUID) (snapshot *WorldSnapshot, err error) {
+	return getWorldSnapshot(ctx, worldId, snapshotId)
+}
+
+// GetWorldSnapshotForRequester returns the snapshot of the world with its objects if the requester can view the world
+func GetWorldSnapshotForRequester(ctx context.Context, requester *sm.User, worldId uuid.UUID, snapshotId uuid.UUID) (snapshot *WorldSnapshot, err error) {
+	canView, err := EntityViewable(ctx, requester.Id, worldId)
+	if err != nil {
+		return nil, err
+	}
+
+	if !canView {
+		return nil, errors.New("no access")
+	}
+
+	return getWorldSnapshot(ctx, worldId, snapshotId)
+}
+
+// DeleteWorldSnapshotForAdmin Deletes the snapshot, blobs not referenced anymore are deleted by the blob cleanup
+func DeleteWorldSnapshotForAdmin(ctx context.Context, worldId uuid.UUID, snapshotId uuid.UUID) (err error) {
+	db := database.DB
+
+	q := `DELETE FROM world_snapshots s WHERE s.id = $1 AND s.world_id = $2`
+	tag, err := db.Exec(ctx, q, snapshotId /*$1*/, worldId /*$2*/)
+	if err != nil {
+		return fmt.Errorf("failed to delete the %s: %v", worldSnapshotSingular, err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+
+	return nil
+}
+
+// DeleteWorldSnapshotForRequester Deletes the snapshot if the requester can edit the world
+func DeleteWorldSnapshotForRequester(ctx context.Context, requester *sm.User, worldId uuid.UUID, snapshotId uuid.UUID) (err error) {
+	canEdit, err := EntityEditable(ctx, requester.Id, worldId)
+	if err != nil {
+		return err
+	}
+
+	if !canEdit {
+		return errors.New("no access")
+	}
+
+	return DeleteWorldSnapshotForAdmin(ctx, worldId, snapshotId)
+}
+
+//endregion
+
+//region Diff
+
+func propertiesEqual(a []WorldSnapshotProperty, b []WorldSnapshotProperty) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	values := map[string]WorldSnapshotProperty{}
+	for _, p := range a {
+		values[p.Name] = p
+	}
+
+	for _, p := range b {
+		if v, ok := values[p.Name]; !ok || v != p {
+			return false
+		}
+	}
+
+	return true
+}
+
+func filesEqual(a []WorldSnapshotFile, b []WorldSnapshotFile) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	urls := map[uuid.UUID]string{}
+	for _, f := range a {
+		urls[f.Id] = f.Url
+	}
+
+	for _, f := range b {
+		if url, ok := urls[f.Id]; !ok || url != f.Url {
+			return false
+		}
+	}
+
+	return true
+}
+
+// diffWorldLayouts Compares two layouts by object ids
+func diffWorldLayouts(from []WorldSnapshotObject, to []WorldSnapshotObject) (diff *WorldSnapshotDiff) {
+	diff = &WorldSnapshotDiff{Added: []WorldSnapshotObject{}, Removed: []WorldSnapshotObject{}, Changed: []WorldSnapshotObjectChange{}}
+
+	objects := map[uuid.UUID]WorldSnapshotObject{}
+	for _, o := range from {
+		objects[o.Id] = o
+	}
+
+	for _, o := range to {
+		prev, ok := objects[o.Id]
+		if !ok {
+			diff.Added = append(diff.Added, o)
+			continue
+		}
+		delete(objects, o.Id)
+
+		var fields []string
+		if (prev.EntityId == nil) != (o.EntityId == nil) || (prev.EntityId != nil && *prev.EntityId != *o.EntityId) {
+			fields = append(fields, "entityId")
+		}
+		if prev.PlaceableClassId != o.PlaceableClassId {
+			fields = append(fields, "placeableClassId")
+		}
+		if prev.OffsetX != o.OffsetX || prev.OffsetY != o.OffsetY || prev.OffsetZ != o.OffsetZ ||
+			prev.RotationX != o.RotationX || prev.RotationY != o.RotationY || prev.RotationZ != o.RotationZ ||
+			prev.ScaleX != o.ScaleX || prev.ScaleY != o.ScaleY || prev.ScaleZ != o.ScaleZ {
+			fields = append(fields, "transform")
+		}
+		if !propertiesEqual(prev.Properties, o.Properties) {
+			fields = append(fields, "properties")
+		}
+		if !filesEqual(prev.Files, o.Files) {
+			fields = append(fields, "files")
+		}
+
+		if len(fields) > 0 {
+			diff.Changed = append(diff.Changed, WorldSnapshotObjectChange{Id: o.Id, Fields: fields, From: prev, To: o})
+		}
+	}
+
+	for _, o := range objects {
+		diff.Removed = append(diff.Removed, o)
+	}
+	sort.Slice(diff.Removed, func(i, j int) bool {
+		return diff.Removed[i].Id.String() < diff.Removed[j].Id.String()
+	})
+
+	return diff
+}
+
+// getWorldSnapshotLayout returns objects of the snapshot or the current layout if the snapshot is not set
+func getWorldSnapshotLayout(ctx context.Context, worldId uuid.UUID, snapshotId *uuid.UUID) (objects []WorldSnapshotObject, err error) {
+	if snapshotId != nil {
+		snapshot, err := getWorldSnapshot(ctx, worldId, *snapshotId)
+		if err != nil {
+			return nil, err
+		}
+		return snapshot.Objects, nil
+	}
+
+	db := database.DB
+
+	tx, err := db.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.RepeatableRead, AccessMode: pgx.ReadOnly})
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin tx: %v", err)
+	}
+	defer func() {
+		_ = tx.Rollback(ctx)
+	}()
+
+	q := `SELECT s.id FROM spaces s WHERE s.id = $1`
+	if err = tx.QueryRow(ctx, q, worldId /*$1*/).Scan(&worldId); err != nil {
+		return nil, err
+	}
+
+	return getWorldLayout(ctx, tx, worldId)
+}
+
+// DiffWorldSnapshotsForAdmin Compares two snapshots of the world, the current layout is used for the snapshot not set
+func DiffWorldSnapshotsForAdmin(ctx context.Context, worldId uuid.UUID, fromId *uuid.UUID, toId *uuid.UUID) (diff *WorldSnapshotDiff, err error) {
+	from, err := getWorldSnapshotLayout(ctx, worldId, fromId)
+	if err != nil {
+		return nil, err
+	}
+
+	to, err := getWorldSnapshotLayout(ctx, worldId, toId)
+	if err != nil {
+		return nil, err
+	}
+
+	diff = diffWorldLayouts(from, to)
+	diff.From = fromId
+	diff.To = toId
+
+	return diff, nil
+}
+
+// DiffWorldSnapshotsForRequester Compares two snapshots of the world if the requester can view the world
+func DiffWorldSnapshotsForRequester(ctx context.Context, requester *sm.User, worldId uuid.UUID, fromId *uuid.UUID, toId *uuid.UUID) (diff *WorldSnapshotDiff, err error) {
+	canView, err := EntityViewable(ctx, requester.Id, worldId)
+	if err != nil {
+		return nil, err
+	}
+
+	if !canView {
+		return nil, errors.New("no access")
+	}
+
+	return DiffWorldSnapshotsForAdmin(ctx, worldId, fromId, toId)
+}
+
+//endregion
+
+//region Restore
+
+// restoreWorldSnapshotObject Recreates or updates the object with its properties and files, returns ids of files which objects are missing
+func restoreWorldSnapshotObject(ctx context.Context, tx pgx.Tx, requester *sm.User, worldId uuid.UUID, o WorldSnapshotObject) (skippedFiles []uuid.UUID, err error) {
+	q := `INSERT INTO entities (id, entity_type, public) VALUES ($1, $2, $3) ON CONFLICT (id) DO NOTHING`
+	tag, err := tx.Exec(ctx, q, o.Id /*$1*/, "placeable" /*$2*/, o.Public /*$3*/)
+	if err != nil {
+		return nil, err
+	}
+
+	// Recreated objects are owned by the requester
+	if tag.RowsAffected() > 0 && requester != nil {
+		q = `INSERT INTO accessibles (user_id, entity_id, is_owner, can_view, can_edit, can_delete) VALUES ($1, $2, true, true, true, true)`
+		if _, err = tx.Exec(ctx, q, requester.Id /*$1*/, o.Id /*$2*/); err != nil {
+			return nil, err
+		}
+	}
+
+	// Linked entities deleted since the snapshot are unlinked
+	q = `INSERT INTO placeables (id, space_id, entity_id, placeable_class_id, offset_x, offset_y, offset_z, rotation_x, rotation_y, rotation_z, scale_x, scale_y, scale_z)
+VALUES ($1, $2, (SELECT e.id FROM entities e WHERE e.id = $3), $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+ON CONFLICT (id) DO UPDATE SET space_id           = excluded.space_id,
+                               entity_id          = excluded.entity_id,
+                               placeable_class_id = excluded.placeable_class_id,
+                               offset_x           = excluded.offset_x,
+                               offset_y           = excluded.offset_y,
+                               offset_z           = excluded.offset_z,
+                               rotation_x         = excluded.rotation_x,
+                               rotation_y         = excluded.rotation_y,
+                               rotation_z         = excluded.rotation_z,
+                               scale_x            = excluded.scale_x,
+                               scale_y            = excluded.scale_y,
+                               scale_z            = excluded.scale_z`
+	_, err = tx.Exec(ctx, q, o.Id /*$1*/, worldId /*$2*/, o.EntityId /*$3*/, o.PlaceableClassId /*$4*/, o.OffsetX /*$5*/, o.OffsetY /*$6*/, o.OffsetZ /*$7*/, o.RotationX /*$8*/, o.RotationY /*$9*/, o.RotationZ /*$10*/, o.ScaleX /*$11*/, o.ScaleY /*$12*/, o.ScaleZ /*$13*/)
+	if err != nil {
+		return nil, err
+	}
+
+	//region Properties
+
+	q = `DELETE FROM properties WHERE entity_id = $1`
+	if _, err = tx.Exec(ctx, q, o.Id /*$1*/); err != nil {
+		return nil, err
+	}
+
+	for _, p := range o.Properties {
+		q = `INSERT INTO properties (entity_id, type, name, value) VALUES ($1, $2, $3, $4)`
+		if _, err = tx.Exec(ctx, q, o.Id /*$1*/, p.Type /*$2*/, p.Name /*$3*/, p.Value /*$4*/); err != nil {
+			return nil, err
+		}
+	}
+
+	//endregion
+
+	//region Files
+
+	var fileIds []uuid.UUID
+	for _, f := range o.Files {
+		fileIds = append(fileIds, f.Id)
+	}
+
+	// Blobs of the removed files are kept by the backup snapshot, their own objects are deleted after the restore has been committed
+	q = `DELETE FROM files WHERE entity_id = $1 AND NOT (id = ANY($2))`
+	if _, err = tx.Exec(ctx, q, o.Id /*$1*/, fileIds /*$2*/); err != nil {
+		return nil, err
+	}
+
+	for _, f := range o.Files {
+		// Own objects of files deleted since the snapshot may have been deleted from the storage, blobs are kept by the snapshot
+		if f.BlobHash == nil {
+			if key := s3.GetS3KeyForEntityUrl(f.Url); f.Url == s3.GetS3UrlForFile(key) && !s3.ObjectExists(key) {
+				skippedFiles = append(skippedFiles, f.Id)
+				continue
+			}
+		}
+
+		// Files with changed contents get the next version number so clients download them again
+		q = `INSERT INTO files (id, entity_id, url, type, mime, size, version, deployment_type, platform, uploaded_by, width, height, created_at, updated_at, variation, original_path, hash, blob_hash, metadata, scan_status)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, now(), $14, $15, $16, $17, $18, $19)
+ON CONFLICT (id) DO UPDATE SET version         = CASE WHEN files.url = excluded.url THEN files.version ELSE greatest(files.version, excluded.version) + 1 END,
+                               url             = excluded.url,
+                               type            = excluded.type,
+                               mime            = excluded.mime,
+                               size            = excluded.size,
+                               deployment_type = excluded.deployment_type,
+                               platform        = excluded.platform,
+                               width           = excluded.width,
+                               height          = excluded.height,
+                               updated_at      = now(),
+                               variation       = excluded.variation,
+                               original_path   = excluded.original_path,
+                               hash            = excluded.hash,
+                               blob_hash       = excluded.blob_hash,
+                               metadata        = excluded.metadata,
+                               scan_status     = CASE WHEN files.url = excluded.url THEN files.scan_status ELSE excluded.scan_status END`
+		_, err = tx.Exec(ctx, q, f.Id /*$1*/, o.Id /*$2*/, f.Url /*$3*/, f.Type /*$4*/, f.Mime /*$5*/, f.Size /*$6*/, f.Version /*$7*/, f.Deployment /*$8*/, f.Platform /*$9*/, f.UploadedBy /*$10*/, f.Width /*$11*/, f.Height /*$12*/, f.CreatedAt /*$13*/, f.Variation /*$14*/, f.OriginalPath /*$15*/, f.Hash /*$16*/, f.BlobHash /*$17*/, f.Metadata /*$18*/, f.ScanStatus /*$19*/)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	//endregion
+
+	return skippedFiles, nil
+}
+
+// worldSnapshotReplacedFile is the url of the world object file which could be removed or replaced by the restore
+type worldSnapshotReplacedFile struct {
+	EntityId uuid.UUID
+	Url      string
+}
+
+// getWorldFileUrls returns urls of files of the world objects stored at the storage
+func getWorldFileUrls(ctx context.Context, tx pgx.Tx, worldId uuid.UUID) (files []worldSnapshotReplacedFile, err error) {
+	q := `SELECT f.entity_id, f.url FROM files f INNER JOIN placeables p ON p.id = f.entity_id WHERE p.space_id = $1`
+	rows, err := tx.Query(ctx, q, worldId /*$1*/)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var f worldSnapshotReplacedFile
+		if err = rows.Scan(&f.EntityId, &f.Url); err != nil {
+			return nil, err
+		}
+
+		if s3.IsStorageUrl(f.Url) {
+			files = append(files, f)
+		}
+	}
+
+	return files, rows.Err()
+}
+
+// deleteReplacedWorldFileObjects Deletes objects of files removed or replaced by the committed restore unless they are still referenced, blobs are kept while snapshots reference them
+func deleteReplacedWorldFileObjects(ctx context.Context, files []worldSnapshotReplacedFile) {
+	db := database.DB
+
+	for _, f := range files {
+		tx, err := db.Begin(ctx)
+		if err != nil {
+			logrus.Errorf("failed to begin tx @ %s: %v", reflect.FunctionName(), err)
+			return
+		}
+
+		if err = deleteReplacedFileObject(ctx, tx, f.EntityId, f.Url); err != nil {
+			logrus.Errorf("failed to delete the replaced object %s @ %s: %v", f.Url, reflect.FunctionName(), err)
+			if err1 := tx.Rollback(ctx); err1 != nil {
+				logrus.Errorf("failed to rollback failed tx @ %s: %v, %v", reflect.FunctionName(), err, err1)
+			}
+			continue
+		}
+
+		if err = tx.Commit(ctx); err != nil {
+			logrus.Errorf("failed to commit tx @ %s: %v", reflect.FunctionName(), err)
+		}
+	}
+}
+
+// restoreWorldSnapshot Replaces the layout of the world with the snapshot in a single tx, the replaced layout is kept as an automatic snapshot
+func restoreWorldSnapshot(ctx context.Context, requester *sm.User, worldId uuid.UUID, snapshotId uuid.UUID) (result *WorldSnapshotRestoreResult, err error) {
+	snapshot, err := getWorldSnapshot(ctx, worldId, snapshotId)
+	if err != nil {
+		return nil, err
+	}
+
+	db := database.DB
+
+	tx, err1 := db.Begin(ctx)
+	if err1 != nil {
+		return nil, fmt.Errorf("failed to begin tx: %v", err1)
+	}
+
+	result = &WorldSnapshotRestoreResult{SkippedObjects: []uuid.UUID{}, SkippedFiles: []uuid.UUID{}}
+
+	// Concurrent restores of the world wait for each other
+	q := `SELECT s.id FROM spaces s WHERE s.id = $1 FOR UPDATE`
+	err1 = tx.QueryRow(ctx, q, worldId /*$1*/).Scan(&worldId)
+
+	if err1 == nil {
+		var backup *WorldSnapshot
+		if backup, err1 = takeAutomaticWorldSnapshot(ctx, tx, requester, worldId, fmt.Sprintf("before restore of %s", snapshot.Name)); backup != nil {
+			result.BackupId = &backup.Id
+		}
+	}
+
+	// Objects of files removed or replaced by the restore are deleted once they are not referenced anymore
+	var replacedFiles []worldSnapshotReplacedFile
+	if err1 == nil {
+		replacedFiles, err1 = getWorldFileUrls(ctx, tx, worldId)
+	}
+
+	//region Objects of deleted classes can not be restored
+	var classes map[uuid.UUID]bool
+	if err1 == nil {
+		var classIds []uuid.UUID
+		for _, o := range snapshot.Objects {
+			classIds = append(classIds, o.PlaceableClassId)
+		}
+		classes, err1 = queryExistingIds(ctx, tx, `SELECT pc.id FROM placeable_classes pc WHERE pc.id = ANY($1)`, classIds /*$1*/)
+	}
+
+	var (
+		objects []WorldSnapshotObject
+		keep    []uuid.UUID
+	)
+	for _, o := range snapshot.Objects {
+		if !classes[o.PlaceableClassId] {
+			result.SkippedObjects = append(result.SkippedObjects, o.Id)
+			continue
+		}
+		objects = append(objects, o)
+		keep = append(keep, o.Id)
+	}
+	//endregion
+
+	//region Remove objects added since the snapshot
+	if err1 == nil {
+		var removed map[uuid.UUID]bool
+		removed, err1 = queryExistingIds(ctx, tx, `DELETE FROM placeables p WHERE p.space_id = $1 AND NOT (p.id = ANY($2)) RETURNING p.id`, worldId /*$1*/, keep /*$2*/)
+		if err1 == nil && len(removed) > 0 {
+			var ids []uuid.UUID
+			for id := range removed {
+				ids = append(ids, id)
+			}
+			q = `DELETE FROM entities e WHERE e.id = ANY($1)`
+			_, err1 = tx.Exec(ctx, q, ids /*$1*/)
+		}
+		result.Removed = len(removed)
+	}
+	//endregion
+
+	if err1 == nil {
+		for _, o := range objects {
+			var skipped []uuid.UUID
+			if skipped, err1 = restoreWorldSnapshotObject(ctx, tx, requester, worldId, o); err1 != nil {
+				err1 = fmt.Errorf("failed to restore %s %s: %v", objectSingular, o.Id, err1)
+				break
+			}
+			result.SkippedFiles = append(result.SkippedFiles, skipped...)
+			result.Restored++
+		}
+	}
+
+	if err1 != nil {
+		logrus.Errorf("failed to restore %s %s of %s @ %s: %v", worldSnapshotSingular, snapshotId, worldId, reflect.FunctionName(), err1)
+		if err2 := tx.Rollback(ctx); err2 != nil {
+			return nil, fmt.Errorf("failed to rollback failed tx: %v, %v", err1, err2)
+		}
+		return nil, fmt.Errorf("failed to restore the %s", worldSnapshotSingular)
+	}
+
+	if err1 = tx.Commit(ctx); err1 != nil {
+		return nil, fmt.Errorf("failed to commit tx: %v", err1)
+	}
+
+	deleteReplacedWorldFileObjects(ctx, replacedFiles)
+
+	return result, nil
+}
+
+// RestoreWorldSnapshotForAdmin Replaces the layout of the world with the snapshot
+func RestoreWorldSnapshotForAdmin(ctx context.Context, requester *sm.User, worldId uuid.UUID, snapshotId uuid.UUID) (result *WorldSnapshotRestoreResult, err error) {
+	return restoreWorldSnapshot(ctx, requester, worldId, snapshotId)
+}
+
+// RestoreWorldSnapshotForRequester Replaces the layout of the world with the snapshot if the requester can edit the world
+func RestoreWorldSnapshotForRequester(ctx context.Context, requester *sm.User, worldId uuid.UUID, snapshotId uuid.UUID) (result *WorldSnapshotRestoreResult, err error) {
+	canEdit, err := EntityEditable(ctx, requester.Id, worldId)
+	if err != nil {
+		return nil, err
+	}
+
+	if !canEdit {
+		return nil, errors.New("no access")
+	}
+
+	return restoreWorldSnapshot(ctx, requester, worldId, snapshotId)
+}
+
+//endregion
@@ -0,0 +1,82 @@
+package model
+
+import (
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestDiffWorldLayouts(t *testing.T) {
+	classId := uuid.FromStringOrNil("00000000-0000-4000-8000-000000000100")
+	entityId := uuid.FromStringOrNil("00000000-0000-4000-8000-000000000200")
+	fileId := uuid.FromStringOrNil("00000000-0000-4000-8000-000000000300")
+
+	object := func(id string) WorldSnapshotObject {
+		return WorldSnapshotObject{
+			Id:               uuid.FromStringOrNil(id),
+			PlaceableClassId: classId,
+			ScaleX:           1,
+			ScaleY:           1,
+			ScaleZ:           1,
+			Properties:       []WorldSnapshotProperty{{Type: "string", Name: "title", Value: "Gallery"}},
+			Files:            []WorldSnapshotFile{{Id: fileId, Type: "image_full", Url: "https://example.com/image.png"}},
+		}
+	}
+
+	unchanged := object("00000000-0000-4000-8000-000000000001")
+	moved := object("00000000-0000-4000-8000-000000000002")
+	removed := object("00000000-0000-4000-8000-000000000003")
+	added := object("00000000-0000-4000-8000-000000000004")
+
+	movedTo := moved
+	movedTo.OffsetX = 10
+	movedTo.EntityId = &entityId
+	movedTo.Properties = []WorldSnapshotProperty{{Type: "string", Name: "title", Value: "Museum"}}
+	movedTo.Files = []WorldSnapshotFile{{Id: fileId, Type: "image_full", Url: "https://example.com/image-2.png"}}
+
+	// Properties and files are compared regardless of their order
+	reordered := unchanged
+	reordered.Properties = []WorldSnapshotProperty{{Type: "string", Name: "author", Value: "Artist"}, {Type: "string", Name: "title", Value: "Gallery"}}
+	unchanged.Properties = []WorldSnapshotProperty{{Type: "string", Name: "title", Value: "Gallery"}, {Type: "string", Name: "author", Value: "Artist"}}
+
+	diff := diffWorldLayouts([]WorldSnapshotObject{unchanged, moved, removed}, []WorldSnapshotObject{reordered, movedTo, added})
+
+	if assert.Len(t, diff.Added, 1) {
+		assert.Equal(t, added.Id, diff.Added[0].Id)
+	}
+
+	if assert.Len(t, diff.Removed, 1) {
+		assert.Equal(t, removed.Id, diff.Removed[0].Id)
+	}
+
+	if assert.Len(t, diff.Changed, 1) {
+		assert.Equal(t, moved.Id, diff.Changed[0].Id)
+		assert.Equal(t, []string{"entityId", "transform", "properties", "files"}, diff.Changed[0].Fields)
+		assert.Equal(t, moved.OffsetX, diff.Changed[0].From.OffsetX)
+		assert.Equal(t, movedTo.OffsetX, diff.Changed[0].To.OffsetX)
+	}
+}
+
+func TestDiffWorldLayoutsEmpty(t *testing.T) {
+	diff := diffWorldLayouts(nil, nil)
+
+	// Empty lists are returned so clients get arrays rather than nulls
+	assert.NotNil(t, diff.Added)
+	assert.NotNil(t, diff.Removed)
+	assert.NotNil(t, diff.Changed)
+	assert.Empty(t, diff.Added)
+	assert.Empty(t, diff.Removed)
+	assert.Empty(t, diff.Changed)
+}
+
+func TestDiffWorldLayoutsRemovedOrder(t *testing.T) {
+	a := WorldSnapshotObject{Id: uuid.FromStringOrNil("00000000-0000-4000-8000-00000000000a")}
+	b := WorldSnapshotObject{Id: uuid.FromStringOrNil("00000000-0000-4000-8000-00000000000b")}
+	c := WorldSnapshotObject{Id: uuid.FromStringOrNil("00000000-0000-4000-8000-00000000000c")}
+
+	diff := diffWorldLayouts([]WorldSnapshotObject{c, a, b}, nil)
+
+	if assert.Len(t, diff.Removed, 3) {
+		assert.Equal(t, []uuid.UUID{a.Id, b.Id, c.Id}, []uuid.UUID{diff.Removed[0].Id, diff.Removed[1].Id, diff.Removed[2].Id})
+	}
+}
@@ -0,0 +1,250 @@
+package model
+
+import (
+	"context"
+	sm "dev.hackerman.me/artheon/veverse-shared/model"
+	"errors"
+	"fmt"
+	"github.com/gofrs/uuid"
+	"github.com/jackc/pgx/v5"
+	"veverse-api/database"
+)
+
+// WorldTemplate is the world listed in the template picker
+type WorldTemplate struct {
+	Id          uuid.UUID  `json:"id"`
+	Name        string     `json:"name"`
+	Description string     `json:"description,omitempty"`
+	Map         string     `json:"map,omitempty"`
+	PackageId   *uuid.UUID `json:"metaverseId,omitempty"`
+	ObjectCount int64      `json:"objectCount"`
+	PreviewUrl  *string    `json:"previewUrl,omitempty"`
+}
+
+// WorldCloneMetadata Clone request metadata
+type WorldCloneMetadata struct {
+	Name   *string `json:"name,omitempty"`   // Name of the new world, the source name with the copy suffix by default
+	Public *bool   `json:"public,omitempty"` // Visibility of the new world, private by default
+	Files  bool    `json:"files,omitempty"`  // Copy files of the world and its objects
+}
+
+// WorldTemplateUpdateMetadata Template flag update request metadata
+type WorldTemplateUpdateMetadata struct {
+	Template bool `json:"template"`
+}
+
+// indexWorldTemplates Index template worlds, requester templates are limited to the worlds the requester can view
+func indexWorldTemplates(ctx context.Context, requester *sm.User, offset int64, limit int64) (entities []WorldTemplate, total int64, err error) {
+	db := database.DB
+
+	q := `FROM spaces s
+    JOIN entities e ON e.id = s.id
+WHERE s.template`
+	args := []interface{}{}
+
+	if requester != nil {
+		q += `
+  AND (e.public OR EXISTS(SELECT 1 FROM accessibles a WHERE a.entity_id = e.id AND a.user_id = $1 AND (a.can_view OR a.is_owner)))`
+		args = append(args, requester.Id /*$1*/)
+	}
+
+	if err = db.QueryRow(ctx, `SELECT COUNT(*) `+q, args...).Scan(&total); err != nil {
+		return nil, -1, err
+	}
+
+	if total == 0 {
+		return []WorldTemplate{}, 0, nil
+	}
+
+	n := len(args)
+	q = fmt.Sprintf(`SELECT s.id,
+       coalesce(s.name, ''),
+       coalesce(s.description, ''),
+       coalesce(s.map, ''),
+       s.mod_id,
+       (SELECT COUNT(*) FROM placeables p WHERE p.space_id = s.id),
+       (SELECT preview.url FROM files preview WHERE preview.entity_id = s.id AND preview.type = 'image_preview' ORDER BY preview.variation LIMIT 1)
+%s
+ORDER BY s.name, s.id
+OFFSET $%d LIMIT $%d`, q, n+1, n+2)
+	rows, err := db.Query(ctx, q, append(args, offset, limit)...)
+	if err != nil {
+		return nil, -1, err
+	}
+
+	defer func() {
+		rows.Close()
+		database.LogPgxStat("indexWorldTemplates")
+	}()
+
+	entities = []WorldTemplate{}
+	for rows.Next() {
+		var e WorldTemplate
+		if err = rows.Scan(&e.Id, &e.Name, &e.Description, &e.Map, &e.PackageId, &e.ObjectCount, &e.PreviewUrl); err != nil {
+			return nil, -1, err
+		}
+		entities = append(entities, e)
+	}
+
+	return entities, total, rows.Err()
+}
+
+// IndexWorldTemplatesForAdmin Index all template worlds
+func IndexWorldTemplatesForAdmin(ctx context.Context, offset int64, limit int64) (entities []WorldTemplate, total int64, err error) {
+	return indexWorldTemplates(ctx, nil, offset, limit)
+}
+
+// IndexWorldTemplatesForRequester Index template worlds the requester can view
+func IndexWorldTemplatesForRequester(ctx context.Context, requester *sm.User, offset int64, limit int64) (entities []WorldTemplate, total int64, err error) {
+	return indexWorldTemplates(ctx, requester, offset, limit)
+}
+
+// SetWorldTemplateForAdmin Marks the world as the template or removes it from templates
+func SetWorldTemplateForAdmin(ctx context.Context, worldId uuid.UUID, template bool) (err error) {
+	db := database.DB
+
+	q := `UPDATE spaces SET template = $2 WHERE id = $1`
+	tag, err := db.Exec(ctx, q, worldId /*$1*/, template /*$2*/)
+	if err != nil {
+		return fmt.Errorf("failed to update the world: %v", err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+
+	return nil
+}
+
+// cloneWorld Copies the world metadata, objects, portals, properties and optionally files into a new world owned by the requester
+func cloneWorld(ctx context.Context, requester *sm.User, admin bool, sourceId uuid.UUID, m WorldCloneMetadata) (worldId uuid.UUID, err error) {
+	manifest, files, err := getWorldBundleManifest(ctx, sourceId)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	manifest.World.Name = fmt.Sprintf("%s (copy)", manifest.World.Name)
+	if m.Name != nil && *m.Name != "" {
+		manifest.World.Name = *m.Name
+	}
+
+	manifest.World.Public = m.Public != nil && *m.Public
+
+	b := &worldBundleImport{
+		manifest:     manifest,
+		ids:          map[uuid.UUID]uuid.UUID{},
+		classes:      map[uuid.UUID]uuid.UUID{},
+		references:   map[uuid.UUID]bool{},
+		sources:      files,
+		hasPackageId: manifest.World.PackageId != nil,
+	}
+
+	// Classes of the source world exist
+	for _, c := range manifest.Classes {
+		b.classes[c.Id] = c.Id
+	}
+
+	//region Files
+	var bytes int64
+	cloneFiles := func(files []WorldBundleFile) (cloned []WorldBundleFile) {
+		cloned = []WorldBundleFile{}
+		if !m.Files {
+			return cloned
+		}
+
+		for _, f := range files {
+			// Infected files are not copied, pending files are scanned again
+			if s := b.sources[f.Id].ScanStatus; s != nil && *s == FileScanInfected {
+				continue
+			}
+			if f.Entry != "" && f.Size != nil {
+				bytes += *f.Size
+			}
+			cloned = append(cloned, f)
+		}
+		return cloned
+	}
+
+	manifest.World.Files = cloneFiles(manifest.World.Files)
+	for i := range manifest.Objects {
+		manifest.Objects[i].Files = cloneFiles(manifest.Objects[i].Files)
+	}
+
+	if !admin && bytes > 0 {
+		if err = checkStorageQuota(ctx, requester.Id, uuid.Nil, bytes, uuid.Nil); err != nil {
+			return uuid.Nil, err
+		}
+	}
+	//endregion
+
+	//region New ids
+	ids := []uuid.UUID{manifest.World.Id}
+	for _, f := range manifest.World.Files {
+		ids = append(ids, f.Id)
+	}
+	for _, o := range manifest.Objects {
+		ids = append(ids, o.Id)
+		for _, f := range o.Files {
+			ids = append(ids, f.Id)
+		}
+	}
+	for _, p := range manifest.Portals {
+		ids = append(ids, p.Id)
+	}
+
+	for _, id := range ids {
+		if b.ids[id], err = uuid.NewV4(); err != nil {
+			return uuid.Nil, fmt.Errorf("failed to generate uuid: %v", err)
+		}
+	}
+	//endregion
+
+	if err = b.resolveReferences(ctx); err != nil {
+		return uuid.Nil, err
+	}
+
+	return importWorldBundle(ctx, requester, b)
+}
+
+// CloneWorldForAdmin Copies the world into a new world owned by the requester
+func CloneWorldForAdmin(ctx context.Context, requester *sm.User, sourceId uuid.UUID, m WorldCloneMetadata) (entity *World, err error) {
+	worldId, err := cloneWorld(ctx, requester, true, sourceId, m)
+	if err != nil {
+		return nil, err
+	}
+
+	return GetWorldForAdmin(ctx, requester, worldId)
+}
+
+// CloneWorldForRequester Copies the world into a new world owned by the requester if the requester can edit the world or the world is a template the requester can view
+func CloneWorldForRequester(ctx context.Context, requester *sm.User, sourceId uuid.UUID, m WorldCloneMetadata) (entity *World, err error) {
+	db := database.DB
+
+	var template bool
+	q := `SELECT s.template FROM spaces s WHERE s.id = $1`
+	if err = db.QueryRow(ctx, q, sourceId /*$1*/).Scan(&template); err != nil {
+		return nil, err
+	}
+
+	var canClone bool
+	if template {
+		canClone, err = EntityViewable(ctx, requester.Id, sourceId)
+	} else {
+		canClone, err = EntityEditable(ctx, requester.Id, sourceId)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !canClone {
+		return nil, errors.New("no access")
+	}
+
+	worldId, err := cloneWorld(ctx, requester, false, sourceId, m)
+	if err != nil {
+		return nil, err
+	}
+
+	return GetWorldForRequester(ctx, requester, worldId)
+}
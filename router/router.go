@@ -59,12 +59,17 @@ func SetupRoutes(app *fiber.App) {
 	oauth.Get("/:provider/logout", handler.OAuthLogout)
 	//endregion
 
+	//region Search
+	api.Get("/search", middleware.ProtectedJwt(), handler.Search)
+	//endregion
+
 	//region Entity
 	entity := api.Group("/entities")
 	entity.Get("/:id", middleware.ProtectedJwt(), handler.GetEntity)
 	entity.Delete("/:id", middleware.ProtectedJwt(), handler.DeleteEntity)
 	entity.Post("/:id/views", middleware.ProtectedJwt(), handler.IncrementEntityView)
 	entity.Get("/:id/files", middleware.ProtectedJwt(), handler.IndexFiles)
+	entity.Get("/:id/files/archive", middleware.ProtectedJwt(), handler.DownloadFileArchive)
 	entity.Put("/:id/files/upload", middleware.ProtectedJwt(), handler.UploadFile)
 	entity.Put("/:id/files/link", middleware.ProtectedJwt(), handler.LinkFile)
 	entity.Delete("/files/:id", middleware.ProtectedJwt(), handler.DeleteFile)
@@ -79,6 +84,11 @@ func SetupRoutes(app *fiber.App) {
 	entity.Put("/:id/like", middleware.ProtectedJwt(), handler.LikeEntity)
 	entity.Put("/:id/dislike", middleware.ProtectedJwt(), handler.DislikeEntity)
 	entity.Put("/:id/unlike", middleware.ProtectedJwt(), handler.UnlikeEntity)
+	entity.Get("/:id/relationships", middleware.ProtectedJwt(), handler.IndexEntityRelationships)
+	entity.Get("/:id/relationships/inbound", middleware.ProtectedJwt(), handler.IndexEntityInboundRelationships)
+	entity.Post("/:id/relationships", middleware.ProtectedJwt(), handler.CreateEntityRelationship)
+	entity.Patch("/relationships/:id", middleware.ProtectedJwt(), handler.UpdateEntityRelationship)
+	entity.Delete("/relationships/:id", middleware.ProtectedJwt(), handler.DeleteEntityRelationship)
 	//endregion
 
 	//region Files
@@ -87,6 +97,26 @@ func SetupRoutes(app *fiber.App) {
 	file.Get("/download", middleware.ProtectedJwt(), handler.GetFileDownloadLink)
 	file.Get("/download-pre-signed", middleware.ProtectedJwt(), handler.GetFilePreSignedDownloadLink)
 	file.Get("/download-pre-signed-url", middleware.ProtectedJwt(), handler.GetFilePreSignedDownloadLinkByURL)
+	file.Get("/exists", middleware.ProtectedJwt(), handler.GetFileBlobExists)
+	file.Get("/storage", middleware.ProtectedJwt(), handler.IndexStorageUsage)
+	file.Post("/orphans", middleware.ProtectedJwt(), handler.IndexOrphanedObjects)
+	file.Delete("/orphans", middleware.ProtectedJwt(), handler.DeleteOrphanedObjects)
+	file.Get("/orphans/runs", middleware.ProtectedJwt(), handler.GetObjectGcRun)
+	file.Get("/orphans/runs/:id", middleware.ProtectedJwt(), handler.GetObjectGcRun)
+	file.Get("/:id/content", middleware.OptionalJwt(), handler.DownloadFile)
+	file.Get("/:id/versions", middleware.ProtectedJwt(), handler.IndexFileVersions)
+	file.Post("/:id/versions/:versionId/rollback", middleware.ProtectedJwt(), handler.RollbackFileVersion)
+	file.Post("/uploads", middleware.ProtectedJwt(), handler.InitiateFileUpload)
+	file.Get("/uploads/:id/parts", middleware.ProtectedJwt(), handler.IndexFileUploadParts)
+	file.Get("/uploads/:id/parts/:part", middleware.ProtectedJwt(), handler.GetFileUploadPartLink)
+	file.Post("/uploads/:id/complete", middleware.ProtectedJwt(), handler.CompleteFileUpload)
+	file.Delete("/uploads/:id", middleware.ProtectedJwt(), handler.AbortFileUpload)
+	//endregion
+
+	//region Storage (objects stored at the local filesystem when the S3 storage is not used)
+	storage := api.Group("/storage")
+	storage.Get("/*", handler.GetStorageObject)
+	storage.Put("/*", handler.PutStorageObject)
 	//endregion
 
 	//region World
@@ -99,11 +129,26 @@ func SetupRoutes(app *fiber.App) {
 	world := api.Group("/worlds")
 	world.Get("", middleware.ProtectedJwt(), handler.IndexWorlds)
 	world.Post("/v2", middleware.ProtectedJwt(), handler.IndexWorldsV2)
+	world.Get("/templates", middleware.ProtectedJwt(), handler.IndexWorldTemplates)
 	world.Post("/:id/v2", middleware.ProtectedJwt(), handler.GetWorldV2)
 	world.Get("/:id", middleware.ProtectedJwt(), handler.GetWorld)
 	world.Get("/:id/objects", middleware.ProtectedJwt(), handler.IndexWorldPlaceables)
 	world.Post("/:id/objects", middleware.ProtectedJwt(), handler.CreateWorldPlaceable)
+	world.Post("/:id/objects\\:batch", middleware.ProtectedJwt(), handler.BatchWorldPlaceables)
+	world.Get("/:id/export", middleware.ProtectedJwt(), handler.ExportWorld)
+	world.Post("/:id/clone", middleware.ProtectedJwt(), handler.CloneWorld)
+	world.Get("/:id/routes", middleware.ProtectedJwt(), handler.GetWorldRoute)
+	world.Put("/:id/template", middleware.ProtectedJwt(), handler.SetWorldTemplate)
+	world.Get("/:id/package-version", middleware.ProtectedJwt(), handler.GetWorldPackageVersion)
+	world.Put("/:id/package-version", middleware.ProtectedJwt(), handler.PinWorldPackageVersion)
+	world.Get("/:id/snapshots", middleware.ProtectedJwt(), handler.IndexWorldSnapshots)
+	world.Post("/:id/snapshots", middleware.ProtectedJwt(), handler.CreateWorldSnapshot)
+	world.Get("/:id/snapshots/diff", middleware.ProtectedJwt(), handler.DiffWorldSnapshots)
+	world.Get("/:id/snapshots/:snapshotId", middleware.ProtectedJwt(), handler.GetWorldSnapshot)
+	world.Delete("/:id/snapshots/:snapshotId", middleware.ProtectedJwt(), handler.DeleteWorldSnapshot)
+	world.Post("/:id/snapshots/:snapshotId/restore", middleware.ProtectedJwt(), handler.RestoreWorldSnapshot)
 	world.Post("", middleware.ProtectedJwt(), handler.CreateWorld)
+	world.Post("/import", middleware.ProtectedJwt(), handler.ImportWorld)
 	world.Patch("/:id", middleware.ProtectedJwt(), handler.UpdateWorld)
 	world.Delete("/:id", middleware.ProtectedJwt(), handler.DeleteWorld)
 	//endregion
@@ -117,12 +162,14 @@ func SetupRoutes(app *fiber.App) {
 	// region Art Objects
 	artObject := api.Group("/art-objects")
 	artObject.Get("", middleware.ProtectedJwt(), handler.IndexArtObjects)
+	artObject.Get("/facets", middleware.ProtectedJwt(), handler.GetArtObjectFacets)
 	artObject.Get("/:id", middleware.ProtectedJwt(), handler.GetArtObject)
 
 	//region Portal
 	portal := api.Group("/portals")
 	portal.Get("", middleware.ProtectedJwt(), handler.IndexPortals)
 	portal.Get("/:id", middleware.ProtectedJwt(), handler.GetPortal)
+	portal.Get("/:id/inbound", middleware.ProtectedJwt(), handler.IndexInboundPortals)
 	portal.Post("", middleware.ProtectedJwt(), handler.CreatePortal)
 	portal.Patch("/:id", middleware.ProtectedJwt(), handler.UpdatePortal)
 	//endregion
@@ -146,6 +193,13 @@ func SetupRoutes(app *fiber.App) {
 	packages.Post("", middleware.ProtectedJwt(), handler.CreatePackage)
 	packages.Patch("/:id", middleware.ProtectedJwt(), handler.UpdatePackage)
 	packages.Get("/:id/maps", middleware.ProtectedJwt(), handler.IndexPackageMaps)
+	packages.Get("/:id/dependencies", middleware.ProtectedJwt(), handler.IndexPackageDependencies)
+	packages.Put("/:id/dependencies", middleware.ProtectedJwt(), handler.SetPackageDependencies)
+	packages.Get("/:id/resolve", middleware.ProtectedJwt(), handler.ResolvePackage)
+	packages.Get("/:id/versions", middleware.ProtectedJwt(), handler.IndexPackageVersions)
+	packages.Post("/:id/versions", middleware.ProtectedJwt(), handler.CreatePackageVersion)
+	packages.Get("/:id/versions/:version", middleware.ProtectedJwt(), handler.GetPackageVersion)
+	packages.Patch("/:id/versions/:version", middleware.ProtectedJwt(), handler.UpdatePackageVersion)
 	//packages.Get("/:id/worlds", middleware.ProtectedJwt(), handler.IndexPackageWorlds)
 	//endregion
 
@@ -155,6 +209,7 @@ func SetupRoutes(app *fiber.App) {
 	user.Get("/nonce", handler.GetNonce)
 	user.Get("/me", middleware.ProtectedJwt(), handler.GetMe)                                  // Get requester metadata
 	user.Put("/me/name", middleware.ProtectedJwt(), handler.SetName)                           // Set requester name
+	user.Get("/me/storage", middleware.ProtectedJwt(), handler.GetRequesterStorageUsage)       // Get requester storage usage
 	user.Get("", middleware.ProtectedJwt(), handler.IndexUsers)                                // Index users
 	user.Get("/:id", middleware.ProtectedJwt(), handler.GetUser)                               // Get single user
 	user.Get("/:id/followers", middleware.ProtectedJwt(), handler.IndexFollowers)              // Get user followers
@@ -217,6 +272,8 @@ func SetupRoutes(app *fiber.App) {
 	releases.Get("", middleware.ProtectedJwt(), handler.IndexReleases)
 	releases.Get("/latest", handler.GetLatestReleaseV2Public)
 	releases.Get(":id", middleware.ProtectedJwt(), handler.GetRelease)
+	releases.Get("/:id/manifest", middleware.OptionalJwt(), handler.GetReleaseManifest)
+	releases.Get("/:id/delta", middleware.OptionalJwt(), handler.GetReleaseDelta)
 	//endregion
 
 	//region Jobs
@@ -0,0 +1,110 @@
+package scanner
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+const (
+	clamdDefaultAddress = "unix:/var/run/clamav/clamd.ctl"
+	clamdChunkSize      = 64 * 1024
+	clamdTimeout        = 10 * time.Minute // Default timeout of a single scan if the context has no deadline
+)
+
+// clamdScanner streams contents to the ClamAV daemon using the INSTREAM command
+type clamdScanner struct {
+	network string
+	address string
+}
+
+func newClamdScanner(address string) (*clamdScanner, error) {
+	if address == "" {
+		address = clamdDefaultAddress
+	}
+
+	network, addr, ok := strings.Cut(address, ":")
+	if !ok || (network != "unix" && network != "tcp") || addr == "" {
+		return nil, fmt.Errorf("invalid clamd address: %s", address)
+	}
+
+	return &clamdScanner{network: network, address: addr}, nil
+}
+
+func (s *clamdScanner) Scan(ctx context.Context, r io.Reader) (signature string, err error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, s.network, s.address)
+	if err != nil {
+		return "", fmt.Errorf("failed to connect to clamd: %v", err)
+	}
+	defer conn.Close()
+
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(clamdTimeout)
+	}
+	if err = conn.SetDeadline(deadline); err != nil {
+		return "", err
+	}
+
+	if _, err = conn.Write([]byte("zINSTREAM\x00")); err != nil {
+		return "", fmt.Errorf("failed to send clamd command: %v", err)
+	}
+
+	// Each chunk is prefixed with its length, a zero length chunk ends the stream
+	var (
+		buf    = make([]byte, clamdChunkSize)
+		length = make([]byte, 4)
+	)
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			binary.BigEndian.PutUint32(length, uint32(n))
+			if _, err := conn.Write(length); err != nil {
+				return "", fmt.Errorf("failed to send clamd chunk: %v", err)
+			}
+			if _, err := conn.Write(buf[:n]); err != nil {
+				return "", fmt.Errorf("failed to send clamd chunk: %v", err)
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to read contents: %v", err)
+		}
+	}
+
+	binary.BigEndian.PutUint32(length, 0)
+	if _, err = conn.Write(length); err != nil {
+		return "", fmt.Errorf("failed to end clamd stream: %v", err)
+	}
+
+	reply, err := io.ReadAll(conn)
+	if err != nil {
+		return "", fmt.Errorf("failed to read clamd reply: %v", err)
+	}
+
+	return parseClamdReply(string(bytes.TrimRight(reply, "\x00\n")))
+}
+
+// parseClamdReply parses "stream: OK", "stream: {signature} FOUND" and "{message} ERROR" replies
+func parseClamdReply(reply string) (signature string, err error) {
+	result := strings.TrimPrefix(reply, "stream: ")
+
+	switch {
+	case result == "OK":
+		return "", nil
+	case strings.HasSuffix(result, " FOUND"):
+		return strings.TrimSuffix(result, " FOUND"), nil
+	case strings.HasSuffix(result, " ERROR"):
+		return "", fmt.Errorf("clamd error: %s", strings.TrimSuffix(result, " ERROR"))
+	default:
+		return "", fmt.Errorf("unexpected clamd reply: %s", reply)
+	}
+}
@@ -0,0 +1,38 @@
+package scanner
+
+import (
+	"bytes"
+	"context"
+	"io"
+)
+
+// EicarSignature is the name ClamAV reports for the EICAR test file
+const EicarSignature = "Eicar-Test-Signature"
+
+// Eicar is the standard anti-malware test file contents, detected by every scanner without being harmful
+const Eicar = `X5O!P%@AP[4\PZX54(P^)7CC)7}$EICAR-STANDARD-ANTIVIRUS-TEST-FILE!$H+H*`
+
+// fakeScanner reports contents containing the EICAR test file as infected, used in tests and development without the ClamAV daemon
+type fakeScanner struct{}
+
+func (fakeScanner) Scan(ctx context.Context, r io.Reader) (string, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return "", err
+	}
+
+	if err = ctx.Err(); err != nil {
+		return "", err
+	}
+
+	if bytes.Contains(data, []byte(Eicar)) {
+		return EicarSignature, nil
+	}
+
+	return "", nil
+}
+
+// NewFakeScanner returns the scanner detecting only the EICAR test file
+func NewFakeScanner() Scanner {
+	return fakeScanner{}
+}
@@ -0,0 +1,69 @@
+package scanner
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Scanner checks uploaded file contents for malware
+type Scanner interface {
+	// Scan reads the contents and returns the name of the detected signature, empty if the contents are clean
+	Scan(ctx context.Context, r io.Reader) (signature string, err error)
+}
+
+const (
+	BackendNone  = "none"
+	BackendClamd = "clamd"
+	BackendFake  = "fake"
+)
+
+var (
+	backend      = os.Getenv("FILE_SCANNER")               // none (default, files are not scanned), clamd or fake (only the EICAR test file is detected)
+	clamdAddress = os.Getenv("FILE_SCANNER_CLAMD_ADDRESS") // unix:/path/to/socket or tcp:host:port of the ClamAV daemon (default unix:/var/run/clamav/clamd.ctl)
+)
+
+var scanner Scanner = noopScanner{}
+
+// noopScanner reports all contents as clean
+type noopScanner struct{}
+
+func (noopScanner) Scan(_ context.Context, _ io.Reader) (string, error) {
+	return "", nil
+}
+
+// Setup initializes the scanner configured by the FILE_SCANNER env
+func Setup() (err error) {
+	switch backend {
+	case "", BackendNone:
+		scanner = noopScanner{}
+	case BackendClamd:
+		scanner, err = newClamdScanner(clamdAddress)
+	case BackendFake:
+		scanner = fakeScanner{}
+	default:
+		return fmt.Errorf("unsupported file scanner: %s", backend)
+	}
+
+	return err
+}
+
+// SetScanner replaces the configured scanner (e.g. with a fake in tests), nil disables scanning
+func SetScanner(s Scanner) {
+	if s == nil {
+		s = noopScanner{}
+	}
+	scanner = s
+}
+
+// Enabled returns false if files are not scanned and can be served right after the upload
+func Enabled() bool {
+	_, ok := scanner.(noopScanner)
+	return !ok
+}
+
+// Scan reads the contents and returns the name of the detected signature, empty if the contents are clean
+func Scan(ctx context.Context, r io.Reader) (signature string, err error) {
+	return scanner.Scan(ctx, r)
+}
@@ -0,0 +1,172 @@
+package scanner
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net"
+	"strings"
+	"testing"
+)
+
+// serveClamd accepts a single INSTREAM session and replies as the ClamAV daemon, contents with the EICAR test file are reported as infected
+func serveClamd(t *testing.T, reply string) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = l.Close() })
+
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		command := make([]byte, len("zINSTREAM\x00"))
+		if _, err = io.ReadFull(conn, command); err != nil || string(command) != "zINSTREAM\x00" {
+			_, _ = conn.Write([]byte("UNKNOWN COMMAND ERROR\x00"))
+			return
+		}
+
+		var contents bytes.Buffer
+		length := make([]byte, 4)
+		for {
+			if _, err = io.ReadFull(conn, length); err != nil {
+				return
+			}
+			n := binary.BigEndian.Uint32(length)
+			if n == 0 {
+				break
+			}
+			if _, err = io.CopyN(&contents, conn, int64(n)); err != nil {
+				return
+			}
+		}
+
+		if reply == "" {
+			reply = "stream: OK"
+			if bytes.Contains(contents.Bytes(), []byte(Eicar)) {
+				reply = "stream: " + EicarSignature + " FOUND"
+			}
+		}
+
+		_, _ = conn.Write([]byte(reply + "\x00"))
+	}()
+
+	return "tcp:" + l.Addr().String()
+}
+
+func TestParseClamdReply(t *testing.T) {
+	tests := []struct {
+		name      string
+		reply     string
+		signature string
+		err       bool
+	}{
+		{"clean", "stream: OK", "", false},
+		{"infected", "stream: Eicar-Test-Signature FOUND", "Eicar-Test-Signature", false},
+		{"error", "INSTREAM size limit exceeded. ERROR", "", true},
+		{"unexpected", "PONG", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			signature, err := parseClamdReply(tt.reply)
+			assert.Equal(t, tt.signature, signature, tt.reply)
+			assert.Equal(t, tt.err, err != nil, tt.reply)
+		})
+	}
+}
+
+func TestClamdScanner(t *testing.T) {
+	tests := []struct {
+		name      string
+		contents  string
+		reply     string
+		signature string
+		err       bool
+	}{
+		{"clean", "hello world", "", "", false},
+		{"empty", "", "", "", false},
+		{"infected", "prefix " + Eicar + " suffix", "", EicarSignature, false},
+		{"large", strings.Repeat("a", 3*clamdChunkSize+1), "", "", false},
+		{"daemon error", "hello world", "INSTREAM size limit exceeded. ERROR", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := newClamdScanner(serveClamd(t, tt.reply))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			signature, err := s.Scan(context.Background(), strings.NewReader(tt.contents))
+			assert.Equal(t, tt.signature, signature)
+			assert.Equal(t, tt.err, err != nil, err)
+		})
+	}
+}
+
+func TestClamdAddress(t *testing.T) {
+	tests := []struct {
+		address string
+		valid   bool
+	}{
+		{"", true},
+		{"unix:/var/run/clamav/clamd.ctl", true},
+		{"tcp:127.0.0.1:3310", true},
+		{"udp:127.0.0.1:3310", false},
+		{"tcp:", false},
+		{"127.0.0.1:3310", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.address, func(t *testing.T) {
+			_, err := newClamdScanner(tt.address)
+			assert.Equal(t, tt.valid, err == nil, err)
+		})
+	}
+}
+
+func TestFakeScanner(t *testing.T) {
+	s := NewFakeScanner()
+
+	signature, err := s.Scan(context.Background(), strings.NewReader("hello world"))
+	if assert.NoError(t, err) {
+		assert.Empty(t, signature)
+	}
+
+	signature, err = s.Scan(context.Background(), strings.NewReader(Eicar))
+	if assert.NoError(t, err) {
+		assert.Equal(t, EicarSignature, signature)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = s.Scan(ctx, strings.NewReader("hello world"))
+	assert.Error(t, err, "cancelled scan")
+}
+
+func TestSetScanner(t *testing.T) {
+	t.Cleanup(func() { SetScanner(nil) })
+
+	SetScanner(nil)
+	assert.False(t, Enabled())
+
+	signature, err := Scan(context.Background(), strings.NewReader(Eicar))
+	if assert.NoError(t, err) {
+		assert.Empty(t, signature, "disabled scanner reports everything as clean")
+	}
+
+	SetScanner(NewFakeScanner())
+	assert.True(t, Enabled())
+
+	signature, err = Scan(context.Background(), strings.NewReader(Eicar))
+	if assert.NoError(t, err) {
+		assert.Equal(t, EicarSignature, signature)
+	}
+}
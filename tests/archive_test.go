@@ -0,0 +1,124 @@
+package tests
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"io/ioutil"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// checkArchiveLinks verifies that files linked to external urls are referenced in the _links.txt entry instead of being downloaded
+func checkArchiveLinks(t *testing.T, data []byte) {
+	r, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if !assert.NoError(t, err, "valid archive") {
+		return
+	}
+
+	for _, f := range r.File {
+		if f.Name != "_links.txt" {
+			continue
+		}
+
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		contents, _ := io.ReadAll(rc)
+		_ = rc.Close()
+
+		for _, line := range strings.Split(strings.TrimSpace(string(contents)), "\n") {
+			_, url, ok := strings.Cut(line, ": ")
+			assert.True(t, ok && url != "", line)
+		}
+	}
+}
+
+func TestFileArchive(t *testing.T) {
+	tests := []struct {
+		name         string
+		route        string
+		expectedCode int
+		admin        bool
+	}{
+		{
+			"get HTTP status 200",
+			"/v2/entities/XXXXXXXX-XXXX-XXXX-XXXX-XXXXXXXXXXXX/files/archive",
+			200,
+			false,
+		},
+		{
+			"get HTTP status 200",
+			"/v2/entities/XXXXXXXX-XXXX-XXXX-XXXX-XXXXXXXXXXXX/files/archive?type=pak&platform=Win64",
+			200,
+			true,
+		},
+		{
+			"get HTTP status 400 for invalid id",
+			"/v2/entities/invalid/files/archive",
+			400,
+			false,
+		},
+		{
+			"get HTTP status 404 for missing entity",
+			"/v2/entities/00000000-0000-4000-8000-000000000001/files/archive",
+			404,
+			true,
+		},
+		{
+			"get HTTP status 200",
+			"/v2/worlds/XXXXXXXX-XXXX-XXXX-XXXX-XXXXXXXXXXXX/export",
+			200,
+			true,
+		},
+		{
+			"get HTTP status 400 for invalid id",
+			"/v2/worlds/invalid/export",
+			400,
+			false,
+		},
+		{
+			"get HTTP status 404 for missing world",
+			"/v2/worlds/00000000-0000-4000-8000-000000000001/export",
+			404,
+			true,
+		},
+	}
+
+	app := createApp()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, err := login(app, tt.admin)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			req := httptest.NewRequest("GET", tt.route, nil)
+			req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+
+			resp, err := app.Test(req, -1)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			body, err := ioutil.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !assert.Equal(t, tt.expectedCode, resp.StatusCode, tt.name) {
+				fmt.Printf("%s\n", string(body))
+				return
+			}
+
+			if resp.StatusCode == 200 {
+				checkArchiveLinks(t, body)
+			}
+		})
+	}
+}
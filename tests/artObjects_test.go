@@ -0,0 +1,80 @@
+package tests
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestArtObjects(t *testing.T) {
+	tests := []struct {
+		name         string
+		route        string
+		expectedCode int
+		admin        bool
+	}{
+		{
+			"get HTTP status 200 for filtered objects",
+			"/v2/art-objects?artist=Vincent%20van%20Gogh&artist=Claude%20Monet&yearFrom=1850&yearTo=1900",
+			200,
+			false,
+		},
+		{
+			"get HTTP status 200 for filter values with commas",
+			"/v2/art-objects?medium=Oil%20on%20canvas,%20mounted&origin=Paris,%20France",
+			200,
+			false,
+		},
+		{
+			"get HTTP status 200 for objects sorted by date",
+			"/v2/art-objects?sort=date&order=desc",
+			200,
+			true,
+		},
+		{
+			"get HTTP status 400 for invalid sort",
+			"/v2/art-objects?sort=color",
+			400,
+			false,
+		},
+		{
+			"get HTTP status 200 for facets",
+			"/v2/art-objects/facets?medium=Oil%20on%20canvas&medium=Tempera",
+			200,
+			false,
+		},
+	}
+
+	app := createApp()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, err := login(app, tt.admin)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			req := httptest.NewRequest("GET", tt.route, nil)
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+
+			resp, err := app.Test(req, -1)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !assert.Equal(t, tt.expectedCode, resp.StatusCode, tt.name) {
+				body, err := ioutil.ReadAll(resp.Body)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				jsonStr := string(body)
+
+				fmt.Printf("%s\n", jsonStr)
+			}
+		})
+	}
+}
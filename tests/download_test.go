@@ -0,0 +1,58 @@
+package tests
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"veverse-api/model"
+)
+
+func TestParseByteRange(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		size   int64
+		offset int64
+		length int64
+		err    bool
+	}{
+		{"first bytes", "bytes=0-99", 1000, 0, 100, false},
+		{"middle bytes", "bytes=100-199", 1000, 100, 100, false},
+		{"single byte", "bytes=5-5", 1000, 5, 1, false},
+		{"open range", "bytes=900-", 1000, 900, 100, false},
+		{"end past size", "bytes=900-5000", 1000, 900, 100, false},
+		{"last byte", "bytes=999-", 1000, 999, 1, false},
+		{"suffix range", "bytes=-100", 1000, 900, 100, false},
+		{"suffix past size", "bytes=-5000", 1000, 0, 1000, false},
+		{"spaces", "bytes= 0-99 ", 1000, 0, 100, false},
+		{"start at size", "bytes=1000-", 1000, 0, 0, true},
+		{"start past size", "bytes=2000-3000", 1000, 0, 0, true},
+		{"end before start", "bytes=200-100", 1000, 0, 0, true},
+		{"zero suffix", "bytes=-0", 1000, 0, 0, true},
+		{"suffix of empty object", "bytes=-100", 0, 0, 0, true},
+		{"empty object", "bytes=0-", 0, 0, 0, true},
+		{"multiple ranges", "bytes=0-99,200-299", 1000, 0, 0, true},
+		{"other unit", "items=0-99", 1000, 0, 0, true},
+		{"no dash", "bytes=100", 1000, 0, 0, true},
+		{"empty spec", "bytes=-", 1000, 0, 0, true},
+		{"negative start", "bytes=-5-10", 1000, 0, 0, true},
+		{"signed start", "bytes=+5-10", 1000, 0, 0, true},
+		{"signed suffix", "bytes=-+5", 1000, 0, 0, true},
+		{"not a number", "bytes=a-b", 1000, 0, 0, true},
+		{"overflow", "bytes=0-99999999999999999999", 1000, 0, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			offset, length, err := model.ParseByteRange(tt.header, tt.size)
+			if tt.err {
+				assert.Equal(t, model.ErrInvalidRange, err, tt.header)
+				return
+			}
+
+			if assert.NoError(t, err, tt.header) {
+				assert.Equal(t, tt.offset, offset, tt.header)
+				assert.Equal(t, tt.length, length, tt.header)
+			}
+		})
+	}
+}
@@ -0,0 +1,107 @@
+package tests
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestFileVersions(t *testing.T) {
+	tests := []struct {
+		name         string
+		method       string
+		route        string
+		expectedCode int
+		admin        bool
+	}{
+		{
+			"get HTTP status 200",
+			"GET",
+			"/v2/files/XXXXXXXX-XXXX-XXXX-XXXX-XXXXXXXXXXXX/versions",
+			200,
+			true,
+		},
+		{
+			"get HTTP status 200",
+			"GET",
+			"/v2/files/XXXXXXXX-XXXX-XXXX-XXXX-XXXXXXXXXXXX/versions?offset=0&limit=10",
+			200,
+			false,
+		},
+		{
+			"get HTTP status 400 for invalid id",
+			"GET",
+			"/v2/files/invalid/versions",
+			400,
+			false,
+		},
+		{
+			"get HTTP status 404 for missing file",
+			"GET",
+			"/v2/files/00000000-0000-4000-8000-000000000001/versions",
+			404,
+			true,
+		},
+		{
+			"get HTTP status 400 for invalid version id",
+			"POST",
+			"/v2/files/XXXXXXXX-XXXX-XXXX-XXXX-XXXXXXXXXXXX/versions/invalid/rollback",
+			400,
+			true,
+		},
+		{
+			"get HTTP status 404 for missing version",
+			"POST",
+			"/v2/files/XXXXXXXX-XXXX-XXXX-XXXX-XXXXXXXXXXXX/versions/00000000-0000-4000-8000-000000000001/rollback",
+			404,
+			true,
+		},
+		{
+			"get HTTP status 404 for missing file",
+			"POST",
+			"/v2/files/00000000-0000-4000-8000-000000000001/versions/XXXXXXXX-XXXX-XXXX-XXXX-XXXXXXXXXXXX/rollback",
+			404,
+			false,
+		},
+		{
+			"get HTTP status 200",
+			"POST",
+			"/v2/files/XXXXXXXX-XXXX-XXXX-XXXX-XXXXXXXXXXXX/versions/XXXXXXXX-XXXX-XXXX-XXXX-XXXXXXXXXXXX/rollback",
+			200,
+			true,
+		},
+	}
+
+	app := createApp()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, err := login(app, tt.admin)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			req := httptest.NewRequest(tt.method, tt.route, nil)
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+
+			resp, err := app.Test(req, -1)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !assert.Equal(t, tt.expectedCode, resp.StatusCode, tt.name) {
+				body, err := ioutil.ReadAll(resp.Body)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				jsonStr := string(body)
+
+				fmt.Printf("%s\n", jsonStr)
+			}
+		})
+	}
+}
@@ -1,9 +1,13 @@
 package tests
 
 import (
+	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http/httptest"
+	"regexp"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -64,6 +68,24 @@ func TestIndexFiles(t *testing.T) {
 			200,
 			true,
 		},
+		{
+			"get HTTP status 200",
+			"/v2/entities/XXXXXXXX-XXXX-XXXX-XXXX-XXXXXXXXXXXX/files?limit=10&type=pak,release,image-preview&platform=Win64,Linux&mime=image/&min-size=1&updated-since=2023-01-01T00:00:00Z",
+			200,
+			false,
+		},
+		{
+			"get HTTP status 400",
+			"/v2/entities/XXXXXXXX-XXXX-XXXX-XXXX-XXXXXXXXXXXX/files?cursor=invalid",
+			400,
+			false,
+		},
+		{
+			"get HTTP status 400",
+			"/v2/entities/XXXXXXXX-XXXX-XXXX-XXXX-XXXXXXXXXXXX/files?updated-since=yesterday",
+			400,
+			true,
+		},
 	}
 
 	app := createApp()
@@ -97,3 +119,365 @@ func TestIndexFiles(t *testing.T) {
 		})
 	}
 }
+
+func TestFileBlobExists(t *testing.T) {
+	tests := []struct {
+		name         string
+		route        string
+		expectedCode int
+		admin        bool
+	}{
+		{
+			"get HTTP status 200",
+			"/v2/files/exists?hash=e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
+			200,
+			false,
+		},
+		{
+			"get HTTP status 400",
+			"/v2/files/exists?hash=invalid",
+			400,
+			false,
+		},
+		{
+			"get HTTP status 200",
+			"/v2/files/exists?hash=E3B0C44298FC1C149AFBF4C8996FB92427AE41E4649B934CA495991B7852B855",
+			200,
+			true,
+		},
+	}
+
+	app := createApp()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, err := login(app, tt.admin)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			req := httptest.NewRequest("GET", tt.route, nil)
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+
+			resp, err := app.Test(req, -1)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !assert.Equal(t, tt.expectedCode, resp.StatusCode, tt.name) {
+				body, err := ioutil.ReadAll(resp.Body)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				jsonStr := string(body)
+
+				fmt.Printf("%s\n", jsonStr)
+			}
+		})
+	}
+}
+
+func TestStorageUsage(t *testing.T) {
+	tests := []struct {
+		name         string
+		route        string
+		expectedCode int
+		admin        bool
+	}{
+		{
+			"get HTTP status 200",
+			"/v2/users/me/storage",
+			200,
+			false,
+		},
+		{
+			"get HTTP status 403",
+			"/v2/files/storage",
+			403,
+			false,
+		},
+		{
+			"get HTTP status 200",
+			"/v2/files/storage?group=app",
+			200,
+			true,
+		},
+		{
+			"get HTTP status 400",
+			"/v2/files/storage?group=invalid",
+			400,
+			true,
+		},
+	}
+
+	app := createApp()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, err := login(app, tt.admin)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			req := httptest.NewRequest("GET", tt.route, nil)
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+
+			resp, err := app.Test(req, -1)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !assert.Equal(t, tt.expectedCode, resp.StatusCode, tt.name) {
+				body, err := ioutil.ReadAll(resp.Body)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				jsonStr := string(body)
+
+				fmt.Printf("%s\n", jsonStr)
+			}
+		})
+	}
+}
+
+func TestFileUploadLinkQuota(t *testing.T) {
+	tests := []struct {
+		name         string
+		route        string
+		expectedCode int
+		admin        bool
+	}{
+		{
+			"get HTTP status 400 for missing size",
+			"/v2/files/upload?type=uplugin_content&entityId=XXXXXXXX-XXXX-XXXX-XXXX-XXXXXXXXXXXX",
+			400,
+			false,
+		},
+		{
+			"get HTTP status 400 for zero size",
+			"/v2/files/upload?type=uplugin_content&entityId=XXXXXXXX-XXXX-XXXX-XXXX-XXXXXXXXXXXX&size=0",
+			400,
+			false,
+		},
+		{
+			"get HTTP status 413 for size over the quota",
+			"/v2/files/upload?type=uplugin_content&entityId=XXXXXXXX-XXXX-XXXX-XXXX-XXXXXXXXXXXX&size=1125899906842624",
+			413,
+			false,
+		},
+	}
+
+	app := createApp()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, err := login(app, tt.admin)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			req := httptest.NewRequest("GET", tt.route, nil)
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+
+			resp, err := app.Test(req, -1)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !assert.Equal(t, tt.expectedCode, resp.StatusCode, tt.name) {
+				body, err := ioutil.ReadAll(resp.Body)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				jsonStr := string(body)
+
+				fmt.Printf("%s\n", jsonStr)
+			}
+		})
+	}
+}
+
+func TestFileUploads(t *testing.T) {
+	tests := []struct {
+		name         string
+		method       string
+		route        string
+		body         string
+		expectedCode int
+		admin        bool
+	}{
+		{
+			"get HTTP status 400 for missing entity id",
+			"POST",
+			"/v2/files/uploads",
+			`{"type":"pak","size":1048576}`,
+			400,
+			true,
+		},
+		{
+			"get HTTP status 400 for invalid size",
+			"POST",
+			"/v2/files/uploads",
+			`{"entityId":"XXXXXXXX-XXXX-XXXX-XXXX-XXXXXXXXXXXX","type":"image_full","size":0}`,
+			400,
+			true,
+		},
+		{
+			"get HTTP status 400 for invalid hash",
+			"POST",
+			"/v2/files/uploads",
+			`{"entityId":"XXXXXXXX-XXXX-XXXX-XXXX-XXXXXXXXXXXX","type":"image_full","size":1048576,"hash":"d41d8cd98f00b204e9800998ecf8427e"}`,
+			400,
+			true,
+		},
+		{
+			"get HTTP status 404 for missing entity",
+			"POST",
+			"/v2/files/uploads",
+			`{"entityId":"00000000-0000-4000-8000-000000000001","type":"image_full","size":1048576}`,
+			404,
+			false,
+		},
+		{
+			"get HTTP status 404 for missing upload completion",
+			"POST",
+			"/v2/files/uploads/00000000-0000-4000-8000-000000000001/complete",
+			"",
+			404,
+			false,
+		},
+		{
+			"get HTTP status 404 for missing upload abort",
+			"DELETE",
+			"/v2/files/uploads/00000000-0000-4000-8000-000000000001",
+			"",
+			404,
+			false,
+		},
+	}
+
+	app := createApp()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, err := login(app, tt.admin)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var body io.Reader
+			if tt.body != "" {
+				body = strings.NewReader(tt.body)
+			}
+
+			req := httptest.NewRequest(tt.method, tt.route, body)
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+
+			resp, err := app.Test(req, -1)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !assert.Equal(t, tt.expectedCode, resp.StatusCode, tt.name) {
+				body, err := ioutil.ReadAll(resp.Body)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				jsonStr := string(body)
+
+				fmt.Printf("%s\n", jsonStr)
+			}
+		})
+	}
+}
+
+// derivativeTypePattern matches file types of generated image derivatives (e.g. image_preview_preview_webp)
+var derivativeTypePattern = regexp.MustCompile(`^image_.+_(jpeg|png|webp)$`)
+
+func TestIndexFilesDerivatives(t *testing.T) {
+	tests := []struct {
+		name         string
+		route        string
+		expectedCode int
+		admin        bool
+	}{
+		{
+			"get HTTP status 200",
+			"/v2/entities/XXXXXXXX-XXXX-XXXX-XXXX-XXXXXXXXXXXX/files",
+			200,
+			false,
+		},
+		{
+			"get HTTP status 200",
+			"/v2/entities/XXXXXXXX-XXXX-XXXX-XXXX-XXXXXXXXXXXX/files?type=image_preview",
+			200,
+			true,
+		},
+		{
+			"get HTTP status 200",
+			"/v2/entities/XXXXXXXX-XXXX-XXXX-XXXX-XXXXXXXXXXXX/files?size=preview&format=webp",
+			200,
+			false,
+		},
+	}
+
+	app := createApp()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, err := login(app, tt.admin)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			req := httptest.NewRequest("GET", tt.route, nil)
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+
+			resp, err := app.Test(req, -1)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			body, err := ioutil.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !assert.Equal(t, tt.expectedCode, resp.StatusCode, tt.name) {
+				fmt.Printf("%s\n", string(body))
+				return
+			}
+
+			var result struct {
+				Data struct {
+					Entities []struct {
+						Type         string  `json:"type"`
+						DerivativeOf *string `json:"derivativeOf"`
+					} `json:"entities"`
+				} `json:"data"`
+			}
+			if err = json.Unmarshal(body, &result); err != nil {
+				t.Fatal(err)
+			}
+
+			// Derivatives are only returned in place of their source images if the size or format is requested
+			if strings.Contains(tt.route, "size=") || strings.Contains(tt.route, "format=") {
+				return
+			}
+
+			for _, e := range result.Data.Entities {
+				assert.Nil(t, e.DerivativeOf, e.Type)
+				assert.False(t, derivativeTypePattern.MatchString(e.Type), e.Type)
+			}
+		})
+	}
+}
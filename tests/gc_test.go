@@ -0,0 +1,100 @@
+package tests
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestObjectGc(t *testing.T) {
+	tests := []struct {
+		name         string
+		method       string
+		route        string
+		expectedCode int
+		admin        bool
+	}{
+		{
+			"get HTTP status 403 for non-admin dry run",
+			"POST",
+			"/v2/files/orphans",
+			403,
+			false,
+		},
+		{
+			"get HTTP status 403 for non-admin run",
+			"DELETE",
+			"/v2/files/orphans",
+			403,
+			false,
+		},
+		{
+			"get HTTP status 403 for non-admin run report",
+			"GET",
+			"/v2/files/orphans/runs",
+			403,
+			false,
+		},
+		{
+			"get HTTP status 202",
+			"POST",
+			"/v2/files/orphans",
+			202,
+			true,
+		},
+		{
+			"get HTTP status 200",
+			"GET",
+			"/v2/files/orphans/runs",
+			200,
+			true,
+		},
+		{
+			"get HTTP status 400 for invalid id",
+			"GET",
+			"/v2/files/orphans/runs/invalid",
+			400,
+			true,
+		},
+		{
+			"get HTTP status 404 for missing run",
+			"GET",
+			"/v2/files/orphans/runs/00000000-0000-4000-8000-000000000001",
+			404,
+			true,
+		},
+	}
+
+	app := createApp()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, err := login(app, tt.admin)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			req := httptest.NewRequest(tt.method, tt.route, nil)
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+
+			resp, err := app.Test(req, -1)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !assert.Equal(t, tt.expectedCode, resp.StatusCode, tt.name) {
+				body, err := ioutil.ReadAll(resp.Body)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				jsonStr := string(body)
+
+				fmt.Printf("%s\n", jsonStr)
+			}
+		})
+	}
+}
@@ -0,0 +1,108 @@
+package tests
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestBatchWorldObjects(t *testing.T) {
+	tests := []struct {
+		name         string
+		route        string
+		body         string
+		expectedCode int
+		admin        bool
+	}{
+		{
+			"get HTTP status 200",
+			"/v2/worlds/XXXXXXXX-XXXX-XXXX-XXXX-XXXXXXXXXXXX/objects:batch",
+			`{"operations":[{"op":"create","placeableClassId":"XXXXXXXX-XXXX-XXXX-XXXX-XXXXXXXXXXXX","offsetX":1,"offsetY":2,"offsetZ":3}]}`,
+			200,
+			true,
+		},
+		{
+			"get HTTP status 400 for invalid id",
+			"/v2/worlds/invalid/objects:batch",
+			`{"operations":[{"op":"delete","id":"XXXXXXXX-XXXX-XXXX-XXXX-XXXXXXXXXXXX"}]}`,
+			400,
+			true,
+		},
+		{
+			"get HTTP status 400 for no operations",
+			"/v2/worlds/XXXXXXXX-XXXX-XXXX-XXXX-XXXXXXXXXXXX/objects:batch",
+			`{"operations":[]}`,
+			400,
+			true,
+		},
+		{
+			"get HTTP status 404 for missing world",
+			"/v2/worlds/00000000-0000-4000-8000-000000000001/objects:batch",
+			`{"operations":[{"op":"create","placeableClassId":"XXXXXXXX-XXXX-XXXX-XXXX-XXXXXXXXXXXX"}]}`,
+			404,
+			true,
+		},
+		{
+			"get HTTP status 400 for unsupported operation",
+			"/v2/worlds/XXXXXXXX-XXXX-XXXX-XXXX-XXXXXXXXXXXX/objects:batch",
+			`{"operations":[{"op":"move","id":"XXXXXXXX-XXXX-XXXX-XXXX-XXXXXXXXXXXX"}]}`,
+			400,
+			true,
+		},
+		{
+			"get HTTP status 400 for missing object",
+			"/v2/worlds/XXXXXXXX-XXXX-XXXX-XXXX-XXXXXXXXXXXX/objects:batch",
+			`{"operations":[{"op":"update","id":"00000000-0000-4000-8000-000000000001","offsetX":1}]}`,
+			400,
+			true,
+		},
+		{
+			"get HTTP status 400 for missing class",
+			"/v2/worlds/XXXXXXXX-XXXX-XXXX-XXXX-XXXXXXXXXXXX/objects:batch",
+			`{"operations":[{"op":"create","placeableClassId":"00000000-0000-4000-8000-000000000001"}]}`,
+			400,
+			true,
+		},
+		{
+			"get HTTP status 400 for linked entity the requester can not view",
+			"/v2/worlds/XXXXXXXX-XXXX-XXXX-XXXX-XXXXXXXXXXXX/objects:batch",
+			`{"operations":[{"op":"create","placeableClassId":"XXXXXXXX-XXXX-XXXX-XXXX-XXXXXXXXXXXX","entityId":"XXXXXXXX-XXXX-XXXX-XXXX-XXXXXXXXXXXX"}]}`,
+			400,
+			false,
+		},
+	}
+
+	app := createApp()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, err := login(app, tt.admin)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			req := httptest.NewRequest("POST", tt.route, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+
+			resp, err := app.Test(req, -1)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !assert.Equal(t, tt.expectedCode, resp.StatusCode, tt.name) {
+				body, err := ioutil.ReadAll(resp.Body)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				jsonStr := string(body)
+
+				fmt.Printf("%s\n", jsonStr)
+			}
+		})
+	}
+}
@@ -0,0 +1,146 @@
+package tests
+
+import (
+	"context"
+	"fmt"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"veverse-api/database"
+)
+
+// createDependencyPackage inserts the public package with the version, the package and its dependencies are deleted when the test finishes
+func createDependencyPackage(t *testing.T, version string) uuid.UUID {
+	ctx := context.Background()
+
+	id, err := uuid.NewV4()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = database.DB.Exec(ctx, `INSERT INTO entities (id, entity_type, public) VALUES ($1, 'mod', true)`, id /*$1*/); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		_, _ = database.DB.Exec(ctx, `DELETE FROM package_dependencies WHERE package_id = $1 OR dependency_id = $1`, id /*$1*/)
+		_, _ = database.DB.Exec(ctx, `DELETE FROM mods WHERE id = $1`, id /*$1*/)
+		_, _ = database.DB.Exec(ctx, `DELETE FROM entities WHERE id = $1`, id /*$1*/)
+	})
+
+	if _, err = database.DB.Exec(ctx, `INSERT INTO mods (id, name, version) VALUES ($1, $2, $3)`, id /*$1*/, "test-"+id.String() /*$2*/, version /*$3*/); err != nil {
+		t.Fatal(err)
+	}
+
+	return id
+}
+
+// requestPackageRoute sends the request as the admin and returns the status code
+func requestPackageRoute(t *testing.T, app *fiber.App, token string, method string, route string, body string) int {
+	req := httptest.NewRequest(method, route, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.StatusCode >= 400 {
+		b, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fmt.Printf("%s\n", string(b))
+	}
+
+	return resp.StatusCode
+}
+
+// dependenciesBody returns the update body with the dependencies on the packages with the constraint
+func dependenciesBody(constraint string, ids ...uuid.UUID) string {
+	var dependencies []string
+	for _, id := range ids {
+		dependencies = append(dependencies, fmt.Sprintf(`{"id":"%s","constraint":"%s"}`, id, constraint))
+	}
+	return `{"dependencies":[` + strings.Join(dependencies, ",") + `]}`
+}
+
+func TestPackageDependencies(t *testing.T) {
+	app := createApp()
+
+	token, err := login(app, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a := createDependencyPackage(t, "1.0.0")
+	b := createDependencyPackage(t, "1.5.0")
+	c := createDependencyPackage(t, "1.0.0")
+
+	set := func(id uuid.UUID, body string) int {
+		return requestPackageRoute(t, app, token, "PUT", fmt.Sprintf("/v2/packages/%s/dependencies", id), body)
+	}
+
+	t.Run("get HTTP status 200", func(t *testing.T) {
+		assert.Equal(t, 200, set(a, dependenciesBody("^1.0", b)))
+	})
+
+	t.Run("get HTTP status 400 for self dependency", func(t *testing.T) {
+		assert.Equal(t, 400, set(a, dependenciesBody("*", a)))
+	})
+
+	t.Run("get HTTP status 400 for invalid constraint", func(t *testing.T) {
+		assert.Equal(t, 400, set(a, dependenciesBody("not a version", b)))
+	})
+
+	t.Run("get HTTP status 400 for missing dependency", func(t *testing.T) {
+		assert.Equal(t, 400, set(a, dependenciesBody("*", uuid.FromStringOrNil("00000000-0000-4000-8000-000000000001"))))
+	})
+
+	t.Run("get HTTP status 400 for direct cycle", func(t *testing.T) {
+		assert.Equal(t, 400, set(b, dependenciesBody("*", a)))
+	})
+
+	t.Run("get HTTP status 400 for transitive cycle", func(t *testing.T) {
+		assert.Equal(t, 200, set(b, dependenciesBody("^1.0", c)))
+		assert.Equal(t, 400, set(c, dependenciesBody("*", a)))
+		assert.Equal(t, 200, set(b, dependenciesBody("*")))
+	})
+
+	t.Run("get HTTP status 409 for constraint conflict", func(t *testing.T) {
+		// The package requires ^1.0 of the dependency which is also required as ^2.0 by another dependency
+		assert.Equal(t, 200, set(c, dependenciesBody("^2.0", b)))
+		assert.Equal(t, 200, set(a, dependenciesBody("^1.0", b, c)))
+		assert.Equal(t, 409, requestPackageRoute(t, app, token, "GET", fmt.Sprintf("/v2/packages/%s/resolve?platform=Win64&deployment=Client", a), ""))
+	})
+
+	t.Run("concurrent updates can not form a cycle", func(t *testing.T) {
+		for i := 0; i < 10; i++ {
+			x := createDependencyPackage(t, "1.0.0")
+			y := createDependencyPackage(t, "1.0.0")
+
+			var (
+				wg    sync.WaitGroup
+				codes [2]int
+			)
+			wg.Add(2)
+			go func() {
+				defer wg.Done()
+				codes[0] = set(x, dependenciesBody("*", y))
+			}()
+			go func() {
+				defer wg.Done()
+				codes[1] = set(y, dependenciesBody("*", x))
+			}()
+			wg.Wait()
+
+			assert.ElementsMatch(t, []int{200, 400}, codes[:])
+		}
+	})
+}
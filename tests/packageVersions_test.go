@@ -0,0 +1,304 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http/httptest"
+	"testing"
+	"veverse-api/database"
+)
+
+// createVersionedPackage inserts the public package without versions, versions published by the test and their paks are deleted when the test finishes
+func createVersionedPackage(t *testing.T) uuid.UUID {
+	ctx := context.Background()
+
+	id := createDependencyPackage(t, "")
+
+	t.Cleanup(func() {
+		_, _ = database.DB.Exec(ctx, `DELETE FROM files WHERE entity_id IN (SELECT pv.id FROM package_versions pv WHERE pv.package_id = $1)`, id /*$1*/)
+		_, _ = database.DB.Exec(ctx, `DELETE FROM entities WHERE id IN (SELECT pv.id FROM package_versions pv WHERE pv.package_id = $1)`, id /*$1*/)
+	})
+
+	return id
+}
+
+// createVersionPak inserts the pak file of the package version for the platform and deployment
+func createVersionPak(t *testing.T, packageId uuid.UUID, version string, platform string, deployment string) {
+	ctx := context.Background()
+
+	var versionId uuid.UUID
+	if err := database.DB.QueryRow(ctx, `SELECT pv.id FROM package_versions pv WHERE pv.package_id = $1 AND pv.version = $2`, packageId /*$1*/, version /*$2*/).Scan(&versionId); err != nil {
+		t.Fatal(err)
+	}
+
+	createPak(t, versionId, platform, deployment)
+}
+
+// createPak inserts the pak file of the entity for the platform and deployment
+func createPak(t *testing.T, entityId uuid.UUID, platform string, deployment string) {
+	id, err := uuid.NewV4()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	q := `INSERT INTO files (id, entity_id, url, type, mime, size, version, deployment_type, platform, created_at, original_path) VALUES ($1, $2, $3, 'pak', 'application/octet-stream', 1, 1, $4, $5, now(), 'package.pak')`
+	if _, err = database.DB.Exec(context.Background(), q, id /*$1*/, entityId /*$2*/, "https://example.com/"+id.String() /*$3*/, deployment /*$4*/, platform /*$5*/); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// getPackageRouteData sends the GET request as the admin and decodes the response data
+func getPackageRouteData(t *testing.T, app *fiber.App, token string, route string, data any) {
+	req := httptest.NewRequest("GET", route, nil)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !assert.Equal(t, 200, resp.StatusCode, string(body)) {
+		t.FailNow()
+	}
+
+	v := struct {
+		Data any `json:"data"`
+	}{Data: data}
+	if err = json.Unmarshal(body, &v); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPackageVersions(t *testing.T) {
+	app := createApp()
+
+	token, err := login(app, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id := createVersionedPackage(t)
+
+	publish := func(version string) int {
+		return requestPackageRoute(t, app, token, "POST", fmt.Sprintf("/v2/packages/%s/versions", id), fmt.Sprintf(`{"version":"%s"}`, version))
+	}
+
+	deprecate := func(version string, deprecated bool) int {
+		return requestPackageRoute(t, app, token, "PATCH", fmt.Sprintf("/v2/packages/%s/versions/%s", id, version), fmt.Sprintf(`{"deprecated":%t}`, deprecated))
+	}
+
+	latest := func() string {
+		var entity struct {
+			Version string `json:"version"`
+		}
+		getPackageRouteData(t, app, token, fmt.Sprintf("/v2/packages/%s?platform=Win64&deployment=Client", id), &entity)
+		return entity.Version
+	}
+
+	t.Run("get HTTP status 200 for greater versions", func(t *testing.T) {
+		assert.Equal(t, 200, publish("1.0.0"))
+		assert.Equal(t, 200, publish("2.0.0"))
+	})
+
+	t.Run("get HTTP status 400 for lower version", func(t *testing.T) {
+		assert.Equal(t, 400, publish("1.5.0"))
+	})
+
+	t.Run("get HTTP status 400 for existing version", func(t *testing.T) {
+		assert.Equal(t, 400, publish("2.0.0"))
+	})
+
+	t.Run("get HTTP status 400 for invalid version", func(t *testing.T) {
+		assert.Equal(t, 400, publish("not a version"))
+	})
+
+	t.Run("latest version waits for its pak", func(t *testing.T) {
+		createVersionPak(t, id, "1.0.0", "Win64", "Client")
+		assert.Equal(t, "1.0.0", latest())
+
+		createVersionPak(t, id, "2.0.0", "Win64", "Client")
+		assert.Equal(t, "2.0.0", latest())
+	})
+
+	t.Run("deprecation changes the latest version", func(t *testing.T) {
+		assert.Equal(t, 200, deprecate("2.0.0", true))
+		assert.Equal(t, "1.0.0", latest())
+
+		assert.Equal(t, 200, deprecate("2.0.0", false))
+		assert.Equal(t, "2.0.0", latest())
+	})
+
+	t.Run("get HTTP status 404 for missing version", func(t *testing.T) {
+		assert.Equal(t, 404, deprecate("9.9.9", true))
+	})
+}
+
+func TestPackageVersionDependencies(t *testing.T) {
+	app := createApp()
+
+	token, err := login(app, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The dependency is created first so it is deleted after the snapshot of the dependent version
+	dependency := createVersionedPackage(t)
+	id := createVersionedPackage(t)
+
+	set := func(id uuid.UUID, body string) int {
+		return requestPackageRoute(t, app, token, "PUT", fmt.Sprintf("/v2/packages/%s/dependencies", id), body)
+	}
+
+	publish := func(id uuid.UUID, version string) int {
+		return requestPackageRoute(t, app, token, "POST", fmt.Sprintf("/v2/packages/%s/versions", id), fmt.Sprintf(`{"version":"%s"}`, version))
+	}
+
+	t.Run("get HTTP status 400 for cycle through published version", func(t *testing.T) {
+		assert.Equal(t, 200, set(id, dependenciesBody("^1.0", dependency)))
+		assert.Equal(t, 200, publish(id, "1.0.0"))
+		assert.Equal(t, 200, set(id, dependenciesBody("*")))
+
+		// The published version still depends on the package
+		assert.Equal(t, 400, set(dependency, dependenciesBody("*", id)))
+	})
+
+	t.Run("dependency is satisfied by the latest version", func(t *testing.T) {
+		assert.Equal(t, 200, publish(dependency, "1.0.0"))
+		assert.Equal(t, 200, publish(dependency, "2.0.0"))
+		assert.Equal(t, 200, requestPackageRoute(t, app, token, "PATCH", fmt.Sprintf("/v2/packages/%s/versions/2.0.0", dependency), `{"deprecated":true}`))
+		assert.Equal(t, 200, set(id, dependenciesBody("^1.0", dependency)))
+
+		var entities []struct {
+			Version   string `json:"version"`
+			Satisfied bool   `json:"satisfied"`
+		}
+		getPackageRouteData(t, app, token, fmt.Sprintf("/v2/packages/%s/dependencies", id), &entities)
+
+		if assert.Len(t, entities, 1) {
+			assert.Equal(t, "1.0.0", entities[0].Version)
+			assert.True(t, entities[0].Satisfied)
+		}
+	})
+}
+
+func TestPackageVersionLegacyPak(t *testing.T) {
+	app := createApp()
+
+	token, err := login(app, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Paks built before versions were introduced stay on the package entity
+	id := createVersionedPackage(t)
+	t.Cleanup(func() {
+		_, _ = database.DB.Exec(context.Background(), `DELETE FROM files WHERE entity_id = $1`, id /*$1*/)
+	})
+	createPak(t, id, "Win64", "Client")
+
+	if status := requestPackageRoute(t, app, token, "POST", fmt.Sprintf("/v2/packages/%s/versions", id), `{"version":"1.0.0"}`); status != 200 {
+		t.Fatalf("failed to publish: %d", status)
+	}
+
+	pakEntityId := func() uuid.UUID {
+		var resolution struct {
+			Packages []struct {
+				Pak struct {
+					EntityId uuid.UUID `json:"entityId"`
+				} `json:"pak"`
+			} `json:"packages"`
+		}
+		getPackageRouteData(t, app, token, fmt.Sprintf("/v2/packages/%s/resolve?platform=Win64&deployment=Client", id), &resolution)
+		if len(resolution.Packages) != 1 {
+			t.Fatalf("unexpected packages: %d", len(resolution.Packages))
+		}
+		return resolution.Packages[0].Pak.EntityId
+	}
+
+	t.Run("package pak is served until the version is built", func(t *testing.T) {
+		assert.Equal(t, id, pakEntityId())
+	})
+
+	t.Run("version pak is served once built", func(t *testing.T) {
+		createVersionPak(t, id, "1.0.0", "Win64", "Client")
+		assert.NotEqual(t, id, pakEntityId())
+	})
+}
+
+func TestWorldPackageVersion(t *testing.T) {
+	app := createApp()
+
+	token, err := login(app, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	packageId := createVersionedPackage(t)
+	for _, version := range []string{"1.0.0", "2.0.0"} {
+		if status := requestPackageRoute(t, app, token, "POST", fmt.Sprintf("/v2/packages/%s/versions", packageId), fmt.Sprintf(`{"version":"%s"}`, version)); status != 200 {
+			t.Fatalf("failed to publish %s: %d", version, status)
+		}
+		createVersionPak(t, packageId, version, "Win64", "Client")
+	}
+
+	worldId := createSearchWorld(t, "pinned world", "", true)
+	if _, err = database.DB.Exec(context.Background(), `UPDATE spaces SET mod_id = $2 WHERE id = $1`, worldId /*$1*/, packageId /*$2*/); err != nil {
+		t.Fatal(err)
+	}
+
+	route := fmt.Sprintf("/v2/worlds/%s/package-version", worldId)
+
+	current := func() (pinned bool, version string) {
+		var entity struct {
+			Pinned  bool `json:"pinned"`
+			Version *struct {
+				Version string `json:"version"`
+			} `json:"version"`
+		}
+		getPackageRouteData(t, app, token, route, &entity)
+		if entity.Version != nil {
+			version = entity.Version.Version
+		}
+		return entity.Pinned, version
+	}
+
+	t.Run("world uses the latest version", func(t *testing.T) {
+		pinned, version := current()
+		assert.False(t, pinned)
+		assert.Equal(t, "2.0.0", version)
+	})
+
+	t.Run("world keeps the pinned version", func(t *testing.T) {
+		assert.Equal(t, 200, requestPackageRoute(t, app, token, "PUT", route, `{"version":"1.0.0"}`))
+
+		// Deprecating the pinned version does not unpin the world
+		assert.Equal(t, 200, requestPackageRoute(t, app, token, "PATCH", fmt.Sprintf("/v2/packages/%s/versions/1.0.0", packageId), `{"deprecated":true}`))
+
+		pinned, version := current()
+		assert.True(t, pinned)
+		assert.Equal(t, "1.0.0", version)
+	})
+
+	t.Run("get HTTP status 400 for missing version", func(t *testing.T) {
+		assert.Equal(t, 400, requestPackageRoute(t, app, token, "PUT", route, `{"version":"9.9.9"}`))
+	})
+
+	t.Run("world uses the latest version after unpinning", func(t *testing.T) {
+		assert.Equal(t, 200, requestPackageRoute(t, app, token, "PUT", route, `{"version":null}`))
+
+		pinned, version := current()
+		assert.False(t, pinned)
+		assert.Equal(t, "2.0.0", version)
+	})
+}
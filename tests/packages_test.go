@@ -64,12 +64,30 @@ func TestIndexPackages(t *testing.T) {
 			200,
 			false,
 		},
+		{
+			"packages-index (user) offset=0&limit=10&sort=trending",
+			"/v2/packages?offset=0&limit=10&sort=trending",
+			200,
+			false,
+		},
 		{
 			"packages-index (admin)",
 			"/v2/packages",
 			200,
 			true,
 		},
+		{
+			"packages-index (admin) offset=0&limit=10&sort=trending",
+			"/v2/packages?offset=0&limit=10&sort=trending",
+			200,
+			true,
+		},
+		{
+			"packages-index (user) sort=color",
+			"/v2/packages?sort=color",
+			400,
+			false,
+		},
 		{
 			"packages-index (admin) ?offset=0&limit=10",
 			"/v2/packages?offset=0&limit=10",
@@ -210,3 +228,139 @@ func TestGetPackages(t *testing.T) {
 		})
 	}
 }
+
+func TestResolvePackage(t *testing.T) {
+	tests := []struct {
+		name         string
+		route        string
+		expectedCode int
+		admin        bool
+	}{
+		{
+			"get HTTP status 200",
+			"/v2/packages/XXXXXXXX-XXXX-XXXX-XXXX-XXXXXXXXXXXX/dependencies",
+			200,
+			false,
+		},
+		{
+			"get HTTP status 200",
+			"/v2/packages/XXXXXXXX-XXXX-XXXX-XXXX-XXXXXXXXXXXX/resolve?platform=Win64&deployment=Client",
+			200,
+			false,
+		},
+		{
+			"get HTTP status 200",
+			"/v2/packages/XXXXXXXX-XXXX-XXXX-XXXX-XXXXXXXXXXXX/resolve?platform=Linux&deployment=Server",
+			200,
+			true,
+		},
+		{
+			"get HTTP status 400 for unsupported platform",
+			"/v2/packages/XXXXXXXX-XXXX-XXXX-XXXX-XXXXXXXXXXXX/resolve?platform=Amiga&deployment=Client",
+			400,
+			false,
+		},
+		{
+			"get HTTP status 404",
+			"/v2/packages/00000000-0000-0000-0000-000000000001/resolve?platform=Win64&deployment=Client",
+			404,
+			false,
+		},
+	}
+
+	app := createApp()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, err := login(app, tt.admin)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			req := httptest.NewRequest("GET", tt.route, nil)
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+
+			resp, err := app.Test(req, -1)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !assert.Equal(t, tt.expectedCode, resp.StatusCode, tt.name) {
+				body, err := ioutil.ReadAll(resp.Body)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				jsonStr := string(body)
+
+				fmt.Printf("%s\n", jsonStr)
+			}
+		})
+	}
+}
+
+func TestPackageVersionRoutes(t *testing.T) {
+	tests := []struct {
+		name         string
+		route        string
+		expectedCode int
+		admin        bool
+	}{
+		{
+			"get HTTP status 200",
+			"/v2/packages/XXXXXXXX-XXXX-XXXX-XXXX-XXXXXXXXXXXX/versions",
+			200,
+			false,
+		},
+		{
+			"get HTTP status 200",
+			"/v2/packages/XXXXXXXX-XXXX-XXXX-XXXX-XXXXXXXXXXXX/versions?offset=0&limit=10",
+			200,
+			true,
+		},
+		{
+			"get HTTP status 404 for unknown version",
+			"/v2/packages/XXXXXXXX-XXXX-XXXX-XXXX-XXXXXXXXXXXX/versions/999.0.0",
+			404,
+			false,
+		},
+		{
+			"get HTTP status 404 for unknown version",
+			"/v2/packages/XXXXXXXX-XXXX-XXXX-XXXX-XXXXXXXXXXXX?version=999.0.0",
+			404,
+			false,
+		},
+	}
+
+	app := createApp()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, err := login(app, tt.admin)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			req := httptest.NewRequest("GET", tt.route, nil)
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+
+			resp, err := app.Test(req, -1)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !assert.Equal(t, tt.expectedCode, resp.StatusCode, tt.name) {
+				body, err := ioutil.ReadAll(resp.Body)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				jsonStr := string(body)
+
+				fmt.Printf("%s\n", jsonStr)
+			}
+		})
+	}
+}
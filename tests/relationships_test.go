@@ -0,0 +1,131 @@
+package tests
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"io/ioutil"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestEntityRelationships(t *testing.T) {
+	tests := []struct {
+		name         string
+		method       string
+		route        string
+		body         string
+		expectedCode int
+		admin        bool
+	}{
+		{
+			"get HTTP status 200",
+			"GET",
+			"/v2/entities/XXXXXXXX-XXXX-XXXX-XXXX-XXXXXXXXXXXX/relationships",
+			"",
+			200,
+			false,
+		},
+		{
+			"get HTTP status 200",
+			"GET",
+			"/v2/entities/XXXXXXXX-XXXX-XXXX-XXXX-XXXXXXXXXXXX/relationships/inbound?type=contains",
+			"",
+			200,
+			false,
+		},
+		{
+			"get HTTP status 400 for invalid type",
+			"GET",
+			"/v2/entities/XXXXXXXX-XXXX-XXXX-XXXX-XXXXXXXXXXXX/relationships?type=Not%20A%20Type",
+			"",
+			400,
+			false,
+		},
+		{
+			"get HTTP status 404 for missing entity",
+			"GET",
+			"/v2/entities/00000000-0000-4000-8000-000000000001/relationships",
+			"",
+			404,
+			false,
+		},
+		{
+			"get HTTP status 400 for missing target",
+			"POST",
+			"/v2/entities/XXXXXXXX-XXXX-XXXX-XXXX-XXXXXXXXXXXX/relationships",
+			`{"type":"contains"}`,
+			400,
+			false,
+		},
+		{
+			"get HTTP status 400 for invalid type",
+			"POST",
+			"/v2/entities/XXXXXXXX-XXXX-XXXX-XXXX-XXXXXXXXXXXX/relationships",
+			`{"targetId":"00000000-0000-4000-8000-000000000002","type":"Not A Type"}`,
+			400,
+			false,
+		},
+		{
+			"get HTTP status 404 for missing source",
+			"POST",
+			"/v2/entities/00000000-0000-4000-8000-000000000001/relationships",
+			`{"targetId":"00000000-0000-4000-8000-000000000002","type":"contains"}`,
+			404,
+			false,
+		},
+		{
+			"get HTTP status 404 for missing relationship update",
+			"PATCH",
+			"/v2/entities/relationships/00000000-0000-4000-8000-000000000001",
+			`{"order":1}`,
+			404,
+			false,
+		},
+		{
+			"get HTTP status 404 for missing relationship delete",
+			"DELETE",
+			"/v2/entities/relationships/00000000-0000-4000-8000-000000000001",
+			"",
+			404,
+			true,
+		},
+	}
+
+	app := createApp()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, err := login(app, tt.admin)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var body io.Reader
+			if tt.body != "" {
+				body = strings.NewReader(tt.body)
+			}
+
+			req := httptest.NewRequest(tt.method, tt.route, body)
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+
+			resp, err := app.Test(req, -1)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !assert.Equal(t, tt.expectedCode, resp.StatusCode, tt.name) {
+				body, err := ioutil.ReadAll(resp.Body)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				jsonStr := string(body)
+
+				fmt.Printf("%s\n", jsonStr)
+			}
+		})
+	}
+}
@@ -0,0 +1,104 @@
+package tests
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestReleaseManifest(t *testing.T) {
+	tests := []struct {
+		name         string
+		route        string
+		expectedCode int
+		admin        bool
+		anonymous    bool
+	}{
+		{
+			"get HTTP status 200",
+			"/v2/releases/XXXXXXXX-XXXX-XXXX-XXXX-XXXXXXXXXXXX/manifest",
+			200,
+			false,
+			false,
+		},
+		{
+			"get HTTP status 200",
+			"/v2/releases/XXXXXXXX-XXXX-XXXX-XXXX-XXXXXXXXXXXX/manifest?platform=Win64&deployment=Client",
+			200,
+			true,
+			false,
+		},
+		{
+			"get HTTP status 400 for invalid id",
+			"/v2/releases/invalid/manifest",
+			400,
+			false,
+			true,
+		},
+		{
+			"get HTTP status 404 for missing release",
+			"/v2/releases/00000000-0000-4000-8000-000000000001/manifest",
+			404,
+			true,
+			false,
+		},
+		{
+			"get HTTP status 200",
+			"/v2/releases/XXXXXXXX-XXXX-XXXX-XXXX-XXXXXXXXXXXX/delta?from=XXXXXXXX-XXXX-XXXX-XXXX-XXXXXXXXXXXX",
+			200,
+			true,
+			false,
+		},
+		{
+			"get HTTP status 400 for missing from release",
+			"/v2/releases/XXXXXXXX-XXXX-XXXX-XXXX-XXXXXXXXXXXX/delta",
+			400,
+			false,
+			false,
+		},
+		{
+			"get HTTP status 404 for missing release",
+			"/v2/releases/XXXXXXXX-XXXX-XXXX-XXXX-XXXXXXXXXXXX/delta?from=00000000-0000-4000-8000-000000000001",
+			404,
+			true,
+			false,
+		},
+	}
+
+	app := createApp()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tt.route, nil)
+			req.Header.Set("Content-Type", "application/json")
+
+			// Signed in requesters are identified by the optional JWT
+			if !tt.anonymous {
+				token, err := login(app, tt.admin)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+			}
+
+			resp, err := app.Test(req, -1)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !assert.Equal(t, tt.expectedCode, resp.StatusCode, tt.name) {
+				body, err := ioutil.ReadAll(resp.Body)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				jsonStr := string(body)
+
+				fmt.Printf("%s\n", jsonStr)
+			}
+		})
+	}
+}
@@ -0,0 +1,212 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"veverse-api/database"
+	"veverse-api/model"
+)
+
+func TestSearch(t *testing.T) {
+	tests := []struct {
+		name         string
+		route        string
+		expectedCode int
+		admin        bool
+	}{
+		{
+			"get HTTP status 200",
+			"/v2/search?query=gallery",
+			200,
+			false,
+		},
+		{
+			"get HTTP status 200 for misspelled query",
+			"/v2/search?query=galery&types=world,package",
+			200,
+			false,
+		},
+		{
+			"get HTTP status 200",
+			"/v2/search?query=gallery&offset=0&limit=10",
+			200,
+			true,
+		},
+		{
+			"get HTTP status 400 without query",
+			"/v2/search",
+			400,
+			false,
+		},
+		{
+			"get HTTP status 400 for invalid types",
+			"/v2/search?query=gallery&types=users",
+			400,
+			false,
+		},
+	}
+
+	app := createApp()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, err := login(app, tt.admin)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			req := httptest.NewRequest("GET", tt.route, nil)
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+
+			resp, err := app.Test(req, -1)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !assert.Equal(t, tt.expectedCode, resp.StatusCode, tt.name) {
+				body, err := ioutil.ReadAll(resp.Body)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				jsonStr := string(body)
+
+				fmt.Printf("%s\n", jsonStr)
+			}
+		})
+	}
+}
+
+// createSearchWorld inserts the world without an owner, the world is deleted when the test finishes
+func createSearchWorld(t *testing.T, name string, description string, public bool) uuid.UUID {
+	ctx := context.Background()
+
+	id, err := uuid.NewV4()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = database.DB.Exec(ctx, `INSERT INTO entities (id, entity_type, public) VALUES ($1, 'space', $2)`, id /*$1*/, public /*$2*/); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		_, _ = database.DB.Exec(ctx, `DELETE FROM spaces WHERE id = $1`, id /*$1*/)
+		_, _ = database.DB.Exec(ctx, `DELETE FROM entities WHERE id = $1`, id /*$1*/)
+	})
+
+	if _, err = database.DB.Exec(ctx, `INSERT INTO spaces (id, name, description) VALUES ($1, $2, $3)`, id /*$1*/, name /*$2*/, description /*$3*/); err != nil {
+		t.Fatal(err)
+	}
+
+	return id
+}
+
+// searchWorlds returns the world results of the query
+func searchWorlds(t *testing.T, app *fiber.App, admin bool, query string) []model.SearchResult {
+	token, err := login(app, admin)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest("GET", "/v2/search?types=world&query="+query, nil)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !assert.Equal(t, 200, resp.StatusCode, string(body)) {
+		t.FailNow()
+	}
+
+	var v struct {
+		Data struct {
+			Entities []model.SearchResult `json:"entities"`
+		} `json:"data"`
+	}
+	if err = json.Unmarshal(body, &v); err != nil {
+		t.Fatal(err)
+	}
+
+	return v.Data.Entities
+}
+
+// searchResultIds returns ids of results in the order of ranks
+func searchResultIds(results []model.SearchResult) (ids []uuid.UUID) {
+	for _, r := range results {
+		ids = append(ids, r.Id)
+	}
+	return ids
+}
+
+func TestSearchResults(t *testing.T) {
+	app := createApp()
+
+	// The random word of letters only matches worlds of the test
+	word := strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return 'g' + r - '0'
+		}
+		return r
+	}, "quokka"+uuid.Must(uuid.NewV4()).String()[:8])
+
+	named := createSearchWorld(t, word+" Gallery", "", true)
+	described := createSearchWorld(t, "Hall", "The hall next to the "+word+" gallery", true)
+	private := createSearchWorld(t, word+" Vault", "", false)
+	markup := createSearchWorld(t, "Markup", word+" <script>alert(1)</script>", true)
+
+	t.Run("names rank over descriptions", func(t *testing.T) {
+		ids := searchResultIds(searchWorlds(t, app, true, word))
+		if assert.Contains(t, ids, named) && assert.Contains(t, ids, described) {
+			assert.Less(t, indexOfId(ids, named), indexOfId(ids, described))
+		}
+	})
+
+	t.Run("misspelled names match by similarity", func(t *testing.T) {
+		ids := searchResultIds(searchWorlds(t, app, false, word[:len(word)-1]))
+		assert.Contains(t, ids, named)
+	})
+
+	t.Run("private worlds are only found by admins", func(t *testing.T) {
+		assert.Contains(t, searchResultIds(searchWorlds(t, app, true, word)), private)
+		assert.NotContains(t, searchResultIds(searchWorlds(t, app, false, word)), private)
+	})
+
+	t.Run("snippets escape markup", func(t *testing.T) {
+		for _, r := range searchWorlds(t, app, false, word) {
+			if r.Id == markup {
+				assert.NotContains(t, r.Snippet, "<script>")
+				assert.Contains(t, r.Snippet, "&lt;script&gt;")
+				assert.Contains(t, r.Snippet, "<b>"+word+"</b>")
+				return
+			}
+		}
+		t.Errorf("world %s not found", markup)
+	})
+}
+
+func indexOfId(ids []uuid.UUID, id uuid.UUID) int {
+	for i := range ids {
+		if ids[i] == id {
+			return i
+		}
+	}
+	return -1
+}
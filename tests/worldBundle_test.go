@@ -0,0 +1,154 @@
+package tests
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http/httptest"
+	"testing"
+)
+
+// createWorldBundle returns the zip archive with the manifest, the manifest entry is omitted if it is empty
+func createWorldBundle(t *testing.T, manifest string) []byte {
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+
+	if manifest != "" {
+		f, err := w.Create("manifest.json")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = f.Write([]byte(manifest)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+func TestImportWorld(t *testing.T) {
+	tests := []struct {
+		name         string
+		route        string
+		bundle       []byte
+		expectedCode int
+		admin        bool
+	}{
+		{
+			"get HTTP status 200 for dry run",
+			"/v2/worlds/import?dryRun=true",
+			createWorldBundle(t, `{"formatVersion":1,"world":{"name":"Imported"},"classes":[],"objects":[],"portals":[]}`),
+			200,
+			false,
+		},
+		{
+			"get HTTP status 200",
+			"/v2/worlds/import",
+			createWorldBundle(t, `{"formatVersion":1,"world":{"name":"Imported","properties":[],"files":[]},"classes":[],"objects":[],"portals":[]}`),
+			200,
+			true,
+		},
+		{
+			"get HTTP status 400 for no bundle",
+			"/v2/worlds/import",
+			nil,
+			400,
+			false,
+		},
+		{
+			"get HTTP status 400 for invalid archive",
+			"/v2/worlds/import?dryRun=true",
+			[]byte("invalid"),
+			400,
+			false,
+		},
+		{
+			"get HTTP status 400 for no manifest",
+			"/v2/worlds/import?dryRun=true",
+			createWorldBundle(t, ""),
+			400,
+			false,
+		},
+		{
+			"get HTTP status 400 for unsupported format version",
+			"/v2/worlds/import?dryRun=true",
+			createWorldBundle(t, `{"formatVersion":99,"world":{"name":"Imported"}}`),
+			400,
+			false,
+		},
+		{
+			"get HTTP status 400 for unsupported class conflict handling",
+			"/v2/worlds/import?dryRun=true&classConflict=merge",
+			createWorldBundle(t, `{"formatVersion":1,"world":{"name":"Imported"}}`),
+			400,
+			false,
+		},
+		{
+			"get HTTP status 400 for undeclared class",
+			"/v2/worlds/import?dryRun=true",
+			createWorldBundle(t, `{"formatVersion":1,"world":{"name":"Imported"},"objects":[{"id":"00000000-0000-4000-8000-000000000001","placeableClassId":"00000000-0000-4000-8000-000000000002","scaleX":1,"scaleY":1,"scaleZ":1}]}`),
+			400,
+			false,
+		},
+		{
+			"get HTTP status 400 for file without contents",
+			"/v2/worlds/import?dryRun=true",
+			createWorldBundle(t, `{"formatVersion":1,"world":{"name":"Imported","files":[{"id":"00000000-0000-4000-8000-000000000001","type":"preview","entry":"files/missing"}]}}`),
+			400,
+			false,
+		},
+	}
+
+	app := createApp()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, err := login(app, tt.admin)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var body bytes.Buffer
+			w := multipart.NewWriter(&body)
+			if tt.bundle != nil {
+				f, err := w.CreateFormFile("file", "world.zip")
+				if err != nil {
+					t.Fatal(err)
+				}
+				if _, err = f.Write(tt.bundle); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err = w.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			req := httptest.NewRequest("POST", tt.route, &body)
+			req.Header.Set("Content-Type", w.FormDataContentType())
+			req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+
+			resp, err := app.Test(req, -1)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !assert.Equal(t, tt.expectedCode, resp.StatusCode, tt.name) {
+				body, err := ioutil.ReadAll(resp.Body)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				jsonStr := string(body)
+
+				fmt.Printf("%s\n", jsonStr)
+			}
+		})
+	}
+}
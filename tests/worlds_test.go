@@ -1,11 +1,18 @@
 package tests
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofrs/uuid"
 	"github.com/stretchr/testify/assert"
 	"io/ioutil"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"veverse-api/database"
+	"veverse-api/model"
 )
 
 func TestIndexWorlds(t *testing.T) {
@@ -39,6 +46,12 @@ func TestIndexWorlds(t *testing.T) {
 			200,
 			false,
 		},
+		{
+			"get HTTP status 200",
+			"/v2/worlds?offset=0&limit=10&sort=trending",
+			200,
+			false,
+		},
 		{
 			"get HTTP status 200",
 			"/v2/worlds",
@@ -63,6 +76,436 @@ func TestIndexWorlds(t *testing.T) {
 			200,
 			true,
 		},
+		{
+			"get HTTP status 200",
+			"/v2/worlds?offset=0&limit=10&sort=trending",
+			200,
+			true,
+		},
+		{
+			"get HTTP status 400 for invalid sort",
+			"/v2/worlds?offset=0&limit=10&sort=color",
+			400,
+			false,
+		},
+	}
+
+	app := createApp()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, err := login(app, tt.admin)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			req := httptest.NewRequest("GET", tt.route, nil)
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+
+			resp, err := app.Test(req, -1)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !assert.Equal(t, tt.expectedCode, resp.StatusCode, tt.name) {
+				body, err := ioutil.ReadAll(resp.Body)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				jsonStr := string(body)
+
+				fmt.Printf("%s\n", jsonStr)
+			}
+		})
+	}
+}
+
+func TestWorldObjectsSpatial(t *testing.T) {
+	tests := []struct {
+		name         string
+		route        string
+		expectedCode int
+		admin        bool
+	}{
+		{
+			"get HTTP status 200 for objects within the radius",
+			"/v2/worlds/00000000-0000-4000-8000-000000000001/objects?x=0&y=0&z=0&radius=1000",
+			200,
+			false,
+		},
+		{
+			"get HTTP status 200 for objects inside the box",
+			"/v2/worlds/00000000-0000-4000-8000-000000000001/objects?minX=-100&minY=-100&minZ=-100&maxX=100&maxY=100&maxZ=100",
+			200,
+			true,
+		},
+		{
+			"get HTTP status 200 for nearest objects",
+			"/v2/worlds/00000000-0000-4000-8000-000000000001/objects?x=0&y=0&z=0&nearest=10",
+			200,
+			false,
+		},
+		{
+			"get HTTP status 400 for incomplete point",
+			"/v2/worlds/00000000-0000-4000-8000-000000000001/objects?x=0&radius=10",
+			400,
+			false,
+		},
+		{
+			"get HTTP status 400 for nearest without point",
+			"/v2/worlds/00000000-0000-4000-8000-000000000001/objects?nearest=10",
+			400,
+			false,
+		},
+	}
+
+	app := createApp()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, err := login(app, tt.admin)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			req := httptest.NewRequest("GET", tt.route, nil)
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+
+			resp, err := app.Test(req, -1)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !assert.Equal(t, tt.expectedCode, resp.StatusCode, tt.name) {
+				body, err := ioutil.ReadAll(resp.Body)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				jsonStr := string(body)
+
+				fmt.Printf("%s\n", jsonStr)
+			}
+		})
+	}
+}
+
+func TestWorldSnapshots(t *testing.T) {
+	tests := []struct {
+		name         string
+		route        string
+		expectedCode int
+		admin        bool
+	}{
+		{
+			"get HTTP status 400 for invalid world id",
+			"/v2/worlds/invalid/snapshots",
+			400,
+			false,
+		},
+		{
+			"get HTTP status 400 for diff without snapshots",
+			"/v2/worlds/00000000-0000-4000-8000-000000000001/snapshots/diff",
+			400,
+			false,
+		},
+		{
+			"get HTTP status 400 for invalid diff snapshot id",
+			"/v2/worlds/00000000-0000-4000-8000-000000000001/snapshots/diff?from=invalid",
+			400,
+			true,
+		},
+		{
+			"get HTTP status 404 for missing snapshot",
+			"/v2/worlds/00000000-0000-4000-8000-000000000001/snapshots/00000000-0000-4000-8000-000000000002",
+			404,
+			true,
+		},
+	}
+
+	app := createApp()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, err := login(app, tt.admin)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			req := httptest.NewRequest("GET", tt.route, nil)
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+
+			resp, err := app.Test(req, -1)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !assert.Equal(t, tt.expectedCode, resp.StatusCode, tt.name) {
+				body, err := ioutil.ReadAll(resp.Body)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				jsonStr := string(body)
+
+				fmt.Printf("%s\n", jsonStr)
+			}
+		})
+	}
+}
+
+// createSnapshotObject inserts the placeable of the world, the placeable is deleted when the test finishes
+func createSnapshotObject(t *testing.T, worldId uuid.UUID, classId uuid.UUID, offsetX float64) uuid.UUID {
+	ctx := context.Background()
+
+	id, err := uuid.NewV4()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = database.DB.Exec(ctx, `INSERT INTO entities (id, entity_type, public) VALUES ($1, 'placeable', true)`, id /*$1*/); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		_, _ = database.DB.Exec(ctx, `DELETE FROM placeables WHERE id = $1`, id /*$1*/)
+		_, _ = database.DB.Exec(ctx, `DELETE FROM entities WHERE id = $1`, id /*$1*/)
+	})
+
+	q := `INSERT INTO placeables (id, space_id, placeable_class_id, offset_x, offset_y, offset_z, rotation_x, rotation_y, rotation_z, scale_x, scale_y, scale_z) VALUES ($1, $2, $3, $4, 0, 0, 0, 0, 0, 1, 1, 1)`
+	if _, err = database.DB.Exec(ctx, q, id /*$1*/, worldId /*$2*/, classId /*$3*/, offsetX /*$4*/); err != nil {
+		t.Fatal(err)
+	}
+
+	return id
+}
+
+// createSnapshotClass inserts the placeable class, the class is deleted when the test finishes
+func createSnapshotClass(t *testing.T) uuid.UUID {
+	ctx := context.Background()
+
+	id, err := uuid.NewV4()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = database.DB.Exec(ctx, `INSERT INTO entities (id, entity_type, public) VALUES ($1, 'placeable_class', true)`, id /*$1*/); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		_, _ = database.DB.Exec(ctx, `DELETE FROM placeable_classes WHERE id = $1`, id /*$1*/)
+		_, _ = database.DB.Exec(ctx, `DELETE FROM entities WHERE id = $1`, id /*$1*/)
+	})
+
+	if _, err = database.DB.Exec(ctx, `INSERT INTO placeable_classes (id, cls, name, description, category) VALUES ($1, $2, $3, '', 'Test')`, id /*$1*/, "/Game/Test/"+id.String() /*$2*/, "test-"+id.String() /*$3*/); err != nil {
+		t.Fatal(err)
+	}
+
+	return id
+}
+
+// requestWorldSnapshotRoute sends the request as the admin and decodes the response data
+func requestWorldSnapshotRoute(t *testing.T, app *fiber.App, token string, method string, route string, body string, data any) {
+	req := httptest.NewRequest(method, route, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !assert.Equal(t, 200, resp.StatusCode, string(b)) {
+		t.FailNow()
+	}
+
+	v := struct {
+		Data any `json:"data"`
+	}{Data: data}
+	if err = json.Unmarshal(b, &v); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWorldSnapshotRestore(t *testing.T) {
+	ctx := context.Background()
+
+	app := createApp()
+
+	token, err := login(app, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	worldId := createSearchWorld(t, "snapshot-"+uuid.Must(uuid.NewV4()).String(), "", false)
+	classId := createSnapshotClass(t)
+	objectId := createSnapshotObject(t, worldId, classId, 1)
+
+	var snapshot model.WorldSnapshot
+	requestWorldSnapshotRoute(t, app, token, "POST", fmt.Sprintf("/v2/worlds/%s/snapshots", worldId), `{"name":"round trip"}`, &snapshot)
+	assert.Equal(t, 1, snapshot.ObjectCount)
+
+	// Move the object and add another one after the snapshot
+	if _, err = database.DB.Exec(ctx, `UPDATE placeables SET offset_x = 10 WHERE id = $1`, objectId /*$1*/); err != nil {
+		t.Fatal(err)
+	}
+	addedId := createSnapshotObject(t, worldId, classId, 2)
+
+	diffRoute := fmt.Sprintf("/v2/worlds/%s/snapshots/diff?from=%s", worldId, snapshot.Id)
+
+	t.Run("diff lists changes since the snapshot", func(t *testing.T) {
+		var diff model.WorldSnapshotDiff
+		requestWorldSnapshotRoute(t, app, token, "GET", diffRoute, "", &diff)
+
+		if assert.Len(t, diff.Added, 1) {
+			assert.Equal(t, addedId, diff.Added[0].Id)
+		}
+		assert.Empty(t, diff.Removed)
+		if assert.Len(t, diff.Changed, 1) {
+			assert.Equal(t, objectId, diff.Changed[0].Id)
+			assert.Equal(t, []string{"transform"}, diff.Changed[0].Fields)
+		}
+	})
+
+	t.Run("restore brings back the snapshot layout", func(t *testing.T) {
+		var result model.WorldSnapshotRestoreResult
+		requestWorldSnapshotRoute(t, app, token, "POST", fmt.Sprintf("/v2/worlds/%s/snapshots/%s/restore", worldId, snapshot.Id), "", &result)
+
+		assert.Equal(t, 1, result.Restored)
+		assert.Equal(t, 1, result.Removed)
+
+		var diff model.WorldSnapshotDiff
+		requestWorldSnapshotRoute(t, app, token, "GET", diffRoute, "", &diff)
+
+		assert.Empty(t, diff.Added)
+		assert.Empty(t, diff.Removed)
+		assert.Empty(t, diff.Changed)
+
+		var offsetX float64
+		if err = database.DB.QueryRow(ctx, `SELECT offset_x FROM placeables WHERE id = $1`, objectId /*$1*/).Scan(&offsetX); err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, float64(1), offsetX)
+	})
+}
+
+func TestWorldTemplates(t *testing.T) {
+	tests := []struct {
+		name         string
+		method       string
+		route        string
+		expectedCode int
+		admin        bool
+	}{
+		{
+			"get HTTP status 200 for templates",
+			"GET",
+			"/v2/worlds/templates",
+			200,
+			false,
+		},
+		{
+			"get HTTP status 400 for invalid clone world id",
+			"POST",
+			"/v2/worlds/invalid/clone",
+			400,
+			false,
+		},
+		{
+			"get HTTP status 404 for missing clone world",
+			"POST",
+			"/v2/worlds/00000000-0000-4000-8000-000000000001/clone",
+			404,
+			false,
+		},
+		{
+			"get HTTP status 403 for template update by non-admin",
+			"PUT",
+			"/v2/worlds/00000000-0000-4000-8000-000000000001/template",
+			403,
+			false,
+		},
+	}
+
+	app := createApp()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, err := login(app, tt.admin)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			req := httptest.NewRequest(tt.method, tt.route, nil)
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+
+			resp, err := app.Test(req, -1)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !assert.Equal(t, tt.expectedCode, resp.StatusCode, tt.name) {
+				body, err := ioutil.ReadAll(resp.Body)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				jsonStr := string(body)
+
+				fmt.Printf("%s\n", jsonStr)
+			}
+		})
+	}
+}
+
+func TestWorldRoutes(t *testing.T) {
+	tests := []struct {
+		name         string
+		route        string
+		expectedCode int
+		admin        bool
+	}{
+		{
+			"get HTTP status 400 for route without destination",
+			"/v2/worlds/00000000-0000-4000-8000-000000000001/routes",
+			400,
+			false,
+		},
+		{
+			"get HTTP status 404 for route between missing worlds",
+			"/v2/worlds/00000000-0000-4000-8000-000000000001/routes?to=00000000-0000-4000-8000-000000000002",
+			404,
+			true,
+		},
+		{
+			"get HTTP status 404 for route to missing world",
+			"/v2/worlds/XXXXXXXX-XXXX-XXXX-XXXX-XXXXXXXXXXXX/routes?to=00000000-0000-4000-8000-000000000002",
+			404,
+			false,
+		},
+		{
+			"get HTTP status 400 for inbound portals of invalid world id",
+			"/v2/portals/invalid/inbound",
+			400,
+			false,
+		},
+		{
+			"get HTTP status 404 for inbound portals of missing world",
+			"/v2/portals/00000000-0000-4000-8000-000000000001/inbound",
+			404,
+			false,
+		},
 	}
 
 	app := createApp()